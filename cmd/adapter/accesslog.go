@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// accessLog writes one line per call, in logfmt: its method, peer, status
+// code, duration, the bytes of the messages it received and sent, and its
+// request Id. A method with a sampling rate below 1 has only that share of
+// its calls logged, so high-volume reads such as Get can be sampled while
+// every write is logged. Like deadlines, it is always in the chain so a
+// reload can turn it on.
+type accessLog struct {
+	mu      sync.RWMutex
+	enabled bool
+	// Sampling rates by full method name, e.g. /class.Adapter/Get, or by
+	// method name alone for that method of every service; 1 for methods
+	// not listed.
+	rates map[string]float64
+
+	// sample returns a number in [0, 1) to compare a rate with.
+	sample func() float64
+	out    func(line string)
+}
+
+func newAccessLog(enabled bool, rates map[string]float64) *accessLog {
+	a := &accessLog{
+		sample: rand.Float64,
+		out:    func(line string) { log.Print(line) },
+	}
+	a.set(enabled, rates)
+	return a
+}
+
+// set replaces the settings, e.g. on reload.
+func (a *accessLog) set(enabled bool, rates map[string]float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.enabled, a.rates = enabled, rates
+}
+
+// rate returns the share of fullMethod's calls to log, 0 when the access
+// log is off.
+func (a *accessLog) rate(fullMethod string) float64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.enabled {
+		return 0
+	}
+	if r, ok := a.rates[fullMethod]; ok {
+		return r
+	}
+	if r, ok := a.rates[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return r
+	}
+	return 1
+}
+
+// sampled reports whether to log a call of fullMethod, and at what rate.
+func (a *accessLog) sampled(fullMethod string) (float64, bool) {
+	r := a.rate(fullMethod)
+	return r, r >= 1 || (r > 0 && a.sample() < r)
+}
+
+func (a *accessLog) write(ctx context.Context, method string, rate float64, start time.Time, err error, recvBytes, sentBytes int) {
+	addr := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	a.out(fmt.Sprintf("access method=%s peer=%s code=%s duration=%s request_bytes=%d response_bytes=%d request_id=%s sample_rate=%s",
+		method, addr, status.Code(err), time.Since(start), recvBytes, sentBytes,
+		requestIdFromContext(ctx), strconv.FormatFloat(rate, 'g', -1, 64)))
+}
+
+func (a *accessLog) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	rate, ok := a.sampled(info.FullMethod)
+	if !ok {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	a.write(ctx, info.FullMethod, rate, start, err, messageSize(req), messageSize(resp))
+	return resp, err
+}
+
+func (a *accessLog) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	rate, ok := a.sampled(info.FullMethod)
+	if !ok {
+		return handler(srv, ss)
+	}
+	start := time.Now()
+	cs := &countingStream{ServerStream: ss}
+	err := handler(srv, cs)
+	a.write(ss.Context(), info.FullMethod, rate, start, err, cs.recvBytes, cs.sentBytes)
+	return err
+}
+
+// countingStream counts the bytes of the messages a stream receives and
+// sends.
+type countingStream struct {
+	grpc.ServerStream
+	recvBytes, sentBytes int
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recvBytes += messageSize(m)
+	}
+	return err
+}
+
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sentBytes += messageSize(m)
+	}
+	return err
+}
+
+func messageSize(m interface{}) int {
+	if pm, ok := m.(proto.Message); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
+
+// parseSampleRates parses comma-separated Method=rate pairs, where Method
+// is a method name such as Get or a full one such as /class.Adapter/Get
+// and rate is between 0 and 1.
+func parseSampleRates(s string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	if s == "" {
+		return rates, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not Method=rate", pair)
+		}
+		r, err := strconv.ParseFloat(pair[i+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pair[:i], err)
+		}
+		if r < 0 || r > 1 {
+			return nil, fmt.Errorf("%s: rate must be between 0 and 1", pair[:i])
+		}
+		rates[pair[:i]] = r
+	}
+	return rates, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessLog(t *testing.T) {
+	rates, err := parseSampleRates("Get=0.01,/class.Adapter/List=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newAccessLog(true, rates)
+	var lines []string
+	a.out = func(line string) { lines = append(lines, line) }
+	draw := 0.5
+	a.sample = func() float64 { return draw }
+
+	call := func(method string, err error) {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		a.unaryInterceptor(context.Background(), &pb.GetRequest{Id: "MATH101"}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &pb.Class{Id: "MATH101", Name: "Algebra"}, nil
+		})
+	}
+	call("/class.Adapter/Create", status.Error(codes.InvalidArgument, "bad"))
+	call("/class.Adapter/Get", nil)
+	call("/class.Adapter/List", nil)
+	draw = 0.001
+	call("/class.Adapter/Get", nil)
+	call("/class.Adapter/List", nil)
+
+	if len(lines) != 2 {
+		t.Fatalf("logged %q, want the Create and the second Get", lines)
+	}
+	for _, want := range []string{"method=/class.Adapter/Create", "code=InvalidArgument", "request_bytes=9", "response_bytes=0", "sample_rate=1"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("line %q lacks %s", lines[0], want)
+		}
+	}
+	for _, want := range []string{"method=/class.Adapter/Get", "code=OK", "response_bytes=18", "sample_rate=0.01"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("line %q lacks %s", lines[1], want)
+		}
+	}
+
+	a.set(false, rates)
+	call("/class.Adapter/Create", nil)
+	if len(lines) != 2 {
+		t.Errorf("disabled access log logged %q", lines[2:])
+	}
+}
+
+func TestParseSampleRates(t *testing.T) {
+	for _, s := range []string{"Get", "Get=x", "Get=1.5", "Get=-0.1"} {
+		if _, err := parseSampleRates(s); err == nil {
+			t.Errorf("parseSampleRates(%q) succeeded", s)
+		}
+	}
+}
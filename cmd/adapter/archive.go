@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Archived classes are stored whole, with their sections, as
+// archive/<semester>/<id>. Class Ids repeat from one semester to the next,
+// so the archive is keyed by semester first.
+const archivePrefix = "archive/"
+
+// Classes archived per transaction, to stay well inside Badger's limits.
+const archiveBatch = 100
+
+func archiveKey(semester, id string) []byte {
+	return []byte(archivePrefix + semester + "/" + id)
+}
+
+// archiveClasses moves up to archiveBatch classes of semester, after the
+// Id after, into the archive. It returns the classes archived and the last
+// Id it looked at, which is empty once the semester has no more classes.
+// Classes that fail their checksum stay in place for repair.
+func archiveClasses(txn *tenantTxn, semester, after string) (archived []*pb.Class, last string, err error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = semesterIndexKey(semester, "")
+	it := txn.NewIterator(opts)
+	var ids []string
+	for it.Seek(semesterIndexKey(semester, after)); it.Valid() && len(ids) < archiveBatch; it.Next() {
+		id := string(it.Key()[len(opts.Prefix):])
+		if id != after {
+			ids = append(ids, id)
+		}
+	}
+	it.Close()
+
+	for _, id := range ids {
+		if err := txn.ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		last = id
+		c, err := getClass(txn, id)
+		if isCorrupt(err) {
+			log.Printf("Not archiving class %s of tenant %s: it is quarantined", id, txn.tenant)
+			continue
+		}
+		if err == badger.ErrKeyNotFound {
+			// Expired since the index was read.
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("read %s: %w", id, err)
+		}
+		sections, err := listSections(txn, id)
+		if err != nil {
+			return nil, "", err
+		}
+		v, err := proto.Marshal(&pb.ClassBundle{Class: c, Sections: sections})
+		if err != nil {
+			return nil, "", err
+		}
+		if err := txn.Set(archiveKey(semester, id), v); err != nil {
+			return nil, "", fmt.Errorf("put archived class %s: %w", id, err)
+		}
+		if err := removeClass(txn, id); err != nil {
+			return nil, "", err
+		}
+		archived = append(archived, c)
+	}
+	return archived, last, nil
+}
+
+// listArchived reads the archived classes of one semester in ascending Id
+// order.
+func listArchived(txn *tenantTxn, semester string) ([]*pb.Class, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = archiveKey(semester, "")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	classes := make([]*pb.Class, 0)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return classes, err
+		}
+		b := &pb.ClassBundle{}
+		err := it.Item().Value(func(v []byte) error {
+			return proto.Unmarshal(v, b)
+		})
+		if err != nil {
+			return classes, fmt.Errorf("read archived class %s: %w", it.Key(), err)
+		}
+		classes = append(classes, b.Class)
+	}
+	return classes, nil
+}
+
+func (s *server) ArchiveSemester(ctx context.Context, in *pb.ArchiveSemesterRequest) (*pb.ArchiveSemesterResponse, error) {
+	logf(ctx, "ArchiveSemester called for semester %s", in.Semester)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, end, err := s.calendar.bounds(in.Semester)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if time.Now().Before(end) {
+		return nil, preconditionFailed(preconditionSemester, "semesters/"+in.Semester, "semester %s hasn't ended; it ends at %s", in.Semester, end.Format(time.RFC3339))
+	}
+
+	// Each batch commits on its own, so a failed call leaves the semester
+	// partly archived and calling again finishes the job.
+	resp := &pb.ArchiveSemesterResponse{}
+	after := ""
+	for {
+		var archived []*pb.Class
+		var events []*pb.ClassEvent
+		var next string
+		err := s.update(ctx, tenant, func(txn *tenantTxn) error {
+			var err error
+			events = nil
+			archived, next, err = archiveClasses(txn, in.Semester, after)
+			if err != nil {
+				return err
+			}
+			for _, c := range archived {
+				if err := s.audit.record(ctx, txn, "ArchiveSemester", c.Id, c, nil); err != nil {
+					return err
+				}
+				e := newClassEvent(pb.ClassEvent_DELETED, tenant, c)
+				txn.record(e)
+				events = append(events, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, storageError(err)
+		}
+		for _, c := range archived {
+			s.forgetRead(tenant, c.Id)
+		}
+		for _, e := range events {
+			s.emit(e)
+		}
+		resp.ArchivedCount += int64(len(archived))
+		if after = next; after == "" {
+			break
+		}
+	}
+	logf(ctx, "Archived %d classes of semester %s", resp.ArchivedCount, in.Semester)
+	return resp, nil
+}
+
+func (s *server) ListArchived(ctx context.Context, in *pb.ListArchivedRequest) (*pb.Classes, error) {
+	logf(ctx, "ListArchived called for semester %s", in.Semester)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit, after, err := s.checkPage(ctx, "ListArchived", in.PageSize, in.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	cs := &pb.Classes{}
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		classes, err := listArchived(txn, in.Semester)
+		if err != nil {
+			return err
+		}
+		cs.TotalSize = int64(len(classes))
+		cs.Classes, cs.NextPageToken = page(classes, after, limit)
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return cs, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestArchiveSemester(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		calendar, err := parseCalendar(defaultCalendar, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &server{db: newDB(), events: newEventBus(), calendar: calendar, checkInvariants: true}
+		ctx := context.Background()
+		putTestClasses(t, s.db,
+			&pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2020-FALL"},
+			&pb.Class{Id: "MATH102", Name: "Geometry", Semester: "2020-FALL"},
+			&pb.Class{Id: "PHYS101", Name: "Mechanics", Semester: "2021-SPRING"},
+		)
+		b := testBundle()
+		b.Class.Id = "CHEM101"
+		b.Class.Semester = "2020-FALL"
+		if _, err := s.CreateClassBundle(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := s.ArchiveSemester(ctx, &pb.ArchiveSemesterRequest{Semester: "2020-FALL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ArchivedCount != 3 {
+			t.Errorf("archived %d classes, want 3", resp.ArchivedCount)
+		}
+		cs, err := s.List(ctx, &pb.ListRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(cs.Classes); !equalIds(got, []string{"PHYS101"}) || cs.TotalSize != 1 {
+			t.Errorf("List after archiving returned %v (total %d), want [PHYS101]", got, cs.TotalSize)
+		}
+		if _, err := s.GetClassBundle(ctx, &pb.GetRequest{Id: "CHEM101"}); status.Code(err) != codes.NotFound {
+			t.Errorf("GetClassBundle of an archived class returned %v, want NotFound", err)
+		}
+
+		archived, err := s.ListArchived(ctx, &pb.ListArchivedRequest{Semester: "2020-FALL", PageSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(archived.Classes); !equalIds(got, []string{"CHEM101", "MATH101"}) || archived.TotalSize != 3 {
+			t.Errorf("ListArchived returned %v (total %d), want [CHEM101 MATH101] of 3", got, archived.TotalSize)
+		}
+		archived, err = s.ListArchived(ctx, &pb.ListArchivedRequest{Semester: "2020-FALL", PageToken: archived.NextPageToken})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(archived.Classes); !equalIds(got, []string{"MATH102"}) || archived.Classes[0].Name != "Geometry" {
+			t.Errorf("second page of ListArchived returned %v, want MATH102", archived.Classes)
+		}
+
+		// The same Id can be reused in a later semester.
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2021-SPRING"}); err != nil {
+			t.Fatal(err)
+		}
+		if resp, err := s.ArchiveSemester(ctx, &pb.ArchiveSemesterRequest{Semester: "2020-FALL"}); err != nil || resp.ArchivedCount != 0 {
+			t.Errorf("archiving again returned %v, %v, want nothing archived", resp, err)
+		}
+
+		current, _, _ := calendar.at(time.Now())
+		if _, err := s.ArchiveSemester(ctx, &pb.ArchiveSemesterRequest{Semester: current}); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("archiving the current semester returned %v, want FailedPrecondition", err)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	auditPrefix      = "audit/"
+	auditSequenceKey = "meta/audit-seq"
+)
+
+// auditLog records every change to a class in the same transaction as the
+// change, under audit/<id>/<sequence>. Entries are never rewritten; each one
+// is chained to the previous entry for its class by hash so tampering shows
+// up when the history is read back.
+type auditLog struct {
+	seq kvSequence
+}
+
+func newAuditLog(db kvDB) (*auditLog, error) {
+	seq, err := db.GetSequence([]byte(auditSequenceKey), 100)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{seq: seq}, nil
+}
+
+func (a *auditLog) close() {
+	if err := a.seq.Release(); err != nil {
+		log.Printf("Error releasing audit sequence: %s", err)
+	}
+}
+
+func auditClassPrefix(id string) []byte {
+	return []byte(auditPrefix + escapeId(id) + "/")
+}
+
+// record appends an entry for a change made by method to the class id. old
+// is nil for a new class and c is nil for a delete. A nil audit log records
+// nothing.
+func (a *auditLog) record(ctx context.Context, txn *tenantTxn, method, id string, old, c *pb.Class) error {
+	if a == nil {
+		return nil
+	}
+	n, err := a.seq.Next()
+	if err != nil {
+		return err
+	}
+	prev, err := lastAuditHash(txn, id)
+	if err != nil {
+		return err
+	}
+	e := &pb.AuditEntry{
+		Sequence: int64(n),
+		Time:     timestamppb.Now(),
+		Actor:    actorFromContext(ctx),
+		Peer:     peerFromContext(ctx),
+		Method:   method,
+		Id:       id,
+		OldValue: old,
+		NewValue: c,
+		PrevHash: prev,
+		Changes:  diffClasses(old, c),
+	}
+	if e.Hash, err = auditHash(e); err != nil {
+		return err
+	}
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%020d", auditClassPrefix(id), n)
+	if err := txn.Set([]byte(key), b); err != nil {
+		return fmt.Errorf("put audit entry %s: %w", key, err)
+	}
+	return nil
+}
+
+// auditHash hashes e with its Hash field cleared.
+func auditHash(e *pb.AuditEntry) ([]byte, error) {
+	e = proto.Clone(e).(*pb.AuditEntry)
+	e.Hash = nil
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// lastAuditHash returns the hash of the newest entry for id, or nil if the
+// class has no history.
+func lastAuditHash(txn *tenantTxn, id string) ([]byte, error) {
+	prefix := auditClassPrefix(id)
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	it.Seek(append(prefix, 0xff))
+	if !it.ValidForPrefix(prefix) {
+		return nil, nil
+	}
+	e := &pb.AuditEntry{}
+	err := it.Item().Value(func(v []byte) error {
+		return proto.Unmarshal(v, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.Hash, nil
+}
+
+// readAuditLog returns the history of id oldest first, failing with DataLoss
+// if any entry doesn't match its hash or the one before it.
+func readAuditLog(txn *tenantTxn, id string) ([]*pb.AuditEntry, error) {
+	prefix := auditClassPrefix(id)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	entries := make([]*pb.AuditEntry, 0)
+	var prev []byte
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return nil, err
+		}
+		e := &pb.AuditEntry{}
+		err := it.Item().Value(func(v []byte) error {
+			return proto.Unmarshal(v, e)
+		})
+		if err != nil {
+			return nil, err
+		}
+		sum, err := auditHash(e)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(e.PrevHash, prev) || !bytes.Equal(e.Hash, sum) {
+			log.Printf("Audit log for %s fails verification at sequence %d", id, e.Sequence)
+			return nil, status.Errorf(codes.DataLoss, "audit log for %s fails verification at sequence %d", id, e.Sequence)
+		}
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// actorFromContext identifies the caller by a digest of its bearer token, so
+// the log names who made a change without storing credentials.
+func actorFromContext(ctx context.Context) string {
+	token, ok := ctx.Value(tokenKey{}).(string)
+	if !ok {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:8])
+}
+
+func peerFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+func (s *server) GetAuditLog(ctx context.Context, in *pb.AuditLogRequest) (*pb.AuditLog, error) {
+	logf(ctx, "GetAuditLog called for Id %s", in.Id)
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.AuditLog{}
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		resp.Entries, err = readAuditLog(txn, in.Id)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// auditKeys returns the keys of id's audit entries, oldest first.
+func auditKeys(t *testing.T, db kvDB, id string) [][]byte {
+	t.Helper()
+	var keys [][]byte
+	err := db.View(func(txn kvTxn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = auditClassPrefix(id)
+		it := newTenantTxn(txn, defaultTenant).NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestAuditLog(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		var err error
+		if s.audit, err = newAuditLog(s.db); err != nil {
+			t.Fatal(err)
+		}
+		defer s.audit.close()
+		alice := context.WithValue(context.Background(), tokenKey{}, "alice-token")
+		ctx := context.Background()
+
+		if _, err := s.Create(alice, &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I", ValidateOnly: true}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Create(tenantContext("other"), &pb.Class{Id: "MATH101", Name: "Calculus"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Validate-only calls and other tenants' changes aren't in the
+		// class's history; the history outlives the class.
+		log, err := s.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			method   string
+			old, new string
+		}{
+			{"Create", "", "Algebra"},
+			{"Update", "Algebra", "Algebra I"},
+			{"Delete", "Algebra I", ""},
+		}
+		if len(log.Entries) != len(want) {
+			t.Fatalf("GetAuditLog returned %d entries, want %d: %v", len(log.Entries), len(want), log.Entries)
+		}
+		for i, e := range log.Entries {
+			if e.Method != want[i].method || e.OldValue.GetName() != want[i].old || e.NewValue.GetName() != want[i].new {
+				t.Errorf("entry %d is %s from %q to %q, want %s from %q to %q", i, e.Method, e.OldValue.GetName(), e.NewValue.GetName(), want[i].method, want[i].old, want[i].new)
+			}
+			if i > 0 && e.Sequence <= log.Entries[i-1].Sequence {
+				t.Errorf("entry %d has sequence %d after %d", i, e.Sequence, log.Entries[i-1].Sequence)
+			}
+		}
+		if a := log.Entries[0].Actor; a != actorFromContext(alice) || a == "anonymous" {
+			t.Errorf("Create was recorded by %q, want alice's token digest", a)
+		}
+		if a := log.Entries[1].Actor; a != "anonymous" {
+			t.Errorf("Update without a token was recorded by %q, want anonymous", a)
+		}
+
+		// Editing an entry, or removing one, breaks the chain.
+		keys := auditKeys(t, s.db, "MATH101")
+		edited := proto.Clone(log.Entries[1]).(*pb.AuditEntry)
+		edited.Actor = actorFromContext(alice)
+		b, err := proto.Marshal(edited)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.db.Update(func(txn kvTxn) error {
+			return newTenantTxn(txn, defaultTenant).Set(keys[1], b)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "MATH101"}); status.Code(err) != codes.DataLoss {
+			t.Errorf("GetAuditLog of an edited entry returned %v, want DataLoss", err)
+		}
+		// Even with its hash recomputed, the entry after it no longer
+		// follows it.
+		if edited.Hash, err = auditHash(edited); err != nil {
+			t.Fatal(err)
+		}
+		if b, err = proto.Marshal(edited); err != nil {
+			t.Fatal(err)
+		}
+		err = s.db.Update(func(txn kvTxn) error {
+			return newTenantTxn(txn, defaultTenant).Set(keys[1], b)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "MATH101"}); status.Code(err) != codes.DataLoss {
+			t.Errorf("GetAuditLog of a rehashed entry returned %v, want DataLoss", err)
+		}
+		err = s.db.Update(func(txn kvTxn) error {
+			return newTenantTxn(txn, defaultTenant).Delete(keys[1])
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "MATH101"}); status.Code(err) != codes.DataLoss {
+			t.Errorf("GetAuditLog with an entry removed returned %v, want DataLoss", err)
+		}
+
+		if log, err := s.GetAuditLog(tenantContext("other"), &pb.AuditLogRequest{Id: "MATH101"}); err != nil || len(log.Entries) != 1 {
+			t.Errorf("the other tenant's GetAuditLog returned %v, %v; want its one entry", log, err)
+		}
+		regular := context.WithValue(context.Background(), roleKey{}, "")
+		if _, err := s.GetAuditLog(regular, &pb.AuditLogRequest{Id: "MATH101"}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("GetAuditLog with a regular token returned %v, want PermissionDenied", err)
+		}
+	})
+}
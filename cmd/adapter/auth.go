@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+const (
+	adminRole = "admin"
+	// Stats tokens may only read aggregate statistics.
+	statsRole = "stats"
+)
+
+var statsMethods = map[string]bool{
+	"/class.Adapter/GetAggregateStats": true,
+}
+
+// serverMethods describe the server rather than a tenant's data, so a token
+// may call them whichever tenants it was granted.
+var serverMethods = map[string]bool{
+	"/class.Adapter/GetClientPolicy":  true,
+	"/class.Adapter/GetServerInfo":    true,
+	"/class.Adapter/GetApiDescriptor": true,
+	"/class.Adapter/DescribeSchema":   true,
+}
+
+// tokenAuth accepts requests carrying one of a set of bearer tokens in the
+// authorization metadata. Health checks are always allowed so probes don't
+// need credentials. With no tokens file every request is accepted.
+type tokenAuth struct {
+	mu sync.RWMutex
+	// tokens maps each accepted token to what it may do; nil when
+	// authentication is disabled.
+	tokens map[string]tokenGrant
+}
+
+// tokenGrant is what a token may do.
+type tokenGrant struct {
+	// role is adminRole, statsRole, or empty for regular clients.
+	role string
+	// tenants are those the token may name in x-tenant-id, or nil for any.
+	tenants map[string]bool
+}
+
+// allows reports whether the token may act for tenant.
+func (g tokenGrant) allows(tenant string) bool {
+	return g.tenants == nil || g.tenants[tenant]
+}
+
+type roleKey struct{}
+
+// tokenKey carries the caller's bearer token, identifying it in the audit log.
+type tokenKey struct{}
+
+// grantKey carries the caller's tokenGrant, for methods naming a tenant in
+// the request rather than in x-tenant-id.
+type grantKey struct{}
+
+// allowsTenant reports whether the caller may act for tenant. Without
+// -auth-tokens-file every caller may.
+func allowsTenant(ctx context.Context, tenant string) bool {
+	g, ok := ctx.Value(grantKey{}).(tokenGrant)
+	return !ok || g.allows(tenant)
+}
+
+// newTokenAuth accepts the tokens listed in path, or every request if path
+// is empty.
+func newTokenAuth(path string) (*tokenAuth, error) {
+	a := &tokenAuth{}
+	return a, a.load(path)
+}
+
+// load replaces the accepted tokens with those in path, keeping the current
+// ones if the file can't be read.
+func (a *tokenAuth) load(path string) error {
+	var tokens map[string]tokenGrant
+	if path != "" {
+		var err error
+		if tokens, err = readTokens(path); err != nil {
+			return err
+		}
+	}
+	a.mu.Lock()
+	a.tokens = tokens
+	a.mu.Unlock()
+	return nil
+}
+
+// readTokens reads one token per line from path, optionally followed by a
+// role ("admin" or "stats") and by "tenants=" with a comma-separated list of
+// the tenants it may use, or "*" for any. Without one an admin token may use
+// any tenant and other tokens only defaultTenant. Blank lines and # comments
+// are skipped.
+func readTokens(path string) (map[string]tokenGrant, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(map[string]tokenGrant)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		g, err := parseGrant(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid token line %q: %v", path, line, err)
+		}
+		tokens[fields[0]] = g
+	}
+	return tokens, sc.Err()
+}
+
+// parseGrant parses the fields following a token on its line.
+func parseGrant(fields []string) (tokenGrant, error) {
+	var g tokenGrant
+	if len(fields) > 0 && (fields[0] == adminRole || fields[0] == statsRole) {
+		g.role, fields = fields[0], fields[1:]
+	}
+	switch {
+	case len(fields) == 0:
+		if g.role != adminRole {
+			g.tenants = map[string]bool{defaultTenant: true}
+		}
+		return g, nil
+	case len(fields) > 1 || !strings.HasPrefix(fields[0], "tenants="):
+		return g, fmt.Errorf("want a token, an optional role and optional tenants=")
+	}
+	list := strings.TrimPrefix(fields[0], "tenants=")
+	if list == "*" {
+		return g, nil
+	}
+	g.tenants = make(map[string]bool)
+	for _, tenant := range strings.Split(list, ",") {
+		if !tenantPattern.MatchString(tenant) {
+			return g, fmt.Errorf("tenant %q must match %s", tenant, tenantPattern)
+		}
+		g.tenants[tenant] = true
+	}
+	return g, nil
+}
+
+// authorize returns ctx annotated with the caller's role. A token may only
+// be used for the tenants it was granted.
+func (a *tokenAuth) authorize(ctx context.Context, method string) (context.Context, error) {
+	a.mu.RLock()
+	tokens := a.tokens
+	a.mu.RUnlock()
+	if tokens == nil || strings.HasPrefix(method, healthServicePrefix) {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if !strings.HasPrefix(v, "Bearer ") {
+			continue
+		}
+		token := strings.TrimPrefix(v, "Bearer ")
+		if g, ok := tokens[token]; ok {
+			if g.role == statsRole && !statsMethods[method] {
+				return nil, status.Error(codes.PermissionDenied, "stats tokens may only read aggregate statistics")
+			}
+			// An invalid tenant is left for the handler to reject as
+			// InvalidArgument.
+			if tenant, err := tenantFromContext(ctx); err == nil && !serverMethods[method] && !g.allows(tenant) {
+				return nil, status.Errorf(codes.PermissionDenied, "token may not be used for tenant %s", tenant)
+			}
+			ctx = context.WithValue(ctx, tokenKey{}, token)
+			ctx = context.WithValue(ctx, grantKey{}, g)
+			return context.WithValue(ctx, roleKey{}, g.role), nil
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+// authorizeHTTP checks the bearer token of a request for tenant to an HTTP
+// endpoint serving class data, returning http.StatusOK or the status to fail
+// with. Stats tokens are refused, since they may only read aggregate
+// statistics.
+func (a *tokenAuth) authorizeHTTP(r *http.Request, tenant string) (int, string) {
+	a.mu.RLock()
+	tokens := a.tokens
+	a.mu.RUnlock()
+	if tokens == nil {
+		return http.StatusOK, ""
+	}
+	v := r.Header.Get("Authorization")
+	g, ok := tokens[strings.TrimPrefix(v, "Bearer ")]
+	switch {
+	case !strings.HasPrefix(v, "Bearer ") || !ok:
+		return http.StatusUnauthorized, "missing or invalid bearer token"
+	case g.role == statsRole:
+		return http.StatusForbidden, "stats tokens may only read aggregate statistics"
+	case !g.allows(tenant):
+		return http.StatusForbidden, "token may not be used for tenant " + tenant
+	}
+	return http.StatusOK, ""
+}
+
+// requireAdmin fails unless the caller authenticated with an admin token.
+// Without -auth-tokens-file every caller is trusted.
+func requireAdmin(ctx context.Context) error {
+	role, authenticated := ctx.Value(roleKey{}).(string)
+	if authenticated && role != adminRole {
+		return status.Error(codes.PermissionDenied, "admin token required")
+	}
+	return nil
+}
+
+func (a *tokenAuth) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *tokenAuth) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/dgraph-io/badger/v2/options"
+)
+
+// badgerFlags tune the Badger driver. Their defaults match Badger's.
+type badgerFlags struct {
+	valueLogFileSize int64
+	memTableSize     int64
+	compression      string
+	numCompactors    int
+	syncWrites       bool
+}
+
+var compressionTypes = map[string]options.CompressionType{
+	"none":   options.None,
+	"snappy": options.Snappy,
+	"zstd":   options.ZSTD,
+}
+
+func registerBadgerFlags(fs *flag.FlagSet) *badgerFlags {
+	d := badger.DefaultOptions("")
+	f := &badgerFlags{}
+	fs.Int64Var(&f.valueLogFileSize, "badger-value-log-file-size", d.ValueLogFileSize, "largest value log file in bytes before Badger starts a new one")
+	fs.Int64Var(&f.memTableSize, "badger-memtable-size", d.MaxTableSize, "size in bytes of each memtable, and of the tables it is flushed to")
+	fs.StringVar(&f.compression, "badger-compression", "none", "how Badger compresses table blocks: none, snappy or zstd (zstd needs a cgo build)")
+	fs.IntVar(&f.numCompactors, "badger-num-compactors", d.NumCompactors, "number of compaction workers, at least 2")
+	fs.BoolVar(&f.syncWrites, "badger-sync-writes", d.SyncWrites, "sync every write to disk before acknowledging it, so a power loss can't lose it")
+	return f
+}
+
+func (f *badgerFlags) validate() error {
+	if _, ok := compressionTypes[f.compression]; !ok {
+		return fmt.Errorf("invalid -badger-compression %q, must be none, snappy or zstd", f.compression)
+	}
+	if f.numCompactors < 2 {
+		return fmt.Errorf("-badger-num-compactors must be at least 2")
+	}
+	return nil
+}
+
+// apply sets the flags' values in opts.
+func (f *badgerFlags) apply(opts badger.Options) (badger.Options, error) {
+	if err := f.validate(); err != nil {
+		return opts, err
+	}
+	return opts.
+		WithValueLogFileSize(f.valueLogFileSize).
+		WithMaxTableSize(f.memTableSize).
+		WithCompression(compressionTypes[f.compression]).
+		WithNumCompactors(f.numCompactors).
+		WithSyncWrites(f.syncWrites), nil
+}
+
+func logBadgerOptions(opts badger.Options) {
+	compression := "none"
+	for name, c := range compressionTypes {
+		if c == opts.Compression {
+			compression = name
+		}
+	}
+	log.Printf("Badger options: value log file size %d, memtable size %d, compression %s, %d compactors, sync writes %t, encrypted %t",
+		opts.ValueLogFileSize, opts.MaxTableSize, compression, opts.NumCompactors, opts.SyncWrites, len(opts.EncryptionKey) > 0)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/dgraph-io/badger/v2/options"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func TestBadgerFlags(t *testing.T) {
+	parse := func(args ...string) *badgerFlags {
+		t.Helper()
+		fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		f := registerBadgerFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	// The defaults leave Badger's options as they were.
+	d := badger.DefaultOptions("")
+	opts, err := parse().apply(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ValueLogFileSize != d.ValueLogFileSize || opts.MaxTableSize != d.MaxTableSize || opts.Compression != d.Compression ||
+		opts.NumCompactors != d.NumCompactors || opts.SyncWrites != d.SyncWrites {
+		t.Errorf("the default flags changed Badger's options to %+v", opts)
+	}
+
+	f := parse("-badger-value-log-file-size", "1048576", "-badger-memtable-size", "2097152",
+		"-badger-compression", "snappy", "-badger-num-compactors", "3", "-badger-sync-writes=false")
+	if opts, err = f.apply(d); err != nil {
+		t.Fatal(err)
+	}
+	if opts.ValueLogFileSize != 1<<20 || opts.MaxTableSize != 2<<20 || opts.Compression != options.Snappy || opts.NumCompactors != 3 || opts.SyncWrites {
+		t.Errorf("the flags set Badger's options to %+v", opts)
+	}
+
+	for _, args := range [][]string{
+		{"-badger-compression", "lz4"},
+		{"-badger-num-compactors", "1"},
+	} {
+		if _, err := parse(args...).apply(d); err == nil {
+			t.Errorf("apply of %v succeeded", args)
+		}
+		if _, err := openDB(driverBadger, dbOptions{dir: t.TempDir(), badger: parse(args...)}); err == nil {
+			t.Errorf("openDB with %v succeeded", args)
+		}
+	}
+
+	// openDB logs the options it opens Badger with.
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	db, err := openDB(driverBadger, dbOptions{dir: t.TempDir(), badger: f})
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	putTestClasses(t, db, &pb.Class{Id: "MATH101", Name: "Algebra"})
+	want := "value log file size 1048576, memtable size 2097152, compression snappy, 3 compactors, sync writes false"
+	if !strings.Contains(logged.String(), want) {
+		t.Errorf("openDB logged %q, want it to mention %q", logged.String(), want)
+	}
+}
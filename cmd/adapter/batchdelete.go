@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// Most Ids a DeleteFilter may list.
+const maxBatchDeleteIds = 1000
+
+func (v *violations) checkDeleteFilter(f *pb.DeleteFilter) {
+	if f.Semester == "" && f.IdPrefix == "" && len(f.Ids) == 0 {
+		v.add("filter", "must set semester, id_prefix or ids")
+	}
+	v.checkSemester(f.Semester)
+	if len(f.IdPrefix) > maxIdLength {
+		v.add("id_prefix", "must be at most %d characters", maxIdLength)
+	}
+	if len(f.Ids) > maxBatchDeleteIds {
+		v.add("ids", "must have at most %d Ids", maxBatchDeleteIds)
+	}
+	for i, id := range f.Ids {
+		v.checkIdAs(fmt.Sprintf("ids[%d]", i), id)
+	}
+}
+
+// matchesDeleteFilter reports whether c, as stored, matches every filter
+// that is set.
+func matchesDeleteFilter(f *pb.DeleteFilter, ids map[string]bool, c *pb.Class) bool {
+	if f.Semester != "" && c.Semester != f.Semester {
+		return false
+	}
+	if len(ids) > 0 && !ids[c.Id] {
+		return false
+	}
+	return strings.HasPrefix(c.Id, f.IdPrefix)
+}
+
+// deleteCandidates returns, in ascending order, the Ids of the classes
+// that may match f, read from the cheapest source the filter allows
+// without reading any class.
+func deleteCandidates(txn *tenantTxn, f *pb.DeleteFilter) ([]string, error) {
+	if len(f.Ids) > 0 {
+		ids := append([]string(nil), f.Ids...)
+		sort.Strings(ids)
+		return ids, nil
+	}
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	if f.Semester != "" {
+		opts.Prefix = semesterIndexKey(f.Semester, "")
+	} else {
+		opts.Prefix = classKey(f.IdPrefix, "")
+		opts.Prefix = opts.Prefix[:len(opts.Prefix)-len(delim)]
+	}
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var ids []string
+	suffix := []byte(delim + "Name")
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return nil, err
+		}
+		k := it.Key()
+		switch {
+		case f.Semester != "":
+			ids = append(ids, string(k[len(opts.Prefix):]))
+		case bytes.HasSuffix(k, suffix):
+			ids = append(ids, unescapeId(string(k[len(classKeyPrefix):len(k)-len(suffix)])))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// batchDeleteError adds to err, the failure of a BatchDelete batch, how many
+// classes the batches committed before it deleted. Those stay deleted, as
+// a call split into batches isn't atomic, and an ErrorInfo tells clients how
+// many there were.
+func batchDeleteError(err error, deleted int64) error {
+	if deleted == 0 {
+		return err
+	}
+	st := status.Convert(err).Proto()
+	st.Message = fmt.Sprintf("deleted %d classes before failing: %s", deleted, st.Message)
+	return withDetails(status.FromProto(st), &errdetails.ErrorInfo{
+		Reason:   "BATCH_DELETE_INCOMPLETE",
+		Domain:   "class.Adapter",
+		Metadata: map[string]string{"deleted_count": strconv.FormatInt(deleted, 10)},
+	}).Err()
+}
+
+func (s *server) BatchDelete(ctx context.Context, in *pb.DeleteFilter) (*pb.BatchDeleteResponse, error) {
+	logf(ctx, "BatchDelete called for semester %q, Id prefix %q and %d Ids", in.Semester, in.IdPrefix, len(in.Ids))
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(in.Ids))
+	for _, id := range in.Ids {
+		ids[id] = true
+	}
+	var candidates []string
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		candidates, err = deleteCandidates(txn, in)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	// Classes are deleted in one transaction, so the call is atomic, and
+	// every deletion is audited and published with the class it removes.
+	// Only when they don't fit in one are they deleted in batches like
+	// ArchiveSemester archives them, each in a transaction of its own. Each
+	// class is checked against the filter again as its batch reads it.
+	resp := &pb.BatchDeleteResponse{}
+	size := len(candidates)
+	for len(candidates) > 0 {
+		n := size
+		if n > len(candidates) {
+			n = len(candidates)
+		}
+		batch := candidates[:n]
+
+		var events []*pb.ClassEvent
+		var deleted []string
+		err := s.update(ctx, tenant, func(txn *tenantTxn) error {
+			events, deleted = nil, nil
+			for _, id := range batch {
+				c, err := allowCorrupt(getClass(txn, id))
+				if err == badger.ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if !matchesDeleteFilter(in, ids, c) {
+					continue
+				}
+				if err := checkEditLease(txn, id, ""); err != nil {
+					return err
+				}
+				deleted = append(deleted, id)
+				if in.ValidateOnly {
+					continue
+				}
+				if err := removeClass(txn, id); err != nil {
+					return err
+				}
+				if err := s.audit.record(ctx, txn, "BatchDelete", id, c, nil); err != nil {
+					return err
+				}
+				e := newClassEvent(pb.ClassEvent_DELETED, tenant, c)
+				txn.record(e)
+				events = append(events, e)
+			}
+			if in.ValidateOnly {
+				return errValidateOnly
+			}
+			return nil
+		})
+		if errors.Is(err, badger.ErrTxnTooBig) && size > archiveBatch {
+			logf(ctx, "BatchDelete of %d classes is too big for one transaction, deleting them in batches of %d", n, archiveBatch)
+			size = archiveBatch
+			continue
+		}
+		if err != nil && err != errValidateOnly {
+			return nil, batchDeleteError(storageError(err), resp.DeletedCount)
+		}
+		candidates = candidates[n:]
+		for _, id := range deleted {
+			s.forgetRead(tenant, id)
+		}
+		for _, e := range events {
+			s.emit(e)
+		}
+		resp.DeletedCount += int64(len(deleted))
+	}
+	logf(ctx, "BatchDelete deleted %d classes", resp.DeletedCount)
+	return resp, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBatchDelete(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		putTestClasses(t, s.db,
+			&pb.Class{Id: "ART100", Semester: "2024-FALL"},
+			&pb.Class{Id: "MATH101", Semester: "2024-FALL"},
+			&pb.Class{Id: "MATH102", Semester: "2024-FALL"},
+			&pb.Class{Id: "MATH201", Semester: "2025-SPRING"},
+			&pb.Class{Id: "PHYS101", Semester: "2025-SPRING"},
+		)
+		if _, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: "s1"}); err != nil {
+			t.Fatal(err)
+		}
+		list := func() []string {
+			cs, err := s.List(ctx, &pb.ListRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ids(cs.Classes)
+		}
+
+		resp, err := s.BatchDelete(ctx, &pb.DeleteFilter{Semester: "2024-FALL", IdPrefix: "MATH", ValidateOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.DeletedCount != 2 || len(list()) != 5 {
+			t.Errorf("validate_only BatchDelete counted %d and left %v, want 2 and nothing deleted", resp.DeletedCount, list())
+		}
+
+		tests := []struct {
+			filter *pb.DeleteFilter
+			count  int64
+			left   []string
+		}{
+			{&pb.DeleteFilter{Semester: "2024-FALL", IdPrefix: "MATH"}, 2, []string{"ART100", "MATH201", "PHYS101"}},
+			{&pb.DeleteFilter{IdPrefix: "MATH"}, 1, []string{"ART100", "PHYS101"}},
+			{&pb.DeleteFilter{Ids: []string{"PHYS101", "NOPE"}, Semester: "2025-SPRING"}, 1, []string{"ART100"}},
+		}
+		for _, tt := range tests {
+			resp, err := s.BatchDelete(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("BatchDelete(%v): %v", tt.filter, err)
+			}
+			if got := list(); resp.DeletedCount != tt.count || !equalIds(got, tt.left) {
+				t.Errorf("BatchDelete(%v) deleted %d leaving %v, want %d leaving %v", tt.filter, resp.DeletedCount, got, tt.count, tt.left)
+			}
+		}
+
+		if err := validateRequest("/class.Adapter/BatchDelete", &pb.DeleteFilter{}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("BatchDelete without a filter returned %v, want InvalidArgument", err)
+		}
+	})
+}
+
+// smallTxnDB fails transactions deleting more than maxDeletes keys with
+// badger.ErrTxnTooBig, as Badger does those past its size limit, and counts
+// the keys the last transaction deleted.
+type smallTxnDB struct {
+	kvDB
+	maxDeletes int
+	deleted    *int
+}
+
+func (db smallTxnDB) Update(fn func(txn kvTxn) error) error {
+	*db.deleted = 0
+	return db.kvDB.Update(func(txn kvTxn) error {
+		return fn(&smallTxn{kvTxn: txn, db: db})
+	})
+}
+
+type smallTxn struct {
+	kvTxn
+	db smallTxnDB
+}
+
+func (txn *smallTxn) Delete(key []byte) error {
+	if *txn.db.deleted == txn.db.maxDeletes {
+		return badger.ErrTxnTooBig
+	}
+	*txn.db.deleted++
+	return txn.kvTxn.Delete(key)
+}
+
+func TestBatchDeleteAtomic(t *testing.T) {
+	f := newFaultInjector(10, 0, 0)
+	// The transaction deleting the classes fails.
+	var txns int
+	f.sample = func() float64 {
+		if txns++; txns == 2 {
+			return 0
+		}
+		return 0.5
+	}
+	db := newTestDB(t, driverBadger, t.TempDir())
+	s := &server{db: faultyDB{db, f}, events: newEventBus()}
+	var classes []*pb.Class
+	for i := 0; i < archiveBatch+10; i++ {
+		classes = append(classes, &pb.Class{Id: fmt.Sprintf("MATH%03d", i), Semester: "2024-FALL"})
+	}
+	putTestClasses(t, db, classes...)
+
+	_, err := s.BatchDelete(context.Background(), &pb.DeleteFilter{IdPrefix: "MATH"})
+	if status.Code(err) != codes.Unavailable || strings.Contains(status.Convert(err).Message(), "deleted") {
+		t.Fatalf("BatchDelete failing its transaction returned %v", err)
+	}
+	for _, d := range status.Convert(err).Details() {
+		if _, ok := d.(*errdetails.ErrorInfo); ok {
+			t.Errorf("BatchDelete that deleted nothing returned %v", d)
+		}
+	}
+	cs, err := s.List(context.Background(), &pb.ListRequest{})
+	if err != nil || len(cs.Classes) != archiveBatch+10 {
+		t.Errorf("after a failed BatchDelete, List returned %d classes, %v; want all %d", len(cs.GetClasses()), err, archiveBatch+10)
+	}
+	resp, err := s.BatchDelete(context.Background(), &pb.DeleteFilter{IdPrefix: "MATH"})
+	if err != nil || resp.DeletedCount != archiveBatch+10 {
+		t.Errorf("BatchDelete = %v, %v; want %d deleted", resp, err, archiveBatch+10)
+	}
+}
+
+func TestBatchDeletePartialFailure(t *testing.T) {
+	f := newFaultInjector(10, 0, 0)
+	// The classes don't fit in one transaction, and only the transaction
+	// of the second batch fails.
+	var txns int
+	f.sample = func() float64 {
+		if txns++; txns == 4 {
+			return 0
+		}
+		return 0.5
+	}
+	db := newTestDB(t, driverBadger, t.TempDir())
+	var classes []*pb.Class
+	for i := 0; i < archiveBatch+10; i++ {
+		classes = append(classes, &pb.Class{Id: fmt.Sprintf("MATH%03d", i), Semester: "2024-FALL"})
+	}
+	putTestClasses(t, db, classes...)
+	// A transaction has room for the deletes of a few more classes than a
+	// batch, but not of every class.
+	var deleted int
+	probe := &server{db: smallTxnDB{newTestDB(t, driverBadger, t.TempDir()), -1, &deleted}, events: newEventBus()}
+	putTestClasses(t, probe.db, classes[:archiveBatch+5]...)
+	if _, err := probe.BatchDelete(context.Background(), &pb.DeleteFilter{IdPrefix: "MATH"}); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{db: faultyDB{smallTxnDB{db, deleted, &deleted}, f}, events: newEventBus()}
+
+	_, err := s.BatchDelete(context.Background(), &pb.DeleteFilter{IdPrefix: "MATH"})
+	if status.Code(err) != codes.Unavailable || !strings.Contains(status.Convert(err).Message(), fmt.Sprintf("deleted %d classes", archiveBatch)) {
+		t.Fatalf("BatchDelete failing its second batch returned %v", err)
+	}
+	var info *errdetails.ErrorInfo
+	for _, d := range status.Convert(err).Details() {
+		if d, ok := d.(*errdetails.ErrorInfo); ok {
+			info = d
+		}
+	}
+	if info == nil || info.Reason != "BATCH_DELETE_INCOMPLETE" || info.Metadata["deleted_count"] != strconv.Itoa(archiveBatch) {
+		t.Errorf("BatchDelete error carries %v, want an ErrorInfo counting %d deletions", info, archiveBatch)
+	}
+
+	// The first batch stays deleted, and calling again deletes the rest.
+	resp, err := s.BatchDelete(context.Background(), &pb.DeleteFilter{IdPrefix: "MATH"})
+	if err != nil || resp.DeletedCount != 10 {
+		t.Errorf("BatchDelete after a partial failure = %v, %v; want 10 deleted", resp, err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Sections are stored whole, one key per section, as
+// section/<class id>/<section id>.
+const sectionPrefix = "section/"
+
+const (
+	maxSections       = 100
+	maxRosterSize     = 1000
+	maxMeetings       = 20
+	maxLocationLength = 128
+	meetingTimeLayout = "15:04"
+)
+
+func sectionKey(classId, sectionId string) []byte {
+	return []byte(sectionPrefix + escapeId(classId) + "/" + sectionId)
+}
+
+func putSection(txn *tenantTxn, classId string, sec *pb.Section) error {
+	v, err := proto.Marshal(sec)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(sectionKey(classId, sec.Id), v); err != nil {
+		return fmt.Errorf("put section %s of %s: %w", sec.Id, classId, err)
+	}
+	return nil
+}
+
+// listSections reads the sections of a class in ascending Id order.
+func listSections(txn *tenantTxn, classId string) ([]*pb.Section, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = sectionKey(classId, "")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var sections []*pb.Section
+	for it.Rewind(); it.Valid(); it.Next() {
+		sec := &pb.Section{}
+		err := it.Item().Value(func(v []byte) error {
+			return proto.Unmarshal(v, sec)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read section %s: %w", it.Key(), err)
+		}
+		sections = append(sections, sec)
+	}
+	return sections, nil
+}
+
+// deleteSections removes every section of a class.
+func deleteSections(txn *tenantTxn, classId string) error {
+	return deletePrefix(txn, sectionKey(classId, ""))
+}
+
+// deletePrefix removes every key that starts with prefix.
+func deletePrefix(txn *tenantTxn, prefix []byte) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	var keys []string
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+	for _, k := range keys {
+		if err := txn.Delete([]byte(k)); err != nil {
+			return fmt.Errorf("delete %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+func (v *violations) checkBundle(b *pb.ClassBundle) {
+	if b.Class == nil {
+		v.add("class", "must be set")
+	} else {
+		v.within("class", func(v *violations) {
+			v.checkClass(b.Class)
+		})
+	}
+	if len(b.Sections) > maxSections {
+		v.add("sections", "must have at most %d sections", maxSections)
+	}
+	seen := make(map[string]bool)
+	for i, sec := range b.Sections {
+		v.within(fmt.Sprintf("sections[%d]", i), func(v *violations) {
+			v.checkId(sec.Id)
+			if seen[sec.Id] {
+				v.add("id", "duplicates another section's Id")
+			}
+			seen[sec.Id] = true
+			v.checkRoster(sec.StudentIds)
+			v.checkMeetings(sec.Meetings)
+		})
+	}
+}
+
+func (v *violations) checkRoster(students []string) {
+	if len(students) > maxRosterSize {
+		v.add("student_ids", "must have at most %d students", maxRosterSize)
+	}
+	seen := make(map[string]bool)
+	for i, id := range students {
+		field := fmt.Sprintf("student_ids[%d]", i)
+		switch {
+		case id == "":
+			v.add(field, "must not be empty")
+		case len(id) > maxIdLength:
+			v.add(field, "must be at most %d characters", maxIdLength)
+		case seen[id]:
+			v.add(field, "student %s is listed twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func (v *violations) checkMeetings(meetings []*pb.Meeting) {
+	if len(meetings) > maxMeetings {
+		v.add("meetings", "must have at most %d meetings", maxMeetings)
+	}
+	for i, m := range meetings {
+		v.within(fmt.Sprintf("meetings[%d]", i), func(v *violations) {
+			v.checkMeeting(m)
+		})
+	}
+}
+
+func (v *violations) checkMeeting(m *pb.Meeting) {
+	if _, ok := pb.Meeting_Day_name[int32(m.Day)]; !ok || m.Day == pb.Meeting_DAY_UNSPECIFIED {
+		v.add("day", "must be a day of the week")
+	}
+	start, err := time.Parse(meetingTimeLayout, m.StartTime)
+	if err != nil {
+		v.add("start_time", "must be a 24-hour HH:MM time")
+	}
+	end, err2 := time.Parse(meetingTimeLayout, m.EndTime)
+	if err2 != nil {
+		v.add("end_time", "must be a 24-hour HH:MM time")
+	}
+	if err == nil && err2 == nil && !end.After(start) {
+		v.add("end_time", "must be after start_time")
+	}
+	if len(m.Location) > maxLocationLength {
+		v.add("location", "must be at most %d characters", maxLocationLength)
+	}
+}
+
+func (s *server) CreateClassBundle(ctx context.Context, in *pb.ClassBundle) (*pb.ClassBundle, error) {
+	logf(ctx, "CreateClassBundle called for Id %s with %d sections", in.GetClass().GetId(), len(in.Sections))
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := proto.Clone(in.Class).(*pb.Class)
+	c.LeaseToken = ""
+	c.UpdateMask = nil
+	c.ValidateOnly = false
+	var event *pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		exists, err := classExists(txn, c.Id)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return status.Errorf(codes.AlreadyExists, "class %s already exists", c.Id)
+		}
+		if err := checkReferences(txn, c); err != nil {
+			return err
+		}
+		if err := putClass(txn, c); err != nil {
+			return err
+		}
+		for _, sec := range in.Sections {
+			if err := putSection(txn, c.Id, sec); err != nil {
+				return err
+			}
+		}
+		if err := s.audit.record(ctx, txn, "CreateClassBundle", c.Id, nil, proto.Clone(c).(*pb.Class)); err != nil {
+			return err
+		}
+		event = newClassEvent(pb.ClassEvent_CREATED, tenant, proto.Clone(c).(*pb.Class))
+		txn.record(event)
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	s.forgetRead(tenant, c.Id)
+	s.emit(event)
+	logf(ctx, "Added %s with %d sections to class database", c.Id, len(in.Sections))
+	return &pb.ClassBundle{Class: c, Sections: in.Sections}, nil
+}
+
+func (s *server) GetClassBundle(ctx context.Context, in *pb.GetRequest) (*pb.ClassBundle, error) {
+	logf(ctx, "GetClassBundle called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := &pb.ClassBundle{}
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		b.Class, err = getClass(txn, in.Id)
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "class %s not found", in.Id)
+		}
+		if err != nil {
+			return err
+		}
+		b.Sections, err = listSections(txn, in.Id)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return b, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testBundle() *pb.ClassBundle {
+	return &pb.ClassBundle{
+		Class: &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"},
+		Sections: []*pb.Section{
+			{Id: "02", StudentIds: []string{"s3"}},
+			{Id: "01", StudentIds: []string{"s1", "s2"}, Meetings: []*pb.Meeting{
+				{Day: pb.Meeting_MONDAY, StartTime: "09:00", EndTime: "10:15", Location: "Hall B"},
+			}},
+		},
+	}
+}
+
+func TestClassBundle(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+
+		if _, err := s.CreateClassBundle(ctx, testBundle()); err != nil {
+			t.Fatal(err)
+		}
+		b, err := s.GetClassBundle(ctx, &pb.GetRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Class.Name != "Algebra" || len(b.Sections) != 2 || b.Sections[0].Id != "01" {
+			t.Fatalf("GetClassBundle returned %v", b)
+		}
+		if !proto.Equal(b.Sections[0], testBundle().Sections[1]) {
+			t.Errorf("section 01 read back as %v", b.Sections[0])
+		}
+
+		again := testBundle()
+		again.Sections = append(again.Sections, &pb.Section{Id: "03"})
+		if _, err := s.CreateClassBundle(ctx, again); status.Code(err) != codes.AlreadyExists {
+			t.Errorf("creating the class again returned %v, want AlreadyExists", err)
+		}
+		if b, _ := s.GetClassBundle(ctx, &pb.GetRequest{Id: "MATH101"}); len(b.Sections) != 2 {
+			t.Errorf("a failed bundle added sections: %v", b.Sections)
+		}
+
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetClassBundle(ctx, &pb.GetRequest{Id: "MATH101"}); status.Code(err) != codes.NotFound {
+			t.Errorf("GetClassBundle after Delete returned %v, want NotFound", err)
+		}
+		if cs, _ := s.List(ctx, &pb.ListRequest{}); len(cs.Classes) != 0 {
+			t.Errorf("sections show up as classes: %v", cs.Classes)
+		}
+	})
+}
+
+func TestValidateBundle(t *testing.T) {
+	b := testBundle()
+	b.Class.Id = ""
+	b.Sections[0].Id = "01"
+	b.Sections[1].StudentIds = []string{"s1", "s1"}
+	b.Sections[1].Meetings[0].EndTime = "08:00"
+	b.Sections[1].Meetings = append(b.Sections[1].Meetings, &pb.Meeting{StartTime: "9am", EndTime: "10:00"})
+
+	var got []string
+	for _, d := range status.Convert(validateRequest("/class.Adapter/CreateClassBundle", b)).Details() {
+		for _, fv := range d.(*errdetails.BadRequest).FieldViolations {
+			got = append(got, fv.Field)
+		}
+	}
+	want := []string{
+		"class.id",
+		"sections[1].id",
+		"sections[1].student_ids[1]",
+		"sections[1].meetings[0].end_time",
+		"sections[1].meetings[1].day",
+		"sections[1].meetings[1].start_time",
+	}
+	if !equalIds(got, want) {
+		t.Errorf("violations %v, want %v", got, want)
+	}
+	if err := validateRequest("/class.Adapter/CreateClassBundle", testBundle()); err != nil {
+		t.Error(err)
+	}
+}
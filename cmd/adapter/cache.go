@@ -0,0 +1,120 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var readCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "adapter_read_cache_requests_total",
+	Help: "Get and List requests looked up in the read cache, by method and result (hit or miss).",
+}, []string{"method", "result"})
+
+// readCache is an LRU cache of Get and List responses, so the few classes
+// everyone reads at the start of a term are served without a storage read.
+//
+// Entries are keyed by the tenant's generation, which every committed
+// write of the tenant bumps. An entry read before a write is therefore
+// never found after it, whichever of the two finishes first, and is left
+// for the LRU to evict. A nil cache caches nothing.
+type readCache struct {
+	size int
+
+	mu      sync.Mutex
+	gens    map[string]uint64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type readCacheEntry struct {
+	key string
+	m   proto.Message
+}
+
+// newReadCache returns a cache of size responses, or nil if size isn't
+// positive.
+func newReadCache(size int) *readCache {
+	if size <= 0 {
+		return nil
+	}
+	return &readCache{
+		size:    size,
+		gens:    make(map[string]uint64),
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// key identifies a read of tenant's data by method and request, as of the
+// tenant's current generation. extra holds whatever else the response
+// depends on.
+func (c *readCache) key(tenant, method string, in proto.Message, extra ...interface{}) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	b, err := proto.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	gen := c.gens[tenant]
+	c.mu.Unlock()
+	return fmt.Sprintf("%s/%d/%s/%v/%s", tenant, gen, method, extra, b), nil
+}
+
+// get returns a copy of the response cached under key.
+func (c *readCache) get(method, key string) (proto.Message, bool) {
+	if c == nil || key == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		readCacheRequests.WithLabelValues(method, "miss").Inc()
+		return nil, false
+	}
+	readCacheRequests.WithLabelValues(method, "hit").Inc()
+	return proto.Clone(el.Value.(*readCacheEntry).m), true
+}
+
+// put caches a copy of m under key, evicting the least recently used
+// response if the cache is full.
+func (c *readCache) put(key string, m proto.Message) {
+	if c == nil || key == "" {
+		return
+	}
+	m = proto.Clone(m)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*readCacheEntry).m = m
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&readCacheEntry{key: key, m: m})
+	if c.lru.Len() > c.size {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*readCacheEntry).key)
+	}
+}
+
+// invalidate drops every response cached for tenant. Call it after each
+// commit that may have changed the tenant's classes.
+func (c *readCache) invalidate(tenant string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.gens[tenant]++
+	c.mu.Unlock()
+}
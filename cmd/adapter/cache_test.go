@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func TestReadCache(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true, cache: newReadCache(10)}
+		ctx := context.Background()
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Calculus"})
+		name := func() string {
+			c, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c.Name
+		}
+		list := func() []string {
+			cs, err := s.List(ctx, &pb.ListRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ids(cs.Classes)
+		}
+		if got := name(); got != "Calculus" {
+			t.Fatalf("Get returned %q, want Calculus", got)
+		}
+		list()
+
+		// Writing behind the server's back doesn't invalidate the cache, so
+		// the stale responses show they were cached.
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra"}, &pb.Class{Id: "ART100"})
+		if got := name(); got != "Calculus" {
+			t.Errorf("cached Get returned %q, want Calculus", got)
+		}
+		if got := list(); !equalIds(got, []string{"MATH101"}) {
+			t.Errorf("cached List returned %v, want [MATH101]", got)
+		}
+
+		// Any write through the server drops the tenant's responses.
+		if _, err := s.Create(ctx, &pb.Class{Id: "PHYS101"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := name(); got != "Algebra" {
+			t.Errorf("Get after a write returned %q, want Algebra", got)
+		}
+		if got := list(); !equalIds(got, []string{"ART100", "MATH101", "PHYS101"}) {
+			t.Errorf("List after a write returned %v, want [ART100 MATH101 PHYS101]", got)
+		}
+
+		// Responses are copies; changing one doesn't change the cache.
+		c, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Name = "changed"
+		if got := name(); got != "Algebra" {
+			t.Errorf("Get returned %q after the caller changed a response, want Algebra", got)
+		}
+	})
+}
+
+func TestReadCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newReadCache(2)
+	keys := make([]string, 3)
+	for i, id := range []string{"a", "b", "c"} {
+		var err error
+		if keys[i], err = c.key(defaultTenant, "Get", &pb.GetRequest{Id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.put(keys[0], &pb.Class{Id: "a"})
+	c.put(keys[1], &pb.Class{Id: "b"})
+	c.get("Get", keys[0])
+	c.put(keys[2], &pb.Class{Id: "c"})
+	for i, want := range []bool{true, false, true} {
+		if _, ok := c.get("Get", keys[i]); ok != want {
+			t.Errorf("key %d cached = %v, want %v", i, ok, want)
+		}
+	}
+
+	var nilCache *readCache
+	key, _ := nilCache.key(defaultTenant, "Get", &pb.GetRequest{Id: "a"})
+	nilCache.put(key, &pb.Class{Id: "a"})
+	if _, ok := nilCache.get("Get", key); ok {
+		t.Error("nil cache returned a response")
+	}
+}
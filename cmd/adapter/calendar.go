@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// Scratch images have no zoneinfo, so embed it.
+	_ "time/tzdata"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultCalendar gives the day each term starts; a term runs until the
+// next one starts, so WINTER runs into the following year.
+const defaultCalendar = "SPRING=01-15,SUMMER=06-01,FALL=08-25,WINTER=12-15"
+
+var terms = []string{"SPRING", "SUMMER", "FALL", "WINTER"}
+
+type termStart struct {
+	term  string
+	month time.Month
+	day   int
+}
+
+// semesterCalendar places semesters in time. Semesters start at midnight on
+// their first day in the institution's time zone, so boundaries follow the
+// local calendar across DST changes rather than being a fixed number of
+// hours apart, and never depend on the server's own time zone.
+type semesterCalendar struct {
+	loc *time.Location
+	// In calendar order.
+	starts []termStart
+}
+
+// parseCalendar reads a spec of TERM=MM-DD pairs naming the start date of
+// every term.
+func parseCalendar(spec string, loc *time.Location) (*semesterCalendar, error) {
+	c := &semesterCalendar{loc: loc}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid term start %q, want TERM=MM-DD", part)
+		}
+		date, err := time.Parse("01-02", kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid start date for %s: %q, want MM-DD", kv[0], kv[1])
+		}
+		term := strings.ToUpper(kv[0])
+		if seen[term] {
+			return nil, fmt.Errorf("term %s listed twice", term)
+		}
+		seen[term] = true
+		c.starts = append(c.starts, termStart{term: term, month: date.Month(), day: date.Day()})
+	}
+	for _, t := range terms {
+		if !seen[t] {
+			return nil, fmt.Errorf("no start date for term %s", t)
+		}
+	}
+	if len(c.starts) != len(terms) {
+		return nil, fmt.Errorf("unknown term in %q, terms are %s", spec, strings.Join(terms, ", "))
+	}
+	sort.Slice(c.starts, func(i, j int) bool {
+		a, b := c.starts[i], c.starts[j]
+		return a.month < b.month || a.month == b.month && a.day < b.day
+	})
+	for i := 1; i < len(c.starts); i++ {
+		if c.starts[i].month == c.starts[i-1].month && c.starts[i].day == c.starts[i-1].day {
+			return nil, fmt.Errorf("terms %s and %s start on the same day", c.starts[i-1].term, c.starts[i].term)
+		}
+	}
+	return c, nil
+}
+
+func (c *semesterCalendar) start(year, i int) time.Time {
+	s := c.starts[i]
+	return time.Date(year, s.month, s.day, 0, 0, 0, 0, c.loc)
+}
+
+// next returns the index and year of the term after the i'th term of year.
+func (c *semesterCalendar) next(year, i int) (int, int) {
+	if i+1 < len(c.starts) {
+		return year, i + 1
+	}
+	return year + 1, 0
+}
+
+// bounds returns when a semester such as 2024-FALL starts and ends.
+func (c *semesterCalendar) bounds(semester string) (start, end time.Time, err error) {
+	if !semesterPattern.MatchString(semester) {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid semester %q", semester)
+	}
+	parts := strings.SplitN(semester, "-", 2)
+	year, _ := strconv.Atoi(parts[0])
+	for i, s := range c.starts {
+		if s.term == parts[1] {
+			ny, ni := c.next(year, i)
+			return c.start(year, i), c.start(ny, ni), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown term %q", parts[1])
+}
+
+// at returns the semester in session at t.
+func (c *semesterCalendar) at(t time.Time) (semester string, start, end time.Time) {
+	// The semester in session started this calendar year or, early in the
+	// year, is the last term of the previous one.
+	year := t.In(c.loc).Year()
+	y, i := year-1, len(c.starts)-1
+	for j := range c.starts {
+		if !c.start(year, j).After(t) {
+			y, i = year, j
+		}
+	}
+	ny, ni := c.next(y, i)
+	return fmt.Sprintf("%04d-%s", y, c.starts[i].term), c.start(y, i), c.start(ny, ni)
+}
+
+func (s *server) GetSemester(ctx context.Context, in *pb.GetSemesterRequest) (*pb.Semester, error) {
+	logf(ctx, "GetSemester called for semester %q at %v", in.Semester, in.Time.AsTime())
+	var start, end time.Time
+	name := in.Semester
+	if name != "" {
+		var err error
+		if start, end, err = s.calendar.bounds(name); err != nil {
+			return nil, err
+		}
+	} else {
+		t := time.Now()
+		if in.Time != nil {
+			t = in.Time.AsTime()
+		}
+		name, start, end = s.calendar.at(t)
+	}
+	return &pb.Semester{
+		Name:      name,
+		StartTime: timestamppb.New(start),
+		EndTime:   timestamppb.New(end),
+		TimeZone:  s.calendar.loc.String(),
+	}, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func testCalendar(t *testing.T, spec, zone string) *semesterCalendar {
+	t.Helper()
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := parseCalendar(spec, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func mustParse(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSemesterAtHonorsTimeZone(t *testing.T) {
+	// 02:00 UTC on Aug 25 is still the evening of Aug 24 in New York.
+	instant := mustParse(t, "2024-08-25T02:00:00Z")
+	for _, tc := range []struct {
+		zone string
+		want string
+	}{
+		{"UTC", "2024-FALL"},
+		{"America/New_York", "2024-SUMMER"},
+		{"Asia/Tokyo", "2024-FALL"},
+	} {
+		got, _, _ := testCalendar(t, defaultCalendar, tc.zone).at(instant)
+		if got != tc.want {
+			t.Errorf("%s: at(%s) = %s, want %s", tc.zone, instant, got, tc.want)
+		}
+	}
+}
+
+func TestSemesterAtIgnoresServerTimeZone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(l *time.Location) { time.Local = l }(time.Local)
+	time.Local = tokyo
+
+	c := testCalendar(t, defaultCalendar, "America/Chicago")
+	got, start, _ := c.at(mustParse(t, "2024-08-25T03:00:00Z"))
+	if got != "2024-SUMMER" {
+		t.Errorf("at = %s, want 2024-SUMMER", got)
+	}
+	if want := mustParse(t, "2024-06-01T05:00:00Z"); !start.Equal(want) {
+		t.Errorf("start = %s, want %s", start, want)
+	}
+}
+
+func TestSemesterBoundsAcrossDST(t *testing.T) {
+	// US daylight saving time starts on 2024-03-10 and ends on 2024-11-03.
+	c := testCalendar(t, "SPRING=03-10,SUMMER=06-01,FALL=11-03,WINTER=12-20", "America/New_York")
+
+	start, end, err := c.bounds("2024-SPRING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Midnight on Mar 10 is still EST; midnight on Jun 1 is EDT.
+	if want := mustParse(t, "2024-03-10T05:00:00Z"); !start.Equal(want) {
+		t.Errorf("2024-SPRING starts %s, want %s", start, want)
+	}
+	if want := mustParse(t, "2024-06-01T04:00:00Z"); !end.Equal(want) {
+		t.Errorf("2024-SPRING ends %s, want %s", end, want)
+	}
+
+	// Midnight on Nov 3 comes before the 02:00 fall back, so it is EDT.
+	start, end, err = c.bounds("2024-FALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustParse(t, "2024-11-03T04:00:00Z"); !start.Equal(want) {
+		t.Errorf("2024-FALL starts %s, want %s", start, want)
+	}
+	if want := mustParse(t, "2024-12-20T05:00:00Z"); !end.Equal(want) {
+		t.Errorf("2024-FALL ends %s, want %s", end, want)
+	}
+
+	for _, tc := range []struct {
+		at   string
+		want string
+	}{
+		{"2024-03-10T04:59:59Z", "2023-WINTER"},
+		{"2024-03-10T05:00:00Z", "2024-SPRING"},
+		{"2024-11-03T03:59:59Z", "2024-SUMMER"},
+		{"2024-11-03T04:00:00Z", "2024-FALL"},
+	} {
+		if got, _, _ := c.at(mustParse(t, tc.at)); got != tc.want {
+			t.Errorf("at(%s) = %s, want %s", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestSemestersAreContiguous(t *testing.T) {
+	c := testCalendar(t, defaultCalendar, "Europe/London")
+	semester := "2023-WINTER"
+	_, end, err := c.bounds(semester)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2024-SPRING", "2024-SUMMER", "2024-FALL", "2024-WINTER", "2025-SPRING"} {
+		got, start, next := c.at(end)
+		if got != want || !start.Equal(end) {
+			t.Fatalf("semester after %s: got %s starting %s, want %s starting %s", semester, got, start, want, end)
+		}
+		semester, end = got, next
+	}
+}
+
+func TestParseCalendarErrors(t *testing.T) {
+	for _, spec := range []string{
+		"SPRING=01-15,SUMMER=06-01,FALL=08-25",
+		"SPRING=01-15,SUMMER=06-01,FALL=08-25,WINTER=12-15,SPRING=02-01",
+		"SPRING=01-15,SUMMER=06-01,FALL=08-25,WINTER=13-01",
+		"SPRING=01-15,SUMMER=06-01,FALL=08-25,WINTER=08-25",
+		"SPRING=01-15,SUMMER=06-01,FALL=08-25,WINTER=12-15,AUTUMN=09-01",
+		"SPRING",
+	} {
+		if _, err := parseCalendar(spec, time.UTC); err == nil {
+			t.Errorf("parseCalendar(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestGetSemester(t *testing.T) {
+	s := &server{calendar: testCalendar(t, defaultCalendar, "America/Chicago")}
+	got, err := s.GetSemester(context.Background(), &pb.GetSemesterRequest{
+		Time: timestamppb.New(mustParse(t, "2025-01-10T12:00:00Z")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "2024-WINTER" || got.TimeZone != "America/Chicago" {
+		t.Errorf("GetSemester = %v, want 2024-WINTER in America/Chicago", got)
+	}
+	if want := mustParse(t, "2024-12-15T06:00:00Z"); !got.StartTime.AsTime().Equal(want) {
+		t.Errorf("start = %s, want %s", got.StartTime.AsTime(), want)
+	}
+
+	if _, err := s.GetSemester(context.Background(), &pb.GetSemesterRequest{Semester: "2024-AUTUMN"}); err == nil {
+		t.Error("GetSemester accepted an invalid semester")
+	}
+}
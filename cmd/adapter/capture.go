@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// captureRecord is one captured call, a line of JSON in the capture file.
+// Credentials and other metadata aren't recorded, only the tenant, and
+// neither are capturedSecrets.
+type captureRecord struct {
+	Time    time.Time       `json:"time"`
+	Method  string          `json:"method"`
+	Tenant  string          `json:"tenant"`
+	Request json.RawMessage `json:"request,omitempty"`
+	// Requests holds the messages of a client-streaming call, in the order
+	// they were received.
+	Requests []json.RawMessage `json:"requests,omitempty"`
+	Response json.RawMessage   `json:"response,omitempty"`
+	Code     string            `json:"code"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// captureLog records unary and client-streaming calls, such as ImportRoster,
+// for the replay subcommand. Server-streaming calls only read and aren't
+// recorded. It keeps at most
+// maxBytes on disk: once the file reaches half of that it's moved to
+// "<path>.1", replacing the previous one, and a new file is started.
+type captureLog struct {
+	path    string
+	maxSize int64
+	// Method names to capture, e.g. "Update"; every method when empty.
+	methods map[string]bool
+	// Tenant to capture; every tenant when empty.
+	tenant string
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func newCaptureLog(path string, maxBytes int64, methods []string, tenant string) (*captureLog, error) {
+	c := &captureLog{
+		path:    path,
+		maxSize: maxBytes / 2,
+		methods: make(map[string]bool),
+		tenant:  tenant,
+	}
+	for _, m := range methods {
+		c.methods[m] = true
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.f, c.size = f, fi.Size()
+	return c, nil
+}
+
+func (c *captureLog) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.f.Close()
+}
+
+func (c *captureLog) wants(method, tenant string) bool {
+	if c.tenant != "" && tenant != c.tenant {
+		return false
+	}
+	return len(c.methods) == 0 || c.methods[method[strings.LastIndex(method, "/")+1:]]
+}
+
+func (c *captureLog) write(rec *captureRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size > 0 && c.size+int64(len(b)) > c.maxSize {
+		if err := c.f.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(c.path, c.path+".1"); err != nil {
+			return err
+		}
+		if c.f, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+			return err
+		}
+		c.size = 0
+	}
+	n, err := c.f.Write(b)
+	c.size += int64(n)
+	return err
+}
+
+func (c *captureLog) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	tenant, err := tenantFromContext(ctx)
+	if err != nil || !c.wants(info.FullMethod, tenant) {
+		return handler(ctx, req)
+	}
+	// Marshal the request first; handlers may fill in its fields.
+	rec := &captureRecord{Method: info.FullMethod, Tenant: tenant}
+	rec.Request, err = marshalCaptured(req)
+	rec.Time = time.Now()
+	resp, herr := handler(ctx, req)
+	rec.Code = status.Code(herr).String()
+	if herr != nil {
+		rec.Error = status.Convert(herr).Message()
+	} else if err == nil {
+		rec.Response, err = marshalCaptured(resp)
+	}
+	if err == nil {
+		err = c.write(rec)
+	}
+	if err != nil {
+		logf(ctx, "Error capturing %s: %s", info.FullMethod, err)
+	}
+	return resp, herr
+}
+
+func (c *captureLog) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	tenant, err := tenantFromContext(ss.Context())
+	if err != nil || !info.IsClientStream || info.IsServerStream || !c.wants(info.FullMethod, tenant) {
+		return handler(srv, ss)
+	}
+	cs := &captureStream{ServerStream: ss, rec: &captureRecord{Method: info.FullMethod, Tenant: tenant, Time: time.Now()}}
+	herr := handler(srv, cs)
+	cs.rec.Code = status.Code(herr).String()
+	if herr != nil {
+		cs.rec.Error = status.Convert(herr).Message()
+		cs.rec.Response = nil
+	}
+	err = cs.err
+	if err == nil {
+		err = c.write(cs.rec)
+	}
+	if err != nil {
+		logf(ss.Context(), "Error capturing %s: %s", info.FullMethod, err)
+	}
+	return herr
+}
+
+// captureStream records the messages of a client-streaming call and its
+// response.
+type captureStream struct {
+	grpc.ServerStream
+	rec *captureRecord
+	// The first error marshaling a message; the call isn't recorded if set.
+	err error
+}
+
+func (s *captureStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	b, err := marshalCaptured(m)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	s.rec.Requests = append(s.rec.Requests, b)
+	return nil
+}
+
+func (s *captureStream) SendMsg(m interface{}) error {
+	b, err := marshalCaptured(m)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	s.rec.Response = b
+	return s.ServerStream.SendMsg(m)
+}
+
+// capturedSecrets are the fields left out of captured requests and
+// responses, wherever they're nested: keys, lease tokens and the stored
+// values of the key-value store, which clients may keep credentials in.
+var capturedSecrets = map[protoreflect.FullName]bool{
+	"class.OffboardTenantRequest.archive_key":   true,
+	"class.TenantArchive.Entry.value":           true,
+	"class.KeyValue.value":                      true,
+	"class.Class.lease_token":                   true,
+	"class.AcquireEditLeaseRequest.token":       true,
+	"class.EditLease.token":                     true,
+	"class.ReleaseEditLeaseRequest.token":       true,
+	"class.TransitionStateRequest.lease_token":  true,
+	"adapter.v2.UpdateClassRequest.lease_token": true,
+	"adapter.v2.DeleteClassRequest.lease_token": true,
+}
+
+func marshalCaptured(v interface{}) (json.RawMessage, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto message", v)
+	}
+	m = proto.Clone(m)
+	scrubSecrets(m.ProtoReflect())
+	return protojson.Marshal(m)
+}
+
+// scrubSecrets clears the capturedSecrets in m and the messages it holds.
+func scrubSecrets(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case capturedSecrets[fd.FullName()]:
+			m.Clear(fd)
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					scrubSecrets(v.Message())
+					return true
+				})
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				scrubSecrets(v.List().Get(i).Message())
+			}
+		default:
+			scrubSecrets(v.Message())
+		}
+		return true
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func TestCapturedSecrets(t *testing.T) {
+	for name := range capturedSecrets {
+		i := strings.LastIndex(string(name), ".")
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(name[:i])
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if d.(protoreflect.MessageDescriptor).Fields().ByName(protoreflect.Name(name[i+1:])) == nil {
+			t.Errorf("%s: no such field", name)
+		}
+	}
+
+	// Secrets are scrubbed however deeply they're nested, and the message
+	// passed in is left alone.
+	req := &pb.TransactRequest{Ops: []*pb.TransactOp{
+		{Op: &pb.TransactOp_Update{Update: &pb.Class{Id: "MATH101", LeaseToken: "s3cret"}}},
+	}}
+	b, err := marshalCaptured(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cret") || !strings.Contains(string(b), "MATH101") {
+		t.Errorf("captured %s", b)
+	}
+	if req.Ops[0].GetUpdate().LeaseToken != "s3cret" {
+		t.Error("marshalCaptured changed the request")
+	}
+}
+
+// serveCapture serves a new adapter over TLS on a local port, capturing its
+// calls into capture if not nil, and returns its address.
+func serveCapture(t *testing.T, certFile, keyFile string, capture *captureLog) string {
+	t.Helper()
+	srv := newE2EServer(t, newTestDB(t, driverBadger, t.TempDir()))
+	auth, err := newTokenAuth("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unary, stream := e2eInterceptors(t, auth)
+	if capture != nil {
+		unary = append(unary, capture.unaryInterceptor)
+		stream = append(stream, capture.streamInterceptor)
+	}
+	creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, _ := newGRPCServer(localServices(srv, 1000, 64<<10), []grpc.ServerOption{grpc.Creds(creds)}, unary, stream)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	return lis.Addr().String()
+}
+
+func TestCaptureReplay(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeTestCert(t, dir)
+	path := filepath.Join(dir, "calls.jsonl")
+	capture, err := newCaptureLog(path, 1<<20, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func(addr string) *grpc.ClientConn {
+		t.Helper()
+		creds, err := replayCredentials(false, certFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := grpc.Dial(addr, creds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	conn := dial(serveCapture(t, certFile, keyFile, capture))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), tenantMetadataKey, "x")
+	adapter, kv := pb.NewAdapterClient(conn), pb.NewKeyValueStoreClient(conn)
+	if _, err := adapter.Create(ctx, &pb.Class{Id: "MATH101", Name: "Calculus", Semester: "2024-FALL"}); err != nil {
+		t.Fatal(err)
+	}
+	lease, err := adapter.AcquireEditLease(ctx, &pb.AcquireEditLeaseRequest{Id: "MATH101", Holder: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Put(ctx, &pb.KeyValue{Namespace: "sessions", Key: "alice", Value: []byte("s3cret")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Get(ctx, &pb.KeyRequest{Namespace: "sessions", Key: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	// The leased MATH101 fails; MATH102 is created.
+	roster, err := adapter.ImportRoster(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{"id,name\nMATH101,Alg", "ebra\nMATH102,Geometry\n"} {
+		if err := roster.Send(&pb.RosterChunk{Data: []byte(chunk)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp, err := roster.CloseAndRecv(); err != nil || resp.Created != 1 || resp.Failed != 1 {
+		t.Fatalf("ImportRoster returned %v, %v", resp, err)
+	}
+	if _, err := adapter.Create(ctx, &pb.Class{Name: "Calculus"}); err == nil {
+		t.Fatal("Create without an Id succeeded")
+	}
+	if err := capture.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// protojson writes bytes in base64.
+	for _, secret := range []string{"s3cret", "czNjcmV0", lease.Token} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("the capture holds the secret %q:\n%s", secret, b)
+		}
+	}
+
+	// Requests failing validation aren't captured. Replayed against a new
+	// adapter, every other call has the captured outcome, the roster sent
+	// again in its chunks; replayed again, AcquireEditLease finds the lease
+	// it took.
+	conn = dial(serveCapture(t, certFile, keyFile, nil))
+	calls, mismatches, err := replayFile(conn, path, "")
+	if err != nil || calls != 5 || mismatches != 0 {
+		t.Errorf("replayFile = %d calls, %d mismatches, %v; want 5 calls, none differing", calls, mismatches, err)
+	}
+	if c, err := pb.NewAdapterClient(conn).Get(ctx, &pb.GetRequest{Id: "MATH102"}); err != nil || c.Name != "Geometry" {
+		t.Errorf("after the replay, Get of the roster's class returned %v, %v", c, err)
+	}
+	calls, mismatches, err = replayFile(conn, path, "")
+	if err != nil || calls != 5 || mismatches == 0 {
+		t.Errorf("replayFile again = %d calls, %d mismatches, %v; want a mismatch", calls, mismatches, err)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	changelogPrefix = "changelog/"
+	// The last sequence handed out, and the last one trimmed.
+	changelogSequenceKey = "meta/changelog-seq"
+	changelogTrimmedKey  = "meta/changelog-trimmed"
+	// changelogBatch is how many changes a replay reads, or a trim deletes,
+	// per transaction.
+	changelogBatch      = 100
+	changelogTrimPeriod = time.Minute
+)
+
+// changelog records every class change in the transaction making it, under
+// changelog/<sequence> among the tenant's keys, so consumers that missed
+// changes can replay them in order. Sequences are handed out under a lock
+// held until the transaction commits, so they increase in commit order
+// across tenants and a reader that sees one change sees every change
+// before it. Transactions that fail to commit leave gaps.
+type changelog struct {
+	db kvDB
+	mu sync.Mutex
+	// The last sequence handed out.
+	last uint64
+	// Changes older than the newest maxEntries sequences are trimmed; zero
+	// keeps every change.
+	maxEntries uint64
+}
+
+func newChangelog(db kvDB, maxEntries uint64) (*changelog, error) {
+	c := &changelog{db: db, maxEntries: maxEntries}
+	err := db.View(func(txn kvTxn) error {
+		var err error
+		c.last, err = readSequence(txn, changelogSequenceKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readSequence reads a sequence stored as a decimal string, zero if unset.
+func readSequence(txn kvTxn, key string) (uint64, error) {
+	item, err := txn.Get([]byte(key))
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(v), 10, 64)
+}
+
+func changelogKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", changelogPrefix, seq))
+}
+
+// record adds e to the changes txn makes. update logs them, and queues them
+// for the event relay, as the transaction commits.
+func (t *tenantTxn) record(e *pb.ClassEvent) {
+	t.changes = append(t.changes, e)
+}
+
+// lock is held from the first sequence a transaction takes until it
+// commits. A nil changelog has nothing to lock.
+func (c *changelog) lock() (unlock func()) {
+	if c == nil {
+		return func() {}
+	}
+	c.mu.Lock()
+	return c.mu.Unlock
+}
+
+// add sets e's sequence and stores it in txn. The caller holds the lock. A
+// nil changelog logs nothing.
+func (c *changelog) add(txn *tenantTxn, e *pb.ClassEvent) error {
+	if c == nil {
+		return nil
+	}
+	c.last++
+	e.Sequence = int64(c.last)
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(changelogKey(c.last), b); err != nil {
+		return fmt.Errorf("put changelog entry %d: %w", c.last, err)
+	}
+	return txn.Txn.Set([]byte(changelogSequenceKey), []byte(strconv.FormatUint(c.last, 10)))
+}
+
+// trimmedThrough returns the last sequence trimmed; changes up to it may be
+// gone.
+func (c *changelog) trimmedThrough() (uint64, error) {
+	var trimmed uint64
+	err := c.db.View(func(txn kvTxn) error {
+		var err error
+		trimmed, err = readSequence(txn, changelogTrimmedKey)
+		return err
+	})
+	return trimmed, err
+}
+
+// readChanges returns up to limit of txn's tenant's changes after since,
+// oldest first.
+func readChanges(txn *tenantTxn, since uint64, limit int) ([]*pb.ClassEvent, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(changelogPrefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	var changes []*pb.ClassEvent
+	for it.Seek(changelogKey(since + 1)); it.ValidForPrefix(opts.Prefix) && len(changes) < limit; it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return nil, err
+		}
+		e := &pb.ClassEvent{}
+		err := it.Item().Value(func(v []byte) error {
+			return proto.Unmarshal(v, e)
+		})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, e)
+	}
+	return changes, nil
+}
+
+// run trims the changelog every changelogTrimPeriod until ctx ends.
+func (c *changelog) run(ctx context.Context) {
+	if c.maxEntries == 0 {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(changelogTrimPeriod):
+		}
+		if err := c.trim(); err != nil {
+			log.Printf("Error trimming the changelog: %s", err)
+		}
+	}
+}
+
+// trim deletes every tenant's changes older than the newest maxEntries
+// sequences. The new horizon is stored first, so a replay that started
+// before it fails rather than skips the deleted changes.
+func (c *changelog) trim() error {
+	c.mu.Lock()
+	last := c.last
+	c.mu.Unlock()
+	if last <= c.maxEntries {
+		return nil
+	}
+	horizon := last - c.maxEntries
+	trimmed, err := c.trimmedThrough()
+	if err != nil || trimmed >= horizon {
+		return err
+	}
+	err = c.db.Update(func(txn kvTxn) error {
+		return txn.Set([]byte(changelogTrimmedKey), []byte(strconv.FormatUint(horizon, 10)))
+	})
+	if err != nil {
+		return err
+	}
+	tenants, err := listTenants(c.db)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		for {
+			var n int
+			err := c.db.Update(func(txn kvTxn) error {
+				t := newTenantTxn(txn, tenant)
+				opts := badger.DefaultIteratorOptions
+				opts.PrefetchValues = false
+				opts.Prefix = []byte(changelogPrefix)
+				it := t.NewIterator(opts)
+				var keys [][]byte
+				for it.Rewind(); it.Valid() && len(keys) < changelogBatch; it.Next() {
+					k := it.Key()
+					if string(k) > string(changelogKey(horizon)) {
+						break
+					}
+					keys = append(keys, append([]byte(nil), k...))
+				}
+				it.Close()
+				for _, k := range keys {
+					if err := t.Delete(k); err != nil {
+						return err
+					}
+				}
+				n = len(keys)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if n < changelogBatch {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *server) ReplayChanges(in *pb.ReplayChangesRequest, stream pb.Adapter_ReplayChangesServer) error {
+	logf(stream.Context(), "ReplayChanges called since sequence %d", in.SinceSequence)
+	if s.changelog == nil {
+		return preconditionFailed(preconditionServer, "server", "this adapter keeps no changelog")
+	}
+	tenant, err := tenantFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+	ctx, reason, cancel := s.drain.bound(stream.Context())
+	defer cancel()
+
+	// Events on the bus only say there is more to read: reading the
+	// changelog keeps changes in commit order and skips none.
+	match := func(e *pb.ClassEvent) bool { return e.Tenant == tenant }
+	var sub *subscription
+	if in.Follow {
+		sub = s.events.subscribe(match)
+		defer func() { s.events.unsubscribe(sub) }()
+	}
+	last := uint64(in.SinceSequence)
+	for {
+		if err := s.replayFrom(ctx, tenant, &last, stream); err != nil {
+			if ctx.Err() != nil {
+				if r := reason(); r != nil {
+					return r
+				}
+			}
+			return err
+		}
+		if !in.Follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return reason()
+		case _, ok := <-sub.events:
+			if !ok {
+				// Fell behind the bus; the changelog still has every change.
+				s.events.unsubscribe(sub)
+				sub = s.events.subscribe(match)
+			}
+		}
+	}
+}
+
+// replayFrom sends tenant's logged changes after *last, advancing it, until
+// none are left.
+func (s *server) replayFrom(ctx context.Context, tenant string, last *uint64, stream pb.Adapter_ReplayChangesServer) error {
+	for {
+		var changes []*pb.ClassEvent
+		err := s.view(ctx, tenant, func(txn *tenantTxn) error {
+			var err error
+			changes, err = readChanges(txn, *last, changelogBatch)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		trimmed, err := s.changelog.trimmedThrough()
+		if err != nil {
+			return err
+		}
+		if *last > 0 && *last < trimmed {
+			return status.Errorf(codes.OutOfRange, "changes after sequence %d were trimmed from the changelog, which now starts after %d; list again before replaying", *last, trimmed)
+		}
+		for _, e := range changes {
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+			*last = uint64(e.Sequence)
+		}
+		if len(changes) < changelogBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type replayStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *pb.ClassEvent
+}
+
+func (r replayStream) Context() context.Context { return r.ctx }
+
+func (r replayStream) Send(e *pb.ClassEvent) error {
+	r.sent <- e
+	return nil
+}
+
+// replay runs a ReplayChanges that doesn't follow and returns the changes
+// it sent.
+func replay(t *testing.T, s *server, ctx context.Context, since int64) ([]*pb.ClassEvent, error) {
+	t.Helper()
+	sent := make(chan *pb.ClassEvent, 100)
+	err := s.ReplayChanges(&pb.ReplayChangesRequest{SinceSequence: since}, replayStream{ctx: ctx, sent: sent})
+	close(sent)
+	var changes []*pb.ClassEvent
+	for e := range sent {
+		changes = append(changes, e)
+	}
+	return changes, err
+}
+
+func changeIds(changes []*pb.ClassEvent) []string {
+	var ids []string
+	for _, e := range changes {
+		ids = append(ids, e.Type.String()+" "+e.Class.Id)
+	}
+	return ids
+}
+
+func TestReplayChanges(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		cl, err := newChangelog(db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &server{db: db, events: newEventBus(), changelog: cl}
+		ctx := context.Background()
+		other := metadata.NewIncomingContext(ctx, metadata.Pairs(tenantMetadataKey, "lincoln-high"))
+		for _, c := range []struct {
+			ctx context.Context
+			id  string
+		}{{ctx, "ART1"}, {other, "BIO1"}, {ctx, "MATH101"}} {
+			if _, err := s.Create(c.ctx, &pb.Class{Id: c.id, Name: "Class"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "ART1"}); err != nil {
+			t.Fatal(err)
+		}
+
+		changes, err := replay(t, s, ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"CREATED ART1", "CREATED MATH101", "DELETED ART1"}
+		if !equalIds(changeIds(changes), want) {
+			t.Fatalf("replay got %v, want %v", changeIds(changes), want)
+		}
+		for i := 1; i < len(changes); i++ {
+			if changes[i].Sequence <= changes[i-1].Sequence {
+				t.Errorf("sequences %d then %d don't increase", changes[i-1].Sequence, changes[i].Sequence)
+			}
+		}
+		if changes, _ := replay(t, s, ctx, changes[0].Sequence); !equalIds(changeIds(changes), want[1:]) {
+			t.Errorf("replay after the first change got %v, want %v", changeIds(changes), want[1:])
+		}
+		if changes, _ := replay(t, s, other, 0); !equalIds(changeIds(changes), []string{"CREATED BIO1"}) {
+			t.Errorf("other tenant's replay got %v", changeIds(changes))
+		}
+
+		// Sequences carry on where they left off after a restart.
+		reopened, err := newChangelog(db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reopened.last != uint64(changes[len(changes)-1].Sequence) {
+			t.Errorf("reopened changelog is at %d, want %d", reopened.last, changes[len(changes)-1].Sequence)
+		}
+
+		// Validate-only writes aren't logged.
+		if _, err := s.Create(ctx, &pb.Class{Id: "CHEM1", Name: "Class", ValidateOnly: true}); err != nil {
+			t.Fatal(err)
+		}
+		if changes, _ := replay(t, s, ctx, 0); len(changes) != 3 {
+			t.Errorf("replay after a validate-only create got %v", changeIds(changes))
+		}
+	})
+}
+
+func TestReplayChangesTrimmed(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		cl, err := newChangelog(db, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &server{db: db, events: newEventBus(), changelog: cl}
+		ctx := context.Background()
+		for _, id := range []string{"ART1", "BIO1", "CHEM1", "MATH101"} {
+			if _, err := s.Create(ctx, &pb.Class{Id: id, Name: "Class"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := cl.trim(); err != nil {
+			t.Fatal(err)
+		}
+		changes, err := replay(t, s, ctx, 0)
+		if err != nil || !equalIds(changeIds(changes), []string{"CREATED CHEM1", "CREATED MATH101"}) {
+			t.Errorf("replay of a trimmed changelog got %v, %v, want the newest two changes", changeIds(changes), err)
+		}
+		if _, err := replay(t, s, ctx, 1); status.Code(err) != codes.OutOfRange {
+			t.Errorf("replay from a trimmed sequence got %v, want OutOfRange", err)
+		}
+		if _, err := replay(t, s, ctx, 2); err != nil {
+			t.Errorf("replay from the last trimmed sequence got %v", err)
+		}
+	})
+}
+
+func TestReplayChangesFollows(t *testing.T) {
+	db := newTestDB(t, driverBadger, t.TempDir())
+	cl, err := newChangelog(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{db: db, events: newEventBus(), changelog: cl}
+	if _, err := s.Create(context.Background(), &pb.Class{Id: "ART1", Name: "Class"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sent := make(chan *pb.ClassEvent, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ReplayChanges(&pb.ReplayChangesRequest{Follow: true}, replayStream{ctx: ctx, sent: sent})
+	}()
+	next := func() *pb.ClassEvent {
+		select {
+		case e := <-sent:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change was replayed")
+			return nil
+		}
+	}
+	if e := next(); e.Class.Id != "ART1" {
+		t.Errorf("first change replayed is %v, want ART1's", e)
+	}
+	if _, err := s.Create(context.Background(), &pb.Class{Id: "BIO1", Name: "Class"}); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); e.Class.Id != "BIO1" || e.Sequence != 2 {
+		t.Errorf("followed change is %v, want BIO1's at sequence 2", e)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReplayChanges didn't end with its context")
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	classroomURL = "https://classroom.googleapis.com"
+	// classroomPageSize is how many courses each list call asks for.
+	classroomPageSize = 100
+	// Labels linking a class to its course, and naming the course's owner.
+	classroomCourseLabel = "classroom-course-id"
+	classroomOwnerLabel  = "classroom-owner-id"
+	// classroomIdPrefix starts the Id of a class created for a course.
+	classroomIdPrefix = "classroom-"
+	// classroomPrefix holds, under classroom/<course Id> among the tenant's
+	// keys, the update time of the course as last applied.
+	classroomPrefix = "classroom/"
+)
+
+var (
+	classroomSyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "adapter_classroom_syncs_total",
+		Help: "Google Classroom syncs, by result (ok or failed).",
+	}, []string{"result"})
+	classroomConflicts = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "adapter_classroom_sync_conflicts",
+		Help: "Courses the last Google Classroom sync couldn't apply.",
+	})
+)
+
+// classroomCourse is the part of a Classroom Course the sync maps.
+type classroomCourse struct {
+	Id                 string `json:"id"`
+	Name               string `json:"name"`
+	DescriptionHeading string `json:"descriptionHeading"`
+	Description        string `json:"description"`
+	OwnerId            string `json:"ownerId"`
+	// When the course last changed, in RFC 3339.
+	UpdateTime string `json:"updateTime"`
+}
+
+// classroomClient lists courses through the Classroom REST API.
+type classroomClient struct {
+	client *http.Client
+	url    string
+	// File holding an OAuth 2.0 access token, read for every sync so
+	// whatever refreshes it needn't restart the adapter.
+	tokenFile string
+}
+
+func newClassroomClient(tokenFile string) *classroomClient {
+	return &classroomClient{client: &http.Client{Timeout: 30 * time.Second}, url: classroomURL, tokenFile: tokenFile}
+}
+
+// courses lists every active course the token's user can see.
+func (c *classroomClient) courses(ctx context.Context) ([]classroomCourse, error) {
+	token, err := ioutil.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{"courseStates": {"ACTIVE"}, "pageSize": {fmt.Sprint(classroomPageSize)}}
+	var courses []classroomCourse
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/v1/courses?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("list courses: %s: %s", resp.Status, bytes.TrimSpace(b))
+		}
+		var page struct {
+			Courses       []classroomCourse `json:"courses"`
+			NextPageToken string            `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return nil, fmt.Errorf("list courses: %w", err)
+		}
+		courses = append(courses, page.Courses...)
+		if page.NextPageToken == "" {
+			return courses, nil
+		}
+		q.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// classroomSync keeps one tenant's classes in step with the courses of a
+// Google Classroom account. Each course maps to the class labeled with its
+// course Id, or else to classroom-<course Id>. The sync sets the name,
+// description, semester and the two Classroom labels of that class and
+// leaves its other fields alone. An edit made in the adapter to those
+// fields is kept, and reported as a conflict, until the course changes
+// again in Classroom. Classes whose course is archived or deleted are kept.
+type classroomSync struct {
+	client *classroomClient
+	tenant string
+	// Semester given to synced classes; Classroom has none. Left alone if
+	// empty.
+	semester string
+	// Set while a sync runs.
+	running int32
+}
+
+func newClassroomSync(client *classroomClient, tenant, semester string) *classroomSync {
+	return &classroomSync{client: client, tenant: tenant, semester: semester}
+}
+
+// syncClassroomEvery syncs now and then every interval until ctx ends.
+func (s *server) syncClassroomEvery(ctx context.Context, interval time.Duration) {
+	for {
+		if _, err := s.syncClassroom(ctx); err != nil {
+			log.Printf("Error syncing Google Classroom: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *server) AdminSyncClassroom(ctx context.Context, in *pb.Empty) (*pb.ClassroomSyncResult, error) {
+	logf(ctx, "AdminSyncClassroom called")
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if s.classroom == nil {
+		return nil, preconditionFailed(preconditionServer, "server", "this adapter isn't configured to sync Google Classroom; set -classroom-token-file")
+	}
+	res, err := s.syncClassroom(ctx)
+	if err != nil && !isStatusError(err) {
+		return nil, status.Errorf(codes.Unavailable, "sync Google Classroom: %s", err)
+	}
+	return res, err
+}
+
+// syncClassroom lists the courses and applies each in its own transaction.
+func (s *server) syncClassroom(ctx context.Context) (*pb.ClassroomSyncResult, error) {
+	cs := s.classroom
+	if !atomic.CompareAndSwapInt32(&cs.running, 0, 1) {
+		return nil, status.Error(codes.Aborted, "a Google Classroom sync is already running, retry once it has finished")
+	}
+	defer atomic.StoreInt32(&cs.running, 0)
+
+	start := time.Now()
+	courses, err := cs.client.courses(ctx)
+	if err != nil {
+		classroomSyncs.WithLabelValues("failed").Inc()
+		return nil, err
+	}
+	var links map[string][]string
+	err = s.view(ctx, cs.tenant, func(txn *tenantTxn) error {
+		var err error
+		links, err = classroomLinks(txn)
+		return err
+	})
+	if err != nil {
+		classroomSyncs.WithLabelValues("failed").Inc()
+		return nil, storageError(err)
+	}
+	res := &pb.ClassroomSyncResult{}
+	for _, course := range courses {
+		id := classroomIdPrefix + course.Id
+		var reason string
+		switch linked := links[course.Id]; len(linked) {
+		case 0:
+		case 1:
+			id = linked[0]
+		default:
+			reason = fmt.Sprintf("classes %s are all labeled %s=%s", strings.Join(linked, ", "), classroomCourseLabel, course.Id)
+		}
+		if reason == "" {
+			var outcome *int32
+			outcome, reason, err = s.applyCourse(ctx, res, id, course)
+			if isContextError(err) {
+				classroomSyncs.WithLabelValues("failed").Inc()
+				return nil, storageError(err)
+			}
+			if err != nil {
+				reason = err.Error()
+				if st, ok := status.FromError(err); ok {
+					reason = st.Message()
+				}
+			}
+			if outcome != nil {
+				*outcome++
+			}
+		}
+		if reason != "" {
+			res.Conflicts = append(res.Conflicts, &pb.ClassroomConflict{CourseId: course.Id, ClassId: id, Reason: reason})
+		}
+	}
+	res.Duration = durationpb.New(time.Since(start))
+	classroomSyncs.WithLabelValues("ok").Inc()
+	classroomConflicts.Set(float64(len(res.Conflicts)))
+	logf(ctx, "Google Classroom sync of %d courses created %d, updated %d and left %d classes, with %d conflicts, in %s",
+		len(courses), res.Created, res.Updated, res.Unchanged, len(res.Conflicts), res.Duration.AsDuration().Round(time.Millisecond))
+	for _, c := range res.Conflicts {
+		logf(ctx, "Google Classroom course %s not applied to class %s: %s", c.CourseId, c.ClassId, c.Reason)
+	}
+	return res, nil
+}
+
+// classroomLinks returns the Ids of the classes labeled with each course Id.
+func classroomLinks(txn *tenantTxn) (map[string][]string, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = labelIndexKey(classroomCourseLabel, "")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	links := make(map[string][]string)
+	for it.Rewind(); it.Valid(); it.Next() {
+		v, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		id := string(it.Item().Key()[len(opts.Prefix):])
+		links[string(v)] = append(links[string(v)], id)
+	}
+	return links, nil
+}
+
+// applyCourse writes course to the class with the given Id. It returns the
+// counter of res the outcome adds to, or why the course wasn't applied.
+func (s *server) applyCourse(ctx context.Context, res *pb.ClassroomSyncResult, id string, course classroomCourse) (outcome *int32, conflict string, err error) {
+	cs := s.classroom
+	var event *pb.ClassEvent
+	err = s.update(ctx, cs.tenant, func(txn *tenantTxn) error {
+		outcome, conflict, event = nil, "", nil
+		old, err := allowCorrupt(getClass(txn, id))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		c := &pb.Class{Id: id}
+		if old != nil {
+			if old.Labels[classroomCourseLabel] != course.Id {
+				conflict = fmt.Sprintf("class %s exists and isn't labeled %s=%s; label it to sync it with the course", id, classroomCourseLabel, course.Id)
+				return nil
+			}
+			c = proto.Clone(old).(*pb.Class)
+		}
+		cs.mapCourse(c, course)
+		applied, err := appliedUpdateTime(txn, course.Id)
+		if err != nil {
+			return err
+		}
+		if old != nil && proto.Equal(c, old) {
+			outcome = &res.Unchanged
+			return txn.Set(classroomKey(course.Id), []byte(course.UpdateTime))
+		}
+		if old != nil && applied != "" && applied == course.UpdateTime {
+			conflict = fmt.Sprintf("class %s was changed in the adapter since course %s was last synced; it is kept until the course changes in Classroom", id, course.Id)
+			return nil
+		}
+		if err := validateClass(c); err != nil {
+			return err
+		}
+		if err := checkEditLease(txn, id, ""); err != nil {
+			return err
+		}
+		if err := checkReferences(txn, c); err != nil {
+			return err
+		}
+		if err := putClass(txn, c); err != nil {
+			return err
+		}
+		if err := txn.Set(classroomKey(course.Id), []byte(course.UpdateTime)); err != nil {
+			return err
+		}
+		if err := s.audit.record(ctx, txn, "AdminSyncClassroom", id, old, proto.Clone(c).(*pb.Class)); err != nil {
+			return err
+		}
+		t, counter := pb.ClassEvent_UPDATED, &res.Updated
+		if old == nil {
+			t, counter = pb.ClassEvent_CREATED, &res.Created
+		}
+		event = newClassEvent(t, cs.tenant, proto.Clone(c).(*pb.Class))
+		txn.record(event)
+		outcome = counter
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if event != nil {
+		s.forgetRead(cs.tenant, id)
+		s.emit(event)
+	}
+	return outcome, conflict, nil
+}
+
+// mapCourse sets the fields of c the sync owns from course.
+func (cs *classroomSync) mapCourse(c *pb.Class, course classroomCourse) {
+	c.Name = course.Name
+	c.Description = course.Description
+	if c.Description == "" {
+		c.Description = course.DescriptionHeading
+	}
+	if cs.semester != "" {
+		c.Semester = cs.semester
+	}
+	labels := make(map[string]string, len(c.Labels)+2)
+	for k, v := range c.Labels {
+		labels[k] = v
+	}
+	labels[classroomCourseLabel] = course.Id
+	if course.OwnerId != "" {
+		labels[classroomOwnerLabel] = course.OwnerId
+	} else {
+		delete(labels, classroomOwnerLabel)
+	}
+	c.Labels = labels
+}
+
+func classroomKey(courseId string) []byte {
+	return []byte(classroomPrefix + courseId)
+}
+
+// appliedUpdateTime returns the update time of the course as the sync last
+// applied it, empty if it never has.
+func appliedUpdateTime(txn *tenantTxn, courseId string) (string, error) {
+	item, err := txn.Get(classroomKey(courseId))
+	if err == badger.ErrKeyNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	v, err := item.ValueCopy(nil)
+	return string(v), err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// fakeClassroom serves courses one to a page, to callers with the token
+// "secret".
+type fakeClassroom struct {
+	mu      sync.Mutex
+	courses []classroomCourse
+}
+
+func (f *fakeClassroom) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/courses" || r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Get("courseStates") != "ACTIVE" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	var page struct {
+		Courses       []classroomCourse `json:"courses,omitempty"`
+		NextPageToken string            `json:"nextPageToken,omitempty"`
+	}
+	if i < len(f.courses) {
+		page.Courses = f.courses[i : i+1]
+	}
+	if i+1 < len(f.courses) {
+		page.NextPageToken = strconv.Itoa(i + 1)
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func (f *fakeClassroom) touch(i int, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.courses[i].Name = name
+	f.courses[i].UpdateTime = time.Now().Add(time.Second).Format(time.RFC3339Nano)
+}
+
+func TestSyncClassroom(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+	fake := &fakeClassroom{courses: []classroomCourse{
+		{Id: "101", Name: "Algebra", Description: "Linear equations", OwnerId: "9001", UpdateTime: old},
+		{Id: "102", Name: "Biology", DescriptionHeading: "Cells", UpdateTime: old},
+		{Id: "103", Name: "Chemistry", UpdateTime: old},
+	}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := newClassroomClient(tokenFile)
+	client.url = ts.URL
+
+	s := &server{db: newTestDB(t, driverBadger, t.TempDir()), events: newEventBus()}
+	s.classroom = newClassroomSync(client, defaultTenant, "2024-FALL")
+	ctx := context.Background()
+	for _, c := range []*pb.Class{
+		{Id: "BIO1", Name: "Bio", Capacity: 20, Labels: map[string]string{classroomCourseLabel: "102"}},
+		{Id: "classroom-103", Name: "Chemistry"},
+	} {
+		if _, err := s.Create(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := s.AdminSyncClassroom(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 1 || res.Updated != 1 || res.Unchanged != 0 || len(res.Conflicts) != 1 || res.Conflicts[0].ClassId != "classroom-103" {
+		t.Errorf("first sync got %v, want 1 created, 1 updated and a conflict on classroom-103", res)
+	}
+	c, _ := s.Get(ctx, &pb.GetRequest{Id: "classroom-101"})
+	if c.Name != "Algebra" || c.Description != "Linear equations" || c.Semester != "2024-FALL" || c.Labels[classroomCourseLabel] != "101" || c.Labels[classroomOwnerLabel] != "9001" {
+		t.Errorf("created class is %v", c)
+	}
+	c, _ = s.Get(ctx, &pb.GetRequest{Id: "BIO1"})
+	if c.Name != "Biology" || c.Description != "Cells" || c.Capacity != 20 {
+		t.Errorf("linked class is %v, want the course's name and description and its own capacity", c)
+	}
+
+	res, err = s.AdminSyncClassroom(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 0 || res.Updated != 0 || res.Unchanged != 2 || len(res.Conflicts) != 1 {
+		t.Errorf("second sync got %v, want 2 unchanged and the conflict", res)
+	}
+
+	// An edit in the adapter holds until the course changes again.
+	if _, err := s.Update(ctx, &pb.Class{Id: "classroom-101", Name: "Algebra I", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = s.AdminSyncClassroom(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Unchanged != 1 || len(res.Conflicts) != 2 || res.Conflicts[0].ClassId != "classroom-101" {
+		t.Errorf("sync after an edit got %v, want a conflict on classroom-101", res)
+	}
+	fake.touch(0, "Algebra II")
+	if res, err := s.AdminSyncClassroom(ctx, &pb.Empty{}); err != nil || res.Updated != 1 {
+		t.Errorf("sync after the course changed got %v, %v, want 1 updated", res, err)
+	}
+	if c, _ := s.Get(ctx, &pb.GetRequest{Id: "classroom-101"}); c.Name != "Algebra II" {
+		t.Errorf("class is %v after the course changed, want it renamed", c)
+	}
+}
+
+func TestSyncClassroomUnconfigured(t *testing.T) {
+	s := &server{db: newTestDB(t, driverBadger, t.TempDir()), events: newEventBus()}
+	if _, err := s.AdminSyncClassroom(context.Background(), &pb.Empty{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("AdminSyncClassroom without a token file got %v, want FailedPrecondition", err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/virtual-class-tutor/class-adapter-file/pkg/client"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Values of -output.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// classCommand holds the flags every class subcommand shares.
+type classCommand struct {
+	fs      *flag.FlagSet
+	addr    *string
+	token   *string
+	tenant  *string
+	timeout *time.Duration
+	output  *string
+}
+
+func newClassCommand(cmd, usage string) *classCommand {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	c := &classCommand{
+		fs:      fs,
+		addr:    fs.String("addr", "localhost"+port, "address of the adapter to call"),
+		token:   fs.String("token", "", "bearer token, if the adapter requires one"),
+		tenant:  fs.String("tenant", defaultTenant, "tenant whose classes to act on"),
+		timeout: fs.Duration("timeout", 30*time.Second, "how long to wait for the adapter"),
+		output:  fs.String("output", outputTable, "how to print classes: table or json"),
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: adapter %s [flags] %s\n", cmd, usage)
+		fs.PrintDefaults()
+	}
+	return c
+}
+
+// parse parses args, exiting with the usage unless nargs arguments are left
+// after the flags.
+func (c *classCommand) parse(args []string, nargs int) {
+	c.fs.Parse(args)
+	if c.fs.NArg() != nargs {
+		c.fs.Usage()
+		os.Exit(2)
+	}
+	if *c.output != outputTable && *c.output != outputJSON {
+		fmt.Fprintf(os.Stderr, "%s: invalid -output %q, must be table or json\n", c.fs.Name(), *c.output)
+		os.Exit(2)
+	}
+	if !tenantPattern.MatchString(*c.tenant) {
+		fmt.Fprintf(os.Stderr, "%s: -tenant must match %s\n", c.fs.Name(), tenantPattern)
+		os.Exit(2)
+	}
+}
+
+// run dials the adapter and calls fn with it, exiting on failure.
+func (c *classCommand) run(fn func(ctx context.Context, cl *client.Client) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *c.timeout)
+	defer cancel()
+	creds, err := dialCredentials(*c.addr)
+	if err != nil {
+		log.Fatalf("%s: %s", c.fs.Name(), err)
+	}
+	opts := []client.Option{client.WithDialOptions(creds)}
+	if *c.token != "" {
+		opts = append(opts, client.WithToken(*c.token))
+	}
+	cl, err := client.Dial(ctx, *c.addr, opts...)
+	if err != nil {
+		log.Fatalf("%s: %s", c.fs.Name(), err)
+	}
+	defer cl.Close()
+	if *c.tenant != defaultTenant {
+		ctx = client.WithTenant(ctx, *c.tenant)
+	}
+	if err := fn(ctx, cl); err != nil {
+		cl.Close()
+		log.Fatalf("%s: %s", c.fs.Name(), err)
+	}
+}
+
+// runClassCommand is the get, list, create, delete and import-roster
+// subcommands, which call a running adapter so operators needn't build
+// requests by hand.
+func runClassCommand(cmd string, args []string) {
+	switch cmd {
+	case "get":
+		c := newClassCommand(cmd, "id")
+		system := c.fs.String("system", "", "look the class up by its Id in this external system, e.g. sis")
+		c.parse(args, 1)
+		c.run(func(ctx context.Context, cl *client.Client) error {
+			if *system != "" {
+				class, err := cl.GetByExternalId(ctx, &pb.GetByExternalIdRequest{System: *system, Id: c.fs.Arg(0)})
+				if err != nil {
+					return err
+				}
+				return printClass(os.Stdout, *c.output, class)
+			}
+			// Get answers for a missing class with only its Id.
+			ok, err := cl.ClassExists(ctx, c.fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("class %s not found", c.fs.Arg(0))
+			}
+			class, err := cl.GetClass(ctx, c.fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			return printClass(os.Stdout, *c.output, class)
+		})
+	case "list":
+		c := newClassCommand(cmd, "")
+		semester := c.fs.String("semester", "", "only list classes of this semester")
+		selector := c.fs.String("label-selector", "", "only list classes whose labels match, e.g. subject=math,level!=ap")
+		orderBy := c.fs.String("order-by", "", "sort by id, name or semester, optionally followed by asc or desc")
+		c.parse(args, 0)
+		c.run(func(ctx context.Context, cl *client.Client) error {
+			var classes []*pb.Class
+			var err error
+			if *semester != "" {
+				if *selector != "" || *orderBy != "" {
+					return fmt.Errorf("-semester can't be combined with -label-selector or -order-by")
+				}
+				classes, err = cl.ListClassesBySemester(ctx, *semester)
+			} else {
+				classes, err = cl.ListClasses(ctx, &pb.ListRequest{
+					PageSize:      cl.Policy().MaxPageSize,
+					LabelSelector: *selector,
+					OrderBy:       *orderBy,
+				})
+			}
+			if err != nil {
+				return err
+			}
+			return printClasses(os.Stdout, *c.output, classes)
+		})
+	case "create":
+		c := newClassCommand(cmd, "")
+		class := &pb.Class{}
+		c.fs.StringVar(&class.Id, "id", "", "Id of the class, e.g. MATH101-01 (required)")
+		c.fs.StringVar(&class.Name, "name", "", "display name of the class")
+		c.fs.StringVar(&class.Semester, "semester", "", "semester the class is taught in, e.g. 2024-FALL")
+		c.fs.StringVar(&class.InstructorId, "instructor-id", "", "Id of the instructor teaching the class")
+		c.fs.StringVar(&class.InstructorName, "instructor-name", "", "display name of the instructor")
+		capacity := c.fs.Int("capacity", 0, "most students that may enroll (0 for no limit)")
+		c.fs.StringVar(&class.Description, "description", "", "description of the class")
+		labels := c.fs.String("labels", "", "comma-separated key=value labels, e.g. subject=math,level=ap")
+		prereqs := c.fs.String("prerequisites", "", "comma-separated Ids of the classes this one requires")
+		externalIds := c.fs.String("external-ids", "", "comma-separated system=id Ids of the class in other systems, e.g. sis=2024-MATH-101-01")
+		c.fs.BoolVar(&class.ValidateOnly, "validate-only", false, "only check the class would be created")
+		c.parse(args, 0)
+		if class.Id == "" {
+			fmt.Fprintln(os.Stderr, "create: -id is required")
+			os.Exit(2)
+		}
+		class.Capacity = int32(*capacity)
+		var err error
+		if class.Labels, err = parseLabelFlag(*labels); err != nil {
+			fmt.Fprintf(os.Stderr, "create: invalid -labels: %s\n", err)
+			os.Exit(2)
+		}
+		if class.ExternalIds, err = parseLabelFlag(*externalIds); err != nil {
+			fmt.Fprintf(os.Stderr, "create: invalid -external-ids: %s\n", err)
+			os.Exit(2)
+		}
+		if *prereqs != "" {
+			class.PrerequisiteIds = strings.Split(*prereqs, ",")
+		}
+		c.run(func(ctx context.Context, cl *client.Client) error {
+			created, err := cl.Create(ctx, class)
+			if err != nil {
+				return err
+			}
+			return printClass(os.Stdout, *c.output, created)
+		})
+	case "delete":
+		c := newClassCommand(cmd, "id")
+		c.parse(args, 1)
+		c.run(func(ctx context.Context, cl *client.Client) error {
+			return cl.DeleteClass(ctx, c.fs.Arg(0))
+		})
+	case "import-roster":
+		c := newClassCommand(cmd, "file.csv (- for standard input)")
+		dryRun := c.fs.Bool("dry-run", false, "only check the rows would import")
+		c.parse(args, 1)
+		in := os.Stdin
+		if c.fs.Arg(0) != "-" {
+			f, err := os.Open(c.fs.Arg(0))
+			if err != nil {
+				log.Fatalf("%s: %s", cmd, err)
+			}
+			defer f.Close()
+			in = f
+		}
+		c.run(func(ctx context.Context, cl *client.Client) error {
+			resp, err := cl.ImportRosterCSV(ctx, in, *dryRun)
+			if err != nil {
+				return err
+			}
+			if err := printRosterImport(os.Stdout, *c.output, resp); err != nil {
+				return err
+			}
+			if resp.Failed > 0 {
+				return fmt.Errorf("%d rows failed", resp.Failed)
+			}
+			return nil
+		})
+	}
+}
+
+// printRosterImport writes the summary of an import, and a table of the
+// rows that failed, or the response as JSON.
+func printRosterImport(w io.Writer, output string, resp *pb.ImportRosterResponse) error {
+	if output == outputJSON {
+		return printJSON(w, resp)
+	}
+	verb := "Imported"
+	if resp.DryRun {
+		verb = "Checked"
+	}
+	fmt.Fprintf(w, "%s roster: %d created, %d updated, %d failed\n", verb, resp.Created, resp.Updated, resp.Failed)
+	if len(resp.Errors) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROW\tID\tERROR")
+	for _, e := range resp.Errors {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", e.Row, e.Id, e.Message)
+	}
+	return tw.Flush()
+}
+
+// parseLabelFlag parses comma-separated key=value pairs.
+func parseLabelFlag(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not key=value", pair)
+		}
+		labels[pair[:i]] = pair[i+1:]
+	}
+	return labels, nil
+}
+
+// printClass writes c to w as a one-row table, or as a JSON object.
+func printClass(w io.Writer, output string, c *pb.Class) error {
+	if output == outputJSON {
+		return printJSON(w, c)
+	}
+	return printClasses(w, output, []*pb.Class{c})
+}
+
+// printClasses writes classes to w as a table, or as JSON in the form of a
+// List response.
+func printClasses(w io.Writer, output string, classes []*pb.Class) error {
+	if output == outputJSON {
+		return printJSON(w, &pb.Classes{Classes: classes})
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSEMESTER\tINSTRUCTOR\tCAPACITY\tLABELS")
+	for _, c := range classes {
+		capacity := "-"
+		if c.Capacity > 0 {
+			capacity = fmt.Sprint(c.Capacity)
+		}
+		var labels []string
+		for k, v := range c.Labels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Id, c.Name, c.Semester, c.InstructorName, capacity, strings.Join(labels, ","))
+	}
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, m protoreflect.ProtoMessage) error {
+	b, err := protojson.MarshalOptions{Multiline: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
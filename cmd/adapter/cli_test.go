@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestPrintClasses(t *testing.T) {
+	classes := []*pb.Class{
+		{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL", Capacity: 30, Labels: map[string]string{"subject": "math", "level": "ap"}},
+		{Id: "ART1", Name: "Drawing"},
+	}
+	var buf bytes.Buffer
+	if err := printClasses(&buf, outputTable, classes); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") {
+		t.Fatalf("table = %q, want a header and two rows", buf.String())
+	}
+	if !strings.Contains(lines[1], "level=ap,subject=math") || !strings.HasSuffix(strings.TrimSpace(lines[2]), "-") {
+		t.Errorf("rows = %q, want sorted labels and - for no capacity", lines[1:])
+	}
+
+	buf.Reset()
+	if err := printClasses(&buf, outputJSON, classes); err != nil {
+		t.Fatal(err)
+	}
+	var got pb.Classes
+	if err := protojson.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("JSON output doesn't parse as Classes: %v", err)
+	}
+	if !equalIds(ids(got.Classes), []string{"MATH101", "ART1"}) {
+		t.Errorf("JSON output has classes %v", ids(got.Classes))
+	}
+}
+
+func TestParseLabelFlag(t *testing.T) {
+	labels, err := parseLabelFlag("subject=math,note=")
+	if err != nil || len(labels) != 2 || labels["subject"] != "math" || labels["note"] != "" {
+		t.Errorf("parseLabelFlag = %v, %v", labels, err)
+	}
+	if _, err := parseLabelFlag("subject"); err == nil {
+		t.Error("parseLabelFlag accepted a label without =")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (v *violations) checkClone(in *pb.CloneRequest) {
+	v.checkIdAs("source_id", in.SourceId)
+	v.checkIdAs("new_id", in.NewId)
+	if in.NewId != "" && in.NewId == in.SourceId {
+		v.add("new_id", "must differ from source_id")
+	}
+	if len(in.NewSemester) > maxSemesterLength {
+		v.add("new_semester", "must be at most %d characters", maxSemesterLength)
+	} else if in.NewSemester != "" && !semesterPattern.MatchString(in.NewSemester) {
+		v.add("new_semester", "must match %s, e.g. 2024-FALL", semesterPattern)
+	}
+}
+
+// copyEnrollments enrolls the students of one class in another, as of now.
+// The copy has the source's capacity, so they all fit.
+func copyEnrollments(txn *tenantTxn, fromId, toId string) error {
+	enrollments, err := listEnrollments(txn, fromId)
+	if err != nil {
+		return err
+	}
+	now := timestamppb.Now()
+	for _, e := range enrollments {
+		v, err := proto.Marshal(&pb.Enrollment{ClassId: toId, StudentId: e.StudentId, EnrollTime: now})
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(enrollmentKey(toId, e.StudentId), v); err != nil {
+			return fmt.Errorf("put enrollment of %s in %s: %w", e.StudentId, toId, err)
+		}
+	}
+	return setEnrollmentCount(txn, toId, int64(len(enrollments)))
+}
+
+func (s *server) Clone(ctx context.Context, in *pb.CloneRequest) (*pb.Class, error) {
+	logf(ctx, "Clone called for Id %s to %s", in.SourceId, in.NewId)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var c *pb.Class
+	var event *pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		src, err := getClass(txn, in.SourceId)
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "class %s not found", in.SourceId)
+		}
+		if err != nil {
+			return err
+		}
+		exists, err := classExists(txn, in.NewId)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return status.Errorf(codes.AlreadyExists, "class %s already exists", in.NewId)
+		}
+		c = proto.Clone(src).(*pb.Class)
+		c.Id = in.NewId
+		// The source's external Ids still name the source.
+		c.ExternalIds = nil
+		// A clone starts out like a new class, whatever the source's state.
+		c.State = pb.Class_STATE_UNSPECIFIED
+		if in.NewSemester != "" {
+			c.Semester = in.NewSemester
+		}
+		if err := checkReferences(txn, c); err != nil {
+			return err
+		}
+		if err := putClass(txn, c); err != nil {
+			return err
+		}
+		if in.CopyEnrollments {
+			if err := copyEnrollments(txn, in.SourceId, in.NewId); err != nil {
+				return err
+			}
+		}
+		if err := s.audit.record(ctx, txn, "Clone", c.Id, nil, proto.Clone(c).(*pb.Class)); err != nil {
+			return err
+		}
+		event = newClassEvent(pb.ClassEvent_CREATED, tenant, proto.Clone(c).(*pb.Class))
+		txn.record(event)
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	s.forgetRead(tenant, c.Id)
+	s.emit(event)
+	logf(ctx, "Cloned %s to %s", in.SourceId, c.Id)
+	return c, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClone(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		src := &pb.Class{Id: "MATH101", Name: "Calculus", Semester: "2024-FALL", Capacity: 2, Labels: map[string]string{"subject": "math"}}
+		if _, err := s.Create(ctx, src); err != nil {
+			t.Fatal(err)
+		}
+		for _, student := range []string{"s1", "s2"} {
+			if _, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: student}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		c, err := s.Clone(ctx, &pb.CloneRequest{SourceId: "MATH101", NewId: "MATH101-S25", NewSemester: "2025-SPRING", CopyEnrollments: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101-S25"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "Calculus" || got.Semester != "2025-SPRING" || got.Capacity != 2 || got.Labels["subject"] != "math" || c.Semester != got.Semester {
+			t.Errorf("Clone stored %v, want a copy of %v in 2025-SPRING", got, src)
+		}
+		e, err := s.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "MATH101-S25"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.TotalSize != 2 {
+			t.Errorf("clone has %d enrollments, want 2", e.TotalSize)
+		}
+		if _, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101-S25", StudentId: "s3"}); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Enroll in a full clone returned %v, want FailedPrecondition", err)
+		}
+
+		if _, err := s.Clone(ctx, &pb.CloneRequest{SourceId: "MATH101", NewId: "MATH101-F25"}); err != nil {
+			t.Fatal(err)
+		}
+		if e, err := s.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "MATH101-F25"}); err != nil || e.TotalSize != 0 {
+			t.Errorf("clone without copy_enrollments has %v enrollments (%v), want none", e.GetTotalSize(), err)
+		}
+
+		tests := []struct {
+			in   *pb.CloneRequest
+			code codes.Code
+		}{
+			{&pb.CloneRequest{SourceId: "NOPE", NewId: "NEW"}, codes.NotFound},
+			{&pb.CloneRequest{SourceId: "MATH101", NewId: "MATH101-S25"}, codes.AlreadyExists},
+			{&pb.CloneRequest{SourceId: "MATH101", NewId: "MATH101"}, codes.InvalidArgument},
+			{&pb.CloneRequest{SourceId: "MATH101", NewId: "NEW", NewSemester: "someday"}, codes.InvalidArgument},
+		}
+		for _, tt := range tests {
+			err := validateRequest("/class.Adapter/Clone", tt.in)
+			if err == nil {
+				_, err = s.Clone(ctx, tt.in)
+			}
+			if status.Code(err) != tt.code {
+				t.Errorf("Clone(%v) returned %v, want %v", tt.in, err, tt.code)
+			}
+		}
+	})
+}
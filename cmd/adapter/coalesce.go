@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+// The coalescing ratio is 1 - reads/requests.
+var (
+	getRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "adapter_get_requests_total",
+		Help: "Get requests served, including those that shared another request's read.",
+	})
+	getStorageReads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "adapter_get_storage_reads_total",
+		Help: "Storage reads issued for Get requests after coalescing.",
+	})
+)
+
+// readCoalesced runs read once for all concurrent Gets of the same class and
+// hands each caller its own copy of the result. The first Get waits
+// coalesceWindow before reading so that a burst of Gets shares one read.
+// Writes call forgetRead so a Get that arrives after a commit never joins a
+// read started before it.
+//
+// A caller whose ctx ends stops waiting, but the shared read carries on for
+// the others: it runs under a context of its own that none of them can
+// cancel.
+func (s *server) readCoalesced(ctx context.Context, tenant, id string, read func(context.Context) (*pb.Class, error)) (*pb.Class, error) {
+	getRequests.Inc()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	window := s.tuning().coalesceWindow
+	ch := s.reads.DoChan(tenant+"/"+id, func() (interface{}, error) {
+		if window > 0 {
+			time.Sleep(window)
+		}
+		getStorageReads.Inc()
+		return read(context.Background())
+	})
+	select {
+	case r := <-ch:
+		return proto.Clone(r.Val.(*pb.Class)).(*pb.Class), r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *server) forgetRead(tenant, id string) {
+	s.reads.Forget(tenant + "/" + id)
+}
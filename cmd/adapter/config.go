@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Every flag can also be set by an environment variable named after it,
+// e.g. ADAPTER_DATA_DIR for -data-dir.
+const envPrefix = "ADAPTER_"
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// commandLineFlags returns the names of the flags set by fs.Parse. Call it
+// before applyConfig, which sets flags too.
+func commandLineFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyConfig fills in the flags that weren't given on the command line,
+// first from the environment and then from the YAML config file named by
+// configFlag, so flags override the environment, which overrides the file.
+// Config keys are flag names; nested maps join their keys with "-", so
+// keepalive: {time: 1m} sets -keepalive-time.
+func applyConfig(fs *flag.FlagSet, configFlag string, commandLine map[string]bool) error {
+	set := make(map[string]bool, len(commandLine))
+	for name := range commandLine {
+		set[name] = true
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if err != nil || set[f.Name] || !ok {
+			return
+		}
+		if err = fs.Set(f.Name, v); err != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), err)
+		}
+		set[f.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	path := fs.Lookup(configFlag).Value.String()
+	if path == "" {
+		return nil
+	}
+	values, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == configFlag || fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+// loadConfigFile reads a YAML file into flag values keyed by flag name.
+func loadConfigFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[interface{}]interface{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]string)
+	if err := flattenConfig("", doc, values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flattenConfig(prefix string, m map[interface{}]interface{}, values map[string]string) error {
+	for k, v := range m {
+		name := fmt.Sprint(k)
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		switch v := v.(type) {
+		case map[interface{}]interface{}:
+			if err := flattenConfig(name, v, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			return fmt.Errorf("%s: lists are not supported", name)
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
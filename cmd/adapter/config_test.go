@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setEnv sets the environment variable name to value for the rest of t.
+func setEnv(t *testing.T, name, value string) {
+	t.Helper()
+	old, set := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if set {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// writeConfig writes a YAML config file into a new directory.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "adapter.yaml")
+	if err := ioutil.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// configFlags is a small flag set like serve's.
+type configFlags struct {
+	fs            *flag.FlagSet
+	config        *string
+	dataDir       *string
+	listen        *string
+	rateLimit     *float64
+	maxResults    *int
+	keepaliveTime *time.Duration
+	readOnly      *bool
+}
+
+func newConfigFlags() *configFlags {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return &configFlags{
+		fs:            fs,
+		config:        fs.String("config", "", ""),
+		dataDir:       fs.String("data-dir", "data", ""),
+		listen:        fs.String("listen", ":50051", ""),
+		rateLimit:     fs.Float64("rate-limit", 0, ""),
+		maxResults:    fs.Int("list-max-results", 1000, ""),
+		keepaliveTime: fs.Duration("keepalive-time", 2*time.Hour, ""),
+		readOnly:      fs.Bool("read-only", false, ""),
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	path := writeConfig(t, `
+data-dir: /var/lib/adapter
+listen: ":6000"
+rate-limit: 50
+keepalive:
+  time: 1m
+read-only: true
+`)
+	setEnv(t, envName("listen"), ":7000")
+	setEnv(t, envName("rate-limit"), "75")
+
+	// The command line beats the environment, which beats the file.
+	f := newConfigFlags()
+	if err := f.fs.Parse([]string{"-config", path, "-rate-limit", "100"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(f.fs, "config", commandLineFlags(f.fs)); err != nil {
+		t.Fatal(err)
+	}
+	if *f.dataDir != "/var/lib/adapter" || *f.listen != ":7000" || *f.rateLimit != 100 || *f.keepaliveTime != time.Minute || !*f.readOnly {
+		t.Errorf("applyConfig set -data-dir %s, -listen %s, -rate-limit %g, -keepalive-time %s, -read-only %v; want /var/lib/adapter, :7000, 100, 1m0s, true",
+			*f.dataDir, *f.listen, *f.rateLimit, *f.keepaliveTime, *f.readOnly)
+	}
+
+	// Without a file, the environment alone applies.
+	f = newConfigFlags()
+	if err := applyConfig(f.fs, "config", commandLineFlags(f.fs)); err != nil {
+		t.Fatal(err)
+	}
+	if *f.dataDir != "data" || *f.listen != ":7000" {
+		t.Errorf("applyConfig without a file set -data-dir %s, -listen %s; want data, :7000", *f.dataDir, *f.listen)
+	}
+
+	for _, bad := range []struct{ yaml, want string }{
+		{"data-directory: /tmp\n", `unknown setting "data-directory"`},
+		{"config: other.yaml\n", `unknown setting "config"`},
+		{"keepalive-time: soon\n", "keepalive-time"},
+		{"listen: [':6000', ':6001']\n", "lists are not supported"},
+		{"listen: ':6000\n", "adapter.yaml"},
+	} {
+		f := newConfigFlags()
+		if err := f.fs.Parse([]string{"-config", writeConfig(t, bad.yaml)}); err != nil {
+			t.Fatal(err)
+		}
+		err := applyConfig(f.fs, "config", commandLineFlags(f.fs))
+		if err == nil || !strings.Contains(err.Error(), bad.want) {
+			t.Errorf("applyConfig of %q returned %v, want an error mentioning %s", bad.yaml, err, bad.want)
+		}
+	}
+
+	setEnv(t, envName("read-only"), "maybe")
+	f = newConfigFlags()
+	if err := applyConfig(f.fs, "config", commandLineFlags(f.fs)); err == nil || !strings.Contains(err.Error(), envName("read-only")) {
+		t.Errorf("applyConfig with an invalid %s returned %v", envName("read-only"), err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// defaultMethodTimeouts leave the admin calls that rewrite or export a
+// whole database, and the batched writes, without a deadline.
+const defaultMethodTimeouts = "AdminCompact=0,AdminRunGC=0,AdminSyncClassroom=0,AdminOffboardTenant=0,ArchiveSemester=0,BatchDelete=0"
+
+// deadlines gives unary calls that arrive without a deadline a default one,
+// so a client that sets none can't hold a transaction open indefinitely.
+// Scans notice the deadline passing through the transaction's context, and
+// the call fails with DeadlineExceeded. Streams such as Watch are left
+// alone.
+type deadlines struct {
+	mu  sync.RWMutex
+	def time.Duration
+	// Timeouts by full method name, e.g. /class.Adapter/List, or by method
+	// name alone for that method of every service; zero for none.
+	methods map[string]time.Duration
+}
+
+func newDeadlines(def time.Duration, methods map[string]time.Duration) *deadlines {
+	d := &deadlines{}
+	d.set(def, methods)
+	return d
+}
+
+// set replaces the timeouts, e.g. on reload.
+func (d *deadlines) set(def time.Duration, methods map[string]time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.def, d.methods = def, methods
+}
+
+// timeout returns the deadline fullMethod gets, zero for none.
+func (d *deadlines) timeout(fullMethod string) time.Duration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if t, ok := d.methods[fullMethod]; ok {
+		return t
+	}
+	if t, ok := d.methods[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return t
+	}
+	return d.def
+}
+
+func (d *deadlines) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		if t := d.timeout(info.FullMethod); t > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, t)
+			defer cancel()
+		}
+	}
+	return handler(ctx, req)
+}
+
+// parseMethodTimeouts parses comma-separated Method=duration pairs, where
+// Method is a method name such as List or a full one such as
+// /class.Adapter/List.
+func parseMethodTimeouts(s string) (map[string]time.Duration, error) {
+	methods := make(map[string]time.Duration)
+	if s == "" {
+		return methods, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not Method=duration", pair)
+		}
+		t, err := time.ParseDuration(pair[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pair[:i], err)
+		}
+		if t < 0 {
+			return nil, fmt.Errorf("%s: timeout must not be negative", pair[:i])
+		}
+		methods[pair[:i]] = t
+	}
+	return methods, nil
+}
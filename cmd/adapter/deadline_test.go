@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestDeadlinesInterceptor(t *testing.T) {
+	timeouts, err := parseMethodTimeouts("AdminCompact=0,/class.KeyValueStore/Get=1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDeadlines(5*time.Second, timeouts)
+	remaining := func(ctx context.Context, method string) time.Duration {
+		var left time.Duration
+		d.unaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				left = time.Until(deadline)
+			}
+			return nil, nil
+		})
+		return left
+	}
+	for _, tc := range []struct {
+		method   string
+		min, max time.Duration
+	}{
+		{"/class.Adapter/List", 4 * time.Second, 5 * time.Second},
+		{"/class.Adapter/AdminCompact", 0, 0},
+		{"/class.KeyValueStore/Get", 59 * time.Second, time.Minute},
+		{"/class.Adapter/Get", 4 * time.Second, 5 * time.Second},
+	} {
+		if left := remaining(context.Background(), tc.method); left < tc.min || left > tc.max {
+			t.Errorf("%s got %s to run, want %s to %s", tc.method, left, tc.min, tc.max)
+		}
+	}
+
+	// A deadline of the caller's own is kept, even a longer one.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if left := remaining(ctx, "/class.Adapter/List"); left < 59*time.Minute {
+		t.Errorf("the caller's deadline was replaced, %s left", left)
+	}
+
+	d.set(0, nil)
+	if left := remaining(context.Background(), "/class.Adapter/List"); left != 0 {
+		t.Errorf("with no default timeout the call got %s", left)
+	}
+}
+
+func TestParseMethodTimeouts(t *testing.T) {
+	for _, bad := range []string{"List", "=1s", "List=soon", "List=-1s"} {
+		if _, err := parseMethodTimeouts(bad); err == nil {
+			t.Errorf("parseMethodTimeouts(%q) succeeded", bad)
+		}
+	}
+	if _, err := parseMethodTimeouts(defaultMethodTimeouts); err != nil {
+		t.Errorf("the default -method-timeouts don't parse: %v", err)
+	}
+}
+
+func TestViewFailsWhenDeadlinePasses(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		ctx, cancel := context.WithCancel(context.Background())
+		// fn itself succeeds, but the deadline passed while it ran, so its
+		// scans may have stopped short.
+		err := s.view(ctx, defaultTenant, func(txn *tenantTxn) error {
+			cancel()
+			return nil
+		})
+		if err != context.Canceled {
+			t.Errorf("view returned %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+// checkLoopback fails unless addr's host is a loopback address, or a name
+// that only resolves to them. Profiles and goroutine dumps expose memory
+// contents, so the debug server is never reachable from off the host.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("%s listens on every interface; give a loopback host such as 127.0.0.1", addr)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return fmt.Errorf("%s is not a loopback address", ip)
+		}
+	}
+	return nil
+}
+
+// debugHandler serves net/http/pprof under /debug/pprof/, expvar at
+// /debug/vars and a dump of every goroutine's stack at /debug/goroutines.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1<<20)
+		for {
+			n := runtime.Stack(buf, true)
+			if n < len(buf) {
+				buf = buf[:n]
+				break
+			}
+			buf = make([]byte, 2*len(buf))
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf)
+	})
+	return mux
+}
+
+// serveDebug serves debugHandler on addr until the process exits.
+func serveDebug(addr string) {
+	log.Printf("Serving debug endpoints on %v...\n", addr)
+	if err := http.ListenAndServe(addr, debugHandler()); err != nil {
+		log.Fatalf("failed to serve debug endpoints: %v", err)
+	}
+}
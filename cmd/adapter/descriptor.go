@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// apiDescriptor returns the FileDescriptorSet of the adapter's proto files
+// and their imports, each file after the files it imports.
+func apiDescriptor() ([]byte, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(f protoreflect.FileDescriptor)
+	add = func(f protoreflect.FileDescriptor) {
+		if seen[f.Path()] {
+			return
+		}
+		seen[f.Path()] = true
+		imports := f.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(f))
+	}
+	add(pb.File_proto_class_proto)
+	add(adapterv2.File_proto_v2_class_proto)
+	return proto.MarshalOptions{Deterministic: true}.Marshal(set)
+}
+
+func (s *server) GetApiDescriptor(ctx context.Context, in *pb.Empty) (*pb.ApiDescriptor, error) {
+	logf(ctx, "GetApiDescriptor called")
+	b, err := apiDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ApiDescriptor{FileDescriptorSet: b}, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestGetApiDescriptor(t *testing.T) {
+	s := &server{}
+	d, err := s.GetApiDescriptor(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(d.FileDescriptorSet, set); err != nil {
+		t.Fatal(err)
+	}
+	// NewFiles fails if a file the set needs is missing.
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"class.Adapter", "class.Instructors", "class.KeyValueStore", "adapter.v2.Classes", "google.protobuf.Timestamp"} {
+		if _, err := files.FindDescriptorByName(protoreflect.FullName(name)); err != nil {
+			t.Errorf("descriptor set lacks %s: %s", name, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// diffIgnored are Class fields left out of audit diffs: request-only options
+// and the timestamps and etag that change on every write.
+var diffIgnored = map[protoreflect.Name]bool{
+	"lease_token":   true,
+	"update_mask":   true,
+	"validate_only": true,
+	"create_time":   true,
+	"update_time":   true,
+	"etag":          true,
+}
+
+// diffClasses describes field by field how c differs from old, walking the
+// Class descriptor so new fields are covered without changes here. Either
+// class may be nil.
+func diffClasses(old, c *pb.Class) []*pb.FieldChange {
+	var before, after protoreflect.Message
+	if old != nil {
+		before = old.ProtoReflect()
+	}
+	if c != nil {
+		after = c.ProtoReflect()
+	}
+	var changes []*pb.FieldChange
+	fields := (&pb.Class{}).ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if diffIgnored[fd.Name()] {
+			continue
+		}
+		o, n := fieldText(before, fd), fieldText(after, fd)
+		change := &pb.FieldChange{Field: string(fd.Name())}
+		if fd.IsList() || fd.IsMap() {
+			change.Added, change.Removed = difference(n, o), difference(o, n)
+			if len(change.Added) == 0 && len(change.Removed) == 0 {
+				continue
+			}
+		} else {
+			if len(o) > 0 {
+				change.OldValue = o[0]
+			}
+			if len(n) > 0 {
+				change.NewValue = n[0]
+			}
+			if change.OldValue == change.NewValue {
+				continue
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// fieldText renders the value of fd in m as text, one string per element for
+// repeated and map fields. Unset fields render as nothing.
+func fieldText(m protoreflect.Message, fd protoreflect.FieldDescriptor) []string {
+	if m == nil || !m.Has(fd) {
+		return nil
+	}
+	v := m.Get(fd)
+	switch {
+	case fd.IsList():
+		l := v.List()
+		out := make([]string, l.Len())
+		for i := range out {
+			out[i] = valueText(fd, l.Get(i))
+		}
+		return out
+	case fd.IsMap():
+		var out []string
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			out = append(out, fmt.Sprintf("%s=%s", k.String(), valueText(fd.MapValue(), v)))
+			return true
+		})
+		sort.Strings(out)
+		return out
+	}
+	return []string{valueText(fd, v)}
+}
+
+func valueText(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return prototext.MarshalOptions{}.Format(v.Message().Interface())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+	case protoreflect.BytesKind:
+		return fmt.Sprintf("%x", v.Bytes())
+	}
+	return v.String()
+}
+
+// difference returns the elements of a not in b.
+func difference(a, b []string) []string {
+	in := make(map[string]int, len(b))
+	for _, s := range b {
+		in[s]++
+	}
+	var out []string
+	for _, s := range a {
+		if in[s] > 0 {
+			in[s]--
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDiffClasses(t *testing.T) {
+	base := &pb.Class{
+		Id:              "MATH101",
+		Name:            "Algebra",
+		Semester:        "2024-FALL",
+		Capacity:        30,
+		Labels:          map[string]string{"level": "intro", "room": "B2"},
+		PrerequisiteIds: []string{"MATH100"},
+	}
+	tests := []struct {
+		name     string
+		old, new *pb.Class
+		want     []*pb.FieldChange
+	}{
+		{"unchanged", base, base, nil},
+		{
+			"scalars",
+			base,
+			&pb.Class{Id: "MATH101", Name: "Algebra I", Semester: "2024-FALL", Labels: base.Labels, PrerequisiteIds: base.PrerequisiteIds, State: pb.Class_PUBLISHED},
+			[]*pb.FieldChange{
+				{Field: "name", OldValue: "Algebra", NewValue: "Algebra I"},
+				{Field: "capacity", OldValue: "30"},
+				{Field: "state", NewValue: "PUBLISHED"},
+			},
+		},
+		{
+			"labels and prerequisites",
+			base,
+			&pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL", Capacity: 30, Labels: map[string]string{"level": "advanced", "room": "B2", "lab": "yes"}, PrerequisiteIds: []string{"MATH099"}},
+			[]*pb.FieldChange{
+				{Field: "labels", Added: []string{"lab=yes", "level=advanced"}, Removed: []string{"level=intro"}},
+				{Field: "prerequisite_ids", Added: []string{"MATH099"}, Removed: []string{"MATH100"}},
+			},
+		},
+		{
+			// Fields every write sets, or that only steer the request, aren't
+			// changes.
+			"ignored",
+			base,
+			func() *pb.Class {
+				c := proto.Clone(base).(*pb.Class)
+				c.UpdateTime, c.Etag, c.LeaseToken, c.ValidateOnly = timestamppb.Now(), "0123abcd", "token", true
+				return c
+			}(),
+			nil,
+		},
+		{
+			"created",
+			nil,
+			&pb.Class{Id: "ART100", Labels: map[string]string{"room": "A1"}},
+			[]*pb.FieldChange{
+				{Field: "id", NewValue: "ART100"},
+				{Field: "labels", Added: []string{"room=A1"}},
+			},
+		},
+		{
+			"deleted",
+			&pb.Class{Id: "ART100", Name: "Drawing"},
+			nil,
+			[]*pb.FieldChange{
+				{Field: "id", OldValue: "ART100"},
+				{Field: "name", OldValue: "Drawing"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := diffClasses(tt.old, tt.new)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: diffClasses = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !proto.Equal(got[i], tt.want[i]) {
+				t.Errorf("%s: change %d = %v, want %v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestAuditChanges(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		var err error
+		if s.audit, err = newAuditLog(s.db); err != nil {
+			t.Fatal(err)
+		}
+		defer s.audit.close()
+		ctx := context.Background()
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I"}); err != nil {
+			t.Fatal(err)
+		}
+		log, err := s.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(log.Entries) != 2 {
+			t.Fatalf("GetAuditLog returned %d entries, want 2", len(log.Entries))
+		}
+		var updates int
+		for _, e := range log.Entries {
+			if e.Method != "Update" {
+				continue
+			}
+			updates++
+			want := &pb.FieldChange{Field: "name", OldValue: "Algebra", NewValue: "Algebra I"}
+			if len(e.Changes) != 1 || !proto.Equal(e.Changes[0], want) {
+				t.Errorf("the Update entry lists changes %v, want only %v", e.Changes, want)
+			}
+		}
+		if updates != 1 {
+			t.Errorf("GetAuditLog returned %d Update entries, want 1", updates)
+		}
+	})
+}
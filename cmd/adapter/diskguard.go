@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+)
+
+var (
+	diskFreeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "adapter_disk_free_bytes",
+		Help: "Bytes available to the adapter on the file system holding -data-dir.",
+	})
+	diskSizeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "adapter_disk_size_bytes",
+		Help: "Size in bytes of the file system holding -data-dir.",
+	})
+	dbSizeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "adapter_db_size_bytes",
+		Help: "Bytes the database takes up on disk.",
+	})
+	diskGuardTripped = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "adapter_disk_guard_tripped",
+		Help: "1 while writes are refused because of -max-db-size or -min-free-disk, 0 otherwise.",
+	})
+)
+
+// spaceFreeingMethods are the writes a full adapter still takes, since an
+// operator needs them to make room.
+var spaceFreeingMethods = map[string]bool{
+	"/class.Adapter/Delete":              true,
+	"/class.Adapter/BatchDelete":         true,
+	"/class.Adapter/AdminCompact":        true,
+	"/class.Adapter/AdminRunGC":          true,
+	"/class.Adapter/AdminOffboardTenant": true,
+	"/class.Instructors/Delete":          true,
+	"/class.KeyValueStore/Delete":        true,
+	"/adapter.v2.Classes/DeleteClass":    true,
+}
+
+// diskGuard turns an adapter read-only while its database is larger than
+// -max-db-size or the disk holding it has less than -min-free-disk free,
+// so it stops taking writes before Badger runs out of space mid-write.
+// Writes resume once there is room again.
+type diskGuard struct {
+	db  kvDB
+	dir string
+
+	mu        sync.RWMutex
+	maxDBSize int64
+	minFree   int64
+	// Why writes are refused, empty while they aren't.
+	reason string
+
+	// statfs returns the bytes available to the adapter and in total on
+	// the file system holding dir.
+	statfs func(dir string) (free, size uint64, err error)
+}
+
+func newDiskGuard(db kvDB, dir string, maxDBSize, minFree int64) *diskGuard {
+	g := &diskGuard{db: db, dir: dir, statfs: statfs}
+	g.set(maxDBSize, minFree)
+	return g
+}
+
+// set replaces the thresholds, e.g. on reload. Zero disables one.
+func (g *diskGuard) set(maxDBSize, minFree int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxDBSize, g.minFree = maxDBSize, minFree
+}
+
+// errStatfsUnsupported is returned by statfs where the adapter can't
+// measure a file system. Only -max-db-size is enforced there.
+var errStatfsUnsupported = errors.New("measuring free disk space isn't supported on this platform")
+
+// checkDiskGuardSettings validates -max-db-size and -min-free-disk.
+func checkDiskGuardSettings(maxDBSize, minFree int64) error {
+	switch {
+	case maxDBSize < 0:
+		return errors.New("-max-db-size must not be negative")
+	case minFree < 0:
+		return errors.New("-min-free-disk must not be negative")
+	}
+	return nil
+}
+
+// check measures the database and its disk, updating the metrics, and
+// returns why writes must be refused, or "" if they needn't be.
+func (g *diskGuard) check() (string, error) {
+	free, size, err := g.statfs(g.dir)
+	measured := err == nil
+	if err != nil && err != errStatfsUnsupported {
+		return "", err
+	}
+	used, err := g.db.DiskSize()
+	if err != nil {
+		return "", err
+	}
+	if measured {
+		diskFreeBytes.Set(float64(free))
+		diskSizeBytes.Set(float64(size))
+	}
+	dbSizeBytes.Set(float64(used))
+
+	g.mu.RLock()
+	maxDBSize, minFree := g.maxDBSize, g.minFree
+	g.mu.RUnlock()
+	switch {
+	case maxDBSize > 0 && used >= maxDBSize:
+		return fmt.Sprintf("the database takes %d bytes, at or above -max-db-size of %d", used, maxDBSize), nil
+	case measured && minFree > 0 && free < uint64(minFree):
+		return fmt.Sprintf("the disk holding the database has %d bytes free, below -min-free-disk of %d", free, minFree), nil
+	}
+	return "", nil
+}
+
+// run checks the disk every interval until ctx is done, calling onChange
+// each time writes are refused or allowed again. A failed check leaves
+// writes as they are.
+func (g *diskGuard) run(ctx context.Context, interval time.Duration, onChange func(full bool)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reason, err := g.check()
+		if err != nil {
+			log.Printf("Failed to check disk space: %v", err)
+		} else {
+			g.mu.Lock()
+			changed := (reason == "") != (g.reason == "")
+			g.reason = reason
+			g.mu.Unlock()
+			if changed {
+				if reason != "" {
+					log.Printf("Refusing writes: %s", reason)
+					diskGuardTripped.Set(1)
+				} else {
+					log.Printf("Taking writes again: the database is within its disk limits")
+					diskGuardTripped.Set(0)
+				}
+				onChange(reason != "")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refuse returns the error a write to method fails with while the guard
+// has tripped, or nil.
+func (g *diskGuard) refuse(method string) error {
+	if !writeMethods[method] || spaceFreeingMethods[method] {
+		return nil
+	}
+	g.mu.RLock()
+	reason := g.reason
+	g.mu.RUnlock()
+	if reason == "" {
+		return nil
+	}
+	return preconditionFailed(preconditionServer, "server", "adapter is read-only: %s", reason)
+}
+
+func (g *diskGuard) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := g.refuse(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (g *diskGuard) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := g.refuse(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!windows
+
+package main
+
+func statfs(dir string) (free, size uint64, err error) {
+	return 0, 0, errStatfsUnsupported
+}
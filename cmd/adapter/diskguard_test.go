@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDiskGuard(t *testing.T) {
+	dir := t.TempDir()
+	g := newDiskGuard(newTestDB(t, driverBadger, dir), dir, 0, 100)
+	free := uint64(1000)
+	g.statfs = func(string) (uint64, uint64, error) { return free, 10000, nil }
+	var changes []bool
+	check := func() {
+		t.Helper()
+		// With ctx done, run checks once and returns.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		g.run(ctx, time.Hour, func(full bool) { changes = append(changes, full) })
+	}
+	call := func(method string) error {
+		_, err := g.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	}
+
+	check()
+	if len(changes) != 0 || call("/class.Adapter/Create") != nil {
+		t.Fatalf("guard with room tripped: changes %v", changes)
+	}
+
+	free = 50
+	check()
+	if len(changes) != 1 || !changes[0] {
+		t.Fatalf("changes = %v, want the guard to trip", changes)
+	}
+	if err := call("/class.Adapter/Create"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Create on a full disk returned %v, want FailedPrecondition", err)
+	}
+	for _, method := range []string{"/class.Adapter/Get", "/class.Adapter/Delete", "/class.Adapter/AdminRunGC"} {
+		if err := call(method); err != nil {
+			t.Errorf("%s on a full disk returned %v", method, err)
+		}
+	}
+
+	// A reload can lift the limit.
+	g.set(0, 10)
+	check()
+	if len(changes) != 2 || changes[1] || call("/class.Adapter/Create") != nil {
+		t.Errorf("changes = %v, want writes allowed again", changes)
+	}
+
+	size, err := g.db.DiskSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.set(size, 0)
+	if reason, err := g.check(); err != nil || reason == "" {
+		t.Errorf("check of a database at -max-db-size = %q, %v", reason, err)
+	}
+
+	// Where free space can't be measured, -max-db-size still applies.
+	g.statfs = func(string) (uint64, uint64, error) { return 0, 0, errStatfsUnsupported }
+	g.set(size, 100)
+	if reason, err := g.check(); err != nil || reason == "" {
+		t.Errorf("check of a database at -max-db-size without statfs = %q, %v", reason, err)
+	}
+	g.set(0, 100)
+	if reason, err := g.check(); err != nil || reason != "" {
+		t.Errorf("check with only -min-free-disk without statfs = %q, %v, want writes allowed", reason, err)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+func statfs(dir string) (free, size uint64, err error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &size, nil); err != nil {
+		return 0, 0, err
+	}
+	return free, size, nil
+}
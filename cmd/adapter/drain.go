@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Watch streams end with these once they have run too long or the server
+// is shutting down. Both are Unavailable, which clients retry, so a watcher
+// reconnects, through the load balancer, to a server that is staying up.
+var (
+	errWatchMaxAge = status.Error(codes.Unavailable, "watch reached its maximum age; list again and restart the watch")
+	errDraining    = status.Error(codes.Unavailable, "server is shutting down; list again and restart the watch")
+)
+
+// streamDrain ends long-lived streams. A connection GOAWAY'd for
+// -max-connection-age only closes once its streams are done, and a Watch is
+// never done by itself, so without this a watcher would keep its client on
+// the old server, or hold up its shutdown. A nil streamDrain never ends
+// streams.
+type streamDrain struct {
+	maxAge time.Duration
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newStreamDrain(maxAge time.Duration) *streamDrain {
+	return &streamDrain{maxAge: maxAge, done: make(chan struct{})}
+}
+
+// start ends every stream, current and future, for shutdown.
+func (d *streamDrain) start() {
+	d.once.Do(func() { close(d.done) })
+}
+
+// bound returns a context for a stream that ends with ctx, once the stream
+// reaches the maximum age, or when draining starts. Once the context is
+// done, reason returns the status the stream should end with, or nil if
+// ctx ended by itself. Call cancel when the stream ends.
+func (d *streamDrain) bound(ctx context.Context) (bounded context.Context, reason func() error, cancel context.CancelFunc) {
+	bounded, cancel = context.WithCancel(ctx)
+	if d == nil {
+		return bounded, func() error { return nil }, cancel
+	}
+	var mu sync.Mutex
+	var why error
+	end := func(err error) {
+		mu.Lock()
+		why = err
+		mu.Unlock()
+		cancel()
+	}
+	var timer *time.Timer
+	var age <-chan time.Time
+	if d.maxAge > 0 {
+		// Up to 10% either way, as gRPC does for connection ages, so
+		// streams opened together don't all reconnect together.
+		jitter := time.Duration((rand.Float64()*0.2 - 0.1) * float64(d.maxAge))
+		timer = time.NewTimer(d.maxAge + jitter)
+		age = timer.C
+	}
+	go func() {
+		if timer != nil {
+			defer timer.Stop()
+		}
+		select {
+		case <-bounded.Done():
+		case <-age:
+			end(errWatchMaxAge)
+		case <-d.done:
+			end(errDraining)
+		}
+	}()
+	return bounded, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return why
+	}, cancel
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type watchStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w watchStream) Context() context.Context { return w.ctx }
+
+func (w watchStream) Send(*pb.ClassEvent) error { return nil }
+
+func (w watchStream) SendHeader(metadata.MD) error { return nil }
+
+// watchUntilEnd runs a Watch and returns how it ended.
+func watchUntilEnd(t *testing.T, s *server, ctx context.Context) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- s.Watch(&pb.WatchRequest{}, watchStream{ctx: ctx}) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch didn't end")
+		return nil
+	}
+}
+
+func TestWatchEndsAtMaxAge(t *testing.T) {
+	s := &server{events: newEventBus(), drain: newStreamDrain(50 * time.Millisecond)}
+	start := time.Now()
+	err := watchUntilEnd(t, s, context.Background())
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Watch past its max age returned %v, want Unavailable", err)
+	}
+	if d := time.Since(start); d < 45*time.Millisecond {
+		t.Errorf("Watch ended after %v, before its max age", d)
+	}
+}
+
+func TestWatchEndsWhenDraining(t *testing.T) {
+	drain := newStreamDrain(0)
+	s := &server{events: newEventBus(), drain: drain}
+	time.AfterFunc(10*time.Millisecond, drain.start)
+	if err := watchUntilEnd(t, s, context.Background()); err != errDraining {
+		t.Errorf("Watch during shutdown returned %v, want %v", err, errDraining)
+	}
+	// Watches started once draining has begun end right away.
+	if err := watchUntilEnd(t, s, context.Background()); err != errDraining {
+		t.Errorf("Watch started during shutdown returned %v, want %v", err, errDraining)
+	}
+}
+
+func TestWatchEndsWithClient(t *testing.T) {
+	for _, drain := range []*streamDrain{nil, newStreamDrain(time.Hour)} {
+		s := &server{events: newEventBus(), drain: drain}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if err := watchUntilEnd(t, s, ctx); err != nil {
+			t.Errorf("Watch whose client left returned %v, want nil", err)
+		}
+	}
+}
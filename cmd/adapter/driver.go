@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// Values of -storage-driver.
+const (
+	driverBadger = "badger"
+	driverFile   = "file"
+)
+
+// kvDB is the ordered key-value store with serializable transactions that
+// the adapter keeps everything in. Each storage driver implements it, with
+// the semantics of the Badger API it was modelled on: reads in an update
+// see its own writes, ErrKeyNotFound reports a missing key, and entries past
+// their ExpiresAt are gone.
+type kvDB interface {
+	View(fn func(txn kvTxn) error) error
+	Update(fn func(txn kvTxn) error) error
+	// GetSequence returns a counter stored at key, leasing bandwidth values
+	// at a time; values leased but not handed out before Release or a crash
+	// are skipped.
+	GetSequence(key []byte, bandwidth uint64) (kvSequence, error)
+	// DropPrefix deletes every key starting with one of the prefixes.
+	DropPrefix(prefixes ...[]byte) error
+	// Compact merges the database's tables as far as it can, and RunGC
+	// rewrites the data files at least discardRatio stale, returning how
+	// many it rewrote. Drivers whose files never hold stale data do
+	// nothing.
+	Compact() error
+	RunGC(discardRatio float64) (int, error)
+	// DiskSize is the bytes the database takes on disk.
+	DiskSize() (int64, error)
+	// Size is the bytes in the LSM tree and the value log as last measured,
+	// which may lag behind DiskSize.
+	Size() (lsm, vlog int64)
+	Close() error
+}
+
+type kvTxn interface {
+	Get(key []byte) (kvItem, error)
+	Set(key, val []byte) error
+	// SetEntry sets e.Key to e.Value, expiring at e.ExpiresAt if set.
+	SetEntry(e *badger.Entry) error
+	Delete(key []byte) error
+	// NewIterator honours opt.Prefix and opt.Reverse; the other options are
+	// hints a driver may ignore.
+	NewIterator(opt badger.IteratorOptions) kvIterator
+}
+
+type kvItem interface {
+	Key() []byte
+	KeyCopy(dst []byte) []byte
+	// Value calls fn with the value, which is only valid during the call.
+	Value(fn func(val []byte) error) error
+	ValueCopy(dst []byte) ([]byte, error)
+	// ExpiresAt is the Unix time the entry expires at, zero if never.
+	ExpiresAt() uint64
+}
+
+type kvIterator interface {
+	Rewind()
+	Seek(key []byte)
+	Valid() bool
+	ValidForPrefix(prefix []byte) bool
+	Next()
+	Item() kvItem
+	Close()
+}
+
+type kvSequence interface {
+	Next() (uint64, error)
+	Release() error
+}
+
+// dbOptions say how openDB opens a database.
+type dbOptions struct {
+	dir      string
+	readOnly bool
+	// memory keeps the database in memory instead of dir.
+	memory bool
+	// encryptionKey, if set, encrypts the data at rest with AES, rotating
+	// the data keys derived from it every keyRotation.
+	encryptionKey []byte
+	keyRotation   time.Duration
+	// badger tunes the Badger driver, which uses Badger's defaults if nil.
+	badger *badgerFlags
+}
+
+// openDB opens a database with the named driver. Only Badger can keep the
+// database in memory or encrypt it.
+func openDB(driver string, o dbOptions) (kvDB, error) {
+	switch driver {
+	case driverBadger:
+		opts := badger.DefaultOptions(o.dir).WithReadOnly(o.readOnly)
+		if o.memory {
+			opts = badger.DefaultOptions("").WithInMemory(true)
+		}
+		if len(o.encryptionKey) > 0 {
+			opts = opts.WithEncryptionKey(o.encryptionKey)
+			if o.keyRotation > 0 {
+				opts = opts.WithEncryptionKeyRotationDuration(o.keyRotation)
+			}
+			// Badger recommends a block cache when encrypting, so blocks
+			// aren't decrypted again on every read.
+			opts = opts.WithBlockCacheSize(encryptedBlockCacheSize)
+		}
+		if o.badger != nil {
+			var err error
+			if opts, err = o.badger.apply(opts); err != nil {
+				return nil, err
+			}
+			logBadgerOptions(opts)
+		}
+		db, err := badger.Open(opts)
+		if err != nil {
+			return nil, err
+		}
+		return badgerDB{db, opts}, nil
+	case driverFile:
+		switch {
+		case o.memory:
+			return nil, fmt.Errorf("the %s driver can't keep the database in memory", driverFile)
+		case len(o.encryptionKey) > 0:
+			return nil, fmt.Errorf("the %s driver can't encrypt the database", driverFile)
+		}
+		return openFileDB(o.dir, o.readOnly)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q, must be %s or %s", driver, driverBadger, driverFile)
+}
+
+// encryptedBlockCacheSize is the block cache given to encrypted Badger
+// databases.
+const encryptedBlockCacheSize = 64 << 20
+
+// readEncryptionKey reads an AES-128, AES-192 or AES-256 key written as 32,
+// 48 or 64 hex digits, such as the output of "openssl rand -hex 32".
+func readEncryptionKey(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: the key must be written in hex", path)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: the key must be 16, 24 or 32 bytes, not %d", path, len(key))
+}
+
+// badgerDB adapts Badger to kvDB.
+type badgerDB struct {
+	*badger.DB
+	// The options it was opened with.
+	opts badger.Options
+}
+
+func (db badgerDB) View(fn func(txn kvTxn) error) error {
+	return db.DB.View(func(txn *badger.Txn) error {
+		return fn(badgerTxn{txn})
+	})
+}
+
+func (db badgerDB) Update(fn func(txn kvTxn) error) error {
+	return db.DB.Update(func(txn *badger.Txn) error {
+		return fn(badgerTxn{txn})
+	})
+}
+
+func (db badgerDB) GetSequence(key []byte, bandwidth uint64) (kvSequence, error) {
+	seq, err := db.DB.GetSequence(key, bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+func (db badgerDB) Compact() error {
+	return db.Flatten(db.opts.NumCompactors)
+}
+
+// RunGC runs Badger's value log GC until a pass rewrites nothing.
+func (db badgerDB) RunGC(discardRatio float64) (int, error) {
+	var n int
+	for {
+		err := db.RunValueLogGC(discardRatio)
+		switch {
+		case err == badger.ErrNoRewrite, err == badger.ErrGCInMemoryMode:
+			return n, nil
+		case err != nil:
+			return n, err
+		}
+		n++
+	}
+}
+
+// DiskSize adds up the files in Badger's directories, which unlike
+// badger.DB.Size is current right after a compaction or GC.
+func (db badgerDB) DiskSize() (int64, error) {
+	opts := db.opts
+	if opts.InMemory {
+		return 0, nil
+	}
+	dirs := []string{opts.Dir}
+	if opts.ValueDir != opts.Dir {
+		dirs = append(dirs, opts.ValueDir)
+	}
+	var size int64
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return 0, err
+		}
+		for _, f := range files {
+			if f.Mode().IsRegular() {
+				size += f.Size()
+			}
+		}
+	}
+	return size, nil
+}
+
+type badgerTxn struct {
+	*badger.Txn
+}
+
+func (t badgerTxn) Get(key []byte) (kvItem, error) {
+	item, err := t.Txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (t badgerTxn) NewIterator(opt badger.IteratorOptions) kvIterator {
+	return badgerIterator{t.Txn.NewIterator(opt)}
+}
+
+type badgerIterator struct {
+	*badger.Iterator
+}
+
+func (it badgerIterator) Item() kvItem {
+	return it.Iterator.Item()
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+func setKeys(t *testing.T, db kvDB, kvs ...string) {
+	t.Helper()
+	err := db.Update(func(txn kvTxn) error {
+		for i := 0; i < len(kvs); i += 2 {
+			if err := txn.Set([]byte(kvs[i]), []byte(kvs[i+1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getKey(t *testing.T, db kvDB, key string) (string, bool) {
+	t.Helper()
+	var val []byte
+	err := db.View(func(txn kvTxn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return "", false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(val), true
+}
+
+func scanKeys(t *testing.T, db kvDB, opt badger.IteratorOptions, seek string) []string {
+	t.Helper()
+	var keys []string
+	err := db.View(func(txn kvTxn) error {
+		it := txn.NewIterator(opt)
+		defer it.Close()
+		if seek == "" {
+			it.Rewind()
+		} else {
+			it.Seek([]byte(seek))
+		}
+		for ; it.Valid(); it.Next() {
+			keys = append(keys, string(it.Item().Key()))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestDriverGetSetDelete(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		if _, ok := getKey(t, db, "a"); ok {
+			t.Fatal("found a key in an empty database")
+		}
+		setKeys(t, db, "a", "1", "b", "\xff\x00")
+		if v, _ := getKey(t, db, "a"); v != "1" {
+			t.Errorf("a = %q, want 1", v)
+		}
+		if v, _ := getKey(t, db, "b"); v != "\xff\x00" {
+			t.Errorf("b = %q, want binary value back", v)
+		}
+		err := db.Update(func(txn kvTxn) error { return txn.Delete([]byte("a")) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := getKey(t, db, "a"); ok {
+			t.Error("a still there after Delete")
+		}
+	})
+}
+
+func TestDriverIteration(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		setKeys(t, db, "p/c", "", "p/a", "", "q/a", "", "p/b", "", "o", "")
+
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = []byte("p/")
+		for _, tc := range []struct {
+			reverse bool
+			seek    string
+			want    []string
+		}{
+			{false, "", []string{"p/a", "p/b", "p/c"}},
+			{false, "p/b", []string{"p/b", "p/c"}},
+			{false, "p/bb", []string{"p/c"}},
+			{true, "p/\xff", []string{"p/c", "p/b", "p/a"}},
+			{true, "p/bb", []string{"p/b", "p/a"}},
+		} {
+			opt.Reverse = tc.reverse
+			if got := scanKeys(t, db, opt, tc.seek); !equalIds(got, tc.want) {
+				t.Errorf("reverse=%v seek %q: got %v, want %v", tc.reverse, tc.seek, got, tc.want)
+			}
+		}
+	})
+}
+
+func TestDriverReadsOwnWrites(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		setKeys(t, db, "a", "1", "b", "2")
+		err := db.Update(func(txn kvTxn) error {
+			txn.Set([]byte("c"), []byte("3"))
+			txn.Delete([]byte("a"))
+			if _, err := txn.Get([]byte("a")); err != badger.ErrKeyNotFound {
+				t.Errorf("Get of a key deleted in the txn returned %v", err)
+			}
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			var keys []string
+			for it.Rewind(); it.Valid(); it.Next() {
+				keys = append(keys, string(it.Item().Key()))
+			}
+			if want := []string{"b", "c"}; !equalIds(keys, want) {
+				t.Errorf("iterating in the txn got %v, want %v", keys, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDriverDiscardsFailedUpdate(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		setKeys(t, db, "a", "1")
+		errFail := errors.New("fail")
+		err := db.Update(func(txn kvTxn) error {
+			txn.Set([]byte("a"), []byte("2"))
+			txn.Set([]byte("b"), []byte("2"))
+			return errFail
+		})
+		if err != errFail {
+			t.Fatalf("Update returned %v, want the callback's error", err)
+		}
+		if v, _ := getKey(t, db, "a"); v != "1" {
+			t.Errorf("a = %q after a failed update, want 1", v)
+		}
+		if _, ok := getKey(t, db, "b"); ok {
+			t.Error("b written by a failed update")
+		}
+	})
+}
+
+func TestDriverViewIsReadOnly(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		err := db.View(func(txn kvTxn) error { return txn.Set([]byte("a"), nil) })
+		if err != badger.ErrReadOnlyTxn {
+			t.Errorf("Set in a View returned %v, want ErrReadOnlyTxn", err)
+		}
+	})
+}
+
+func TestDriverExpiry(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		past := uint64(time.Now().Add(-time.Minute).Unix())
+		future := uint64(time.Now().Add(time.Hour).Unix())
+		err := db.Update(func(txn kvTxn) error {
+			e := badger.NewEntry([]byte("old"), []byte("x"))
+			e.ExpiresAt = past
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+			e = badger.NewEntry([]byte("new"), []byte("x"))
+			e.ExpiresAt = future
+			return txn.SetEntry(e)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := getKey(t, db, "old"); ok {
+			t.Error("expired entry still readable")
+		}
+		if got := scanKeys(t, db, badger.DefaultIteratorOptions, ""); !equalIds(got, []string{"new"}) {
+			t.Errorf("iteration got %v, want only the unexpired entry", got)
+		}
+		db.View(func(txn kvTxn) error {
+			item, err := txn.Get([]byte("new"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.ExpiresAt() != future {
+				t.Errorf("ExpiresAt = %d, want %d", item.ExpiresAt(), future)
+			}
+			return nil
+		})
+	})
+}
+
+func TestDriverDropPrefix(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		setKeys(t, db, "a/1", "", "a/2", "", "b/1", "", "c/1", "")
+		if err := db.DropPrefix([]byte("a/"), []byte("c/")); err != nil {
+			t.Fatal(err)
+		}
+		if got := scanKeys(t, db, badger.DefaultIteratorOptions, ""); !equalIds(got, []string{"b/1"}) {
+			t.Errorf("after DropPrefix got %v, want [b/1]", got)
+		}
+	})
+}
+
+func TestDriverSequence(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		seq, err := db.GetSequence([]byte("seq"), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var last uint64
+		for i := 0; i < 5; i++ {
+			n, err := seq.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i > 0 && n <= last {
+				t.Fatalf("sequence went from %d to %d", last, n)
+			}
+			last = n
+		}
+		if err := seq.Release(); err != nil {
+			t.Fatal(err)
+		}
+		seq, err = db.GetSequence([]byte("seq"), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer seq.Release()
+		n, err := seq.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n <= last {
+			t.Errorf("new sequence started at %d, want more than %d", n, last)
+		}
+	})
+}
+
+func TestFileDriverPersists(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDB(driverFile, dbOptions{dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setKeys(t, db, "a", "1", "b", "\x00\xff")
+	db.Close()
+
+	db, err = openDB(driverFile, dbOptions{dir: dir, readOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, _ := getKey(t, db, "a"); v != "1" {
+		t.Errorf("a = %q after reopening, want 1", v)
+	}
+	if v, _ := getKey(t, db, "b"); v != "\x00\xff" {
+		t.Errorf("b = %q after reopening, want binary value back", v)
+	}
+	if err := db.Update(func(txn kvTxn) error { return nil }); err == nil {
+		t.Error("Update succeeded on a read-only database")
+	}
+}
+
+func TestBadgerEncryption(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := readEncryptionKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDir := filepath.Join(dir, "data")
+	db, err := openDB(driverBadger, dbOptions{dir: dataDir, encryptionKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setKeys(t, db, "MATH101.Name", "Algebra")
+	db.Close()
+
+	// Badger keeps small values in the LSM tree, so look for the value in
+	// every file it wrote.
+	files, _ := filepath.Glob(filepath.Join(dataDir, "*"))
+	for _, f := range files {
+		b, _ := ioutil.ReadFile(f)
+		if bytes.Contains(b, []byte("Algebra")) {
+			t.Errorf("%s holds the value in the clear", filepath.Base(f))
+		}
+	}
+	if db, err := openDB(driverBadger, dbOptions{dir: dataDir}); err == nil {
+		db.Close()
+		t.Error("opened an encrypted database without the key")
+	}
+	db, err = openDB(driverBadger, dbOptions{dir: dataDir, encryptionKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, _ := getKey(t, db, "MATH101.Name"); v != "Algebra" {
+		t.Errorf("read %q back, want Algebra", v)
+	}
+}
+
+func TestReadEncryptionKeyErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"short":  "abcd",
+		"notHex": strings.Repeat("zz", 16),
+	} {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(contents), 0600)
+		if _, err := readEncryptionKey(path); err == nil {
+			t.Errorf("%s: readEncryptionKey accepted %q", name, contents)
+		}
+	}
+	if _, err := openDB(driverFile, dbOptions{dir: dir, encryptionKey: make([]byte, 32)}); err == nil {
+		t.Error("the file driver accepted an encryption key")
+	}
+}
@@ -0,0 +1,702 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/virtual-class-tutor/class-adapter-file/pkg/client"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// e2eAdapter is an adapter serving over bufconn through the interceptors
+// and services serve sets up, so tests see what a real client would.
+type e2eAdapter struct {
+	srv    *server
+	client *client.Client
+	// conn is a plain connection, for the services the client doesn't
+	// cover and for calls that must skip its retries.
+	conn   *grpc.ClientConn
+	dialer grpc.DialOption
+}
+
+// e2eStorage are the databases the end-to-end tests run against.
+var e2eStorage = []struct {
+	name  string
+	newDB func(t *testing.T) kvDB
+}{
+	{"disk", func(t *testing.T) kvDB { return newTestDB(t, driverBadger, t.TempDir()) }},
+	{"memory", func(t *testing.T) kvDB {
+		opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+		db, err := badger.Open(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return badgerDB{db, opts}
+	}},
+}
+
+// forEachStorage runs test as a subtest against a new adapter on each kind
+// of storage in e2eStorage. authTokensFile is as -auth-tokens-file.
+func forEachStorage(t *testing.T, authTokensFile string, test func(t *testing.T, a *e2eAdapter)) {
+	for _, storage := range e2eStorage {
+		storage := storage
+		t.Run(storage.name, func(t *testing.T) {
+			test(t, startE2E(t, storage.newDB(t), authTokensFile))
+		})
+	}
+}
+
+// startE2E serves db, with a client ready unless authTokensFile is set;
+// then tests dial their own with the token they need.
+func startE2E(t *testing.T, db kvDB, authTokensFile string) *e2eAdapter {
+	t.Helper()
+	srv := newE2EServer(t, db)
+	auth, err := newTokenAuth(authTokensFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unary, stream := e2eInterceptors(t, auth)
+	gs, _ := newGRPCServer(localServices(srv, 1000, 64<<10), nil, unary, stream)
+	lis := bufconn.Listen(1 << 20)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	})
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	a := &e2eAdapter{srv: srv, conn: conn, dialer: dialer}
+	if authTokensFile == "" {
+		a.client = a.dial(t)
+	}
+	return a
+}
+
+// newE2EServer returns a server for db set up as serve would.
+func newE2EServer(t *testing.T, db kvDB) *server {
+	t.Helper()
+	if err := migrateKeySchema(db); err != nil {
+		t.Fatal(err)
+	}
+	calendar, err := parseCalendar(defaultCalendar, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &server{
+		db:              db,
+		events:          newEventBus(),
+		calendar:        calendar,
+		checkInvariants: true,
+		snapshots:       newSnapshotRegistry(time.Minute),
+		cache:           newReadCache(100),
+		drain:           newStreamDrain(0),
+	}
+	t.Cleanup(srv.snapshots.close)
+	policy, err := loadClientPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.setTuning(tunables{paginationMode: paginationOptional, clientPolicy: policy})
+	if srv.audit, err = newAuditLog(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.audit.close)
+	if srv.changelog, err = newChangelog(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// e2eInterceptors returns the interceptor chains serve sets up, without
+// rate limits.
+func e2eInterceptors(t *testing.T, auth *tokenAuth) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	t.Helper()
+	timeouts, err := parseMethodTimeouts(defaultMethodTimeouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return interceptors(newAccessLog(false, nil), newDeadlines(5*time.Second, timeouts), auth, newRateLimiter(0, 0, 0, 0))
+}
+
+func (a *e2eAdapter) dial(t *testing.T, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.Dial(context.Background(), "bufnet", append([]client.Option{client.WithDialOptions(grpc.WithInsecure(), a.dialer)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// badRequestFields returns the fields of the BadRequest err carries.
+func badRequestFields(err error) []string {
+	var fields []string
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	return fields
+}
+
+// preconditionType returns the type of the PreconditionFailure err carries.
+func preconditionType(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if pf, ok := d.(*errdetails.PreconditionFailure); ok && len(pf.Violations) > 0 {
+			return pf.Violations[0].Type
+		}
+	}
+	return ""
+}
+
+func TestE2EClasses(t *testing.T) {
+	forEachStorage(t, "", func(t *testing.T, a *e2eAdapter) {
+		c := a.client
+		v2 := adapterv2.NewClassesClient(a.conn)
+		ctx := context.Background()
+
+		if _, err := c.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL", Capacity: 30, Labels: map[string]string{"subject": "math"}}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := c.Create(ctx, &pb.Class{Id: strings.Repeat("M", maxIdLength+1), Name: "Algebra"})
+		if status.Code(err) != codes.InvalidArgument || strings.Join(badRequestFields(err), ",") != "id" {
+			t.Errorf("creating an invalid Id got %v with fields %v, want InvalidArgument on id", err, badRequestFields(err))
+		}
+		if client.RequestId(err) == "" {
+			t.Errorf("error %v carries no request Id", err)
+		}
+		if got, err := c.GetClass(ctx, "MATH101"); err != nil || got.Name != "Algebra" || got.CreateTime == nil {
+			t.Errorf("GetClass returned %v, %v", got, err)
+		}
+		if ok, err := c.ClassExists(ctx, "NOPE"); err != nil || ok {
+			t.Errorf("ClassExists of a missing class returned %v, %v", ok, err)
+		}
+
+		mask := &fieldmaskpb.FieldMask{Paths: []string{"name"}}
+		if _, err := c.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I", UpdateMask: mask}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Update(ctx, &pb.Class{Id: "NOPE", Name: "Nope", UpdateMask: mask}); status.Code(err) != codes.NotFound {
+			t.Errorf("updating a missing class got %v, want NotFound", err)
+		}
+		if _, err := c.Update(ctx, &pb.Class{Id: "MATH101", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"colour"}}}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("updating an unknown field got %v, want InvalidArgument", err)
+		}
+
+		// Another session's edit lease blocks updates without its token.
+		lease, err := c.AcquireEditLease(ctx, &pb.AcquireEditLeaseRequest{Id: "MATH101", Holder: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only the token renews it; naming its holder doesn't.
+		if l, err := c.AcquireEditLease(ctx, &pb.AcquireEditLeaseRequest{Id: "MATH101", Holder: "alice"}); preconditionType(err) != preconditionLease || l != nil {
+			t.Errorf("acquiring alice's lease without its token returned %v, %v, want a LEASE precondition failure", l, err)
+		}
+		renewed, err := c.AcquireEditLease(ctx, &pb.AcquireEditLeaseRequest{Id: "MATH101", Holder: "alice", Token: lease.Token, TtlSeconds: 600})
+		if err != nil || renewed.Token != lease.Token || !renewed.ExpireTime.AsTime().After(lease.ExpireTime.AsTime()) {
+			t.Errorf("renewing with the token returned %v, %v", renewed, err)
+		}
+		_, err = c.Update(ctx, &pb.Class{Id: "MATH101", Capacity: 25, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"capacity"}}})
+		if status.Code(err) != codes.FailedPrecondition || preconditionType(err) != preconditionLease {
+			t.Errorf("updating a leased class got %v, want a LEASE precondition failure", err)
+		}
+		if _, err := c.Update(ctx, &pb.Class{Id: "MATH101", Capacity: 25, LeaseToken: lease.Token, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"capacity"}}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ReleaseEditLease(ctx, &pb.ReleaseEditLeaseRequest{Id: "MATH101", Token: lease.Token}); err != nil {
+			t.Fatal(err)
+		}
+
+		// v2 reads and writes the same classes.
+		if _, err := v2.CreateClass(ctx, &adapterv2.CreateClassRequest{ClassId: "MATH102", Class: &adapterv2.Class{DisplayName: "Geometry", Semester: "2024-FALL"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v2.CreateClass(ctx, &adapterv2.CreateClassRequest{ClassId: "MATH101", Class: &adapterv2.Class{DisplayName: "Again"}}); status.Code(err) != codes.AlreadyExists {
+			t.Errorf("v2 CreateClass of an existing class got %v, want AlreadyExists", err)
+		}
+		if got, err := v2.GetClass(ctx, &adapterv2.GetClassRequest{Name: "classes/MATH101"}); err != nil || got.DisplayName != "Algebra I" || got.Capacity != 25 {
+			t.Errorf("v2 GetClass returned %v, %v", got, err)
+		}
+		if list, err := v2.ListClasses(ctx, &adapterv2.ListClassesRequest{LabelSelector: "subject=math"}); err != nil || len(list.Classes) != 1 {
+			t.Errorf("v2 ListClasses by label returned %v, %v", list, err)
+		}
+
+		if n, err := c.Count(ctx, &pb.CountRequest{Semester: "2024-FALL"}); err != nil || n.Total != 2 {
+			t.Errorf("Count returned %v, %v", n, err)
+		}
+		if got, err := c.ListClassesBySemester(ctx, "2024-FALL"); err != nil || !equalIds(ids(got), []string{"MATH101", "MATH102"}) {
+			t.Errorf("ListClassesBySemester returned %v, %v", got, err)
+		}
+		if _, err := c.GetByExternalId(ctx, &pb.GetByExternalIdRequest{System: "sis", Id: "42"}); status.Code(err) != codes.NotFound {
+			t.Errorf("GetByExternalId of an unknown Id got %v, want NotFound", err)
+		}
+
+		if _, err := c.Delete(ctx, &pb.Class{Id: "MATH102", ValidateOnly: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.DeleteClass(ctx, "MATH102"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v2.DeleteClass(ctx, &adapterv2.DeleteClassRequest{Name: "classes/MATH102"}); status.Code(err) != codes.NotFound {
+			t.Errorf("v2 DeleteClass of a deleted class got %v, want NotFound", err)
+		}
+		if _, err := v2.DeleteClass(ctx, &adapterv2.DeleteClassRequest{Name: "classes/MATH102", AllowMissing: true}); err != nil {
+			t.Errorf("v2 DeleteClass with allow_missing got %v", err)
+		}
+
+		audit, err := c.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var methods []string
+		for _, e := range audit.Entries {
+			methods = append(methods, e.Method)
+		}
+		if strings.Join(methods, ",") != "Create,Update,Update" {
+			t.Errorf("audit log of MATH101 has %v", methods)
+		}
+	})
+}
+
+func TestE2EPagination(t *testing.T) {
+	forEachStorage(t, "", func(t *testing.T, a *e2eAdapter) {
+		c := a.client
+		ctx := context.Background()
+		var want []string
+		for i := 0; i < 25; i++ {
+			id := fmt.Sprintf("CS%03d", i)
+			want = append(want, id)
+			if _, err := c.Create(ctx, &pb.Class{Id: id, Name: fmt.Sprintf("Course %d", 24-i), Semester: "2024-FALL"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got []string
+		var sizes []int
+		req := &pb.ListRequest{PageSize: 10}
+		for {
+			page, err := c.List(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.TotalSize != 25 {
+				t.Errorf("page reports %d classes in total, want 25", page.TotalSize)
+			}
+			sizes = append(sizes, len(page.Classes))
+			got = append(got, ids(page.Classes)...)
+			if page.NextPageToken == "" {
+				break
+			}
+			req.PageToken = page.NextPageToken
+		}
+		if fmt.Sprint(sizes) != "[10 10 5]" || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("pages of %v held %v, want %v", sizes, got, want)
+		}
+
+		// Page tokens remember the order.
+		all, err := c.ListClasses(ctx, &pb.ListRequest{PageSize: 7, OrderBy: "name desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 25 || all[0].Name != "Course 9" || all[24].Name != "Course 0" {
+			t.Errorf("ListClasses by name desc returned %d classes from %v to %v", len(all), all[0], all[len(all)-1])
+		}
+		page, err := c.List(ctx, &pb.ListRequest{PageSize: 7, OrderBy: "name"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.List(ctx, &pb.ListRequest{PageSize: 7, PageToken: page.NextPageToken, OrderBy: "id"}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("changing the order between pages got %v, want InvalidArgument", err)
+		}
+		if _, err := c.List(ctx, &pb.ListRequest{PageSize: 7, PageToken: "!!!"}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("a garbage page token got %v, want InvalidArgument", err)
+		}
+
+		bySemester, err := c.ListClassesBySemester(ctx, "2024-FALL")
+		if err != nil || len(bySemester) != 25 {
+			t.Errorf("ListClassesBySemester returned %d classes, %v", len(bySemester), err)
+		}
+		v2 := adapterv2.NewClassesClient(a.conn)
+		v2page, err := v2.ListClasses(ctx, &adapterv2.ListClassesRequest{PageSize: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2rest, err := v2.ListClasses(ctx, &adapterv2.ListClassesRequest{PageSize: 20, PageToken: v2page.NextPageToken})
+		if err != nil || len(v2page.Classes)+len(v2rest.Classes) != 25 || v2rest.NextPageToken != "" {
+			t.Errorf("v2 pages held %d and %d classes, %v", len(v2page.Classes), len(v2rest.Classes), err)
+		}
+	})
+}
+
+func TestE2EConcurrentWrites(t *testing.T) {
+	forEachStorage(t, "", func(t *testing.T, a *e2eAdapter) {
+		c := a.client
+		ctx := context.Background()
+		if _, err := c.Create(ctx, &pb.Class{Id: "ART1", Name: "Drawing", Capacity: 4}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Creates of different classes, updates of the same class and
+		// enrollments competing for its seats all run at once.
+		var wg sync.WaitGroup
+		errs := make(chan error, 40)
+		enrolled := make(chan string, 10)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := c.Create(ctx, &pb.Class{Id: fmt.Sprintf("ART%d", 100+i), Name: "Sculpture"})
+				errs <- err
+			}(i)
+		}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := c.Update(ctx, &pb.Class{Id: "ART1", Description: fmt.Sprintf("take %d", i), UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"description"}}})
+				errs <- err
+			}(i)
+		}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				student := fmt.Sprintf("s%d", i)
+				_, err := c.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "ART1", StudentId: student})
+				switch {
+				case err == nil:
+					enrolled <- student
+				case preconditionType(err) != preconditionCapacity:
+					errs <- err
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		close(enrolled)
+		for err := range errs {
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		if len(enrolled) != 4 {
+			t.Errorf("%d students enrolled in a class of 4", len(enrolled))
+		}
+
+		if n, err := c.Count(ctx, &pb.CountRequest{}); err != nil || n.Total != 21 {
+			t.Errorf("Count after concurrent creates returned %v, %v", n, err)
+		}
+		es, err := c.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "ART1"})
+		if err != nil || es.TotalSize != 4 {
+			t.Errorf("ListEnrollments returned %v, %v", es, err)
+		}
+		audit, err := c.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "ART1"})
+		if err != nil || len(audit.Entries) != 11 {
+			t.Errorf("audit log of ART1 has %d entries, want the create and 10 updates: %v", len(audit.Entries), err)
+		}
+	})
+}
+
+func TestE2EStreams(t *testing.T) {
+	forEachStorage(t, "", func(t *testing.T, a *e2eAdapter) {
+		c := a.client
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		watch, err := c.Watch(ctx, &pb.WatchRequest{Semester: "2024-FALL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The header says the watch is in place.
+		if _, err := watch.Header(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Create(ctx, &pb.Class{Id: "HIST1", Name: "Rome", Semester: "2023-FALL"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Create(ctx, &pb.Class{Id: "HIST2", Name: "Greece", Semester: "2024-FALL"}); err != nil {
+			t.Fatal(err)
+		}
+		e, err := watch.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != pb.ClassEvent_CREATED || e.Class.Id != "HIST2" {
+			t.Errorf("Watch of 2024-FALL got %v, want HIST2 created", e)
+		}
+		if _, err := c.Watch(ctx, &pb.WatchRequest{Semester: "autumn"}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := c.ImportRosterCSV(ctx, strings.NewReader("id,name,semester\nHIST3,Egypt,2024-FALL\nHIST4,Persia,2024-FALL\n"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Created != 2 || res.Failed != 0 {
+			t.Errorf("ImportRosterCSV returned %v", res)
+		}
+		res, err = c.ImportRosterCSV(ctx, strings.NewReader("id,name\nHIST5,China\n"+strings.Repeat("H", maxIdLength+1)+",India\n"), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.DryRun || res.Created != 1 || res.Failed != 1 {
+			t.Errorf("dry run of ImportRosterCSV returned %v", res)
+		}
+
+		replay, err := c.ReplayChanges(ctx, &pb.ReplayChangesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var replayed []string
+		for {
+			e, err := replay.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			replayed = append(replayed, e.Class.Id)
+		}
+		if strings.Join(replayed, ",") != "HIST1,HIST2,HIST3,HIST4" {
+			t.Errorf("ReplayChanges sent %v", replayed)
+		}
+	})
+}
+
+func TestE2EServices(t *testing.T) {
+	forEachStorage(t, "", func(t *testing.T, a *e2eAdapter) {
+		c := a.client
+		ctx := context.Background()
+
+		// Instructors, and the classes that name them.
+		if _, err := c.Instructors.Create(ctx, &pb.Instructor{Id: "hopper", Name: "Grace Hopper"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Create(ctx, &pb.Class{Id: "CS101", Name: "Compilers", Semester: "2024-FALL", InstructorId: "ghost"}); preconditionType(err) != preconditionInstructor {
+			t.Errorf("naming a missing instructor got %v, want an INSTRUCTOR precondition failure", err)
+		}
+		if _, err := c.Create(ctx, &pb.Class{Id: "CS101", Name: "Compilers", Semester: "2024-FALL", InstructorId: "hopper"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Instructors.Delete(ctx, &pb.InstructorRequest{Id: "hopper"}); preconditionType(err) != preconditionInstructor {
+			t.Errorf("deleting an assigned instructor got %v, want an INSTRUCTOR precondition failure", err)
+		}
+		if got, err := c.GetInstructor(ctx, "hopper"); err != nil || got.Name != "Grace Hopper" {
+			t.Errorf("GetInstructor returned %v, %v", got, err)
+		}
+		if list, err := c.Instructors.List(ctx, &pb.ListInstructorsRequest{}); err != nil || len(list.Instructors) != 1 {
+			t.Errorf("Instructors.List returned %v, %v", list, err)
+		}
+
+		// Prerequisites, bundles, clones and transactions.
+		if _, err := c.Create(ctx, &pb.Class{Id: "CS201", Name: "Interpreters", PrerequisiteIds: []string{"CS101"}}); err != nil {
+			t.Fatal(err)
+		}
+		tree, err := c.GetPrerequisiteTree(ctx, &pb.PrerequisiteTreeRequest{Id: "CS201"})
+		if err != nil || len(tree.Prerequisites) != 1 || tree.Prerequisites[0].Class.Id != "CS101" {
+			t.Errorf("GetPrerequisiteTree returned %v, %v", tree, err)
+		}
+		if _, err := c.CreateClassBundle(ctx, &pb.ClassBundle{Class: &pb.Class{Id: "CS301", Name: "Linkers"}, Sections: []*pb.Section{{Id: "01", StudentIds: []string{"s1"}}}}); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := c.GetClassBundle(ctx, &pb.GetRequest{Id: "CS301"}); err != nil || len(b.Sections) != 1 {
+			t.Errorf("GetClassBundle returned %v, %v", b, err)
+		}
+		if cl, err := c.Clone(ctx, &pb.CloneRequest{SourceId: "CS101", NewId: "CS101-S", NewSemester: "2025-SPRING"}); err != nil || cl.Semester != "2025-SPRING" {
+			t.Errorf("Clone returned %v, %v", cl, err)
+		}
+		tx, err := c.Transact(ctx, &pb.TransactRequest{Ops: []*pb.TransactOp{
+			{Op: &pb.TransactOp_Create{Create: &pb.Class{Id: "CS401", Name: "Loaders"}}},
+			{Op: &pb.TransactOp_Delete{Delete: &pb.Class{Id: "CS301"}}},
+		}})
+		if err != nil || len(tx.Results) != 2 {
+			t.Errorf("Transact returned %v, %v", tx, err)
+		}
+		if _, err := c.Transact(ctx, &pb.TransactRequest{Ops: []*pb.TransactOp{
+			{Op: &pb.TransactOp_Create{Create: &pb.Class{Id: "CS501", Name: "Debuggers"}}},
+			{Op: &pb.TransactOp_Update{Update: &pb.Class{Id: "NOPE", Name: "Nope", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}}}},
+		}}); status.Code(err) != codes.NotFound {
+			t.Errorf("Transact updating a missing class got %v, want NotFound", err)
+		}
+		if ok, _ := c.ClassExists(ctx, "CS501"); ok {
+			t.Error("failed Transact created CS501")
+		}
+
+		// Saved queries.
+		if _, err := c.SaveQuery(ctx, &pb.SavedQuery{Name: "fall", Query: &pb.ClassQuery{Semester: "2024-FALL"}}); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := c.RunSavedQuery(ctx, &pb.SavedQueryRequest{Name: "fall"}); err != nil || !equalIds(ids(got.Classes), []string{"CS101"}) {
+			t.Errorf("RunSavedQuery returned %v, %v", got, err)
+		}
+		for _, list := range []func(context.Context, *pb.Empty, ...grpc.CallOption) (*pb.SavedQueries, error){c.ListSavedQueries, c.AdminListSavedQueries} {
+			if qs, err := list(ctx, &pb.Empty{}); err != nil || len(qs.Queries) != 1 {
+				t.Errorf("listing saved queries returned %v, %v", qs, err)
+			}
+		}
+		if _, err := c.DeleteSavedQuery(ctx, &pb.SavedQueryRequest{Name: "fall"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.RunSavedQuery(ctx, &pb.SavedQueryRequest{Name: "fall"}); status.Code(err) != codes.NotFound {
+			t.Errorf("running a deleted query got %v, want NotFound", err)
+		}
+
+		// The key-value store.
+		if _, err := c.KeyValueStore.Put(ctx, &pb.KeyValue{Namespace: "tutor-sessions", Key: "s1", Value: []byte("active")}); err != nil {
+			t.Fatal(err)
+		}
+		if kv, err := c.KeyValueStore.Get(ctx, &pb.KeyRequest{Namespace: "tutor-sessions", Key: "s1"}); err != nil || string(kv.Value) != "active" {
+			t.Errorf("KeyValueStore.Get returned %v, %v", kv, err)
+		}
+		if kvs, err := c.KeyValueStore.List(ctx, &pb.ListKeysRequest{Namespace: "tutor-sessions"}); err != nil || len(kvs.Entries) != 1 {
+			t.Errorf("KeyValueStore.List returned %v, %v", kvs, err)
+		}
+		if _, err := c.KeyValueStore.Delete(ctx, &pb.KeyRequest{Namespace: "tutor-sessions", Key: "s1"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.KeyValueStore.Get(ctx, &pb.KeyRequest{Namespace: "tutor-sessions", Key: "s1"}); status.Code(err) != codes.NotFound {
+			t.Errorf("getting a deleted key got %v, want NotFound", err)
+		}
+
+		// Archiving a semester that has ended, and deleting in bulk.
+		if _, err := c.Create(ctx, &pb.Class{Id: "OLD1", Name: "Punch cards", Semester: "2001-FALL"}); err != nil {
+			t.Fatal(err)
+		}
+		if res, err := c.ArchiveSemester(ctx, &pb.ArchiveSemesterRequest{Semester: "2001-FALL"}); err != nil || res.ArchivedCount != 1 {
+			t.Errorf("ArchiveSemester returned %v, %v", res, err)
+		}
+		if got, err := c.ListArchived(ctx, &pb.ListArchivedRequest{Semester: "2001-FALL"}); err != nil || !equalIds(ids(got.Classes), []string{"OLD1"}) {
+			t.Errorf("ListArchived returned %v, %v", got, err)
+		}
+		if _, err := c.ArchiveSemester(ctx, &pb.ArchiveSemesterRequest{Semester: "2999-FALL"}); preconditionType(err) != preconditionSemester {
+			t.Errorf("archiving a future semester got %v, want a SEMESTER precondition failure", err)
+		}
+		if res, err := c.BatchDelete(ctx, &pb.DeleteFilter{IdPrefix: "CS4"}); err != nil || res.DeletedCount != 1 {
+			t.Errorf("BatchDelete returned %v, %v", res, err)
+		}
+
+		// Reads about the server and its data.
+		info, err := c.GetServerInfo(ctx, &pb.Empty{})
+		if err != nil || len(info.Features) != len(features) {
+			t.Errorf("GetServerInfo returned %v, %v", info, err)
+		}
+		if schema, err := c.DescribeSchema(ctx, &pb.Empty{}); err != nil || len(schema.Fields) == 0 {
+			t.Errorf("DescribeSchema returned %v, %v", schema, err)
+		}
+		if d, err := c.GetApiDescriptor(ctx, &pb.Empty{}); err != nil || len(d.FileDescriptorSet) == 0 {
+			t.Errorf("GetApiDescriptor returned %d bytes, %v", len(d.GetFileDescriptorSet()), err)
+		}
+		if p, err := c.GetClientPolicy(ctx, &pb.Empty{}); err != nil || p.RetryPolicy == nil {
+			t.Errorf("GetClientPolicy returned %v, %v", p, err)
+		}
+		if st, err := c.Stats(ctx, &pb.Empty{}); err != nil || st.ClassCount != 3 {
+			t.Errorf("Stats returned %v, %v", st, err)
+		}
+		if sem, err := c.GetSemester(ctx, &pb.GetSemesterRequest{Semester: "2024-FALL"}); err != nil || sem.StartTime == nil {
+			t.Errorf("GetSemester returned %v, %v", sem, err)
+		}
+		if _, err := c.GetAggregateStats(ctx, &pb.AggregateStatsRequest{GroupBy: []string{"semester"}}); err != nil {
+			t.Error(err)
+		}
+		if q, err := c.AdminListQuarantined(ctx, &pb.Empty{}); err != nil || len(q.Classes) != 0 {
+			t.Errorf("AdminListQuarantined returned %v, %v", q, err)
+		}
+		if _, err := c.AdminListOffboardCertificates(ctx, &pb.Empty{}); err != nil {
+			t.Error(err)
+		}
+		if _, err := c.AdminCompact(ctx, &pb.Empty{}); err != nil {
+			t.Error(err)
+		}
+
+		// Features this adapter wasn't started with.
+		if _, err := c.AdminOffboardTenant(ctx, &pb.OffboardTenantRequest{Tenant: "gone", ArchiveKey: make([]byte, 32)}); preconditionType(err) != preconditionServer {
+			t.Errorf("offboarding without -offboard-dir got %v, want a SERVER precondition failure", err)
+		}
+		if _, err := c.AdminSyncClassroom(ctx, &pb.Empty{}); preconditionType(err) != preconditionServer {
+			t.Errorf("syncing Classroom without -classroom-token-file got %v, want a SERVER precondition failure", err)
+		}
+
+		// Tenants don't see each other's classes.
+		other := client.WithTenant(ctx, "other")
+		if n, err := c.Count(other, &pb.CountRequest{}); err != nil || n.Total != 0 {
+			t.Errorf("Count for another tenant returned %v, %v", n, err)
+		}
+
+		health, err := grpc_health_v1.NewHealthClient(a.conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		if err != nil || health.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+			t.Errorf("health check returned %v, %v", health, err)
+		}
+	})
+}
+
+func TestE2EAuth(t *testing.T) {
+	tokens := filepath.Join(t.TempDir(), "tokens")
+	if err := ioutil.WriteFile(tokens, []byte("user-token\nadmin-token admin\ndistrict-a-token tenants=district-a,district-a2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	forEachStorage(t, tokens, func(t *testing.T, a *e2eAdapter) {
+		ctx := context.Background()
+		if _, err := pb.NewAdapterClient(a.conn).List(ctx, &pb.ListRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("List without a token got %v, want Unauthenticated", err)
+		}
+		health, err := grpc_health_v1.NewHealthClient(a.conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		if err != nil || health.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+			t.Errorf("health check without a token returned %v, %v", health, err)
+		}
+
+		user := a.dial(t, client.WithToken("user-token"))
+		if _, err := user.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := user.AdminCompact(ctx, &pb.Empty{}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("AdminCompact with a user token got %v, want PermissionDenied", err)
+		}
+		audit, err := a.dial(t, client.WithToken("admin-token")).GetAuditLog(ctx, &pb.AuditLogRequest{Id: "MATH101"})
+		if err != nil || len(audit.Entries) != 1 {
+			t.Errorf("GetAuditLog with an admin token returned %v, %v", audit, err)
+		}
+
+		// Tokens are bound to their tenants.
+		districtA, districtB := client.WithTenant(ctx, "district-a"), client.WithTenant(ctx, "district-b")
+		district := a.dial(t, client.WithToken("district-a-token"))
+		if _, err := district.Create(districtA, &pb.Class{Id: "MATH101", Name: "Geometry"}); err != nil {
+			t.Errorf("Create in its own tenant returned %v", err)
+		}
+		for name, ctx := range map[string]context.Context{"another district's tenant": districtB, "the default tenant": ctx} {
+			if _, err := district.Get(ctx, &pb.GetRequest{Id: "MATH101"}); status.Code(err) != codes.PermissionDenied {
+				t.Errorf("Get in %s got %v, want PermissionDenied", name, err)
+			}
+		}
+		if _, err := user.Get(districtA, &pb.GetRequest{Id: "MATH101"}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Get in district-a with a token for the default tenant got %v, want PermissionDenied", err)
+		}
+		if c, err := a.dial(t, client.WithToken("admin-token")).Get(districtA, &pb.GetRequest{Id: "MATH101"}); err != nil || c.Name != "Geometry" {
+			t.Errorf("Get in district-a with an admin token returned %v, %v", c, err)
+		}
+	})
+}
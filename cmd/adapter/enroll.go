@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Enrollments are stored one key per student, as
+// enroll/<class id>/<student id>, with the class's enrollment count at
+// enroll/<class id>. Every Enroll reads and writes the count, so two that
+// race for the last seat conflict and only one commits.
+const enrollmentPrefix = "enroll/"
+
+func enrollmentKey(classId, studentId string) []byte {
+	return []byte(enrollmentPrefix + escapeId(classId) + "/" + studentId)
+}
+
+func enrollmentCountKey(classId string) []byte {
+	return []byte(enrollmentPrefix + escapeId(classId))
+}
+
+func countEnrollments(txn *tenantTxn, classId string) (int64, error) {
+	item, err := txn.Get(enrollmentCountKey(classId))
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = item.Value(func(v []byte) error {
+		n, err = strconv.ParseInt(string(v), 10, 64)
+		return err
+	})
+	return n, err
+}
+
+// setEnrollmentCount stores the enrollment count of a class, adding the
+// change to the counts of its semester.
+func setEnrollmentCount(txn *tenantTxn, classId string, n int64) error {
+	old, err := countEnrollments(txn, classId)
+	if err != nil {
+		return err
+	}
+	semester, err := getField(txn, classId, "Semester")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	// A class deleted earlier in the transaction took its enrollments off
+	// the counts already.
+	if err == nil {
+		if err := addSemesterStats(txn, semester, 0, n-old); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return txn.Delete(enrollmentCountKey(classId))
+	}
+	return txn.Set(enrollmentCountKey(classId), []byte(strconv.FormatInt(n, 10)))
+}
+
+// listEnrollments reads the enrollments of a class in ascending student Id
+// order.
+func listEnrollments(txn *tenantTxn, classId string) ([]*pb.Enrollment, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = enrollmentKey(classId, "")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var enrollments []*pb.Enrollment
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return nil, err
+		}
+		e := &pb.Enrollment{}
+		err := it.Item().Value(func(v []byte) error {
+			return proto.Unmarshal(v, e)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read enrollment %s: %w", it.Key(), err)
+		}
+		enrollments = append(enrollments, e)
+	}
+	return enrollments, nil
+}
+
+// deleteEnrollments removes every enrollment of a class.
+func deleteEnrollments(txn *tenantTxn, classId string) error {
+	if err := deletePrefix(txn, enrollmentKey(classId, "")); err != nil {
+		return err
+	}
+	return setEnrollmentCount(txn, classId, 0)
+}
+
+func (v *violations) checkEnrollment(in *pb.EnrollmentRequest) {
+	v.checkIdAs("class_id", in.ClassId)
+	v.checkIdAs("student_id", in.StudentId)
+}
+
+func (s *server) Enroll(ctx context.Context, in *pb.EnrollmentRequest) (*pb.Enrollment, error) {
+	logf(ctx, "Enroll called for student %s in class %s", in.StudentId, in.ClassId)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e := &pb.Enrollment{ClassId: in.ClassId, StudentId: in.StudentId, EnrollTime: timestamppb.Now()}
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		c, err := getClass(txn, in.ClassId)
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "class %s not found", in.ClassId)
+		}
+		if err != nil {
+			return err
+		}
+		if c.State != pb.Class_PUBLISHED {
+			return preconditionFailed(preconditionState, "classes/"+in.ClassId, "class %s is %s and isn't taking enrollments", in.ClassId, c.State)
+		}
+		_, err = txn.Get(enrollmentKey(in.ClassId, in.StudentId))
+		if err == nil {
+			return status.Errorf(codes.AlreadyExists, "student %s is already enrolled in %s", in.StudentId, in.ClassId)
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+		n, err := countEnrollments(txn, in.ClassId)
+		if err != nil {
+			return err
+		}
+		if c.Capacity > 0 && n >= int64(c.Capacity) {
+			return preconditionFailed(preconditionCapacity, "classes/"+in.ClassId, "class %s is full: %d of %d seats taken", in.ClassId, n, c.Capacity)
+		}
+		v, err := proto.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(enrollmentKey(in.ClassId, in.StudentId), v); err != nil {
+			return fmt.Errorf("put enrollment of %s in %s: %w", in.StudentId, in.ClassId, err)
+		}
+		return setEnrollmentCount(txn, in.ClassId, n+1)
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return e, nil
+}
+
+func (s *server) Unenroll(ctx context.Context, in *pb.EnrollmentRequest) (*pb.Empty, error) {
+	logf(ctx, "Unenroll called for student %s in class %s", in.StudentId, in.ClassId)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		_, err := txn.Get(enrollmentKey(in.ClassId, in.StudentId))
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "student %s is not enrolled in %s", in.StudentId, in.ClassId)
+		}
+		if err != nil {
+			return err
+		}
+		n, err := countEnrollments(txn, in.ClassId)
+		if err != nil {
+			return err
+		}
+		if err := txn.Delete(enrollmentKey(in.ClassId, in.StudentId)); err != nil {
+			return fmt.Errorf("delete enrollment of %s in %s: %w", in.StudentId, in.ClassId, err)
+		}
+		if n > 0 {
+			n--
+		}
+		return setEnrollmentCount(txn, in.ClassId, n)
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (s *server) ListEnrollments(ctx context.Context, in *pb.ListEnrollmentsRequest) (*pb.Enrollments, error) {
+	logf(ctx, "ListEnrollments called for class %s", in.ClassId)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit, after, err := s.checkPage(ctx, "ListEnrollments", in.PageSize, in.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.Enrollments{Enrollments: make([]*pb.Enrollment, 0)}
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		exists, err := classExists(txn, in.ClassId)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return status.Errorf(codes.NotFound, "class %s not found", in.ClassId)
+		}
+		enrollments, err := listEnrollments(txn, in.ClassId)
+		if err != nil {
+			return err
+		}
+		out.TotalSize = int64(len(enrollments))
+		if after != "" {
+			i := sort.Search(len(enrollments), func(i int) bool { return enrollments[i].StudentId > after })
+			enrollments = enrollments[i:]
+		}
+		if limit > 0 && len(enrollments) > limit {
+			enrollments = enrollments[:limit]
+			out.NextPageToken = encodePageToken(enrollments[limit-1].StudentId)
+		}
+		out.Enrollments = append(out.Enrollments, enrollments...)
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return out, nil
+}
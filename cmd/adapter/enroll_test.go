@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEnrollment(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL", Capacity: 2})
+
+		enroll := func(student string) error {
+			_, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: student})
+			return err
+		}
+		if err := enroll("s2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := enroll("s1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := enroll("s1"); status.Code(err) != codes.AlreadyExists {
+			t.Errorf("enrolling twice returned %v, want AlreadyExists", err)
+		}
+		if err := enroll("s3"); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("enrolling in a full class returned %v, want FailedPrecondition", err)
+		}
+		if _, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "NOPE", StudentId: "s1"}); status.Code(err) != codes.NotFound {
+			t.Errorf("enrolling in a missing class returned %v, want NotFound", err)
+		}
+
+		es, err := s.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "MATH101", PageSize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(es.Enrollments) != 1 || es.Enrollments[0].StudentId != "s1" || es.TotalSize != 2 || es.NextPageToken == "" {
+			t.Errorf("first page of ListEnrollments returned %v", es)
+		}
+		es, err = s.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "MATH101", PageToken: es.NextPageToken})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(es.Enrollments) != 1 || es.Enrollments[0].StudentId != "s2" || es.NextPageToken != "" {
+			t.Errorf("second page of ListEnrollments returned %v", es)
+		}
+
+		// Unenrolling frees a seat.
+		if _, err := s.Unenroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: "s2"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Unenroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: "s2"}); status.Code(err) != codes.NotFound {
+			t.Errorf("unenrolling twice returned %v, want NotFound", err)
+		}
+		if err := enroll("s3"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Deleting the class deletes its enrollments.
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"})
+		es, err = s.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(es.Enrollments) != 0 || es.TotalSize != 0 {
+			t.Errorf("ListEnrollments of a recreated class returned %v, want none", es)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"syscall"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Types of the PreconditionFailure violations FailedPrecondition errors
+// carry, saying what the client must change before it tries again.
+const (
+	// Another session holds the class's edit lease; the subject is the
+	// class.
+	preconditionLease = "LEASE"
+	// The class has no free seats; the subject is the class.
+	preconditionCapacity = "CAPACITY"
+	// The instructor named doesn't exist, or still teaches classes; the
+	// subject is the instructor.
+	preconditionInstructor = "INSTRUCTOR"
+	// A prerequisite doesn't exist or would form a cycle; the subject is
+	// the class named as a prerequisite.
+	preconditionPrerequisite = "PREREQUISITE"
+	// The semester hasn't ended; the subject is the semester.
+	preconditionSemester = "SEMESTER"
+	// The tenant is being offboarded; the subject is the tenant.
+	preconditionOffboarding = "OFFBOARDING"
+	// The class's state doesn't allow the call, e.g. a transition that
+	// skips a state; the subject is the class.
+	preconditionState = "STATE"
+	// The server doesn't allow the call, e.g. it is read-only; the subject
+	// is the server.
+	preconditionServer = "SERVER"
+)
+
+// conflictRetryDelay is the RetryInfo of a transaction conflict: a moment
+// for the write it lost to commit.
+const conflictRetryDelay = 20 * time.Millisecond
+
+// blockedWritesRetryDelay is the RetryInfo of a write refused while writes
+// are blocked, long enough for most prefix drops to finish.
+const blockedWritesRetryDelay = time.Second
+
+// withDetails returns st with details attached, or st alone if they can't
+// be encoded.
+func withDetails(st *status.Status, details ...proto.Message) *status.Status {
+	if ds, err := st.WithDetails(details...); err == nil {
+		return ds
+	}
+	return st
+}
+
+// preconditionFailed returns a FailedPrecondition status carrying one
+// PreconditionFailure violation of type typ about subject, e.g.
+// "classes/MATH101". The message doubles as the violation's description.
+func preconditionFailed(typ, subject, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	return withDetails(status.New(codes.FailedPrecondition, msg), &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{Type: typ, Subject: subject, Description: msg}},
+	}).Err()
+}
+
+// retryAfter returns a status with code and msg carrying RetryInfo, which
+// tells clients the call may succeed if repeated after delay.
+func retryAfter(code codes.Code, delay time.Duration, msg string) error {
+	return withDetails(status.New(code, msg), &errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}).Err()
+}
+
+// errValidateOnly rolls back the transaction of a validate_only request once
+// its checks have passed.
+var errValidateOnly = errors.New("validate only")
+
+// isStatusError reports whether err already carries a gRPC status, e.g. a
+// precondition failure raised inside a transaction.
+func isStatusError(err error) bool {
+	var se interface{ GRPCStatus() *status.Status }
+	return errors.As(err, &se)
+}
+
+// isContextError reports whether err comes from a request's context ending,
+// which aborts scans partway through.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// storageError converts an error returned from a Badger transaction into a
+// gRPC status error. Write handlers return it for every failed transaction,
+// so a write never reports success it didn't have.
+func storageError(err error) error {
+	switch {
+	case isStatusError(err):
+		return err
+	case errors.Is(err, badger.ErrConflict):
+		return retryAfter(codes.Aborted, conflictRetryDelay, "concurrent modification, retry the request")
+	case isContextError(err):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, errInjectedFault):
+		return status.Error(codes.Unavailable, "injected storage fault (-fault-inject)")
+	case errors.Is(err, badger.ErrBlockedWrites):
+		// Writes are blocked while a prefix is dropped, e.g. a tenant
+		// offboarded, and resume when it's done.
+		return retryAfter(codes.Unavailable, blockedWritesRetryDelay, "storage is briefly unavailable for writes, retry the request")
+	case errors.Is(err, badger.ErrDBClosed):
+		return status.Error(codes.Unavailable, "storage is closed, the adapter is shutting down")
+	case errors.Is(err, badger.ErrTxnTooBig):
+		return status.Error(codes.ResourceExhausted, "the write is too large for one transaction")
+	case errors.Is(err, syscall.ENOSPC):
+		log.Printf("Storage error: %s", err)
+		return status.Error(codes.ResourceExhausted, "storage is full")
+	}
+	log.Printf("Storage error: %s", err)
+	return status.Error(codes.Internal, "storage error")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func retryInfo(t *testing.T, err error) *errdetails.RetryInfo {
+	t.Helper()
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			return ri
+		}
+	}
+	t.Fatalf("%v carries no RetryInfo", err)
+	return nil
+}
+
+func TestErrorDetails(t *testing.T) {
+	err := preconditionFailed(preconditionLease, "classes/MATH101", "class %s is being edited", "MATH101")
+	st := status.Convert(err)
+	if st.Code() != codes.FailedPrecondition || st.Message() != "class MATH101 is being edited" {
+		t.Fatalf("preconditionFailed = %v", err)
+	}
+	pf, ok := st.Details()[0].(*errdetails.PreconditionFailure)
+	if !ok || len(pf.Violations) != 1 || pf.Violations[0].Type != preconditionLease || pf.Violations[0].Subject != "classes/MATH101" {
+		t.Errorf("details = %v, want one LEASE violation of classes/MATH101", st.Details())
+	}
+
+	err = storageError(badger.ErrConflict)
+	if status.Code(err) != codes.Aborted || retryInfo(t, err).RetryDelay.AsDuration() != conflictRetryDelay {
+		t.Errorf("conflict = %v, want Aborted with RetryInfo of %s", err, conflictRetryDelay)
+	}
+
+	// Operations of a transaction keep their details.
+	err = transactOpError(2, preconditionFailed(preconditionCapacity, "classes/ART1", "class ART1 is full"))
+	st = status.Convert(err)
+	if st.Message() != "ops[2]: class ART1 is full" || len(st.Details()) != 1 {
+		t.Errorf("transactOpError = %v with details %v", err, st.Details())
+	}
+}
+
+func TestRateLimitRetryInfo(t *testing.T) {
+	l := newRateLimiter(10, 1, 0, 0)
+	if err := l.allow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	err := l.allow(context.Background())
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second request = %v, want ResourceExhausted", err)
+	}
+	if d := retryInfo(t, err).RetryDelay.AsDuration(); d != 100*time.Millisecond {
+		t.Errorf("retry delay = %s, want the 100ms a token takes at 10/s", d)
+	}
+}
+
+func TestStorageErrorCodes(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("commit: %w", badger.ErrConflict), codes.Aborted},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{badger.ErrBlockedWrites, codes.Unavailable},
+		{badger.ErrDBClosed, codes.Unavailable},
+		{badger.ErrTxnTooBig, codes.ResourceExhausted},
+		{fmt.Errorf("write: %w", syscall.ENOSPC), codes.ResourceExhausted},
+		{errors.New("checksum mismatch"), codes.Internal},
+		{status.Error(codes.NotFound, "class MATH101 not found"), codes.NotFound},
+	} {
+		if got := status.Code(storageError(c.err)); got != c.want {
+			t.Errorf("storageError(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+	retryInfo(t, storageError(badger.ErrBlockedWrites))
+}
+
+// failingDB fails every write transaction with err after running it, as
+// when its commit fails.
+type failingDB struct {
+	kvDB
+	err error
+}
+
+func (db *failingDB) Update(fn func(txn kvTxn) error) error {
+	if db.err == nil {
+		return db.kvDB.Update(fn)
+	}
+	return db.kvDB.Update(func(txn kvTxn) error {
+		if err := fn(txn); err != nil {
+			return err
+		}
+		return db.err
+	})
+}
+
+func TestWriteErrors(t *testing.T) {
+	db := &failingDB{kvDB: newTestDB(t, driverBadger, t.TempDir())}
+	s := &server{db: db, events: newEventBus()}
+	cs := &classesV2{s: s}
+	is := &instructorStore{s: s}
+	ctx := context.Background()
+	if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+		t.Fatal(err)
+	}
+	sub := s.events.subscribe(nil)
+	defer s.events.unsubscribe(sub)
+
+	db.err = errors.New("commit failed")
+	for name, call := range map[string]func() error{
+		"Create": func() error {
+			_, err := s.Create(ctx, &pb.Class{Id: "MATH102", Name: "Geometry"})
+			return err
+		},
+		"Update": func() error {
+			_, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I"})
+			return err
+		},
+		"Delete": func() error {
+			_, err := s.Delete(ctx, &pb.Class{Id: "MATH101"})
+			return err
+		},
+		"CreateClass": func() error {
+			_, err := cs.CreateClass(ctx, &adapterv2.CreateClassRequest{ClassId: "MATH102", Class: &adapterv2.Class{DisplayName: "Geometry"}})
+			return err
+		},
+		"UpdateClass": func() error {
+			_, err := cs.UpdateClass(ctx, &adapterv2.UpdateClassRequest{Class: &adapterv2.Class{Name: "classes/MATH101", DisplayName: "Algebra I"}})
+			return err
+		},
+		"DeleteClass": func() error {
+			_, err := cs.DeleteClass(ctx, &adapterv2.DeleteClassRequest{Name: "classes/MATH101"})
+			return err
+		},
+		"Instructors.Create": func() error {
+			_, err := is.Create(ctx, &pb.Instructor{Id: "lovelace", Name: "Ada Lovelace"})
+			return err
+		},
+	} {
+		if err := call(); status.Code(err) != codes.Internal {
+			t.Errorf("%s with a failing commit got %v, want Internal", name, err)
+		}
+	}
+	select {
+	case e := <-sub.events:
+		t.Errorf("failed write published %v", e)
+	default:
+	}
+
+	db.err = nil
+	if c, _ := s.Get(ctx, &pb.GetRequest{Id: "MATH101"}); c.Name != "Algebra" {
+		t.Errorf("class is %v after failed writes", c)
+	}
+	if c, _ := s.Get(ctx, &pb.GetRequest{Id: "MATH102"}); c.Name != "" {
+		t.Errorf("failed Create stored %v", c)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Events buffered per subscriber before it is considered too slow and dropped.
+const subscriberBuffer = 64
+
+// eventBus fans committed class changes out to subscribers. Publishing never
+// blocks the write path: a subscriber whose buffer is full is closed instead.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+type subscription struct {
+	events chan *pb.ClassEvent
+	match  func(*pb.ClassEvent) bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[*subscription]struct{})}
+}
+
+// subscribe registers a subscriber for events accepted by match (all events
+// if match is nil).
+func (b *eventBus) subscribe(match func(*pb.ClassEvent) bool) *subscription {
+	sub := &subscription{
+		events: make(chan *pb.ClassEvent, subscriberBuffer),
+		match:  match,
+	}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+func newClassEvent(t pb.ClassEvent_Type, tenant string, c *pb.Class) *pb.ClassEvent {
+	return &pb.ClassEvent{
+		Type:   t,
+		Class:  c,
+		Time:   timestamppb.New(time.Now()),
+		Tenant: tenant,
+	}
+}
+
+func (b *eventBus) publish(e *pb.ClassEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		if sub.match != nil && !sub.match(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			delete(b.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+func (s *server) Watch(in *pb.WatchRequest, stream pb.Adapter_WatchServer) error {
+	logf(stream.Context(), "Watch called for Id %q semester %q", in.Id, in.Semester)
+	tenant, err := tenantFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	sub := s.events.subscribe(func(e *pb.ClassEvent) bool {
+		return e.Tenant == tenant &&
+			(in.Id == "" || e.Class.Id == in.Id) &&
+			(in.Semester == "" || e.Class.Semester == in.Semester)
+	})
+	defer s.events.unsubscribe(sub)
+	// Headers tell the caller no later change will be missed, so it can list
+	// and then apply events without a gap.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	ctx, reason, cancel := s.drain.bound(stream.Context())
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return reason()
+		case e, ok := <-sub.events:
+			if !ok {
+				return retryAfter(codes.ResourceExhausted, 0, "watcher fell behind, list again and restart the watch")
+			}
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
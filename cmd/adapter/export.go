@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var (
+	snapshotExports = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "adapter_snapshot_exports_total",
+		Help: "Exports of the class set to -snapshot-dir, by result (ok or failed).",
+	}, []string{"result"})
+	snapshotLastExport = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "adapter_snapshot_last_export_timestamp_seconds",
+		Help: "Unix time the last export to -snapshot-dir finished.",
+	})
+)
+
+// exportSnapshots writes every tenant's classes to dir now and then every
+// interval until ctx ends.
+func (s *server) exportSnapshots(ctx context.Context, dir string, interval time.Duration) {
+	for {
+		start := time.Now()
+		if err := s.exportSnapshot(ctx, dir); err != nil {
+			snapshotExports.WithLabelValues("failed").Inc()
+			log.Printf("Error exporting classes to %s: %s", dir, err)
+		} else {
+			snapshotExports.WithLabelValues("ok").Inc()
+			snapshotLastExport.SetToCurrentTime()
+			log.Printf("Exported classes to %s in %s", dir, time.Since(start).Round(time.Millisecond))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// exportSnapshot writes each tenant's classes to <tenant>.jsonl in dir, one
+// Class as JSON per line in ascending Id order, from a single read of the
+// tenant. Each file is written under a dot-prefixed temporary name and
+// renamed into place, so readers see either the previous export or the
+// whole new one. Quarantined classes are left out.
+func (s *server) exportSnapshot(ctx context.Context, dir string) error {
+	tenants, err := listTenants(s.db)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := s.exportTenant(ctx, dir, tenant); err != nil {
+			return fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+func (s *server) exportTenant(ctx context.Context, dir, tenant string) error {
+	path := filepath.Join(dir, tenant+".jsonl")
+	tmp := filepath.Join(dir, "."+tenant+".jsonl.tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	w := bufio.NewWriter(f)
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		classes, err := listClasses(txn)
+		if err != nil {
+			return err
+		}
+		for _, c := range classes {
+			b, err := protojson.Marshal(c)
+			if err != nil {
+				return err
+			}
+			w.Write(b)
+			if err := w.WriteByte('\n'); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// checkSnapshotDir fails unless dir is a directory the adapter can write
+// exports to.
+func checkSnapshotDir(dir string) error {
+	f, err := ioutil.TempFile(dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// readExport reads the classes exported to path.
+func readExport(t *testing.T, path string) []*pb.Class {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var classes []*pb.Class
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		c := &pb.Class{}
+		if err := protojson.Unmarshal(sc.Bytes(), c); err != nil {
+			t.Fatalf("line %q of %s: %v", sc.Text(), path, err)
+		}
+		classes = append(classes, c)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return classes
+}
+
+func TestExportSnapshot(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra", Labels: map[string]string{"subject": "math"}}, &pb.Class{Id: "ART1", Name: "Drawing"})
+		other := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantMetadataKey, "lincoln-high"))
+		if _, err := s.Create(other, &pb.Class{Id: "BIO1", Name: "Cells"}); err != nil {
+			t.Fatal(err)
+		}
+
+		dir := t.TempDir()
+		if err := checkSnapshotDir(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.exportSnapshot(context.Background(), dir); err != nil {
+			t.Fatal(err)
+		}
+		classes := readExport(t, filepath.Join(dir, "default.jsonl"))
+		if !equalIds(ids(classes), []string{"ART1", "MATH101"}) || classes[1].Labels["subject"] != "math" {
+			t.Errorf("default tenant's export has %v", classes)
+		}
+		if classes := readExport(t, filepath.Join(dir, "lincoln-high.jsonl")); !equalIds(ids(classes), []string{"BIO1"}) {
+			t.Errorf("lincoln-high's export has %v", ids(classes))
+		}
+
+		// A later export replaces the file, leaving no temporary files.
+		if _, err := s.Delete(context.Background(), &pb.Class{Id: "ART1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.exportSnapshot(context.Background(), dir); err != nil {
+			t.Fatal(err)
+		}
+		if classes := readExport(t, filepath.Join(dir, "default.jsonl")); !equalIds(ids(classes), []string{"MATH101"}) {
+			t.Errorf("second export has %v", ids(classes))
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 2 {
+			var names []string
+			for _, f := range files {
+				names = append(names, f.Name())
+			}
+			t.Errorf("snapshot dir holds %v, want only the two exports", names)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// External Ids are indexed as idx/external/<system>/<external Id>, with the
+// class Id as the entry's value, so GetByExternalId reads a single key.
+// System names can't contain "/"; external Ids can, since they end the key.
+const externalIdIndexPrefix = indexPrefix + "external/"
+
+const (
+	maxExternalIds      = 16
+	maxExternalIdLength = 256
+)
+
+func externalIdIndexKey(system, id string) []byte {
+	return []byte(externalIdIndexPrefix + system + "/" + id)
+}
+
+// External Ids are stored as a JSON object in the ExternalIds field of the
+// class.
+func encodeExternalIds(ids map[string]string) (string, error) {
+	b, err := json.Marshal(ids)
+	return string(b), err
+}
+
+func decodeExternalIds(v string) (map[string]string, error) {
+	var ids map[string]string
+	if err := json.Unmarshal([]byte(v), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// indexExternalIds replaces the external Id index entries of the class with
+// the given Id, whose stored ExternalIds field was old, with entries for
+// ids. Entries that already point to another class are left to it.
+func indexExternalIds(txn *tenantTxn, id, old string, ids map[string]string) error {
+	if old != "" {
+		prev, err := decodeExternalIds(old)
+		if err != nil {
+			return fmt.Errorf("parse external Ids of %s: %w", id, err)
+		}
+		for system, ext := range prev {
+			if ids[system] == ext {
+				continue
+			}
+			owner, err := externalIdOwner(txn, system, ext)
+			if err == badger.ErrKeyNotFound || (err == nil && owner != id) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := txn.Delete(externalIdIndexKey(system, ext)); err != nil {
+				return fmt.Errorf("delete external Id index for %s: %w", id, err)
+			}
+		}
+	}
+	for system, ext := range ids {
+		if err := txn.Set(externalIdIndexKey(system, ext), []byte(id)); err != nil {
+			return fmt.Errorf("put external Id index for %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (v *violations) checkExternalIds(ids map[string]string) {
+	if len(ids) > maxExternalIds {
+		v.add("external_ids", "must have at most %d systems", maxExternalIds)
+	}
+	systems := make([]string, 0, len(ids))
+	for system := range ids {
+		systems = append(systems, system)
+	}
+	sort.Strings(systems)
+	for _, system := range systems {
+		v.checkExternalId(fmt.Sprintf("external_ids[%s]", system), system, ids[system])
+	}
+}
+
+// checkExternalId checks one system name and Id, reporting both as field.
+func (v *violations) checkExternalId(field, system, id string) {
+	if !labelPattern.MatchString(system) {
+		v.add(field, "system %q must match %s", system, labelPattern)
+	}
+	switch {
+	case id == "":
+		v.add(field, "must not be empty")
+	case len(id) > maxExternalIdLength:
+		v.add(field, "must be at most %d characters", maxExternalIdLength)
+	}
+}
+
+// externalIdOwner returns the Id of the class with the given external Id,
+// or badger.ErrKeyNotFound.
+func externalIdOwner(txn *tenantTxn, system, id string) (string, error) {
+	item, err := txn.Get(externalIdIndexKey(system, id))
+	if err != nil {
+		return "", err
+	}
+	v, err := item.ValueCopy(nil)
+	return string(v), err
+}
+
+// checkExternalIdRefs fails with AlreadyExists if another class has one of
+// c's external Ids.
+func checkExternalIdRefs(txn *tenantTxn, c *pb.Class) error {
+	for system, id := range c.ExternalIds {
+		owner, err := externalIdOwner(txn, system, id)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if owner != c.Id {
+			return status.Errorf(codes.AlreadyExists, "%s Id %s already names class %s", system, id, owner)
+		}
+	}
+	return nil
+}
+
+func (s *server) GetByExternalId(ctx context.Context, in *pb.GetByExternalIdRequest) (*pb.Class, error) {
+	logf(ctx, "GetByExternalId called for %s Id %s", in.System, in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var c *pb.Class
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		owner, err := externalIdOwner(txn, in.System, in.Id)
+		if err != nil {
+			return err
+		}
+		c, err = getClass(txn, owner)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, status.Errorf(codes.NotFound, "no class has %s Id %s", in.System, in.Id)
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return c, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestGetByExternalId(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		get := func(ctx context.Context, system, id string) (string, error) {
+			c, err := s.GetByExternalId(ctx, &pb.GetByExternalIdRequest{System: system, Id: id})
+			return c.GetId(), err
+		}
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", ExternalIds: map[string]string{"sis": "2024/MATH-101", "lms": "course-7"}}); err != nil {
+			t.Fatal(err)
+		}
+		if id, err := get(ctx, "sis", "2024/MATH-101"); err != nil || id != "MATH101" {
+			t.Errorf("sis lookup got %q, %v, want MATH101", id, err)
+		}
+		if id, err := get(ctx, "lms", "course-7"); err != nil || id != "MATH101" {
+			t.Errorf("lms lookup got %q, %v, want MATH101", id, err)
+		}
+		if _, err := get(ctx, "lms", "2024/MATH-101"); status.Code(err) != codes.NotFound {
+			t.Errorf("lookup in the wrong system got %v, want NotFound", err)
+		}
+		other := metadata.NewIncomingContext(ctx, metadata.Pairs(tenantMetadataKey, "lincoln-high"))
+		if _, err := get(other, "sis", "2024/MATH-101"); status.Code(err) != codes.NotFound {
+			t.Errorf("lookup from another tenant got %v, want NotFound", err)
+		}
+
+		_, err := s.Create(ctx, &pb.Class{Id: "MATH102", Name: "Algebra", ExternalIds: map[string]string{"sis": "2024/MATH-101"}})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Errorf("Create reusing another class's external Id got %v, want AlreadyExists", err)
+		}
+		if _, err := s.Create(other, &pb.Class{Id: "MATH102", Name: "Algebra", ExternalIds: map[string]string{"sis": "2024/MATH-101"}}); err != nil {
+			t.Errorf("Create reusing an external Id of another tenant got %v", err)
+		}
+
+		// Changing an external Id frees the old one.
+		mask := &fieldmaskpb.FieldMask{Paths: []string{"external_ids"}}
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH101", ExternalIds: map[string]string{"sis": "2024/MATH-101-01"}, UpdateMask: mask}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := get(ctx, "lms", "course-7"); status.Code(err) != codes.NotFound {
+			t.Errorf("lookup of a removed external Id got %v, want NotFound", err)
+		}
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH102", Name: "Algebra", ExternalIds: map[string]string{"sis": "2024/MATH-101"}}); err != nil {
+			t.Errorf("Create taking a freed external Id got %v", err)
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := get(ctx, "sis", "2024/MATH-101-01"); status.Code(err) != codes.NotFound {
+			t.Errorf("lookup of a deleted class got %v, want NotFound", err)
+		}
+		if id, err := get(ctx, "sis", "2024/MATH-101"); err != nil || id != "MATH102" {
+			t.Errorf("lookup after the delete got %q, %v, want MATH102", id, err)
+		}
+	})
+}
+
+func TestExternalIdValidation(t *testing.T) {
+	for _, ids := range []map[string]string{
+		{"sis/v2": "1"},
+		{"sis": ""},
+	} {
+		if err := validateRequest("/class.Adapter/Create", &pb.Class{Id: "MATH101", ExternalIds: ids}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Create with external Ids %v got %v, want InvalidArgument", ids, err)
+		}
+	}
+	if err := validateRequest("/class.Adapter/GetByExternalId", &pb.GetByExternalIdRequest{Id: "1"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetByExternalId without a system got %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// allowFaultInjectionEnv must be 1 for -fault-inject to start, so a config
+// file copied from a test environment can't make a production adapter
+// flaky. It is not a flag, and no flag sets it.
+const allowFaultInjectionEnv = "ADAPTER_ALLOW_FAULT_INJECTION"
+
+var injectedFaults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "adapter_injected_faults_total",
+	Help: "Storage transactions -fault-inject delayed or failed, by kind (delay or error).",
+}, []string{"kind"})
+
+// errInjectedFault is what -fault-inject fails storage transactions with.
+var errInjectedFault = errors.New("injected fault")
+
+// faultInjector delays and fails a share of storage transactions, so the
+// services calling an adapter can test their retries and timeouts against
+// one that misbehaves like a slow or flaky disk. Percentages are of
+// transactions, each drawn independently: a transaction may be delayed,
+// then fail.
+type faultInjector struct {
+	mu           sync.RWMutex
+	errorPercent float64
+	delayPercent float64
+	// Delays are uniform between 0 and maxDelay.
+	maxDelay time.Duration
+
+	// sample returns a number in [0, 1).
+	sample func() float64
+	sleep  func(time.Duration)
+}
+
+func newFaultInjector(errorPercent, delayPercent float64, maxDelay time.Duration) *faultInjector {
+	f := &faultInjector{sample: rand.Float64, sleep: time.Sleep}
+	f.set(errorPercent, delayPercent, maxDelay)
+	return f
+}
+
+// set replaces the settings, e.g. on reload.
+func (f *faultInjector) set(errorPercent, delayPercent float64, maxDelay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errorPercent, f.delayPercent, f.maxDelay = errorPercent, delayPercent, maxDelay
+}
+
+// inject runs before a transaction, delaying it or failing it with
+// errInjectedFault at the configured rates.
+func (f *faultInjector) inject() error {
+	f.mu.RLock()
+	errorPercent, delayPercent, maxDelay := f.errorPercent, f.delayPercent, f.maxDelay
+	f.mu.RUnlock()
+	if delayPercent > 0 && f.sample()*100 < delayPercent {
+		injectedFaults.WithLabelValues("delay").Inc()
+		f.sleep(time.Duration(f.sample() * float64(maxDelay)))
+	}
+	if errorPercent > 0 && f.sample()*100 < errorPercent {
+		injectedFaults.WithLabelValues("error").Inc()
+		return errInjectedFault
+	}
+	return nil
+}
+
+// checkFaultSettings validates the -fault-inject-* flags.
+func checkFaultSettings(errorPercent, delayPercent float64, maxDelay time.Duration) error {
+	switch {
+	case errorPercent < 0 || errorPercent > 100:
+		return errors.New("-fault-inject-error-percent must be between 0 and 100")
+	case delayPercent < 0 || delayPercent > 100:
+		return errors.New("-fault-inject-delay-percent must be between 0 and 100")
+	case maxDelay < 0:
+		return errors.New("-fault-inject-max-delay must not be negative")
+	}
+	return nil
+}
+
+// faultyDB is a kvDB whose transactions, including those on list
+// snapshots, pass through a faultInjector first.
+type faultyDB struct {
+	kvDB
+	faults *faultInjector
+}
+
+func (db faultyDB) View(fn func(txn kvTxn) error) error {
+	if err := db.faults.inject(); err != nil {
+		return err
+	}
+	return db.kvDB.View(fn)
+}
+
+func (db faultyDB) Update(fn func(txn kvTxn) error) error {
+	if err := db.faults.inject(); err != nil {
+		return err
+	}
+	return db.kvDB.Update(fn)
+}
+
+// KeySplits keeps parallel scans working on drivers that support them.
+func (db faultyDB) KeySplits(prefix []byte) [][]byte {
+	if sp, ok := db.kvDB.(kvSplitter); ok {
+		return sp.KeySplits(prefix)
+	}
+	return nil
+}
+
+// Snapshot keeps paged Lists on snapshots working on drivers that support
+// them.
+func (db faultyDB) Snapshot() kvSnapshot {
+	ss, ok := db.kvDB.(kvSnapshotter)
+	if !ok {
+		return nil
+	}
+	return faultySnapshot{ss.Snapshot(), db.faults}
+}
+
+type faultySnapshot struct {
+	kvSnapshot
+	faults *faultInjector
+}
+
+func (s faultySnapshot) View(fn func(txn kvTxn) error) error {
+	if err := s.faults.inject(); err != nil {
+		return err
+	}
+	return s.kvSnapshot.View(fn)
+}
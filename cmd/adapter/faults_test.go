@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFaultInjection(t *testing.T) {
+	f := newFaultInjector(10, 50, time.Second)
+	var draws []float64
+	f.sample = func() float64 {
+		d := draws[0]
+		draws = draws[1:]
+		return d
+	}
+	var slept []time.Duration
+	f.sleep = func(d time.Duration) { slept = append(slept, d) }
+	s := &server{db: faultyDB{newTestDB(t, driverBadger, t.TempDir()), f}, events: newEventBus()}
+	ctx := context.Background()
+
+	// Delayed by a quarter of the maximum, then not failed.
+	draws = []float64{0.2, 0.25, 0.5}
+	if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(slept) != 1 || slept[0] != 250*time.Millisecond {
+		t.Errorf("slept %v, want 250ms", slept)
+	}
+	// Neither delayed nor failed, then failed without a delay.
+	draws = []float64{0.9, 0.5, 0.9, 0.05}
+	if _, err := s.Exists(ctx, &pb.GetRequest{Id: "MATH101"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Update with an injected fault got %v, want Unavailable", err)
+	}
+	if len(slept) != 1 || len(draws) != 0 {
+		t.Errorf("slept %v with draws %v left", slept, draws)
+	}
+
+	f.set(0, 0, 0)
+	if c, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101"}); err != nil || c.Name != "Algebra" {
+		t.Errorf("Get after faults were turned off returned %v, %v", c, err)
+	}
+
+	for _, bad := range [][3]float64{{-1, 0, 0}, {0, 101, 0}, {0, 0, -1}} {
+		if checkFaultSettings(bad[0], bad[1], time.Duration(bad[2])) == nil {
+			t.Errorf("checkFaultSettings%v succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// fileDataName is the file the file driver keeps the database in, inside
+// the data directory.
+const fileDataName = "data.jsonl"
+
+var errFileReadOnly = errors.New("database is read-only")
+
+// fileDB keeps the whole database in memory and in a single JSON-lines file,
+// one entry per line in key order, rewritten on every commit. Updates run
+// one at a time, so they never conflict. It suits small deployments that
+// want a data file they can read, diff and back up with everyday tools.
+type fileDB struct {
+	path     string
+	readOnly bool
+
+	// txnMu lets views run together and updates one at a time.
+	txnMu sync.RWMutex
+	// mu guards entries, which sequences change outside of transactions.
+	mu      sync.Mutex
+	entries map[string]*fileEntry
+}
+
+type fileEntry struct {
+	value     []byte
+	expiresAt uint64
+}
+
+func (e *fileEntry) expired(now uint64) bool {
+	return e.expiresAt != 0 && e.expiresAt <= now
+}
+
+// fileLine is how an entry is stored. Values that aren't valid UTF-8 are
+// stored base64-encoded in Binary instead of Value.
+type fileLine struct {
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	Binary    []byte `json:"binary,omitempty"`
+	ExpiresAt uint64 `json:"expires_at,omitempty"`
+}
+
+func openFileDB(dir string, readOnly bool) (*fileDB, error) {
+	db := &fileDB{
+		path:     filepath.Join(dir, fileDataName),
+		readOnly: readOnly,
+		entries:  make(map[string]*fileEntry),
+	}
+	f, err := os.Open(db.path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for n := 1; sc.Scan(); n++ {
+		var l fileLine
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", db.path, n, err)
+		}
+		e := &fileEntry{value: []byte(l.Value), expiresAt: l.ExpiresAt}
+		if l.Binary != nil {
+			e.value = l.Binary
+		}
+		db.entries[l.Key] = e
+	}
+	return db, sc.Err()
+}
+
+func (db *fileDB) Close() error {
+	return nil
+}
+
+// save writes the entries to a new file and moves it over the old one, so
+// a crash leaves either the old or the new contents. Call with mu held.
+func (db *fileDB) save() error {
+	now := uint64(time.Now().Unix())
+	keys := make([]string, 0, len(db.entries))
+	for k, e := range db.entries {
+		if !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	tmp := db.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, k := range keys {
+		e := db.entries[k]
+		l := fileLine{Key: k, ExpiresAt: e.expiresAt}
+		if utf8.Valid(e.value) {
+			l.Value = string(e.value)
+		} else {
+			l.Binary = e.value
+		}
+		if err := enc.Encode(&l); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, db.path)
+}
+
+func (db *fileDB) View(fn func(txn kvTxn) error) error {
+	db.txnMu.RLock()
+	defer db.txnMu.RUnlock()
+	return fn(&fileTxn{db: db})
+}
+
+func (db *fileDB) Update(fn func(txn kvTxn) error) error {
+	if db.readOnly {
+		return errFileReadOnly
+	}
+	db.txnMu.Lock()
+	defer db.txnMu.Unlock()
+	txn := &fileTxn{db: db, pending: make(map[string]*fileEntry)}
+	if err := fn(txn); err != nil {
+		return err
+	}
+	if len(txn.pending) == 0 {
+		return nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	undo := make(map[string]*fileEntry, len(txn.pending))
+	for k, e := range txn.pending {
+		undo[k] = db.entries[k]
+		db.set(k, e)
+	}
+	if err := db.save(); err != nil {
+		for k, e := range undo {
+			db.set(k, e)
+		}
+		return err
+	}
+	return nil
+}
+
+// set stores e at k, deleting k if e is nil. Call with mu held.
+func (db *fileDB) set(k string, e *fileEntry) {
+	if e == nil {
+		delete(db.entries, k)
+	} else {
+		db.entries[k] = e
+	}
+}
+
+// Compact and RunGC have nothing to do: every commit rewrites the file with
+// only the live entries.
+func (db *fileDB) Compact() error {
+	return nil
+}
+
+func (db *fileDB) RunGC(discardRatio float64) (int, error) {
+	return 0, nil
+}
+
+func (db *fileDB) DiskSize() (int64, error) {
+	fi, err := os.Stat(db.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Size reports the whole file as the LSM tree.
+func (db *fileDB) Size() (lsm, vlog int64) {
+	size, _ := db.DiskSize()
+	return size, 0
+}
+
+func (db *fileDB) DropPrefix(prefixes ...[]byte) error {
+	if db.readOnly {
+		return errFileReadOnly
+	}
+	db.txnMu.Lock()
+	defer db.txnMu.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	dropped := make(map[string]*fileEntry)
+	for k, e := range db.entries {
+		for _, p := range prefixes {
+			if bytes.HasPrefix([]byte(k), p) {
+				dropped[k] = e
+				delete(db.entries, k)
+				break
+			}
+		}
+	}
+	if err := db.save(); err != nil {
+		for k, e := range dropped {
+			db.entries[k] = e
+		}
+		return err
+	}
+	return nil
+}
+
+// fileTxn reads the committed entries and, in an update, buffers its writes
+// in pending until commit. A nil pending entry is a delete.
+type fileTxn struct {
+	db      *fileDB
+	pending map[string]*fileEntry
+}
+
+func (t *fileTxn) lookup(k string) *fileEntry {
+	if e, ok := t.pending[k]; ok {
+		return e
+	}
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	return t.db.entries[k]
+}
+
+func (t *fileTxn) Get(key []byte) (kvItem, error) {
+	e := t.lookup(string(key))
+	if e == nil || e.expired(uint64(time.Now().Unix())) {
+		return nil, badger.ErrKeyNotFound
+	}
+	return &fileItem{key: append([]byte(nil), key...), entry: e}, nil
+}
+
+func (t *fileTxn) Set(key, val []byte) error {
+	return t.SetEntry(badger.NewEntry(key, val))
+}
+
+func (t *fileTxn) SetEntry(e *badger.Entry) error {
+	if t.pending == nil {
+		return badger.ErrReadOnlyTxn
+	}
+	t.pending[string(e.Key)] = &fileEntry{value: append([]byte(nil), e.Value...), expiresAt: e.ExpiresAt}
+	return nil
+}
+
+func (t *fileTxn) Delete(key []byte) error {
+	if t.pending == nil {
+		return badger.ErrReadOnlyTxn
+	}
+	t.pending[string(key)] = nil
+	return nil
+}
+
+// NewIterator iterates over the entries as of its creation, including the
+// transaction's own writes.
+func (t *fileTxn) NewIterator(opt badger.IteratorOptions) kvIterator {
+	now := uint64(time.Now().Unix())
+	merged := make(map[string]*fileEntry)
+	t.db.mu.Lock()
+	for k, e := range t.db.entries {
+		if bytes.HasPrefix([]byte(k), opt.Prefix) {
+			merged[k] = e
+		}
+	}
+	t.db.mu.Unlock()
+	for k, e := range t.pending {
+		if bytes.HasPrefix([]byte(k), opt.Prefix) {
+			merged[k] = e
+		}
+	}
+
+	it := &fileIterator{reverse: opt.Reverse}
+	for k, e := range merged {
+		if e != nil && !e.expired(now) {
+			it.items = append(it.items, &fileItem{key: []byte(k), entry: e})
+		}
+	}
+	sort.Slice(it.items, func(i, j int) bool {
+		less := bytes.Compare(it.items[i].key, it.items[j].key) < 0
+		return less != it.reverse
+	})
+	return it
+}
+
+type fileItem struct {
+	key   []byte
+	entry *fileEntry
+}
+
+func (i *fileItem) Key() []byte {
+	return i.key
+}
+
+func (i *fileItem) KeyCopy(dst []byte) []byte {
+	return append(dst[:0], i.key...)
+}
+
+func (i *fileItem) Value(fn func(val []byte) error) error {
+	return fn(i.entry.value)
+}
+
+func (i *fileItem) ValueCopy(dst []byte) ([]byte, error) {
+	return append(dst[:0], i.entry.value...), nil
+}
+
+func (i *fileItem) ExpiresAt() uint64 {
+	return i.entry.expiresAt
+}
+
+type fileIterator struct {
+	items   []*fileItem
+	reverse bool
+	i       int
+}
+
+func (it *fileIterator) Rewind() {
+	it.i = 0
+}
+
+// Seek moves to the first key at or after key, or at or before it when
+// iterating in reverse.
+func (it *fileIterator) Seek(key []byte) {
+	it.i = sort.Search(len(it.items), func(i int) bool {
+		c := bytes.Compare(it.items[i].key, key)
+		if it.reverse {
+			return c <= 0
+		}
+		return c >= 0
+	})
+}
+
+func (it *fileIterator) Valid() bool {
+	return it.i < len(it.items)
+}
+
+func (it *fileIterator) ValidForPrefix(prefix []byte) bool {
+	return it.Valid() && bytes.HasPrefix(it.items[it.i].key, prefix)
+}
+
+func (it *fileIterator) Next() {
+	it.i++
+}
+
+func (it *fileIterator) Item() kvItem {
+	return it.items[it.i]
+}
+
+func (it *fileIterator) Close() {}
+
+// fileSequence leases values in blocks like Badger's sequences, storing the
+// end of the current lease big-endian at key.
+type fileSequence struct {
+	db        *fileDB
+	key       string
+	bandwidth uint64
+
+	mu     sync.Mutex
+	next   uint64
+	leased uint64
+}
+
+func (db *fileDB) GetSequence(key []byte, bandwidth uint64) (kvSequence, error) {
+	if db.readOnly {
+		return nil, errFileReadOnly
+	}
+	s := &fileSequence{db: db, key: string(key), bandwidth: bandwidth}
+	db.mu.Lock()
+	if e, ok := db.entries[s.key]; ok && len(e.value) == 8 {
+		s.next = binary.BigEndian.Uint64(e.value)
+	}
+	db.mu.Unlock()
+	s.leased = s.next
+	return s, s.lease(s.next + bandwidth)
+}
+
+// lease records end as the end of the lease. It writes outside of any
+// transaction, so it may be called from within one. Call with s.mu held.
+func (s *fileSequence) lease(end uint64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, end)
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	old := s.db.entries[s.key]
+	s.db.entries[s.key] = &fileEntry{value: b}
+	if err := s.db.save(); err != nil {
+		s.db.set(s.key, old)
+		return err
+	}
+	s.leased = end
+	return nil
+}
+
+func (s *fileSequence) Next() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= s.leased {
+		if err := s.lease(s.leased + s.bandwidth); err != nil {
+			return 0, err
+		}
+	}
+	n := s.next
+	s.next++
+	return n, nil
+}
+
+// Release gives back the values leased but not handed out.
+func (s *fileSequence) Release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lease(s.next)
+}
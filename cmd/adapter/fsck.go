@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+// Values of -fsck-on-start.
+const (
+	fsckOff    = "off"
+	fsckReport = "report"
+	fsckRepair = "repair"
+)
+
+// fsckProblem is one inconsistency fsck found in a tenant's keys.
+type fsckProblem struct {
+	tenant string
+	// The key at fault, relative to the tenant's prefix.
+	key    string
+	detail string
+	// How to repair it: delete lists keys to delete, put holds the value
+	// key should have, and repairId names a corrupt class to restore from
+	// its audit log. None is set when only a person can tell what the data
+	// should be.
+	delete   [][]byte
+	put      []byte
+	repairId string
+}
+
+func (p *fsckProblem) repairable() bool {
+	return len(p.delete) > 0 || p.put != nil || p.repairId != ""
+}
+
+func (p *fsckProblem) String() string {
+	s := fmt.Sprintf("tenant %s: %s: %s", p.tenant, p.key, p.detail)
+	if !p.repairable() {
+		s += " (needs manual repair)"
+	}
+	return s
+}
+
+// fsckTenant checks one tenant's keys for class fields without a class,
+// class Ids holding the field delimiter, values that can't be read back,
+// index entries, sections and enrollments of classes that don't exist, and
+// semester counts that disagree with the semester index, e.g. because
+// classes counted in them expired.
+func fsckTenant(txn *tenantTxn) ([]*fsckProblem, error) {
+	var problems []*fsckProblem
+	add := func(key []byte, format string, a ...interface{}) *fsckProblem {
+		p := &fsckProblem{tenant: txn.tenant, key: string(key), detail: fmt.Sprintf(format, a...)}
+		problems = append(problems, p)
+		return p
+	}
+
+	// Class fields, grouped by Id.
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(classKeyPrefix)
+	it := txn.NewIterator(opts)
+	stored := make(map[string]storedClass)
+	keys := make(map[string][][]byte)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			it.Close()
+			return nil, err
+		}
+		k := it.Key()
+		rest := string(k[len(opts.Prefix):])
+		id, field, ok := splitClassKey(rest)
+		if !ok {
+			add(k, "class key has no field name").delete = [][]byte{append([]byte(nil), k...)}
+			continue
+		}
+		if !bytes.Equal(k, classKey(id, field)) {
+			// Left by a migration that didn't finish, or written by hand:
+			// such a key may belong to a different Id than it seems to.
+			add(k, "class key of %s doesn't escape its Id", id)
+		}
+		v, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		if stored[id] == nil {
+			stored[id] = storedClass{}
+		}
+		stored[id][field] = string(v)
+		keys[id] = append(keys[id], append([]byte(nil), k...))
+	}
+	it.Close()
+
+	ids := make([]string, 0, len(stored))
+	for id := range stored {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	exists := make(map[string]bool)
+	for _, id := range ids {
+		f := stored[id]
+		if _, ok := f["Name"]; !ok {
+			add(keys[id][0], "%d field keys of class %s, which has no Name key", len(keys[id]), id).delete = keys[id]
+			continue
+		}
+		exists[id] = true
+		if sum, ok := f[checksumField]; ok && sum != f.checksum() {
+			add(classKey(id, checksumField), "class %s fails its checksum", id).repairId = id
+			continue
+		}
+		if _, err := decodeClass(txn.tenant, id, f); err != nil {
+			add(classKey(id, "Name"), "class %s can't be read: %s", id, err)
+		}
+	}
+
+	// Index entries end with the Id of the class they point to, after a
+	// semester, label or escaped instructor Id that holds no "/".
+	for _, prefix := range []string{semesterIndexPrefix, instructorIndexPrefix, labelIndexPrefix} {
+		prefix := prefix
+		err := fsckKeys(txn, []byte(prefix), func(k []byte) {
+			rest := string(k[len(prefix):])
+			id := rest[strings.Index(rest, "/")+1:]
+			if !exists[id] {
+				add(k, "index entry for missing class %s", id).delete = [][]byte{k}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// External Id index entries hold the Id of their class.
+	err := fsckValues(txn, []byte(externalIdIndexPrefix), func(k, v []byte) {
+		if !exists[string(v)] {
+			add(k, "index entry for missing class %s", v).delete = [][]byte{k}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sections and enrollments start with the escaped Id of their class.
+	type record struct {
+		prefix string
+		msg    func() proto.Message
+	}
+	for _, r := range []record{
+		{sectionPrefix, func() proto.Message { return &pb.Section{} }},
+		{enrollmentPrefix, func() proto.Message { return &pb.Enrollment{} }},
+	} {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(r.prefix)
+		it := txn.NewIterator(opts)
+		for it.Rewind(); it.Valid(); it.Next() {
+			k := append([]byte(nil), it.Key()...)
+			rest := string(k[len(r.prefix):])
+			id := unescapeId(rest)
+			if i := strings.Index(rest, "/"); i >= 0 {
+				id = unescapeId(rest[:i])
+			} else if r.prefix == enrollmentPrefix {
+				// The enrollment count of the class.
+				if !exists[id] {
+					add(k, "enrollment count of missing class %s", id).delete = [][]byte{k}
+				}
+				continue
+			}
+			if !exists[id] {
+				add(k, "%s of missing class %s", strings.TrimSuffix(r.prefix, "/"), id).delete = [][]byte{k}
+				continue
+			}
+			err := it.Item().Value(func(v []byte) error {
+				return proto.Unmarshal(v, r.msg())
+			})
+			if err != nil {
+				add(k, "value can't be read: %s", err)
+			}
+		}
+		it.Close()
+	}
+
+	err = fsckValues(txn, []byte(instructorPrefix), func(k, v []byte) {
+		if err := proto.Unmarshal(v, &pb.Instructor{}); err != nil {
+			add(k, "value can't be read: %s", err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counted, err := countSemesterStats(txn)
+	if err != nil {
+		return nil, err
+	}
+	err = fsckValues(txn, []byte(semesterStatsPrefix), func(k, v []byte) {
+		semester := string(k[len(semesterStatsPrefix):])
+		want := counted[semester]
+		delete(counted, semester)
+		if want == nil {
+			add(k, "counts of semester %s, which has no classes", semester).delete = [][]byte{k}
+			return
+		}
+		st := &pb.SemesterStats{}
+		if err := proto.Unmarshal(v, st); err != nil {
+			add(k, "value can't be read: %s", err).put = marshalStats(want)
+			return
+		}
+		if st.ClassCount != want.ClassCount || st.EnrollmentCount != want.EnrollmentCount {
+			if st.UpdateTime != nil {
+				want.UpdateTime = st.UpdateTime
+			}
+			add(k, "semester %s is counted with %d classes and %d enrollments but has %d and %d",
+				semester, st.ClassCount, st.EnrollmentCount, want.ClassCount, want.EnrollmentCount).put = marshalStats(want)
+		}
+	})
+	semesters := make([]string, 0, len(counted))
+	for semester := range counted {
+		semesters = append(semesters, semester)
+	}
+	sort.Strings(semesters)
+	for _, semester := range semesters {
+		add(semesterStatsKey(semester), "semester %s has no counts", semester).put = marshalStats(counted[semester])
+	}
+	return problems, err
+}
+
+func marshalStats(st *pb.SemesterStats) []byte {
+	v, _ := proto.Marshal(st)
+	return v
+}
+
+// fsckKeys calls fn with a copy of every key starting with prefix.
+func fsckKeys(txn *tenantTxn, prefix []byte, fn func(k []byte)) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return err
+		}
+		fn(append([]byte(nil), it.Key()...))
+	}
+	return nil
+}
+
+// fsckValues calls fn with a copy of every key starting with prefix and its
+// value, which is only valid during the call.
+func fsckValues(txn *tenantTxn, prefix []byte, fn func(k, v []byte)) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return err
+		}
+		k := append([]byte(nil), it.Key()...)
+		err := it.Item().Value(func(v []byte) error {
+			fn(k, v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsck checks every tenant of s's database, logging each problem, and with
+// repair set repairs those it can: keys nothing refers to are deleted,
+// semester counts recounted and corrupt classes restored from their audit
+// log. It returns how many
+// problems it found and how many are left.
+func (s *server) fsck(ctx context.Context, repair bool) (found, left int, err error) {
+	tenants, err := listTenants(s.db)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, tenant := range tenants {
+		var problems []*fsckProblem
+		err := s.view(ctx, tenant, func(txn *tenantTxn) error {
+			var err error
+			problems, err = fsckTenant(txn)
+			return err
+		})
+		if err != nil {
+			return found, left, fmt.Errorf("check tenant %s: %w", tenant, err)
+		}
+		found += len(problems)
+		var deletes [][]byte
+		var puts []*fsckProblem
+		for _, p := range problems {
+			logf(ctx, "fsck: %s", p)
+			switch {
+			case !repair || !p.repairable():
+				left++
+			case p.repairId != "":
+				repaired, err := s.repairClass(ctx, tenant, p.repairId)
+				if err != nil || !repaired {
+					logf(ctx, "fsck: class %s of tenant %s can't be restored: %v", p.repairId, tenant, err)
+					left++
+				}
+			case p.put != nil:
+				puts = append(puts, p)
+			default:
+				deletes = append(deletes, p.delete...)
+			}
+		}
+		if len(puts) > 0 {
+			err := s.update(ctx, tenant, func(txn *tenantTxn) error {
+				for _, p := range puts {
+					if err := txn.Set([]byte(p.key), p.put); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return found, left, fmt.Errorf("repair tenant %s: %w", tenant, err)
+			}
+		}
+		for len(deletes) > 0 {
+			n := archiveBatch
+			if n > len(deletes) {
+				n = len(deletes)
+			}
+			batch := deletes[:n]
+			deletes = deletes[n:]
+			err := s.update(ctx, tenant, func(txn *tenantTxn) error {
+				for _, k := range batch {
+					if err := txn.Delete(k); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return found, left, fmt.Errorf("repair tenant %s: %w", tenant, err)
+			}
+		}
+	}
+	return found, left, nil
+}
+
+// runFsck is the fsck subcommand: it checks a data directory the adapter
+// isn't running on, and exits non-zero if problems are left.
+func runFsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	dataDir := fs.String("data-dir", "", "data directory to check (the adapter must not be running)")
+	storageDriver := fs.String("storage-driver", driverBadger, "storage driver the -data-dir is kept with: badger or file")
+	encryptionKeyFile := fs.String("encryption-key-file", "", "file holding the key the -data-dir is encrypted with, if it is")
+	repair := fs.Bool("repair", false, "delete keys nothing refers to, recount semesters and restore corrupt classes from their audit log")
+	fs.Parse(args)
+	if *dataDir == "" {
+		fmt.Fprintln(os.Stderr, "fsck: -data-dir is required")
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	o := dbOptions{dir: *dataDir, readOnly: !*repair}
+	var err error
+	if *encryptionKeyFile != "" {
+		o.encryptionKey, err = readEncryptionKey(*encryptionKeyFile)
+	}
+	var found, left int
+	if err == nil {
+		found, left, err = fsckDataDir(*storageDriver, o, *repair)
+	}
+	if err != nil {
+		log.Fatalf("fsck: %s", err)
+	}
+	fmt.Fprintf(os.Stdout, "%d problems found, %d repaired, %d left\n", found, found-left, left)
+	if left > 0 {
+		os.Exit(1)
+	}
+}
+
+func fsckDataDir(driver string, o dbOptions, repair bool) (found, left int, err error) {
+	db, err := openDB(driver, o)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+	if err := checkKeySchema(db); err != nil {
+		return 0, 0, err
+	}
+	s := &server{db: db, events: newEventBus()}
+	if repair {
+		if s.audit, err = newAuditLog(db); err != nil {
+			return 0, 0, err
+		}
+		defer s.audit.close()
+	}
+	return s.fsck(context.Background(), repair)
+}
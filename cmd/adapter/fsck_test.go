@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func TestFsck(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		putTestClasses(t, s.db, &pb.Class{Id: "a", Name: "A", Semester: "fall"})
+		err := s.db.Update(func(txn kvTxn) error {
+			tt := newTenantTxn(txn, defaultTenant)
+			for k, v := range map[string]string{
+				string(classKey("gone", "Semester")):       "fall",
+				string(semesterIndexKey("spring", "gone")): "",
+				string(enrollmentKey("gone", "s1")):        "",
+				string(enrollmentCountKey("gone")):         "1",
+				string(enrollmentKey("a", "s1")):           "not a proto",
+				string(labelIndexKey("k=v", "also-gone")):  "",
+			} {
+				if err := tt.Set([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found, left, err := s.fsck(context.Background(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != 6 || left != 6 {
+			t.Fatalf("fsck found %d problems with %d left, want 6 and 6", found, left)
+		}
+
+		found, left, err = s.fsck(context.Background(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The unreadable enrollment of a class that exists needs a person.
+		if found != 6 || left != 1 {
+			t.Fatalf("fsck -repair found %d problems with %d left, want 6 and 1", found, left)
+		}
+		if found, _, err := s.fsck(context.Background(), false); err != nil || found != 1 {
+			t.Fatalf("fsck after repair found %d problems (%v), want 1", found, err)
+		}
+		var classes []*pb.Class
+		err = s.view(context.Background(), defaultTenant, func(txn *tenantTxn) error {
+			classes, err = listClasses(txn)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalIds(ids(classes), []string{"a"}) {
+			t.Errorf("classes after repair = %v, want [a]", ids(classes))
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+
+	"github.com/virtual-class-tutor/class-adapter-file/pkg/client"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type genSubject struct {
+	code   string
+	topics []string
+}
+
+var (
+	genSubjects = []genSubject{
+		{"MATH", []string{"Algebra I", "Algebra II", "Geometry", "Trigonometry", "Precalculus", "Calculus", "Statistics"}},
+		{"ENG", []string{"English Language", "American Literature", "British Literature", "Creative Writing", "Composition"}},
+		{"SCI", []string{"Biology", "Chemistry", "Physics", "Earth Science", "Environmental Science", "Anatomy"}},
+		{"HIST", []string{"World History", "US History", "European History", "Government", "Economics"}},
+		{"CS", []string{"Computer Science Principles", "Programming Fundamentals", "Data Structures", "Web Development"}},
+		{"LANG", []string{"Spanish", "French", "German", "Mandarin", "Latin"}},
+		{"ART", []string{"Drawing", "Painting", "Music Theory", "Photography", "Theater"}},
+	}
+	genLevels = []string{"", "", "", "Honors ", "AP ", "Intro to "}
+	genTerms  = []string{"SPRING", "SUMMER", "FALL", "WINTER"}
+)
+
+// generateClasses deterministically builds n classes for a given seed.
+func generateClasses(n int, seed int64) []*pb.Class {
+	r := rand.New(rand.NewSource(seed))
+	classes := make([]*pb.Class, n)
+	for i := range classes {
+		subj := genSubjects[r.Intn(len(genSubjects))]
+		topic := subj.topics[r.Intn(len(subj.topics))]
+		level := genLevels[r.Intn(len(genLevels))]
+		classes[i] = &pb.Class{
+			Id:       fmt.Sprintf("%s%d-%05d", subj.code, 100+r.Intn(400), i),
+			Name:     level + topic,
+			Semester: fmt.Sprintf("%d-%s", 2019+r.Intn(7), genTerms[r.Intn(len(genTerms))]),
+		}
+	}
+	return classes
+}
+
+func runGen(args []string) {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	n := fs.Int("n", 100, "number of classes to generate")
+	seed := fs.Int64("seed", 1, "random seed; the same seed always yields the same classes")
+	addr := fs.String("addr", "", "address of a running adapter to create the classes through")
+	dataDir := fs.String("data-dir", "", "data directory to write the classes into directly (the adapter must not be running)")
+	tenant := fs.String("tenant", defaultTenant, "tenant to create the classes for")
+	storageDriver := fs.String("storage-driver", driverBadger, "storage driver the -data-dir is kept with: badger or file")
+	encryptionKeyFile := fs.String("encryption-key-file", "", "file holding the key the -data-dir is encrypted with, if it is")
+	fs.Parse(args)
+
+	if (*addr == "") == (*dataDir == "") {
+		fmt.Fprintln(os.Stderr, "gen: exactly one of -addr or -data-dir is required")
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !tenantPattern.MatchString(*tenant) {
+		fmt.Fprintf(os.Stderr, "gen: -tenant must match %s\n", tenantPattern)
+		os.Exit(2)
+	}
+
+	classes := generateClasses(*n, *seed)
+	var err error
+	if *addr != "" {
+		err = genToAdapter(*addr, *tenant, classes)
+	} else {
+		o := dbOptions{dir: *dataDir}
+		if *encryptionKeyFile != "" {
+			o.encryptionKey, err = readEncryptionKey(*encryptionKeyFile)
+		}
+		if err == nil {
+			err = genToDataDir(*storageDriver, o, *tenant, classes)
+		}
+	}
+	if err != nil {
+		log.Fatalf("gen: %s", err)
+	}
+	log.Printf("Generated %d classes with seed %d", len(classes), *seed)
+}
+
+func genToAdapter(addr, tenant string, classes []*pb.Class) error {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), tenantMetadataKey, tenant)
+	c, err := client.Dial(ctx, addr, client.WithDialOptions(grpc.WithInsecure()))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	result, err := c.Import(ctx, classes, client.ImportOptions{
+		Progress: func(p client.Progress) {
+			log.Printf("Created %d of %d classes", p.Done-p.Failed, p.Total)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		f := result.Failed[0]
+		return fmt.Errorf("%d classes failed, first %s: %s", len(result.Failed), f.Id, f.Err)
+	}
+	return nil
+}
+
+// genBatchSize is how many classes genToDataDir writes per transaction,
+// well within what either driver commits at once.
+const genBatchSize = 500
+
+func genToDataDir(driver string, o dbOptions, tenant string, classes []*pb.Class) error {
+	db, err := openDB(driver, o)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := migrateKeySchema(db); err != nil {
+		return err
+	}
+
+	for len(classes) > 0 {
+		batch := classes
+		if len(batch) > genBatchSize {
+			batch = batch[:genBatchSize]
+		}
+		classes = classes[len(batch):]
+		err := db.Update(func(txn kvTxn) error {
+			t := newTenantTxn(txn, tenant)
+			for _, c := range batch {
+				if err := putClass(t, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHealthFastPath(t *testing.T) {
+	var ran []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ran = append(ran, name)
+			return handler(ctx, req)
+		}
+	}
+	// Stands in for auth and rate limiting, which would turn a probe away.
+	reject := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ran = append(ran, "reject")
+		return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		ran = append(ran, "handler")
+		return req, nil
+	}
+	samples := func(method string) uint64 {
+		var m dto.Metric
+		if err := healthDuration.WithLabelValues(method).(prometheus.Metric).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.Histogram.GetSampleCount()
+	}
+
+	const check = healthServicePrefix + "Check"
+	before := samples(check)
+	fast := healthFastPathUnary(record("first"), record("second"), reject)
+	if _, err := fast(context.Background(), "probe", &grpc.UnaryServerInfo{FullMethod: check}, handler); err != nil {
+		t.Errorf("a health check got %v", err)
+	}
+	if len(ran) != 1 || ran[0] != "handler" {
+		t.Errorf("a health check ran %v, want only its handler", ran)
+	}
+	if got := samples(check); got != before+1 {
+		t.Errorf("a health check recorded %d latency samples, want 1", got-before)
+	}
+
+	ran = nil
+	_, err := fast(context.Background(), "call", &grpc.UnaryServerInfo{FullMethod: "/class.Adapter/Get"}, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("a call the chain rejects got %v", err)
+	}
+	if want := []string{"first", "second", "reject"}; !equalIds(ran, want) {
+		t.Errorf("a regular call ran %v, want %v", ran, want)
+	}
+	ran = nil
+	if _, err := healthFastPathUnary(record("first"), record("second"))(context.Background(), "call", &grpc.UnaryServerInfo{FullMethod: "/class.Adapter/Get"}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "second", "handler"}; !equalIds(ran, want) {
+		t.Errorf("a regular call ran %v, want %v", ran, want)
+	}
+}
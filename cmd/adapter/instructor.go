@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Instructors are stored whole as instructor/<id>. The classes naming each
+// one are indexed as idx/instructor/<instructor id>/<class id>.
+const (
+	instructorPrefix      = "instructor/"
+	instructorIndexPrefix = indexPrefix + "instructor/"
+)
+
+const maxEmailLength = 254
+
+func instructorKey(id string) []byte {
+	return []byte(instructorPrefix + id)
+}
+
+func instructorIndexKey(instructorId, classId string) []byte {
+	return []byte(instructorIndexPrefix + escapeId(instructorId) + "/" + classId)
+}
+
+// instructorStore serves the Instructors service from the adapter's
+// database.
+type instructorStore struct {
+	pb.UnimplementedInstructorsServer
+	s *server
+}
+
+func (v *violations) checkInstructor(in *pb.Instructor) {
+	v.checkId(in.Id)
+	if len(in.Name) > maxNameLength {
+		v.add("name", "must be at most %d characters", maxNameLength)
+	}
+	switch {
+	case len(in.Email) > maxEmailLength:
+		v.add("email", "must be at most %d characters", maxEmailLength)
+	case in.Email != "" && !strings.Contains(in.Email, "@"):
+		v.add("email", "must be an email address")
+	}
+}
+
+func getInstructor(txn *tenantTxn, id string) (*pb.Instructor, error) {
+	item, err := txn.Get(instructorKey(id))
+	if err != nil {
+		return nil, err
+	}
+	in := &pb.Instructor{}
+	err = item.Value(func(v []byte) error {
+		return proto.Unmarshal(v, in)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read instructor %s: %w", id, err)
+	}
+	return in, nil
+}
+
+func putInstructor(txn *tenantTxn, in *pb.Instructor) error {
+	v, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(instructorKey(in.Id), v); err != nil {
+		return fmt.Errorf("put instructor %s: %w", in.Id, err)
+	}
+	return nil
+}
+
+// checkInstructorRef fails with FailedPrecondition unless c names no
+// instructor or one that exists. It rewrites the instructor unchanged, so
+// a concurrent Delete of the instructor conflicts with the class write
+// instead of leaving the class pointing at nothing.
+func checkInstructorRef(txn *tenantTxn, c *pb.Class) error {
+	if c.InstructorId == "" {
+		return nil
+	}
+	in, err := getInstructor(txn, c.InstructorId)
+	if err == badger.ErrKeyNotFound {
+		return preconditionFailed(preconditionInstructor, "instructors/"+c.InstructorId, "instructor %s not found", c.InstructorId)
+	}
+	if err != nil {
+		return err
+	}
+	return putInstructor(txn, in)
+}
+
+// instructorClasses returns the Ids of the classes naming an instructor.
+func instructorClasses(txn *tenantTxn, instructorId string) []string {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = instructorIndexKey(instructorId, "")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var ids []string
+	for it.Rewind(); it.Valid(); it.Next() {
+		ids = append(ids, string(it.Key()[len(opts.Prefix):]))
+	}
+	return ids
+}
+
+func (is *instructorStore) Create(ctx context.Context, in *pb.Instructor) (*pb.Instructor, error) {
+	logf(ctx, "Instructors.Create called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	in.CreateTime = timestamppb.Now()
+	in.UpdateTime = in.CreateTime
+	err = is.s.update(ctx, tenant, func(txn *tenantTxn) error {
+		_, err := txn.Get(instructorKey(in.Id))
+		if err == nil {
+			return status.Errorf(codes.AlreadyExists, "instructor %s already exists", in.Id)
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+		return putInstructor(txn, in)
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return in, nil
+}
+
+func (is *instructorStore) Get(ctx context.Context, in *pb.InstructorRequest) (*pb.Instructor, error) {
+	logf(ctx, "Instructors.Get called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out *pb.Instructor
+	err = is.s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		out, err = getInstructor(txn, in.Id)
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "instructor %s not found", in.Id)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return out, nil
+}
+
+func (is *instructorStore) Update(ctx context.Context, in *pb.Instructor) (*pb.Instructor, error) {
+	logf(ctx, "Instructors.Update called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = is.s.update(ctx, tenant, func(txn *tenantTxn) error {
+		old, err := getInstructor(txn, in.Id)
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "instructor %s not found", in.Id)
+		}
+		if err != nil {
+			return err
+		}
+		in.CreateTime = old.CreateTime
+		in.UpdateTime = timestamppb.Now()
+		return putInstructor(txn, in)
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return in, nil
+}
+
+func (is *instructorStore) Delete(ctx context.Context, in *pb.InstructorRequest) (*pb.Empty, error) {
+	logf(ctx, "Instructors.Delete called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = is.s.update(ctx, tenant, func(txn *tenantTxn) error {
+		_, err := txn.Get(instructorKey(in.Id))
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "instructor %s not found", in.Id)
+		}
+		if err != nil {
+			return err
+		}
+		if classes := instructorClasses(txn, in.Id); len(classes) > 0 {
+			return preconditionFailed(preconditionInstructor, "instructors/"+in.Id, "instructor %s is assigned to %d classes, e.g. %s", in.Id, len(classes), classes[0])
+		}
+		return txn.Delete(instructorKey(in.Id))
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (is *instructorStore) List(ctx context.Context, in *pb.ListInstructorsRequest) (*pb.ListInstructorsResponse, error) {
+	logf(ctx, "Instructors.List called")
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit, after, err := is.s.checkPage(ctx, "Instructors.List", in.PageSize, in.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.ListInstructorsResponse{Instructors: make([]*pb.Instructor, 0)}
+	err = is.s.view(ctx, tenant, func(txn *tenantTxn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(instructorPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Keys differ only after the prefix, so they sort in Id order.
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := txn.ctx.Err(); err != nil {
+				return err
+			}
+			out.TotalSize++
+			id := string(it.Key()[len(opts.Prefix):])
+			if id <= after || (limit > 0 && len(out.Instructors) > limit) {
+				continue
+			}
+			in := &pb.Instructor{}
+			err := it.Item().Value(func(v []byte) error {
+				return proto.Unmarshal(v, in)
+			})
+			if err != nil {
+				return fmt.Errorf("read instructor %s: %w", id, err)
+			}
+			out.Instructors = append(out.Instructors, in)
+		}
+		if limit > 0 && len(out.Instructors) > limit {
+			out.Instructors = out.Instructors[:limit]
+			out.NextPageToken = encodePageToken(out.Instructors[limit-1].Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return out, nil
+}
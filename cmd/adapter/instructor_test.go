@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestInstructorReferences(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		is := &instructorStore{s: s}
+		ctx := context.Background()
+
+		if _, err := is.Create(ctx, &pb.Instructor{Id: "lovelace", Name: "Ada Lovelace", Email: "ada@example.edu"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := is.Create(ctx, &pb.Instructor{Id: "lovelace"}); status.Code(err) != codes.AlreadyExists {
+			t.Errorf("creating a duplicate instructor returned %v, want AlreadyExists", err)
+		}
+		if _, err := is.Create(ctx, &pb.Instructor{Id: "babbage", Name: "Charles Babbage"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := is.Update(ctx, &pb.Instructor{Id: "babbage", Name: "C. Babbage"}); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := is.Get(ctx, &pb.InstructorRequest{Id: "babbage"}); err != nil || got.Name != "C. Babbage" || got.CreateTime == nil {
+			t.Errorf("Get after Update returned %v, %v", got, err)
+		}
+		list, err := is.List(ctx, &pb.ListInstructorsRequest{PageSize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Instructors) != 1 || list.Instructors[0].Id != "babbage" || list.TotalSize != 2 || list.NextPageToken == "" {
+			t.Errorf("first page of List returned %v", list)
+		}
+
+		if _, err := s.Create(ctx, &pb.Class{Id: "CS101", InstructorId: "hopper"}); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Create naming an unknown instructor returned %v, want FailedPrecondition", err)
+		}
+		if _, err := s.Create(ctx, &pb.Class{Id: "CS101", InstructorId: "lovelace"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := is.Delete(ctx, &pb.InstructorRequest{Id: "lovelace"}); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("deleting an assigned instructor returned %v, want FailedPrecondition", err)
+		}
+
+		// Reassigning the class frees the first instructor.
+		_, err = s.Update(ctx, &pb.Class{
+			Id:           "CS101",
+			InstructorId: "babbage",
+			UpdateMask:   &fieldmaskpb.FieldMask{Paths: []string{"instructor_id"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := is.Delete(ctx, &pb.InstructorRequest{Id: "lovelace"}); err != nil {
+			t.Errorf("deleting an unassigned instructor: %v", err)
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "CS101"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := is.Delete(ctx, &pb.InstructorRequest{Id: "babbage"}); err != nil {
+			t.Errorf("deleting the instructor of a deleted class: %v", err)
+		}
+		if _, err := is.Get(ctx, &pb.InstructorRequest{Id: "babbage"}); status.Code(err) != codes.NotFound {
+			t.Errorf("Get of a deleted instructor returned %v, want NotFound", err)
+		}
+	})
+}
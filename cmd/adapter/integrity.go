@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	corruptReads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "adapter_corrupt_reads_total",
+		Help: "Reads of class records that failed their checksum.",
+	})
+	classRepairs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "adapter_class_repairs_total",
+		Help: "Attempts to repair a corrupt class by result (repaired or failed).",
+	}, []string{"result"})
+)
+
+// classRef names a class across tenants.
+type classRef struct {
+	tenant, id string
+}
+
+// corruptClasses queues classes found corrupt for repair. Reports are dropped
+// while the queue is full; the next read reports them again.
+var corruptClasses = make(chan classRef, 100)
+
+// corruptionError is returned for a class whose fields don't match their
+// checksum. Such classes are quarantined: List leaves them out, Get fails
+// with DataLoss, and only AdminListQuarantined shows them.
+type corruptionError struct {
+	id string
+	// The fields as stored, for the admin view and the audit log.
+	stored *pb.Class
+}
+
+func (e *corruptionError) Error() string {
+	return fmt.Sprintf("class %s fails its checksum", e.id)
+}
+
+func (e *corruptionError) GRPCStatus() *status.Status {
+	return status.Newf(codes.DataLoss, "class %s is corrupt and has been quarantined for repair", e.id)
+}
+
+func isCorrupt(err error) bool {
+	var ce *corruptionError
+	return errors.As(err, &ce)
+}
+
+// reportCorrupt records a failed checksum and queues the class for repair.
+func reportCorrupt(tenant, id string, stored *pb.Class) error {
+	corruptReads.Inc()
+	log.Printf("Corruption detected: class %s of tenant %s fails its checksum, stored as %v", id, tenant, stored)
+	select {
+	case corruptClasses <- classRef{tenant, id}:
+	default:
+	}
+	return &corruptionError{id: id, stored: stored}
+}
+
+// rawClass converts stored fields to a class without verifying them. Times
+// that don't parse are left unset.
+func rawClass(id string, f storedClass) *pb.Class {
+	c := &pb.Class{
+		Id:             id,
+		Name:           f["Name"],
+		Semester:       f["Semester"],
+		InstructorId:   f["InstructorId"],
+		InstructorName: f["InstructorName"],
+		Description:    f["Description"],
+	}
+	c.CreateTime, _ = parseTime(f["CreateTime"])
+	c.UpdateTime, _ = parseTime(f["UpdateTime"])
+	if n, err := strconv.ParseInt(f["Capacity"], 10, 32); err == nil {
+		c.Capacity = int32(n)
+	}
+	c.Meetings, _ = decodeMeetings(f["Meetings"])
+	c.Labels, _ = decodeLabels(f["Labels"])
+	c.PrerequisiteIds, _ = decodePrerequisites(f["Prerequisites"])
+	c.ExternalIds, _ = decodeExternalIds(f["ExternalIds"])
+	c.ExpireTime, _ = parseTime(f["ExpireTime"])
+	c.State, _ = decodeState(f)
+	return c
+}
+
+// allowCorrupt returns the stored fields of a corrupt class instead of
+// failing, for writes that replace the whole class.
+func allowCorrupt(c *pb.Class, err error) (*pb.Class, error) {
+	var ce *corruptionError
+	if errors.As(err, &ce) {
+		return ce.stored, nil
+	}
+	return c, err
+}
+
+// repairCorrupt repairs queued classes until ctx is cancelled. A class that
+// can't be repaired stays quarantined and isn't retried until restart.
+func (s *server) repairCorrupt(ctx context.Context) {
+	failed := make(map[classRef]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-corruptClasses:
+			if failed[c] {
+				continue
+			}
+			repaired, err := s.repairClass(ctx, c.tenant, c.id)
+			switch {
+			case err != nil:
+				failed[c] = true
+				classRepairs.WithLabelValues("failed").Inc()
+				log.Printf("Error repairing class %s of tenant %s, it stays quarantined: %s", c.id, c.tenant, err)
+			case repaired:
+				classRepairs.WithLabelValues("repaired").Inc()
+				log.Printf("Repaired class %s of tenant %s from its audit log", c.id, c.tenant)
+			}
+		}
+	}
+}
+
+// repairClass restores a corrupt class to the value its audit log recorded
+// for the last change, reporting whether anything was rewritten.
+func (s *server) repairClass(ctx context.Context, tenant, id string) (bool, error) {
+	var repaired bool
+	err := s.update(ctx, tenant, func(txn *tenantTxn) error {
+		repaired = false
+		_, err := getClass(txn, id)
+		var ce *corruptionError
+		if !errors.As(err, &ce) {
+			// Already repaired, overwritten or deleted.
+			return nil
+		}
+		entries, err := readAuditLog(txn, id)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 || entries[len(entries)-1].NewValue == nil {
+			return errors.New("no known-good copy in the audit log")
+		}
+		good := entries[len(entries)-1].NewValue
+		if err := storeClass(txn, good); err != nil {
+			return err
+		}
+		repaired = true
+		return s.audit.record(ctx, txn, "Repair", id, ce.stored, good)
+	})
+	if err != nil {
+		return false, err
+	}
+	if repaired {
+		s.forgetRead(tenant, id)
+	}
+	return repaired, nil
+}
+
+func (s *server) AdminListQuarantined(ctx context.Context, in *pb.Empty) (*pb.Classes, error) {
+	logf(ctx, "AdminListQuarantined called")
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cs := &pb.Classes{}
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		_, cs.Classes, err = scanClasses(txn)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	cs.TotalSize = int64(len(cs.Classes))
+	return cs, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.Counter.GetValue()
+}
+
+func TestCorruptClass(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		var err error
+		if s.audit, err = newAuditLog(s.db); err != nil {
+			t.Fatal(err)
+		}
+		defer s.audit.close()
+		ctx := context.Background()
+		for _, c := range []*pb.Class{{Id: "MATH101", Name: "Algebra"}, {Id: "MATH102", Name: "Geometry"}} {
+			if _, err := s.Create(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// MATH103 has no audit log to repair it from.
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH103", Name: "Calculus"})
+		tamper := func(id string) {
+			t.Helper()
+			err := s.db.Update(func(txn kvTxn) error {
+				return newTenantTxn(txn, defaultTenant).Set(classKey(id, "Name"), []byte("tampered"))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		tamper("MATH101")
+		tamper("MATH103")
+		for len(corruptClasses) > 0 {
+			<-corruptClasses
+		}
+
+		// A corrupt class is quarantined: Get fails, List leaves it out and
+		// only the admin listing shows it, as stored.
+		reads := counterValue(t, corruptReads)
+		if _, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101"}); status.Code(err) != codes.DataLoss {
+			t.Errorf("Get of a corrupt class returned %v, want DataLoss", err)
+		}
+		if n := counterValue(t, corruptReads) - reads; n != 1 {
+			t.Errorf("Get of a corrupt class counted %g corrupt reads, want 1", n)
+		}
+		select {
+		case ref := <-corruptClasses:
+			if ref != (classRef{defaultTenant, "MATH101"}) {
+				t.Errorf("Get queued %v for repair, want MATH101", ref)
+			}
+		default:
+			t.Error("Get didn't queue the corrupt class for repair")
+		}
+		cs, err := s.List(ctx, &pb.ListRequest{})
+		if err != nil || !equalIds(ids(cs.Classes), []string{"MATH102"}) {
+			t.Errorf("List returned %v, %v; want only MATH102", cs, err)
+		}
+		admin := context.WithValue(ctx, roleKey{}, "admin")
+		q, err := s.AdminListQuarantined(admin, &pb.Empty{})
+		if err != nil || !equalIds(ids(q.Classes), []string{"MATH101", "MATH103"}) || q.Classes[0].Name != "tampered" {
+			t.Errorf("AdminListQuarantined returned %v, %v; want MATH101 and MATH103 as stored", q, err)
+		}
+		if _, err := s.AdminListQuarantined(context.WithValue(ctx, roleKey{}, ""), &pb.Empty{}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("AdminListQuarantined with a regular token returned %v, want PermissionDenied", err)
+		}
+		for len(corruptClasses) > 0 {
+			<-corruptClasses
+		}
+
+		// The repairer restores what the audit log last recorded, and leaves
+		// classes it can't repair quarantined.
+		repaired := counterValue(t, classRepairs.WithLabelValues("repaired"))
+		failed := counterValue(t, classRepairs.WithLabelValues("failed"))
+		repairCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			s.repairCorrupt(repairCtx)
+			close(done)
+		}()
+		corruptClasses <- classRef{defaultTenant, "MATH101"}
+		corruptClasses <- classRef{defaultTenant, "MATH103"}
+		deadline := time.Now().Add(5 * time.Second)
+		for counterValue(t, classRepairs.WithLabelValues("repaired"))-repaired < 1 ||
+			counterValue(t, classRepairs.WithLabelValues("failed"))-failed < 1 {
+			if time.Now().After(deadline) {
+				t.Fatal("the repairer didn't handle both classes")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		<-done
+		if c, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101"}); err != nil || c.Name != "Algebra" {
+			t.Errorf("Get after repair returned %v, %v; want Algebra", c, err)
+		}
+		if _, err := s.Get(ctx, &pb.GetRequest{Id: "MATH103"}); status.Code(err) != codes.DataLoss {
+			t.Errorf("Get of an unrepairable class returned %v, want DataLoss", err)
+		}
+		log, err := s.GetAuditLog(admin, &pb.AuditLogRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := log.Entries[len(log.Entries)-1]; last.Method != "Repair" || last.OldValue.GetName() != "tampered" || last.NewValue.GetName() != "Algebra" {
+			t.Errorf("the repair was recorded as %v", last)
+		}
+
+		// A write replacing the whole class also clears the quarantine.
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH103", Name: "Calculus I"}); err != nil {
+			t.Errorf("Update of a corrupt class returned %v", err)
+		}
+		if c, err := s.Get(ctx, &pb.GetRequest{Id: "MATH103"}); err != nil || c.Name != "Calculus I" {
+			t.Errorf("Get after Update returned %v, %v", c, err)
+		}
+		for len(corruptClasses) > 0 {
+			<-corruptClasses
+		}
+	})
+}
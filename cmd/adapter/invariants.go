@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// touch records that txn wrote or deleted the class with the given Id, so
+// -check-invariants can verify its derived data before the commit.
+func (t *tenantTxn) touch(id string) {
+	if t.written == nil {
+		t.written = make(map[string]bool)
+	}
+	t.written[id] = true
+}
+
+// assertInvariants panics, before txn commits, if any class it touched
+// disagrees with its derived data. It is meant for tests and staging: the
+// semester index is scanned once per write.
+func assertInvariants(txn *tenantTxn) {
+	ids := make([]string, 0, len(txn.written))
+	for id := range txn.written {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := checkClassInvariants(txn, id); err != nil {
+			log.Panicf("Invariant violated for class %s of tenant %s: %s", id, txn.tenant, err)
+		}
+	}
+}
+
+// checkClassInvariants verifies that a stored class has all of its keys, a
+// checksum that matches them, exactly one semester index entry, an
+// instructor index entry if it names one, a label index entry per label and
+// an external Id index entry per external Id, and that a deleted class left
+// neither keys, index entries, sections nor enrollments behind.
+func checkClassInvariants(txn *tenantTxn, id string) error {
+	f := storedClass{}
+	for _, field := range classFields {
+		v, err := getField(txn, id, field)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		f[field] = v
+	}
+	_, exists := f["Name"]
+
+	var indexed []string
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte(semesterIndexPrefix)
+	it := txn.NewIterator(opts)
+	for it.Rewind(); it.Valid(); it.Next() {
+		k := string(it.Key()[len(opts.Prefix):])
+		if i := strings.Index(k, "/"); i >= 0 && k[i+1:] == id {
+			indexed = append(indexed, k[:i])
+		}
+	}
+	it.Close()
+
+	var instructors []string
+	opts.Prefix = []byte(instructorIndexPrefix)
+	it = txn.NewIterator(opts)
+	for it.Rewind(); it.Valid(); it.Next() {
+		k := string(it.Key()[len(opts.Prefix):])
+		if i := strings.Index(k, "/"); i >= 0 && k[i+1:] == id {
+			instructors = append(instructors, unescapeId(k[:i]))
+		}
+	}
+	it.Close()
+
+	labeled := make(map[string]string)
+	opts.PrefetchValues = true
+	opts.Prefix = []byte(labelIndexPrefix)
+	it = txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		k := string(it.Key()[len(opts.Prefix):])
+		if i := strings.Index(k, "/"); i >= 0 && k[i+1:] == id {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			labeled[k[:i]] = string(v)
+		}
+	}
+
+	external := make(map[string]string)
+	opts.Prefix = []byte(externalIdIndexPrefix)
+	ext := txn.NewIterator(opts)
+	defer ext.Close()
+	for ext.Rewind(); ext.Valid(); ext.Next() {
+		v, err := ext.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if string(v) != id {
+			continue
+		}
+		k := string(ext.Key()[len(opts.Prefix):])
+		if i := strings.Index(k, "/"); i >= 0 {
+			external[k[:i]] = k[i+1:]
+		}
+	}
+
+	if !exists {
+		if len(f) > 0 {
+			return fmt.Errorf("orphan keys without a Name: %v", f)
+		}
+		if len(indexed) > 0 {
+			return fmt.Errorf("deleted class is still indexed under semesters %v", indexed)
+		}
+		if len(instructors) > 0 {
+			return fmt.Errorf("deleted class is still indexed under instructors %v", instructors)
+		}
+		if len(labeled) > 0 {
+			return fmt.Errorf("deleted class is still indexed under labels %v", labeled)
+		}
+		if len(external) > 0 {
+			return fmt.Errorf("deleted class is still indexed under external Ids %v", external)
+		}
+		sections, err := listSections(txn, id)
+		if err != nil {
+			return err
+		}
+		if len(sections) > 0 {
+			return fmt.Errorf("deleted class still has %d sections", len(sections))
+		}
+		enrollments, err := listEnrollments(txn, id)
+		if err != nil {
+			return err
+		}
+		if len(enrollments) > 0 {
+			return fmt.Errorf("deleted class still has %d enrollments", len(enrollments))
+		}
+		return nil
+	}
+	if _, ok := f["Semester"]; !ok {
+		return fmt.Errorf("no Semester key")
+	}
+	if sum, ok := f[checksumField]; !ok || sum != f.checksum() {
+		return fmt.Errorf("checksum %q doesn't match the fields, want %q", sum, f.checksum())
+	}
+	want := 0
+	if f["Semester"] != "" {
+		want = 1
+	}
+	if len(indexed) != want || (want == 1 && indexed[0] != f["Semester"]) {
+		return fmt.Errorf("semester %q is indexed under %v", f["Semester"], indexed)
+	}
+	if want := f["InstructorId"]; (want == "" && len(instructors) > 0) || (want != "" && (len(instructors) != 1 || instructors[0] != want)) {
+		return fmt.Errorf("instructor %q is indexed under %v", want, instructors)
+	}
+	labels := map[string]string{}
+	if v, ok := f["Labels"]; ok {
+		var err error
+		if labels, err = decodeLabels(v); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(labels, labeled) {
+		return fmt.Errorf("labels %v are indexed as %v", labels, labeled)
+	}
+	externalIds := map[string]string{}
+	if v, ok := f["ExternalIds"]; ok {
+		var err error
+		if externalIds, err = decodeExternalIds(v); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(externalIds, external) {
+		return fmt.Errorf("external Ids %v are indexed as %v", externalIds, external)
+	}
+	return nil
+}
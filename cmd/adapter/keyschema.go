@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// keySchemaVersion is the layout this adapter reads and writes: v1
+	// moved class fields under v1ClassKeyPrefix, v2 added the semester
+	// counts of semesterStatsPrefix, and v3 escaped the Ids in class keys
+	// and the keys of class records, moving class fields under
+	// classKeyPrefix. It is the version of the last of migrations.
+	keySchemaVersion = 3
+	// keySchemaKey records the layout of the database, missing before it
+	// was versioned.
+	keySchemaKey = metaPrefix + "key-schema"
+	// migrationProgressKey records, while a migration is under way, its
+	// version and the last tenant it finished, as <version>/<tenant>.
+	migrationProgressKey = metaPrefix + "migration-progress"
+	// Keys moved per transaction, to stay well inside Badger's limits.
+	migrateBatch = 1000
+)
+
+// migration is one numbered step of the key schema, bringing each tenant
+// from the version before it to version. A step commits its work in
+// batches and must be safe to run again on a tenant it was interrupted
+// part way through, since progress is only recorded once a tenant is done.
+// Changes to how keys are laid out or values encoded add a step to the end
+// of migrations and bump keySchemaVersion.
+type migration struct {
+	version int
+	// done describes what the step did, given the count run returned.
+	done string
+	run  func(db kvDB, tenant string) (int, error)
+}
+
+var migrations = []migration{
+	{1, "moved %d class keys under " + v1ClassKeyPrefix, migrateTenantToV1},
+	{2, "counted the classes of %d semesters", migrateTenantToV2},
+	{3, "moved %d keys to escape their Ids", migrateTenantToV3},
+}
+
+// readKeySchema returns the key schema version of db, 0 when unversioned.
+func readKeySchema(db kvDB) (int, error) {
+	var version int
+	err := db.View(func(txn kvTxn) error {
+		item, err := txn.Get([]byte(keySchemaKey))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			version, err = strconv.Atoi(string(v))
+			return err
+		})
+	})
+	return version, err
+}
+
+// readMigrationProgress returns the version of the migration under way on
+// db and the last tenant it finished, or 0 if none is under way.
+func readMigrationProgress(db kvDB) (int, string, error) {
+	var version int
+	var tenant string
+	err := db.View(func(txn kvTxn) error {
+		item, err := txn.Get([]byte(migrationProgressKey))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			parts := strings.SplitN(string(v), "/", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("malformed %s %q", migrationProgressKey, v)
+			}
+			version, err = strconv.Atoi(parts[0])
+			tenant = parts[1]
+			return err
+		})
+	})
+	return version, tenant, err
+}
+
+// checkKeySchema fails unless db is at keySchemaVersion, for a read-only
+// adapter that can't migrate it.
+func checkKeySchema(db kvDB) error {
+	version, err := readKeySchema(db)
+	if err != nil {
+		return err
+	}
+	if version != keySchemaVersion {
+		return fmt.Errorf("database uses key schema v%d but this adapter reads v%d; start a writable adapter on it once to migrate it", version, keySchemaVersion)
+	}
+	return nil
+}
+
+// migrateKeySchema brings db up to keySchemaVersion by running migrations,
+// recording the version after each so later starts skip what is done. A
+// database written by a newer adapter is refused rather than misread.
+func migrateKeySchema(db kvDB) error {
+	return runMigrations(db, migrations)
+}
+
+// runMigrations runs the steps db hasn't had yet, in order, one tenant at
+// a time. After each tenant it records how far it got, so a migration
+// stopped by a crash or a restart resumes with the next tenant.
+func runMigrations(db kvDB, steps []migration) error {
+	version, err := readKeySchema(db)
+	if err != nil {
+		return err
+	}
+	latest := steps[len(steps)-1].version
+	if version > latest {
+		return fmt.Errorf("database uses key schema v%d, newer than this adapter's v%d", version, latest)
+	}
+	if version == latest {
+		return nil
+	}
+	tenants, err := listTenants(db)
+	if err != nil {
+		return err
+	}
+	resumeVersion, resumeAfter, err := readMigrationProgress(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range steps {
+		if m.version <= version {
+			continue
+		}
+		todo := tenants
+		if m.version == resumeVersion {
+			for i, tenant := range tenants {
+				if tenant == resumeAfter {
+					todo = tenants[i+1:]
+					log.Printf("Resuming the migration to key schema v%d after tenant %s", m.version, tenant)
+					break
+				}
+			}
+		}
+		var n int
+		for _, tenant := range todo {
+			c, err := m.run(db, tenant)
+			n += c
+			if err != nil {
+				return fmt.Errorf("migrate to key schema v%d: tenant %s: %w", m.version, tenant, err)
+			}
+			err = db.Update(func(txn kvTxn) error {
+				return txn.Set([]byte(migrationProgressKey), []byte(strconv.Itoa(m.version)+"/"+tenant))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("Migrated %d tenants to key schema v%d: "+m.done, len(todo), m.version, n)
+		err := db.Update(func(txn kvTxn) error {
+			if err := txn.Set([]byte(keySchemaKey), []byte(strconv.Itoa(m.version))); err != nil {
+				return err
+			}
+			return txn.Delete([]byte(migrationProgressKey))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listTenants returns defaultTenant and every tenant with keys of its own.
+func listTenants(db kvDB) ([]string, error) {
+	tenants := []string{defaultTenant}
+	err := db.View(func(txn kvTxn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(tenantKeyPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); {
+			rest := string(it.Item().Key()[len(opts.Prefix):])
+			i := strings.Index(rest, "/")
+			if i < 0 {
+				it.Next()
+				continue
+			}
+			tenants = append(tenants, rest[:i])
+			// Skip the rest of the tenant's keys: "0" sorts right after "/".
+			it.Seek([]byte(tenantKeyPrefix + rest[:i] + "0"))
+		}
+		return nil
+	})
+	return tenants, err
+}
+
+// migrateTenantToV1 moves one tenant's unversioned class keys a batch at a
+// time. Keys that are neither reserved nor a class field are left in place.
+func migrateTenantToV1(db kvDB, tenant string) (int, error) {
+	type entry struct{ key, value []byte }
+	var moved int
+	var after []byte
+	for {
+		var batch []entry
+		err := db.View(func(txn kvTxn) error {
+			t := newTenantTxn(txn, tenant)
+			it := t.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Seek(after); it.Valid() && len(batch) < migrateBatch; it.Next() {
+				k := it.Key()
+				if bytes.Equal(k, after) {
+					continue
+				}
+				after = append(after[:0], k...)
+				if isReservedKey(string(k)) || bytes.HasPrefix(k, []byte(v1ClassKeyPrefix)) || bytes.HasPrefix(k, []byte(classKeyPrefix)) {
+					continue
+				}
+				if !bytes.Contains(k, []byte(delim)) {
+					log.Printf("Leaving key %q of tenant %s in place: it isn't a class field", k, tenant)
+					continue
+				}
+				v, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				batch = append(batch, entry{append([]byte(nil), k...), v})
+			}
+			return nil
+		})
+		if err != nil || len(batch) == 0 {
+			return moved, err
+		}
+		err = db.Update(func(txn kvTxn) error {
+			t := newTenantTxn(txn, tenant)
+			for _, e := range batch {
+				if err := t.Set(append([]byte(v1ClassKeyPrefix), e.key...), e.value); err != nil {
+					return err
+				}
+				if err := t.Delete(e.key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+		moved += len(batch)
+	}
+}
+
+// migrateTenantToV3 moves one tenant's audit log entries, then its class
+// keys, to keys with their Ids escaped, reading everything up to a class
+// key's last delimiter as its Id, as older adapters did. A class whose Id
+// changes when escaped takes its sections and enrollments along in the
+// transaction that moves its Name key, and so does its instructor index
+// entry if the instructor's Id changes. Class keys move from
+// v1ClassKeyPrefix to classKeyPrefix, and audit entries are keyed by the Id
+// they hold, so a second run moves nothing. Finally it recounts the
+// tenant's semesters, since migrateTenantToV2 looked for classes under
+// classKeyPrefix before they were there.
+//
+// A section or enrollment is taken to be of the class whose unescaped Id
+// its key holds. That is only wrong if the tenant has a class whose Id is
+// the escaped Id of another's, such as "a%b" and "a%25b".
+func migrateTenantToV3(db kvDB, tenant string) (int, error) {
+	moved, err := migrateAuditToV3(db, tenant)
+	if err != nil {
+		return moved, err
+	}
+	type entry struct {
+		from, value []byte
+		id, field   string
+	}
+	for {
+		var batch []entry
+		err := db.View(func(txn kvTxn) error {
+			t := newTenantTxn(txn, tenant)
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte(v1ClassKeyPrefix)
+			it := t.NewIterator(opts)
+			defer it.Close()
+			for it.Rewind(); it.Valid() && len(batch) < migrateBatch; it.Next() {
+				k := it.Key()
+				e := entry{from: append([]byte(nil), k...), id: string(k[len(v1ClassKeyPrefix):])}
+				if i := strings.LastIndex(e.id, delim); i >= 0 {
+					e.id, e.field = e.id[:i], e.id[i+1:]
+				}
+				v, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				e.value = v
+				batch = append(batch, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		var records int
+		err = db.Update(func(txn kvTxn) error {
+			t := newTenantTxn(txn, tenant)
+			records = 0
+			for _, e := range batch {
+				// A key without a field name stays one, for fsck to report.
+				to := []byte(classKeyPrefix + escapeId(e.id))
+				if e.field != "" {
+					to = classKey(e.id, e.field)
+				}
+				if err := t.Set(to, e.value); err != nil {
+					return err
+				}
+				if err := t.Delete(e.from); err != nil {
+					return err
+				}
+				if e.field == "Name" {
+					n, err := moveClassRecordsToV3(t, e.id)
+					if err != nil {
+						return fmt.Errorf("class %s: %w", e.id, err)
+					}
+					records += n
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+		moved += len(batch) + records
+	}
+	_, err = migrateTenantToV2(db, tenant)
+	return moved, err
+}
+
+// moveClassRecordsToV3 moves the sections, enrollments and instructor index
+// entry of the class id to keys with its Id, and its instructor's, escaped.
+// The class's own keys may be under either prefix.
+func moveClassRecordsToV3(txn *tenantTxn, id string) (int, error) {
+	var moved int
+	move := func(from, to []byte) error {
+		if bytes.Equal(from, to) {
+			return nil
+		}
+		item, err := txn.Get(from)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(to, v); err != nil {
+			return err
+		}
+		moved++
+		return txn.Delete(from)
+	}
+	if escapeId(id) != id {
+		for _, p := range []struct{ from, to []byte }{
+			{[]byte(sectionPrefix + id + "/"), sectionKey(id, "")},
+			{[]byte(enrollmentPrefix + id + "/"), enrollmentKey(id, "")},
+		} {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			opts.Prefix = p.from
+			it := txn.NewIterator(opts)
+			var keys [][]byte
+			for it.Rewind(); it.Valid(); it.Next() {
+				keys = append(keys, append([]byte(nil), it.Key()...))
+			}
+			it.Close()
+			for _, k := range keys {
+				if err := move(k, append(append([]byte(nil), p.to...), k[len(p.from):]...)); err != nil {
+					return moved, err
+				}
+			}
+		}
+		if err := move([]byte(enrollmentPrefix+id), enrollmentCountKey(id)); err != nil {
+			return moved, err
+		}
+	}
+
+	var instructorId string
+	for _, k := range [][]byte{[]byte(v1ClassKeyPrefix + id + delim + "InstructorId"), classKey(id, "InstructorId")} {
+		item, err := txn.Get(k)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return moved, err
+		}
+		instructorId = string(v)
+	}
+	if instructorId == "" {
+		return moved, nil
+	}
+	return moved, move([]byte(instructorIndexPrefix+instructorId+"/"+id), instructorIndexKey(instructorId, id))
+}
+
+// migrateAuditToV3 moves one tenant's audit log entries to keys with the
+// Id of their class, which each entry holds, escaped. It covers the
+// entries of deleted classes too, which no class key leads to.
+func migrateAuditToV3(db kvDB, tenant string) (int, error) {
+	type entry struct{ from, to, value []byte }
+	var moved int
+	var after []byte
+	for {
+		var batch []entry
+		err := db.View(func(txn kvTxn) error {
+			t := newTenantTxn(txn, tenant)
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte(auditPrefix)
+			it := t.NewIterator(opts)
+			defer it.Close()
+			if after == nil {
+				it.Rewind()
+			} else {
+				it.Seek(after)
+			}
+			for ; it.Valid() && len(batch) < migrateBatch; it.Next() {
+				k := it.Key()
+				if bytes.Equal(k, after) {
+					continue
+				}
+				after = append(after[:0], k...)
+				v, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				e := &pb.AuditEntry{}
+				if err := proto.Unmarshal(v, e); err != nil {
+					log.Printf("Leaving audit entry %q of tenant %s in place: %s", k, tenant, err)
+					continue
+				}
+				to := []byte(fmt.Sprintf("%s%020d", auditClassPrefix(e.Id), e.Sequence))
+				if !bytes.Equal(k, to) {
+					batch = append(batch, entry{append([]byte(nil), k...), to, v})
+				}
+			}
+			return nil
+		})
+		if err != nil || len(batch) == 0 {
+			return moved, err
+		}
+		err = db.Update(func(txn kvTxn) error {
+			t := newTenantTxn(txn, tenant)
+			for _, e := range batch {
+				if err := t.Set(e.to, e.value); err != nil {
+					return err
+				}
+				if err := t.Delete(e.from); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+		moved += len(batch)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMigrateKeySchema(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		// Classes as written before the key schema was versioned, including
+		// one with more fields than fit in a migration batch.
+		setKeys(t, db,
+			"MATH101.Name", "Algebra", "MATH101.Semester", "2024-FALL",
+			"tenant/district-a/ART100.Name", "Drawing", "tenant/district-a/ART100.Semester", "",
+			"idx/semester/2024-FALL/MATH101", "",
+			"stray", "left alone",
+		)
+		var many []string
+		for i := 0; i < migrateBatch+10; i++ {
+			many = append(many, fmt.Sprintf("C%04d.Name", i), "Bulk", fmt.Sprintf("C%04d.Semester", i), "")
+		}
+		setKeys(t, db, many...)
+
+		if err := checkKeySchema(db); err == nil {
+			t.Error("an unversioned database passed checkKeySchema")
+		}
+		for i := 0; i < 2; i++ {
+			if err := migrateKeySchema(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := checkKeySchema(db); err != nil {
+			t.Error(err)
+		}
+
+		s := &server{db: db, events: newEventBus()}
+		cs, err := s.List(context.Background(), &pb.ListRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cs.TotalSize != migrateBatch+11 || cs.Classes[0].Id != "C0000" || cs.Classes[len(cs.Classes)-1].Id != "MATH101" {
+			t.Errorf("List after migrating returned %d classes (total %d)", len(cs.Classes), cs.TotalSize)
+		}
+		c, err := s.Get(tenantContext("district-a"), &pb.GetRequest{Id: "ART100"})
+		if err != nil || c.Name != "Drawing" {
+			t.Errorf("Get of another tenant's class returned %v, %v", c, err)
+		}
+		st, err := s.GetSemesterStats(context.Background(), &pb.GetSemesterStatsRequest{Semester: "2024-FALL"})
+		if err != nil || st.ClassCount != 1 {
+			t.Errorf("GetSemesterStats after migrating returned %v, %v, want 1 class", st, err)
+		}
+		for _, k := range []string{"MATH101.Name", "tenant/district-a/ART100.Name"} {
+			if _, ok := getKey(t, db, k); ok {
+				t.Errorf("%s wasn't moved", k)
+			}
+		}
+		for _, k := range []string{"stray", "idx/semester/2024-FALL/MATH101"} {
+			if _, ok := getKey(t, db, k); !ok {
+				t.Errorf("%s was moved", k)
+			}
+		}
+
+		setKeys(t, db, keySchemaKey, strconv.Itoa(keySchemaVersion+1))
+		if err := migrateKeySchema(db); err == nil {
+			t.Error("a database from a newer adapter was accepted")
+		}
+	})
+}
+
+func TestMigrateToV3(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		// Keys of v2, when Ids were stored as they are. Older adapters
+		// allowed the field delimiter in them.
+		section, _ := proto.Marshal(&pb.Section{Id: "01"})
+		enrollment, _ := proto.Marshal(&pb.Enrollment{ClassId: "m%n", StudentId: "s1"})
+		entry := &pb.AuditEntry{Sequence: 7, Method: "Delete", Id: "d%e"}
+		entry.Hash, _ = auditHash(entry)
+		audit, _ := proto.Marshal(entry)
+		setKeys(t, db,
+			keySchemaKey, "2",
+			v1ClassKeyPrefix+"x.y.Name", "Dotted", v1ClassKeyPrefix+"x.y.Semester", "",
+			v1ClassKeyPrefix+"x.Name", "Plain", v1ClassKeyPrefix+"x.Semester", "2024-FALL",
+			"idx/semester/2024-FALL/x", "",
+			v1ClassKeyPrefix+"m%n.Name", "Percent", v1ClassKeyPrefix+"m%n.Semester", "", v1ClassKeyPrefix+"m%n.InstructorId", "i%j",
+			"section/m%n/01", string(section),
+			"enroll/m%n/s1", string(enrollment), "enroll/m%n", "1",
+			"idx/instructor/i%j/m%n", "",
+			"audit/d%e/00000000000000000007", string(audit),
+			"tenant/district-a/"+v1ClassKeyPrefix+"p.q.Name", "Other", "tenant/district-a/"+v1ClassKeyPrefix+"p.q.Semester", "",
+		)
+		for i := 0; i < 2; i++ {
+			if err := migrateKeySchema(db); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := checkKeySchema(db); err != nil {
+			t.Error(err)
+		}
+		for _, k := range []string{v1ClassKeyPrefix + "x.Name", v1ClassKeyPrefix + "x.y.Name", "section/m%n/01", "enroll/m%n", "audit/d%e/00000000000000000007", "tenant/district-a/" + v1ClassKeyPrefix + "p.q.Name"} {
+			if _, ok := getKey(t, db, k); ok {
+				t.Errorf("%s wasn't moved", k)
+			}
+		}
+		if n, err := migrateTenantToV3(db, defaultTenant); err != nil || n != 0 {
+			t.Errorf("migrating to v3 again moved %d keys (%v), want none", n, err)
+		}
+
+		s := &server{db: db, events: newEventBus()}
+		ctx := context.Background()
+		for id, name := range map[string]string{"x": "Plain", "x.y": "Dotted", "m%n": "Percent"} {
+			c, err := s.Get(ctx, &pb.GetRequest{Id: id})
+			if err != nil || c.Name != name {
+				t.Errorf("Get(%s) after migrating returned %v, %v, want %s", id, c, err, name)
+			}
+		}
+		c, err := s.Get(tenantContext("district-a"), &pb.GetRequest{Id: "p.q"})
+		if err != nil || c.Name != "Other" {
+			t.Errorf("Get of another tenant's class returned %v, %v", c, err)
+		}
+		if b, err := s.GetClassBundle(ctx, &pb.GetRequest{Id: "m%n"}); err != nil || len(b.Sections) != 1 {
+			t.Errorf("GetClassBundle(m%%n) returned %v, %v, want its section", b, err)
+		}
+		if es, err := s.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "m%n"}); err != nil || len(es.Enrollments) != 1 {
+			t.Errorf("ListEnrollments(m%%n) returned %v, %v, want its student", es, err)
+		}
+		if log, err := s.GetAuditLog(ctx, &pb.AuditLogRequest{Id: "d%e"}); err != nil || len(log.Entries) != 1 {
+			t.Errorf("GetAuditLog of the deleted class d%%e returned %v, %v", log, err)
+		}
+		// migrateTenantToV2 ran before the class keys moved.
+		if st, err := s.GetSemesterStats(ctx, &pb.GetSemesterStatsRequest{Semester: "2024-FALL"}); err != nil || st.ClassCount != 1 {
+			t.Errorf("GetSemesterStats after migrating returned %v, %v, want 1 class", st, err)
+		}
+		err = s.view(ctx, defaultTenant, func(txn *tenantTxn) error {
+			if got := instructorClasses(txn, "i%j"); !equalIds(got, []string{"m%n"}) {
+				t.Errorf("instructorClasses(i%%j) = %v, want [m%%n]", got)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestMigrationsAreNumbered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.version, i+1)
+		}
+	}
+	if latest := migrations[len(migrations)-1].version; latest != keySchemaVersion {
+		t.Errorf("the last migration is v%d, but keySchemaVersion is %d", latest, keySchemaVersion)
+	}
+}
+
+func TestRunMigrationsResumes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		setKeys(t, db, "tenant/a/x", "", "tenant/b/x", "", "tenant/c/x", "")
+		runs := make(map[string]int)
+		fail := "b"
+		steps := []migration{
+			{1, "touched %d tenants", func(db kvDB, tenant string) (int, error) {
+				runs["v1/"+tenant]++
+				return 1, nil
+			}},
+			{2, "touched %d tenants", func(db kvDB, tenant string) (int, error) {
+				if tenant == fail {
+					return 0, fmt.Errorf("interrupted")
+				}
+				runs["v2/"+tenant]++
+				return 1, nil
+			}},
+		}
+
+		if err := runMigrations(db, steps); err == nil {
+			t.Fatal("runMigrations succeeded with a failing step")
+		}
+		if version, err := readKeySchema(db); err != nil || version != 1 {
+			t.Errorf("after the failure the key schema is v%d (%v), want v1", version, err)
+		}
+		if version, tenant, err := readMigrationProgress(db); err != nil || version != 2 || tenant != "a" {
+			t.Errorf("after the failure the progress is v%d after %q (%v), want v2 after a", version, tenant, err)
+		}
+
+		fail = ""
+		if err := runMigrations(db, steps); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int{
+			"v1/" + defaultTenant: 1, "v1/a": 1, "v1/b": 1, "v1/c": 1,
+			"v2/" + defaultTenant: 1, "v2/a": 1, "v2/b": 1, "v2/c": 1,
+		}
+		for k, n := range want {
+			if runs[k] != n {
+				t.Errorf("step %s ran %d times, want %d", k, runs[k], n)
+			}
+		}
+		if version, err := readKeySchema(db); err != nil || version != 2 {
+			t.Errorf("the key schema is v%d (%v), want v2", version, err)
+		}
+		if _, ok := getKey(t, db, migrationProgressKey); ok {
+			t.Error("the migration progress was left after it finished")
+		}
+		if err := runMigrations(db, steps[:1]); err == nil {
+			t.Error("runMigrations accepted a database newer than its steps")
+		}
+	})
+}
+
+func TestListSkipsKeysWithoutField(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		putTestClasses(t, db, &pb.Class{Id: "MATH101", Name: "Algebra"})
+		setKeys(t, db, classKeyPrefix+"nodelimiter", "x")
+		s := &server{db: db, events: newEventBus()}
+		cs, err := s.List(context.Background(), &pb.ListRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(cs.Classes); !equalIds(got, []string{"MATH101"}) {
+			t.Errorf("List returned %v", got)
+		}
+	})
+}
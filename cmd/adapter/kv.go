@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Key-value entries live under kvPrefix in the caller's tenant, as
+// "ext/<namespace>/<key>". Class scans skip the prefix like any other
+// reserved one, and class keys start with classKeyPrefix, so the two never
+// meet.
+const kvPrefix = "ext/"
+
+const (
+	maxKVKeyLength = 256
+	// Most entries a KeyValueStore List returns per page.
+	maxKVListResults = 1000
+)
+
+var kvNamespacePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,63}$`)
+
+// kvStore serves the KeyValueStore service from the adapter's database.
+type kvStore struct {
+	pb.UnimplementedKeyValueStoreServer
+	s *server
+
+	// Quotas for each namespace of each tenant.
+	maxKeys      int
+	maxValueSize int
+}
+
+func kvNamespaceKey(namespace string) []byte {
+	return []byte(kvPrefix + namespace + "/")
+}
+
+func kvKey(namespace, key string) []byte {
+	return append(kvNamespaceKey(namespace), key...)
+}
+
+func (v *violations) checkNamespace(namespace string) {
+	if !kvNamespacePattern.MatchString(namespace) {
+		v.add("namespace", "must match %s", kvNamespacePattern)
+	}
+}
+
+func (v *violations) checkKVKey(key string) {
+	switch {
+	case key == "":
+		v.add("key", "must not be empty")
+	case len(key) > maxKVKeyLength:
+		v.add("key", "must be at most %d bytes", maxKVKeyLength)
+	}
+}
+
+// countKeys counts the entries of a namespace without reading their values.
+func countKeys(txn *tenantTxn, namespace string) int {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = kvNamespaceKey(namespace)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	n := 0
+	for it.Rewind(); it.Valid(); it.Next() {
+		n++
+	}
+	return n
+}
+
+func (kv *kvStore) Put(ctx context.Context, in *pb.KeyValue) (*pb.KeyValue, error) {
+	logf(ctx, "KeyValueStore.Put called for %s/%s", in.Namespace, in.Key)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var v violations
+	if len(in.Value) > kv.maxValueSize {
+		v.add("value", "must be at most %d bytes", kv.maxValueSize)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	err = kv.s.update(ctx, tenant, func(txn *tenantTxn) error {
+		k := kvKey(in.Namespace, in.Key)
+		_, err := txn.Get(k)
+		if err == badger.ErrKeyNotFound {
+			if n := countKeys(txn, in.Namespace); n >= kv.maxKeys {
+				st := status.Newf(codes.ResourceExhausted, "namespace %s already holds %d keys", in.Namespace, n)
+				return withDetails(st, &errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+					Subject:     "namespaces/" + in.Namespace,
+					Description: fmt.Sprintf("at most %d keys per namespace", kv.maxKeys),
+				}}}).Err()
+			}
+		} else if err != nil {
+			return err
+		}
+		return txn.Set(k, in.Value)
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.KeyValue{Namespace: in.Namespace, Key: in.Key, Value: in.Value}, nil
+}
+
+func (kv *kvStore) Get(ctx context.Context, in *pb.KeyRequest) (*pb.KeyValue, error) {
+	logf(ctx, "KeyValueStore.Get called for %s/%s", in.Namespace, in.Key)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &pb.KeyValue{Namespace: in.Namespace, Key: in.Key}
+	err = kv.s.view(ctx, tenant, func(txn *tenantTxn) error {
+		item, err := txn.Get(kvKey(in.Namespace, in.Key))
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "key %s not found in namespace %s", in.Key, in.Namespace)
+		}
+		if err != nil {
+			return err
+		}
+		e.Value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return e, nil
+}
+
+func (kv *kvStore) Delete(ctx context.Context, in *pb.KeyRequest) (*pb.Empty, error) {
+	logf(ctx, "KeyValueStore.Delete called for %s/%s", in.Namespace, in.Key)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = kv.s.update(ctx, tenant, func(txn *tenantTxn) error {
+		return txn.Delete(kvKey(in.Namespace, in.Key))
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (kv *kvStore) List(ctx context.Context, in *pb.ListKeysRequest) (*pb.KeyValues, error) {
+	logf(ctx, "KeyValueStore.List called for %s", in.Namespace)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The request rules have checked that the page token decodes.
+	after, _ := decodePageToken(in.PageToken)
+	limit := int(in.PageSize)
+	if limit == 0 || limit > maxKVListResults {
+		limit = maxKVListResults
+	}
+
+	out := &pb.KeyValues{}
+	err = kv.s.view(ctx, tenant, func(txn *tenantTxn) error {
+		ns := kvNamespaceKey(in.Namespace)
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = append(ns, in.Prefix...)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Seeking before the prefix would land on another namespace's keys.
+		it.Rewind()
+		if after > in.Prefix {
+			it.Seek(kvKey(in.Namespace, after))
+		}
+		for ; it.Valid(); it.Next() {
+			key := string(it.Key()[len(ns):])
+			if after != "" && key <= after {
+				continue
+			}
+			if len(out.Entries) == limit {
+				out.NextPageToken = encodePageToken(out.Entries[limit-1].Key)
+				return nil
+			}
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			out.Entries = append(out.Entries, &pb.KeyValue{Namespace: in.Namespace, Key: key, Value: value})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestKVQuotas(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		kv := &kvStore{s: &server{db: newDB(), events: newEventBus()}, maxKeys: 3, maxValueSize: 8}
+		ctx := context.Background()
+		put := func(ctx context.Context, namespace, key, value string) error {
+			_, err := kv.Put(ctx, &pb.KeyValue{Namespace: namespace, Key: key, Value: []byte(value)})
+			return err
+		}
+		for i := 0; i < 3; i++ {
+			if err := put(ctx, "sessions", fmt.Sprintf("s%d", i), "active"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name                  string
+			ctx                   context.Context
+			namespace, key, value string
+			want                  codes.Code
+		}{
+			{"new key past the quota", ctx, "sessions", "s3", "active", codes.ResourceExhausted},
+			{"overwrite at the quota", ctx, "sessions", "s0", "ended", codes.OK},
+			{"value too large", ctx, "sessions", "s0", "123456789", codes.InvalidArgument},
+			{"value at the limit", ctx, "sessions", "s0", "12345678", codes.OK},
+			// Quotas are per namespace and per tenant.
+			{"another namespace", ctx, "drafts", "d0", "x", codes.OK},
+			{"another tenant", tenantContext("other"), "sessions", "s3", "active", codes.OK},
+		}
+		for _, tt := range tests {
+			err := put(tt.ctx, tt.namespace, tt.key, tt.value)
+			if status.Code(err) != tt.want {
+				t.Errorf("%s: Put returned %v, want %v", tt.name, err, tt.want)
+			}
+			if tt.want != codes.ResourceExhausted {
+				continue
+			}
+			var quota *errdetails.QuotaFailure
+			for _, d := range status.Convert(err).Details() {
+				if d, ok := d.(*errdetails.QuotaFailure); ok {
+					quota = d
+				}
+			}
+			if quota == nil || len(quota.Violations) != 1 || quota.Violations[0].Subject != "namespaces/"+tt.namespace {
+				t.Errorf("%s: Put returned %v without a QuotaFailure for the namespace", tt.name, err)
+			}
+		}
+
+		// Deleting a key frees its place in the quota.
+		if _, err := kv.Delete(ctx, &pb.KeyRequest{Namespace: "sessions", Key: "s1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := put(ctx, "sessions", "s3", "active"); err != nil {
+			t.Errorf("Put after a Delete returned %v", err)
+		}
+		if err := put(ctx, "sessions", "s4", "active"); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Put past the quota again returned %v, want ResourceExhausted", err)
+		}
+		if _, err := kv.Get(ctx, &pb.KeyRequest{Namespace: "sessions", Key: "s1"}); status.Code(err) != codes.NotFound {
+			t.Errorf("Get of a deleted key returned %v, want NotFound", err)
+		}
+	})
+}
+
+func TestKVIsolation(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		kv := &kvStore{s: s, maxKeys: 10, maxValueSize: 64}
+		ctx := context.Background()
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra"})
+		for _, e := range []*pb.KeyValue{
+			{Namespace: "sessions", Key: "MATH101", Value: []byte("a")},
+			{Namespace: "sessions", Key: "v3/MATH101", Value: []byte("b")},
+			{Namespace: "sessions-old", Key: "x", Value: []byte("c")},
+		} {
+			if _, err := kv.Put(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Entries are neither classes nor in another namespace's listing.
+		cs, err := s.List(ctx, &pb.ListRequest{})
+		if err != nil || !equalIds(ids(cs.Classes), []string{"MATH101"}) || cs.Classes[0].Name != "Algebra" {
+			t.Errorf("List returned %v, %v; want only MATH101", cs, err)
+		}
+		kvs, err := kv.List(ctx, &pb.ListKeysRequest{Namespace: "sessions"})
+		if err != nil || len(kvs.Entries) != 2 || kvs.Entries[0].Key != "MATH101" || kvs.Entries[1].Key != "v3/MATH101" {
+			t.Errorf("List of sessions returned %v, %v", kvs, err)
+		}
+		if kvs, err := kv.List(tenantContext("other"), &pb.ListKeysRequest{Namespace: "sessions"}); err != nil || len(kvs.Entries) != 0 {
+			t.Errorf("another tenant's List of sessions returned %v, %v", kvs, err)
+		}
+	})
+}
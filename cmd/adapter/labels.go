@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+// Labels are indexed by key as idx/label/<key>/<id>, with the label value
+// as the entry's value, so a selector can start from the classes that
+// carry one of its keys. Keys may not contain "/".
+const labelIndexPrefix = indexPrefix + "label/"
+
+const maxLabels = 64
+
+// Label keys and non-empty values follow the Kubernetes name rules, less
+// the "/" prefix separator.
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]{0,61}[A-Za-z0-9])?$`)
+
+func labelIndexKey(key, id string) []byte {
+	return []byte(labelIndexPrefix + key + "/" + id)
+}
+
+// encodeLabels stores labels as a JSON object, whose keys encoding/json
+// sorts, so the same labels always store the same value.
+func encodeLabels(labels map[string]string) (string, error) {
+	b, err := json.Marshal(labels)
+	return string(b), err
+}
+
+func decodeLabels(v string) (map[string]string, error) {
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(v), &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// indexLabels replaces the label index entries of the class with the given
+// Id, whose stored Labels field was old, with entries for labels.
+func indexLabels(txn *tenantTxn, id, old string, labels map[string]string) error {
+	if old != "" {
+		prev, err := decodeLabels(old)
+		if err != nil {
+			return fmt.Errorf("parse labels of %s: %w", id, err)
+		}
+		for k := range prev {
+			if _, ok := labels[k]; ok {
+				continue
+			}
+			if err := txn.Delete(labelIndexKey(k, id)); err != nil {
+				return fmt.Errorf("delete label index for %s: %w", id, err)
+			}
+		}
+	}
+	for k, v := range labels {
+		if err := txn.Set(labelIndexKey(k, id), []byte(v)); err != nil {
+			return fmt.Errorf("put label index for %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (v *violations) checkLabels(labels map[string]string) {
+	if len(labels) > maxLabels {
+		v.add("labels", "must have at most %d labels", maxLabels)
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !labelPattern.MatchString(k) {
+			v.add("labels", "key %q must match %s", k, labelPattern)
+		}
+		if val := labels[k]; val != "" && !labelPattern.MatchString(val) {
+			v.add("labels", "value %q of %s must be empty or match %s", val, k, labelPattern)
+		}
+	}
+}
+
+type labelOp int
+
+const (
+	labelEquals labelOp = iota
+	labelNotEquals
+	labelIn
+	labelNotIn
+	labelExists
+	labelNotExists
+)
+
+// labelRequirement is one comma-separated term of a label selector.
+type labelRequirement struct {
+	key    string
+	op     labelOp
+	values []string
+}
+
+func (r labelRequirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+	switch r.op {
+	case labelEquals, labelIn:
+		return ok && containsString(r.values, v)
+	case labelNotEquals, labelNotIn:
+		return !ok || !containsString(r.values, v)
+	case labelExists:
+		return ok
+	default:
+		return !ok
+	}
+}
+
+// indexed reports whether every class the requirement matches has its key,
+// so the label index can supply the candidates.
+func (r labelRequirement) indexed() bool {
+	return r.op == labelEquals || r.op == labelIn || r.op == labelExists
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type labelSelector []labelRequirement
+
+func (sel labelSelector) matches(labels map[string]string) bool {
+	for _, r := range sel {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	labelSetPattern  = regexp.MustCompile(`^([^\s!=()]+)\s+(in|notin)\s*\(([^()]*)\)$`)
+	labelCmpPattern  = regexp.MustCompile(`^([^\s!=()]+)\s*(==|=|!=)\s*([^\s!=()]*)$`)
+	labelNamePattern = regexp.MustCompile(`^(!?)\s*([^\s!=()]+)$`)
+)
+
+// parseLabelSelector parses a Kubernetes-style equality- and set-based
+// selector, such as "subject=math,level in (ap,honors),!retired".
+func parseLabelSelector(s string) (labelSelector, error) {
+	var sel labelSelector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, term := range splitSelector(s) {
+		term = strings.TrimSpace(term)
+		var r labelRequirement
+		if m := labelSetPattern.FindStringSubmatch(term); m != nil {
+			r = labelRequirement{key: m[1], op: labelIn}
+			if m[2] == "notin" {
+				r.op = labelNotIn
+			}
+			for _, v := range strings.Split(m[3], ",") {
+				r.values = append(r.values, strings.TrimSpace(v))
+			}
+		} else if m := labelCmpPattern.FindStringSubmatch(term); m != nil {
+			r = labelRequirement{key: m[1], op: labelEquals, values: []string{m[3]}}
+			if m[2] == "!=" {
+				r.op = labelNotEquals
+			}
+		} else if m := labelNamePattern.FindStringSubmatch(term); m != nil {
+			r = labelRequirement{key: m[2], op: labelExists}
+			if m[1] == "!" {
+				r.op = labelNotExists
+			}
+		} else {
+			return nil, fmt.Errorf("can't parse requirement %q", term)
+		}
+		if !labelPattern.MatchString(r.key) {
+			return nil, fmt.Errorf("key %q must match %s", r.key, labelPattern)
+		}
+		for _, v := range r.values {
+			if v != "" && !labelPattern.MatchString(v) {
+				return nil, fmt.Errorf("value %q must be empty or match %s", v, labelPattern)
+			}
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// splitSelector splits s at the commas that aren't inside a value list.
+func splitSelector(s string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+// selectClasses reads the classes matching sel in ascending Id order. When
+// a requirement names a key every match must carry, only the classes in
+// that key's index are read.
+func selectClasses(txn *tenantTxn, sel labelSelector) ([]*pb.Class, error) {
+	var candidates []*pb.Class
+	var err error
+	indexed := false
+	for _, r := range sel {
+		if r.indexed() {
+			candidates, err = listLabeled(txn, r.key)
+			indexed = true
+			break
+		}
+	}
+	if !indexed {
+		candidates, err = listClasses(txn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	classes := make([]*pb.Class, 0)
+	for _, c := range candidates {
+		if sel.matches(c.Labels) {
+			classes = append(classes, c)
+		}
+	}
+	return classes, nil
+}
+
+// listLabeled reads the classes that have a label with the given key, in
+// ascending Id order since each index key ends with the Id.
+func listLabeled(txn *tenantTxn, key string) ([]*pb.Class, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = labelIndexKey(key, "")
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	classes := make([]*pb.Class, 0)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return classes, err
+		}
+		id := string(it.Key()[len(opts.Prefix):])
+		c, err := getClass(txn, id)
+		if isCorrupt(err) || err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return classes, fmt.Errorf("read %s: %w", id, err)
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
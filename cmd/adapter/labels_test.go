@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestLabelSelector(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		for _, c := range []*pb.Class{
+			{Id: "BIO101", Semester: "2024-FALL"},
+			{Id: "MATH101", Semester: "2024-FALL", Labels: map[string]string{"subject": "math", "level": "intro"}},
+			{Id: "MATH301", Semester: "2024-FALL", Labels: map[string]string{"subject": "math", "level": "ap"}},
+			{Id: "PHYS301", Semester: "2024-FALL", Labels: map[string]string{"subject": "physics", "level": "ap", "lab": ""}},
+		} {
+			if _, err := s.Create(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			selector string
+			want     []string
+		}{
+			{"subject=math", []string{"MATH101", "MATH301"}},
+			{"subject=math,level=ap", []string{"MATH301"}},
+			{"subject==math, level != ap", []string{"MATH101"}},
+			{"level in (ap, intro),subject notin (physics)", []string{"MATH101", "MATH301"}},
+			{"lab", []string{"PHYS301"}},
+			{"!subject", []string{"BIO101"}},
+			{"level!=ap", []string{"BIO101", "MATH101"}},
+		}
+		for _, tt := range tests {
+			cs, err := s.List(ctx, &pb.ListRequest{LabelSelector: tt.selector})
+			if err != nil {
+				t.Errorf("List(%q): %v", tt.selector, err)
+				continue
+			}
+			if got := ids(cs.Classes); !equalIds(got, tt.want) || cs.TotalSize != int64(len(tt.want)) {
+				t.Errorf("List(%q) returned %v (total %d), want %v", tt.selector, got, cs.TotalSize, tt.want)
+			}
+		}
+
+		// Changing and deleting labels keeps the index in step.
+		_, err := s.Update(ctx, &pb.Class{
+			Id:         "MATH301",
+			Labels:     map[string]string{"subject": "physics"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "PHYS301"}); err != nil {
+			t.Fatal(err)
+		}
+		cs, err := s.List(ctx, &pb.ListRequest{LabelSelector: "subject=physics"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(cs.Classes); !equalIds(got, []string{"MATH301"}) {
+			t.Errorf("List after relabeling returned %v, want [MATH301]", got)
+		}
+
+		for _, sel := range []string{"subject in math", "a/b=c", "=math", "level=(ap)"} {
+			if err := validateRequest("/class.Adapter/List", &pb.ListRequest{LabelSelector: sel}); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("List(%q) returned %v, want InvalidArgument", sel, err)
+			}
+		}
+		if err := validateRequest("/class.Adapter/Create", &pb.Class{Id: "ART100", Labels: map[string]string{"bad key": "x"}}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Create with an invalid label key returned %v, want InvalidArgument", err)
+		}
+	})
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// leaseAddressAnnotation records the leader's gRPC address on its Lease, so
+// standbys know where to send calls.
+const leaseAddressAnnotation = "class-adapter/address"
+
+// Where Kubernetes mounts a pod's service account credentials.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// errLeaseConflict means another replica changed the Lease since it was read.
+var errLeaseConflict = errors.New("lease was changed by another replica")
+
+// lease is the part of a coordination.k8s.io/v1 Lease leader election uses.
+type lease struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace,omitempty"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int32  `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int32  `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// Lease times are MicroTime, RFC 3339 with microseconds.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// expired reports whether the holder let l lapse by now.
+func (l *lease) expired(now time.Time) bool {
+	renewed, err := time.Parse(microTime, l.Spec.RenewTime)
+	if err != nil {
+		// Fall back to RFC 3339 without microseconds, as kubectl writes it.
+		if renewed, err = time.Parse(time.RFC3339, l.Spec.RenewTime); err != nil {
+			return true
+		}
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// leaseStore reads and writes one Lease. get returns nil if it doesn't
+// exist; create and update fail with errLeaseConflict if another replica got
+// there first.
+type leaseStore interface {
+	get(ctx context.Context) (*lease, error)
+	create(ctx context.Context, l *lease) error
+	update(ctx context.Context, l *lease) error
+}
+
+// kubeLeases keeps a Lease through the Kubernetes API, with the pod's
+// service account.
+type kubeLeases struct {
+	client *http.Client
+	url    string
+	// tokenFile holds the service account token. It's read for every
+	// request, as the kubelet rotates projected tokens in place.
+	tokenFile string
+	namespace string
+	name      string
+}
+
+// newKubeLeases talks to the API server of the cluster the adapter runs in.
+// namespace defaults to the pod's own.
+func newKubeLeases(namespace, name string) (*kubeLeases, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are unset")
+	}
+	if _, err := ioutil.ReadFile(serviceAccountDir + "/token"); err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s/ca.crt", serviceAccountDir)
+	}
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	return &kubeLeases{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		url:       "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountDir + "/token",
+		namespace: namespace,
+		name:      name,
+	}, nil
+}
+
+func (k *kubeLeases) do(ctx context.Context, method, url string, in, out interface{}) (int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return 0, err
+		}
+	}
+	token, err := ioutil.ReadFile(k.tokenFile)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict:
+		return resp.StatusCode, nil
+	case resp.StatusCode/100 != 2:
+		return resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, bytes.TrimSpace(b))
+	}
+	if out != nil {
+		return resp.StatusCode, json.Unmarshal(b, out)
+	}
+	return resp.StatusCode, nil
+}
+
+func (k *kubeLeases) collection() string {
+	return fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", k.url, k.namespace)
+}
+
+func (k *kubeLeases) get(ctx context.Context) (*lease, error) {
+	l := &lease{}
+	code, err := k.do(ctx, http.MethodGet, k.collection()+"/"+k.name, nil, l)
+	if err != nil || code == http.StatusNotFound {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (k *kubeLeases) create(ctx context.Context, l *lease) error {
+	l.Metadata.Name, l.Metadata.Namespace = k.name, k.namespace
+	code, err := k.do(ctx, http.MethodPost, k.collection(), l, nil)
+	if err == nil && code == http.StatusConflict {
+		return errLeaseConflict
+	}
+	return err
+}
+
+func (k *kubeLeases) update(ctx context.Context, l *lease) error {
+	code, err := k.do(ctx, http.MethodPut, k.collection()+"/"+k.name, l, nil)
+	if err == nil && code == http.StatusConflict {
+		return errLeaseConflict
+	}
+	return err
+}
+
+// leaderElector contends for a Lease with the other replicas of an
+// active/standby deployment. The holder is the only replica that opens the
+// data directory; the others proxy to it.
+type leaderElector struct {
+	store    leaseStore
+	identity string
+	// The holder's gRPC address, as the other replicas can dial it.
+	address  string
+	duration time.Duration
+	now      func() time.Time
+}
+
+func newLeaderElector(store leaseStore, identity, address string, duration time.Duration) *leaderElector {
+	return &leaderElector{store: store, identity: identity, address: address, duration: duration, now: time.Now}
+}
+
+// tryAcquire takes or renews the Lease if it is free, lapsed or already
+// ours, and otherwise returns the leader's address.
+func (e *leaderElector) tryAcquire(ctx context.Context) (leader bool, leaderAddr string, err error) {
+	now := e.now()
+	l, err := e.store.get(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	if l == nil {
+		l = &lease{}
+		e.claim(l, now)
+		if err := e.store.create(ctx, l); err == errLeaseConflict {
+			return false, "", nil
+		} else if err != nil {
+			return false, "", err
+		}
+		return true, e.address, nil
+	}
+	if l.Spec.HolderIdentity != e.identity && l.Spec.HolderIdentity != "" && !l.expired(now) {
+		return false, l.Metadata.Annotations[leaseAddressAnnotation], nil
+	}
+	e.claim(l, now)
+	if err := e.store.update(ctx, l); err == errLeaseConflict {
+		return false, "", nil
+	} else if err != nil {
+		return false, "", err
+	}
+	return true, e.address, nil
+}
+
+// claim makes l ours as of now, counting a transition if it was another's.
+func (e *leaderElector) claim(l *lease, now time.Time) {
+	if l.Spec.HolderIdentity != e.identity {
+		if l.Spec.HolderIdentity != "" {
+			l.Spec.LeaseTransitions++
+		}
+		l.Spec.HolderIdentity = e.identity
+		l.Spec.AcquireTime = now.UTC().Format(microTime)
+	}
+	l.Spec.RenewTime = now.UTC().Format(microTime)
+	l.Spec.LeaseDurationSeconds = int32((e.duration + time.Second - 1) / time.Second)
+	if l.Metadata.Annotations == nil {
+		l.Metadata.Annotations = make(map[string]string)
+	}
+	l.Metadata.Annotations[leaseAddressAnnotation] = e.address
+}
+
+// awaitLeadership returns once this replica holds the Lease, or with the
+// leader's address if another replica does. It keeps trying while the Lease
+// is changing hands or the API server can't be reached.
+func (e *leaderElector) awaitLeadership(ctx context.Context) (leader bool, leaderAddr string) {
+	for {
+		leader, addr, err := e.tryAcquire(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Leader election failed, retrying: %v", err)
+		case leader || addr != "":
+			return leader, addr
+		}
+		select {
+		case <-ctx.Done():
+			return false, ""
+		case <-time.After(e.duration / 4):
+		}
+	}
+}
+
+// renew keeps the Lease until ctx ends, and calls lost if it can't renew it
+// before it lapses or another replica takes it.
+func (e *leaderElector) renew(ctx context.Context, lost func()) {
+	lastRenewed := e.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.duration / 3):
+		}
+		leader, _, err := e.tryAcquire(ctx)
+		switch {
+		case err == nil && leader:
+			lastRenewed = e.now()
+			continue
+		case err == nil:
+			log.Printf("Lease was taken by another replica")
+		case e.now().Sub(lastRenewed) < e.duration:
+			log.Printf("Lease renewal failed, retrying: %v", err)
+			continue
+		default:
+			log.Printf("Lease renewal failed past its %s duration: %v", e.duration, err)
+		}
+		lost()
+		return
+	}
+}
+
+// watchLeader polls the Lease while this replica stands by, proxying to the
+// leader at proxying. It calls changed once this replica takes the Lease,
+// e.g. after the leader failed to renew it, or another replica leads at a
+// different address.
+func (e *leaderElector) watchLeader(ctx context.Context, proxying string, changed func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.duration / 4):
+		}
+		leader, addr, err := e.tryAcquire(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Leader election failed, retrying: %v", err)
+		case leader:
+			log.Printf("Took over the lease from the leader at %s", proxying)
+			changed()
+			return
+		case addr != "" && addr != proxying:
+			log.Printf("The leader moved from %s to %s", proxying, addr)
+			changed()
+			return
+		}
+	}
+}
+
+// restartSelf replaces the process with a fresh run of the same command,
+// which then starts as leader or proxies to the new one.
+func restartSelf() {
+	exe, err := os.Executable()
+	if err == nil {
+		err = syscall.Exec(exe, os.Args, os.Environ())
+	}
+	log.Fatalf("failed to restart: %v", err)
+}
+
+// defaultLeaderAddress is where other replicas dial this one when it leads:
+// the pod IP Kubernetes exposes as POD_IP through the downward API, or the
+// hostname, at the port of listen.
+func defaultLeaderAddress(listen string) string {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	host := os.Getenv("POD_IP")
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLeases keeps a Lease in memory, checking resource versions as the API
+// server does.
+type memLeases struct {
+	mu      sync.Mutex
+	l       *lease
+	version int
+}
+
+func (m *memLeases) get(ctx context.Context) (*lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.l == nil {
+		return nil, nil
+	}
+	var l lease
+	b, _ := json.Marshal(m.l)
+	json.Unmarshal(b, &l)
+	return &l, nil
+}
+
+func (m *memLeases) create(ctx context.Context, l *lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.l != nil {
+		return errLeaseConflict
+	}
+	return m.store(l)
+}
+
+func (m *memLeases) update(ctx context.Context, l *lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.l == nil || m.l.Metadata.ResourceVersion != l.Metadata.ResourceVersion {
+		return errLeaseConflict
+	}
+	return m.store(l)
+}
+
+func (m *memLeases) store(l *lease) error {
+	m.version++
+	var stored lease
+	b, _ := json.Marshal(l)
+	json.Unmarshal(b, &stored)
+	stored.Metadata.ResourceVersion = strconv.Itoa(m.version)
+	m.l = &stored
+	return nil
+}
+
+func TestLeaderElection(t *testing.T) {
+	ctx := context.Background()
+	store := &memLeases{}
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	a := newLeaderElector(store, "a", "10.0.0.1:50051", 15*time.Second)
+	b := newLeaderElector(store, "b", "10.0.0.2:50051", 15*time.Second)
+	a.now, b.now = clock, clock
+
+	if leader, addr, err := a.tryAcquire(ctx); err != nil || !leader || addr != a.address {
+		t.Fatalf("a got %v, %q, %v for a free lease, want to lead", leader, addr, err)
+	}
+	if leader, addr, err := b.tryAcquire(ctx); err != nil || leader || addr != a.address {
+		t.Fatalf("b got %v, %q, %v while a leads, want a's address", leader, addr, err)
+	}
+
+	// a renews within the duration and keeps the lease.
+	now = now.Add(10 * time.Second)
+	if leader, _, err := a.tryAcquire(ctx); err != nil || !leader {
+		t.Fatalf("a failed to renew: %v, %v", leader, err)
+	}
+	now = now.Add(10 * time.Second)
+	if leader, _, _ := b.tryAcquire(ctx); leader {
+		t.Fatal("b took a lease a renewed")
+	}
+
+	// Once a stops renewing, b takes over.
+	now = now.Add(16 * time.Second)
+	if leader, addr, err := b.tryAcquire(ctx); err != nil || !leader || addr != b.address {
+		t.Fatalf("b got %v, %q, %v for a lapsed lease, want to lead", leader, addr, err)
+	}
+	if leader, addr, _ := a.tryAcquire(ctx); leader || addr != b.address {
+		t.Fatalf("a got %v, %q after b took over, want b's address", leader, addr)
+	}
+	l, _ := store.get(ctx)
+	if l.Spec.HolderIdentity != "b" || l.Spec.LeaseTransitions != 1 || l.Spec.LeaseDurationSeconds != 15 {
+		t.Errorf("lease after the takeover is %+v", l.Spec)
+	}
+}
+
+func TestLeaderElectionConflict(t *testing.T) {
+	ctx := context.Background()
+	store := &memLeases{}
+	e := newLeaderElector(store, "a", "10.0.0.1:50051", 15*time.Second)
+	e.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	e.tryAcquire(ctx)
+
+	// Another replica writes the lapsed lease between our read and update.
+	racing := &racingLeases{memLeases: store}
+	b := newLeaderElector(racing, "b", "10.0.0.2:50051", 15*time.Second)
+	if leader, _, err := b.tryAcquire(ctx); err != nil || leader {
+		t.Errorf("b got %v, %v when losing the race, want to stand by", leader, err)
+	}
+}
+
+// racingLeases changes the Lease behind every update.
+type racingLeases struct {
+	*memLeases
+}
+
+func (r *racingLeases) update(ctx context.Context, l *lease) error {
+	r.mu.Lock()
+	r.l.Metadata.ResourceVersion = "raced"
+	r.mu.Unlock()
+	return r.memLeases.update(ctx, l)
+}
+
+func TestLeaderRenewNoticesTakeover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := &memLeases{}
+	a := newLeaderElector(store, "a", "10.0.0.1:50051", 30*time.Millisecond)
+	if leader, _ := a.awaitLeadership(ctx); !leader {
+		t.Fatal("a didn't lead a free lease")
+	}
+
+	// b takes the lease as if a's had lapsed.
+	l, _ := store.get(ctx)
+	l.Spec.HolderIdentity = "b"
+	l.Spec.RenewTime = time.Now().Add(time.Hour).UTC().Format(microTime)
+	store.update(ctx, l)
+
+	lost := make(chan struct{})
+	go a.renew(ctx, func() { close(lost) })
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("renew didn't notice b took the lease")
+	}
+}
+
+func TestKubeLeases(t *testing.T) {
+	var mu sync.Mutex
+	var stored []byte
+	version := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		const path = "/apis/coordination.k8s.io/v1/namespaces/school/leases"
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == path+"/adapter":
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(stored)
+		case r.Method == http.MethodPost && r.URL.Path == path:
+			if stored != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			var l lease
+			json.NewDecoder(r.Body).Decode(&l)
+			version++
+			l.Metadata.ResourceVersion = strconv.Itoa(version)
+			stored, _ = json.Marshal(l)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && r.URL.Path == path+"/adapter":
+			var l lease
+			json.NewDecoder(r.Body).Decode(&l)
+			if l.Metadata.ResourceVersion != strconv.Itoa(version) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			version++
+			l.Metadata.ResourceVersion = strconv.Itoa(version)
+			stored, _ = json.Marshal(l)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	k := &kubeLeases{client: ts.Client(), url: ts.URL, tokenFile: tokenFile, namespace: "school", name: "adapter"}
+
+	ctx := context.Background()
+	if l, err := k.get(ctx); err != nil || l != nil {
+		t.Fatalf("get of a missing lease got %v, %v", l, err)
+	}
+	e := newLeaderElector(k, "a", "10.0.0.1:50051", 15*time.Second)
+	if leader, _, err := e.tryAcquire(ctx); err != nil || !leader {
+		t.Fatalf("creating the lease got %v, %v", leader, err)
+	}
+	if err := k.create(ctx, &lease{}); err != errLeaseConflict {
+		t.Errorf("creating an existing lease got %v, want errLeaseConflict", err)
+	}
+	if leader, _, err := e.tryAcquire(ctx); err != nil || !leader {
+		t.Fatalf("renewing the lease got %v, %v", leader, err)
+	}
+	// The stored lease is now at version 2, so a stale update conflicts.
+	stale := &lease{}
+	stale.Metadata.ResourceVersion = "1"
+	if err := k.update(ctx, stale); err != errLeaseConflict {
+		t.Errorf("a stale update got %v, want errLeaseConflict", err)
+	}
+	l, err := k.get(ctx)
+	if err != nil || l.Metadata.Annotations[leaseAddressAnnotation] != "10.0.0.1:50051" {
+		t.Errorf("get got %+v, %v, want the leader's address", l, err)
+	}
+
+	// A rotated token is used from the next request on.
+	if err := ioutil.WriteFile(tokenFile, []byte("wrong"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.get(ctx); err == nil {
+		t.Error("get with a rejected token succeeded")
+	}
+	if err := ioutil.WriteFile(tokenFile, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.get(ctx); err != nil {
+		t.Errorf("get after the token was rotated back got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	leasePrefix     = "lease/"
+	defaultLeaseTTL = 5 * time.Minute
+	maxLeaseTTL     = time.Hour
+	maxHolderLength = 128
+)
+
+func leaseKey(id string) []byte {
+	return []byte(leasePrefix + id)
+}
+
+// getLease returns the live lease on id, or nil if nobody holds one.
+func getLease(txn *tenantTxn, id string) (*pb.EditLease, error) {
+	item, err := txn.Get(leaseKey(id))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := &pb.EditLease{}
+	err = item.Value(func(val []byte) error {
+		return proto.Unmarshal(val, l)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read lease for %s: %w", id, err)
+	}
+	// Badger expires keys with second granularity, so double check.
+	if !l.ExpireTime.AsTime().After(time.Now()) {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// checkEditLease fails with FailedPrecondition when someone other than the
+// holder of token is editing the class.
+func checkEditLease(txn *tenantTxn, id, token string) error {
+	l, err := getLease(txn, id)
+	if err != nil {
+		return err
+	}
+	if l != nil && l.Token != token {
+		return leaseHeldError(l)
+	}
+	return nil
+}
+
+func leaseHeldError(l *pb.EditLease) error {
+	return preconditionFailed(preconditionLease, "classes/"+l.Id, "class %s is being edited by %s until %s",
+		l.Id, l.Holder, l.ExpireTime.AsTime().Format(time.RFC3339))
+}
+
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (v *violations) checkAcquireEditLease(in *pb.AcquireEditLeaseRequest) {
+	v.checkId(in.Id)
+	if in.Holder == "" {
+		v.add("holder", "must not be empty")
+	} else if len(in.Holder) > maxHolderLength {
+		v.add("holder", "must be at most %d characters", maxHolderLength)
+	}
+	if ttl := time.Duration(in.TtlSeconds) * time.Second; ttl < 0 || ttl > maxLeaseTTL {
+		v.add("ttl_seconds", "must be between 1 and %d", int(maxLeaseTTL.Seconds()))
+	}
+}
+
+func (s *server) AcquireEditLease(ctx context.Context, in *pb.AcquireEditLeaseRequest) (*pb.EditLease, error) {
+	logf(ctx, "AcquireEditLease called for Id %s by %s", in.Id, in.Holder)
+	ttl := time.Duration(in.TtlSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultLeaseTTL
+	}
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var lease *pb.EditLease
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		if ok, err := classExists(txn, in.Id); err != nil {
+			return err
+		} else if !ok {
+			return status.Errorf(codes.NotFound, "class %s not found", in.Id)
+		}
+
+		l, err := getLease(txn, in.Id)
+		if err != nil {
+			return err
+		}
+		// Only the caller holding a live lease's token may renew it, so
+		// nobody learns the token by acquiring the lease under its holder's
+		// name.
+		if l != nil && l.Token != in.Token {
+			return leaseHeldError(l)
+		}
+		if l == nil {
+			token, err := newLeaseToken()
+			if err != nil {
+				return err
+			}
+			l = &pb.EditLease{
+				Id:     in.Id,
+				Holder: in.Holder,
+				Token:  token,
+			}
+		}
+		l.ExpireTime = timestamppb.New(time.Now().Add(ttl))
+
+		b, err := proto.Marshal(l)
+		if err != nil {
+			return err
+		}
+		if err := txn.SetEntry(badger.NewEntry(leaseKey(in.Id), b).WithTTL(ttl)); err != nil {
+			return fmt.Errorf("put lease for %s: %w", in.Id, err)
+		}
+		lease = l
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return lease, nil
+}
+
+func (s *server) ReleaseEditLease(ctx context.Context, in *pb.ReleaseEditLeaseRequest) (*pb.Empty, error) {
+	logf(ctx, "ReleaseEditLease called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		l, err := getLease(txn, in.Id)
+		if err != nil || l == nil {
+			return err
+		}
+		if l.Token != in.Token {
+			return leaseHeldError(l)
+		}
+		return txn.Delete(leaseKey(in.Id))
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.Empty{}, nil
+}
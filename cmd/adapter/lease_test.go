@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEditLeaseGuardsWrites(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		cs := &classesV2{s: s}
+		ctx := context.Background()
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra"}, &pb.Class{Id: "MATH102", Name: "Geometry"})
+		lease, err := s.AcquireEditLease(ctx, &pb.AcquireEditLeaseRequest{Id: "MATH101", Holder: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every write that would replace or remove the class needs the
+		// lease's token, as Update does.
+		writes := []struct {
+			name string
+			call func() error
+		}{
+			{"Create", func() error {
+				_, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Calculus"})
+				return err
+			}},
+			{"Delete", func() error {
+				_, err := s.Delete(ctx, &pb.Class{Id: "MATH101"})
+				return err
+			}},
+			{"DeleteClass", func() error {
+				_, err := cs.DeleteClass(ctx, &adapterv2.DeleteClassRequest{Name: "classes/MATH101"})
+				return err
+			}},
+			{"Transact create", func() error {
+				_, err := s.Transact(ctx, &pb.TransactRequest{Ops: []*pb.TransactOp{{Op: &pb.TransactOp_Create{Create: &pb.Class{Id: "MATH101", Name: "Calculus"}}}}})
+				return err
+			}},
+			{"Transact delete", func() error {
+				_, err := s.Transact(ctx, &pb.TransactRequest{Ops: []*pb.TransactOp{{Op: &pb.TransactOp_Delete{Delete: &pb.Class{Id: "MATH101"}}}}})
+				return err
+			}},
+			{"BatchDelete", func() error {
+				_, err := s.BatchDelete(ctx, &pb.DeleteFilter{Ids: []string{"MATH101", "MATH102"}})
+				return err
+			}},
+		}
+		for _, w := range writes {
+			if err := w.call(); status.Code(err) != codes.FailedPrecondition || preconditionType(err) != preconditionLease {
+				t.Errorf("%s of a leased class returned %v, want FailedPrecondition of type %s", w.name, err, preconditionLease)
+			}
+		}
+		got, err := s.List(ctx, &pb.ListRequest{})
+		if err != nil || !equalIds(ids(got.Classes), []string{"MATH101", "MATH102"}) || got.Classes[0].Name != "Algebra" {
+			t.Errorf("after the refused writes, List returned %v, %v", got, err)
+		}
+
+		// The holder may replace the class, and delete it.
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Calculus", LeaseToken: lease.Token}); err != nil {
+			t.Errorf("Create with the lease's token returned %v", err)
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101", LeaseToken: lease.Token}); err != nil {
+			t.Errorf("Delete with the lease's token returned %v", err)
+		}
+
+		// A class created again with the Id doesn't inherit the lease.
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Statistics"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Statistics I"}); err != nil {
+			t.Errorf("Update of a class recreated after its deletion returned %v", err)
+		}
+		if _, err := s.AcquireEditLease(ctx, &pb.AcquireEditLeaseRequest{Id: "MATH101", Holder: "bob"}); err != nil {
+			t.Errorf("AcquireEditLease of a recreated class returned %v", err)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/status"
+)
+
+// legacyFields maps the column and property names the flat-file adapter
+// used, normalized by legacyFieldName, to Class fields.
+var legacyFields = map[string]string{
+	"id":          "id",
+	"classid":     "id",
+	"code":        "id",
+	"coursecode":  "id",
+	"name":        "name",
+	"classname":   "name",
+	"title":       "name",
+	"semester":    "semester",
+	"term":        "semester",
+	"instructor":  "instructor_name",
+	"teacher":     "instructor_name",
+	"capacity":    "capacity",
+	"maxsize":     "capacity",
+	"description": "description",
+}
+
+// legacyFieldName lowercases name and drops separators, so "Class_ID",
+// "class-id" and "ClassId" all match.
+func legacyFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '_', '-', ' ':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// legacySemesterPattern matches the free-form terms found in flat files,
+// such as "Fall 2024", "2024 fall" and "FALL-2024".
+var legacySemesterPattern = regexp.MustCompile(`(?i)^\s*(?:(\d{4})[\s_-]*(spring|summer|fall|winter)|(spring|summer|fall|winter)[\s_-]*(\d{4}))\s*$`)
+
+// normalizeSemester rewrites a legacy term as YYYY-TERM, leaving values it
+// doesn't recognize for validation to reject.
+func normalizeSemester(v string) string {
+	m := legacySemesterPattern.FindStringSubmatch(v)
+	switch {
+	case m == nil:
+		return v
+	case m[1] != "":
+		return m[1] + "-" + strings.ToUpper(m[2])
+	default:
+		return m[4] + "-" + strings.ToUpper(m[3])
+	}
+}
+
+// legacyReport sums up what an import-legacy run found.
+type legacyReport struct {
+	records int
+	skipped []string
+	// Unmapped field names, with how many records had them.
+	unmapped map[string]int
+}
+
+func (r *legacyReport) skip(format string, a ...interface{}) {
+	r.skipped = append(r.skipped, fmt.Sprintf(format, a...))
+}
+
+// legacyClass maps one record, keyed by the legacy field names, onto a
+// class.
+func (r *legacyReport) legacyClass(where string, rec map[string]string) *pb.Class {
+	r.records++
+	c := &pb.Class{}
+	for k, v := range rec {
+		switch legacyFields[legacyFieldName(k)] {
+		case "id":
+			c.Id = strings.TrimSpace(v)
+		case "name":
+			c.Name = strings.TrimSpace(v)
+		case "semester":
+			c.Semester = normalizeSemester(strings.TrimSpace(v))
+		case "instructor_name":
+			c.InstructorName = strings.TrimSpace(v)
+		case "capacity":
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				r.skip("%s: capacity %q is not a number", where, v)
+				return nil
+			}
+			c.Capacity = int32(n)
+		case "description":
+			c.Description = strings.TrimSpace(v)
+		default:
+			r.unmapped[k]++
+		}
+	}
+	if err := validateClass(c); err != nil {
+		r.skip("%s: %s", where, status.Convert(err).Message())
+		return nil
+	}
+	return c
+}
+
+// readLegacyFile reads the classes of a flat-file export: a CSV file with
+// a header row, a JSON array of objects, a JSON object of objects keyed by
+// Id, or one JSON object per line.
+func (r *legacyReport) readLegacyFile(path string) ([]*pb.Class, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var recs []map[string]string
+	var where func(i int) string
+	switch {
+	case strings.EqualFold(filepath.Ext(path), ".csv"):
+		recs, err = readLegacyCSV(b)
+		// Data starts on the line after the header.
+		where = func(i int) string { return fmt.Sprintf("%s:%d", path, i+2) }
+	default:
+		recs, err = readLegacyJSON(b)
+		where = func(i int) string { return fmt.Sprintf("%s record %d", path, i+1) }
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var classes []*pb.Class
+	for i, rec := range recs {
+		if c := r.legacyClass(where(i), rec); c != nil {
+			classes = append(classes, c)
+		}
+	}
+	return classes, nil
+}
+
+func readLegacyCSV(b []byte) ([]map[string]string, error) {
+	cr := csv.NewReader(bytes.NewReader(b))
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	var recs []map[string]string
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := make(map[string]string, len(header))
+		for i, v := range row {
+			if v != "" {
+				rec[header[i]] = v
+			}
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func readLegacyJSON(b []byte) ([]map[string]string, error) {
+	trimmed := bytes.TrimSpace(b)
+	var raw []map[string]interface{}
+	switch {
+	case len(trimmed) == 0:
+	case trimmed[0] == '[':
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, err
+		}
+	default:
+		// Either one object keyed by Id, or one object per line.
+		var byId map[string]map[string]interface{}
+		if err := json.Unmarshal(trimmed, &byId); err == nil {
+			ids := make([]string, 0, len(byId))
+			for id := range byId {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				rec := byId[id]
+				if _, ok := rec["id"]; !ok {
+					rec["id"] = id
+				}
+				raw = append(raw, rec)
+			}
+			break
+		}
+		sc := bufio.NewScanner(bytes.NewReader(trimmed))
+		sc.Buffer(nil, 1<<20)
+		for line := 1; sc.Scan(); line++ {
+			if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+				continue
+			}
+			var rec map[string]interface{}
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			raw = append(raw, rec)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	recs := make([]map[string]string, len(raw))
+	for i, r := range raw {
+		recs[i] = make(map[string]string, len(r))
+		for k, v := range r {
+			if s, ok := v.(string); ok {
+				recs[i][k] = s
+			} else if v != nil {
+				recs[i][k] = fmt.Sprint(v)
+			}
+		}
+	}
+	return recs, nil
+}
+
+func runImportLegacy(args []string) {
+	fs := flag.NewFlagSet("import-legacy", flag.ExitOnError)
+	addr := fs.String("addr", "", "address of a running adapter to create the classes through")
+	dataDir := fs.String("data-dir", "", "data directory to write the classes into directly (the adapter must not be running)")
+	tenant := fs.String("tenant", defaultTenant, "tenant to create the classes for")
+	storageDriver := fs.String("storage-driver", driverBadger, "storage driver the -data-dir is kept with: badger or file")
+	encryptionKeyFile := fs.String("encryption-key-file", "", "file holding the key the -data-dir is encrypted with, if it is")
+	dryRun := fs.Bool("dry-run", false, "only read the files and report what would be imported")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: adapter import-legacy [flags] file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || (!*dryRun && (*addr == "") == (*dataDir == "")) {
+		fmt.Fprintln(os.Stderr, "import-legacy: name the files, and exactly one of -addr or -data-dir unless -dry-run")
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !tenantPattern.MatchString(*tenant) {
+		fmt.Fprintf(os.Stderr, "import-legacy: -tenant must match %s\n", tenantPattern)
+		os.Exit(2)
+	}
+
+	report := &legacyReport{unmapped: make(map[string]int)}
+	byId := make(map[string]*pb.Class)
+	var ids []string
+	for _, path := range fs.Args() {
+		classes, err := report.readLegacyFile(path)
+		if err != nil {
+			log.Fatalf("import-legacy: %s", err)
+		}
+		for _, c := range classes {
+			if _, dup := byId[c.Id]; dup {
+				report.skip("earlier record of class %s, replaced by one in %s", c.Id, path)
+			} else {
+				ids = append(ids, c.Id)
+			}
+			byId[c.Id] = c
+		}
+	}
+	classes := make([]*pb.Class, len(ids))
+	for i, id := range ids {
+		classes[i] = byId[id]
+	}
+
+	for _, s := range report.skipped {
+		log.Printf("Skipped %s", s)
+	}
+	unmapped := make([]string, 0, len(report.unmapped))
+	for f := range report.unmapped {
+		unmapped = append(unmapped, f)
+	}
+	sort.Strings(unmapped)
+	for _, f := range unmapped {
+		log.Printf("Field %q of %d records has no place in the current schema and was dropped", f, report.unmapped[f])
+	}
+	log.Printf("Read %d records, %d classes to import", report.records, len(classes))
+	if *dryRun {
+		return
+	}
+
+	var err error
+	if *addr != "" {
+		err = genToAdapter(*addr, *tenant, classes)
+	} else {
+		o := dbOptions{dir: *dataDir}
+		if *encryptionKeyFile != "" {
+			o.encryptionKey, err = readEncryptionKey(*encryptionKeyFile)
+		}
+		if err == nil {
+			err = genToDataDir(*storageDriver, o, *tenant, classes)
+		}
+	}
+	if err != nil {
+		log.Fatalf("import-legacy: %s", err)
+	}
+	log.Printf("Imported %d classes for tenant %s", len(classes), *tenant)
+}
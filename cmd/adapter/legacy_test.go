@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func TestReadLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"classes.csv": "Class_ID,Title,Term,Room\nMATH101,Algebra,Fall 2024,B12\n" + strings.Repeat("B", maxIdLength+1) + ",Broken,2024-FALL,\n",
+		"array.json":  `[{"id": "ART100", "name": "Drawing", "semester": "2025 spring", "credits": 3}]`,
+		"byid.json":   `{"PHYS200": {"title": "Mechanics", "term": "SUMMER-2025"}}`,
+		"lines.json":  "{\"code\": \"CHEM100\", \"semester\": \"2024-WINTER\"}\n\n{\"code\": \"BIO100\", \"term\": \"Autumn\"}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		file string
+		want []*pb.Class
+	}{
+		{"classes.csv", []*pb.Class{{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"}}},
+		{"array.json", []*pb.Class{{Id: "ART100", Name: "Drawing", Semester: "2025-SPRING"}}},
+		{"byid.json", []*pb.Class{{Id: "PHYS200", Name: "Mechanics", Semester: "2025-SUMMER"}}},
+		{"lines.json", []*pb.Class{{Id: "CHEM100", Semester: "2024-WINTER"}}},
+	} {
+		r := &legacyReport{unmapped: make(map[string]int)}
+		got, err := r.readLegacyFile(filepath.Join(dir, tc.file))
+		if err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.file, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Id != tc.want[i].Id || got[i].Name != tc.want[i].Name || got[i].Semester != tc.want[i].Semester {
+				t.Errorf("%s: got %v, want %v", tc.file, got[i], tc.want[i])
+			}
+		}
+		switch tc.file {
+		case "classes.csv":
+			if r.records != 2 || len(r.skipped) != 1 || r.unmapped["Room"] != 1 {
+				t.Errorf("%s: %d records, skipped %v, unmapped %v", tc.file, r.records, r.skipped, r.unmapped)
+			}
+		case "array.json":
+			if r.unmapped["credits"] != 1 {
+				t.Errorf("%s: unmapped %v", tc.file, r.unmapped)
+			}
+		case "lines.json":
+			if len(r.skipped) != 1 {
+				t.Errorf("%s: the unrecognized term wasn't skipped: %v", tc.file, r.skipped)
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenSpec is one address the adapter serves gRPC on, with the TLS
+// configuration to serve it with, or nil for plaintext.
+type listenSpec struct {
+	addr string
+	tls  *tls.Config
+}
+
+// parseListeners parses -listen, comma-separated addresses, and
+// -listen-tls, comma-separated address=cert.pem:key.pem pairs naming the
+// addresses served over TLS with that certificate and key. The rest are
+// served in plaintext, so one adapter can take plaintext calls on
+// localhost or a socket and TLS ones on the pod IP.
+func parseListeners(listen, listenTLS string) ([]listenSpec, error) {
+	var specs []listenSpec
+	index := make(map[string]int)
+	for _, addr := range strings.Split(listen, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			return nil, fmt.Errorf("-listen has an empty address")
+		}
+		if _, ok := index[addr]; ok {
+			return nil, fmt.Errorf("-listen has %s twice", addr)
+		}
+		index[addr] = len(specs)
+		specs = append(specs, listenSpec{addr: addr})
+	}
+	if listenTLS == "" {
+		return specs, nil
+	}
+	for _, pair := range strings.Split(listenTLS, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("-listen-tls: %q is not address=cert.pem:key.pem", pair)
+		}
+		i, ok := index[kv[0]]
+		if !ok {
+			return nil, fmt.Errorf("-listen-tls: %s is not a -listen address", kv[0])
+		}
+		if specs[i].tls != nil {
+			return nil, fmt.Errorf("-listen-tls has %s twice", kv[0])
+		}
+		files := strings.SplitN(kv[1], ":", 2)
+		if len(files) != 2 || files[0] == "" || files[1] == "" {
+			return nil, fmt.Errorf("-listen-tls: %q is not address=cert.pem:key.pem", pair)
+		}
+		cert, err := tls.LoadX509KeyPair(files[0], files[1])
+		if err != nil {
+			return nil, fmt.Errorf("-listen-tls: %s: %w", kv[0], err)
+		}
+		specs[i].tls = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2"},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+	return specs, nil
+}
+
+// plaintextAddr returns the first address in specs served in plaintext,
+// which other adapters dial without credentials, leaving out Unix domain
+// sockets if tcpOnly is set. It returns "" if there is none.
+func plaintextAddr(specs []listenSpec, tcpOnly bool) string {
+	for _, l := range specs {
+		if _, unix := socketPath(l.addr); l.tls != nil || unix && tcpOnly {
+			continue
+		}
+		return l.addr
+	}
+	return ""
+}
+
+// openListeners opens every listener in specs, closing those already open
+// if one fails.
+func openListeners(specs []listenSpec, mode os.FileMode) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, l := range specs {
+		lis, err := openListener(l.addr, mode)
+		if err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", l.addr, err)
+		}
+		if l.tls != nil {
+			lis = tls.NewListener(lis, l.tls)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// serveAll serves s on every listener until it stops, or one of them fails.
+func serveAll(s grpcServer, listeners []net.Listener) error {
+	errc := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		go func(lis net.Listener) { errc <- s.Serve(lis) }(lis)
+	}
+	for range listeners {
+		if err := <-errc; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unixScheme starts a -listen address naming a Unix domain socket, in the
+// form gRPC clients dial: unix:///var/run/adapter.sock for an absolute
+// path, or unix:adapter.sock for one relative to the working directory.
+const unixScheme = "unix:"
+
+// socketPath returns the path of the Unix domain socket addr names, and
+// false for a TCP address.
+func socketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixScheme) {
+		return "", false
+	}
+	if strings.HasPrefix(addr, unixScheme+"//") {
+		return strings.TrimPrefix(addr, unixScheme+"//"), true
+	}
+	return strings.TrimPrefix(addr, unixScheme), true
+}
+
+// parseSocketMode parses -listen-socket-mode, an octal file mode such as
+// 0660.
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("-listen-socket-mode must be an octal file mode such as 0660, got %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// openListener listens on addr: a Unix domain socket given mode for a
+// unix: address, so filesystem permissions decide who may connect, and TCP
+// otherwise. A socket file left behind by an adapter that didn't shut down
+// cleanly is replaced; one another process still accepts connections on is
+// not. The socket file is removed when the listener closes.
+func openListener(addr string, mode os.FileMode) (net.Listener, error) {
+	path, ok := socketPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" || strings.HasSuffix(path, "/") {
+		return nil, fmt.Errorf("%s names no socket file", addr)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// removeStaleSocket removes the socket file at path unless something is
+// listening on it. Other kinds of file are left for net.Listen to fail on.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
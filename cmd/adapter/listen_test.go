@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestSocketPath(t *testing.T) {
+	tests := []struct {
+		addr, path string
+		ok         bool
+	}{
+		{":50051", "", false},
+		{"localhost:50051", "", false},
+		{"unix:///var/run/adapter.sock", "/var/run/adapter.sock", true},
+		{"unix:adapter.sock", "adapter.sock", true},
+	}
+	for _, tt := range tests {
+		if path, ok := socketPath(tt.addr); path != tt.path || ok != tt.ok {
+			t.Errorf("socketPath(%q) = %q, %v, want %q, %v", tt.addr, path, ok, tt.path, tt.ok)
+		}
+	}
+	for _, s := range []string{"0660", "600", "0777"} {
+		if _, err := parseSocketMode(s); err != nil {
+			t.Errorf("parseSocketMode(%q) = %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "0999", "01777", "rw"} {
+		if _, err := parseSocketMode(s); err == nil {
+			t.Errorf("parseSocketMode(%q) succeeded", s)
+		}
+	}
+}
+
+func TestUnixListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "adapter.sock")
+	addr := "unix://" + path
+
+	// A socket left behind by an adapter that died is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lis, err := openListener(addr, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("socket has mode %v, want 0600", fi.Mode().Perm())
+	}
+	if _, err := openListener(addr, 0600); err == nil {
+		t.Error("a second listener took over a socket in use")
+	}
+
+	s := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("Check over the socket = %v, %v", resp, err)
+	}
+	conn.Close()
+
+	s.Stop()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file is left after the server stopped: %v", err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for localhost and its key
+// into dir, returning their paths and a pool trusting the certificate.
+func writeTestCert(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestParseListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, _ := writeTestCert(t, dir)
+	pair := certFile + ":" + keyFile
+
+	specs, err := parseListeners("localhost:50051, unix:///run/a.sock,:50443", ":50443="+pair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 3 || specs[0].tls != nil || specs[1].tls != nil || specs[2].tls == nil {
+		t.Errorf("parseListeners returned %v, want TLS on the third address only", specs)
+	}
+	if specs[1].addr != "unix:///run/a.sock" {
+		t.Errorf("parseListeners kept %q, want the address trimmed", specs[1].addr)
+	}
+	if addr := plaintextAddr(specs, false); addr != "localhost:50051" {
+		t.Errorf("plaintextAddr = %q, want localhost:50051", addr)
+	}
+	specs[0].tls = specs[2].tls
+	if addr := plaintextAddr(specs, true); addr != "" {
+		t.Errorf("plaintextAddr of TCP only = %q, want none", addr)
+	}
+	if addr := plaintextAddr(specs, false); addr != "unix:///run/a.sock" {
+		t.Errorf("plaintextAddr = %q, want the socket", addr)
+	}
+
+	for _, tt := range []struct{ listen, tls string }{
+		{"", ""},
+		{":50051,", ""},
+		{":50051,:50051", ""},
+		{":50051", ":50052=" + pair},
+		{":50051", ":50051"},
+		{":50051", ":50051=" + certFile},
+		{":50051", ":50051=" + pair + ",:50051=" + pair},
+		{":50051", ":50051=" + filepath.Join(dir, "missing.pem") + ":" + keyFile},
+	} {
+		if _, err := parseListeners(tt.listen, tt.tls); err == nil {
+			t.Errorf("parseListeners(%q, %q) succeeded", tt.listen, tt.tls)
+		}
+	}
+}
+
+func TestServeAllListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, pool := writeTestCert(t, dir)
+	sock := "unix://" + filepath.Join(dir, "adapter.sock")
+
+	specs, err := parseListeners("127.0.0.1:0,localhost:0,"+sock, "localhost:0="+certFile+":"+keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listeners, err := openListeners(specs, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	served := make(chan error, 1)
+	go func() { served <- serveAll(s, listeners) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	check := func(addr string, opt grpc.DialOption) {
+		t.Helper()
+		conn, err := grpc.DialContext(ctx, addr, opt, grpc.WithBlock())
+		if err != nil {
+			t.Fatalf("dial %s: %v", addr, err)
+		}
+		defer conn.Close()
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		if err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+			t.Errorf("Check on %s = %v, %v", addr, resp, err)
+		}
+	}
+	check(listeners[0].Addr().String(), grpc.WithInsecure())
+	check(listeners[1].Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "localhost"})))
+	check(sock, grpc.WithInsecure())
+
+	// A plaintext client can't call the TLS listener.
+	conn, err := grpc.Dial(listeners[1].Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, cancelShort := context.WithTimeout(ctx, 500*time.Millisecond)
+	if _, err := grpc_health_v1.NewHealthClient(conn).Check(short, &grpc_health_v1.HealthCheckRequest{}); err == nil {
+		t.Error("a plaintext Check on the TLS listener succeeded")
+	}
+	cancelShort()
+	conn.Close()
+
+	s.GracefulStop()
+	if err := <-served; err != nil {
+		t.Errorf("serveAll returned %v after the server stopped", err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const lockFileName = "adapter.lock"
+
+// errFileLocked is returned by lockFile when another process holds the lock.
+var errFileLocked = errors.New("file is locked")
+
+// dataDirOwner describes the adapter holding a data directory's lock. It is
+// written into the lock file so a second adapter can say who it clashed with.
+type dataDirOwner struct {
+	PID    int       `json:"pid"`
+	Host   string    `json:"host"`
+	Listen string    `json:"listen"`
+	Since  time.Time `json:"since"`
+}
+
+// dialAddr is an address other adapters can reach the owner's gRPC listener
+// on.
+func (o *dataDirOwner) dialAddr() string {
+	host, port, err := net.SplitHostPort(o.Listen)
+	if err != nil {
+		return o.Listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+		if me, _ := os.Hostname(); o.Host != "" && o.Host != me {
+			host = o.Host
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// dataDirLockedError reports that another adapter already owns a data
+// directory.
+type dataDirLockedError struct {
+	dir   string
+	owner *dataDirOwner
+}
+
+func (e *dataDirLockedError) Error() string {
+	if e.owner == nil {
+		return fmt.Sprintf("data directory %s is in use by another adapter", e.dir)
+	}
+	return fmt.Sprintf("data directory %s is in use by another adapter (pid %d on %s, listening on %s since %s)",
+		e.dir, e.owner.PID, e.owner.Host, e.owner.Listen, e.owner.Since.Format(time.RFC3339))
+}
+
+// dataDirLock is an exclusive lock on a data directory, held for the life of
+// the process. Badger locks the directory too, but only reports a bare LOCK
+// error when it is taken.
+type dataDirLock struct {
+	f *os.File
+}
+
+// lockDataDir takes the lock on dir for an adapter listening on listen,
+// failing with a dataDirLockedError if another adapter holds it.
+func lockDataDir(dir, listen string) (*dataDirLock, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, lockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		defer f.Close()
+		if err != errFileLocked {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		locked := &dataDirLockedError{dir: dir}
+		if b, err := ioutil.ReadAll(f); err == nil {
+			owner := &dataDirOwner{}
+			if json.Unmarshal(b, owner) == nil {
+				locked.owner = owner
+			}
+		}
+		return nil, locked
+	}
+
+	host, _ := os.Hostname()
+	b, err := json.Marshal(&dataDirOwner{
+		PID:    os.Getpid(),
+		Host:   host,
+		Listen: listen,
+		Since:  time.Now().UTC(),
+	})
+	if err == nil {
+		err = f.Truncate(0)
+	}
+	if err == nil {
+		_, err = f.WriteAt(b, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write %s: %w", path, err)
+	}
+	return &dataDirLock{f: f}, nil
+}
+
+// release clears the owner and drops the lock.
+func (l *dataDirLock) release() {
+	l.f.Truncate(0)
+	l.f.Close()
+}
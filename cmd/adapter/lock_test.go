@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockDataDir(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := lockDataDir(dir, ":50051")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lockDataDir(dir, ":50052")
+	var locked *dataDirLockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("locking a locked data directory returned %v, want a dataDirLockedError", err)
+	}
+	if locked.owner == nil || locked.owner.Listen != ":50051" {
+		t.Errorf("the lock error names owner %+v, want the one listening on :50051", locked.owner)
+	}
+
+	lock.release()
+	again, err := lockDataDir(dir, ":50052")
+	if err != nil {
+		t.Fatalf("locking a released data directory returned %v", err)
+	}
+	again.release()
+}
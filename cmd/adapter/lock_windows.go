@@ -0,0 +1,21 @@
+package main
+
+import (
+	"math"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on f without waiting. Windows locks
+// byte ranges and keeps other processes from reading a locked range, so
+// the lock covers one byte far past the owner written at the start of the
+// file, which a second adapter can then still read.
+func lockFile(f *os.File) error {
+	ol := &windows.Overlapped{Offset: math.MaxUint32, OffsetHigh: math.MaxInt32}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errFileLocked
+	}
+	return err
+}
@@ -1,20 +1,32 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
 	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -22,203 +34,1292 @@ const (
 	delim = "."
 )
 
+// Values of -storage.
+const (
+	storageDisk   = "disk"
+	storageMemory = "memory"
+)
+
 type server struct {
 	pb.UnimplementedAdapterServer
-	db *badger.DB
+	db     kvDB
+	events *eventBus
+	outbox *outbox
+	// Queues class events for webhook targets; nil to send none.
+	webhooks *webhooks
+	audit    *auditLog
+	// Logs every class change for ReplayChanges; nil to log none.
+	changelog *changelog
+	reads     singleflight.Group
+
+	calendar *semesterCalendar
+	// Holds the current tunables; see tuning.
+	settings atomic.Value
+
+	offboarding tenantGate
+	// Directory offboarding archives are written to; offboarding is
+	// disabled when empty.
+	offboardDir string
+	// Verify the derived data of every class a write touches; see
+	// assertInvariants.
+	checkInvariants bool
+	// Set while AdminCompact or AdminRunGC runs.
+	maintaining int32
+	// Snapshots of List calls with pages to come; nil to page over live
+	// data.
+	snapshots *snapshotRegistry
+	// Recent Get and List responses; nil to read every one from storage.
+	cache *readCache
+	// Ends Watch streams; nil to let them run until the client leaves.
+	drain *streamDrain
+	// Syncs classes from Google Classroom; nil if not configured.
+	classroom *classroomSync
+}
+
+// emit announces a committed change to watchers and the event relay.
+func (s *server) emit(e *pb.ClassEvent) {
+	s.events.publish(e)
+	s.outbox.notify()
+	s.webhooks.notify()
 }
 
 func (s *server) List(ctx context.Context, in *pb.ListRequest) (*pb.Classes, error) {
-	log.Print("List called")
+	logf(ctx, "List called")
+	// The request rules have checked both parse.
+	sel, _ := parseLabelSelector(in.LabelSelector)
+	less, _ := parseOrderBy(in.OrderBy)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit, after, err := s.checkPage(ctx, "List", in.PageSize, in.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := s.cache.key(tenant, "List", in, limit)
+	if m, ok := s.cache.get("List", key); ok {
+		return m.(*pb.Classes), nil
+	}
+	var v violations
+	snap, after, err := s.snapshots.resume(tenant, after)
+	if err != nil {
+		v.add("page_token", "%s", err)
+		return nil, v.err()
+	}
+	if snap == nil && after == "" && limit > 0 {
+		snap = s.snapshots.open(s.db)
+	}
+	var start *pb.Class
+	if in.OrderBy != "" {
+		if start, err = orderedPageStart(in.OrderBy, after); err != nil {
+			v.add("page_token", "%s", err)
+			return nil, v.err()
+		}
+	} else if strings.HasPrefix(after, orderCursorMark) {
+		v.add("page_token", "page token is from an ordered list; pass the same order_by")
+		return nil, v.err()
+	}
 	cs := &pb.Classes{}
 	cs.Classes = make([]*pb.Class, 0)
-	err := s.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		classMap := make(map[string]int)
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			k := string(item.Key())
-			// Split ID from parameter
-			lastIndex := strings.LastIndex(k, ".")
-			id := k[:lastIndex]
-			param := k[lastIndex+1:]
-
-			// Determine if we've already found this Class, add a new placeholder if not
-			var index int
-			var ok bool
-			if index, ok = classMap[id]; !ok {
-				index = len(cs.Classes)
-				classMap[id] = index
-				cs.Classes = append(cs.Classes, &pb.Class{
-					Id: id,
-				})
-
-			}
-
-			err := item.Value(func(v []byte) error {
-				if param == "Name" {
-					cs.Classes[index].Name = string(v)
-				} else if param == "Semester" {
-					cs.Classes[index].Semester = string(v)
-				}
-				return nil
-			})
+	err = s.viewSnapshot(ctx, tenant, snap, func(txn *tenantTxn) error {
+		var classes []*pb.Class
+		var err error
+		switch {
+		case len(sel) > 0:
+			classes, err = selectClasses(txn, sel)
+			cs.TotalSize = int64(len(classes))
+		case in.OrderBy == "" && limit > 0 && len(in.States) == 0:
+			// A page in Id order only needs the values of its own classes.
+			classes, next, total, err := listClassPage(txn, after, limit)
 			if err != nil {
 				return err
 			}
+			cs.Classes, cs.NextPageToken, cs.TotalSize = classes, next, total
+			return nil
+		default:
+			classes, err = s.listClasses(txn)
+			if err == nil {
+				cs.TotalSize, err = countClasses(txn)
+			}
 		}
-
+		if err != nil {
+			return err
+		}
+		if len(in.States) > 0 {
+			classes = inStates(classes, in.States)
+			cs.TotalSize = int64(len(classes))
+		}
+		if in.OrderBy != "" {
+			cs.Classes, cs.NextPageToken, err = orderedPage(classes, in.OrderBy, less, start, limit)
+			return err
+		}
+		cs.Classes, cs.NextPageToken = page(classes, after, limit)
 		return nil
 	})
+	if err == errSnapshotDiscarded {
+		v.add("page_token", "page token has expired; start the listing again")
+		return nil, v.err()
+	}
+	if err == nil {
+		cs.NextPageToken, err = s.snapshots.hold(tenant, snap, cs.NextPageToken)
+	} else if snap != nil {
+		s.snapshots.release(snap)
+	}
+	if isContextError(err) {
+		return nil, storageError(err)
+	}
 	if err != nil {
-		log.Printf("Error listing from class database: %s", err)
+		logf(ctx, "Error listing from class database: %s", err)
+	} else if cs.NextPageToken == "" && !anyExpiring(cs.Classes) {
+		// Only whole listings and last pages are cached; the token of any
+		// other page names a snapshot that expires.
+		s.cache.put(key, cs)
 	}
 	return cs, nil
 }
 
 func (s *server) Get(ctx context.Context, in *pb.GetRequest) (*pb.Class, error) {
-	log.Printf("Get called for Id %s", in.Id)
-	c := &pb.Class{
-		Id:       in.Id,
-		Name:     "",
-		Semester: "",
-	}
-	err := s.db.View(func(txn *badger.Txn) error {
-		n, nameErr := txn.Get([]byte(in.Id + delim + "Name"))
-		if nameErr != nil {
-			return nameErr
-		}
-		nameErr = n.Value(func(val []byte) error {
-			c.Name = string(val)
-			return nil
-		})
-		if nameErr != nil {
-			return nameErr
-		}
-
-		s, semesterErr := txn.Get([]byte(in.Id + delim + "Semester"))
-		if semesterErr != nil {
-			return semesterErr
+	logf(ctx, "Get called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Callers polling with different etags share cache entries.
+	etag := in.IfNoneMatch
+	in.IfNoneMatch = ""
+	notModified := func(c *pb.Class) *pb.Class {
+		if etag != "" && c.Etag == etag {
+			return &pb.Class{Id: c.Id, Etag: c.Etag}
 		}
-		semesterErr = s.Value(func(val []byte) error {
-			c.Semester = string(val)
+		return c
+	}
+	key, _ := s.cache.key(tenant, "Get", in)
+	if m, ok := s.cache.get("Get", key); ok {
+		return notModified(m.(*pb.Class)), nil
+	}
+	c, err := s.readCoalesced(ctx, tenant, in.Id, func(ctx context.Context) (*pb.Class, error) {
+		c := &pb.Class{Id: in.Id}
+		err := s.view(ctx, tenant, func(txn *tenantTxn) error {
+			found, err := getClass(txn, in.Id)
+			if err != nil {
+				return err
+			}
+			c = found
 			return nil
 		})
-		if semesterErr != nil {
-			return semesterErr
-		}
+		return c, err
+	})
+	if isCorrupt(err) || isContextError(err) {
+		return nil, storageError(err)
+	}
+	if err != nil {
+		logf(ctx, "Error reading %s from class database: %s", in.Name, err)
+	} else if c.ExpireTime == nil {
+		// A class that expires would outlive its expiry in the cache.
+		s.cache.put(key, c)
+	}
+	return notModified(c), nil
+}
 
-		return nil
+func (s *server) Exists(ctx context.Context, in *pb.GetRequest) (*pb.ExistsResponse, error) {
+	logf(ctx, "Exists called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ExistsResponse{}
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		resp.Exists, err = classExists(txn, in.Id)
+		return err
 	})
 	if err != nil {
-		log.Printf("Error reading %s from class database: %s", in.Name, err)
+		return nil, storageError(err)
 	}
-	return c, nil
+	return resp, nil
 }
 
 func (s *server) Create(ctx context.Context, in *pb.Class) (*pb.Class, error) {
-	log.Printf("Create called for Id %s", in.Id)
-	err := s.db.Update(func(txn *badger.Txn) error {
-		// Store name
-		err := txn.Set([]byte(in.Id+delim+"Name"), []byte(in.Name))
-		if err != nil {
-			return fmt.Errorf("put %s%sName: %s", in.Id, delim, err)
-		}
+	logf(ctx, "Create called for Id %s", in.Id)
+	return s.create(ctx, in, true)
+}
 
-		// Store semester
-		err = txn.Set([]byte(in.Id+delim+"Semester"), []byte(in.Semester))
-		if err != nil {
-			return fmt.Errorf("put %s%sSemester: %s", in.Id, delim, err)
+// create stores in, replacing the class with its Id if replace is set and
+// failing with AlreadyExists otherwise.
+func (s *server) create(ctx context.Context, in *pb.Class, replace bool) (*pb.Class, error) {
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token := in.LeaseToken
+	validateOnly := in.ValidateOnly
+	in.LeaseToken = ""
+	in.ValidateOnly = false
+	var event *pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		old, err := allowCorrupt(getClass(txn, in.Id))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
 		}
-
+		if old != nil && !replace {
+			return status.Errorf(codes.AlreadyExists, "class %s already exists", in.Id)
+		}
+		if old != nil {
+			if err := checkEditLease(txn, in.Id, token); err != nil {
+				return err
+			}
+		}
+		if err := checkReferences(txn, in); err != nil {
+			return err
+		}
+		if err := putClass(txn, in); err != nil {
+			return err
+		}
+		if validateOnly {
+			return errValidateOnly
+		}
+		if err := s.audit.record(ctx, txn, "Create", in.Id, old, proto.Clone(in).(*pb.Class)); err != nil {
+			return err
+		}
+		event = newClassEvent(pb.ClassEvent_CREATED, tenant, proto.Clone(in).(*pb.Class))
+		txn.record(event)
 		return nil
 	})
+	if err == errValidateOnly {
+		return in, nil
+	}
 	if err != nil {
-		log.Printf("Error saving %s to class database: %s", in.Name, err)
+		return nil, storageError(err)
 	}
-
-	log.Printf("Added %s to class database", in.Name)
+	s.forgetRead(tenant, in.Id)
+	s.emit(event)
+	logf(ctx, "Added %s to class database", in.Name)
 	return in, nil
 }
 
 func (s *server) Update(ctx context.Context, in *pb.Class) (*pb.Class, error) {
-	log.Printf("Update called for Id %s", in.Id)
-	err := s.db.Update(func(txn *badger.Txn) error {
-		// Store name
-		err := txn.Set([]byte(in.Id+delim+"Name"), []byte(in.Name))
-		if err != nil {
-			return fmt.Errorf("put %s%sName: %s", in.Id, delim, err)
+	logf(ctx, "Update called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := in.UpdateMask.GetPaths()
+	token := in.LeaseToken
+	validateOnly := in.ValidateOnly
+	in.LeaseToken = ""
+	in.UpdateMask = nil
+	in.ValidateOnly = false
+	var event *pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		if err := checkEditLease(txn, in.Id, token); err != nil {
+			return err
 		}
-
-		// Store semester
-		err = txn.Set([]byte(in.Id+delim+"Semester"), []byte(in.Semester))
-		if err != nil {
-			return fmt.Errorf("put %s%sSemester: %s", in.Id, delim, err)
+		old, err := getClass(txn, in.Id)
+		if len(paths) == 0 {
+			// Replacing every field repairs a corrupt class, but a partial
+			// update would keep some of its corrupt fields.
+			old, err = allowCorrupt(old, err)
 		}
-
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if len(paths) > 0 {
+			if old == nil {
+				return status.Errorf(codes.NotFound, "class %s not found", in.Id)
+			}
+			in = applyUpdateMask(proto.Clone(old).(*pb.Class), in, paths)
+		}
+		if err := checkReferences(txn, in); err != nil {
+			return err
+		}
+		if err := putClass(txn, in); err != nil {
+			return err
+		}
+		if validateOnly {
+			return errValidateOnly
+		}
+		if err := s.audit.record(ctx, txn, "Update", in.Id, old, proto.Clone(in).(*pb.Class)); err != nil {
+			return err
+		}
+		event = newClassEvent(pb.ClassEvent_UPDATED, tenant, proto.Clone(in).(*pb.Class))
+		txn.record(event)
 		return nil
 	})
+	if err == errValidateOnly {
+		return in, nil
+	}
 	if err != nil {
-		log.Printf("Error saving %s to class database: %s", in.Name, err)
+		return nil, storageError(err)
 	}
-
-	log.Printf("Added %s to class database", in.Name)
+	s.forgetRead(tenant, in.Id)
+	s.emit(event)
+	logf(ctx, "Added %s to class database", in.Name)
 	return in, nil
 }
 
+// classPaths are the field paths an update mask or query projection can
+// name.
+var classPaths = map[string]bool{
+	"name":             true,
+	"semester":         true,
+	"instructor_id":    true,
+	"instructor_name":  true,
+	"capacity":         true,
+	"description":      true,
+	"meetings":         true,
+	"labels":           true,
+	"prerequisite_ids": true,
+	"external_ids":     true,
+	"expire_time":      true,
+}
+
+// applyUpdateMask copies the fields named by paths from src onto dst.
+func applyUpdateMask(dst, src *pb.Class, paths []string) *pb.Class {
+	for _, p := range paths {
+		switch p {
+		case "name":
+			dst.Name = src.Name
+		case "semester":
+			dst.Semester = src.Semester
+		case "instructor_id":
+			dst.InstructorId = src.InstructorId
+		case "instructor_name":
+			dst.InstructorName = src.InstructorName
+		case "capacity":
+			dst.Capacity = src.Capacity
+		case "description":
+			dst.Description = src.Description
+		case "meetings":
+			dst.Meetings = src.Meetings
+		case "labels":
+			dst.Labels = src.Labels
+		case "prerequisite_ids":
+			dst.PrerequisiteIds = src.PrerequisiteIds
+		case "external_ids":
+			dst.ExternalIds = src.ExternalIds
+		case "expire_time":
+			dst.ExpireTime = src.ExpireTime
+		}
+	}
+	return dst
+}
+
 func (s *server) Delete(ctx context.Context, in *pb.Class) (*pb.Empty, error) {
-	log.Printf("Delete called for Id %s", in.Id)
-	err := s.db.Update(func(txn *badger.Txn) error {
-		err := txn.Delete([]byte(in.Id + ".Name"))
-		if err != nil {
-			return fmt.Errorf("delete %s.Name: %s", in.Id, err)
+	logf(ctx, "Delete called for Id %s", in.Id)
+	return s.delete(ctx, in, true)
+}
+
+// delete removes the class named by in.Id. A missing class is a no-op if
+// allowMissing is set and fails with NotFound otherwise.
+func (s *server) delete(ctx context.Context, in *pb.Class, allowMissing bool) (*pb.Empty, error) {
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var event *pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		old, err := allowCorrupt(getClass(txn, in.Id))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
 		}
-		err = txn.Delete([]byte(in.Id + ".Semester"))
-		if err != nil {
-			return fmt.Errorf("delete %s.Semester: %s", in.Id, err)
+		if old == nil && !allowMissing {
+			return status.Errorf(codes.NotFound, "class %s not found", in.Id)
+		}
+		if err := checkEditLease(txn, in.Id, in.LeaseToken); err != nil {
+			return err
+		}
+		if err := removeClass(txn, in.Id); err != nil {
+			return err
+		}
+		if in.ValidateOnly {
+			return errValidateOnly
+		}
+		if old == nil {
+			return nil
+		}
+		if err := s.audit.record(ctx, txn, "Delete", in.Id, old, nil); err != nil {
+			return err
 		}
+		event = newClassEvent(pb.ClassEvent_DELETED, tenant, old)
+		txn.record(event)
 		return nil
 	})
+	if err == errValidateOnly {
+		return &pb.Empty{}, nil
+	}
 	if err != nil {
-		log.Printf("Error saving %s to class database: %s", in.Name, err)
+		return nil, storageError(err)
+	}
+	if event != nil {
+		s.forgetRead(tenant, in.Id)
+		s.emit(event)
 	}
-
 	return &pb.Empty{}, nil
 }
 
+func (s *server) ListBySemester(ctx context.Context, in *pb.ListBySemesterRequest) (*pb.Classes, error) {
+	logf(ctx, "ListBySemester called for semester %s", in.Semester)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit, after, err := s.checkPage(ctx, "ListBySemester", in.PageSize, in.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	cs := &pb.Classes{}
+	cs.Classes = make([]*pb.Class, 0)
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		classes, err := listSemester(txn, in.Semester)
+		if err != nil {
+			return err
+		}
+		cs.Classes, cs.NextPageToken = page(classes, after, limit)
+		cs.TotalSize, err = countSemester(txn, in.Semester)
+		return err
+	})
+	if isContextError(err) {
+		return nil, storageError(err)
+	}
+	if err != nil {
+		logf(ctx, "Error listing semester %s from class database: %s", in.Semester, err)
+	}
+	return cs, nil
+}
+
+func (s *server) Count(ctx context.Context, in *pb.CountRequest) (*pb.CountResponse, error) {
+	logf(ctx, "Count called for semester %q", in.Semester)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.CountResponse{}
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		if in.Semester != "" {
+			resp.Total, err = countSemester(txn, in.Semester)
+		} else {
+			resp.Total, err = countClasses(txn)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return resp, nil
+}
+
 func main() {
-	log.Printf("Opening database...\n")
-	dir, err := ioutil.TempDir("", "class")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "gen":
+			runGen(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "import-legacy":
+			runImportLegacy(os.Args[2:])
+			return
+		case "compact", "gc":
+			runMaintenance(os.Args[1], os.Args[2:])
+			return
+		case "fsck":
+			runFsck(os.Args[2:])
+			return
+		case "get", "list", "create", "delete", "import-roster":
+			runClassCommand(os.Args[1], os.Args[2:])
+			return
+		}
+	}
+	serve(os.Args[1:])
+}
+
+func serve(args []string) {
+	fs := flag.NewFlagSet("adapter", flag.ExitOnError)
+	listen := fs.String("listen", port, "comma-separated addresses to serve gRPC on: host:port for TCP, or unix:///path/to/socket for a Unix domain socket")
+	listenTLS := fs.String("listen-tls", "", "comma-separated address=cert.pem:key.pem pairs serving those -listen addresses over TLS with that certificate and key (the rest are plaintext)")
+	xdsMode := fs.Bool("xds", false, "take listener configuration and mTLS certificates from the xDS control plane named by the GRPC_XDS_BOOTSTRAP file")
+	listenSocketMode := fs.String("listen-socket-mode", "0660", "file mode of the -listen Unix domain socket, in octal")
+	dataDir := fs.String("data-dir", "", "directory holding the class database (a temporary directory if empty)")
+	storage := fs.String("storage", storageDisk, "where to keep the class database: disk (in -data-dir) or memory (lost on exit)")
+	storageDriver := fs.String("storage-driver", driverBadger, "how to store the class database: badger, or file for a single JSON-lines file in -data-dir")
+	encryptionKeyFile := fs.String("encryption-key-file", "", "file holding a hex AES key to encrypt the database at rest with (unencrypted if empty)")
+	keyRotation := fs.Duration("encryption-key-rotation", 10*24*time.Hour, "how often to rotate the data keys derived from -encryption-key-file")
+	proxyTo := fs.String("proxy-to", "", "address of an upstream adapter to front instead of serving local storage")
+	replicaOf := fs.String("replica-of", "", "address of a primary adapter whose classes to copy into local storage and serve read-only (disabled if empty)")
+	replicaTenants := fs.String("replica-tenants", defaultTenant, "comma-separated tenants -replica-of copies")
+	replicaTokenFile := fs.String("replica-token-file", "", "file holding the bearer token to call -replica-of with, if it requires one")
+	cacheTTL := fs.Duration("cache-ttl", 5*time.Second, "how long proxy mode caches read responses (0 disables caching)")
+	authTokensFile := fs.String("auth-tokens-file", "", "file of accepted bearer tokens, one per line (authentication is disabled if empty)")
+	rateLimit := fs.Float64("rate-limit", 0, "maximum requests per second across all clients (0 disables rate limiting)")
+	rateBurst := fs.Int("rate-burst", 100, "number of requests allowed to exceed -rate-limit in a burst")
+	clientRateLimit := fs.Float64("client-rate-limit", 0, "maximum requests per second from each client, identified by token or IP address (0 disables the per-client limit)")
+	clientRateBurst := fs.Int("client-rate-burst", 20, "number of requests a client may send over -client-rate-limit in a burst")
+	eventsURL := fs.String("events-url", "", "NATS URL to publish class change events to, e.g. nats://localhost:4222 (disabled if empty)")
+	eventsSubject := fs.String("events-subject", "class.events", "JetStream subject for class change events")
+	webhookURLs := fs.String("webhook-urls", "", "comma-separated http(s) URLs to POST class change events to as JSON (disabled if empty)")
+	webhookSecretFile := fs.String("webhook-secret-file", "", "file holding the secret webhook requests are signed with (required with -webhook-urls)")
+	webhookMaxAttempts := fs.Int("webhook-max-attempts", 10, "failed deliveries of an event to a webhook before it is logged as a dead letter and dropped")
+	coalesceWindow := fs.Duration("get-coalesce-window", 0, "how long a Get waits for identical Gets to share its storage read (0 only shares reads already in flight)")
+	statsMinCount := fs.Int64("stats-min-count", 10, "smallest group GetAggregateStats reports; smaller groups are suppressed")
+	metricsAddr := fs.String("metrics-addr", "", "address to serve Prometheus metrics on, e.g. :9090 (disabled if empty)")
+	debugAddr := fs.String("debug-addr", "", "loopback address to serve pprof, expvar and goroutine dumps on, e.g. 127.0.0.1:6060 (disabled if empty)")
+	snapshotDir := fs.String("snapshot-dir", "", "directory to export every tenant's classes to as <tenant>.jsonl, replaced atomically each -snapshot-interval (disabled if empty)")
+	snapshotInterval := fs.Duration("snapshot-interval", time.Hour, "how often to export classes to -snapshot-dir")
+	classroomTokenFile := fs.String("classroom-token-file", "", "file holding an OAuth 2.0 access token with the classroom.courses.readonly scope, read for every sync, to sync classes from Google Classroom with (disabled if empty)")
+	classroomInterval := fs.Duration("classroom-interval", time.Hour, "how often to sync classes from Google Classroom (0 only syncs on AdminSyncClassroom)")
+	classroomTenant := fs.String("classroom-tenant", defaultTenant, "tenant to sync Google Classroom courses into")
+	classroomSemester := fs.String("classroom-semester", "", "semester to give classes synced from Google Classroom, e.g. 2024-FALL (left alone if empty)")
+	sqlAddr := fs.String("sql-addr", "", "address to serve read-only SQL queries over HTTP on, e.g. :8081 (disabled if empty)")
+	sqlTimeout := fs.Duration("sql-timeout", 10*time.Second, "longest a SQL query may run")
+	sqlMaxRows := fs.Int("sql-max-rows", 1000, "most rows a SQL query returns (0 for no limit)")
+	timeZone := fs.String("timezone", "UTC", "IANA time zone of the institution, used for all semester dates, e.g. America/Chicago")
+	calendarSpec := fs.String("semester-calendar", defaultCalendar, "start date of each term as TERM=MM-DD pairs")
+	listMaxResults := fs.Int("list-max-results", 0, "most classes a List or ListBySemester returns per page (0 for no limit)")
+	listParallelism := fs.Int("list-parallelism", 1, "ranges of the class keys a List reading every class scans concurrently (badger driver only)")
+	listSnapshotTTL := fs.Duration("list-snapshot-ttl", 5*time.Minute, "how long a paged List keeps its snapshot after each page (0 pages over live data)")
+	cacheSize := fs.Int("cache-size", 0, "most Get and List responses to cache in memory, dropped on every write of their tenant (0 disables the cache)")
+	paginationMode := fs.String("pagination", paginationOptional, "whether List requests need a page_size: optional, warn (log and send a warning header) or strict (reject)")
+	clientPolicyFile := fs.String("client-policy-file", "", "YAML file of the batch size, retry policy and deprecation notices GetClientPolicy serves (defaults if empty)")
+	kvMaxKeys := fs.Int("kv-max-keys", 1000, "most keys each KeyValueStore namespace of a tenant may hold")
+	kvMaxValueSize := fs.Int("kv-max-value-size", 64<<10, "largest KeyValueStore value in bytes")
+	offboardDir := fs.String("offboard-dir", "", "directory AdminOffboardTenant writes tenant archives to (offboarding is disabled if empty)")
+	captureFile := fs.String("capture-file", "", "file to record unary and client-streaming calls to for the replay subcommand (disabled if empty)")
+	captureMaxBytes := fs.Int64("capture-max-bytes", 16<<20, "most bytes of captured calls kept, across -capture-file and the previous file")
+	captureMethods := fs.String("capture-methods", "", "comma-separated method names to capture, e.g. Create,Update (every method if empty)")
+	captureTenant := fs.String("capture-tenant", "", "only capture calls from this tenant (every tenant if empty)")
+	watchMaxAge := fs.Duration("watch-max-age", 0, "end Watch streams with UNAVAILABLE after about this long, so watchers reconnect and rebalance (0 is unlimited)")
+	shutdownGrace := fs.Duration("shutdown-grace", 5*time.Second, "how long shutdown waits for in-flight calls after ending Watch streams")
+	fsckOnStart := fs.String("fsck-on-start", fsckOff, "check the database before serving: off, report (log the problems found) or repair (also repair them, as fsck -repair)")
+	defaultTimeout := fs.Duration("default-timeout", 5*time.Second, "deadline of calls that arrive without one; they fail with DEADLINE_EXCEEDED once it passes (0 for none)")
+	methodTimeouts := fs.String("method-timeouts", defaultMethodTimeouts, "comma-separated Method=duration deadlines overriding -default-timeout for calls without one, e.g. List=10s (0 for none)")
+	accessLogEnabled := fs.Bool("access-log", false, "log one line per call with its method, peer, status code, duration and message bytes")
+	accessLogRates := fs.String("access-log-sample-rates", "", "comma-separated Method=rate shares of calls -access-log logs, e.g. Get=0.01 (other methods are always logged)")
+	changelogMaxEntries := fs.Uint64("changelog-max-entries", 100000, "sequences of class changes the changelog keeps for ReplayChanges; older changes are trimmed every minute (0 keeps every change)")
+	enableReflection := fs.Bool("reflection", false, "serve gRPC server reflection, so tools such as grpcurl can list and call methods without the schema (GetApiDescriptor serves the schema either way)")
+	seedFile := fs.String("seed-file", "", "JSON file of classes to store on first start, when the database is empty, e.g. for demos and integration tests (disabled if empty)")
+	seedTenant := fs.String("seed-tenant", defaultTenant, "tenant -seed-file seeds")
+	checkInvariants := fs.Bool("check-invariants", false, "before committing each write, verify the keys and indexes of the classes it touched and panic on a mismatch (for tests and staging; slows writes)")
+	faultInject := fs.Bool("fault-inject", false, "developer mode: delay and fail a share of storage transactions, to test clients' retries and timeouts against a flaky adapter (needs "+allowFaultInjectionEnv+"=1 in the environment)")
+	faultErrorPercent := fs.Float64("fault-inject-error-percent", 5, "percentage of storage transactions -fault-inject fails, with UNAVAILABLE")
+	faultDelayPercent := fs.Float64("fault-inject-delay-percent", 10, "percentage of storage transactions -fault-inject delays")
+	faultMaxDelay := fs.Duration("fault-inject-max-delay", time.Second, "longest delay -fault-inject adds; delays are uniform up to it")
+	maxDBSize := fs.Int64("max-db-size", 0, "refuse writes other than deletes and maintenance while the database takes up at least this many bytes on disk (0 for no limit)")
+	minFreeDisk := fs.Int64("min-free-disk", 256<<20, "refuse writes other than deletes and maintenance while the disk holding -data-dir has fewer bytes free than this (0 for no limit)")
+	diskCheckInterval := fs.Duration("disk-check-interval", 10*time.Second, "how often to check -max-db-size and -min-free-disk and update the disk metrics")
+	grpcFlags := registerServerFlags(fs)
+	badgerTuning := registerBadgerFlags(fs)
+	readOnlyMode := fs.Bool("read-only", false, "open -data-dir read-only and reject writes, e.g. to report from a restored backup")
+	readOnlyFallback := fs.Bool("read-only-fallback", false, "if another adapter owns -data-dir, serve reads through it instead of exiting")
+	leaseName := fs.String("leader-election-lease", "", "Kubernetes Lease replicas sharing -data-dir elect a leader with; standbys proxy to the leader (disabled if empty)")
+	leaseNamespace := fs.String("leader-election-namespace", "", "namespace of -leader-election-lease (the pod's if empty)")
+	leaderIdentity := fs.String("leader-identity", "", "name this replica holds -leader-election-lease under (the hostname if empty)")
+	leaderAddress := fs.String("leader-address", "", "address other replicas dial while this one leads (POD_IP, or the hostname, at the -listen port if empty)")
+	leaseDuration := fs.Duration("lease-duration", 15*time.Second, "how long a leader that stops renewing keeps -leader-election-lease before a standby takes over")
+	fs.String("config", "", "YAML file of flag settings; command-line flags and ADAPTER_* environment variables override it")
+	showVersion := fs.Bool("version", false, "print the version and exit")
+	fs.Parse(args)
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+	commandLine := commandLineFlags(fs)
+	if err := applyConfig(fs, "config", commandLine); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if !validPaginationMode(*paginationMode) {
+		log.Fatalf("invalid -pagination %q, must be optional, warn or strict", *paginationMode)
+	}
+	clientPolicy, err := loadClientPolicy(*clientPolicyFile)
 	if err != nil {
-		panic(err)
+		log.Fatalf("invalid -client-policy-file: %v", err)
+	}
+	if err := badgerTuning.validate(); err != nil {
+		log.Fatal(err)
+	}
+	switch *fsckOnStart {
+	case fsckOff, fsckReport:
+	case fsckRepair:
+		if *readOnlyMode {
+			log.Fatalf("-fsck-on-start=repair can't be combined with -read-only")
+		}
+	default:
+		log.Fatalf("invalid -fsck-on-start %q, must be off, report or repair", *fsckOnStart)
+	}
+	var faults *faultInjector
+	if *faultInject {
+		switch {
+		case os.Getenv(allowFaultInjectionEnv) != "1":
+			log.Fatalf("-fault-inject is for testing only; set %s=1 to allow it", allowFaultInjectionEnv)
+		case *proxyTo != "":
+			log.Fatalf("-fault-inject needs local storage; run it on the adapter at %s", *proxyTo)
+		}
+		if err := checkFaultSettings(*faultErrorPercent, *faultDelayPercent, *faultMaxDelay); err != nil {
+			log.Fatal(err)
+		}
+		faults = newFaultInjector(*faultErrorPercent, *faultDelayPercent, *faultMaxDelay)
+	}
+	if err := checkDiskGuardSettings(*maxDBSize, *minFreeDisk); err != nil {
+		log.Fatal(err)
+	}
+	if *diskCheckInterval <= 0 {
+		log.Fatalf("-disk-check-interval must be positive")
+	}
+	var seedClasses []*pb.Class
+	if *seedFile != "" {
+		switch {
+		case *proxyTo != "":
+			log.Fatalf("-seed-file needs local storage; run it on the adapter at %s", *proxyTo)
+		case *readOnlyMode:
+			log.Fatalf("-seed-file can't be combined with -read-only")
+		case *replicaOf != "":
+			log.Fatalf("-seed-file can't be combined with -replica-of; the replica copies the primary's classes")
+		case !tenantPattern.MatchString(*seedTenant):
+			log.Fatalf("invalid -seed-tenant: %q must match %s", *seedTenant, tenantPattern)
+		}
+		// Read it up front, so a bad file fails every start and not only
+		// the first.
+		seedClasses, err = loadSeedFile(*seedFile)
+		if err != nil {
+			log.Fatalf("invalid -seed-file: %v", err)
+		}
+	}
+	if *debugAddr != "" {
+		if err := checkLoopback(*debugAddr); err != nil {
+			log.Fatalf("invalid -debug-addr: %v", err)
+		}
 	}
-	defer os.RemoveAll(dir)
 
-	db, err := badger.Open(badger.DefaultOptions(dir))
+	listeners, err := parseListeners(*listen, *listenTLS)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
+	}
+	if *xdsMode {
+		if err := checkXDS(listeners, *enableReflection); err != nil {
+			log.Fatal(err)
+		}
 	}
-	defer db.Close()
 
-	log.Printf("Listening on port %v...\n", port)
-	lis, err := net.Listen("tcp", port)
+	// Authentication and rate limiting are always in the chain, even when
+	// disabled, so a reload can turn them on.
+	auth, err := newTokenAuth(*authTokensFile)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		log.Fatalf("failed to load auth tokens: %v", err)
+	}
+	limiter := newRateLimiter(*rateLimit, *rateBurst, *clientRateLimit, *clientRateBurst)
+	timeouts, err := parseMethodTimeouts(*methodTimeouts)
+	if err != nil {
+		log.Fatalf("invalid -method-timeouts: %v", err)
+	}
+	deadlines := newDeadlines(*defaultTimeout, timeouts)
+	sampleRates, err := parseSampleRates(*accessLogRates)
+	if err != nil {
+		log.Fatalf("invalid -access-log-sample-rates: %v", err)
+	}
+	accessLog := newAccessLog(*accessLogEnabled, sampleRates)
+	unary, stream := interceptors(accessLog, deadlines, auth, limiter)
+
+	memory := *storage == storageMemory
+	switch {
+	case *storage != storageDisk && !memory:
+		log.Fatalf("invalid -storage %q, must be disk or memory", *storage)
+	case memory && *dataDir != "":
+		log.Fatalf("-storage=memory doesn't use -data-dir")
+	case memory && *readOnlyMode:
+		log.Fatalf("-storage=memory can't be combined with -read-only")
+	case memory && *storageDriver != driverBadger:
+		log.Fatalf("-storage=memory needs -storage-driver=%s", driverBadger)
+	case memory && *encryptionKeyFile != "":
+		log.Fatalf("-storage=memory writes nothing to disk to encrypt")
+	case *encryptionKeyFile != "" && *storageDriver != driverBadger:
+		log.Fatalf("-encryption-key-file needs -storage-driver=%s", driverBadger)
+	}
+	var replicaToken string
+	if *replicaOf != "" {
+		switch {
+		case *proxyTo != "":
+			log.Fatalf("-replica-of can't be combined with -proxy-to")
+		case *readOnlyMode:
+			log.Fatalf("-replica-of can't be combined with -read-only; the replica writes the classes it copies")
+		case *leaseName != "":
+			log.Fatalf("-replica-of can't be combined with -leader-election-lease")
+		case *eventsURL != "":
+			log.Fatalf("-replica-of can't be combined with -events-url; the primary publishes events")
+		case *webhookURLs != "":
+			log.Fatalf("-replica-of can't be combined with -webhook-urls; the primary sends webhooks")
+		}
+		for _, tenant := range strings.Split(*replicaTenants, ",") {
+			if !tenantPattern.MatchString(tenant) {
+				log.Fatalf("invalid -replica-tenants: %q must match %s", tenant, tenantPattern)
+			}
+		}
+		if *replicaTokenFile != "" {
+			b, err := ioutil.ReadFile(*replicaTokenFile)
+			if err != nil {
+				log.Fatalf("invalid -replica-token-file: %v", err)
+			}
+			replicaToken = strings.TrimSpace(string(b))
+		}
+		ro := &readOnly{reason: "it is a replica of the adapter at " + *replicaOf + "; send writes there"}
+		unary = append(unary, ro.unaryInterceptor)
+		stream = append(stream, ro.streamInterceptor)
+	}
+	if *leaseName != "" {
+		switch {
+		case *proxyTo != "":
+			log.Fatalf("-leader-election-lease can't be combined with -proxy-to")
+		case *readOnlyMode:
+			log.Fatalf("-leader-election-lease can't be combined with -read-only")
+		case memory || *dataDir == "":
+			log.Fatalf("-leader-election-lease needs a -data-dir the replicas share")
+		case *leaseDuration < time.Second:
+			log.Fatalf("-lease-duration must be at least 1s")
+		}
+	}
+	if *readOnlyMode {
+		if *proxyTo == "" && *dataDir == "" {
+			log.Fatalf("-read-only needs an existing -data-dir")
+		}
+		if *eventsURL != "" {
+			log.Fatalf("-read-only can't be combined with -events-url")
+		}
+		if *webhookURLs != "" {
+			log.Fatalf("-read-only can't be combined with -webhook-urls")
+		}
+		ro := &readOnly{reason: "started with -read-only"}
+		unary = append(unary, ro.unaryInterceptor)
+		stream = append(stream, ro.streamInterceptor)
+	}
+
+	var webhookTargets []string
+	var webhookSecret []byte
+	if *webhookURLs != "" {
+		switch {
+		case *proxyTo != "":
+			log.Fatalf("-webhook-urls needs local storage; run it on the adapter at %s", *proxyTo)
+		case *webhookSecretFile == "":
+			log.Fatalf("-webhook-urls needs -webhook-secret-file")
+		case *webhookMaxAttempts < 1:
+			log.Fatalf("-webhook-max-attempts must be at least 1")
+		}
+		for _, u := range strings.Split(*webhookURLs, ",") {
+			parsed, err := url.Parse(u)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				log.Fatalf("invalid -webhook-urls: %q is not an http or https URL", u)
+			}
+			webhookTargets = append(webhookTargets, u)
+		}
+		b, err := ioutil.ReadFile(*webhookSecretFile)
+		if err != nil {
+			log.Fatalf("invalid -webhook-secret-file: %v", err)
+		}
+		if webhookSecret = bytes.TrimSpace(b); len(webhookSecret) == 0 {
+			log.Fatalf("invalid -webhook-secret-file: %s is empty", *webhookSecretFile)
+		}
+	}
+
+	if *captureFile != "" {
+		var methods []string
+		if *captureMethods != "" {
+			methods = strings.Split(*captureMethods, ",")
+		}
+		capture, err := newCaptureLog(*captureFile, *captureMaxBytes, methods, *captureTenant)
+		if err != nil {
+			log.Fatalf("failed to open capture file: %v", err)
+		}
+		defer capture.close()
+		log.Printf("Capturing calls to %v...\n", *captureFile)
+		unary = append(unary, capture.unaryInterceptor)
+		stream = append(stream, capture.streamInterceptor)
+	}
+
+	upstream := *proxyTo
+	dir := *dataDir
+	// A standby restarts when it takes over the Lease, or the leader moves.
+	var takeover chan struct{}
+	if *leaseName != "" {
+		store, err := newKubeLeases(*leaseNamespace, *leaseName)
+		if err != nil {
+			log.Fatalf("failed to set up leader election: %v", err)
+		}
+		identity, address := *leaderIdentity, *leaderAddress
+		if identity == "" {
+			identity, _ = os.Hostname()
+		}
+		if address == "" {
+			addr := plaintextAddr(listeners, true)
+			if addr == "" {
+				log.Fatalf("-leader-address is required when no -listen address is plaintext TCP, which other replicas proxy to")
+			}
+			address = defaultLeaderAddress(addr)
+		}
+		elector := newLeaderElector(store, identity, address, *leaseDuration)
+		log.Printf("Electing a leader with lease %s as %s...\n", *leaseName, identity)
+		leader, leaderAddr := elector.awaitLeadership(context.Background())
+		if leader {
+			log.Printf("Leading; other replicas proxy to %s", address)
+			go elector.renew(context.Background(), func() {
+				// Writes must stop before a standby opens the data directory.
+				log.Fatalf("lost leadership; exiting so a standby takes over")
+			})
+		} else {
+			log.Printf("Standing by for the leader at %s", leaderAddr)
+			upstream = leaderAddr
+			takeover = make(chan struct{})
+			go elector.watchLeader(context.Background(), leaderAddr, func() { close(takeover) })
+		}
+	}
+	// A read-only adapter leaves the data directory to Badger's shared lock,
+	// so any number of them can serve the same copy while no writer has it.
+	if upstream == "" && !*readOnlyMode && !memory {
+		if dir == "" {
+			var err error
+			dir, err = ioutil.TempDir("", "class")
+			if err != nil {
+				panic(err)
+			}
+			defer os.RemoveAll(dir)
+		}
+		lockAddr := plaintextAddr(listeners, false)
+		if lockAddr == "" {
+			lockAddr = listeners[0].addr
+		}
+		lock, err := lockDataDir(dir, lockAddr)
+		var locked *dataDirLockedError
+		switch {
+		case errors.As(err, &locked) && *readOnlyFallback && locked.owner != nil:
+			upstream = locked.owner.dialAddr()
+			log.Printf("%s; serving reads read-only through it at %s", locked, upstream)
+			ro := &readOnly{reason: "writes go to the adapter at " + upstream}
+			unary = append(unary, ro.unaryInterceptor)
+			stream = append(stream, ro.streamInterceptor)
+		case locked != nil:
+			log.Fatalf("%s; stop it, use another -data-dir, or pass -read-only-fallback to serve reads through it", locked)
+		case err != nil:
+			log.Fatalf("failed to lock data directory: %v", err)
+		default:
+			defer lock.release()
+		}
+	}
+
+	drain := newStreamDrain(*watchMaxAge)
+	var svc services
+	var srv *server
+	var rep *replica
+	var guard *diskGuard
+	if upstream != "" {
+		log.Printf("Proxying to %v...\n", upstream)
+		p, err := newProxyServer(upstream, *cacheTTL, grpcFlags.maxSendMsgSize)
+		if err != nil {
+			log.Fatalf("failed to dial upstream: %v", err)
+		}
+		defer p.Close()
+		p.drain = drain
+		svc = proxyServices(p)
+	} else {
+		if memory {
+			log.Printf("Opening in-memory database...\n")
+		} else {
+			log.Printf("Opening %s database...\n", *storageDriver)
+		}
+		opts := dbOptions{dir: dir, readOnly: *readOnlyMode, memory: memory, keyRotation: *keyRotation, badger: badgerTuning}
+		if *encryptionKeyFile != "" {
+			key, err := readEncryptionKey(*encryptionKeyFile)
+			if err != nil {
+				log.Fatalf("invalid -encryption-key-file: %v", err)
+			}
+			opts.encryptionKey = key
+		}
+		db, err := openDB(*storageDriver, opts)
+		if err != nil {
+			log.Fatalf("failed to open database in %s: %v", dir, err)
+		}
+		defer db.Close()
+		// Emptiness is checked before anything is written, such as the key
+		// schema, so seeding happens on the first start only.
+		seedDB := false
+		if seedClasses != nil {
+			if seedDB, err = isEmptyDB(db); err != nil {
+				log.Fatalf("failed to open database in %s: %v", dir, err)
+			}
+		}
+		if *readOnlyMode {
+			err = checkKeySchema(db)
+		} else {
+			err = migrateKeySchema(db)
+		}
+		if err != nil {
+			log.Fatalf("failed to open database in %s: %v", dir, err)
+		}
+		loc, err := time.LoadLocation(*timeZone)
+		if err != nil {
+			log.Fatalf("invalid -timezone: %v", err)
+		}
+		calendar, err := parseCalendar(*calendarSpec, loc)
+		if err != nil {
+			log.Fatalf("invalid -semester-calendar: %v", err)
+		}
+		if *offboardDir != "" {
+			if err := checkOffboardDir(*offboardDir); err != nil {
+				log.Fatalf("invalid -offboard-dir: %v", err)
+			}
+		}
+		srv = &server{
+			db:              db,
+			events:          newEventBus(),
+			calendar:        calendar,
+			offboardDir:     *offboardDir,
+			checkInvariants: *checkInvariants,
+			snapshots:       newSnapshotRegistry(*listSnapshotTTL),
+			cache:           newReadCache(*cacheSize),
+			drain:           drain,
+		}
+		defer srv.snapshots.close()
+		srv.setTuning(tunables{
+			coalesceWindow:  *coalesceWindow,
+			statsMinCount:   *statsMinCount,
+			listMaxResults:  *listMaxResults,
+			listParallelism: *listParallelism,
+			paginationMode:  *paginationMode,
+			clientPolicy:    clientPolicy,
+		})
+		// Writes need the audit log, and repairs are writes, so a read-only
+		// adapter needs neither; corrupt classes are still quarantined.
+		if !*readOnlyMode {
+			srv.audit, err = newAuditLog(db)
+			if err != nil {
+				log.Fatalf("failed to open audit log: %v", err)
+			}
+			defer srv.audit.close()
+			repairCtx, cancelRepairs := context.WithCancel(context.Background())
+			defer cancelRepairs()
+			go srv.repairCorrupt(repairCtx)
+		}
+		srv.changelog, err = newChangelog(db, *changelogMaxEntries)
+		if err != nil {
+			log.Fatalf("failed to open changelog: %v", err)
+		}
+		if !*readOnlyMode {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go srv.changelog.run(ctx)
+		}
+		if *fsckOnStart != fsckOff {
+			found, left, err := srv.fsck(context.Background(), *fsckOnStart == fsckRepair)
+			if err != nil {
+				log.Fatalf("failed to check database: %v", err)
+			}
+			log.Printf("Database check found %d problems, %d left unrepaired", found, left)
+		}
+		if *eventsURL != "" {
+			log.Printf("Publishing class events to %v...\n", *eventsURL)
+			sink, err := newNATSSink(*eventsURL, *eventsSubject)
+			if err != nil {
+				log.Fatalf("failed to connect to event broker: %v", err)
+			}
+			defer sink.Close()
+			srv.outbox, err = newOutbox(db, sink)
+			if err != nil {
+				log.Fatalf("failed to open event outbox: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go srv.outbox.run(ctx)
+		}
+		if webhookTargets != nil {
+			log.Printf("Sending class events to %d webhooks...\n", len(webhookTargets))
+			srv.webhooks, err = newWebhooks(db, webhookTargets, webhookSecret, *webhookMaxAttempts)
+			if err != nil {
+				log.Fatalf("failed to open webhook queues: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go srv.webhooks.run(ctx)
+		}
+		if seedDB {
+			if err := srv.seed(context.Background(), *seedTenant, seedClasses); err != nil {
+				log.Fatalf("failed to seed classes from %s: %v", *seedFile, err)
+			}
+		} else if seedClasses != nil {
+			log.Printf("Not seeding classes from %s: the database isn't empty", *seedFile)
+		}
+		// A read-only database can't fill its disk, and an in-memory one
+		// has none.
+		if !*readOnlyMode && !memory {
+			guard = newDiskGuard(db, dir, *maxDBSize, *minFreeDisk)
+			unary = append(unary, guard.unaryInterceptor)
+			stream = append(stream, guard.streamInterceptor)
+		}
+		// Faults start once the database is open and set up, so they can't
+		// fail the start itself.
+		if faults != nil {
+			log.Printf("Injecting faults into %g%% of storage transactions and delays of up to %s into %g%%", *faultErrorPercent, *faultMaxDelay, *faultDelayPercent)
+			srv.db = faultyDB{srv.db, faults}
+		}
+		if *replicaOf != "" {
+			creds, err := dialCredentials(*replicaOf)
+			if err != nil {
+				log.Fatalf("failed to dial -replica-of: %v", err)
+			}
+			conn, err := grpc.Dial(*replicaOf, creds,
+				grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(grpcFlags.maxSendMsgSize)))
+			if err != nil {
+				log.Fatalf("failed to dial -replica-of: %v", err)
+			}
+			defer conn.Close()
+			rep = newReplica(srv, conn, *replicaOf, strings.Split(*replicaTenants, ","), replicaToken)
+		}
+		svc = localServices(srv, *kvMaxKeys, *kvMaxValueSize)
 	}
 
-	s := grpc.NewServer()
-	pb.RegisterAdapterServer(s, &server{
-		db: db,
+	if *debugAddr != "" {
+		go serveDebug(*debugAddr)
+	}
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr)
+	}
+	if *sqlAddr != "" {
+		if srv == nil {
+			log.Fatalf("-sql-addr needs local storage; run it on the adapter at %s", upstream)
+		}
+		go serveSQL(*sqlAddr, &sqlHandler{s: srv, auth: auth, timeout: *sqlTimeout, maxRows: *sqlMaxRows})
+	}
+	if *snapshotDir != "" {
+		switch {
+		case srv == nil:
+			log.Fatalf("-snapshot-dir needs local storage; run it on the adapter at %s", upstream)
+		case *snapshotInterval <= 0:
+			log.Fatalf("-snapshot-interval must be positive")
+		}
+		if err := checkSnapshotDir(*snapshotDir); err != nil {
+			log.Fatalf("invalid -snapshot-dir: %v", err)
+		}
+		log.Printf("Exporting classes to %v every %v...\n", *snapshotDir, *snapshotInterval)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go srv.exportSnapshots(ctx, *snapshotDir, *snapshotInterval)
+	}
+	if *classroomTokenFile != "" {
+		switch {
+		case srv == nil:
+			log.Fatalf("-classroom-token-file needs local storage; run it on the adapter at %s", upstream)
+		case *readOnlyMode || *replicaOf != "":
+			log.Fatalf("-classroom-token-file can't be used with -read-only or -replica-of")
+		case *classroomInterval < 0:
+			log.Fatalf("-classroom-interval must not be negative")
+		case !tenantPattern.MatchString(*classroomTenant):
+			log.Fatalf("invalid -classroom-tenant %q, must match %s", *classroomTenant, tenantPattern)
+		case *classroomSemester != "" && !semesterPattern.MatchString(*classroomSemester):
+			log.Fatalf("invalid -classroom-semester %q, must match %s", *classroomSemester, semesterPattern)
+		}
+		srv.classroom = newClassroomSync(newClassroomClient(*classroomTokenFile), *classroomTenant, *classroomSemester)
+		if *classroomInterval > 0 {
+			log.Printf("Syncing classes from Google Classroom every %v...\n", *classroomInterval)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go srv.syncClassroomEvery(ctx, *classroomInterval)
+		}
+	}
+
+	go reloadOnHangup(fs, "config", commandLine, func() error {
+		if !validPaginationMode(*paginationMode) {
+			return fmt.Errorf("invalid -pagination %q, must be optional, warn or strict", *paginationMode)
+		}
+		if err := auth.load(*authTokensFile); err != nil {
+			return fmt.Errorf("load auth tokens: %w", err)
+		}
+		clientPolicy, err := loadClientPolicy(*clientPolicyFile)
+		if err != nil {
+			return fmt.Errorf("load client policy: %w", err)
+		}
+		timeouts, err := parseMethodTimeouts(*methodTimeouts)
+		if err != nil {
+			return fmt.Errorf("invalid -method-timeouts: %w", err)
+		}
+		sampleRates, err := parseSampleRates(*accessLogRates)
+		if err != nil {
+			return fmt.Errorf("invalid -access-log-sample-rates: %w", err)
+		}
+		limiter.setLimits(*rateLimit, *rateBurst, *clientRateLimit, *clientRateBurst)
+		deadlines.set(*defaultTimeout, timeouts)
+		accessLog.set(*accessLogEnabled, sampleRates)
+		if faults != nil {
+			if err := checkFaultSettings(*faultErrorPercent, *faultDelayPercent, *faultMaxDelay); err != nil {
+				return err
+			}
+			faults.set(*faultErrorPercent, *faultDelayPercent, *faultMaxDelay)
+		}
+		if guard != nil {
+			if err := checkDiskGuardSettings(*maxDBSize, *minFreeDisk); err != nil {
+				return err
+			}
+			guard.set(*maxDBSize, *minFreeDisk)
+		}
+		if srv != nil {
+			srv.setTuning(tunables{
+				coalesceWindow:  *coalesceWindow,
+				statsMinCount:   *statsMinCount,
+				listMaxResults:  *listMaxResults,
+				listParallelism: *listParallelism,
+				paginationMode:  *paginationMode,
+				clientPolicy:    clientPolicy,
+			})
+		}
+		return nil
 	})
-	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
-	reflection.Register(s)
+
+	for _, l := range listeners {
+		if l.tls != nil {
+			log.Printf("Listening on %v with TLS...\n", l.addr)
+		} else {
+			log.Printf("Listening on %v...\n", l.addr)
+		}
+	}
+	socketMode, err := parseSocketMode(*listenSocketMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lis, err := openListeners(listeners, socketMode)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	var s grpcServer
+	var hs *health.Server
+	if *xdsMode {
+		log.Printf("Taking listener and security configuration from the xDS control plane in %s...\n", os.Getenv(xdsBootstrapEnv))
+		s, hs, err = newXDSServer(svc, grpcFlags.options(), unary, stream)
+		if err != nil {
+			log.Fatalf("failed to set up xDS: %v", err)
+		}
+	} else {
+		gs, ghs := newGRPCServer(svc, grpcFlags.options(), unary, stream)
+		if *enableReflection {
+			reflection.Register(gs)
+		}
+		s, hs = gs, ghs
+	}
+	if rep != nil {
+		// Health checks fail until every tenant has been copied once.
+		hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		log.Printf("Replicating from %v...\n", *replicaOf)
+		go rep.run(ctx, func() {
+			log.Printf("Replica is in step with %v", *replicaOf)
+			hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+		})
+	}
+
+	if guard != nil {
+		// Health checks fail while writes are refused, so load balancers
+		// send traffic to an adapter with room.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go guard.run(ctx, *diskCheckInterval, func(full bool) {
+			if full {
+				hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+			} else {
+				hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+			}
+		})
+	}
+
+	go stopOnSignal(s, hs, drain, *shutdownGrace, takeover)
 
 	log.Printf("Serving gRPC...\n")
-	if err := s.Serve(lis); err != nil {
+	if err := serveAll(s, lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
+	select {
+	case <-takeover:
+		log.Printf("Restarting to follow the lease...\n")
+		restartSelf()
+	default:
+	}
+}
+
+// interceptors returns the chains every adapter runs calls through, in
+// order; modes such as -read-only append to them. Recovery comes right
+// after the metrics, so a recovered panic is still counted and logged as an
+// Internal error.
+func interceptors(accessLog *accessLog, deadlines *deadlines, auth *tokenAuth, limiter *rateLimiter) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	unary := []grpc.UnaryServerInterceptor{requestIdUnaryInterceptor, accessLog.unaryInterceptor, metricsUnaryInterceptor, recoverUnaryInterceptor, deadlines.unaryInterceptor, auth.unaryInterceptor, limiter.unaryInterceptor, validationUnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{requestIdStreamInterceptor, accessLog.streamInterceptor, metricsStreamInterceptor, recoverStreamInterceptor, auth.streamInterceptor, limiter.streamInterceptor, validationStreamInterceptor}
+	return unary, stream
+}
+
+// services are the gRPC services an adapter serves, from its own storage
+// or an upstream adapter's.
+type services struct {
+	adapter     pb.AdapterServer
+	kv          pb.KeyValueStoreServer
+	instructors pb.InstructorsServer
+	classes     adapterv2.ClassesServer
+}
+
+func localServices(srv *server, kvMaxKeys, kvMaxValueSize int) services {
+	return services{
+		adapter:     srv,
+		kv:          &kvStore{s: srv, maxKeys: kvMaxKeys, maxValueSize: kvMaxValueSize},
+		instructors: &instructorStore{s: srv},
+		classes:     &classesV2{s: srv},
+	}
+}
+
+func proxyServices(p *proxyServer) services {
+	return services{
+		adapter:     p,
+		kv:          &kvProxy{upstream: pb.NewKeyValueStoreClient(p.conn)},
+		instructors: &instructorProxy{upstream: pb.NewInstructorsClient(p.conn)},
+		classes:     &classesV2Proxy{p: p, upstream: adapterv2.NewClassesClient(p.conn)},
+	}
+}
+
+// newGRPCServer returns a gRPC server serving svc and health checks, which
+// skip the interceptors so probes stay cheap.
+func newGRPCServer(svc services, opts []grpc.ServerOption, unary []grpc.UnaryServerInterceptor, stream []grpc.StreamServerInterceptor) (*grpc.Server, *health.Server) {
+	s := grpc.NewServer(serverOptions(opts, unary, stream)...)
+	return s, registerServices(s, svc)
+}
+
+// serverOptions adds the interceptor chains to opts.
+func serverOptions(opts []grpc.ServerOption, unary []grpc.UnaryServerInterceptor, stream []grpc.StreamServerInterceptor) []grpc.ServerOption {
+	return append(opts,
+		grpc.UnaryInterceptor(healthFastPathUnary(unary...)),
+		grpc.StreamInterceptor(healthFastPathStream(stream...)),
+	)
+}
+
+// registerServices registers svc and health checks with s, returning the
+// health server.
+func registerServices(s grpc.ServiceRegistrar, svc services) *health.Server {
+	pb.RegisterAdapterServer(s, svc.adapter)
+	pb.RegisterKeyValueStoreServer(s, svc.kv)
+	pb.RegisterInstructorsServer(s, svc.instructors)
+	adapterv2.RegisterClassesServer(s, svc.classes)
+	hs := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, hs)
+	return hs
+}
+
+// stopOnSignal stops s on SIGINT or SIGTERM, letting serve return and close
+// the database; Badger won't open a database read-only unless it was closed.
+// Health checks report NOT_SERVING and Watch streams end with UNAVAILABLE
+// first, so clients move to another server, then in-flight calls get grace
+// to finish. A standby stops the same way when restart is closed.
+func stopOnSignal(s grpcServer, hs *health.Server, drain *streamDrain, grace time.Duration, restart <-chan struct{}) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-stop:
+	case <-restart:
+	}
+	log.Printf("Shutting down...\n")
+	hs.Shutdown()
+	drain.start()
+	t := time.AfterFunc(grace, s.Stop)
+	s.GracefulStop()
+	t.Stop()
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const defaultDiscardRatio = 0.5
+
+// lastGCKey holds the time the last AdminRunGC finished.
+const lastGCKey = metaPrefix + "last-gc"
+
+func (s *server) AdminCompact(ctx context.Context, in *pb.Empty) (*pb.MaintenanceResult, error) {
+	logf(ctx, "AdminCompact called")
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return s.maintain("Compaction", func() (int, error) {
+		return 0, s.db.Compact()
+	})
+}
+
+func (s *server) AdminRunGC(ctx context.Context, in *pb.RunGCRequest) (*pb.MaintenanceResult, error) {
+	logf(ctx, "AdminRunGC called with discard ratio %g", in.DiscardRatio)
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	ratio := in.DiscardRatio
+	if ratio == 0 {
+		ratio = defaultDiscardRatio
+	}
+	return s.maintain("Value log GC", func() (int, error) {
+		n, err := s.db.RunGC(ratio)
+		if err != nil {
+			return n, err
+		}
+		return n, s.db.Update(func(txn kvTxn) error {
+			return txn.Set([]byte(lastGCKey), []byte(formatTime(timestamppb.Now())))
+		})
+	})
+}
+
+func (s *server) Stats(ctx context.Context, in *pb.Empty) (*pb.StatsResponse, error) {
+	logf(ctx, "Stats called")
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.StatsResponse{}
+	resp.LsmSize, resp.VlogSize = s.db.Size()
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		if resp.ClassCount, err = countClasses(txn); err != nil {
+			return err
+		}
+		item, err := txn.Txn.Get([]byte(lastGCKey))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			resp.LastGcTime, err = parseTime(string(v))
+			return err
+		})
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return resp, nil
+}
+
+// maintain runs one maintenance task at a time, measuring the space it
+// reclaims. It keeps running if the caller goes away, since the storage
+// engine can't stop it partway.
+func (s *server) maintain(name string, run func() (int, error)) (*pb.MaintenanceResult, error) {
+	if !atomic.CompareAndSwapInt32(&s.maintaining, 0, 1) {
+		return nil, status.Error(codes.Aborted, "another compaction or GC is running, retry once it has finished")
+	}
+	defer atomic.StoreInt32(&s.maintaining, 0)
+
+	start := time.Now()
+	before, err := s.db.DiskSize()
+	if err != nil {
+		return nil, storageError(err)
+	}
+	rewritten, err := run()
+	if err != nil {
+		return nil, storageError(err)
+	}
+	after, err := s.db.DiskSize()
+	if err != nil {
+		return nil, storageError(err)
+	}
+	res := &pb.MaintenanceResult{
+		SizeBefore:     before,
+		SizeAfter:      after,
+		FilesRewritten: int32(rewritten),
+		Duration:       durationpb.New(time.Since(start)),
+	}
+	log.Printf("%s took %s, rewrote %d files and took the database from %d to %d bytes", name, res.Duration.AsDuration(), rewritten, before, after)
+	return res, nil
+}
+
+// runMaintenance asks a running adapter to compact its database or run
+// value log GC, since only the adapter that owns a data directory can.
+func runMaintenance(cmd string, args []string) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	addr := fs.String("addr", "localhost"+port, "address of the adapter to maintain")
+	token := fs.String("token", "", "admin bearer token, if the adapter requires one")
+	timeout := fs.Duration("timeout", time.Hour, "how long to wait for the adapter to finish")
+	var ratio *float64
+	if cmd == "gc" {
+		ratio = fs.Float64("discard-ratio", defaultDiscardRatio, "share of a value log file that must be stale for it to be rewritten")
+	}
+	fs.Parse(args)
+
+	conn, err := grpc.Dial(*addr, grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("%s: %s", cmd, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if *token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+*token)
+	}
+
+	c := pb.NewAdapterClient(conn)
+	var res *pb.MaintenanceResult
+	if cmd == "gc" {
+		res, err = c.AdminRunGC(ctx, &pb.RunGCRequest{DiscardRatio: *ratio})
+	} else {
+		res, err = c.AdminCompact(ctx, &pb.Empty{})
+	}
+	if err != nil {
+		log.Fatalf("%s: %s", cmd, err)
+	}
+	fmt.Fprintf(os.Stdout, "%d bytes before, %d after, %d reclaimed; %d value log files rewritten in %s\n",
+		res.SizeBefore, res.SizeAfter, res.SizeBefore-res.SizeAfter, res.FilesRewritten, res.Duration.AsDuration())
+}
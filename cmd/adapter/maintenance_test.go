@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaintenance(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		ctx := context.Background()
+		putTestClasses(t, s.db, orderTestClasses...)
+		if size, err := s.db.DiskSize(); err != nil || size <= 0 {
+			t.Errorf("DiskSize with classes stored returned %d, %v", size, err)
+		}
+		for _, c := range orderTestClasses {
+			if _, err := s.Delete(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := s.AdminCompact(ctx, &pb.Empty{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.AdminRunGC(ctx, &pb.RunGCRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := validateRequest("/class.Adapter/AdminRunGC", &pb.RunGCRequest{DiscardRatio: 1}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("a discard ratio of 1 returned %v, want InvalidArgument", err)
+		}
+
+		s.maintaining = 1
+		if _, err := s.AdminCompact(ctx, &pb.Empty{}); status.Code(err) != codes.Aborted {
+			t.Errorf("a second compaction returned %v, want Aborted", err)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		ctx := context.Background()
+		putTestClasses(t, s.db, orderTestClasses...)
+
+		resp, err := s.Stats(ctx, &pb.Empty{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ClassCount != int64(len(orderTestClasses)) {
+			t.Errorf("ClassCount = %d, want %d", resp.ClassCount, len(orderTestClasses))
+		}
+		if resp.LastGcTime != nil {
+			t.Errorf("LastGcTime = %v before any GC, want unset", resp.LastGcTime)
+		}
+		if got, err := s.Stats(tenantContext("other"), &pb.Empty{}); err != nil || got.ClassCount != 0 {
+			t.Errorf("Stats for another tenant returned %v, %v, want no classes", got, err)
+		}
+
+		if _, err := s.AdminRunGC(ctx, &pb.RunGCRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err = s.Stats(ctx, &pb.Empty{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.LastGcTime == nil {
+			t.Error("LastGcTime unset after AdminRunGC")
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "adapter_grpc_requests_total",
+		Help: "gRPC requests handled, by method and status code.",
+	}, []string{"method", "code"})
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "adapter_grpc_request_duration_seconds",
+		Help:    "gRPC request latency, by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeRPC(info.FullMethod, start, err)
+	return err
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	rpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	rpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+}
+
+// serveMetrics exposes the Prometheus registry on addr until the process exits.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Printf("Serving metrics on %v...\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("failed to serve metrics: %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Offboarding certificates are kept under offboardPrefix by tenant, outside
+// the tenant's own keyspace so they outlive it.
+const offboardPrefix = metaPrefix + "offboarded/"
+
+// tenantGate refuses a tenant's writes while it is being offboarded, so
+// nothing is written after the export that the delete would then remove.
+// The zero value is ready to use.
+type tenantGate struct {
+	mu      sync.Mutex
+	locks   map[string]*sync.RWMutex
+	closing map[string]bool
+}
+
+func (g *tenantGate) lock(tenant string) *sync.RWMutex {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.locks == nil {
+		g.locks = make(map[string]*sync.RWMutex)
+		g.closing = make(map[string]bool)
+	}
+	l, ok := g.locks[tenant]
+	if !ok {
+		l = &sync.RWMutex{}
+		g.locks[tenant] = l
+	}
+	return l
+}
+
+func (g *tenantGate) isClosing(tenant string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closing[tenant]
+}
+
+// enter admits a write to tenant, which must call release once committed.
+// Writes are refused rather than queued behind an offboarding, which may
+// take as long as exporting the whole tenant.
+func (g *tenantGate) enter(tenant string) (release func(), err error) {
+	refused := preconditionFailed(preconditionOffboarding, "tenants/"+tenant, "tenant %s is being offboarded", tenant)
+	if g.isClosing(tenant) {
+		return nil, refused
+	}
+	l := g.lock(tenant)
+	l.RLock()
+	// The tenant may have started closing while this waited for the lock.
+	if g.isClosing(tenant) {
+		l.RUnlock()
+		return nil, refused
+	}
+	return l.RUnlock, nil
+}
+
+// close refuses new writes to tenant and waits for those in progress. It
+// returns false if the tenant is already closed.
+func (g *tenantGate) close(tenant string) bool {
+	l := g.lock(tenant)
+	g.mu.Lock()
+	if g.closing[tenant] {
+		g.mu.Unlock()
+		return false
+	}
+	g.closing[tenant] = true
+	g.mu.Unlock()
+	l.Lock()
+	return true
+}
+
+func (g *tenantGate) reopen(tenant string) {
+	g.mu.Lock()
+	delete(g.closing, tenant)
+	l := g.locks[tenant]
+	g.mu.Unlock()
+	l.Unlock()
+}
+
+// exportTenant reads every key of tenant, including its saved queries, and
+// counts its classes.
+func exportTenant(txn kvTxn, tenant string) (*pb.TenantArchive, int64, error) {
+	archive := &pb.TenantArchive{Tenant: tenant, Time: timestamppb.New(time.Now())}
+	prefixes := []struct {
+		prefix []byte
+		global bool
+	}{
+		{tenantPrefix(tenant), false},
+		{[]byte(queryPrefix + tenant + "/"), true},
+	}
+	for _, p := range prefixes {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = p.prefix
+		it := txn.NewIterator(opts)
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				it.Close()
+				return nil, 0, err
+			}
+			key := item.KeyCopy(nil)
+			if !p.global {
+				key = key[len(p.prefix):]
+			}
+			archive.Entries = append(archive.Entries, &pb.TenantArchive_Entry{
+				Key:       key,
+				Value:     v,
+				Global:    p.global,
+				ExpiresAt: item.ExpiresAt(),
+			})
+		}
+		it.Close()
+	}
+	classes, err := countClasses(newTenantTxn(txn, tenant))
+	return archive, classes, err
+}
+
+// sealArchive encrypts b with AES-256-GCM, authenticating the tenant name,
+// and prepends the nonce.
+func sealArchive(key []byte, tenant string, b []byte) ([]byte, error) {
+	gcm, err := archiveCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, b, []byte(tenant)), nil
+}
+
+func openArchive(key []byte, tenant string, sealed []byte) ([]byte, error) {
+	gcm, err := archiveCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("archive is truncated")
+	}
+	n := gcm.NonceSize()
+	return gcm.Open(nil, sealed[:n], sealed[n:], []byte(tenant))
+}
+
+func archiveCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeArchive writes the sealed archive and reads it back, failing unless
+// it decrypts to exactly plain.
+func writeArchive(path string, key []byte, tenant string, plain []byte) ([]byte, error) {
+	sealed, err := sealArchive(key, tenant, plain)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, sealed, 0600); err != nil {
+		return nil, err
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	got, err := openArchive(key, tenant, written)
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %w", path, err)
+	}
+	if !bytes.Equal(got, plain) {
+		return nil, fmt.Errorf("verify %s: contents differ from the export", path)
+	}
+	sum := sha256.Sum256(written)
+	return sum[:], nil
+}
+
+func (v *violations) checkOffboardTenant(in *pb.OffboardTenantRequest) {
+	switch {
+	case in.Tenant == defaultTenant:
+		v.add("tenant", "the default tenant can't be offboarded")
+	case !tenantPattern.MatchString(in.Tenant):
+		v.add("tenant", "must match %s", tenantPattern)
+	}
+	if len(in.ArchiveKey) != 32 {
+		v.add("archive_key", "must be 32 bytes")
+	}
+}
+
+func (s *server) AdminOffboardTenant(ctx context.Context, in *pb.OffboardTenantRequest) (*pb.OffboardCertificate, error) {
+	logf(ctx, "AdminOffboardTenant called for tenant %s", in.Tenant)
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	// The tenant is named in the request, so authorize couldn't check it.
+	if !allowsTenant(ctx, in.Tenant) {
+		return nil, status.Errorf(codes.PermissionDenied, "token may not be used for tenant %s", in.Tenant)
+	}
+	if s.offboardDir == "" {
+		return nil, preconditionFailed(preconditionServer, "server", "offboarding needs the server to run with -offboard-dir")
+	}
+	if !s.offboarding.close(in.Tenant) {
+		return nil, status.Errorf(codes.Aborted, "tenant %s is already being offboarded", in.Tenant)
+	}
+	defer s.offboarding.reopen(in.Tenant)
+
+	var archive *pb.TenantArchive
+	var classes int64
+	err := s.db.View(func(txn kvTxn) error {
+		var err error
+		archive, classes, err = exportTenant(txn, in.Tenant)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	if len(archive.Entries) == 0 {
+		return nil, status.Errorf(codes.NotFound, "tenant %s has no data", in.Tenant)
+	}
+	plain, err := proto.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s.archive", in.Tenant, archive.Time.AsTime().Format("20060102T150405Z"))
+	sum, err := writeArchive(filepath.Join(s.offboardDir, name), in.ArchiveKey, in.Tenant, plain)
+	if err != nil {
+		logf(ctx, "Error writing offboarding archive for tenant %s: %s", in.Tenant, err)
+		return nil, status.Error(codes.Internal, "failed to write the archive")
+	}
+
+	if err := s.db.DropPrefix(tenantPrefix(in.Tenant), []byte(queryPrefix+in.Tenant+"/")); err != nil {
+		return nil, storageError(err)
+	}
+	s.cache.invalidate(in.Tenant)
+	cert := &pb.OffboardCertificate{
+		Tenant:        in.Tenant,
+		Time:          timestamppb.New(time.Now()),
+		Actor:         actorFromContext(ctx),
+		Archive:       name,
+		ArchiveSha256: sum,
+		KeyCount:      int64(len(archive.Entries)),
+		ClassCount:    classes,
+	}
+	b, err := proto.Marshal(cert)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Update(func(txn kvTxn) error {
+		return txn.Set([]byte(offboardPrefix+in.Tenant), b)
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	logf(ctx, "Offboarded tenant %s: %d keys archived to %s", in.Tenant, cert.KeyCount, name)
+	return cert, nil
+}
+
+func (s *server) AdminListOffboardCertificates(ctx context.Context, in *pb.Empty) (*pb.OffboardCertificates, error) {
+	logf(ctx, "AdminListOffboardCertificates called")
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	certs := &pb.OffboardCertificates{}
+	err := s.db.View(func(txn kvTxn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(offboardPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			// Only certificates of tenants the token was granted.
+			if !allowsTenant(ctx, strings.TrimPrefix(string(it.Item().Key()), offboardPrefix)) {
+				continue
+			}
+			c := &pb.OffboardCertificate{}
+			err := it.Item().Value(func(val []byte) error {
+				return proto.Unmarshal(val, c)
+			})
+			if err != nil {
+				return fmt.Errorf("read %s: %w", strings.TrimPrefix(string(it.Item().Key()), offboardPrefix), err)
+			}
+			certs.Certificates = append(certs.Certificates, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return certs, nil
+}
+
+// checkOffboardDir makes sure archives can be written to dir.
+func checkOffboardDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
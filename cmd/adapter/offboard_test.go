@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestOffboardTenant(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), offboardDir: t.TempDir()}
+		kv := &kvStore{s: s, maxKeys: 10, maxValueSize: 64}
+		acme, other := tenantContext("acme"), tenantContext("other")
+		for _, ctx := range []context.Context{acme, other} {
+			for _, c := range []*pb.Class{{Id: "MATH101", Name: "Algebra"}, {Id: "MATH102", Name: "Geometry"}} {
+				if _, err := s.Create(ctx, c); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.SaveQuery(ctx, &pb.SavedQuery{Name: "fall", Query: &pb.ClassQuery{Semester: "2024-FALL"}}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := kv.Put(ctx, &pb.KeyValue{Namespace: "sessions", Key: "s0", Value: []byte("active")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Writes to a tenant are refused while it is offboarded.
+		if !s.offboarding.close("acme") {
+			t.Fatal("close of an open tenant failed")
+		}
+		if _, err := s.Create(acme, &pb.Class{Id: "MATH103", Name: "Calculus"}); status.Code(err) != codes.FailedPrecondition || preconditionType(err) != preconditionOffboarding {
+			t.Errorf("Create during offboarding returned %v, want FailedPrecondition of type %s", err, preconditionOffboarding)
+		}
+		if _, err := s.Create(other, &pb.Class{Id: "MATH103", Name: "Calculus"}); err != nil {
+			t.Errorf("Create for another tenant during offboarding returned %v", err)
+		}
+		s.offboarding.reopen("acme")
+
+		admin := context.WithValue(acme, roleKey{}, "admin")
+		key := bytes.Repeat([]byte{7}, 32)
+		cert, err := s.AdminOffboardTenant(admin, &pb.OffboardTenantRequest{Tenant: "acme", ArchiveKey: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.ClassCount != 2 || cert.KeyCount == 0 {
+			t.Errorf("the certificate counts %d classes in %d keys, want 2 classes", cert.ClassCount, cert.KeyCount)
+		}
+
+		// The archive holds everything the tenant had, decryptable only with
+		// its key, and matches the certificate.
+		sealed, err := ioutil.ReadFile(filepath.Join(s.offboardDir, cert.Archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := sha256.Sum256(sealed); !bytes.Equal(sum[:], cert.ArchiveSha256) {
+			t.Error("the archive doesn't match the certificate's SHA-256")
+		}
+		if _, err := openArchive(bytes.Repeat([]byte{8}, 32), "acme", sealed); err == nil {
+			t.Error("the archive opened with the wrong key")
+		}
+		if _, err := openArchive(key, "other", sealed); err == nil {
+			t.Error("the archive opened as another tenant's")
+		}
+		plain, err := openArchive(key, "acme", sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive := &pb.TenantArchive{}
+		if err := proto.Unmarshal(plain, archive); err != nil {
+			t.Fatal(err)
+		}
+		var global int
+		for _, e := range archive.Entries {
+			if e.Global {
+				global++
+			}
+		}
+		if archive.Tenant != "acme" || int64(len(archive.Entries)) != cert.KeyCount || global != 1 {
+			t.Errorf("the archive of %s has %d entries, %d global; want %d, 1 global", archive.Tenant, len(archive.Entries), global, cert.KeyCount)
+		}
+
+		// Nothing of the tenant is readable afterwards.
+		if c, err := s.Get(acme, &pb.GetRequest{Id: "MATH101"}); err != nil || c.Name != "" {
+			t.Errorf("Get after offboarding returned %v, %v; want no class", c, err)
+		}
+		if cs, err := s.List(acme, &pb.ListRequest{}); err != nil || len(cs.Classes) != 0 {
+			t.Errorf("List after offboarding returned %v, %v", cs, err)
+		}
+		if qs, err := s.ListSavedQueries(acme, &pb.Empty{}); err != nil || len(qs.Queries) != 0 {
+			t.Errorf("ListSavedQueries after offboarding returned %v, %v", qs, err)
+		}
+		if _, err := kv.Get(acme, &pb.KeyRequest{Namespace: "sessions", Key: "s0"}); status.Code(err) != codes.NotFound {
+			t.Errorf("KeyValueStore.Get after offboarding returned %v, want NotFound", err)
+		}
+		if _, err := s.AdminOffboardTenant(admin, &pb.OffboardTenantRequest{Tenant: "acme", ArchiveKey: key}); status.Code(err) != codes.NotFound {
+			t.Errorf("a second AdminOffboardTenant returned %v, want NotFound", err)
+		}
+
+		// Other tenants are untouched.
+		if cs, err := s.List(other, &pb.ListRequest{}); err != nil || !equalIds(ids(cs.Classes), []string{"MATH101", "MATH102", "MATH103"}) {
+			t.Errorf("the other tenant's List returned %v, %v", cs, err)
+		}
+		if qs, err := s.ListSavedQueries(other, &pb.Empty{}); err != nil || len(qs.Queries) != 1 {
+			t.Errorf("the other tenant's ListSavedQueries returned %v, %v", qs, err)
+		}
+		if e, err := kv.Get(other, &pb.KeyRequest{Namespace: "sessions", Key: "s0"}); err != nil || string(e.Value) != "active" {
+			t.Errorf("the other tenant's KeyValueStore.Get returned %v, %v", e, err)
+		}
+
+		certs, err := s.AdminListOffboardCertificates(admin, &pb.Empty{})
+		if err != nil || len(certs.Certificates) != 1 || !proto.Equal(certs.Certificates[0], cert) {
+			t.Errorf("AdminListOffboardCertificates returned %v, %v; want the one certificate", certs, err)
+		}
+		if _, err := s.AdminOffboardTenant(context.WithValue(other, roleKey{}, ""), &pb.OffboardTenantRequest{Tenant: "other", ArchiveKey: key}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("AdminOffboardTenant with a regular token returned %v, want PermissionDenied", err)
+		}
+	})
+}
+
+func TestOffboardTenantGrant(t *testing.T) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens")
+	if err := ioutil.WriteFile(tokensFile, []byte("acme-admin admin tenants=acme\nroot admin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := newTokenAuth(tokensFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// call authorizes token for method as the interceptor would.
+	call := func(token, method string) context.Context {
+		t.Helper()
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantMetadataKey, "acme", "authorization", "Bearer "+token))
+		ctx, err := auth.authorize(ctx, "/class.Adapter/"+method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctx
+	}
+
+	s := &server{db: newTestDB(t, driverBadger, t.TempDir()), events: newEventBus(), offboardDir: t.TempDir()}
+	for _, tenant := range []string{"acme", "other"} {
+		if _, err := s.Create(tenantContext(tenant), &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := bytes.Repeat([]byte{7}, 32)
+
+	// A token granted acme can't offboard another tenant by naming it.
+	_, err = s.AdminOffboardTenant(call("acme-admin", "AdminOffboardTenant"), &pb.OffboardTenantRequest{Tenant: "other", ArchiveKey: key})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("AdminOffboardTenant of another tenant returned %v, want PermissionDenied", err)
+	}
+	if c, err := s.Get(tenantContext("other"), &pb.GetRequest{Id: "MATH101"}); err != nil || c.Name != "Algebra" {
+		t.Errorf("after a refused AdminOffboardTenant, the tenant's Get returned %v, %v", c, err)
+	}
+	if _, err := s.AdminOffboardTenant(call("acme-admin", "AdminOffboardTenant"), &pb.OffboardTenantRequest{Tenant: "acme", ArchiveKey: key}); err != nil {
+		t.Errorf("AdminOffboardTenant of the granted tenant returned %v", err)
+	}
+	if _, err := s.AdminOffboardTenant(call("root", "AdminOffboardTenant"), &pb.OffboardTenantRequest{Tenant: "other", ArchiveKey: key}); err != nil {
+		t.Errorf("AdminOffboardTenant with a token for any tenant returned %v", err)
+	}
+
+	// Each token lists only the certificates of its tenants.
+	for _, tt := range []struct {
+		token string
+		want  []string
+	}{
+		{"acme-admin", []string{"acme"}},
+		{"root", []string{"acme", "other"}},
+	} {
+		certs, err := s.AdminListOffboardCertificates(call(tt.token, "AdminListOffboardCertificates"), &pb.Empty{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tenants []string
+		for _, c := range certs.Certificates {
+			tenants = append(tenants, c.Tenant)
+		}
+		sort.Strings(tenants)
+		if !equalIds(tenants, tt.want) {
+			t.Errorf("AdminListOffboardCertificates for %s listed %v, want %v", tt.token, tenants, tt.want)
+		}
+	}
+}
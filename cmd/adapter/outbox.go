@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+const (
+	outboxPrefix      = "outbox/"
+	outboxSequenceKey = "meta/outbox-seq"
+	outboxBatch       = 100
+	minPublishBackoff = 100 * time.Millisecond
+	maxPublishBackoff = 30 * time.Second
+	outboxPollPeriod  = time.Second
+)
+
+var (
+	eventsPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "adapter_events_published_total",
+		Help: "Class change events delivered to the broker.",
+	})
+	eventPublishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "adapter_event_publish_failures_total",
+		Help: "Failed attempts to deliver a class change event to the broker.",
+	})
+)
+
+// eventSink delivers an event to a broker, returning only once the broker has
+// durably accepted it. id is stable across retries of the same event.
+type eventSink interface {
+	deliver(id string, data []byte) error
+	Close()
+}
+
+// outbox records class events in the same transaction as the change itself
+// and relays them to a broker in order, retrying with backoff until each one
+// is acknowledged. Events survive restarts, so delivery is at-least-once.
+type outbox struct {
+	db   kvDB
+	seq  kvSequence
+	sink eventSink
+	wake chan struct{}
+}
+
+func newOutbox(db kvDB, sink eventSink) (*outbox, error) {
+	seq, err := db.GetSequence([]byte(outboxSequenceKey), 100)
+	if err != nil {
+		return nil, err
+	}
+	return &outbox{
+		db:   db,
+		seq:  seq,
+		sink: sink,
+		wake: make(chan struct{}, 1),
+	}, nil
+}
+
+// add queues e for delivery once txn commits. A nil outbox discards events.
+func (o *outbox) add(txn kvTxn, e *pb.ClassEvent) error {
+	if o == nil {
+		return nil
+	}
+	n, err := o.seq.Next()
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(fmt.Sprintf("%s%020d", outboxPrefix, n)), b)
+}
+
+// notify wakes the relay after a commit so events go out promptly.
+func (o *outbox) notify() {
+	if o == nil {
+		return
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run relays queued events until ctx is cancelled.
+func (o *outbox) run(ctx context.Context) {
+	defer o.seq.Release()
+	backoff := minPublishBackoff
+	for {
+		delay := outboxPollPeriod
+		wake := o.wake
+		if err := o.drain(); err != nil {
+			eventPublishFailures.Inc()
+			log.Printf("Error publishing class events, retrying in %s: %s", backoff, err)
+			delay = backoff
+			if backoff *= 2; backoff > maxPublishBackoff {
+				backoff = maxPublishBackoff
+			}
+			// Keep backing off rather than hammering a broker that is down.
+			wake = nil
+		} else {
+			backoff = minPublishBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(delay):
+		}
+	}
+}
+
+type outboxEntry struct {
+	key  []byte
+	data []byte
+}
+
+// drain delivers queued events oldest first, removing each once it has been
+// acknowledged.
+func (o *outbox) drain() error {
+	for {
+		var entries []outboxEntry
+		err := o.db.View(func(txn kvTxn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte(outboxPrefix)
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Rewind(); it.Valid() && len(entries) < outboxBatch; it.Next() {
+				v, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, outboxEntry{key: it.Item().KeyCopy(nil), data: v})
+			}
+			return nil
+		})
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+
+		for _, e := range entries {
+			if err := o.sink.deliver(string(e.key), e.data); err != nil {
+				return err
+			}
+			eventsPublished.Inc()
+			if err := o.db.Update(func(txn kvTxn) error {
+				return txn.Delete(e.key)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// natsSink publishes to a NATS JetStream stream, which must already be
+// configured to capture the subject.
+type natsSink struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+func newNATSSink(url, subject string) (*natsSink, error) {
+	conn, err := nats.Connect(url, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &natsSink{conn: conn, js: js, subject: subject}, nil
+}
+
+func (s *natsSink) deliver(id string, data []byte) error {
+	// The message id lets JetStream drop duplicates from retried publishes.
+	_, err := s.js.Publish(s.subject, data, nats.MsgId(id))
+	return err
+}
+
+func (s *natsSink) Close() {
+	s.conn.Close()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Pagination modes, from most to least lenient. Operators move clients onto
+// pagination by switching to warn, watching adapter_unpaginated_lists_total
+// and the warnings clients receive, and then switching to strict.
+const (
+	paginationOptional = "optional"
+	paginationWarn     = "warn"
+	paginationStrict   = "strict"
+)
+
+// paginationWarningKey is the response header carrying warnings about
+// unpaginated requests.
+const paginationWarningKey = "x-pagination-warning"
+
+var unpaginatedLists = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "adapter_unpaginated_lists_total",
+	Help: "List requests without a page_size, by method.",
+}, []string{"method"})
+
+func validPaginationMode(mode string) bool {
+	switch mode {
+	case paginationOptional, paginationWarn, paginationStrict:
+		return true
+	}
+	return false
+}
+
+func encodePageToken(lastId string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastId))
+}
+
+func decodePageToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errors.New("invalid page token")
+	}
+	return string(b), nil
+}
+
+// checkPage validates the paging fields of a list request, returning how
+// many classes to return at most (0 for no limit) and the Id the page starts
+// after. Requests without a page size are capped at listMaxResults and, as
+// the pagination mode requires, warned or rejected.
+func (s *server) checkPage(ctx context.Context, method string, pageSize int32, pageToken string) (limit int, after string, err error) {
+	t := s.tuning()
+	var v violations
+	if pageSize < 0 {
+		v.add("page_size", "must not be negative")
+	}
+	if pageToken != "" {
+		if after, err = decodePageToken(pageToken); err != nil {
+			v.add("page_token", "%s", err)
+		}
+	}
+	if pageSize == 0 && pageToken == "" {
+		unpaginatedLists.WithLabelValues(method).Inc()
+		switch t.paginationMode {
+		case paginationStrict:
+			v.add("page_size", "is required")
+		case paginationWarn:
+			logf(ctx, "Unpaginated %s request; page_size will soon be required", method)
+			grpc.SetHeader(ctx, metadata.Pairs(paginationWarningKey, "page_size will soon be required"))
+		}
+	}
+	if err := v.err(); err != nil {
+		return 0, "", err
+	}
+
+	limit = int(pageSize)
+	if t.listMaxResults > 0 && (limit == 0 || limit > t.listMaxResults) {
+		limit = t.listMaxResults
+	}
+	return limit, after, nil
+}
+
+// page returns up to limit of classes, which are in ascending Id order,
+// starting after the given Id, and the token for the following page.
+func page(classes []*pb.Class, after string, limit int) ([]*pb.Class, string) {
+	if after != "" {
+		i := sort.Search(len(classes), func(i int) bool { return classes[i].Id > after })
+		classes = classes[i:]
+	}
+	if limit == 0 || len(classes) <= limit {
+		return classes, ""
+	}
+	classes = classes[:limit]
+	return classes, encodePageToken(classes[limit-1].Id)
+}
+
+// Page tokens of ordered lists hold an orderCursor, marked by a leading NUL
+// so they can't be mistaken for the Id of an unordered one.
+const orderCursorMark = "\x00"
+
+// orderCursor is where an ordered page ended: the order it was listed in
+// and the sort fields of its last class.
+type orderCursor struct {
+	OrderBy string `json:"o"`
+	Last    []byte `json:"l"`
+}
+
+// orderedPageStart returns the class an ordered page starts after, or nil
+// for the first page. It fails if the token came from a list in another
+// order.
+func orderedPageStart(orderBy, after string) (*pb.Class, error) {
+	if after == "" {
+		return nil, nil
+	}
+	var cur orderCursor
+	if !strings.HasPrefix(after, orderCursorMark) || json.Unmarshal([]byte(after[1:]), &cur) != nil {
+		return nil, errors.New("page token is from a list in another order")
+	}
+	if cur.OrderBy != orderBy {
+		return nil, fmt.Errorf("page token is from a list ordered by %q", cur.OrderBy)
+	}
+	last := &pb.Class{}
+	if err := proto.Unmarshal(cur.Last, last); err != nil {
+		return nil, errors.New("invalid page token")
+	}
+	return last, nil
+}
+
+// orderedPage sorts classes by less and returns the page after start, like
+// page. The token keeps only the fields the order compares, so it stays
+// valid if the last class changes or goes away.
+func orderedPage(classes []*pb.Class, orderBy string, less func(a, b *pb.Class) bool, start *pb.Class, limit int) ([]*pb.Class, string, error) {
+	sort.SliceStable(classes, func(i, j int) bool { return less(classes[i], classes[j]) })
+	if start != nil {
+		i := sort.Search(len(classes), func(i int) bool { return less(start, classes[i]) })
+		classes = classes[i:]
+	}
+	if limit == 0 || len(classes) <= limit {
+		return classes, "", nil
+	}
+	classes = classes[:limit]
+	field := strings.Fields(orderBy)[0]
+	last := &pb.Class{Id: classes[limit-1].Id}
+	if field != "id" {
+		last = applyUpdateMask(last, classes[limit-1], []string{field})
+	}
+	b, err := proto.Marshal(last)
+	if err != nil {
+		return nil, "", err
+	}
+	cur, err := json.Marshal(orderCursor{OrderBy: orderBy, Last: b})
+	if err != nil {
+		return nil, "", err
+	}
+	return classes, encodePageToken(orderCursorMark + string(cur)), nil
+}
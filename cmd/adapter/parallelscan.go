@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"golang.org/x/sync/errgroup"
+)
+
+// kvSplitter is implemented by drivers whose read transactions can run
+// several iterators at once, and that know where to split a prefix so each
+// part holds a similar amount of data.
+type kvSplitter interface {
+	// KeySplits returns keys starting with prefix, in ascending order,
+	// that divide it into parts of similar size. It may return none.
+	KeySplits(prefix []byte) [][]byte
+}
+
+func (db badgerDB) KeySplits(prefix []byte) [][]byte {
+	var splits [][]byte
+	for _, k := range db.DB.KeySplits(prefix) {
+		splits = append(splits, []byte(k))
+	}
+	return splits
+}
+
+// listClasses reads every class like the function of the same name, in up
+// to listParallelism ranges of the class keys read concurrently when the
+// driver can split them. Badger's Stream does the same, but each of its
+// workers reads in a transaction of its own, which would break the snapshot
+// a paged List reads; here every range is read in txn. txn must be
+// read-only.
+func (s *server) listClasses(txn *tenantTxn) ([]*pb.Class, error) {
+	n := s.tuning().listParallelism
+	sp, ok := s.db.(kvSplitter)
+	if n <= 1 || !ok {
+		return listClasses(txn)
+	}
+	prefix := txn.key([]byte(classKeyPrefix))
+	var splits [][]byte
+	for _, k := range sp.KeySplits(prefix) {
+		// Splits are whole keys, tenant prefix and all.
+		splits = append(splits, k[len(txn.prefix):])
+	}
+	bounds := pickSplits(splits, n)
+
+	stored := make([]map[string]storedClass, len(bounds)+1)
+	var g errgroup.Group
+	for i := range stored {
+		i := i
+		stored[i] = make(map[string]storedClass)
+		var start, end []byte
+		if i > 0 {
+			start = bounds[i-1]
+		}
+		if i < len(bounds) {
+			end = bounds[i]
+		}
+		g.Go(func() error {
+			return scanClassRange(txn, start, end, stored[i])
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	merged := stored[0]
+	for _, part := range stored[1:] {
+		for id, f := range part {
+			if m, ok := merged[id]; ok {
+				for k, v := range f {
+					m[k] = v
+				}
+			} else {
+				merged[id] = f
+			}
+		}
+	}
+	classes, _, err := decodeScanned(txn, merged)
+	return classes, err
+}
+
+// pickSplits chooses at most n-1 of the sorted, distinct splits, spread
+// evenly, as the bounds between n ranges.
+func pickSplits(splits [][]byte, n int) [][]byte {
+	sort.Slice(splits, func(i, j int) bool { return bytes.Compare(splits[i], splits[j]) < 0 })
+	var distinct [][]byte
+	for i, k := range splits {
+		if i == 0 || !bytes.Equal(k, splits[i-1]) {
+			distinct = append(distinct, k)
+		}
+	}
+	if len(distinct) < n {
+		return distinct
+	}
+	bounds := make([][]byte, 0, n-1)
+	for i := 1; i < n; i++ {
+		bounds = append(bounds, distinct[i*len(distinct)/n])
+	}
+	return bounds
+}
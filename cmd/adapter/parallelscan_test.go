@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// fixedSplits splits the class keys at given keys rather than where Badger's
+// tables happen to end, which a small test database has none of.
+type fixedSplits struct {
+	badgerDB
+	splits [][]byte
+}
+
+func (db fixedSplits) KeySplits(prefix []byte) [][]byte {
+	return db.splits
+}
+
+func TestListParallelScan(t *testing.T) {
+	const tenant = "acme"
+	db := newTestDB(t, driverBadger, t.TempDir()).(badgerDB)
+	err := db.Update(func(txn kvTxn) error {
+		for _, c := range orderTestClasses {
+			if err := putClass(newTenantTxn(txn, tenant), c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(id, field string) []byte {
+		return append(tenantPrefix(tenant), classKey(id, field)...)
+	}
+	// The second split falls between the fields of class "a".
+	splits := [][]byte{key("a-b", ""), key("a", "Name"), key("a", "Name"), key("ab", "")}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantMetadataKey, tenant))
+
+	for _, n := range []int{1, 2, 3, 8} {
+		s := &server{db: fixedSplits{db, splits}, events: newEventBus()}
+		s.setTuning(tunables{listParallelism: n})
+		cs, err := s.List(ctx, &pb.ListRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"B", "a", "a-b", "a0", "ab"}
+		if got := ids(cs.Classes); !equalIds(got, want) {
+			t.Fatalf("List with parallelism %d returned %v, want %v", n, got, want)
+		}
+		for _, c := range cs.Classes {
+			if c.Name == "" || c.Semester == "" {
+				t.Errorf("List with parallelism %d returned %v with fields missing", n, c)
+			}
+		}
+	}
+}
+
+func TestPickSplits(t *testing.T) {
+	var splits [][]byte
+	for _, k := range []string{"f", "b", "d", "b", "h", "j"} {
+		splits = append(splits, []byte(k))
+	}
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{1, []string{}},
+		{2, []string{"f"}},
+		{3, []string{"d", "h"}},
+		{10, []string{"b", "d", "f", "h", "j"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, k := range pickSplits(splits, tt.n) {
+			got = append(got, string(k))
+		}
+		if !equalIds(got, tt.want) {
+			t.Errorf("pickSplits(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/virtual-class-tutor/class-adapter-file/pkg/client"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v2"
+)
+
+// clientPolicyFile is the YAML form of the -client-policy-file. Settings it
+// leaves out keep the defaults the bundled client starts with.
+type clientPolicyFile struct {
+	MaxBatchSize    int32         `yaml:"max_batch_size"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	Retry           *struct {
+		MaxAttempts       int32         `yaml:"max_attempts"`
+		InitialBackoff    time.Duration `yaml:"initial_backoff"`
+		MaxBackoff        time.Duration `yaml:"max_backoff"`
+		BackoffMultiplier float64       `yaml:"backoff_multiplier"`
+		RetryableCodes    []string      `yaml:"retryable_codes"`
+	} `yaml:"retry"`
+	Hedging *struct {
+		MaxAttempts int32         `yaml:"max_attempts"`
+		Delay       time.Duration `yaml:"delay"`
+	} `yaml:"hedging"`
+	Deprecations []struct {
+		Method  string `yaml:"method"`
+		Message string `yaml:"message"`
+		// A date, e.g. 2025-06-30, or an RFC 3339 time.
+		Sunset string `yaml:"sunset"`
+	} `yaml:"deprecations"`
+}
+
+// loadClientPolicy reads the policy served by GetClientPolicy from path, or
+// returns the default policy if path is empty. The max page size isn't part
+// of it; that is always -list-max-results.
+func loadClientPolicy(path string) (*pb.ClientPolicy, error) {
+	p := client.DefaultPolicy()
+	if path == "" {
+		return p, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f clientPolicyFile
+	if err := yaml.UnmarshalStrict(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var v []string
+	invalid := func(format string, args ...interface{}) {
+		v = append(v, fmt.Sprintf(format, args...))
+	}
+	switch {
+	case f.MaxBatchSize < 0:
+		invalid("max_batch_size must not be negative")
+	case f.MaxBatchSize > 0:
+		p.MaxBatchSize = f.MaxBatchSize
+	}
+	switch {
+	case f.RefreshInterval < 0:
+		invalid("refresh_interval must not be negative")
+	case f.RefreshInterval > 0:
+		p.RefreshInterval = durationpb.New(f.RefreshInterval)
+	}
+	if r := f.Retry; r != nil {
+		if r.MaxAttempts < 1 {
+			invalid("retry.max_attempts must be at least 1")
+		}
+		if r.InitialBackoff <= 0 || r.MaxBackoff < r.InitialBackoff {
+			invalid("retry.initial_backoff must be positive and at most retry.max_backoff")
+		}
+		if r.BackoffMultiplier < 1 {
+			invalid("retry.backoff_multiplier must be at least 1")
+		}
+		for _, name := range r.RetryableCodes {
+			var c codes.Code
+			if err := c.UnmarshalJSON([]byte(`"` + name + `"`)); err != nil {
+				invalid("retry.retryable_codes: unknown code %q", name)
+			}
+		}
+		p.RetryPolicy = &pb.RetryPolicy{
+			MaxAttempts:       r.MaxAttempts,
+			InitialBackoff:    durationpb.New(r.InitialBackoff),
+			MaxBackoff:        durationpb.New(r.MaxBackoff),
+			BackoffMultiplier: r.BackoffMultiplier,
+			RetryableCodes:    r.RetryableCodes,
+		}
+	}
+	if h := f.Hedging; h != nil {
+		if h.MaxAttempts < 1 {
+			invalid("hedging.max_attempts must be at least 1")
+		}
+		if h.Delay <= 0 {
+			invalid("hedging.delay must be positive")
+		}
+		p.HedgingPolicy = &pb.HedgingPolicy{
+			MaxAttempts:  h.MaxAttempts,
+			HedgingDelay: durationpb.New(h.Delay),
+		}
+	}
+	for i, d := range f.Deprecations {
+		if _, err := methodDescriptor(d.Method); err != nil {
+			invalid("deprecations[%d].method: %s", i, err)
+		}
+		dep := &pb.Deprecation{Method: d.Method, Message: d.Message}
+		if d.Sunset != "" {
+			t, err := time.Parse("2006-01-02", d.Sunset)
+			if err != nil {
+				t, err = time.Parse(time.RFC3339, d.Sunset)
+			}
+			if err != nil {
+				invalid("deprecations[%d].sunset must be a date or an RFC 3339 time", i)
+			}
+			dep.SunsetTime = timestamppb.New(t)
+		}
+		p.Deprecations = append(p.Deprecations, dep)
+	}
+	if len(v) > 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(v, "; "))
+	}
+	return p, nil
+}
+
+func (s *server) GetClientPolicy(ctx context.Context, in *pb.Empty) (*pb.ClientPolicy, error) {
+	logf(ctx, "GetClientPolicy called")
+	t := s.tuning()
+	p := client.DefaultPolicy()
+	if t.clientPolicy != nil {
+		p = proto.Clone(t.clientPolicy).(*pb.ClientPolicy)
+	}
+	p.MaxPageSize = int32(t.listMaxResults)
+	config, err := client.ServiceConfig(p, pb.File_proto_class_proto, adapterv2.File_proto_v2_class_proto)
+	if err != nil {
+		return nil, err
+	}
+	p.ServiceConfig = config
+	return p, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+)
+
+func TestLoadClientPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	ioutil.WriteFile(path, []byte(`
+max_batch_size: 50
+retry:
+  max_attempts: 5
+  initial_backoff: 50ms
+  max_backoff: 2s
+  backoff_multiplier: 1.5
+  retryable_codes: [UNAVAILABLE]
+hedging:
+  max_attempts: 2
+  delay: 300ms
+deprecations:
+- method: /class.Adapter/ListBySemester
+  message: use List with a query
+  sunset: 2027-06-30
+`), 0600)
+	p, err := loadClientPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxBatchSize != 50 || p.RetryPolicy.MaxAttempts != 5 || p.RetryPolicy.InitialBackoff.AsDuration() != 50*time.Millisecond {
+		t.Errorf("got %v", p)
+	}
+	if p.HedgingPolicy.MaxAttempts != 2 || p.HedgingPolicy.HedgingDelay.AsDuration() != 300*time.Millisecond {
+		t.Errorf("hedging policy = %v", p.HedgingPolicy)
+	}
+	if p.RefreshInterval.AsDuration() != 5*time.Minute {
+		t.Errorf("refresh interval = %v, want the default", p.RefreshInterval.AsDuration())
+	}
+	if len(p.Deprecations) != 1 || p.Deprecations[0].SunsetTime.AsTime().Format("2006-01-02") != "2027-06-30" {
+		t.Errorf("deprecations = %v", p.Deprecations)
+	}
+
+	ioutil.WriteFile(path, []byte(`
+retry:
+  max_attempts: 0
+  retryable_codes: [SOMETIMES]
+hedging:
+  max_attempts: 2
+deprecations:
+- method: /class.Adapter/Nope
+`), 0600)
+	_, err = loadClientPolicy(path)
+	for _, want := range []string{"max_attempts", "SOMETIMES", "hedging.delay", "/class.Adapter/Nope"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v doesn't mention %s", err, want)
+		}
+	}
+}
+
+func TestGetClientPolicyServiceConfig(t *testing.T) {
+	s := &server{}
+	s.setTuning(tunables{listMaxResults: 100})
+	p, err := s.GetClientPolicy(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// grpc.Dial rejects a default service config it can't parse.
+	conn, err := grpc.Dial("localhost:0", grpc.WithInsecure(), grpc.WithDefaultServiceConfig(p.ServiceConfig))
+	if err != nil {
+		t.Fatalf("service config %s: %v", p.ServiceConfig, err)
+	}
+	conn.Close()
+	for _, want := range []string{`{"service":"class.Adapter","method":"Get"}`, `{"service":"adapter.v2.Classes","method":"UpdateClass"}`} {
+		if !strings.Contains(p.ServiceConfig, want) {
+			t.Errorf("service config %s lacks %s", p.ServiceConfig, want)
+		}
+	}
+	if strings.Contains(p.ServiceConfig, `"method":"Enroll"`) {
+		t.Errorf("service config %s retries Enroll", p.ServiceConfig)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxPrerequisites = 32
+
+// Prerequisites are stored as a JSON array of Ids in the Prerequisites
+// field of the class.
+func encodePrerequisites(ids []string) (string, error) {
+	b, err := json.Marshal(ids)
+	return string(b), err
+}
+
+func decodePrerequisites(v string) ([]string, error) {
+	var ids []string
+	if err := json.Unmarshal([]byte(v), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (v *violations) checkPrerequisites(id string, prereqs []string) {
+	if len(prereqs) > maxPrerequisites {
+		v.add("prerequisite_ids", "must have at most %d classes", maxPrerequisites)
+	}
+	seen := make(map[string]bool)
+	for i, p := range prereqs {
+		field := fmt.Sprintf("prerequisite_ids[%d]", i)
+		v.checkIdAs(field, p)
+		switch {
+		case p == id:
+			v.add(field, "class can't be its own prerequisite")
+		case seen[p]:
+			v.add(field, "class %s is listed twice", p)
+		}
+		seen[p] = true
+	}
+}
+
+// storedPrerequisites reads the prerequisite Ids of a class without
+// reading the rest of it.
+func storedPrerequisites(txn *tenantTxn, id string) ([]string, error) {
+	v, err := getField(txn, id, "Prerequisites")
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodePrerequisites(v)
+}
+
+// checkPrerequisiteRefs fails with FailedPrecondition unless every
+// prerequisite of c exists and none of them leads back to c. Reading the
+// graph registers the reads, so two writes that would close a cycle
+// between them conflict.
+func checkPrerequisiteRefs(txn *tenantTxn, c *pb.Class) error {
+	for _, p := range c.PrerequisiteIds {
+		exists, err := classExists(txn, p)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return preconditionFailed(preconditionPrerequisite, "classes/"+p, "prerequisite %s not found", p)
+		}
+	}
+	visited := make(map[string]bool)
+	var walk func(id string, path []string) error
+	walk = func(id string, path []string) error {
+		if id == c.Id {
+			return preconditionFailed(preconditionPrerequisite, "classes/"+c.Id, "prerequisites would form a cycle: %s", strings.Join(append(path, id), " -> "))
+		}
+		if visited[id] {
+			return nil
+		}
+		visited[id] = true
+		prereqs, err := storedPrerequisites(txn, id)
+		if err != nil {
+			return err
+		}
+		for _, p := range prereqs {
+			if err := walk(p, append(path, id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, p := range c.PrerequisiteIds {
+		if err := walk(p, []string{c.Id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReferences checks the classes and instructors c refers to, and that
+// no other class has its external Ids, before it is written.
+func checkReferences(txn *tenantTxn, c *pb.Class) error {
+	if err := checkInstructorRef(txn, c); err != nil {
+		return err
+	}
+	if err := checkExternalIdRefs(txn, c); err != nil {
+		return err
+	}
+	return checkPrerequisiteRefs(txn, c)
+}
+
+// prerequisiteTree builds the tree of the class with the given Id, down to
+// depth levels when depth is positive.
+func prerequisiteTree(txn *tenantTxn, id string, depth int) (*pb.PrerequisiteTree, error) {
+	if err := txn.ctx.Err(); err != nil {
+		return nil, err
+	}
+	c, err := getClass(txn, id)
+	if err == badger.ErrKeyNotFound {
+		return &pb.PrerequisiteTree{Class: &pb.Class{Id: id}, Missing: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &pb.PrerequisiteTree{Class: c}
+	if depth == 1 {
+		return t, nil
+	}
+	for _, p := range c.PrerequisiteIds {
+		sub, err := prerequisiteTree(txn, p, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		t.Prerequisites = append(t.Prerequisites, sub)
+	}
+	return t, nil
+}
+
+func (s *server) GetPrerequisiteTree(ctx context.Context, in *pb.PrerequisiteTreeRequest) (*pb.PrerequisiteTree, error) {
+	logf(ctx, "GetPrerequisiteTree called for Id %s", in.Id)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tree *pb.PrerequisiteTree
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		exists, err := classExists(txn, in.Id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return status.Errorf(codes.NotFound, "class %s not found", in.Id)
+		}
+		// The root's own level counts, so max_depth 1 returns its direct
+		// prerequisites.
+		depth := 0
+		if in.MaxDepth > 0 {
+			depth = int(in.MaxDepth) + 1
+		}
+		tree, err = prerequisiteTree(txn, in.Id, depth)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return tree, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestPrerequisites(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		for _, c := range []*pb.Class{
+			{Id: "MATH101"},
+			{Id: "MATH102"},
+			{Id: "MATH201", PrerequisiteIds: []string{"MATH101", "MATH102"}},
+			{Id: "MATH301", PrerequisiteIds: []string{"MATH201"}},
+		} {
+			if _, err := s.Create(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tree, err := s.GetPrerequisiteTree(ctx, &pb.PrerequisiteTreeRequest{Id: "MATH301"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.Class.Id != "MATH301" || len(tree.Prerequisites) != 1 {
+			t.Fatalf("tree of MATH301 is %v", tree)
+		}
+		sub := tree.Prerequisites[0]
+		if sub.Class.Id != "MATH201" || len(sub.Prerequisites) != 2 || sub.Prerequisites[1].Class.Id != "MATH102" {
+			t.Errorf("prerequisites of MATH201 are %v", sub)
+		}
+		tree, err = s.GetPrerequisiteTree(ctx, &pb.PrerequisiteTreeRequest{Id: "MATH301", MaxDepth: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tree.Prerequisites) != 1 || len(tree.Prerequisites[0].Prerequisites) != 0 {
+			t.Errorf("tree with max_depth 1 is %v, want only direct prerequisites", tree)
+		}
+
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH401", PrerequisiteIds: []string{"MATH999"}}); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Create with an unknown prerequisite returned %v, want FailedPrecondition", err)
+		}
+		if err := validateRequest("/class.Adapter/Create", &pb.Class{Id: "MATH401", PrerequisiteIds: []string{"MATH401"}}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Create listing itself as a prerequisite returned %v, want InvalidArgument", err)
+		}
+		_, err = s.Update(ctx, &pb.Class{
+			Id:              "MATH101",
+			PrerequisiteIds: []string{"MATH301"},
+			UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"prerequisite_ids"}},
+		})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Update closing a cycle returned %v, want FailedPrecondition", err)
+		}
+
+		// A deleted prerequisite shows up as missing.
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH102"}); err != nil {
+			t.Fatal(err)
+		}
+		tree, err = s.GetPrerequisiteTree(ctx, &pb.PrerequisiteTreeRequest{Id: "MATH201"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tree.Prerequisites) != 2 || !tree.Prerequisites[1].Missing {
+			t.Errorf("tree of MATH201 after deleting MATH102 is %v", tree)
+		}
+	})
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const maxProxyCacheEntries = 10000
+
+var proxyCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "adapter_proxy_cache_requests_total",
+	Help: "Proxy read requests by cache result (hit or miss).",
+}, []string{"result"})
+
+// proxyServer fronts an upstream Adapter without any local storage. Reads are
+// cached for a short TTL and the whole cache is dropped on every write that
+// passes through the proxy; writes made directly against the upstream become
+// visible once the cached entries expire.
+type proxyServer struct {
+	pb.UnimplementedAdapterServer
+	conn     *grpc.ClientConn
+	upstream pb.AdapterClient
+	cache    *responseCache
+	drain    *streamDrain
+}
+
+// newProxyServer dials addr, accepting responses up to maxMsgSize bytes so
+// anything the proxy may send on can come through.
+func newProxyServer(addr string, cacheTTL time.Duration, maxMsgSize int) (*proxyServer, error) {
+	creds, err := dialCredentials(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.Dial(addr, creds,
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize)))
+	if err != nil {
+		return nil, err
+	}
+	return &proxyServer{
+		conn:     conn,
+		upstream: pb.NewAdapterClient(conn),
+		cache:    newResponseCache(cacheTTL),
+	}, nil
+}
+
+func (p *proxyServer) Close() error {
+	return p.conn.Close()
+}
+
+// outgoing forwards the caller's metadata (tenant, credentials, ...) upstream.
+func outgoing(ctx context.Context) context.Context {
+	in, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	out := metadata.MD{}
+	for k, v := range in {
+		if strings.HasPrefix(k, ":") || k == "content-type" || k == "user-agent" {
+			continue
+		}
+		out[k] = v
+	}
+	// Send on the request Id the adapter made up for a caller without one.
+	if id := requestIdFromContext(ctx); id != "" {
+		out.Set(requestIdMetadataKey, id)
+	}
+	return metadata.NewOutgoingContext(ctx, out)
+}
+
+// cached serves a read from the cache, calling fetch on a miss.
+func (p *proxyServer) cached(ctx context.Context, method string, in proto.Message, fetch func() (proto.Message, error)) (proto.Message, error) {
+	key, err := cacheKey(ctx, method, in)
+	if err == nil {
+		if m, ok := p.cache.get(key); ok {
+			proxyCacheRequests.WithLabelValues("hit").Inc()
+			return m, nil
+		}
+	}
+	proxyCacheRequests.WithLabelValues("miss").Inc()
+	m, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		p.cache.put(key, m)
+	}
+	return m, nil
+}
+
+func (p *proxyServer) List(ctx context.Context, in *pb.ListRequest) (*pb.Classes, error) {
+	m, err := p.cached(ctx, "List", in, func() (proto.Message, error) {
+		return p.upstream.List(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Classes), nil
+}
+
+func (p *proxyServer) Get(ctx context.Context, in *pb.GetRequest) (*pb.Class, error) {
+	m, err := p.cached(ctx, "Get", in, func() (proto.Message, error) {
+		return p.upstream.Get(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Class), nil
+}
+
+func (p *proxyServer) GetByExternalId(ctx context.Context, in *pb.GetByExternalIdRequest) (*pb.Class, error) {
+	m, err := p.cached(ctx, "GetByExternalId", in, func() (proto.Message, error) {
+		return p.upstream.GetByExternalId(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Class), nil
+}
+
+func (p *proxyServer) Exists(ctx context.Context, in *pb.GetRequest) (*pb.ExistsResponse, error) {
+	m, err := p.cached(ctx, "Exists", in, func() (proto.Message, error) {
+		return p.upstream.Exists(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.ExistsResponse), nil
+}
+
+func (p *proxyServer) ListBySemester(ctx context.Context, in *pb.ListBySemesterRequest) (*pb.Classes, error) {
+	m, err := p.cached(ctx, "ListBySemester", in, func() (proto.Message, error) {
+		return p.upstream.ListBySemester(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Classes), nil
+}
+
+func (p *proxyServer) Create(ctx context.Context, in *pb.Class) (*pb.Class, error) {
+	defer p.cache.clear()
+	return p.upstream.Create(outgoing(ctx), in)
+}
+
+func (p *proxyServer) CreateClassBundle(ctx context.Context, in *pb.ClassBundle) (*pb.ClassBundle, error) {
+	defer p.cache.clear()
+	return p.upstream.CreateClassBundle(outgoing(ctx), in)
+}
+
+func (p *proxyServer) GetClassBundle(ctx context.Context, in *pb.GetRequest) (*pb.ClassBundle, error) {
+	m, err := p.cached(ctx, "GetClassBundle", in, func() (proto.Message, error) {
+		return p.upstream.GetClassBundle(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.ClassBundle), nil
+}
+
+func (p *proxyServer) Update(ctx context.Context, in *pb.Class) (*pb.Class, error) {
+	defer p.cache.clear()
+	return p.upstream.Update(outgoing(ctx), in)
+}
+
+func (p *proxyServer) Delete(ctx context.Context, in *pb.Class) (*pb.Empty, error) {
+	defer p.cache.clear()
+	return p.upstream.Delete(outgoing(ctx), in)
+}
+
+func (p *proxyServer) TransitionState(ctx context.Context, in *pb.TransitionStateRequest) (*pb.Class, error) {
+	defer p.cache.clear()
+	return p.upstream.TransitionState(outgoing(ctx), in)
+}
+
+func (p *proxyServer) AcquireEditLease(ctx context.Context, in *pb.AcquireEditLeaseRequest) (*pb.EditLease, error) {
+	return p.upstream.AcquireEditLease(outgoing(ctx), in)
+}
+
+func (p *proxyServer) ReleaseEditLease(ctx context.Context, in *pb.ReleaseEditLeaseRequest) (*pb.Empty, error) {
+	return p.upstream.ReleaseEditLease(outgoing(ctx), in)
+}
+
+func (p *proxyServer) SaveQuery(ctx context.Context, in *pb.SavedQuery) (*pb.SavedQuery, error) {
+	defer p.cache.clear()
+	return p.upstream.SaveQuery(outgoing(ctx), in)
+}
+
+func (p *proxyServer) DeleteSavedQuery(ctx context.Context, in *pb.SavedQueryRequest) (*pb.Empty, error) {
+	defer p.cache.clear()
+	return p.upstream.DeleteSavedQuery(outgoing(ctx), in)
+}
+
+func (p *proxyServer) ListSavedQueries(ctx context.Context, in *pb.Empty) (*pb.SavedQueries, error) {
+	return p.upstream.ListSavedQueries(outgoing(ctx), in)
+}
+
+func (p *proxyServer) RunSavedQuery(ctx context.Context, in *pb.SavedQueryRequest) (*pb.Classes, error) {
+	m, err := p.cached(ctx, "RunSavedQuery", in, func() (proto.Message, error) {
+		return p.upstream.RunSavedQuery(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Classes), nil
+}
+
+func (p *proxyServer) AdminListSavedQueries(ctx context.Context, in *pb.Empty) (*pb.SavedQueries, error) {
+	return p.upstream.AdminListSavedQueries(outgoing(ctx), in)
+}
+
+func (p *proxyServer) Count(ctx context.Context, in *pb.CountRequest) (*pb.CountResponse, error) {
+	m, err := p.cached(ctx, "Count", in, func() (proto.Message, error) {
+		return p.upstream.Count(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.CountResponse), nil
+}
+
+func (p *proxyServer) GetAggregateStats(ctx context.Context, in *pb.AggregateStatsRequest) (*pb.AggregateStats, error) {
+	m, err := p.cached(ctx, "GetAggregateStats", in, func() (proto.Message, error) {
+		return p.upstream.GetAggregateStats(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.AggregateStats), nil
+}
+
+func (p *proxyServer) DescribeSchema(ctx context.Context, in *pb.Empty) (*pb.Schema, error) {
+	m, err := p.cached(ctx, "DescribeSchema", in, func() (proto.Message, error) {
+		return p.upstream.DescribeSchema(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Schema), nil
+}
+
+func (p *proxyServer) GetAuditLog(ctx context.Context, in *pb.AuditLogRequest) (*pb.AuditLog, error) {
+	return p.upstream.GetAuditLog(outgoing(ctx), in)
+}
+
+func (p *proxyServer) AdminListQuarantined(ctx context.Context, in *pb.Empty) (*pb.Classes, error) {
+	return p.upstream.AdminListQuarantined(outgoing(ctx), in)
+}
+
+func (p *proxyServer) GetSemester(ctx context.Context, in *pb.GetSemesterRequest) (*pb.Semester, error) {
+	m, err := p.cached(ctx, "GetSemester", in, func() (proto.Message, error) {
+		return p.upstream.GetSemester(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Semester), nil
+}
+
+func (p *proxyServer) GetSemesterStats(ctx context.Context, in *pb.GetSemesterStatsRequest) (*pb.SemesterStats, error) {
+	m, err := p.cached(ctx, "GetSemesterStats", in, func() (proto.Message, error) {
+		return p.upstream.GetSemesterStats(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.SemesterStats), nil
+}
+
+func (p *proxyServer) AdminOffboardTenant(ctx context.Context, in *pb.OffboardTenantRequest) (*pb.OffboardCertificate, error) {
+	defer p.cache.clear()
+	return p.upstream.AdminOffboardTenant(outgoing(ctx), in)
+}
+
+func (p *proxyServer) GetClientPolicy(ctx context.Context, in *pb.Empty) (*pb.ClientPolicy, error) {
+	m, err := p.cached(ctx, "GetClientPolicy", in, func() (proto.Message, error) {
+		return p.upstream.GetClientPolicy(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.ClientPolicy), nil
+}
+
+func (p *proxyServer) AdminCompact(ctx context.Context, in *pb.Empty) (*pb.MaintenanceResult, error) {
+	return p.upstream.AdminCompact(outgoing(ctx), in)
+}
+
+func (p *proxyServer) AdminRunGC(ctx context.Context, in *pb.RunGCRequest) (*pb.MaintenanceResult, error) {
+	return p.upstream.AdminRunGC(outgoing(ctx), in)
+}
+
+func (p *proxyServer) AdminSyncClassroom(ctx context.Context, in *pb.Empty) (*pb.ClassroomSyncResult, error) {
+	defer p.cache.clear()
+	return p.upstream.AdminSyncClassroom(outgoing(ctx), in)
+}
+
+func (p *proxyServer) Stats(ctx context.Context, in *pb.Empty) (*pb.StatsResponse, error) {
+	m, err := p.cached(ctx, "Stats", in, func() (proto.Message, error) {
+		return p.upstream.Stats(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.StatsResponse), nil
+}
+
+func (p *proxyServer) ArchiveSemester(ctx context.Context, in *pb.ArchiveSemesterRequest) (*pb.ArchiveSemesterResponse, error) {
+	defer p.cache.clear()
+	return p.upstream.ArchiveSemester(outgoing(ctx), in)
+}
+
+func (p *proxyServer) ListArchived(ctx context.Context, in *pb.ListArchivedRequest) (*pb.Classes, error) {
+	m, err := p.cached(ctx, "ListArchived", in, func() (proto.Message, error) {
+		return p.upstream.ListArchived(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Classes), nil
+}
+
+func (p *proxyServer) Enroll(ctx context.Context, in *pb.EnrollmentRequest) (*pb.Enrollment, error) {
+	defer p.cache.clear()
+	return p.upstream.Enroll(outgoing(ctx), in)
+}
+
+func (p *proxyServer) Unenroll(ctx context.Context, in *pb.EnrollmentRequest) (*pb.Empty, error) {
+	defer p.cache.clear()
+	return p.upstream.Unenroll(outgoing(ctx), in)
+}
+
+func (p *proxyServer) ListEnrollments(ctx context.Context, in *pb.ListEnrollmentsRequest) (*pb.Enrollments, error) {
+	m, err := p.cached(ctx, "ListEnrollments", in, func() (proto.Message, error) {
+		return p.upstream.ListEnrollments(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.Enrollments), nil
+}
+
+func (p *proxyServer) GetPrerequisiteTree(ctx context.Context, in *pb.PrerequisiteTreeRequest) (*pb.PrerequisiteTree, error) {
+	m, err := p.cached(ctx, "GetPrerequisiteTree", in, func() (proto.Message, error) {
+		return p.upstream.GetPrerequisiteTree(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.PrerequisiteTree), nil
+}
+
+func (p *proxyServer) BatchDelete(ctx context.Context, in *pb.DeleteFilter) (*pb.BatchDeleteResponse, error) {
+	defer p.cache.clear()
+	return p.upstream.BatchDelete(outgoing(ctx), in)
+}
+
+func (p *proxyServer) Clone(ctx context.Context, in *pb.CloneRequest) (*pb.Class, error) {
+	defer p.cache.clear()
+	return p.upstream.Clone(outgoing(ctx), in)
+}
+
+func (p *proxyServer) Transact(ctx context.Context, in *pb.TransactRequest) (*pb.TransactResponse, error) {
+	defer p.cache.clear()
+	return p.upstream.Transact(outgoing(ctx), in)
+}
+
+func (p *proxyServer) GetApiDescriptor(ctx context.Context, in *pb.Empty) (*pb.ApiDescriptor, error) {
+	m, err := p.cached(ctx, "GetApiDescriptor", in, func() (proto.Message, error) {
+		return p.upstream.GetApiDescriptor(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*pb.ApiDescriptor), nil
+}
+
+// GetServerInfo reports the proxy's own build, and only the upstream's
+// features the proxy knows how to forward.
+func (p *proxyServer) GetServerInfo(ctx context.Context, in *pb.Empty) (*pb.ServerInfo, error) {
+	m, err := p.cached(ctx, "GetServerInfo", in, func() (proto.Message, error) {
+		return p.upstream.GetServerInfo(outgoing(ctx), in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	upstream := append([]string(nil), m.(*pb.ServerInfo).Features...)
+	sort.Strings(upstream)
+	info := serverInfo()
+	info.Features = commonFeatures(info.Features, upstream)
+	return info, nil
+}
+
+func (p *proxyServer) AdminListOffboardCertificates(ctx context.Context, in *pb.Empty) (*pb.OffboardCertificates, error) {
+	return p.upstream.AdminListOffboardCertificates(outgoing(ctx), in)
+}
+
+func (p *proxyServer) Watch(in *pb.WatchRequest, stream pb.Adapter_WatchServer) error {
+	ctx, reason, cancel := p.drain.bound(stream.Context())
+	defer cancel()
+	// outgoing reads the caller's metadata from the incoming context, which
+	// ctx carries on.
+	up, err := p.upstream.Watch(outgoing(ctx), in)
+	if err != nil {
+		return err
+	}
+	// Pass on that the upstream Watch is subscribed.
+	md, err := up.Header()
+	if err != nil {
+		return err
+	}
+	if err := stream.SendHeader(md); err != nil {
+		return err
+	}
+	for {
+		e, err := up.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if r := reason(); r != nil {
+				return r
+			}
+			return err
+		}
+		if err := stream.Send(e); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayChanges forwards the replay uncached, like Watch.
+func (p *proxyServer) ReplayChanges(in *pb.ReplayChangesRequest, stream pb.Adapter_ReplayChangesServer) error {
+	ctx, reason, cancel := p.drain.bound(stream.Context())
+	defer cancel()
+	up, err := p.upstream.ReplayChanges(outgoing(ctx), in)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := up.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if r := reason(); r != nil {
+				return r
+			}
+			return err
+		}
+		if err := stream.Send(e); err != nil {
+			return err
+		}
+	}
+}
+
+// ImportRoster forwards the roster chunk by chunk.
+func (p *proxyServer) ImportRoster(stream pb.Adapter_ImportRosterServer) error {
+	defer p.cache.clear()
+	up, err := p.upstream.ImportRoster(outgoing(stream.Context()))
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// A failed Send means the upstream ended the call; CloseAndRecv
+		// returns why.
+		if up.Send(chunk) != nil {
+			break
+		}
+	}
+	resp, err := up.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+// kvProxy forwards KeyValueStore calls upstream uncached; other services
+// read their state back rarely enough that caching isn't worth the staleness.
+type kvProxy struct {
+	pb.UnimplementedKeyValueStoreServer
+	upstream pb.KeyValueStoreClient
+}
+
+func (p *kvProxy) Put(ctx context.Context, in *pb.KeyValue) (*pb.KeyValue, error) {
+	return p.upstream.Put(outgoing(ctx), in)
+}
+
+func (p *kvProxy) Get(ctx context.Context, in *pb.KeyRequest) (*pb.KeyValue, error) {
+	return p.upstream.Get(outgoing(ctx), in)
+}
+
+func (p *kvProxy) Delete(ctx context.Context, in *pb.KeyRequest) (*pb.Empty, error) {
+	return p.upstream.Delete(outgoing(ctx), in)
+}
+
+func (p *kvProxy) List(ctx context.Context, in *pb.ListKeysRequest) (*pb.KeyValues, error) {
+	return p.upstream.List(outgoing(ctx), in)
+}
+
+// instructorProxy forwards Instructors calls upstream uncached, like
+// kvProxy.
+type instructorProxy struct {
+	pb.UnimplementedInstructorsServer
+	upstream pb.InstructorsClient
+}
+
+func (p *instructorProxy) Create(ctx context.Context, in *pb.Instructor) (*pb.Instructor, error) {
+	return p.upstream.Create(outgoing(ctx), in)
+}
+
+func (p *instructorProxy) Get(ctx context.Context, in *pb.InstructorRequest) (*pb.Instructor, error) {
+	return p.upstream.Get(outgoing(ctx), in)
+}
+
+func (p *instructorProxy) Update(ctx context.Context, in *pb.Instructor) (*pb.Instructor, error) {
+	return p.upstream.Update(outgoing(ctx), in)
+}
+
+func (p *instructorProxy) Delete(ctx context.Context, in *pb.InstructorRequest) (*pb.Empty, error) {
+	return p.upstream.Delete(outgoing(ctx), in)
+}
+
+func (p *instructorProxy) List(ctx context.Context, in *pb.ListInstructorsRequest) (*pb.ListInstructorsResponse, error) {
+	return p.upstream.List(outgoing(ctx), in)
+}
+
+// classesV2Proxy forwards adapter.v2 calls upstream uncached. Its writes
+// clear the proxy's cache, since they change what v1 reads return.
+type classesV2Proxy struct {
+	adapterv2.UnimplementedClassesServer
+	p        *proxyServer
+	upstream adapterv2.ClassesClient
+}
+
+func (cp *classesV2Proxy) ListClasses(ctx context.Context, in *adapterv2.ListClassesRequest) (*adapterv2.ListClassesResponse, error) {
+	return cp.upstream.ListClasses(outgoing(ctx), in)
+}
+
+func (cp *classesV2Proxy) GetClass(ctx context.Context, in *adapterv2.GetClassRequest) (*adapterv2.Class, error) {
+	return cp.upstream.GetClass(outgoing(ctx), in)
+}
+
+func (cp *classesV2Proxy) CreateClass(ctx context.Context, in *adapterv2.CreateClassRequest) (*adapterv2.Class, error) {
+	defer cp.p.cache.clear()
+	return cp.upstream.CreateClass(outgoing(ctx), in)
+}
+
+func (cp *classesV2Proxy) UpdateClass(ctx context.Context, in *adapterv2.UpdateClassRequest) (*adapterv2.Class, error) {
+	defer cp.p.cache.clear()
+	return cp.upstream.UpdateClass(outgoing(ctx), in)
+}
+
+func (cp *classesV2Proxy) DeleteClass(ctx context.Context, in *adapterv2.DeleteClassRequest) (*emptypb.Empty, error) {
+	defer cp.p.cache.clear()
+	return cp.upstream.DeleteClass(outgoing(ctx), in)
+}
+
+// cacheKey identifies a read by method, tenant, credentials and request
+// message. The credentials are forwarded upstream, which decides what they
+// may read, so a response is only served again to a caller presenting the
+// same ones. Only their hash is kept.
+func cacheKey(ctx context.Context, method string, in proto.Message) (string, error) {
+	b, err := proto.Marshal(in)
+	if err != nil {
+		logf(ctx, "Error building cache key for %s: %s", method, err)
+		return "", err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	creds := sha256.Sum256([]byte(strings.Join(md.Get("authorization"), "\n")))
+	return method + "/" + strings.Join(md.Get(tenantMetadataKey), ",") + "/" + hex.EncodeToString(creds[:]) + "/" + string(b), nil
+}
+
+type cacheEntry struct {
+	m       proto.Message
+	expires time.Time
+}
+
+// responseCache is a small TTL cache of upstream responses. Callers must not
+// modify the messages it hands out.
+type responseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *responseCache) get(key string) (proto.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.m, true
+}
+
+func (c *responseCache) put(key string, m proto.Message) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxProxyCacheEntries {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxProxyCacheEntries {
+			c.entries = make(map[string]cacheEntry)
+		}
+	}
+	c.entries[key] = cacheEntry{m: m, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]cacheEntry)
+	c.mu.Unlock()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestProxyCacheKeysByCredentials(t *testing.T) {
+	p := &proxyServer{cache: newResponseCache(time.Minute)}
+	var fetches int
+	get := func(md ...string) *pb.Class {
+		t.Helper()
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(md...))
+		m, err := p.cached(ctx, "Get", &pb.GetRequest{Id: "MATH101"}, func() (proto.Message, error) {
+			fetches++
+			return &pb.Class{Id: "MATH101", Name: md[len(md)-1]}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.(*pb.Class)
+	}
+
+	get("authorization", "Bearer alice")
+	if c := get("authorization", "Bearer alice"); fetches != 1 || c.Name != "Bearer alice" {
+		t.Errorf("a repeated read fetched %d times, want a cache hit", fetches)
+	}
+	// Neither another caller nor one without credentials gets alice's
+	// response.
+	if c := get("authorization", "Bearer mallory"); fetches != 2 || c.Name != "Bearer mallory" {
+		t.Errorf("another token's read returned %v from the cache", c)
+	}
+	if c := get("x-request-id", "anonymous"); fetches != 3 || c.Name != "anonymous" {
+		t.Errorf("a read without credentials returned %v from the cache", c)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const queryPrefix = "query/"
+
+var queryNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func savedQueryKey(tenant, name string) []byte {
+	return []byte(queryPrefix + tenant + "/" + name)
+}
+
+// classOrders are the sort keys accepted by order_by.
+var classOrders = map[string]func(a, b *pb.Class) bool{
+	"id":       func(a, b *pb.Class) bool { return a.Id < b.Id },
+	"name":     func(a, b *pb.Class) bool { return a.Name < b.Name },
+	"semester": func(a, b *pb.Class) bool { return a.Semester < b.Semester },
+}
+
+// parseOrderBy parses "<field>[ desc]" into a comparison that falls back to
+// Id order so results are stable.
+func parseOrderBy(orderBy string) (func(a, b *pb.Class) bool, bool) {
+	parts := strings.Fields(orderBy)
+	if len(parts) == 0 {
+		return classOrders["id"], true
+	}
+	less, ok := classOrders[parts[0]]
+	if !ok || len(parts) > 2 || (len(parts) == 2 && parts[1] != "desc" && parts[1] != "asc") {
+		return nil, false
+	}
+	desc := len(parts) == 2 && parts[1] == "desc"
+	return func(a, b *pb.Class) bool {
+		if desc {
+			a, b = b, a
+		}
+		if less(a, b) || less(b, a) {
+			return less(a, b)
+		}
+		return a.Id < b.Id
+	}, true
+}
+
+func (v *violations) checkQuery(field string, q *pb.ClassQuery) {
+	if q == nil {
+		return
+	}
+	v.checkSemester(q.Semester)
+	if _, ok := parseOrderBy(q.OrderBy); !ok {
+		v.add(field+".order_by", "must be one of id, name or semester, optionally followed by desc")
+	}
+	for _, p := range q.Fields.GetPaths() {
+		if p != "id" && !classPaths[p] {
+			v.add(field+".fields", "unknown field %q", p)
+		}
+	}
+}
+
+// runQuery evaluates q against the classes visible in txn.
+func runQuery(txn *tenantTxn, q *pb.ClassQuery) ([]*pb.Class, error) {
+	if q == nil {
+		q = &pb.ClassQuery{}
+	}
+	var candidates []*pb.Class
+	var err error
+	if q.Semester != "" {
+		candidates, err = listSemester(txn, q.Semester)
+	} else {
+		candidates, err = listClasses(txn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	classes := make([]*pb.Class, 0, len(candidates))
+	for _, c := range candidates {
+		if !strings.HasPrefix(c.Id, q.IdPrefix) || !strings.Contains(c.Name, q.NameContains) {
+			continue
+		}
+		classes = append(classes, c)
+	}
+
+	less, _ := parseOrderBy(q.OrderBy)
+	sort.SliceStable(classes, func(i, j int) bool { return less(classes[i], classes[j]) })
+
+	if paths := q.Fields.GetPaths(); len(paths) > 0 {
+		for i, c := range classes {
+			classes[i] = applyUpdateMask(&pb.Class{Id: c.Id}, c, paths)
+		}
+	}
+	return classes, nil
+}
+
+func getSavedQuery(txn kvTxn, tenant, name string) (*pb.SavedQuery, error) {
+	item, err := txn.Get(savedQueryKey(tenant, name))
+	if err == badger.ErrKeyNotFound {
+		return nil, status.Errorf(codes.NotFound, "saved query %s not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	q := &pb.SavedQuery{}
+	err = item.Value(func(val []byte) error {
+		return proto.Unmarshal(val, q)
+	})
+	return q, err
+}
+
+func listSavedQueries(txn kvTxn, prefix string) (*pb.SavedQueries, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(prefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	qs := &pb.SavedQueries{}
+	for it.Rewind(); it.Valid(); it.Next() {
+		q := &pb.SavedQuery{}
+		err := it.Item().Value(func(val []byte) error {
+			return proto.Unmarshal(val, q)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", it.Item().Key(), err)
+		}
+		qs.Queries = append(qs.Queries, q)
+	}
+	return qs, nil
+}
+
+func (v *violations) checkQueryName(name string) {
+	if !queryNamePattern.MatchString(name) {
+		v.add("name", "must match %s", queryNamePattern)
+	}
+}
+
+func (s *server) SaveQuery(ctx context.Context, in *pb.SavedQuery) (*pb.SavedQuery, error) {
+	logf(ctx, "SaveQuery called for %s", in.Name)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := &pb.SavedQuery{
+		Name:       in.Name,
+		Tenant:     tenant,
+		Query:      in.Query,
+		UpdateTime: timestamppb.New(time.Now()),
+	}
+	b, err := proto.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		return txn.Txn.Set(savedQueryKey(tenant, q.Name), b)
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return q, nil
+}
+
+func (s *server) DeleteSavedQuery(ctx context.Context, in *pb.SavedQueryRequest) (*pb.Empty, error) {
+	logf(ctx, "DeleteSavedQuery called for %s", in.Name)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		if _, err := getSavedQuery(txn.Txn, tenant, in.Name); err != nil {
+			return err
+		}
+		return txn.Txn.Delete(savedQueryKey(tenant, in.Name))
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func (s *server) ListSavedQueries(ctx context.Context, in *pb.Empty) (*pb.SavedQueries, error) {
+	logf(ctx, "ListSavedQueries called")
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var qs *pb.SavedQueries
+	err = s.db.View(func(txn kvTxn) error {
+		var err error
+		qs, err = listSavedQueries(txn, queryPrefix+tenant+"/")
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return qs, nil
+}
+
+func (s *server) RunSavedQuery(ctx context.Context, in *pb.SavedQueryRequest) (*pb.Classes, error) {
+	logf(ctx, "RunSavedQuery called for %s", in.Name)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cs := &pb.Classes{}
+	err = s.db.View(func(txn kvTxn) error {
+		q, err := getSavedQuery(txn, tenant, in.Name)
+		if err != nil {
+			return err
+		}
+		cs.Classes, err = runQuery(newTenantTxn(txn, tenant), q.Query)
+		cs.TotalSize = int64(len(cs.Classes))
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return cs, nil
+}
+
+func (s *server) AdminListSavedQueries(ctx context.Context, in *pb.Empty) (*pb.SavedQueries, error) {
+	logf(ctx, "AdminListSavedQueries called")
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	var qs *pb.SavedQueries
+	err := s.db.View(func(txn kvTxn) error {
+		var err error
+		qs, err = listSavedQueries(txn, queryPrefix)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return qs, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+)
+
+var rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "adapter_rate_limited_total",
+	Help: "Requests rejected by the rate limiter, by which limit was hit (global or client).",
+}, []string{"limit"})
+
+// rateLimiter rejects requests with ResourceExhausted once the shared token
+// bucket or the caller's own bucket is empty. Either limit may be disabled.
+type rateLimiter struct {
+	mu     sync.Mutex
+	global *rate.Limiter
+
+	clientRate  rate.Limit
+	clientBurst int
+	// An idle client's bucket refills completely after clientIdle, at which
+	// point it is no different from a new bucket and can be dropped.
+	clientIdle time.Duration
+	clients    map[string]*clientBucket
+	lastSweep  time.Time
+}
+
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter limits all clients together to perSecond and each client to
+// clientPerSecond; a zero rate disables that limit.
+func newRateLimiter(perSecond float64, burst int, clientPerSecond float64, clientBurst int) *rateLimiter {
+	l := &rateLimiter{}
+	l.setLimits(perSecond, burst, clientPerSecond, clientBurst)
+	return l
+}
+
+// setLimits changes the limits in place. Client buckets start over at the new
+// burst; the global bucket keeps its tokens.
+func (l *rateLimiter) setLimits(perSecond float64, burst int, clientPerSecond float64, clientBurst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case perSecond <= 0:
+		l.global = nil
+	case l.global == nil:
+		l.global = rate.NewLimiter(rate.Limit(perSecond), burst)
+	default:
+		l.global.SetLimit(rate.Limit(perSecond))
+		l.global.SetBurst(burst)
+	}
+	l.clientRate = rate.Limit(clientPerSecond)
+	l.clientBurst = clientBurst
+	l.clientIdle = 0
+	if clientPerSecond > 0 {
+		l.clientIdle = time.Duration(float64(clientBurst)/clientPerSecond*float64(time.Second)) + time.Second
+	}
+	l.clients = make(map[string]*clientBucket)
+}
+
+// clientKey identifies the caller by its bearer token when authenticated and
+// by its IP address otherwise.
+func clientKey(ctx context.Context) string {
+	if _, ok := ctx.Value(tokenKey{}).(string); ok {
+		return actorFromContext(ctx)
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func (l *rateLimiter) clientAllow(key string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clientRate <= 0 {
+		// Disabled by setLimits since allow checked.
+		return true
+	}
+	if now.Sub(l.lastSweep) > l.clientIdle {
+		for k, b := range l.clients {
+			if now.Sub(b.lastSeen) > l.clientIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.clients[key]
+	if !ok {
+		b = &clientBucket{limiter: rate.NewLimiter(l.clientRate, l.clientBurst)}
+		l.clients[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter.AllowN(now, 1)
+}
+
+// tokenInterval is how long a bucket filling at r takes to gain a token,
+// the RetryInfo delay of a request it rejected.
+func tokenInterval(r rate.Limit) time.Duration {
+	return time.Duration(float64(time.Second) / float64(r))
+}
+
+func (l *rateLimiter) allow(ctx context.Context) error {
+	l.mu.Lock()
+	global, clientRate := l.global, l.clientRate
+	l.mu.Unlock()
+	// Check the caller's own bucket first so one noisy client doesn't drain
+	// the global bucket with requests that would be rejected anyway.
+	if clientRate > 0 && !l.clientAllow(clientKey(ctx)) {
+		rateLimited.WithLabelValues("client").Inc()
+		return retryAfter(codes.ResourceExhausted, tokenInterval(clientRate), "client rate limit exceeded")
+	}
+	if global != nil && !global.Allow() {
+		rateLimited.WithLabelValues("global").Inc()
+		return retryAfter(codes.ResourceExhausted, tokenInterval(global.Limit()), "rate limit exceeded")
+	}
+	return nil
+}
+
+func (l *rateLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.allow(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (l *rateLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.allow(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter(t *testing.T) {
+	from := func(ip string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}})
+	}
+	withToken := func(ip, token string) context.Context {
+		return context.WithValue(from(ip), tokenKey{}, token)
+	}
+
+	// The limits are slow enough that no bucket refills during a test, so
+	// each allows exactly its burst.
+	tests := []struct {
+		name string
+		// Global then per-client rate and burst.
+		perSecond, clientPerSecond float64
+		burst, clientBurst         int
+		calls                      []context.Context
+		// Whether each call is allowed.
+		want []bool
+	}{
+		{
+			name:  "disabled",
+			calls: []context.Context{from("10.0.0.1"), from("10.0.0.1"), from("10.0.0.1")},
+			want:  []bool{true, true, true},
+		},
+		{
+			name:      "global",
+			perSecond: 0.001, burst: 2,
+			calls: []context.Context{from("10.0.0.1"), from("10.0.0.2"), from("10.0.0.3")},
+			want:  []bool{true, true, false},
+		},
+		{
+			name:            "per client address",
+			clientPerSecond: 0.001, clientBurst: 2,
+			calls: []context.Context{from("10.0.0.1"), from("10.0.0.1"), from("10.0.0.1"), from("10.0.0.2")},
+			want:  []bool{true, true, false, true},
+		},
+		{
+			// Clients sharing an address, e.g. behind a NAT, are told apart by
+			// their tokens.
+			name:            "per client token",
+			clientPerSecond: 0.001, clientBurst: 1,
+			calls: []context.Context{withToken("10.0.0.1", "alice"), withToken("10.0.0.1", "bob"), withToken("10.0.0.2", "alice"), from("10.0.0.1")},
+			want:  []bool{true, true, false, true},
+		},
+		{
+			// A client over its limit doesn't spend the global bucket.
+			name:      "client before global",
+			perSecond: 0.001, burst: 2, clientPerSecond: 0.001, clientBurst: 1,
+			calls: []context.Context{from("10.0.0.1"), from("10.0.0.1"), from("10.0.0.1"), from("10.0.0.2"), from("10.0.0.3")},
+			want:  []bool{true, false, false, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.perSecond, tt.burst, tt.clientPerSecond, tt.clientBurst)
+			var handled int
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				handled++
+				return req, nil
+			}
+			var allowed int
+			for i, ctx := range tt.calls {
+				_, err := l.unaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/class.Adapter/Create"}, handler)
+				if got := err == nil; got != tt.want[i] {
+					t.Errorf("call %d allowed = %v, want %v (%v)", i, got, tt.want[i], err)
+				}
+				if err == nil {
+					allowed++
+					continue
+				}
+				if status.Code(err) != codes.ResourceExhausted {
+					t.Errorf("call %d got %v, want ResourceExhausted", i, err)
+				}
+				var retry *errdetails.RetryInfo
+				for _, d := range status.Convert(err).Details() {
+					if d, ok := d.(*errdetails.RetryInfo); ok {
+						retry = d
+					}
+				}
+				if retry == nil || retry.RetryDelay.AsDuration() <= 0 {
+					t.Errorf("call %d got %v without a RetryInfo delay", i, err)
+				}
+			}
+			if handled != allowed {
+				t.Errorf("handler ran %d times for %d allowed calls", handled, allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterSetLimits(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1")}})
+	l := newRateLimiter(0, 0, 0.001, 1)
+	if l.allow(ctx) != nil || l.allow(ctx) == nil {
+		t.Fatal("a client with a burst of 1 wasn't limited to one call")
+	}
+	// A reload starts client buckets over, and disabling a limit lifts it.
+	l.setLimits(0, 0, 0.001, 2)
+	if l.allow(ctx) != nil || l.allow(ctx) != nil || l.allow(ctx) == nil {
+		t.Error("a client with a reloaded burst of 2 wasn't limited to two calls")
+	}
+	l.setLimits(0, 0, 0, 0)
+	if err := l.allow(ctx); err != nil {
+		t.Errorf("allow with the limits disabled got %v", err)
+	}
+}
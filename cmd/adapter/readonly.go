@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// writeMethods change stored data and are refused by a read-only adapter.
+var writeMethods = map[string]bool{
+	"/class.Adapter/Create":              true,
+	"/class.Adapter/Update":              true,
+	"/class.Adapter/Delete":              true,
+	"/class.Adapter/AcquireEditLease":    true,
+	"/class.Adapter/ReleaseEditLease":    true,
+	"/class.Adapter/TransitionState":     true,
+	"/class.Adapter/SaveQuery":           true,
+	"/class.Adapter/DeleteSavedQuery":    true,
+	"/class.Adapter/AdminOffboardTenant": true,
+	"/class.Adapter/CreateClassBundle":   true,
+	"/class.Adapter/AdminCompact":        true,
+	"/class.Adapter/AdminRunGC":          true,
+	"/class.Adapter/ArchiveSemester":     true,
+	"/class.Adapter/Enroll":              true,
+	"/class.Adapter/Unenroll":            true,
+	"/class.Adapter/BatchDelete":         true,
+	"/class.Adapter/Clone":               true,
+	"/class.Adapter/Transact":            true,
+	"/class.Adapter/ImportRoster":        true,
+	"/class.Adapter/AdminSyncClassroom":  true,
+	"/class.Instructors/Create":          true,
+	"/class.Instructors/Update":          true,
+	"/class.Instructors/Delete":          true,
+	"/class.KeyValueStore/Put":           true,
+	"/class.KeyValueStore/Delete":        true,
+	"/adapter.v2.Classes/CreateClass":    true,
+	"/adapter.v2.Classes/UpdateClass":    true,
+	"/adapter.v2.Classes/DeleteClass":    true,
+}
+
+// readOnly refuses writes, telling callers why.
+type readOnly struct {
+	reason string
+}
+
+func (r *readOnly) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if writeMethods[info.FullMethod] {
+		return nil, preconditionFailed(preconditionServer, "server", "adapter is read-only: %s", r.reason)
+	}
+	return handler(ctx, req)
+}
+
+func (r *readOnly) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if writeMethods[info.FullMethod] {
+		return preconditionFailed(preconditionServer, "server", "adapter is read-only: %s", r.reason)
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestWriteMethods(t *testing.T) {
+	// Every method that may change data is refused: all but those marked
+	// free of side effects and the server streams that only read.
+	for _, fd := range []protoreflect.FileDescriptor{pb.File_proto_class_proto, adapterv2.File_proto_v2_class_proto} {
+		for i := 0; i < fd.Services().Len(); i++ {
+			sd := fd.Services().Get(i)
+			for j := 0; j < sd.Methods().Len(); j++ {
+				md := sd.Methods().Get(j)
+				name := fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())
+				reads := md.Options().(*descriptorpb.MethodOptions).GetIdempotencyLevel() == descriptorpb.MethodOptions_NO_SIDE_EFFECTS ||
+					md.IsStreamingServer() && !md.IsStreamingClient()
+				if writeMethods[name] == reads {
+					t.Errorf("%s is in writeMethods: %v, want %v", name, writeMethods[name], !reads)
+				}
+			}
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDB(driverBadger, dbOptions{dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestClasses(t, db, &pb.Class{Id: "MATH101", Name: "Algebra"})
+	if err := migrateKeySchema(db); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// A restored backup, opened read-only.
+	if db, err = openDB(driverBadger, dbOptions{dir: dir, readOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := checkKeySchema(db); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{db: db, events: newEventBus()}
+	ro := &readOnly{reason: "started with -read-only"}
+	ctx := context.Background()
+	call := func(method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+		return ro.unaryInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+
+	resp, err := call("/class.Adapter/Get", &pb.GetRequest{Id: "MATH101"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.Get(ctx, req.(*pb.GetRequest))
+	})
+	if err != nil || resp.(*pb.Class).Name != "Algebra" {
+		t.Errorf("Get on a read-only adapter returned %v, %v", resp, err)
+	}
+	for _, method := range []string{"/class.Adapter/Create", "/class.Adapter/Update", "/class.Adapter/Delete", "/class.KeyValueStore/Put", "/adapter.v2.Classes/DeleteClass"} {
+		_, err := call(method, &pb.Class{Id: "MATH101"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			t.Errorf("%s reached its handler on a read-only adapter", method)
+			return nil, nil
+		})
+		if status.Code(err) != codes.FailedPrecondition || preconditionType(err) != preconditionServer {
+			t.Errorf("%s on a read-only adapter returned %v, want FailedPrecondition of type %s", method, err, preconditionServer)
+		}
+	}
+
+	// Writes that got past the interceptor would still fail in storage.
+	if _, err := s.Create(ctx, &pb.Class{Id: "MATH102", Name: "Geometry"}); err == nil {
+		t.Error("Create on a database opened read-only succeeded")
+	}
+}
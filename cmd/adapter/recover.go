@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var handlerPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "adapter_handler_panics_total",
+	Help: "Handler panics recovered and answered with Internal, by method.",
+}, []string{"method"})
+
+// The interceptors below turn a panic in anything after them in the chain
+// into an Internal error for that call alone, logging the stack, instead of
+// letting it take down the server and every other call with it.
+
+func recoverUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(ctx, info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func recoverStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(ss.Context(), info.FullMethod, r)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func recovered(ctx context.Context, method string, r interface{}) error {
+	handlerPanics.WithLabelValues(method).Inc()
+	logf(ctx, "Panic in %s: %v\n%s", method, r, debug.Stack())
+	return status.Error(codes.Internal, "internal error")
+}
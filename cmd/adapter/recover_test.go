@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecoverUnaryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/class.Adapter/List"}
+	_, err := recoverUnaryInterceptor(context.Background(), &pb.ListRequest{}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		var ids []string
+		return ids[len(ids)-1], nil
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("a panicking handler returned %v, want Internal", err)
+	}
+
+	resp, err := recoverUnaryInterceptor(context.Background(), &pb.ListRequest{}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &pb.Classes{}, nil
+	})
+	if err != nil || resp == nil {
+		t.Errorf("a working handler returned %v, %v", resp, err)
+	}
+}
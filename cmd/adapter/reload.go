@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+// reloadableFlags take effect on SIGHUP. Other settings need a restart; a
+// reload that changes them logs a warning and leaves them as they are.
+var reloadableFlags = map[string]bool{
+	"auth-tokens-file":        true,
+	"rate-limit":              true,
+	"rate-burst":              true,
+	"client-rate-limit":       true,
+	"client-rate-burst":       true,
+	"get-coalesce-window":     true,
+	"stats-min-count":         true,
+	"list-max-results":        true,
+	"list-parallelism":        true,
+	"pagination":              true,
+	"client-policy-file":      true,
+	"default-timeout":         true,
+	"method-timeouts":         true,
+	"access-log":              true,
+	"access-log-sample-rates": true,
+	// -fault-inject itself can't be turned on by a reload.
+	"fault-inject-error-percent": true,
+	"fault-inject-delay-percent": true,
+	"fault-inject-max-delay":     true,
+	"max-db-size":                true,
+	"min-free-disk":              true,
+}
+
+// tunables are the server settings a reload can change while requests are
+// in flight.
+type tunables struct {
+	// How long the first of a burst of identical Gets waits for others to
+	// share its read.
+	coalesceWindow time.Duration
+	// Aggregate stats groups smaller than this are suppressed.
+	statsMinCount int64
+	// Most classes a List returns, 0 for no limit.
+	listMaxResults int
+	// Ranges a List reading every class scans concurrently.
+	listParallelism int
+	// One of paginationOptional, paginationWarn or paginationStrict.
+	paginationMode string
+	// Served by GetClientPolicy, apart from the max page size.
+	clientPolicy *pb.ClientPolicy
+}
+
+// tuning returns the current tunables, all zero until setTuning is called.
+func (s *server) tuning() tunables {
+	t, _ := s.settings.Load().(tunables)
+	return t
+}
+
+func (s *server) setTuning(t tunables) {
+	s.settings.Store(t)
+}
+
+// reloadOnHangup re-reads the environment and config file each time the
+// process receives SIGHUP, then calls apply to put the new flag values into
+// effect. Flags given on the command line keep their values.
+func reloadOnHangup(fs *flag.FlagSet, configFlag string, commandLine map[string]bool, apply func() error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := reloadConfig(fs, configFlag, commandLine, apply); err != nil {
+			log.Printf("Config reload failed, keeping the current settings: %v", err)
+			continue
+		}
+		log.Printf("Reloaded configuration")
+	}
+}
+
+// reloadConfig resets the flags not given on the command line and applies
+// the config again. If that or apply fails, every flag goes back to its
+// previous value.
+func reloadConfig(fs *flag.FlagSet, configFlag string, commandLine map[string]bool, apply func() error) error {
+	previous := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		previous[f.Name] = f.Value.String()
+		if !commandLine[f.Name] {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	err := applyConfig(fs, configFlag, commandLine)
+	fs.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		if err == nil && v != previous[f.Name] && !reloadableFlags[f.Name] && f.Name != configFlag {
+			log.Printf("Ignoring the new value of -%s until restart", f.Name)
+		}
+		if err != nil || !reloadableFlags[f.Name] {
+			f.Value.Set(previous[f.Name])
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		fs.VisitAll(func(f *flag.Flag) { f.Value.Set(previous[f.Name]) })
+		return err
+	}
+	return nil
+}
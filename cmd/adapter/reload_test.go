@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	path := writeConfig(t, "data-dir: /var/lib/adapter\nlist-max-results: 50\nlisten: ':6000'\n")
+	f := newConfigFlags()
+	// -listen is given on the command line, so no reload changes it.
+	if err := f.fs.Parse([]string{"-config", path, "-listen", ":7000"}); err != nil {
+		t.Fatal(err)
+	}
+	commandLine := commandLineFlags(f.fs)
+	if err := applyConfig(f.fs, "config", commandLine); err != nil {
+		t.Fatal(err)
+	}
+	// apply puts the setting into effect as serve's does.
+	s := &server{}
+	apply := func() error {
+		s.setTuning(tunables{listMaxResults: *f.maxResults})
+		return nil
+	}
+	if err := apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	// -list-max-results is reloadable; -data-dir needs a restart and keeps its
+	// value.
+	rewrite := func(yaml string) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(yaml), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rewrite("data-dir: /srv/adapter\nlist-max-results: 80\nlisten: ':6001'\n")
+	if err := reloadConfig(f.fs, "config", commandLine, apply); err != nil {
+		t.Fatal(err)
+	}
+	if s.tuning().listMaxResults != 80 || *f.dataDir != "/var/lib/adapter" || *f.listen != ":7000" {
+		t.Errorf("after a reload, -list-max-results %d, -data-dir %s, -listen %s; want 80, /var/lib/adapter, :7000",
+			s.tuning().listMaxResults, *f.dataDir, *f.listen)
+	}
+
+	// A setting removed from the file goes back to its default.
+	rewrite("data-dir: /var/lib/adapter\n")
+	if err := reloadConfig(f.fs, "config", commandLine, apply); err != nil {
+		t.Fatal(err)
+	}
+	if s.tuning().listMaxResults != 1000 {
+		t.Errorf("after removing list-max-results, -list-max-results is %d, want its default of 1000", s.tuning().listMaxResults)
+	}
+
+	// A file that doesn't parse, or settings apply rejects, change nothing.
+	rewrite("list-max-results: 90\n")
+	if err := reloadConfig(f.fs, "config", commandLine, func() error { return errors.New("invalid") }); err == nil {
+		t.Error("reloadConfig succeeded though apply failed")
+	}
+	rewrite("list-max-results: many\n")
+	if err := reloadConfig(f.fs, "config", commandLine, apply); err == nil {
+		t.Error("reloadConfig of an invalid list-max-results succeeded")
+	}
+	if *f.maxResults != 1000 || s.tuning().listMaxResults != 1000 {
+		t.Errorf("after failed reloads, -list-max-results is %d (applied %d), want 1000", *f.maxResults, s.tuning().listMaxResults)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	addr := fs.String("addr", "localhost"+port, "address of the adapter to replay the calls against")
+	token := fs.String("token", "", "bearer token to send with every call, if the adapter requires one")
+	useTLS := fs.Bool("tls", false, "dial the adapter with TLS, verifying it against the system's roots unless -ca-file is set")
+	caFile := fs.String("ca-file", "", "PEM file of the certificate authorities to verify the adapter with; implies -tls")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: adapter replay [flags] capture-file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	creds, err := replayCredentials(*useTLS, *caFile)
+	if err != nil {
+		log.Fatalf("replay: %s", err)
+	}
+	conn, err := grpc.Dial(*addr, creds)
+	if err != nil {
+		log.Fatalf("replay: %s", err)
+	}
+	defer conn.Close()
+
+	var calls, mismatches int
+	for _, path := range fs.Args() {
+		// Replay the older half of the ring first.
+		for _, p := range []string{path + ".1", path} {
+			if _, err := os.Stat(p); p != path && os.IsNotExist(err) {
+				continue
+			}
+			n, bad, err := replayFile(conn, p, *token)
+			calls += n
+			mismatches += bad
+			if err != nil {
+				log.Fatalf("replay: %s", err)
+			}
+		}
+	}
+	log.Printf("Replayed %d calls, %d differed from the capture", calls, mismatches)
+	if mismatches > 0 {
+		os.Exit(1)
+	}
+}
+
+// replayCredentials returns the transport credentials to dial the adapter
+// with: TLS when useTLS or caFile is set, plaintext otherwise.
+func replayCredentials(useTLS bool, caFile string) (grpc.DialOption, error) {
+	switch {
+	case caFile != "":
+		creds, err := credentials.NewClientTLSFromFile(caFile, "")
+		if err != nil {
+			return nil, err
+		}
+		return grpc.WithTransportCredentials(creds), nil
+	case useTLS:
+		return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})), nil
+	}
+	return grpc.WithInsecure(), nil
+}
+
+// replayFile re-issues every call captured in path, reporting those whose
+// status or response differs from what was recorded.
+func replayFile(conn *grpc.ClientConn, path, token string) (calls, mismatches int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		var rec captureRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return calls, mismatches, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		diff, err := replayCall(conn, &rec, token)
+		if err != nil {
+			return calls, mismatches, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		calls++
+		if diff != "" {
+			mismatches++
+			fmt.Printf("%s:%d: %s (tenant %s, captured %s): %s\n", path, line, rec.Method, rec.Tenant, rec.Time.Format(time.RFC3339), diff)
+		}
+	}
+	return calls, mismatches, sc.Err()
+}
+
+// replayCall issues rec's request and describes how the outcome differs from
+// the captured one, or returns "" if it doesn't.
+func replayCall(conn *grpc.ClientConn, rec *captureRecord, token string) (string, error) {
+	md, err := methodDescriptor(rec.Method)
+	if err != nil {
+		return "", err
+	}
+	requests := []json.RawMessage{rec.Request}
+	if md.IsStreamingClient() {
+		requests = rec.Requests
+	}
+	var reqs []proto.Message
+	for _, r := range requests {
+		req, err := newMessage(md.Input())
+		if err != nil {
+			return "", err
+		}
+		if err := protojson.Unmarshal(r, req); err != nil {
+			return "", fmt.Errorf("request: %w", err)
+		}
+		reqs = append(reqs, req)
+	}
+	resp, err := newMessage(md.Output())
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, tenantMetadataKey, rec.Tenant)
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	var callErr error
+	if md.IsStreamingClient() {
+		callErr = replayClientStream(ctx, conn, rec.Method, reqs, resp)
+	} else {
+		callErr = conn.Invoke(ctx, rec.Method, reqs[0], resp)
+	}
+	if code := status.Code(callErr).String(); code != rec.Code {
+		return fmt.Sprintf("got %s (%s), want %s", code, status.Convert(callErr).Message(), rec.Code), nil
+	}
+	if callErr != nil {
+		return "", nil
+	}
+
+	want, err := newMessage(md.Output())
+	if err != nil {
+		return "", err
+	}
+	if err := protojson.Unmarshal(rec.Response, want); err != nil {
+		return "", fmt.Errorf("response: %w", err)
+	}
+	// Timestamps, and the etags hashed from them, are set by the server and
+	// never match, and the capture holds no secrets to compare.
+	clearTimestamps(resp.ProtoReflect())
+	clearTimestamps(want.ProtoReflect())
+	scrubSecrets(resp.ProtoReflect())
+	if !proto.Equal(resp, want) {
+		got, _ := protojson.Marshal(resp)
+		return fmt.Sprintf("got response %s, want %s", got, rec.Response), nil
+	}
+	return "", nil
+}
+
+// replayClientStream sends reqs on a client-streaming call of method and
+// receives its response into resp.
+func replayClientStream(ctx context.Context, conn *grpc.ClientConn, method string, reqs []proto.Message, resp proto.Message) error {
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true}, method)
+	if err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		// An error sending is returned by RecvMsg, with the call's status.
+		if err := stream.SendMsg(req); err != nil {
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	return stream.RecvMsg(resp)
+}
+
+// methodDescriptor looks up a method by its gRPC name, e.g.
+// "/class.Adapter/Get".
+func methodDescriptor(method string) (protoreflect.MethodDescriptor, error) {
+	name := strings.Replace(strings.TrimPrefix(method, "/"), "/", ".", 1)
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown method %s", method)
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("unknown method %s", method)
+	}
+	return md, nil
+}
+
+func newMessage(d protoreflect.MessageDescriptor) (proto.Message, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(d.FullName())
+	if err != nil {
+		return nil, err
+	}
+	return mt.New().Interface(), nil
+}
+
+// clearTimestamps clears the timestamps in m and the messages it holds, and
+// the etags of classes.
+func clearTimestamps(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.FullName() == "class.Class.etag" {
+			m.Clear(fd)
+		}
+		if fd.Message() == nil || fd.IsMap() {
+			return true
+		}
+		switch {
+		case fd.Message().FullName() == "google.protobuf.Timestamp":
+			m.Clear(fd)
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				clearTimestamps(v.List().Get(i).Message())
+			}
+		default:
+			clearTimestamps(v.Message())
+		}
+		return true
+	})
+}
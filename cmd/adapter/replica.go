@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// replicaPageSize is how many classes each List of a resync reads.
+	replicaPageSize = 500
+	// replicaBatch is how many classes a resync writes per transaction.
+	replicaBatch = 100
+	// Resyncs back off from replicaMinBackoff to replicaMaxBackoff while
+	// the primary can't be reached.
+	replicaMinBackoff = time.Second
+	replicaMaxBackoff = 30 * time.Second
+)
+
+// replica keeps the classes of the local database in step with a primary
+// adapter's. For each tenant it starts a Watch, lists every class, makes
+// the local copy match, and then applies the Watch events as they come.
+// Whenever the Watch ends, e.g. because the replica fell behind, it starts
+// over. Only classes are copied; enrollments, instructors and key-value
+// pairs are not.
+type replica struct {
+	s        *server
+	upstream pb.AdapterClient
+	addr     string
+	tenants  []string
+	// Bearer token to call the primary with; none if empty.
+	token string
+}
+
+func newReplica(s *server, conn *grpc.ClientConn, addr string, tenants []string, token string) *replica {
+	return &replica{s: s, upstream: pb.NewAdapterClient(conn), addr: addr, tenants: tenants, token: token}
+}
+
+// run follows every tenant until ctx ends, calling synced once each has
+// been copied in full for the first time.
+func (r *replica) run(ctx context.Context, synced func()) {
+	var wg sync.WaitGroup
+	wg.Add(len(r.tenants))
+	go func() {
+		wg.Wait()
+		synced()
+	}()
+	for _, tenant := range r.tenants {
+		go r.follow(ctx, tenant, wg.Done)
+	}
+}
+
+// follow resyncs tenant whenever its Watch ends, backing off while the
+// primary is failing.
+func (r *replica) follow(ctx context.Context, tenant string, synced func()) {
+	var once sync.Once
+	backoff := replicaMinBackoff
+	for {
+		err := r.sync(ctx, tenant, func() {
+			once.Do(synced)
+			backoff = replicaMinBackoff
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Replication of tenant %s from %s stopped, resyncing in %s: %v", tenant, r.addr, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > replicaMaxBackoff {
+			backoff = replicaMaxBackoff
+		}
+	}
+}
+
+// outgoing returns ctx with the metadata to call the primary for tenant.
+func (r *replica) outgoing(ctx context.Context, tenant string) context.Context {
+	if tenant != defaultTenant {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenantMetadataKey, tenant)
+	}
+	if r.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+r.token)
+	}
+	return ctx
+}
+
+// sync copies tenant's classes in full, calls synced, and applies changes
+// until the Watch ends, returning why.
+func (r *replica) sync(ctx context.Context, tenant string, synced func()) error {
+	ctx, cancel := context.WithCancel(r.outgoing(ctx, tenant))
+	defer cancel()
+	watch, err := r.upstream.Watch(ctx, &pb.WatchRequest{})
+	if err != nil {
+		return err
+	}
+	// The primary sends headers once the Watch is subscribed, so no change
+	// made after this falls between the listing and the first event. Events
+	// for changes the listing already holds are applied again, harmlessly.
+	if _, err := watch.Header(); err != nil {
+		return err
+	}
+	classes, err := r.listAll(ctx)
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	if err := r.reconcile(ctx, tenant, classes); err != nil {
+		return fmt.Errorf("apply listing: %w", err)
+	}
+	log.Printf("Replicated %d classes of tenant %s from %s", len(classes), tenant, r.addr)
+	synced()
+	for {
+		e, err := watch.Recv()
+		if err == io.EOF {
+			return fmt.Errorf("watch ended")
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.apply(ctx, tenant, e); err != nil {
+			return fmt.Errorf("apply %s of %s: %w", e.Type, e.Class.GetId(), err)
+		}
+	}
+}
+
+// listAll reads every class from the primary, page by page.
+func (r *replica) listAll(ctx context.Context) ([]*pb.Class, error) {
+	req := &pb.ListRequest{PageSize: replicaPageSize}
+	var classes []*pb.Class
+	for {
+		page, err := r.upstream.List(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, page.Classes...)
+		if page.NextPageToken == "" {
+			return classes, nil
+		}
+		req.PageToken = page.NextPageToken
+	}
+}
+
+// reconcile makes tenant's local classes those listed: classes the primary
+// no longer has are removed, and the others written as listed. The writes
+// are split into batches, so readers may see a mix of old and new classes
+// until it returns.
+func (r *replica) reconcile(ctx context.Context, tenant string, classes []*pb.Class) error {
+	listed := make(map[string]bool, len(classes))
+	for _, c := range classes {
+		listed[c.Id] = true
+	}
+	var gone []string
+	err := r.s.view(ctx, tenant, func(txn *tenantTxn) error {
+		ids, err := listClassIds(txn)
+		for _, id := range ids {
+			if !listed[id] {
+				gone = append(gone, id)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for len(gone) > 0 {
+		n := len(gone)
+		if n > replicaBatch {
+			n = replicaBatch
+		}
+		err := r.s.update(ctx, tenant, func(txn *tenantTxn) error {
+			for _, id := range gone[:n] {
+				if err := removeClass(txn, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range gone[:n] {
+			r.s.forgetRead(tenant, id)
+		}
+		gone = gone[n:]
+	}
+	for len(classes) > 0 {
+		n := len(classes)
+		if n > replicaBatch {
+			n = replicaBatch
+		}
+		err := r.s.update(ctx, tenant, func(txn *tenantTxn) error {
+			for _, c := range classes[:n] {
+				if err := storeClass(txn, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range classes[:n] {
+			r.s.forgetRead(tenant, c.Id)
+		}
+		classes = classes[n:]
+	}
+	return nil
+}
+
+// apply makes one change from the primary's Watch locally, and passes it on
+// to the replica's own watchers.
+func (r *replica) apply(ctx context.Context, tenant string, e *pb.ClassEvent) error {
+	if e.Class == nil {
+		return nil
+	}
+	err := r.s.update(ctx, tenant, func(txn *tenantTxn) error {
+		// The replica logs the change under a sequence of its own.
+		txn.record(e)
+		if e.Type == pb.ClassEvent_DELETED {
+			return removeClass(txn, e.Class.Id)
+		}
+		return storeClass(txn, e.Class)
+	})
+	if err != nil {
+		return err
+	}
+	r.s.forgetRead(tenant, e.Class.Id)
+	r.s.events.publish(e)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// servePrimary serves s over an in-memory listener and returns a connection
+// to it.
+func servePrimary(t *testing.T, s *server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	pb.RegisterAdapterServer(gs, s)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitForIds lists the Ids of the classes in s, waiting up to a few seconds
+// for them to become want.
+func waitForIds(t *testing.T, s *server, want ...string) {
+	t.Helper()
+	var got []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		err := s.view(context.Background(), defaultTenant, func(txn *tenantTxn) error {
+			classes, err := listClasses(txn)
+			got = ids(classes)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equalIds(got, want) {
+			return
+		}
+	}
+	t.Fatalf("replica has classes %v, want %v", got, want)
+}
+
+func TestReplicaFollowsPrimary(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		primary := &server{db: newDB(), events: newEventBus()}
+		putTestClasses(t, primary.db, &pb.Class{Id: "ART1", Name: "Drawing"}, &pb.Class{Id: "MATH101", Name: "Algebra"})
+		local := &server{db: newDB(), events: newEventBus()}
+		// The replica starts out with a stale copy of ART1, and a class the
+		// primary no longer has.
+		putTestClasses(t, local.db, &pb.Class{Id: "ART1", Name: "Old"}, &pb.Class{Id: "GONE1", Name: "Gone"})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		synced := make(chan struct{})
+		r := newReplica(local, servePrimary(t, primary), "bufnet", []string{defaultTenant}, "")
+		r.run(ctx, func() { close(synced) })
+		select {
+		case <-synced:
+		case <-time.After(5 * time.Second):
+			t.Fatal("replica never synced")
+		}
+		waitForIds(t, local, "ART1", "MATH101")
+		got, err := local.Get(context.Background(), &pb.GetRequest{Id: "ART1"})
+		if err != nil || got.Name != "Drawing" {
+			t.Errorf("replica's ART1 is %v, %v, want the primary's", got, err)
+		}
+
+		// Changes on the primary reach the replica and its own watchers.
+		sub := local.events.subscribe(func(*pb.ClassEvent) bool { return true })
+		defer local.events.unsubscribe(sub)
+		if _, err := primary.Create(context.Background(), &pb.Class{Id: "BIO1", Name: "Cells"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := primary.Delete(context.Background(), &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+		waitForIds(t, local, "ART1", "BIO1")
+		select {
+		case e := <-sub.events:
+			if e.Type != pb.ClassEvent_CREATED || e.Class.Id != "BIO1" {
+				t.Errorf("replica's watchers got %v first, want BIO1 created", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("replica's watchers got no event")
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIdMetadataKey carries a call's request Id. A caller may send one,
+// e.g. the Id of the request that made the call, and the adapter makes one
+// up otherwise. Either way it is echoed in the response header, prefixed to
+// the call's log lines, sent on with calls a proxy forwards and attached to
+// errors as RequestInfo.
+const requestIdMetadataKey = "x-request-id"
+
+// maxRequestIdLength bounds caller-supplied request Ids; longer ones are
+// replaced.
+const maxRequestIdLength = 128
+
+type requestIdKey struct{}
+
+// requestIdFromContext returns the request Id of the call ctx belongs to,
+// or "" outside a call.
+func requestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// withRequestId returns ctx carrying the caller's request Id, or a new one
+// if the caller sent none or one that isn't printable ASCII.
+func withRequestId(ctx context.Context) (context.Context, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if ids := md.Get(requestIdMetadataKey); len(ids) > 0 && validRequestId(ids[0]) {
+		id = ids[0]
+	} else {
+		id = newRequestId()
+	}
+	return context.WithValue(ctx, requestIdKey{}, id), id
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Ids only correlate log lines; a clash is no worse than none.
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// withRequestInfo attaches id to err's status as RequestInfo.
+func withRequestInfo(err error, id string) error {
+	if err == nil {
+		return nil
+	}
+	return withDetails(status.Convert(err), &errdetails.RequestInfo{RequestId: id}).Err()
+}
+
+func requestIdUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, id := withRequestId(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIdMetadataKey, id))
+	resp, err := handler(ctx, req)
+	return resp, withRequestInfo(err, id)
+}
+
+func requestIdStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, id := withRequestId(ss.Context())
+	ss.SetHeader(metadata.Pairs(requestIdMetadataKey, id))
+	return withRequestInfo(handler(srv, &contextStream{ServerStream: ss, ctx: ctx}), id)
+}
+
+// logf logs like log.Printf, prefixing the line with the request Id of the
+// call ctx belongs to, if any.
+func logf(ctx context.Context, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if id := requestIdFromContext(ctx); id != "" {
+		msg = "[" + id + "] " + msg
+	}
+	log.Output(2, msg)
+}
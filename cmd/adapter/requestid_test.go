@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/virtual-class-tutor/class-adapter-file/pkg/client"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestRequestId(t *testing.T) {
+	s := &server{db: newTestDB(t, driverBadger, t.TempDir()), events: newEventBus()}
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(grpc.UnaryInterceptor(requestIdUnaryInterceptor))
+	pb.RegisterAdapterServer(gs, s)
+	go gs.Serve(lis)
+	defer gs.Stop()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := pb.NewAdapterClient(conn)
+
+	var header metadata.MD
+	ctx := client.WithRequestId(context.Background(), "trace-42")
+	_, err = c.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}}, grpc.Header(&header))
+	if err == nil {
+		t.Fatal("updating a missing class succeeded")
+	}
+	if got := header.Get(requestIdMetadataKey); len(got) != 1 || got[0] != "trace-42" {
+		t.Errorf("response header has request Id %v, want the caller's", got)
+	}
+	if id := client.RequestId(err); id != "trace-42" {
+		t.Errorf("error %v carries request Id %q, want the caller's", err, id)
+	}
+
+	for _, sent := range []string{"", "has spaces"} {
+		ctx := context.Background()
+		if sent != "" {
+			ctx = client.WithRequestId(ctx, sent)
+		}
+		header = nil
+		if _, err := c.Exists(ctx, &pb.GetRequest{Id: "MATH101"}, grpc.Header(&header)); err != nil {
+			t.Fatal(err)
+		}
+		if got := header.Get(requestIdMetadataKey); len(got) != 1 || len(got[0]) != 32 {
+			t.Errorf("sending request Id %q got %v back, want a new one", sent, got)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRosterBytes is the largest CSV file ImportRoster accepts; registrars
+// split larger rosters.
+const maxRosterBytes = 32 << 20
+
+// rosterColumns are the columns a roster's header may name. id and name
+// are required.
+var rosterColumns = map[string]bool{
+	"id":               true,
+	"name":             true,
+	"semester":         true,
+	"instructor_id":    true,
+	"instructor_name":  true,
+	"capacity":         true,
+	"description":      true,
+	"labels":           true,
+	"prerequisite_ids": true,
+}
+
+// checkRosterHeader normalizes the column names of header in place.
+func (v *violations) checkRosterHeader(header []string) {
+	seen := make(map[string]bool)
+	for i, col := range header {
+		col = strings.ToLower(strings.TrimSpace(col))
+		header[i] = col
+		switch {
+		case !rosterColumns[col]:
+			v.add("data", "header names unknown column %q", col)
+		case seen[col]:
+			v.add("data", "header names column %q twice", col)
+		}
+		seen[col] = true
+	}
+	for _, col := range []string{"id", "name"} {
+		if !seen[col] {
+			v.add("data", "header must name the %s column", col)
+		}
+	}
+}
+
+// parseRosterRow builds the class a row describes, with its columns named
+// by header.
+func parseRosterRow(header, row []string) (*pb.Class, error) {
+	c := &pb.Class{}
+	for i, col := range header {
+		value := strings.TrimSpace(row[i])
+		switch col {
+		case "id":
+			c.Id = value
+		case "name":
+			c.Name = value
+		case "semester":
+			c.Semester = value
+		case "instructor_id":
+			c.InstructorId = value
+		case "instructor_name":
+			c.InstructorName = value
+		case "capacity":
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return c, fmt.Errorf("capacity %q is not a whole number", value)
+			}
+			c.Capacity = int32(n)
+		case "description":
+			c.Description = value
+		case "labels":
+			for _, pair := range splitRosterList(value) {
+				i := strings.Index(pair, "=")
+				if i <= 0 {
+					return c, fmt.Errorf("label %q is not key=value", pair)
+				}
+				if c.Labels == nil {
+					c.Labels = make(map[string]string)
+				}
+				c.Labels[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+			}
+		case "prerequisite_ids":
+			c.PrerequisiteIds = splitRosterList(value)
+		}
+	}
+	return c, nil
+}
+
+// splitRosterList splits a cell holding a list separated by ";".
+func splitRosterList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *server) ImportRoster(stream pb.Adapter_ImportRosterServer) error {
+	ctx := stream.Context()
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	var dryRun bool
+	for first := true; ; first = false {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			dryRun = chunk.DryRun
+		}
+		if data.Len()+len(chunk.Data) > maxRosterBytes {
+			var v violations
+			v.add("data", "roster must be at most %d bytes; split it", maxRosterBytes)
+			return v.err()
+		}
+		data.Write(chunk.Data)
+	}
+	logf(stream.Context(), "ImportRoster called with %d bytes, dry run %v", data.Len(), dryRun)
+
+	r := csv.NewReader(&data)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	var v violations
+	switch {
+	case err == io.EOF:
+		v.add("data", "roster is empty")
+	case err != nil:
+		v.add("data", "header: %s", err)
+	default:
+		v.checkRosterHeader(header)
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	resp := &pb.ImportRosterResponse{DryRun: dryRun}
+	for row := int32(2); ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The reader can't tell where a malformed row ends, so nothing
+			// after it can be trusted.
+			var v violations
+			v.add("data", "row %d: %s", row, err)
+			return v.err()
+		}
+		var c *pb.Class
+		if len(record) != len(header) {
+			err = fmt.Errorf("row has %d columns, the header %d", len(record), len(header))
+		} else if c, err = parseRosterRow(header, record); err == nil {
+			var created bool
+			created, err = s.importRosterRow(ctx, tenant, c, dryRun)
+			if err == nil && created {
+				resp.Created++
+			} else if err == nil {
+				resp.Updated++
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if status.Code(err) == codes.Canceled || status.Code(err) == codes.DeadlineExceeded {
+			return err
+		}
+		msg := err.Error()
+		if st, ok := status.FromError(err); ok {
+			msg = st.Message()
+		}
+		resp.Failed++
+		resp.Errors = append(resp.Errors, &pb.RosterRowError{Row: row, Id: rosterRowId(header, record), Message: msg})
+	}
+	logf(stream.Context(), "ImportRoster created %d, updated %d and failed %d classes, dry run %v", resp.Created, resp.Updated, resp.Failed, dryRun)
+	return stream.SendAndClose(resp)
+}
+
+// rosterRowId returns the id column of record, if it has one.
+func rosterRowId(header, record []string) string {
+	for i, col := range header {
+		if col == "id" && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+	}
+	return ""
+}
+
+// importRosterRow creates or replaces c as Create would, reporting whether
+// it created it. Failures are status errors. A class held by an edit lease
+// isn't replaced.
+func (s *server) importRosterRow(ctx context.Context, tenant string, c *pb.Class, dryRun bool) (created bool, err error) {
+	if err := validateClass(c); err != nil {
+		return false, err
+	}
+	var event *pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		if err := checkEditLease(txn, c.Id, ""); err != nil {
+			return err
+		}
+		old, err := allowCorrupt(getClass(txn, c.Id))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		created = old == nil
+		if err := checkReferences(txn, c); err != nil {
+			return err
+		}
+		if err := putClass(txn, c); err != nil {
+			return err
+		}
+		if dryRun {
+			return errValidateOnly
+		}
+		if err := s.audit.record(ctx, txn, "ImportRoster", c.Id, old, proto.Clone(c).(*pb.Class)); err != nil {
+			return err
+		}
+		t := pb.ClassEvent_UPDATED
+		if created {
+			t = pb.ClassEvent_CREATED
+		}
+		event = newClassEvent(t, tenant, proto.Clone(c).(*pb.Class))
+		txn.record(event)
+		return nil
+	})
+	if err == errValidateOnly {
+		return created, nil
+	}
+	if err != nil {
+		return false, storageError(err)
+	}
+	s.forgetRead(tenant, c.Id)
+	s.emit(event)
+	return created, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// importRoster sends roster to s's ImportRoster in small chunks.
+func importRoster(t *testing.T, s *server, roster string, dryRun bool) (*pb.ImportRosterResponse, error) {
+	t.Helper()
+	stream, err := pb.NewAdapterClient(servePrimary(t, s)).ImportRoster(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(roster) > 0 {
+		n := 7
+		if n > len(roster) {
+			n = len(roster)
+		}
+		if err := stream.Send(&pb.RosterChunk{Data: []byte(roster[:n]), DryRun: dryRun}); err != nil {
+			t.Fatal(err)
+		}
+		roster = roster[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestImportRoster(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra"})
+		roster := strings.Join([]string{
+			"ID,Name,Semester,Capacity,Labels,Prerequisite_Ids",
+			"MATH101,Algebra I,2024-FALL,30,,",
+			`MATH201,"Calculus, Part 1",2024-FALL,25,room=B2; dept=math,MATH101`,
+			"ART1,Drawing,2025-SPRING,many,,",
+			"BIO1,Biology",
+			"CHEM1,Chemistry,2024-FALL,-1,,",
+			"PHYS1,Physics,2024-FALL,,,NOPE1",
+		}, "\n")
+
+		resp, err := importRoster(t, s, roster, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.DryRun || resp.Created != 1 || resp.Updated != 1 || resp.Failed != 4 {
+			t.Errorf("dry run got %v, want 1 created, 1 updated and 4 failed", resp)
+		}
+		if c, _ := s.Get(context.Background(), &pb.GetRequest{Id: "MATH201"}); c.GetName() != "" {
+			t.Errorf("dry run stored %v", c)
+		}
+
+		resp, err = importRoster(t, s, roster, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.DryRun || resp.Created != 1 || resp.Updated != 1 || resp.Failed != 4 {
+			t.Errorf("import got %v, want 1 created, 1 updated and 4 failed", resp)
+		}
+		var rows []int32
+		var errIds []string
+		for _, e := range resp.Errors {
+			rows = append(rows, e.Row)
+			errIds = append(errIds, e.Id)
+		}
+		if len(rows) != 4 || rows[0] != 4 || rows[3] != 7 || !equalIds(errIds, []string{"ART1", "BIO1", "CHEM1", "PHYS1"}) {
+			t.Errorf("row errors are %v", resp.Errors)
+		}
+		if !strings.Contains(resp.Errors[0].Message, "capacity") {
+			t.Errorf("row 4's error is %q, want one about its capacity", resp.Errors[0].Message)
+		}
+
+		c, err := s.Get(context.Background(), &pb.GetRequest{Id: "MATH201"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Name != "Calculus, Part 1" || c.Capacity != 25 || c.Labels["room"] != "B2" || c.Labels["dept"] != "math" || !equalIds(c.PrerequisiteIds, []string{"MATH101"}) {
+			t.Errorf("imported class is %v", c)
+		}
+		if c, _ := s.Get(context.Background(), &pb.GetRequest{Id: "MATH101"}); c.GetName() != "Algebra I" {
+			t.Errorf("replaced class is %v, want it renamed", c)
+		}
+	})
+}
+
+func TestImportRosterHeader(t *testing.T) {
+	s := &server{db: newTestDB(t, driverBadger, t.TempDir()), events: newEventBus()}
+	for _, roster := range []string{
+		"",
+		"id,semester\nART1,fall",
+		"id,name,room\nART1,Drawing,B2",
+		"id,name,name\nART1,Drawing,Art",
+		"id,name\n\"ART1,Drawing",
+	} {
+		if _, err := importRoster(t, s, roster, false); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("import of %q got %v, want InvalidArgument", roster, err)
+		}
+	}
+}
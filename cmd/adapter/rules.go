@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc"
+)
+
+// requestRules check the fields of each RPC's request message, keyed by
+// full method name. The validation interceptors run them before any
+// handler, so every service, local or proxied, rejects the same malformed
+// requests with the same BadRequest details, and handlers only check what
+// depends on stored data or server settings. Methods missing here take no
+// request fields, or validate a stream's messages as they read them.
+var requestRules = map[string]func(req interface{}, v *violations){
+	"/class.Adapter/List": func(req interface{}, v *violations) {
+		v.checkListRequest(req.(*pb.ListRequest))
+	},
+	"/class.Adapter/Get": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.GetRequest).Id)
+	},
+	"/class.Adapter/Exists": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.GetRequest).Id)
+	},
+	"/class.Adapter/GetByExternalId": func(req interface{}, v *violations) {
+		in := req.(*pb.GetByExternalIdRequest)
+		v.checkExternalId("id", in.System, in.Id)
+	},
+	"/class.Adapter/Create": func(req interface{}, v *violations) {
+		v.checkClass(req.(*pb.Class))
+	},
+	"/class.Adapter/Update": func(req interface{}, v *violations) {
+		v.checkUpdate(req.(*pb.Class))
+	},
+	"/class.Adapter/Delete": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.Class).Id)
+	},
+	"/class.Adapter/ListBySemester": func(req interface{}, v *violations) {
+		v.checkRequiredSemester(req.(*pb.ListBySemesterRequest).Semester)
+	},
+	"/class.Adapter/AcquireEditLease": func(req interface{}, v *violations) {
+		v.checkAcquireEditLease(req.(*pb.AcquireEditLeaseRequest))
+	},
+	"/class.Adapter/ReleaseEditLease": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.ReleaseEditLeaseRequest).Id)
+	},
+	"/class.Adapter/TransitionState": func(req interface{}, v *violations) {
+		in := req.(*pb.TransitionStateRequest)
+		v.checkId(in.Id)
+		v.checkState("state", in.State)
+	},
+	"/class.Adapter/Watch": func(req interface{}, v *violations) {
+		in := req.(*pb.WatchRequest)
+		if in.Id != "" {
+			v.checkId(in.Id)
+		}
+		v.checkSemester(in.Semester)
+	},
+	"/class.Adapter/SaveQuery": func(req interface{}, v *violations) {
+		in := req.(*pb.SavedQuery)
+		v.checkQueryName(in.Name)
+		v.checkQuery("query", in.Query)
+	},
+	"/class.Adapter/DeleteSavedQuery": func(req interface{}, v *violations) {
+		v.checkQueryName(req.(*pb.SavedQueryRequest).Name)
+	},
+	"/class.Adapter/RunSavedQuery": func(req interface{}, v *violations) {
+		v.checkQueryName(req.(*pb.SavedQueryRequest).Name)
+	},
+	"/class.Adapter/Count": func(req interface{}, v *violations) {
+		v.checkSemester(req.(*pb.CountRequest).Semester)
+	},
+	"/class.Adapter/GetAggregateStats": func(req interface{}, v *violations) {
+		for _, g := range req.(*pb.AggregateStatsRequest).GroupBy {
+			if g != "semester" && g != "department" {
+				v.add("group_by", "unknown dimension %q, must be semester or department", g)
+			}
+		}
+	},
+	"/class.Adapter/GetAuditLog": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.AuditLogRequest).Id)
+	},
+	"/class.Adapter/GetSemester": func(req interface{}, v *violations) {
+		in := req.(*pb.GetSemesterRequest)
+		if in.Semester != "" {
+			v.checkSemester(in.Semester)
+		}
+		if in.Time != nil {
+			if err := in.Time.CheckValid(); err != nil {
+				v.add("time", "%s", err)
+			}
+		}
+	},
+	"/class.Adapter/GetSemesterStats": func(req interface{}, v *violations) {
+		v.checkRequiredSemester(req.(*pb.GetSemesterStatsRequest).Semester)
+	},
+	"/class.Adapter/AdminOffboardTenant": func(req interface{}, v *violations) {
+		v.checkOffboardTenant(req.(*pb.OffboardTenantRequest))
+	},
+	"/class.Adapter/CreateClassBundle": func(req interface{}, v *violations) {
+		v.checkBundle(req.(*pb.ClassBundle))
+	},
+	"/class.Adapter/GetClassBundle": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.GetRequest).Id)
+	},
+	"/class.Adapter/AdminRunGC": func(req interface{}, v *violations) {
+		if r := req.(*pb.RunGCRequest).DiscardRatio; r != 0 && (r <= 0 || r >= 1) {
+			v.add("discard_ratio", "must be between 0 and 1 exclusive")
+		}
+	},
+	"/class.Adapter/ArchiveSemester": func(req interface{}, v *violations) {
+		v.checkRequiredSemester(req.(*pb.ArchiveSemesterRequest).Semester)
+	},
+	"/class.Adapter/ListArchived": func(req interface{}, v *violations) {
+		v.checkRequiredSemester(req.(*pb.ListArchivedRequest).Semester)
+	},
+	"/class.Adapter/Enroll": func(req interface{}, v *violations) {
+		v.checkEnrollment(req.(*pb.EnrollmentRequest))
+	},
+	"/class.Adapter/Unenroll": func(req interface{}, v *violations) {
+		v.checkEnrollment(req.(*pb.EnrollmentRequest))
+	},
+	"/class.Adapter/ListEnrollments": func(req interface{}, v *violations) {
+		v.checkIdAs("class_id", req.(*pb.ListEnrollmentsRequest).ClassId)
+	},
+	"/class.Adapter/GetPrerequisiteTree": func(req interface{}, v *violations) {
+		in := req.(*pb.PrerequisiteTreeRequest)
+		v.checkId(in.Id)
+		if in.MaxDepth < 0 {
+			v.add("max_depth", "must not be negative")
+		}
+	},
+	"/class.Adapter/BatchDelete": func(req interface{}, v *violations) {
+		v.checkDeleteFilter(req.(*pb.DeleteFilter))
+	},
+	"/class.Adapter/Clone": func(req interface{}, v *violations) {
+		v.checkClone(req.(*pb.CloneRequest))
+	},
+	"/class.Adapter/Transact": func(req interface{}, v *violations) {
+		v.checkTransact(req.(*pb.TransactRequest))
+	},
+	"/class.Adapter/ReplayChanges": func(req interface{}, v *violations) {
+		if req.(*pb.ReplayChangesRequest).SinceSequence < 0 {
+			v.add("since_sequence", "must not be negative")
+		}
+	},
+
+	"/class.Instructors/Create": func(req interface{}, v *violations) {
+		v.checkInstructor(req.(*pb.Instructor))
+	},
+	"/class.Instructors/Get": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.InstructorRequest).Id)
+	},
+	"/class.Instructors/Update": func(req interface{}, v *violations) {
+		v.checkInstructor(req.(*pb.Instructor))
+	},
+	"/class.Instructors/Delete": func(req interface{}, v *violations) {
+		v.checkId(req.(*pb.InstructorRequest).Id)
+	},
+
+	"/class.KeyValueStore/Put": func(req interface{}, v *violations) {
+		in := req.(*pb.KeyValue)
+		v.checkNamespace(in.Namespace)
+		v.checkKVKey(in.Key)
+	},
+	"/class.KeyValueStore/Get": func(req interface{}, v *violations) {
+		in := req.(*pb.KeyRequest)
+		v.checkNamespace(in.Namespace)
+		v.checkKVKey(in.Key)
+	},
+	"/class.KeyValueStore/Delete": func(req interface{}, v *violations) {
+		in := req.(*pb.KeyRequest)
+		v.checkNamespace(in.Namespace)
+		v.checkKVKey(in.Key)
+	},
+	"/class.KeyValueStore/List": func(req interface{}, v *violations) {
+		in := req.(*pb.ListKeysRequest)
+		v.checkNamespace(in.Namespace)
+		if in.PageSize < 0 {
+			v.add("page_size", "must not be negative")
+		}
+		if in.PageToken != "" {
+			if _, err := decodePageToken(in.PageToken); err != nil {
+				v.add("page_token", "%s", err)
+			}
+		}
+	},
+
+	"/adapter.v2.Classes/ListClasses": func(req interface{}, v *violations) {
+		in := req.(*adapterv2.ListClassesRequest)
+		if _, ok := v2OrderBy(in.OrderBy); !ok {
+			v.add("order_by", "must be one of id, display_name or semester, optionally followed by asc or desc")
+		}
+		if _, err := parseLabelSelector(in.LabelSelector); err != nil {
+			v.add("label_selector", "%s", err)
+		}
+	},
+	"/adapter.v2.Classes/GetClass": func(req interface{}, v *violations) {
+		if id := v.resourceId("name", classResourcePrefix, req.(*adapterv2.GetClassRequest).Name); id != "" {
+			v.checkId(id)
+		}
+	},
+	"/adapter.v2.Classes/CreateClass": func(req interface{}, v *violations) {
+		if c := createFromV2(v, req.(*adapterv2.CreateClassRequest)); len(*v) == 0 {
+			v.checkClass(c)
+		}
+	},
+	"/adapter.v2.Classes/UpdateClass": func(req interface{}, v *violations) {
+		if c := updateFromV2(v, req.(*adapterv2.UpdateClassRequest)); len(*v) == 0 {
+			v.checkUpdate(c)
+		}
+	},
+	"/adapter.v2.Classes/DeleteClass": func(req interface{}, v *violations) {
+		if id := v.resourceId("name", classResourcePrefix, req.(*adapterv2.DeleteClassRequest).Name); id != "" {
+			v.checkId(id)
+		}
+	},
+}
+
+// validateRequest checks req, the request of method, against its rules,
+// returning InvalidArgument with BadRequest details if it breaks any.
+func validateRequest(method string, req interface{}) error {
+	rule, ok := requestRules[method]
+	if !ok {
+		return nil
+	}
+	var v violations
+	rule(req, &v)
+	return v.err()
+}
+
+func validationUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := validateRequest(info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func validationStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &validatingStream{ServerStream: ss, method: info.FullMethod})
+}
+
+// validatingStream checks each message a server stream receives against the
+// rules of its method.
+type validatingStream struct {
+	grpc.ServerStream
+	method string
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateRequest(s.method, m)
+}
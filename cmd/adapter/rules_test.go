@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func TestRequestRules(t *testing.T) {
+	// A rule for a misspelled or removed method would never run.
+	for method := range requestRules {
+		name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(method, "/"), "/", ".", 1))
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+		if err != nil {
+			t.Errorf("rule for %s: %v", method, err)
+			continue
+		}
+		if _, ok := d.(protoreflect.MethodDescriptor); !ok {
+			t.Errorf("rule for %s doesn't name a method", method)
+		}
+	}
+
+	for _, tc := range []struct {
+		method string
+		req    interface{}
+	}{
+		{"/class.Adapter/Get", &pb.GetRequest{}},
+		{"/class.Instructors/Delete", &pb.InstructorRequest{}},
+		{"/class.KeyValueStore/List", &pb.ListKeysRequest{Namespace: "ns", PageToken: "!!!"}},
+		{"/adapter.v2.Classes/GetClass", &adapterv2.GetClassRequest{Name: "MATH101"}},
+	} {
+		if err := validateRequest(tc.method, tc.req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s of %v got %v, want InvalidArgument", tc.method, tc.req, err)
+		}
+	}
+	if err := validateRequest("/class.Adapter/Get", &pb.GetRequest{Id: "MATH101"}); err != nil {
+		t.Errorf("a valid Get got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// classSchema describes pb.Class using the same limits validateClass and
+// validateUpdate enforce.
+var classSchema = &pb.Schema{
+	Message: "class.Class",
+	Fields: []*pb.FieldSchema{
+		{
+			Name:        "id",
+			Type:        pb.FieldSchema_STRING,
+			Description: `Unique class identifier, e.g. MATH101-01.`,
+			Required:    true,
+			MaxLength:   maxIdLength,
+		},
+		{
+			Name:        "name",
+			Type:        pb.FieldSchema_STRING,
+			Description: "Display name of the class.",
+			MaxLength:   maxNameLength,
+			Updatable:   true,
+		},
+		{
+			Name:        "semester",
+			Type:        pb.FieldSchema_STRING,
+			Description: "Semester the class is taught in, e.g. 2024-FALL.",
+			MaxLength:   maxSemesterLength,
+			Pattern:     semesterPattern.String(),
+			Updatable:   true,
+		},
+		{
+			Name:        "instructor_id",
+			Type:        pb.FieldSchema_STRING,
+			Description: "Identifier of the instructor teaching the class.",
+			MaxLength:   maxIdLength,
+			Pattern:     `^[^.]*$`,
+			Updatable:   true,
+		},
+		{
+			Name:        "instructor_name",
+			Type:        pb.FieldSchema_STRING,
+			Description: "Display name of the instructor.",
+			MaxLength:   maxNameLength,
+			Updatable:   true,
+		},
+		{
+			Name:        "capacity",
+			Type:        pb.FieldSchema_INT32,
+			Description: "Maximum number of enrolled students; zero for no limit.",
+			Updatable:   true,
+		},
+		{
+			Name:        "description",
+			Type:        pb.FieldSchema_STRING,
+			Description: "Free-text description of the class.",
+			MaxLength:   maxDescriptionLength,
+			Updatable:   true,
+		},
+		{
+			Name:        "meetings",
+			Type:        pb.FieldSchema_MESSAGE,
+			Description: fmt.Sprintf("Weekly meeting schedule, at most %d meetings.", maxMeetings),
+			Updatable:   true,
+			Repeated:    true,
+			MessageType: "class.Meeting",
+		},
+		{
+			Name:        "labels",
+			Type:        pb.FieldSchema_MAP,
+			Description: fmt.Sprintf("Key/value labels for filtering with a label selector, at most %d.", maxLabels),
+			MaxLength:   63,
+			Pattern:     labelPattern.String(),
+			Updatable:   true,
+		},
+		{
+			Name:        "prerequisite_ids",
+			Type:        pb.FieldSchema_STRING,
+			Description: fmt.Sprintf("Ids of existing classes to take first, at most %d.", maxPrerequisites),
+			MaxLength:   maxIdLength,
+			Updatable:   true,
+			Repeated:    true,
+		},
+		{
+			Name:        "external_ids",
+			Type:        pb.FieldSchema_MAP,
+			Description: fmt.Sprintf("Ids of the class in external systems such as an SIS or LMS, keyed by system name, at most %d. Each names at most one class.", maxExternalIds),
+			MaxLength:   maxExternalIdLength,
+			Pattern:     labelPattern.String(),
+			Updatable:   true,
+		},
+		{
+			Name:        "expire_time",
+			Type:        pb.FieldSchema_TIMESTAMP,
+			Description: "When the class expires and is removed, if ever. Must be in the future when written.",
+			Updatable:   true,
+		},
+		{
+			Name:        "state",
+			Type:        pb.FieldSchema_ENUM,
+			Description: "Lifecycle state: DRAFT classes are hidden from students; only PUBLISHED classes take enrollments. Set on create, then changed with TransitionState.",
+			EnumValues:  []string{"DRAFT", "PUBLISHED", "CLOSED"},
+		},
+		{
+			Name:        "etag",
+			Type:        pb.FieldSchema_STRING,
+			Description: "Changes whenever the class does; pass it to Get as if_none_match to skip an unchanged class.",
+			OutputOnly:  true,
+		},
+		{
+			Name:        "create_time",
+			Type:        pb.FieldSchema_TIMESTAMP,
+			Description: "When the class was first stored.",
+			OutputOnly:  true,
+		},
+		{
+			Name:        "update_time",
+			Type:        pb.FieldSchema_TIMESTAMP,
+			Description: "When the class was last changed.",
+			OutputOnly:  true,
+		},
+	},
+}
+
+func (s *server) DescribeSchema(ctx context.Context, in *pb.Empty) (*pb.Schema, error) {
+	logf(ctx, "DescribeSchema called")
+	// Tenants can't define custom fields yet, so only the built-in fields are
+	// described.
+	return proto.Clone(classSchema).(*pb.Schema), nil
+}
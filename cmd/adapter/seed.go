@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// loadSeedFile reads the classes of a -seed-file: a JSON array of classes,
+// or one class per line as -snapshot-dir exports them, in the JSON mapping
+// of Class. Every class is validated and Ids must be unique.
+func loadSeedFile(path string) ([]*pb.Class, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if b = bytes.TrimSpace(b); bytes.HasPrefix(b, []byte("[")) {
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, line := range bytes.Split(b, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				raw = append(raw, line)
+			}
+		}
+	}
+	classes := make([]*pb.Class, 0, len(raw))
+	seen := make(map[string]bool)
+	for i, m := range raw {
+		c := &pb.Class{}
+		if err := protojson.Unmarshal(m, c); err != nil {
+			return nil, fmt.Errorf("class %d: %w", i, err)
+		}
+		if err := validateClass(c); err != nil {
+			return nil, fmt.Errorf("class %d: %w", i, err)
+		}
+		if seen[c.Id] {
+			return nil, fmt.Errorf("class %d: Id %s appears twice", i, c.Id)
+		}
+		seen[c.Id] = true
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// isEmptyDB reports whether db holds no keys at all, as on its first start
+// before the key schema is recorded.
+func isEmptyDB(db kvDB) (bool, error) {
+	empty := true
+	err := db.View(func(txn kvTxn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	return empty, err
+}
+
+// seed stores classes in tenant in one transaction, so a failed start
+// leaves nothing half-seeded. Prerequisites may name classes later in the
+// file; references are checked once every class is in place. Each class
+// is audited and published as a create.
+func (s *server) seed(ctx context.Context, tenant string, classes []*pb.Class) error {
+	var events []*pb.ClassEvent
+	err := s.update(ctx, tenant, func(txn *tenantTxn) error {
+		events = nil
+		for _, c := range classes {
+			if err := putClass(txn, c); err != nil {
+				return err
+			}
+		}
+		for _, c := range classes {
+			if err := checkReferences(txn, c); err != nil {
+				return fmt.Errorf("class %s: %w", c.Id, err)
+			}
+			if err := s.audit.record(ctx, txn, "Seed", c.Id, nil, proto.Clone(c).(*pb.Class)); err != nil {
+				return err
+			}
+			e := newClassEvent(pb.ClassEvent_CREATED, tenant, proto.Clone(c).(*pb.Class))
+			txn.record(e)
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		s.forgetRead(tenant, e.Class.Id)
+		s.emit(e)
+	}
+	log.Printf("Seeded %d classes into tenant %s", len(classes), tenant)
+	return nil
+}
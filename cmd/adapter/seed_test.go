@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func writeSeedFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "classes.json")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSeedFile(t *testing.T) {
+	for _, contents := range []string{
+		`[{"id": "MATH201", "name": "Calculus", "prerequisiteIds": ["MATH101"]}, {"id": "MATH101", "name": "Algebra"}]`,
+		"{\"id\": \"MATH201\", \"name\": \"Calculus\", \"prerequisiteIds\": [\"MATH101\"]}\n\n{\"id\": \"MATH101\", \"name\": \"Algebra\"}\n",
+	} {
+		classes, err := loadSeedFile(writeSeedFile(t, contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(classes) != 2 || classes[0].Id != "MATH201" || classes[1].Name != "Algebra" {
+			t.Errorf("loadSeedFile(%q) = %v", contents, classes)
+		}
+	}
+	for _, contents := range []string{
+		`[{"id": "MATH101"}, {"id": "MATH101"}]`,
+		`[{"name": "Algebra"}]`,
+		`[{"id": "MATH101", "colour": "red"}]`,
+		`[{"id": "MATH101"}`,
+	} {
+		if _, err := loadSeedFile(writeSeedFile(t, contents)); err == nil {
+			t.Errorf("loadSeedFile(%q) succeeded", contents)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		if empty, err := isEmptyDB(db); err != nil || !empty {
+			t.Fatalf("isEmptyDB of a new database = %v, %v", empty, err)
+		}
+		s := &server{db: db, events: newEventBus()}
+		sub := s.events.subscribe(nil)
+		defer s.events.unsubscribe(sub)
+		ctx := context.Background()
+
+		classes, err := loadSeedFile(writeSeedFile(t, `[{"id": "MATH201", "name": "Calculus", "prerequisiteIds": ["MATH101"]}, {"id": "MATH101", "name": "Algebra"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.seed(ctx, defaultTenant, classes); err != nil {
+			t.Fatal(err)
+		}
+		if c, _ := s.Get(ctx, &pb.GetRequest{Id: "MATH201"}); c.Name != "Calculus" || c.CreateTime == nil {
+			t.Errorf("seeded class is %v", c)
+		}
+		if len(sub.events) != 2 {
+			t.Errorf("seeding published %d events, want 2", len(sub.events))
+		}
+		if empty, err := isEmptyDB(db); err != nil || empty {
+			t.Errorf("isEmptyDB after seeding = %v, %v", empty, err)
+		}
+
+		// A dangling prerequisite fails the whole seed.
+		db = newDB()
+		s = &server{db: db, events: newEventBus()}
+		classes, err = loadSeedFile(writeSeedFile(t, `[{"id": "ART1", "name": "Drawing"}, {"id": "ART2", "name": "Painting", "prerequisiteIds": ["ART0"]}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.seed(ctx, defaultTenant, classes); err == nil {
+			t.Fatal("seeding a dangling prerequisite succeeded")
+		}
+		if empty, err := isEmptyDB(db); err != nil || !empty {
+			t.Errorf("failed seed left the database empty = %v, %v", empty, err)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Each semester's counts are stored at idx/stats/semester/<semester> and
+// kept up to date by every write that adds, moves or removes a class or an
+// enrollment, so GetSemesterStats reads one key instead of scanning. Since
+// every such write reads and writes its semester's counts, concurrent
+// writes to one semester conflict and are retried. Classes without a
+// semester aren't counted.
+const semesterStatsPrefix = indexPrefix + "stats/semester/"
+
+func semesterStatsKey(semester string) []byte {
+	return []byte(semesterStatsPrefix + semester)
+}
+
+// getSemesterStats returns the stored counts of a semester, zero if it has
+// none.
+func getSemesterStats(txn *tenantTxn, semester string) (*pb.SemesterStats, error) {
+	st := &pb.SemesterStats{Semester: semester}
+	item, err := txn.Get(semesterStatsKey(semester))
+	if err == badger.ErrKeyNotFound {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = item.Value(func(v []byte) error {
+		return proto.Unmarshal(v, st)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stats of semester %s: %w", semester, err)
+	}
+	return st, nil
+}
+
+// putSemesterStats stores the counts of a semester, deleting them once
+// they reach zero.
+func putSemesterStats(txn *tenantTxn, st *pb.SemesterStats) error {
+	if st.ClassCount <= 0 && st.EnrollmentCount <= 0 {
+		return txn.Delete(semesterStatsKey(st.Semester))
+	}
+	v, err := proto.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return txn.Set(semesterStatsKey(st.Semester), v)
+}
+
+// addSemesterStats adds to the counts of a semester and marks it changed
+// now.
+func addSemesterStats(txn *tenantTxn, semester string, classes, enrollments int64) error {
+	if semester == "" {
+		return nil
+	}
+	st, err := getSemesterStats(txn, semester)
+	if err != nil {
+		return err
+	}
+	st.ClassCount += classes
+	st.EnrollmentCount += enrollments
+	// Counts left behind by classes that expired can't go below zero.
+	if st.ClassCount < 0 {
+		st.ClassCount = 0
+	}
+	if st.EnrollmentCount < 0 {
+		st.EnrollmentCount = 0
+	}
+	st.UpdateTime = timestamppb.Now()
+	return putSemesterStats(txn, st)
+}
+
+// restatClass counts the class with the given Id, about to be stored in
+// semester, moving it and its enrollments from the semester it is stored
+// in, if that differs.
+func restatClass(txn *tenantTxn, id, semester string) error {
+	old, err := getField(txn, id, "Semester")
+	if err == badger.ErrKeyNotFound {
+		n, err := countEnrollments(txn, id)
+		if err != nil {
+			return err
+		}
+		return addSemesterStats(txn, semester, 1, n)
+	}
+	if err != nil {
+		return err
+	}
+	if old == semester {
+		return addSemesterStats(txn, semester, 0, 0)
+	}
+	n, err := countEnrollments(txn, id)
+	if err != nil {
+		return err
+	}
+	if err := addSemesterStats(txn, old, -1, -n); err != nil {
+		return err
+	}
+	return addSemesterStats(txn, semester, 1, n)
+}
+
+// unstatClass stops counting the class with the given Id and its
+// enrollments, before it is deleted.
+func unstatClass(txn *tenantTxn, id string) error {
+	semester, err := getField(txn, id, "Semester")
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	n, err := countEnrollments(txn, id)
+	if err != nil {
+		return err
+	}
+	return addSemesterStats(txn, semester, -1, -n)
+}
+
+// countSemesterStats counts every semester of a tenant from the semester
+// index, for the migration that first stores the counts and for fsck. A
+// semester changed when its latest class did.
+func countSemesterStats(txn *tenantTxn) (map[string]*pb.SemesterStats, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte(semesterIndexPrefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	stats := make(map[string]*pb.SemesterStats)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return nil, err
+		}
+		k := string(it.Key()[len(opts.Prefix):])
+		i := strings.Index(k, "/")
+		if i < 0 {
+			continue
+		}
+		semester, id := k[:i], k[i+1:]
+		exists, err := classExists(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		n, err := countEnrollments(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		st := stats[semester]
+		if st == nil {
+			st = &pb.SemesterStats{Semester: semester}
+			stats[semester] = st
+		}
+		st.ClassCount++
+		st.EnrollmentCount += n
+		if v, err := getField(txn, id, "UpdateTime"); err == nil {
+			if t, err := parseTime(v); err == nil && (st.UpdateTime == nil || t.AsTime().After(st.UpdateTime.AsTime())) {
+				st.UpdateTime = t
+			}
+		}
+	}
+	return stats, nil
+}
+
+// migrateTenantToV2 stores the counts of every semester of a tenant,
+// returning how many semesters it counted.
+func migrateTenantToV2(db kvDB, tenant string) (int, error) {
+	var stats map[string]*pb.SemesterStats
+	err := db.View(func(txn kvTxn) error {
+		var err error
+		stats, err = countSemesterStats(newTenantTxn(txn, tenant))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = db.Update(func(txn kvTxn) error {
+		t := newTenantTxn(txn, tenant)
+		for _, st := range stats {
+			if err := putSemesterStats(t, st); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(stats), nil
+}
+
+func (s *server) GetSemesterStats(ctx context.Context, in *pb.GetSemesterStatsRequest) (*pb.SemesterStats, error) {
+	logf(ctx, "GetSemesterStats called for semester %s", in.Semester)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var st *pb.SemesterStats
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		st, err = getSemesterStats(txn, in.Semester)
+		return err
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return st, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestSemesterStats(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		want := func(semester string, classes, enrollments int64) {
+			t.Helper()
+			st, err := s.GetSemesterStats(ctx, &pb.GetSemesterStatsRequest{Semester: semester})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Semester != semester || st.ClassCount != classes || st.EnrollmentCount != enrollments {
+				t.Errorf("GetSemesterStats(%s) returned %v, want %d classes and %d enrollments", semester, st, classes, enrollments)
+			}
+			if (classes > 0) != (st.UpdateTime != nil) {
+				t.Errorf("GetSemesterStats(%s) has update time %v with %d classes", semester, st.UpdateTime, classes)
+			}
+		}
+
+		want("2024-FALL", 0, 0)
+		for _, c := range []*pb.Class{
+			{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"},
+			{Id: "CHEM101", Name: "Chemistry", Semester: "2024-FALL"},
+			{Id: "ART100", Name: "Drawing"},
+		} {
+			if _, err := s.Create(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, student := range []string{"s1", "s2"} {
+			if _, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: student}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want("2024-FALL", 2, 2)
+
+		before, err := s.GetSemesterStats(ctx, &pb.GetSemesterStatsRequest{Semester: "2024-FALL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Unenroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: "s2"}); err != nil {
+			t.Fatal(err)
+		}
+		after, err := s.GetSemesterStats(ctx, &pb.GetSemesterStatsRequest{Semester: "2024-FALL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.EnrollmentCount != 1 || after.UpdateTime.AsTime().Before(before.UpdateTime.AsTime()) {
+			t.Errorf("after Unenroll the stats are %v, were %v", after, before)
+		}
+
+		// Moving a class moves its enrollments with it.
+		_, err = s.Update(ctx, &pb.Class{Id: "MATH101", Semester: "2025-SPRING", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"semester"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want("2024-FALL", 1, 0)
+		want("2025-SPRING", 1, 1)
+
+		if _, err := s.Clone(ctx, &pb.CloneRequest{SourceId: "MATH101", NewId: "MATH102", CopyEnrollments: true}); err != nil {
+			t.Fatal(err)
+		}
+		want("2025-SPRING", 2, 2)
+
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+		want("2025-SPRING", 1, 1)
+		if _, err := s.BatchDelete(ctx, &pb.DeleteFilter{Semester: "2025-SPRING"}); err != nil {
+			t.Fatal(err)
+		}
+		want("2025-SPRING", 0, 0)
+		want("2024-FALL", 1, 0)
+
+		if err := validateRequest("/class.Adapter/GetSemesterStats", &pb.GetSemesterStatsRequest{Semester: "fall"}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GetSemesterStats of a malformed semester returned %v, want InvalidArgument", err)
+		}
+	})
+}
+
+func TestFsckRecountsSemesters(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		ctx := context.Background()
+		for _, c := range []*pb.Class{
+			{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"},
+			{Id: "CHEM101", Name: "Chemistry", Semester: "2025-SPRING"},
+		} {
+			if _, err := s.Create(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Counts off, missing, and left over from a semester with no classes
+		// left, as classes that expire leave them.
+		err := s.update(ctx, defaultTenant, func(txn *tenantTxn) error {
+			if err := putSemesterStats(txn, &pb.SemesterStats{Semester: "2024-FALL", ClassCount: 3, EnrollmentCount: 4}); err != nil {
+				return err
+			}
+			if err := putSemesterStats(txn, &pb.SemesterStats{Semester: "2023-FALL", ClassCount: 1}); err != nil {
+				return err
+			}
+			return txn.Delete(semesterStatsKey("2025-SPRING"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found, left, err := s.fsck(ctx, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != 3 || left != 0 {
+			t.Fatalf("fsck -repair found %d problems with %d left, want 3 and 0", found, left)
+		}
+		if found, _, err := s.fsck(ctx, false); err != nil || found != 0 {
+			t.Fatalf("fsck after repair found %d problems (%v), want none", found, err)
+		}
+		for semester, classes := range map[string]int64{"2024-FALL": 1, "2025-SPRING": 1, "2023-FALL": 0} {
+			st, err := s.GetSemesterStats(ctx, &pb.GetSemesterStatsRequest{Semester: semester})
+			if err != nil || st.ClassCount != classes || st.EnrollmentCount != 0 {
+				t.Errorf("after repair GetSemesterStats(%s) returned %v, %v, want %d classes", semester, st, err, classes)
+			}
+		}
+	})
+}
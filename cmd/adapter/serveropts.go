@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// serverFlags tune the gRPC server. Their defaults match grpc-go's.
+type serverFlags struct {
+	maxRecvMsgSize        int
+	maxSendMsgSize        int
+	maxConcurrentStreams  uint
+	keepaliveTime         time.Duration
+	keepaliveTimeout      time.Duration
+	keepaliveMinTime      time.Duration
+	keepaliveNoStream     bool
+	maxConnectionIdle     time.Duration
+	maxConnectionAge      time.Duration
+	maxConnectionAgeGrace time.Duration
+}
+
+func registerServerFlags(fs *flag.FlagSet) *serverFlags {
+	f := &serverFlags{}
+	fs.IntVar(&f.maxRecvMsgSize, "max-recv-msg-size", 4<<20, "largest request message in bytes the server accepts")
+	fs.IntVar(&f.maxSendMsgSize, "max-send-msg-size", math.MaxInt32, "largest response message in bytes the server sends")
+	fs.UintVar(&f.maxConcurrentStreams, "max-concurrent-streams", 0, "maximum concurrent streams per client connection (0 is unlimited)")
+	fs.DurationVar(&f.keepaliveTime, "keepalive-time", 2*time.Hour, "how long a connection is idle before the server pings the client")
+	fs.DurationVar(&f.keepaliveTimeout, "keepalive-timeout", 20*time.Second, "how long the server waits for a ping ack before closing the connection")
+	fs.DurationVar(&f.keepaliveMinTime, "keepalive-min-time", 5*time.Minute, "minimum interval between client pings; clients pinging more often are disconnected")
+	fs.BoolVar(&f.keepaliveNoStream, "keepalive-permit-without-stream", false, "allow client pings on connections with no active streams")
+	fs.DurationVar(&f.maxConnectionIdle, "max-connection-idle", 0, "close connections idle for this long (0 is unlimited)")
+	fs.DurationVar(&f.maxConnectionAge, "max-connection-age", 0, "close connections after this long, so clients rebalance (0 is unlimited)")
+	fs.DurationVar(&f.maxConnectionAgeGrace, "max-connection-age-grace", 0, "time given to in-flight calls on a connection closed for age (0 is unlimited)")
+	return f
+}
+
+func (f *serverFlags) options() []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(f.maxRecvMsgSize),
+		grpc.MaxSendMsgSize(f.maxSendMsgSize),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  f.keepaliveTime,
+			Timeout:               f.keepaliveTimeout,
+			MaxConnectionIdle:     f.maxConnectionIdle,
+			MaxConnectionAge:      f.maxConnectionAge,
+			MaxConnectionAgeGrace: f.maxConnectionAgeGrace,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             f.keepaliveMinTime,
+			PermitWithoutStream: f.keepaliveNoStream,
+		}),
+	}
+	if f.maxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(f.maxConcurrentStreams)))
+	}
+	return opts
+}
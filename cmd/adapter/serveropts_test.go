@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// serveWithFlags starts an adapter with the gRPC server flags in args,
+// returning a client and how many connections it has dialed.
+func serveWithFlags(t *testing.T, args ...string) (pb.AdapterClient, *int32) {
+	t.Helper()
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	f := registerServerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	srv := newE2EServer(t, newTestDB(t, driverBadger, t.TempDir()))
+	putTestClasses(t, srv.db, &pb.Class{Id: "LONG101", Name: "Long", Description: strings.Repeat("x", 3000)})
+	gs, _ := newGRPCServer(localServices(srv, 1000, 64<<10), f.options(), nil, nil)
+	lis := bufconn.Listen(1 << 20)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	var dials int32
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewAdapterClient(conn), &dials
+}
+
+func TestServerFlags(t *testing.T) {
+	ctx := context.Background()
+	c, _ := serveWithFlags(t, "-max-recv-msg-size", "1024", "-max-send-msg-size", "2048")
+	if _, err := c.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", Description: strings.Repeat("x", 900)}); err != nil {
+		t.Errorf("Create under -max-recv-msg-size returned %v", err)
+	}
+	if _, err := c.Create(ctx, &pb.Class{Id: "MATH102", Name: "Geometry", Description: strings.Repeat("x", 2000)}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Create over -max-recv-msg-size returned %v, want ResourceExhausted", err)
+	}
+	if _, err := c.Get(ctx, &pb.GetRequest{Id: "LONG101"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Get of a class over -max-send-msg-size returned %v, want ResourceExhausted", err)
+	}
+
+	// With one stream per connection, a call waits for a Watch to end.
+	c, _ = serveWithFlags(t, "-max-concurrent-streams", "1")
+	if _, err := c.Get(ctx, &pb.GetRequest{Id: "LONG101"}); err != nil {
+		t.Fatal(err)
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	if _, err := c.Watch(watchCtx, &pb.WatchRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	shortCtx, shortCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer shortCancel()
+	if _, err := c.Get(shortCtx, &pb.GetRequest{Id: "LONG101"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Get during a Watch with -max-concurrent-streams 1 returned %v, want DeadlineExceeded", err)
+	}
+	cancel()
+	if _, err := c.Get(ctx, &pb.GetRequest{Id: "LONG101"}); err != nil {
+		t.Errorf("Get after the Watch ended returned %v", err)
+	}
+
+	// Idle connections are closed only when -max-connection-idle is set.
+	for _, tt := range []struct {
+		args       []string
+		reconnects bool
+	}{
+		{nil, false},
+		{[]string{"-max-connection-idle", "50ms"}, true},
+	} {
+		c, dials := serveWithFlags(t, tt.args...)
+		for i := 0; i < 2; i++ {
+			if _, err := c.Get(ctx, &pb.GetRequest{Id: "LONG101"}); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(300 * time.Millisecond)
+		}
+		if n := atomic.LoadInt32(dials); n > 1 != tt.reconnects {
+			t.Errorf("with %v, the client dialed %d times, want reconnects %v", tt.args, n, tt.reconnects)
+		}
+	}
+}
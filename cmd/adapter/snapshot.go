@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// kvSnapshotter is implemented by drivers that can keep a read snapshot
+// open across requests. The file driver can't without blocking writers, so
+// its listings page over live data.
+type kvSnapshotter interface {
+	Snapshot() kvSnapshot
+}
+
+// kvSnapshot is a read-only view of the database as of ReadTs. Views may
+// run on it from several goroutines, one at a time.
+type kvSnapshot interface {
+	View(fn func(txn kvTxn) error) error
+	ReadTs() uint64
+	Discard()
+}
+
+var errSnapshotDiscarded = errors.New("snapshot discarded")
+
+// badgerSnapshot holds a Badger read transaction open. Badger transactions
+// aren't safe for concurrent use, so mu serializes views and the discard.
+type badgerSnapshot struct {
+	mu        sync.Mutex
+	txn       *badger.Txn
+	discarded bool
+}
+
+func (db badgerDB) Snapshot() kvSnapshot {
+	return &badgerSnapshot{txn: db.NewTransaction(false)}
+}
+
+func (s *badgerSnapshot) View(fn func(txn kvTxn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.discarded {
+		return errSnapshotDiscarded
+	}
+	return fn(badgerTxn{s.txn})
+}
+
+func (s *badgerSnapshot) ReadTs() uint64 {
+	return s.txn.ReadTs()
+}
+
+func (s *badgerSnapshot) Discard() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.discarded {
+		s.txn.Discard()
+		s.discarded = true
+	}
+}
+
+// Most snapshots held open at once; opening another discards the one that
+// expires first.
+const maxListSnapshots = 1000
+
+// snapshotRegistry holds the snapshots of List calls with more pages to
+// come, so every page of a listing reads the same data. A snapshot keeps
+// Badger from discarding the versions it can see, so each is dropped ttl
+// after its last page was read. A nil registry holds none.
+type snapshotRegistry struct {
+	ttl time.Duration
+
+	mu   sync.Mutex
+	held map[string]*heldSnapshot
+}
+
+type heldSnapshot struct {
+	tenant  string
+	snap    kvSnapshot
+	expires time.Time
+}
+
+func newSnapshotRegistry(ttl time.Duration) *snapshotRegistry {
+	if ttl <= 0 {
+		return nil
+	}
+	return &snapshotRegistry{ttl: ttl, held: make(map[string]*heldSnapshot)}
+}
+
+// Page tokens of snapshot listings hold a snapshotCursor, marked by a
+// leading \x01 like orderCursorMark marks ordered ones.
+const snapshotCursorMark = "\x01"
+
+type snapshotCursor struct {
+	Id     string `json:"s"`
+	ReadTs uint64 `json:"t"`
+	// The position within the listing, as an unwrapped token would hold.
+	After string `json:"a"`
+}
+
+// open starts a snapshot of db for a first page, or returns nil if db
+// can't hold one or r is nil.
+func (r *snapshotRegistry) open(db kvDB) kvSnapshot {
+	if r == nil {
+		return nil
+	}
+	ss, ok := db.(kvSnapshotter)
+	if !ok {
+		return nil
+	}
+	return ss.Snapshot()
+}
+
+// resume returns the snapshot a page token names and the position within
+// it. Positions without a snapshot come back as they are, with a nil
+// snapshot. A snapshot that has expired, belongs to another tenant or was
+// taken by another adapter is an error.
+func (r *snapshotRegistry) resume(tenant, after string) (kvSnapshot, string, error) {
+	if !strings.HasPrefix(after, snapshotCursorMark) {
+		return nil, after, nil
+	}
+	var cur snapshotCursor
+	if err := json.Unmarshal([]byte(after[1:]), &cur); err != nil {
+		return nil, "", errors.New("invalid page token")
+	}
+	if r == nil {
+		return nil, "", errors.New("page token has expired; start the listing again")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expireLocked(time.Now())
+	h, ok := r.held[cur.Id]
+	if !ok || h.tenant != tenant || h.snap.ReadTs() != cur.ReadTs {
+		return nil, "", errors.New("page token has expired; start the listing again")
+	}
+	h.expires = time.Now().Add(r.ttl)
+	return h.snap, cur.After, nil
+}
+
+// hold keeps snap open for the next page and returns the page token for
+// it, wrapping next. The snapshot is released instead when there is no
+// next page.
+func (r *snapshotRegistry) hold(tenant string, snap kvSnapshot, next string) (string, error) {
+	if snap == nil {
+		return next, nil
+	}
+	if next == "" {
+		r.release(snap)
+		return "", nil
+	}
+	after, err := decodePageToken(next)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := ""
+	for k, h := range r.held {
+		if h.snap == snap {
+			id = k
+		}
+	}
+	if id == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		id = hex.EncodeToString(b)
+		r.evictLocked()
+	}
+	r.held[id] = &heldSnapshot{tenant: tenant, snap: snap, expires: time.Now().Add(r.ttl)}
+	cur, err := json.Marshal(snapshotCursor{Id: id, ReadTs: snap.ReadTs(), After: after})
+	if err != nil {
+		return "", err
+	}
+	return encodePageToken(snapshotCursorMark + string(cur)), nil
+}
+
+// release discards snap once its listing is done.
+func (r *snapshotRegistry) release(snap kvSnapshot) {
+	r.mu.Lock()
+	for k, h := range r.held {
+		if h.snap == snap {
+			delete(r.held, k)
+		}
+	}
+	r.mu.Unlock()
+	snap.Discard()
+}
+
+func (r *snapshotRegistry) expireLocked(now time.Time) {
+	for k, h := range r.held {
+		if now.After(h.expires) {
+			delete(r.held, k)
+			h.snap.Discard()
+		}
+	}
+}
+
+// evictLocked makes room for one more snapshot.
+func (r *snapshotRegistry) evictLocked() {
+	r.expireLocked(time.Now())
+	if len(r.held) < maxListSnapshots {
+		return
+	}
+	var first string
+	for k, h := range r.held {
+		if first == "" || h.expires.Before(r.held[first].expires) {
+			first = k
+		}
+	}
+	r.held[first].snap.Discard()
+	delete(r.held, first)
+}
+
+// close discards every snapshot, before the database closes.
+func (r *snapshotRegistry) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, h := range r.held {
+		h.snap.Discard()
+		delete(r.held, k)
+	}
+}
+
+// viewSnapshot is view on a held snapshot, or on the live data when snap
+// is nil.
+func (s *server) viewSnapshot(ctx context.Context, tenant string, snap kvSnapshot, fn func(txn *tenantTxn) error) error {
+	if snap == nil {
+		return s.view(ctx, tenant, fn)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return snap.View(func(txn kvTxn) error {
+		t := newTenantTxn(txn, tenant)
+		t.ctx = ctx
+		if err := fn(t); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+}
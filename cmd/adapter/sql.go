@@ -0,0 +1,758 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+// The SQL endpoint answers read-only SELECTs over the caller's classes, for
+// analysts who would otherwise export the data to query it. It speaks a
+// small dialect rather than embedding a database engine:
+//
+//	SELECT select_list FROM classes
+//	  [WHERE condition]
+//	  [GROUP BY column]
+//	  [ORDER BY column [ASC|DESC] [, ...]]
+//	  [LIMIT n]
+//
+// The select list is *, or columns and COUNT(*). Conditions compare a
+// column with a value (=, !=, <>, <, <=, >, >=), match it with [NOT] LIKE
+// or [NOT] IN, and combine with AND, OR, NOT and parentheses. Keywords are
+// case-insensitive; strings are single-quoted with '' for a quote. Integer
+// columns are compared with numbers and the others with strings.
+
+// sqlColumns are the columns of the classes table, in the order * returns
+// them.
+var sqlColumns = []string{"id", "name", "semester", "create_time", "update_time", "instructor_id", "instructor_name", "capacity", "description"}
+
+// sqlIntColumns are the columns holding integers; the rest hold text.
+var sqlIntColumns = map[string]bool{"capacity": true}
+
+// sqlColumn returns the value of col for c: an int64 for integer columns,
+// and a string for the rest.
+func sqlColumn(c *pb.Class, col string) interface{} {
+	switch col {
+	case "id":
+		return c.Id
+	case "name":
+		return c.Name
+	case "semester":
+		return c.Semester
+	case "create_time":
+		return formatTime(c.CreateTime)
+	case "update_time":
+		return formatTime(c.UpdateTime)
+	case "instructor_id":
+		return c.InstructorId
+	case "instructor_name":
+		return c.InstructorName
+	case "capacity":
+		return int64(c.Capacity)
+	case "description":
+		return c.Description
+	}
+	return ""
+}
+
+func isSQLColumn(name string) bool {
+	for _, c := range sqlColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// countColumn is the select list entry and result column for COUNT(*).
+const countColumn = "count(*)"
+
+type sqlOrder struct {
+	column string
+	desc   bool
+}
+
+type sqlSelect struct {
+	columns []string // including countColumn
+	where   sqlCond  // nil matches every class
+	groupBy string
+	orderBy []sqlOrder
+	limit   int // -1 for none
+}
+
+// sqlCond is a WHERE condition.
+type sqlCond interface {
+	match(c *pb.Class) bool
+}
+
+type sqlAnd struct{ left, right sqlCond }
+type sqlOr struct{ left, right sqlCond }
+type sqlNot struct{ cond sqlCond }
+
+func (e sqlAnd) match(c *pb.Class) bool { return e.left.match(c) && e.right.match(c) }
+func (e sqlOr) match(c *pb.Class) bool  { return e.left.match(c) || e.right.match(c) }
+func (e sqlNot) match(c *pb.Class) bool { return !e.cond.match(c) }
+
+type sqlCompare struct {
+	column, op string
+	value      interface{}
+}
+
+func (e sqlCompare) match(c *pb.Class) bool {
+	n := compareSQL(sqlColumn(c, e.column), e.value)
+	switch e.op {
+	case "=":
+		return n == 0
+	case "!=", "<>":
+		return n != 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	}
+	return false
+}
+
+type sqlLike struct {
+	column  string
+	pattern *regexp.Regexp
+}
+
+func (e sqlLike) match(c *pb.Class) bool {
+	return e.pattern.MatchString(sqlColumn(c, e.column).(string))
+}
+
+// likePattern translates a LIKE pattern, where % matches any run of
+// characters and _ any one, into an anchored regexp. Like SQLite, it
+// ignores case.
+func likePattern(p string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range p {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+type sqlIn struct {
+	column string
+	values map[interface{}]bool
+}
+
+func (e sqlIn) match(c *pb.Class) bool { return e.values[sqlColumn(c, e.column)] }
+
+// sqlToken is a word, string, number or punctuation.
+type sqlToken struct {
+	kind byte // 'w'ord, 's'tring, 'n'umber, 'p'unctuation, or 0 at the end
+	text string
+}
+
+func tokenizeSQL(q string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	rs := []rune(q)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{'w', strings.ToLower(string(rs[i:j]))})
+			i = j
+		case unicode.IsDigit(r) || r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			j := i + 1
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{'n', string(rs[i:j])})
+			i = j
+		case r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; ; j++ {
+				if j >= len(rs) {
+					return nil, errors.New("unterminated string")
+				}
+				if rs[j] == '\'' {
+					if j+1 < len(rs) && rs[j+1] == '\'' {
+						b.WriteRune('\'')
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteRune(rs[j])
+			}
+			tokens = append(tokens, sqlToken{'s', b.String()})
+			i = j + 1
+		default:
+			op := string(r)
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case "!=", "<>", "<=", ">=":
+					op = two
+				}
+			}
+			switch op {
+			case "(", ")", ",", "*", ";", "=", "!=", "<>", "<", "<=", ">", ">=":
+			default:
+				return nil, fmt.Errorf("unexpected %q", op)
+			}
+			tokens = append(tokens, sqlToken{'p', op})
+			i += len([]rune(op))
+		}
+	}
+	return tokens, nil
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return sqlToken{}
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept consumes the next token if it is the keyword or punctuation s.
+func (p *sqlParser) accept(s string) bool {
+	if t := p.peek(); (t.kind == 'w' || t.kind == 'p') && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expect(s string) error {
+	if !p.accept(s) {
+		return p.unexpected("expected " + strings.ToUpper(s))
+	}
+	return nil
+}
+
+func (p *sqlParser) unexpected(what string) error {
+	t := p.peek()
+	if t.kind == 0 {
+		return fmt.Errorf("%s at end of query", what)
+	}
+	return fmt.Errorf("%s, found %q", what, t.text)
+}
+
+func (p *sqlParser) column() (string, error) {
+	t := p.peek()
+	if t.kind != 'w' || !isSQLColumn(t.text) {
+		return "", p.unexpected("expected a column (" + strings.Join(sqlColumns, ", ") + ")")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *sqlParser) str() (string, error) {
+	t := p.peek()
+	if t.kind != 's' {
+		return "", p.unexpected("expected a quoted string")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// value parses a literal to compare with col: a number for an integer
+// column, or a quoted string for any other.
+func (p *sqlParser) value(col string) (interface{}, error) {
+	if !sqlIntColumns[col] {
+		if t := p.peek(); t.kind == 'n' {
+			return nil, fmt.Errorf("%s holds text, so compare it with a quoted string, not %s", col, t.text)
+		}
+		return p.str()
+	}
+	t := p.peek()
+	if t.kind != 'n' {
+		return nil, p.unexpected(col + " holds integers, so expected a number")
+	}
+	n, err := strconv.ParseInt(t.text, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s is out of range", t.text)
+	}
+	p.pos++
+	return n, nil
+}
+
+// countArgs parses the (*) following COUNT.
+func (p *sqlParser) countArgs() error {
+	for _, s := range []string{"(", "*", ")"} {
+		if err := p.expect(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSQL parses a query in the endpoint's dialect.
+func parseSQL(q string) (*sqlSelect, error) {
+	tokens, err := tokenizeSQL(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+	s := &sqlSelect{limit: -1}
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("*"):
+			s.columns = append(s.columns, sqlColumns...)
+		case p.accept("count"):
+			if err := p.countArgs(); err != nil {
+				return nil, err
+			}
+			s.columns = append(s.columns, countColumn)
+		default:
+			col, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			s.columns = append(s.columns, col)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	if !p.accept("classes") {
+		return nil, p.unexpected("the only table is classes")
+	}
+	if p.accept("where") {
+		if s.where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("group") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		if s.groupBy, err = p.column(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("order") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			var o sqlOrder
+			if p.accept("count") {
+				if err := p.countArgs(); err != nil {
+					return nil, err
+				}
+				o.column = countColumn
+			} else if o.column, err = p.column(); err != nil {
+				return nil, err
+			}
+			if p.accept("desc") {
+				o.desc = true
+			} else {
+				p.accept("asc")
+			}
+			s.orderBy = append(s.orderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("limit") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != 'n' || err != nil {
+			return nil, errors.New("LIMIT needs a whole number")
+		}
+		s.limit = n
+	}
+	p.accept(";")
+	if p.peek().kind != 0 {
+		return nil, p.unexpected("expected the end of the query")
+	}
+	return s, s.check()
+}
+
+// check rejects queries mixing COUNT(*) with columns that aren't grouped.
+func (s *sqlSelect) check() error {
+	counting := false
+	for _, c := range s.columns {
+		if c == countColumn {
+			counting = true
+		}
+	}
+	for _, c := range s.columns {
+		if c != countColumn && (counting || s.groupBy != "") && c != s.groupBy {
+			return fmt.Errorf("%s must be in GROUP BY to be selected with COUNT(*)", c)
+		}
+	}
+	for _, o := range s.orderBy {
+		if o.column == countColumn && !counting {
+			return errors.New("ORDER BY COUNT(*) needs COUNT(*) in the select list")
+		}
+		if (counting || s.groupBy != "") && o.column != countColumn && o.column != s.groupBy {
+			return fmt.Errorf("can't order groups by %s", o.column)
+		}
+	}
+	return nil
+}
+
+func (p *sqlParser) or() (sqlCond, error) {
+	left, err := p.and()
+	for err == nil && p.accept("or") {
+		var right sqlCond
+		right, err = p.and()
+		left = sqlOr{left, right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) and() (sqlCond, error) {
+	left, err := p.not()
+	for err == nil && p.accept("and") {
+		var right sqlCond
+		right, err = p.not()
+		left = sqlAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) not() (sqlCond, error) {
+	if p.accept("not") {
+		c, err := p.not()
+		return sqlNot{c}, err
+	}
+	if p.accept("(") {
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+	return p.predicate()
+}
+
+func (p *sqlParser) predicate() (sqlCond, error) {
+	col, err := p.column()
+	if err != nil {
+		return nil, err
+	}
+	negate := p.accept("not")
+	var c sqlCond
+	switch {
+	case p.accept("like"):
+		if sqlIntColumns[col] {
+			return nil, fmt.Errorf("LIKE needs a text column, and %s holds integers", col)
+		}
+		pattern, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		c = sqlLike{col, likePattern(pattern)}
+	case p.accept("in"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		in := sqlIn{col, make(map[interface{}]bool)}
+		for {
+			v, err := p.value(col)
+			if err != nil {
+				return nil, err
+			}
+			in.values[v] = true
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		c = in
+	case negate:
+		return nil, p.unexpected("expected LIKE or IN after NOT")
+	default:
+		t := p.next()
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+		default:
+			p.pos--
+			return nil, p.unexpected("expected a comparison")
+		}
+		v, err := p.value(col)
+		if err != nil {
+			return nil, err
+		}
+		c = sqlCompare{col, t.text, v}
+	}
+	if negate {
+		c = sqlNot{c}
+	}
+	return c, nil
+}
+
+// sqlResult is the JSON the endpoint answers with.
+type sqlResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// Truncated is set when rows were left out to stay within the server's
+	// row limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// run evaluates s over classes, returning at most maxRows rows (0 for no
+// limit). It gives up with ctx's error if ctx ends first.
+func (s *sqlSelect) run(ctx context.Context, classes []*pb.Class, maxRows int) (*sqlResult, error) {
+	var matched []*pb.Class
+	for i, c := range classes {
+		if i%1024 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if s.where == nil || s.where.match(c) {
+			matched = append(matched, c)
+		}
+	}
+
+	var rows [][]interface{}
+	// groupKeys[i] is the GROUP BY value of grouped row i.
+	var groupKeys []interface{}
+	grouped := s.groupBy != ""
+	for _, c := range s.columns {
+		grouped = grouped || c == countColumn
+	}
+	if grouped {
+		counts := make(map[interface{}]int64)
+		var keys []interface{}
+		for _, c := range matched {
+			k := sqlColumn(c, s.groupBy)
+			if _, ok := counts[k]; !ok {
+				keys = append(keys, k)
+			}
+			counts[k]++
+		}
+		if s.groupBy == "" && len(keys) == 0 {
+			keys = []interface{}{""}
+		}
+		sort.Slice(keys, func(i, j int) bool { return compareSQL(keys[i], keys[j]) < 0 })
+		for _, k := range keys {
+			row := make([]interface{}, len(s.columns))
+			for i, col := range s.columns {
+				if col == countColumn {
+					row[i] = counts[k]
+				} else {
+					row[i] = k
+				}
+			}
+			rows = append(rows, row)
+			groupKeys = append(groupKeys, k)
+		}
+	} else {
+		for _, c := range matched {
+			row := make([]interface{}, len(s.columns))
+			for i, col := range s.columns {
+				row[i] = sqlColumn(c, col)
+			}
+			rows = append(rows, row)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if len(s.orderBy) > 0 {
+		index := make(map[string]int)
+		for i, col := range s.columns {
+			index[col] = i
+		}
+		// Rows can be ordered by columns that weren't selected: the group
+		// key, or any column of an ungrouped row's class.
+		sortCols := make([]func(i int) interface{}, len(s.orderBy))
+		for n, o := range s.orderBy {
+			o := o
+			i, ok := index[o.column]
+			switch {
+			case ok:
+				sortCols[n] = func(r int) interface{} { return rows[r][i] }
+			case grouped:
+				sortCols[n] = func(r int) interface{} { return groupKeys[r] }
+			default:
+				sortCols[n] = func(r int) interface{} { return sqlColumn(matched[r], o.column) }
+			}
+		}
+		perm := make([]int, len(rows))
+		for i := range perm {
+			perm[i] = i
+		}
+		sort.SliceStable(perm, func(a, b int) bool {
+			for n, o := range s.orderBy {
+				c := compareSQL(sortCols[n](perm[a]), sortCols[n](perm[b]))
+				if c != 0 {
+					return (c < 0) != o.desc
+				}
+			}
+			return false
+		})
+		sorted := make([][]interface{}, len(rows))
+		for i, r := range perm {
+			sorted[i] = rows[r]
+		}
+		rows = sorted
+	}
+
+	res := &sqlResult{Columns: s.columns, Rows: rows}
+	if s.limit >= 0 && len(res.Rows) > s.limit {
+		res.Rows = res.Rows[:s.limit]
+	}
+	if maxRows > 0 && len(res.Rows) > maxRows {
+		res.Rows = res.Rows[:maxRows]
+		res.Truncated = true
+	}
+	if res.Rows == nil {
+		res.Rows = [][]interface{}{}
+	}
+	return res, nil
+}
+
+// compareSQL orders two values of the same column, or two counts:
+// integers numerically and strings bytewise.
+func compareSQL(a, b interface{}) int {
+	if x, ok := a.(int64); ok {
+		y := b.(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+// sqlHandler serves the SQL endpoint.
+type sqlHandler struct {
+	s       *server
+	auth    *tokenAuth
+	timeout time.Duration
+	maxRows int
+}
+
+func (h *sqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var q string
+	switch r.Method {
+	case http.MethodGet:
+		q = r.URL.Query().Get("q")
+	case http.MethodPost:
+		b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if err != nil {
+			sqlError(w, http.StatusRequestEntityTooLarge, "query too long")
+			return
+		}
+		q = string(b)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		sqlError(w, http.StatusMethodNotAllowed, "use GET with ?q= or POST the query")
+		return
+	}
+	tenant := r.Header.Get(tenantMetadataKey)
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	if !tenantPattern.MatchString(tenant) {
+		sqlError(w, http.StatusBadRequest, fmt.Sprintf("%s must match %s", tenantMetadataKey, tenantPattern))
+		return
+	}
+	if status, msg := h.auth.authorizeHTTP(r, tenant); status != http.StatusOK {
+		sqlError(w, status, msg)
+		return
+	}
+
+	sel, err := parseSQL(q)
+	if err != nil {
+		sqlError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+	var classes []*pb.Class
+	err = h.s.view(ctx, tenant, func(txn *tenantTxn) error {
+		var err error
+		classes, err = listClasses(txn)
+		return err
+	})
+	if err != nil && !isContextError(err) {
+		log.Printf("Error reading classes for SQL query: %s", err)
+		sqlError(w, http.StatusInternalServerError, "failed to read classes")
+		return
+	}
+	var res *sqlResult
+	if err == nil {
+		res, err = sel.run(ctx, classes, h.maxRows)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		sqlError(w, http.StatusGatewayTimeout, fmt.Sprintf("query took longer than %s", h.timeout))
+		return
+	}
+	if err != nil {
+		sqlError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func sqlError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// serveSQL serves the SQL endpoint at /query on addr until the process
+// exits.
+func serveSQL(addr string, h *sqlHandler) {
+	mux := http.NewServeMux()
+	mux.Handle("/query", h)
+	log.Printf("Serving SQL queries on %v...\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("failed to serve SQL queries: %v", err)
+	}
+}
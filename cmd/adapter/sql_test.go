@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+var sqlTestClasses = []*pb.Class{
+	{Id: "ART100", Name: "Drawing", Semester: "2024-FALL", Capacity: 9},
+	{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL", Capacity: 30},
+	{Id: "MATH102", Name: "Geometry", Semester: "2025-SPRING", Capacity: 100},
+	{Id: "PHYS200", Name: "Mechanics", Semester: "2025-SPRING", Capacity: 25},
+	{Id: "PHYS201", Name: "O'Brien's Optics", Semester: "2025-SPRING", Capacity: 9},
+}
+
+func TestSQL(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  string // JSON of the rows
+	}{
+		{"SELECT id FROM classes", `[["ART100"],["MATH101"],["MATH102"],["PHYS200"],["PHYS201"]]`},
+		{"select id, name from classes where semester = '2024-FALL'", `[["ART100","Drawing"],["MATH101","Algebra"]]`},
+		{"SELECT id FROM classes WHERE id LIKE 'math%' AND NOT name = 'Algebra'", `[["MATH102"]]`},
+		{"SELECT id FROM classes WHERE semester IN ('2024-FALL') OR id > 'PHYS200'", `[["ART100"],["MATH101"],["PHYS201"]]`},
+		{"SELECT id FROM classes WHERE (id < 'B' OR id >= 'P') AND semester <> '2024-FALL'", `[["PHYS200"],["PHYS201"]]`},
+		{"SELECT id FROM classes WHERE name = 'O''Brien''s Optics'", `[["PHYS201"]]`},
+		{"SELECT id FROM classes WHERE id NOT IN ('ART100', 'MATH101', 'MATH102')", `[["PHYS200"],["PHYS201"]]`},
+		{"SELECT id FROM classes ORDER BY name DESC LIMIT 2", `[["PHYS201"],["PHYS200"]]`},
+		{"SELECT id FROM classes ORDER BY semester DESC, id LIMIT 2;", `[["MATH102"],["PHYS200"]]`},
+		{"SELECT COUNT(*) FROM classes", `[[5]]`},
+		{"SELECT COUNT(*) FROM classes WHERE id = 'none'", `[[0]]`},
+		{"SELECT semester, COUNT(*) FROM classes GROUP BY semester", `[["2024-FALL",2],["2025-SPRING",3]]`},
+		{"SELECT COUNT(*) FROM classes GROUP BY semester ORDER BY COUNT(*) DESC", `[[3],[2]]`},
+		{"SELECT semester FROM classes GROUP BY semester ORDER BY semester DESC", `[["2025-SPRING"],["2024-FALL"]]`},
+
+		// capacity is compared and ordered as a number, so 9 < 25 < 100.
+		{"SELECT id, capacity FROM classes WHERE capacity > 25", `[["MATH101",30],["MATH102",100]]`},
+		{"SELECT id FROM classes WHERE capacity <= 9 OR capacity = 100", `[["ART100"],["MATH102"],["PHYS201"]]`},
+		{"SELECT id FROM classes WHERE capacity IN (9, 25) AND capacity <> 25", `[["ART100"],["PHYS201"]]`},
+		{"SELECT id FROM classes WHERE capacity > -1 ORDER BY capacity DESC, id", `[["MATH102"],["MATH101"],["PHYS200"],["ART100"],["PHYS201"]]`},
+		{"SELECT capacity, COUNT(*) FROM classes GROUP BY capacity", `[[9,2],[25,1],[30,1],[100,1]]`},
+	} {
+		sel, err := parseSQL(tc.query)
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+			continue
+		}
+		res, err := sel.run(context.Background(), sqlTestClasses, 0)
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+			continue
+		}
+		got, _ := json.Marshal(res.Rows)
+		if string(got) != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestSQLErrors(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"DELETE FROM classes",
+		"SELECT * FROM students",
+		"SELECT secret FROM classes",
+		"SELECT id FROM classes WHERE id = 5",
+		"SELECT id FROM classes WHERE id IN ('ART100', 5)",
+		"SELECT id FROM classes WHERE capacity = '30'",
+		"SELECT id FROM classes WHERE capacity IN (9, '25')",
+		"SELECT id FROM classes WHERE capacity LIKE '3%'",
+		"SELECT id FROM classes WHERE capacity > 99999999999999999999",
+		"SELECT id FROM classes WHERE id = 'unterminated",
+		"SELECT id, COUNT(*) FROM classes",
+		"SELECT id FROM classes GROUP BY semester",
+		"SELECT id FROM classes ORDER BY COUNT(*)",
+		"SELECT id FROM classes LIMIT many",
+		"SELECT id FROM classes; DROP TABLE classes",
+	} {
+		if _, err := parseSQL(q); err == nil {
+			t.Errorf("%q parsed", q)
+		}
+	}
+}
+
+func TestSQLLimits(t *testing.T) {
+	sel, err := parseSQL("SELECT * FROM classes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := sel.run(context.Background(), sqlTestClasses, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 3 || !res.Truncated {
+		t.Errorf("got %d rows (truncated %v), want 3 truncated", len(res.Rows), res.Truncated)
+	}
+	if !reflect.DeepEqual(res.Columns, sqlColumns) {
+		t.Errorf("columns %v, want %v", res.Columns, sqlColumns)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := sel.run(ctx, sqlTestClasses, 0); err != context.DeadlineExceeded {
+		t.Errorf("run past the deadline returned %v", err)
+	}
+}
+
+func TestSQLHandler(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		putTestClasses(t, s.db, sqlTestClasses...)
+		auth := &tokenAuth{tokens: map[string]tokenGrant{
+			"analyst":     {tenants: map[string]bool{defaultTenant: true, "district-a": true}},
+			"stats-token": {role: statsRole},
+		}}
+		h := &sqlHandler{s: s, auth: auth, timeout: time.Second, maxRows: 100}
+
+		query := func(token, tenant, q string) (int, map[string]interface{}) {
+			r := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(q))
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			if tenant != "" {
+				r.Header.Set(tenantMetadataKey, tenant)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			var body map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			return w.Code, body
+		}
+
+		if code, body := query("analyst", "", "SELECT COUNT(*) FROM classes"); code != http.StatusOK || body["rows"].([]interface{})[0].([]interface{})[0] != 5.0 {
+			t.Errorf("got %d %v, want a count of 5", code, body)
+		}
+		if code, body := query("analyst", "district-a", "SELECT COUNT(*) FROM classes"); code != http.StatusOK || body["rows"].([]interface{})[0].([]interface{})[0] != 0.0 {
+			t.Errorf("another tenant got %d %v, want a count of 0", code, body)
+		}
+		for _, tc := range []struct {
+			token, tenant, q string
+			want             int
+		}{
+			{"", "", "SELECT id FROM classes", http.StatusUnauthorized},
+			{"stats-token", "", "SELECT id FROM classes", http.StatusForbidden},
+			{"analyst", "Bad Tenant", "SELECT id FROM classes", http.StatusBadRequest},
+			{"analyst", "district-b", "SELECT id FROM classes", http.StatusForbidden},
+			{"analyst", "", "SELECT nonsense", http.StatusBadRequest},
+		} {
+			if code, body := query(tc.token, tc.tenant, tc.q); code != tc.want {
+				t.Errorf("%q with token %q: got %d %v, want %d", tc.q, tc.token, code, body, tc.want)
+			}
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/query?q="+url.QueryEscape("SELECT id FROM classes LIMIT 1"), nil)
+		r.Header.Set("Authorization", "Bearer analyst")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ART100") {
+			t.Errorf("GET returned %d %s", w.Code, w.Body)
+		}
+	})
+}
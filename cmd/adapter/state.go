@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// nextState is the state TransitionState may move a class in each state
+// to. Classes only move forward, one state at a time.
+var nextState = map[pb.Class_State]pb.Class_State{
+	pb.Class_DRAFT:     pb.Class_PUBLISHED,
+	pb.Class_PUBLISHED: pb.Class_CLOSED,
+}
+
+// checkState accepts the states a class can be in, leaving out
+// STATE_UNSPECIFIED.
+func (v *violations) checkState(field string, state pb.Class_State) {
+	if _, ok := pb.Class_State_name[int32(state)]; !ok || state == pb.Class_STATE_UNSPECIFIED {
+		v.add(field, "must be DRAFT, PUBLISHED or CLOSED")
+	}
+}
+
+// inStates returns the classes whose state is one of states.
+func inStates(classes []*pb.Class, states []pb.Class_State) []*pb.Class {
+	want := make(map[pb.Class_State]bool, len(states))
+	for _, st := range states {
+		want[st] = true
+	}
+	var out []*pb.Class
+	for _, c := range classes {
+		if want[c.State] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (s *server) TransitionState(ctx context.Context, in *pb.TransitionStateRequest) (*pb.Class, error) {
+	logf(ctx, "TransitionState called for Id %s to %s", in.Id, in.State)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var c *pb.Class
+	var event *pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		event = nil
+		if err := checkEditLease(txn, in.Id, in.LeaseToken); err != nil {
+			return err
+		}
+		old, err := getClass(txn, in.Id)
+		if err == badger.ErrKeyNotFound {
+			return status.Errorf(codes.NotFound, "class %s not found", in.Id)
+		}
+		if err != nil {
+			return err
+		}
+		if old.State == in.State {
+			c = old
+			return nil
+		}
+		if nextState[old.State] != in.State {
+			return preconditionFailed(preconditionState, "classes/"+in.Id, "class %s can't go from %s to %s", in.Id, old.State, in.State)
+		}
+		c = proto.Clone(old).(*pb.Class)
+		c.State = in.State
+		c.UpdateTime = timestamppb.Now()
+		if err := storeClass(txn, c); err != nil {
+			return err
+		}
+		if err := s.audit.record(ctx, txn, "TransitionState", in.Id, old, proto.Clone(c).(*pb.Class)); err != nil {
+			return err
+		}
+		event = newClassEvent(pb.ClassEvent_UPDATED, tenant, proto.Clone(c).(*pb.Class))
+		txn.record(event)
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	if event != nil {
+		s.forgetRead(tenant, in.Id)
+		s.emit(event)
+	}
+	return c, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestTransitionState(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", State: pb.Class_DRAFT}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Create(ctx, &pb.Class{Id: "CHEM101", Name: "Chemistry"}); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := s.Get(ctx, &pb.GetRequest{Id: "CHEM101"}); err != nil || c.State != pb.Class_PUBLISHED {
+			t.Errorf("class created without a state is %v (%v), want PUBLISHED", c.GetState(), err)
+		}
+		if _, err := s.Create(ctx, &pb.Class{Id: "BIO101", State: pb.Class_CLOSED}); preconditionType(err) != preconditionState {
+			t.Errorf("Create of a CLOSED class returned %v, want a STATE precondition failure", err)
+		}
+
+		if _, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: "s1"}); preconditionType(err) != preconditionState {
+			t.Errorf("Enroll in a DRAFT class returned %v, want a STATE precondition failure", err)
+		}
+		// Writes keep the state, and can't change it.
+		if c, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I"}); err != nil || c.State != pb.Class_DRAFT {
+			t.Errorf("Update left the class %v (%v), want DRAFT", c.GetState(), err)
+		}
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I", State: pb.Class_PUBLISHED}); preconditionType(err) != preconditionState {
+			t.Errorf("Update of the state returned %v, want a STATE precondition failure", err)
+		}
+		if _, err := s.TransitionState(ctx, &pb.TransitionStateRequest{Id: "MATH101", State: pb.Class_CLOSED}); preconditionType(err) != preconditionState {
+			t.Errorf("DRAFT to CLOSED returned %v, want a STATE precondition failure", err)
+		}
+
+		c, err := s.TransitionState(ctx, &pb.TransitionStateRequest{Id: "MATH101", State: pb.Class_PUBLISHED})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.State != pb.Class_PUBLISHED || c.Name != "Algebra I" {
+			t.Errorf("TransitionState returned %v, want Algebra I PUBLISHED", c)
+		}
+		if _, err := s.TransitionState(ctx, &pb.TransitionStateRequest{Id: "MATH101", State: pb.Class_PUBLISHED}); err != nil {
+			t.Errorf("repeating a transition returned %v, want the class", err)
+		}
+		if _, err := s.Enroll(ctx, &pb.EnrollmentRequest{ClassId: "MATH101", StudentId: "s1"}); err != nil {
+			t.Errorf("Enroll in a PUBLISHED class returned %v", err)
+		}
+		if _, err := s.TransitionState(ctx, &pb.TransitionStateRequest{Id: "MATH101", State: pb.Class_CLOSED}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.TransitionState(ctx, &pb.TransitionStateRequest{Id: "MATH101", State: pb.Class_PUBLISHED}); preconditionType(err) != preconditionState {
+			t.Errorf("CLOSED to PUBLISHED returned %v, want a STATE precondition failure", err)
+		}
+		c, err = s.Update(ctx, &pb.Class{Id: "MATH101", Capacity: 10, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"capacity"}}})
+		if err != nil || c.State != pb.Class_CLOSED {
+			t.Errorf("masked Update left the class %v (%v), want CLOSED", c.GetState(), err)
+		}
+
+		tests := []struct {
+			in   *pb.TransitionStateRequest
+			code codes.Code
+		}{
+			{&pb.TransitionStateRequest{Id: "NOPE", State: pb.Class_PUBLISHED}, codes.NotFound},
+			{&pb.TransitionStateRequest{Id: "MATH101"}, codes.InvalidArgument},
+			{&pb.TransitionStateRequest{Id: "MATH101", State: 7}, codes.InvalidArgument},
+			{&pb.TransitionStateRequest{State: pb.Class_CLOSED}, codes.InvalidArgument},
+		}
+		for _, tt := range tests {
+			err := validateRequest("/class.Adapter/TransitionState", tt.in)
+			if err == nil {
+				_, err = s.TransitionState(ctx, tt.in)
+			}
+			if status.Code(err) != tt.code {
+				t.Errorf("TransitionState(%v) returned %v, want %v", tt.in, err, tt.code)
+			}
+		}
+	})
+}
+
+func TestListStates(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		for _, c := range []*pb.Class{
+			{Id: "A", State: pb.Class_DRAFT},
+			{Id: "B"},
+			{Id: "C"},
+			{Id: "D", State: pb.Class_DRAFT},
+		} {
+			if _, err := s.Create(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.TransitionState(ctx, &pb.TransitionStateRequest{Id: "C", State: pb.Class_CLOSED}); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			states []pb.Class_State
+			want   []string
+		}{
+			{nil, []string{"A", "B", "C", "D"}},
+			{[]pb.Class_State{pb.Class_PUBLISHED}, []string{"B"}},
+			{[]pb.Class_State{pb.Class_PUBLISHED, pb.Class_CLOSED}, []string{"B", "C"}},
+			{[]pb.Class_State{pb.Class_DRAFT}, []string{"A", "D"}},
+		}
+		for _, tt := range tests {
+			var got []string
+			token := ""
+			for {
+				cs, err := s.List(ctx, &pb.ListRequest{States: tt.states, PageSize: 1, PageToken: token})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cs.TotalSize != int64(len(tt.want)) {
+					t.Errorf("List of %v has total size %d, want %d", tt.states, cs.TotalSize, len(tt.want))
+				}
+				for _, c := range cs.Classes {
+					got = append(got, c.Id)
+				}
+				if token = cs.NextPageToken; token == "" {
+					break
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("List of %v returned %v, want %v", tt.states, got, tt.want)
+				continue
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("List of %v returned %v, want %v", tt.states, got, tt.want)
+					break
+				}
+			}
+		}
+
+		if err := validateRequest("/class.Adapter/List", &pb.ListRequest{States: []pb.Class_State{pb.Class_STATE_UNSPECIFIED}}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("List of STATE_UNSPECIFIED returned %v, want InvalidArgument", err)
+		}
+	})
+}
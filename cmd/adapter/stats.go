@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+// departmentOf returns the leading letters of a class Id, the subject code in
+// Ids like MATH101-01.
+func departmentOf(id string) string {
+	i := strings.IndexFunc(id, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i < 0 {
+		return strings.ToUpper(id)
+	}
+	return strings.ToUpper(id[:i])
+}
+
+func (s *server) GetAggregateStats(ctx context.Context, in *pb.AggregateStatsRequest) (*pb.AggregateStats, error) {
+	logf(ctx, "GetAggregateStats called grouped by %v", in.GroupBy)
+	bySemester, byDepartment := len(in.GroupBy) == 0, len(in.GroupBy) == 0
+	for _, g := range in.GroupBy {
+		bySemester = bySemester || g == "semester"
+		byDepartment = byDepartment || g == "department"
+	}
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make(map[statsCell]int64)
+	err = s.view(ctx, tenant, func(txn *tenantTxn) error {
+		classes, err := listClasses(txn)
+		if err != nil {
+			return err
+		}
+		for _, c := range classes {
+			cells[statsCell{semester: c.Semester, department: departmentOf(c.Id)}]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	// Every grouping is answered from the same suppression, so no two
+	// answers can be subtracted to reveal a suppressed count.
+	minCount := s.tuning().statsMinCount
+	counts := statsTotals(cells)
+	suppressed := suppressStats(counts, minCount)
+	stats := &pb.AggregateStats{MinCount: minCount}
+	for k, n := range counts {
+		if k.anySemester == bySemester || k.anyDepartment == byDepartment {
+			continue
+		}
+		g := &pb.AggregateStats_Group{
+			Semester:   k.semester,
+			Department: k.department,
+			Count:      n,
+		}
+		if suppressed[k] {
+			g.Count = 0
+			g.Suppressed = true
+		}
+		stats.Groups = append(stats.Groups, g)
+	}
+	sort.Slice(stats.Groups, func(i, j int) bool {
+		a, b := stats.Groups[i], stats.Groups[j]
+		if a.Semester != b.Semester {
+			return a.Semester < b.Semester
+		}
+		return a.Department < b.Department
+	})
+	return stats, nil
+}
+
+// statsCell is a group of GetAggregateStats: the classes of one semester and
+// department, or the total over every semester or department.
+type statsCell struct {
+	semester, department       string
+	anySemester, anyDepartment bool
+}
+
+// statsTotals adds to the per-semester, per-department counts in cells their
+// totals per semester, per department and overall.
+func statsTotals(cells map[statsCell]int64) map[statsCell]int64 {
+	counts := make(map[statsCell]int64)
+	for k, n := range cells {
+		counts[k] += n
+		counts[statsCell{semester: k.semester, anyDepartment: true}] += n
+		counts[statsCell{department: k.department, anySemester: true}] += n
+		counts[statsCell{anySemester: true, anyDepartment: true}] += n
+	}
+	return counts
+}
+
+// suppressStats returns the groups in counts to suppress. Groups with fewer
+// than minCount classes are suppressed, and then complementary suppression
+// protects them from subtraction: wherever a total is the sum of some
+// groups, either none of them and the total are suppressed, or at least two
+// are and, while the total is shown, the hidden groups add up to minCount or
+// more. The smallest groups are suppressed first to keep the most detail.
+func suppressStats(counts map[statsCell]int64, minCount int64) map[statsCell]bool {
+	// The overall total isn't a group, but Count reveals it, so it's never
+	// hidden.
+	all := statsCell{anySemester: true, anyDepartment: true}
+	suppressed := make(map[statsCell]bool)
+	for k, n := range counts {
+		if n < minCount && k != all {
+			suppressed[k] = true
+		}
+	}
+
+	// Each sum is a total followed by its parts.
+	var sums [][]statsCell
+	bySemester, byDepartment := []statsCell{all}, []statsCell{all}
+	for k := range counts {
+		switch {
+		case k.anySemester && k.anyDepartment:
+		case k.anyDepartment:
+			bySemester = append(bySemester, k)
+			sum := []statsCell{k}
+			for c := range counts {
+				if !c.anySemester && !c.anyDepartment && c.semester == k.semester {
+					sum = append(sum, c)
+				}
+			}
+			sums = append(sums, sum)
+		case k.anySemester:
+			byDepartment = append(byDepartment, k)
+			sum := []statsCell{k}
+			for c := range counts {
+				if !c.anySemester && !c.anyDepartment && c.department == k.department {
+					sum = append(sum, c)
+				}
+			}
+			sums = append(sums, sum)
+		}
+	}
+	sums = append(sums, bySemester, byDepartment)
+
+	for changed := true; changed; {
+		changed = false
+		for _, sum := range sums {
+			total, parts := sum[0], sum[1:]
+			hidden, hiddenCount := 0, int64(0)
+			var candidates []statsCell
+			for _, k := range parts {
+				if suppressed[k] {
+					hidden++
+					hiddenCount += counts[k]
+				} else {
+					candidates = append(candidates, k)
+				}
+			}
+			if suppressed[total] {
+				hidden++
+			}
+			if hidden == 0 || hidden >= 2 && (suppressed[total] || hiddenCount >= minCount) {
+				continue
+			}
+			if len(candidates) == 0 {
+				if total == all {
+					continue
+				}
+				// Only the total is left to hide.
+				candidates = []statsCell{total}
+			}
+			sort.Slice(candidates, func(i, j int) bool {
+				a, b := candidates[i], candidates[j]
+				if counts[a] != counts[b] {
+					return counts[a] < counts[b]
+				}
+				if a.semester != b.semester {
+					return a.semester < b.semester
+				}
+				return a.department < b.department
+			})
+			suppressed[candidates[0]] = true
+			changed = true
+		}
+	}
+	return suppressed
+}
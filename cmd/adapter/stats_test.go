@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func TestAggregateStatsSubtraction(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus()}
+		s.setTuning(tunables{statsMinCount: 10})
+		ctx := context.Background()
+
+		// 2024-FALL has 3 MATH classes, too few to report. Without
+		// complementary suppression, its semester total less its ART and PHYS
+		// counts would give them away.
+		var classes []*pb.Class
+		add := func(semester, department string, n int) {
+			for i := 0; i < n; i++ {
+				classes = append(classes, &pb.Class{Id: fmt.Sprintf("%s%d-%s", department, 100+i, semester), Name: department, Semester: semester})
+			}
+		}
+		add("2024-FALL", "MATH", 3)
+		add("2024-FALL", "ART", 10)
+		add("2024-FALL", "PHYS", 12)
+		add("2025-SPRING", "MATH", 11)
+		add("2025-SPRING", "ART", 10)
+		putTestClasses(t, s.db, classes...)
+
+		// shown maps each group of each answer to its count, or -1 when
+		// suppressed.
+		shown := make(map[statsCell]int64)
+		for _, groupBy := range [][]string{{"semester"}, {"department"}, nil} {
+			stats, err := s.GetAggregateStats(ctx, &pb.AggregateStatsRequest{GroupBy: groupBy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			onlyBy := func(dim string) bool { return len(groupBy) == 1 && groupBy[0] == dim }
+			for _, g := range stats.Groups {
+				k := statsCell{semester: g.Semester, department: g.Department, anySemester: onlyBy("department"), anyDepartment: onlyBy("semester")}
+				shown[k] = g.Count
+				if g.Suppressed {
+					shown[k] = -1
+				}
+			}
+		}
+		if shown[statsCell{semester: "2024-FALL", department: "MATH"}] != -1 {
+			t.Errorf("2024-FALL MATH has 3 classes and isn't suppressed: %v", shown)
+		}
+		if shown[statsCell{semester: "2025-SPRING", anyDepartment: true}] != 21 {
+			t.Errorf("2025-SPRING has 21 classes and isn't shown: %v", shown)
+		}
+
+		// Try every subtraction an analyst could: a shown total less its shown
+		// parts, including the overall total, which Count reveals.
+		counts := statsTotals(map[statsCell]int64{
+			{semester: "2024-FALL", department: "MATH"}:   3,
+			{semester: "2024-FALL", department: "ART"}:    10,
+			{semester: "2024-FALL", department: "PHYS"}:   12,
+			{semester: "2025-SPRING", department: "MATH"}: 11,
+			{semester: "2025-SPRING", department: "ART"}:  10,
+		})
+		all := statsCell{anySemester: true, anyDepartment: true}
+		shown[all] = counts[all]
+		semesters, departments := []string{"2024-FALL", "2025-SPRING"}, []string{"ART", "MATH", "PHYS"}
+		type sum struct {
+			total statsCell
+			parts []statsCell
+		}
+		var sums []sum
+		for _, sem := range semesters {
+			x := sum{total: statsCell{semester: sem, anyDepartment: true}}
+			for _, dept := range departments {
+				x.parts = append(x.parts, statsCell{semester: sem, department: dept})
+			}
+			sums = append(sums, x)
+		}
+		for _, dept := range departments {
+			x := sum{total: statsCell{department: dept, anySemester: true}}
+			for _, sem := range semesters {
+				x.parts = append(x.parts, statsCell{semester: sem, department: dept})
+			}
+			sums = append(sums, x)
+		}
+		bySemester, byDepartment := sum{total: all}, sum{total: all}
+		for _, sem := range semesters {
+			bySemester.parts = append(bySemester.parts, statsCell{semester: sem, anyDepartment: true})
+		}
+		for _, dept := range departments {
+			byDepartment.parts = append(byDepartment.parts, statsCell{department: dept, anySemester: true})
+		}
+		sums = append(sums, bySemester, byDepartment)
+
+		for _, x := range sums {
+			if shown[x.total] < 0 {
+				continue
+			}
+			var hidden []statsCell
+			var hiddenCount int64
+			for _, k := range x.parts {
+				if shown[k] < 0 {
+					hidden = append(hidden, k)
+					hiddenCount += counts[k]
+				}
+			}
+			if len(hidden) == 1 || len(hidden) > 1 && hiddenCount < 10 {
+				t.Errorf("subtracting from the shown total %+v reveals %+v, holding %d classes", x.total, hidden, hiddenCount)
+			}
+		}
+	})
+}
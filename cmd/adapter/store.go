@@ -0,0 +1,764 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Derived data lives under indexPrefix so it never collides with class keys,
+// whose escaped Ids never contain "/".
+const (
+	indexPrefix         = "idx/"
+	semesterIndexPrefix = indexPrefix + "semester/"
+	metaPrefix          = "meta/"
+)
+
+// Class fields are stored as <classKeyPrefix><id>.<field>, with the Id
+// escaped. Each prefix is named for the key schema version that moved class
+// keys under it: v1 versioned them, and v3 began escaping their Ids.
+const (
+	classKeyPrefix   = "v3/"
+	v1ClassKeyPrefix = "v1/"
+)
+
+// An Id followed by more of its key, in class keys and the keys of a
+// class's sections, enrollments and audit log, is stored with "%", "." and
+// "/" percent-encoded. Ids may be any string, yet none's keys fall under the
+// <id>. or <id>/ prefix of another's, and each reads back as it was written.
+// An Id that ends its key is stored as it is.
+var (
+	idEscaper   = strings.NewReplacer("%", "%25", delim, "%2E", "/", "%2F")
+	idUnescaper = strings.NewReplacer("%25", "%", "%2E", delim, "%2F", "/")
+)
+
+// escapeId encodes an Id for a key. It encodes character by character, so
+// the encoded prefix of an Id is a prefix of its encoding.
+func escapeId(id string) string {
+	return idEscaper.Replace(id)
+}
+
+func unescapeId(s string) string {
+	return idUnescaper.Replace(s)
+}
+
+func classKey(id, field string) []byte {
+	return []byte(classKeyPrefix + escapeId(id) + delim + field)
+}
+
+// splitClassKey splits a class key, without classKeyPrefix, into the Id
+// and field it stores, returning false if it has no field name.
+func splitClassKey(k string) (id, field string, ok bool) {
+	i := strings.LastIndex(k, delim)
+	if i < 0 {
+		return "", "", false
+	}
+	return unescapeId(k[:i]), k[i+1:], true
+}
+
+// reservedPrefixes hold the keys of everything but class fields, which were
+// stored at the root of the keyspace before the key schema was versioned.
+var reservedPrefixes = []string{indexPrefix, metaPrefix, leasePrefix, queryPrefix, outboxPrefix, auditPrefix, tenantKeyPrefix, kvPrefix, sectionPrefix, archivePrefix, enrollmentPrefix, instructorPrefix, changelogPrefix, classroomPrefix, webhookPrefix}
+
+func isReservedKey(k string) bool {
+	for _, p := range reservedPrefixes {
+		if strings.HasPrefix(k, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumField holds a checksum over a class's other fields, verified on
+// every read.
+const checksumField = "Checksum"
+
+// classFields are the per-field keys stored for a class, as "<id>.<field>".
+// Name and Semester are always stored; the others only when set. State is
+// only stored for classes that aren't PUBLISHED.
+var classFields = []string{"Name", "Semester", "CreateTime", "UpdateTime", "InstructorId", "InstructorName", "Capacity", "Description", "Meetings", "Labels", "Prerequisites", "ExternalIds", "ExpireTime", "State", checksumField}
+
+// storedClass holds the raw field values of a class, keyed by field.
+type storedClass map[string]string
+
+// checksum covers every field but the checksum itself, each length-prefixed
+// so values can't run into each other. It doubles as the class's etag.
+func (f storedClass) checksum() string {
+	h := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	for _, field := range classFields {
+		if field == checksumField {
+			continue
+		}
+		v, ok := f[field]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(h, "%s:%d:%s;", field, len(v), v)
+	}
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// decodeClass verifies the checksum of f and converts it to a class. Classes
+// stored before checksums were added are accepted as they are.
+func decodeClass(tenant, id string, f storedClass) (*pb.Class, error) {
+	if sum, ok := f[checksumField]; ok && sum != f.checksum() {
+		return nil, reportCorrupt(tenant, id, rawClass(id, f))
+	}
+	c := &pb.Class{
+		Id:             id,
+		Name:           f["Name"],
+		Semester:       f["Semester"],
+		InstructorId:   f["InstructorId"],
+		InstructorName: f["InstructorName"],
+		Description:    f["Description"],
+	}
+	var err error
+	if v, ok := f["CreateTime"]; ok {
+		if c.CreateTime, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := f["UpdateTime"]; ok {
+		if c.UpdateTime, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := f["Capacity"]; ok {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parse capacity of %s: %w", id, err)
+		}
+		c.Capacity = int32(n)
+	}
+	if v, ok := f["Meetings"]; ok {
+		if c.Meetings, err = decodeMeetings(v); err != nil {
+			return nil, fmt.Errorf("parse meetings of %s: %w", id, err)
+		}
+	}
+	if v, ok := f["Labels"]; ok {
+		if c.Labels, err = decodeLabels(v); err != nil {
+			return nil, fmt.Errorf("parse labels of %s: %w", id, err)
+		}
+	}
+	if v, ok := f["Prerequisites"]; ok {
+		if c.PrerequisiteIds, err = decodePrerequisites(v); err != nil {
+			return nil, fmt.Errorf("parse prerequisites of %s: %w", id, err)
+		}
+	}
+	if v, ok := f["ExternalIds"]; ok {
+		if c.ExternalIds, err = decodeExternalIds(v); err != nil {
+			return nil, fmt.Errorf("parse external Ids of %s: %w", id, err)
+		}
+	}
+	if v, ok := f["ExpireTime"]; ok {
+		if c.ExpireTime, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if c.State, err = decodeState(f); err != nil {
+		return nil, fmt.Errorf("parse state of %s: %w", id, err)
+	}
+	c.Etag = f.checksum()
+	return c, nil
+}
+
+// decodeState returns the stored state of a class, PUBLISHED if none is
+// stored.
+func decodeState(f storedClass) (pb.Class_State, error) {
+	v, ok := f["State"]
+	if !ok {
+		return pb.Class_PUBLISHED, nil
+	}
+	n, ok := pb.Class_State_value[v]
+	if !ok || n == int32(pb.Class_STATE_UNSPECIFIED) {
+		return 0, fmt.Errorf("unknown state %q", v)
+	}
+	return pb.Class_State(n), nil
+}
+
+// expired reports whether c has passed its expire time. Storage drops the
+// keys of an expired class by itself, but only to the second, so reads
+// check too.
+func expired(c *pb.Class) bool {
+	return c.ExpireTime != nil && !time.Now().Before(c.ExpireTime.AsTime())
+}
+
+// anyExpiring reports whether any of classes has an expire time.
+func anyExpiring(classes []*pb.Class) bool {
+	for _, c := range classes {
+		if c.ExpireTime != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// expiresAt is the storage expiry of the keys of a class expiring at t: the
+// Unix second at or after t.
+func expiresAt(t *timestamppb.Timestamp) uint64 {
+	at := t.AsTime()
+	secs := at.Unix()
+	if at.Nanosecond() > 0 {
+		secs++
+	}
+	return uint64(secs)
+}
+
+// encodeMeetings stores a schedule as the wire encoding of a Class holding
+// only the meetings.
+func encodeMeetings(meetings []*pb.Meeting) (string, error) {
+	b, err := proto.Marshal(&pb.Class{Meetings: meetings})
+	return string(b), err
+}
+
+func decodeMeetings(v string) ([]*pb.Meeting, error) {
+	c := &pb.Class{}
+	if err := proto.Unmarshal([]byte(v), c); err != nil {
+		return nil, err
+	}
+	return c.Meetings, nil
+}
+
+func semesterIndexKey(semester, id string) []byte {
+	return []byte(semesterIndexPrefix + semester + "/" + id)
+}
+
+// putClass stores every field of c under its Id, setting its update time
+// and keeping the create time and state of the class it replaces. Only
+// TransitionState changes the state of a stored class, so putClass fails
+// if c asks for another; a new class starts PUBLISHED unless c asks for
+// DRAFT.
+func putClass(txn *tenantTxn, c *pb.Class) error {
+	now := time.Now()
+	c.CreateTime = timestamppb.New(now)
+	c.UpdateTime = c.CreateTime
+	v, err := getField(txn, c.Id, "CreateTime")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if err == nil {
+		// A create time that doesn't parse is corrupt; replace it.
+		if created, err := parseTime(v); err == nil {
+			c.CreateTime = created
+		}
+	}
+	if err := keepState(txn, c); err != nil {
+		return err
+	}
+	return storeClass(txn, c)
+}
+
+// keepState sets the state of c, about to replace the stored class with
+// its Id, as putClass describes.
+func keepState(txn *tenantTxn, c *pb.Class) error {
+	if _, err := getField(txn, c.Id, "Name"); err == badger.ErrKeyNotFound {
+		switch c.State {
+		case pb.Class_STATE_UNSPECIFIED:
+			c.State = pb.Class_PUBLISHED
+		case pb.Class_CLOSED:
+			return preconditionFailed(preconditionState, "classes/"+c.Id, "class %s can't be created CLOSED", c.Id)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	stored := pb.Class_PUBLISHED
+	if v, err := getField(txn, c.Id, "State"); err == nil {
+		// A state that doesn't parse is corrupt; replace it.
+		if state, err := decodeState(storedClass{"State": v}); err == nil {
+			stored = state
+		}
+	} else if err != badger.ErrKeyNotFound {
+		return err
+	}
+	switch c.State {
+	case pb.Class_STATE_UNSPECIFIED:
+		c.State = stored
+	case stored:
+	default:
+		return preconditionFailed(preconditionState, "classes/"+c.Id, "class %s is %s; change its state with TransitionState", c.Id, stored)
+	}
+	return nil
+}
+
+// storeClass writes c exactly as given, with a fresh checksum, and keeps the
+// semester, instructor and label indexes and the semester counts in step
+// with the stored fields. Keys of fields c leaves unset are deleted. A
+// class with an expire time is stored with its index entries expiring then
+// too.
+func storeClass(txn *tenantTxn, c *pb.Class) error {
+	txn.touch(c.Id)
+	// Before the expiry below, which the semester's counts mustn't get.
+	if err := restatClass(txn, c.Id, c.Semester); err != nil {
+		return err
+	}
+	if c.ExpireTime != nil {
+		txn.expiresAt = expiresAt(c.ExpireTime)
+		defer func() { txn.expiresAt = 0 }()
+	}
+	old, err := getField(txn, c.Id, "Semester")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if err == nil && old != c.Semester {
+		if err := txn.Delete(semesterIndexKey(old, c.Id)); err != nil {
+			return fmt.Errorf("delete semester index for %s: %w", c.Id, err)
+		}
+	}
+	if c.Semester != "" {
+		if err := txn.Set(semesterIndexKey(c.Semester, c.Id), nil); err != nil {
+			return fmt.Errorf("put semester index for %s: %w", c.Id, err)
+		}
+	}
+	oldInstructor, err := getField(txn, c.Id, "InstructorId")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if oldInstructor != "" && oldInstructor != c.InstructorId {
+		if err := txn.Delete(instructorIndexKey(oldInstructor, c.Id)); err != nil {
+			return fmt.Errorf("delete instructor index for %s: %w", c.Id, err)
+		}
+	}
+	if c.InstructorId != "" {
+		if err := txn.Set(instructorIndexKey(c.InstructorId, c.Id), nil); err != nil {
+			return fmt.Errorf("put instructor index for %s: %w", c.Id, err)
+		}
+	}
+	oldLabels, err := getField(txn, c.Id, "Labels")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if err := indexLabels(txn, c.Id, oldLabels, c.Labels); err != nil {
+		return err
+	}
+	oldExternalIds, err := getField(txn, c.Id, "ExternalIds")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if err := indexExternalIds(txn, c.Id, oldExternalIds, c.ExternalIds); err != nil {
+		return err
+	}
+
+	f := storedClass{
+		"Name":     c.Name,
+		"Semester": c.Semester,
+	}
+	if c.CreateTime != nil {
+		f["CreateTime"] = formatTime(c.CreateTime)
+	}
+	if c.UpdateTime != nil {
+		f["UpdateTime"] = formatTime(c.UpdateTime)
+	}
+	if c.InstructorId != "" {
+		f["InstructorId"] = c.InstructorId
+	}
+	if c.InstructorName != "" {
+		f["InstructorName"] = c.InstructorName
+	}
+	if c.Capacity != 0 {
+		f["Capacity"] = strconv.Itoa(int(c.Capacity))
+	}
+	if c.Description != "" {
+		f["Description"] = c.Description
+	}
+	if len(c.Meetings) > 0 {
+		if f["Meetings"], err = encodeMeetings(c.Meetings); err != nil {
+			return err
+		}
+	}
+	if len(c.Labels) > 0 {
+		if f["Labels"], err = encodeLabels(c.Labels); err != nil {
+			return err
+		}
+	}
+	if len(c.PrerequisiteIds) > 0 {
+		if f["Prerequisites"], err = encodePrerequisites(c.PrerequisiteIds); err != nil {
+			return err
+		}
+	}
+	if len(c.ExternalIds) > 0 {
+		if f["ExternalIds"], err = encodeExternalIds(c.ExternalIds); err != nil {
+			return err
+		}
+	}
+	if c.ExpireTime != nil {
+		f["ExpireTime"] = formatTime(c.ExpireTime)
+	}
+	if c.State != pb.Class_STATE_UNSPECIFIED && c.State != pb.Class_PUBLISHED {
+		f["State"] = c.State.String()
+	}
+	f[checksumField] = f.checksum()
+	c.Etag = f[checksumField]
+	for _, field := range classFields {
+		v, ok := f[field]
+		if !ok {
+			if err := txn.Delete(classKey(c.Id, field)); err != nil {
+				return fmt.Errorf("delete %s%s%s: %w", c.Id, delim, field, err)
+			}
+			continue
+		}
+		if err := txn.Set(classKey(c.Id, field), []byte(v)); err != nil {
+			return fmt.Errorf("put %s%s%s: %w", c.Id, delim, field, err)
+		}
+	}
+	return nil
+}
+
+// deleteClassFields removes every field key of the class with the given Id.
+func deleteClassFields(txn *tenantTxn, id string) error {
+	txn.touch(id)
+	if err := unstatClass(txn, id); err != nil {
+		return err
+	}
+	for _, field := range classFields {
+		if err := txn.Delete(classKey(id, field)); err != nil {
+			return fmt.Errorf("delete %s%s%s: %w", id, delim, field, err)
+		}
+	}
+	return nil
+}
+
+// removeClass deletes the class with the given Id along with its index
+// entries, sections, enrollments and edit lease, so a class created again
+// with the Id doesn't start out held.
+func removeClass(txn *tenantTxn, id string) error {
+	if err := unindexClass(txn, id); err != nil {
+		return err
+	}
+	if err := txn.Delete(leaseKey(id)); err != nil {
+		return fmt.Errorf("delete lease for %s: %w", id, err)
+	}
+	if err := deleteClassFields(txn, id); err != nil {
+		return err
+	}
+	if err := deleteSections(txn, id); err != nil {
+		return err
+	}
+	return deleteEnrollments(txn, id)
+}
+
+// getClass reads all fields of the class with the given Id, failing with a
+// corruptionError if they don't match the stored checksum. An expired class
+// is missing, like a deleted one.
+func getClass(txn *tenantTxn, id string) (*pb.Class, error) {
+	f := storedClass{}
+	for _, field := range classFields {
+		v, err := getField(txn, id, field)
+		if err == badger.ErrKeyNotFound && field != "Name" && field != "Semester" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		f[field] = v
+	}
+	c, err := decodeClass(txn.tenant, id, f)
+	if err == nil && expired(c) {
+		return nil, badger.ErrKeyNotFound
+	}
+	return c, err
+}
+
+// classExists checks for the class key without reading its value, and for
+// an expire time that has passed.
+func classExists(txn *tenantTxn, id string) (bool, error) {
+	_, err := txn.Get(classKey(id, "Name"))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	v, err := getField(txn, id, "ExpireTime")
+	if err == badger.ErrKeyNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	t, err := parseTime(v)
+	if err != nil {
+		// Corrupt; reads report it.
+		return true, nil
+	}
+	return !expired(&pb.Class{ExpireTime: t}), nil
+}
+
+func getField(txn *tenantTxn, id, param string) (string, error) {
+	item, err := txn.Get(classKey(id, param))
+	if err != nil {
+		return "", err
+	}
+	var v string
+	err = item.Value(func(val []byte) error {
+		v = string(val)
+		return nil
+	})
+	return v, err
+}
+
+func formatTime(t *timestamppb.Timestamp) string {
+	return t.AsTime().Format(time.RFC3339Nano)
+}
+
+func parseTime(v string) (*timestamppb.Timestamp, error) {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, err
+	}
+	return timestamppb.New(t), nil
+}
+
+// unindexClass removes the index entries of the class with the given Id.
+func unindexClass(txn *tenantTxn, id string) error {
+	txn.touch(id)
+	semester, err := getField(txn, id, "Semester")
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := txn.Delete(semesterIndexKey(semester, id)); err != nil {
+		return fmt.Errorf("delete semester index for %s: %w", id, err)
+	}
+	instructor, err := getField(txn, id, "InstructorId")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if err == nil {
+		if err := txn.Delete(instructorIndexKey(instructor, id)); err != nil {
+			return fmt.Errorf("delete instructor index for %s: %w", id, err)
+		}
+	}
+	labels, err := getField(txn, id, "Labels")
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if err == nil {
+		if err := indexLabels(txn, id, labels, nil); err != nil {
+			return err
+		}
+	}
+	externalIds, err := getField(txn, id, "ExternalIds")
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return indexExternalIds(txn, id, externalIds, nil)
+}
+
+// listClasses reads every class in the database in ascending Id order,
+// leaving out classes that fail their checksum. Keys don't sort the same way
+// as Ids ("a-b.Name" comes before "a.Name"), so the classes are sorted
+// explicitly rather than relying on iteration order.
+func listClasses(txn *tenantTxn) ([]*pb.Class, error) {
+	classes, _, err := scanClasses(txn)
+	return classes, err
+}
+
+// scanClasses reads every class in the database, returning those that fail
+// their checksum separately, with their fields as stored.
+func scanClasses(txn *tenantTxn) (classes, corrupt []*pb.Class, err error) {
+	stored := make(map[string]storedClass)
+	if err := scanClassRange(txn, nil, nil, stored); err != nil {
+		return nil, nil, err
+	}
+	return decodeScanned(txn, stored)
+}
+
+// scanClassRange reads the fields of the class keys from start up to but
+// not including end into stored, by class Id. Nil bounds are open. The
+// fields of one class may straddle a bound, so ranges read into separate
+// maps must be merged field by field.
+func scanClassRange(txn *tenantTxn, start, end []byte, stored map[string]storedClass) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(classKeyPrefix)
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	if start == nil {
+		it.Rewind()
+	} else {
+		it.Seek(start)
+	}
+	for ; it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return err
+		}
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			break
+		}
+		item := it.Item()
+		k := string(it.Key()[len(opts.Prefix):])
+		// Split ID from parameter
+		id, param, ok := splitClassKey(k)
+		if !ok {
+			log.Printf("Skipping key %s%s of tenant %s: it has no field name", opts.Prefix, k, txn.tenant)
+			continue
+		}
+
+		// Determine if we've already found this Class, add a new placeholder if not
+		f, ok := stored[id]
+		if !ok {
+			f = storedClass{}
+			stored[id] = f
+		}
+
+		err := item.Value(func(v []byte) error {
+			f[param] = string(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeScanned decodes the classes scanClassRange read, in ascending Id
+// order, returning those that fail their checksum separately.
+func decodeScanned(txn *tenantTxn, stored map[string]storedClass) (classes, corrupt []*pb.Class, err error) {
+	ids := make([]string, 0, len(stored))
+	for id := range stored {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	classes = make([]*pb.Class, 0, len(ids))
+	for _, id := range ids {
+		c, err := decodeClass(txn.tenant, id, stored[id])
+		var ce *corruptionError
+		if errors.As(err, &ce) {
+			corrupt = append(corrupt, ce.stored)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if expired(c) {
+			continue
+		}
+		classes = append(classes, c)
+	}
+	return classes, corrupt, nil
+}
+
+// listSemester reads the classes of one semester through the semester index,
+// in ascending Id order since each index key ends with the Id.
+func listSemester(txn *tenantTxn, semester string) ([]*pb.Class, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = semesterIndexKey(semester, "")
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	classes := make([]*pb.Class, 0)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return classes, err
+		}
+		id := string(it.Key()[len(opts.Prefix):])
+		c, err := getClass(txn, id)
+		if isCorrupt(err) || err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return classes, fmt.Errorf("read %s: %w", id, err)
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// countClasses counts stored classes without reading any values.
+func countClasses(txn *tenantTxn) (int64, error) {
+	ids, err := listClassIds(txn)
+	return int64(len(ids)), err
+}
+
+// listClassIds returns the Id of every stored class in ascending order,
+// from the keys alone. Each class has exactly one Name key.
+func listClassIds(txn *tenantTxn) ([]string, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte(classKeyPrefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var ids []string
+	suffix := []byte(delim + "Name")
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return nil, err
+		}
+		k := it.Key()
+		if bytes.HasSuffix(k, suffix) {
+			ids = append(ids, unescapeId(string(k[len(opts.Prefix):len(k)-len(suffix)])))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// listClassPage reads one page of classes in ascending Id order, as page
+// would cut it from listClasses, along with the total number of classes.
+// Only the keys of classes outside the page are read, so a page costs the
+// same however large the values of the others are. Classes that fail their
+// checksum are left out.
+func listClassPage(txn *tenantTxn, after string, limit int) ([]*pb.Class, string, int64, error) {
+	ids, err := listClassIds(txn)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	rest := ids[sort.Search(len(ids), func(i int) bool { return ids[i] > after }):]
+	classes := make([]*pb.Class, 0, limit+1)
+	// One class past the page tells whether there is a next one.
+	for _, id := range rest {
+		if len(classes) > limit {
+			break
+		}
+		c, err := getClass(txn, id)
+		if isCorrupt(err) || err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("read %s: %w", id, err)
+		}
+		classes = append(classes, c)
+	}
+	classes, next := page(classes, "", limit)
+	return classes, next, int64(len(ids)), nil
+}
+
+// countSemester counts the entries of one semester in the semester index.
+func countSemester(txn *tenantTxn, semester string) (int64, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = semesterIndexKey(semester, "")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var n int64
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := txn.ctx.Err(); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,896 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var testDrivers = []string{driverBadger, driverFile}
+
+// forEachDriver runs test once per storage driver, with newDB opening an
+// empty database with that driver.
+func forEachDriver(t *testing.T, test func(t *testing.T, newDB func() kvDB)) {
+	for _, driver := range testDrivers {
+		driver := driver
+		t.Run(driver, func(t *testing.T) {
+			test(t, func() kvDB { return newTestDB(t, driver, t.TempDir()) })
+		})
+	}
+}
+
+func newTestDB(t *testing.T, driver, dir string) kvDB {
+	t.Helper()
+	var db kvDB
+	var err error
+	if driver == driverBadger {
+		var bdb *badger.DB
+		opts := badger.DefaultOptions(dir).WithLogger(nil)
+		bdb, err = badger.Open(opts)
+		db = badgerDB{bdb, opts}
+	} else {
+		db, err = openDB(driver, dbOptions{dir: dir})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func putTestClasses(t *testing.T, db kvDB, classes ...*pb.Class) {
+	t.Helper()
+	err := db.Update(func(txn kvTxn) error {
+		for _, c := range classes {
+			if err := putClass(newTenantTxn(txn, defaultTenant), c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ids(classes []*pb.Class) []string {
+	ids := make([]string, len(classes))
+	for i, c := range classes {
+		ids[i] = c.Id
+	}
+	return ids
+}
+
+func equalIds(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Ids chosen so that key order ("a-b.Name" < "a.Name") differs from Id order.
+var orderTestClasses = []*pb.Class{
+	{Id: "a0", Name: "Zero", Semester: "2024-FALL"},
+	{Id: "a-b", Name: "Dash", Semester: "2024-FALL"},
+	{Id: "B", Name: "Upper", Semester: "2024-FALL"},
+	{Id: "a", Name: "Plain", Semester: "2024-FALL"},
+	{Id: "ab", Name: "Two", Semester: "2025-SPRING"},
+}
+
+func TestListOrderedById(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		putTestClasses(t, db, orderTestClasses...)
+		s := &server{db: db, events: newEventBus()}
+
+		want := []string{"B", "a", "a-b", "a0", "ab"}
+		for i := 0; i < 3; i++ {
+			cs, err := s.List(context.Background(), &pb.ListRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(cs.Classes); !equalIds(got, want) {
+				t.Fatalf("List returned %v, want %v", got, want)
+			}
+		}
+	})
+}
+
+func TestListBySemesterOrderedById(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		putTestClasses(t, db, orderTestClasses...)
+		s := &server{db: db, events: newEventBus()}
+
+		cs, err := s.ListBySemester(context.Background(), &pb.ListBySemesterRequest{Semester: "2024-FALL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"B", "a", "a-b", "a0"}
+		if got := ids(cs.Classes); !equalIds(got, want) {
+			t.Fatalf("ListBySemester returned %v, want %v", got, want)
+		}
+	})
+}
+
+func TestListPagesInIdOrder(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		putTestClasses(t, db, orderTestClasses...)
+		// A class failing its checksum is left out of pages, not counted
+		// against their size.
+		err := db.Update(func(txn kvTxn) error {
+			return newTenantTxn(txn, defaultTenant).Set(classKey("a-b", "Name"), []byte("tampered"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &server{db: db, events: newEventBus()}
+
+		var pages [][]string
+		req := &pb.ListRequest{PageSize: 2}
+		for {
+			cs, err := s.List(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cs.TotalSize != 5 {
+				t.Errorf("List returned total_size %d, want 5", cs.TotalSize)
+			}
+			pages = append(pages, ids(cs.Classes))
+			if cs.NextPageToken == "" {
+				break
+			}
+			req.PageToken = cs.NextPageToken
+		}
+		want := [][]string{{"B", "a"}, {"a0", "ab"}}
+		if len(pages) != len(want) {
+			t.Fatalf("List returned pages %v, want %v", pages, want)
+		}
+		for i := range want {
+			if !equalIds(pages[i], want[i]) {
+				t.Errorf("page %d is %v, want %v", i, pages[i], want[i])
+			}
+		}
+	})
+}
+
+func TestListPageTokens(t *testing.T) {
+	s := &server{
+		db:        newTestDB(t, driverBadger, t.TempDir()),
+		events:    newEventBus(),
+		snapshots: newSnapshotRegistry(time.Minute),
+	}
+	defer s.snapshots.close()
+	ctx := context.Background()
+	putTestClasses(t, s.db,
+		&pb.Class{Id: "A", Name: "Echo", Semester: "2024-FALL"}, &pb.Class{Id: "B", Name: "Delta", Semester: "2024-FALL"},
+		&pb.Class{Id: "C", Name: "Charlie", Semester: "2024-FALL"}, &pb.Class{Id: "D", Name: "Bravo"},
+		&pb.Class{Id: "E", Name: "Alpha", Semester: "2024-FALL"},
+	)
+
+	// Tokens carry each listing on where its last page stopped, whether it
+	// holds a snapshot (List), an order (List with order_by) or neither
+	// (ListBySemester).
+	listAll := func(req *pb.ListRequest) (pages [][]string) {
+		t.Helper()
+		for {
+			cs, err := s.List(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages = append(pages, ids(cs.Classes))
+			if cs.NextPageToken == "" {
+				return pages
+			}
+			req.PageToken = cs.NextPageToken
+		}
+	}
+	pages := listAll(&pb.ListRequest{PageSize: 2})
+	if fmt.Sprint(pages) != "[[A B] [C D] [E]]" {
+		t.Errorf("List pages are %v, want [[A B] [C D] [E]]", pages)
+	}
+	if ordered := listAll(&pb.ListRequest{PageSize: 2, OrderBy: "name"}); fmt.Sprint(ordered) != "[[E D] [C B] [A]]" {
+		t.Errorf("List pages by name are %v, want [[E D] [C B] [A]]", ordered)
+	}
+	var bySemester [][]string
+	req := &pb.ListBySemesterRequest{Semester: "2024-FALL", PageSize: 3}
+	for {
+		cs, err := s.ListBySemester(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bySemester = append(bySemester, ids(cs.Classes))
+		if cs.NextPageToken == "" {
+			break
+		}
+		req.PageToken = cs.NextPageToken
+	}
+	if fmt.Sprint(bySemester) != "[[A B C] [E]]" {
+		t.Errorf("ListBySemester pages are %v, want [[A B C] [E]]", bySemester)
+	}
+
+	// Start a listing to tamper with the token of its second page.
+	cs, err := s.List(ctx, &pb.ListRequest{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := decodePageToken(cs.NextPageToken)
+	if err != nil || !strings.HasPrefix(raw, snapshotCursorMark) {
+		t.Fatalf("List returned the page token %q (%v), want a snapshot cursor", raw, err)
+	}
+	var cur snapshotCursor
+	if err := json.Unmarshal([]byte(raw[1:]), &cur); err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(change func(c *snapshotCursor)) string {
+		c := cur
+		change(&c)
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encodePageToken(snapshotCursorMark + string(b))
+	}
+	ordered, err := s.List(ctx, &pb.ListRequest{PageSize: 2, OrderBy: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		ctx   context.Context
+		req   *pb.ListRequest
+		field string
+	}{
+		{"not base64", ctx, &pb.ListRequest{PageSize: 2, PageToken: "!!!"}, "page_token"},
+		{"truncated", ctx, &pb.ListRequest{PageSize: 2, PageToken: cs.NextPageToken[:len(cs.NextPageToken)/2]}, "page_token"},
+		{"another snapshot", ctx, &pb.ListRequest{PageSize: 2, PageToken: tamper(func(c *snapshotCursor) { c.Id = strings.Repeat("0", len(c.Id)) })}, "page_token"},
+		{"another read time", ctx, &pb.ListRequest{PageSize: 2, PageToken: tamper(func(c *snapshotCursor) { c.ReadTs++ })}, "page_token"},
+		{"another tenant", tenantContext("other"), &pb.ListRequest{PageSize: 2, PageToken: cs.NextPageToken}, "page_token"},
+		{"ordered token unordered", ctx, &pb.ListRequest{PageSize: 2, PageToken: ordered.NextPageToken}, "page_token"},
+		{"ordered token reordered", ctx, &pb.ListRequest{PageSize: 2, PageToken: ordered.NextPageToken, OrderBy: "name desc"}, "page_token"},
+		{"unordered token ordered", ctx, &pb.ListRequest{PageSize: 2, PageToken: encodePageToken("B"), OrderBy: "name"}, "page_token"},
+		{"negative page size", ctx, &pb.ListRequest{PageSize: -1}, "page_size"},
+	} {
+		_, err := s.List(tt.ctx, tt.req)
+		if status.Code(err) != codes.InvalidArgument || !equalIds(badRequestFields(err), []string{tt.field}) {
+			t.Errorf("%s: List returned %v, want InvalidArgument for %s", tt.name, err, tt.field)
+		}
+	}
+	// The listing survives the tampering.
+	if cs, err = s.List(ctx, &pb.ListRequest{PageSize: 2, PageToken: cs.NextPageToken}); err != nil || !equalIds(ids(cs.Classes), []string{"C", "D"}) {
+		t.Errorf("List resumed after tampering returned %v, %v; want [C D]", cs, err)
+	}
+}
+
+func TestListPaginationModes(t *testing.T) {
+	s := &server{db: newTestDB(t, driverBadger, t.TempDir()), events: newEventBus()}
+	putTestClasses(t, s.db, &pb.Class{Id: "A"}, &pb.Class{Id: "B"}, &pb.Class{Id: "C"})
+	tests := []struct {
+		mode       string
+		maxResults int
+		pageSize   int32
+		// Classes returned, or -1 for InvalidArgument.
+		want    int
+		warning bool
+	}{
+		{paginationOptional, 0, 0, 3, false},
+		{paginationOptional, 2, 0, 2, false},
+		{paginationOptional, 2, 3, 2, false},
+		{paginationWarn, 0, 0, 3, true},
+		{paginationWarn, 0, 1, 1, false},
+		{paginationStrict, 0, 0, -1, false},
+		{paginationStrict, 0, 2, 2, false},
+	}
+	for _, tt := range tests {
+		s.setTuning(tunables{paginationMode: tt.mode, listMaxResults: tt.maxResults})
+		stream := &headerStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		cs, err := s.List(ctx, &pb.ListRequest{PageSize: tt.pageSize})
+		got := -1
+		if err == nil {
+			got = len(cs.Classes)
+		} else if status.Code(err) != codes.InvalidArgument {
+			t.Fatal(err)
+		}
+		warned := len(stream.header.Get(paginationWarningKey)) > 0
+		if got != tt.want || warned != tt.warning {
+			t.Errorf("List in %s mode with max %d and page size %d returned %d classes, warning %v; want %d, %v",
+				tt.mode, tt.maxResults, tt.pageSize, got, warned, tt.want, tt.warning)
+		}
+	}
+}
+
+// headerStream records the headers a handler sets outside a real server.
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return "" }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *headerStream) SetTrailer(md metadata.MD) error { return nil }
+
+func TestListOrderIndependentOfInsertOrder(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		forward, backward := newDB(), newDB()
+		putTestClasses(t, forward, orderTestClasses...)
+		for i := len(orderTestClasses) - 1; i >= 0; i-- {
+			putTestClasses(t, backward, orderTestClasses[i])
+		}
+
+		var got [2][]string
+		for i, db := range []kvDB{forward, backward} {
+			err := db.View(func(txn kvTxn) error {
+				classes, err := listClasses(newTenantTxn(txn, defaultTenant))
+				got[i] = ids(classes)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !equalIds(got[0], got[1]) {
+			t.Fatalf("order depends on insertion: %v vs %v", got[0], got[1])
+		}
+	})
+}
+
+func tenantContext(tenant string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenantMetadataKey, tenant))
+}
+
+func TestTenantsAreIsolated(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		s := &server{db: db, events: newEventBus(), checkInvariants: true}
+		a, b := tenantContext("district-a"), tenantContext("district-b")
+
+		for _, ctx := range []context.Context{a, b, context.Background()} {
+			if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Create(a, &pb.Class{Id: "ART100", Semester: "2024-FALL"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Delete(b, &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			name string
+			ctx  context.Context
+			want []string
+		}{
+			{"district-a", a, []string{"ART100", "MATH101"}},
+			{"district-b", b, []string{}},
+			{"default", context.Background(), []string{"MATH101"}},
+		} {
+			cs, err := s.List(tc.ctx, &pb.ListRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(cs.Classes); !equalIds(got, tc.want) || cs.TotalSize != int64(len(tc.want)) {
+				t.Errorf("%s: List returned %v (total %d), want %v", tc.name, got, cs.TotalSize, tc.want)
+			}
+			cs, err = s.ListBySemester(tc.ctx, &pb.ListBySemesterRequest{Semester: "2024-FALL"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(cs.Classes); !equalIds(got, tc.want) {
+				t.Errorf("%s: ListBySemester returned %v, want %v", tc.name, got, tc.want)
+			}
+		}
+	})
+}
+
+func TestReadsStopWhenContextEnds(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		putTestClasses(t, db, orderTestClasses...)
+		s := &server{db: db, events: newEventBus()}
+
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		for _, tc := range []struct {
+			ctx  context.Context
+			want codes.Code
+		}{
+			{cancelled, codes.Canceled},
+			{expired, codes.DeadlineExceeded},
+		} {
+			if _, err := s.List(tc.ctx, &pb.ListRequest{}); status.Code(err) != tc.want {
+				t.Errorf("List returned %v, want %s", err, tc.want)
+			}
+			if _, err := s.ListBySemester(tc.ctx, &pb.ListBySemesterRequest{Semester: "2024-FALL"}); status.Code(err) != tc.want {
+				t.Errorf("ListBySemester returned %v, want %s", err, tc.want)
+			}
+			if _, err := s.Get(tc.ctx, &pb.GetRequest{Id: "a"}); status.Code(err) != tc.want {
+				t.Errorf("Get returned %v, want %s", err, tc.want)
+			}
+		}
+
+		// A context that ends partway through a scan stops it at the next key.
+		err := db.View(func(txn kvTxn) error {
+			ttxn := newTenantTxn(txn, defaultTenant)
+			ttxn.ctx = cancelled
+			_, err := listClasses(ttxn)
+			return err
+		})
+		if err != context.Canceled {
+			t.Errorf("scan with a cancelled context returned %v", err)
+		}
+	})
+}
+
+func TestCheckInvariants(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		for _, c := range []*pb.Class{
+			{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"},
+			{Id: "MATH101", Name: "Algebra", Semester: "2025-SPRING"},
+			{Id: "MATH101", Name: "Algebra"},
+		} {
+			if _, err := s.Update(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// A write that leaves a stale index entry behind must not commit.
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("an inconsistent write didn't panic")
+				}
+			}()
+			s.update(ctx, defaultTenant, func(txn *tenantTxn) error {
+				if err := storeClass(txn, &pb.Class{Id: "ART100", Name: "Drawing", Semester: "2024-FALL"}); err != nil {
+					return err
+				}
+				return txn.Set(semesterIndexKey("2025-SPRING", "ART100"), nil)
+			})
+		}()
+		if cs, err := s.List(ctx, &pb.ListRequest{}); err != nil || len(cs.Classes) != 0 {
+			t.Errorf("List after the failed write returned %v, %v", cs, err)
+		}
+	})
+}
+
+func TestIdsWithSeparators(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		// "a.Name" would read as the Name field of "a" if stored as is, the
+		// enrollment count of "a/b" as the enrollment of b in "a", and
+		// "a%2Eb" as "a.b" if "%" weren't escaped too.
+		for _, c := range []*pb.Class{
+			{Id: "a", Name: "Plain", Semester: "2024-FALL"},
+			{Id: "a.b", Name: "Dotted", Semester: "2024-FALL"},
+			{Id: "a.Name", Name: "Field", Semester: "2024-FALL"},
+			{Id: "a.b.c", Name: "Nested"},
+			{Id: "a/b", Name: "Slashed", Semester: "2024-FALL"},
+			{Id: "a%2Eb", Name: "Escaped"},
+		} {
+			if _, err := s.Create(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Get(ctx, &pb.GetRequest{Id: c.Id})
+			if err != nil || got.Name != c.Name {
+				t.Errorf("Get(%s) returned %v, %v, want %s", c.Id, got, err, c.Name)
+			}
+		}
+		cs, err := s.List(ctx, &pb.ListRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(cs.Classes), []string{"a", "a%2Eb", "a.Name", "a.b", "a.b.c", "a/b"}; !equalIds(got, want) {
+			t.Errorf("List returned %v, want %v", got, want)
+		}
+		page, err := s.List(ctx, &pb.ListRequest{PageSize: 2})
+		if err != nil || !equalIds(ids(page.Classes), []string{"a", "a%2Eb"}) {
+			t.Errorf("List of a page returned %v, %v", page, err)
+		}
+		for _, in := range []*pb.EnrollmentRequest{{ClassId: "a", StudentId: "b"}, {ClassId: "a/b", StudentId: "s1"}} {
+			if _, err := s.Enroll(ctx, in); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := s.Delete(ctx, &pb.Class{Id: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := s.Get(ctx, &pb.GetRequest{Id: "a.b"}); err != nil || c.Name != "Dotted" {
+			t.Errorf("after deleting a, Get(a.b) returned %v, %v", c, err)
+		}
+		if es, err := s.ListEnrollments(ctx, &pb.ListEnrollmentsRequest{ClassId: "a/b"}); err != nil || len(es.Enrollments) != 1 || es.Enrollments[0].StudentId != "s1" {
+			t.Errorf("after deleting a, ListEnrollments(a/b) returned %v, %v", es, err)
+		}
+		resp, err := s.BatchDelete(ctx, &pb.DeleteFilter{IdPrefix: "a.b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.DeletedCount != 2 {
+			t.Errorf("BatchDelete of prefix a.b deleted %d classes, want 2", resp.DeletedCount)
+		}
+		if found, _, err := s.fsck(ctx, false); err != nil || found != 0 {
+			t.Errorf("fsck found %d problems (%v), want none", found, err)
+		}
+	})
+}
+
+func TestValidateOnly(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		putTestClasses(t, s.db, &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"})
+
+		c, err := s.Create(ctx, &pb.Class{Id: "ART100", Name: "Drawing", Semester: "2024-FALL", ValidateOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Name != "Drawing" || c.ValidateOnly {
+			t.Errorf("validate_only Create returned %v", c)
+		}
+		c, err = s.Update(ctx, &pb.Class{
+			Id:           "MATH101",
+			Name:         "Geometry",
+			UpdateMask:   &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+			ValidateOnly: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Name != "Geometry" || c.Semester != "2024-FALL" {
+			t.Errorf("validate_only Update returned %v, want the class as it would be stored", c)
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101", ValidateOnly: true}); err != nil {
+			t.Fatal(err)
+		}
+		cs, err := s.List(ctx, &pb.ListRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cs.Classes) != 1 || cs.Classes[0].Name != "Algebra" {
+			t.Errorf("validate_only requests changed the classes to %v", cs.Classes)
+		}
+
+		// Validation and conflicts fail the same way they would for real.
+		if err := validateRequest("/class.Adapter/Create", &pb.Class{ValidateOnly: true}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("validate_only Create of an invalid class returned %v, want InvalidArgument", err)
+		}
+		if _, err := s.AcquireEditLease(ctx, &pb.AcquireEditLeaseRequest{Id: "MATH101", Holder: "someone else"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Geometry", ValidateOnly: true}); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("validate_only Update of a leased class returned %v, want FailedPrecondition", err)
+		}
+	})
+}
+
+func TestClassDetailsRoundTrip(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		in := &pb.Class{
+			Id:             "MATH101",
+			Name:           "Algebra",
+			Semester:       "2024-FALL",
+			InstructorId:   "t-17",
+			InstructorName: "Ada Lovelace",
+			Capacity:       30,
+			Description:    "Linear equations and polynomials.",
+			Meetings: []*pb.Meeting{
+				{Day: pb.Meeting_MONDAY, StartTime: "09:00", EndTime: "10:30", Location: "Hall 2"},
+				{Day: pb.Meeting_WEDNESDAY, StartTime: "09:00", EndTime: "10:30"},
+			},
+			State: pb.Class_PUBLISHED,
+		}
+		instructors := &instructorStore{s: s}
+		if _, err := instructors.Create(ctx, &pb.Instructor{Id: "t-17", Name: "Ada Lovelace"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Create(ctx, proto.Clone(in).(*pb.Class)); err != nil {
+			t.Fatal(err)
+		}
+		c, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.CreateTime, c.UpdateTime, c.Etag = nil, nil, ""
+		if !proto.Equal(c, in) {
+			t.Errorf("Get returned %v, want %v", c, in)
+		}
+
+		// Clearing fields through an update mask removes them from storage.
+		_, err = s.Update(ctx, &pb.Class{
+			Id:         "MATH101",
+			Capacity:   25,
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"capacity", "description", "meetings"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err = s.Get(ctx, &pb.GetRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Capacity != 25 || c.Description != "" || len(c.Meetings) != 0 || c.InstructorName != "Ada Lovelace" {
+			t.Errorf("Get after a masked Update returned %v", c)
+		}
+
+		bad := []*pb.Class{
+			{Id: "MATH102", Capacity: -1},
+			{Id: "MATH102", Meetings: []*pb.Meeting{{Day: pb.Meeting_FRIDAY, StartTime: "11:00", EndTime: "10:00"}}},
+		}
+		for _, c := range bad {
+			if err := validateRequest("/class.Adapter/Create", c); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Create(%v) returned %v, want InvalidArgument", c, err)
+			}
+		}
+	})
+}
+
+func TestListOrderBy(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		putTestClasses(t, s.db, orderTestClasses...)
+
+		listAll := func(orderBy string) []string {
+			var got []string
+			token := ""
+			for {
+				cs, err := s.List(ctx, &pb.ListRequest{OrderBy: orderBy, PageSize: 2, PageToken: token})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, ids(cs.Classes)...)
+				if token = cs.NextPageToken; token == "" {
+					return got
+				}
+			}
+		}
+		tests := []struct {
+			orderBy string
+			want    []string
+		}{
+			{"name", []string{"a-b", "a", "ab", "B", "a0"}},
+			{"name desc", []string{"a0", "B", "ab", "a", "a-b"}},
+			{"semester desc", []string{"ab", "a0", "a-b", "a", "B"}},
+			{"id asc", []string{"B", "a", "a-b", "a0", "ab"}},
+		}
+		for _, tt := range tests {
+			if got := listAll(tt.orderBy); !equalIds(got, tt.want) {
+				t.Errorf("List ordered by %q returned %v, want %v", tt.orderBy, got, tt.want)
+			}
+		}
+
+		// A page token keeps its place when the class it ended on changes.
+		cs, err := s.List(ctx, &pb.ListRequest{OrderBy: "name", PageSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Delete(ctx, &pb.Class{Id: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		cs, err = s.List(ctx, &pb.ListRequest{OrderBy: "name", PageSize: 2, PageToken: cs.NextPageToken})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(cs.Classes); !equalIds(got, []string{"ab", "B"}) {
+			t.Errorf("second page after deleting the last class of the first returned %v, want [ab B]", got)
+		}
+
+		if _, err := s.List(ctx, &pb.ListRequest{OrderBy: "name desc", PageToken: cs.NextPageToken}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("List with a token from another order returned %v, want InvalidArgument", err)
+		}
+		if _, err := s.List(ctx, &pb.ListRequest{PageToken: cs.NextPageToken}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("unordered List with an ordered token returned %v, want InvalidArgument", err)
+		}
+		if err := validateRequest("/class.Adapter/List", &pb.ListRequest{OrderBy: "create_time"}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("List ordered by an unknown field returned %v, want InvalidArgument", err)
+		}
+	})
+}
+
+func TestListPagesReadOneSnapshot(t *testing.T) {
+	s := &server{
+		db:              newTestDB(t, driverBadger, t.TempDir()),
+		events:          newEventBus(),
+		checkInvariants: true,
+		snapshots:       newSnapshotRegistry(time.Minute),
+	}
+	defer s.snapshots.close()
+	ctx := context.Background()
+	putTestClasses(t, s.db,
+		&pb.Class{Id: "A"}, &pb.Class{Id: "C"}, &pb.Class{Id: "E"}, &pb.Class{Id: "G"},
+	)
+
+	cs, err := s.List(ctx, &pb.ListRequest{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the snapshot, the next page would leave out E and add F.
+	if _, err := s.Delete(ctx, &pb.Class{Id: "E"}); err != nil {
+		t.Fatal(err)
+	}
+	putTestClasses(t, s.db, &pb.Class{Id: "B"}, &pb.Class{Id: "F"})
+	cs, err = s.List(ctx, &pb.ListRequest{PageSize: 2, PageToken: cs.NextPageToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(cs.Classes); !equalIds(got, []string{"E", "G"}) || cs.NextPageToken != "" || cs.TotalSize != 4 {
+		t.Errorf("second page returned %v (total %d, next %q), want [E G] of 4 as of the first page", got, cs.TotalSize, cs.NextPageToken)
+	}
+	if n := len(s.snapshots.held); n != 0 {
+		t.Errorf("%d snapshots held after the last page, want 0", n)
+	}
+
+	// A fresh listing sees the changes.
+	cs, err = s.List(ctx, &pb.ListRequest{PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(cs.Classes); !equalIds(got, []string{"A", "B", "C", "F", "G"}) {
+		t.Errorf("fresh List returned %v", got)
+	}
+
+	// Tokens stop working once their snapshot expires.
+	s.snapshots.ttl = time.Nanosecond
+	cs, err = s.List(ctx, &pb.ListRequest{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := s.List(ctx, &pb.ListRequest{PageSize: 2, PageToken: cs.NextPageToken}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("List with an expired token returned %v, want InvalidArgument", err)
+	}
+	if _, err := s.List(tenantContext("other"), &pb.ListRequest{PageSize: 2, PageToken: cs.NextPageToken}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("List with another tenant's token returned %v, want InvalidArgument", err)
+	}
+}
+
+func TestClassExpiry(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		db := newDB()
+		s := &server{db: db, events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+
+		if err := validateRequest("/class.Adapter/Create", &pb.Class{Id: "DEMO1", Name: "Demo", ExpireTime: timestamppb.New(time.Now().Add(-time.Minute))}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Create of an expired class returned %v, want InvalidArgument", err)
+		}
+		expire := timestamppb.New(time.Now().Add(time.Hour))
+		if _, err := s.Create(ctx, &pb.Class{Id: "DEMO1", Name: "Demo", Semester: "2024-FALL", Labels: map[string]string{"trial": "yes"}, ExpireTime: expire}); err != nil {
+			t.Fatal(err)
+		}
+		// The class's index entries expire with it.
+		var indexExpiry uint64
+		db.View(func(txn kvTxn) error {
+			item, err := newTenantTxn(txn, defaultTenant).Get(semesterIndexKey("2024-FALL", "DEMO1"))
+			if err == nil {
+				indexExpiry = item.ExpiresAt()
+			}
+			return err
+		})
+		if indexExpiry != expiresAt(expire) {
+			t.Errorf("semester index expires at %d, want %d", indexExpiry, expiresAt(expire))
+		}
+		if c, err := s.Get(ctx, &pb.GetRequest{Id: "DEMO1"}); err != nil || !proto.Equal(c.ExpireTime, expire) {
+			t.Errorf("Get = %v, %v; want the expire time", c, err)
+		}
+
+		// Clearing the expire time keeps the class for good.
+		if _, err := s.Update(ctx, &pb.Class{Id: "DEMO1", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"expire_time"}}}); err != nil {
+			t.Fatal(err)
+		}
+		db.View(func(txn kvTxn) error {
+			item, err := newTenantTxn(txn, defaultTenant).Get(semesterIndexKey("2024-FALL", "DEMO1"))
+			if err == nil {
+				indexExpiry = item.ExpiresAt()
+			}
+			return err
+		})
+		if indexExpiry != 0 {
+			t.Errorf("semester index of a class that no longer expires expires at %d", indexExpiry)
+		}
+
+		// A class past its expire time is gone from every read, even while
+		// storage still holds its keys until the end of the second.
+		s.update(ctx, defaultTenant, func(txn *tenantTxn) error {
+			return storeClass(txn, &pb.Class{Id: "DEMO2", Name: "Demo", Semester: "2024-FALL", Labels: map[string]string{"trial": "yes"}, ExpireTime: timestamppb.New(time.Now().Add(-time.Millisecond))})
+		})
+		if resp, err := s.Exists(ctx, &pb.GetRequest{Id: "DEMO2"}); err != nil || resp.Exists {
+			t.Errorf("Exists of an expired class = %v, %v", resp, err)
+		}
+		if c, _ := s.Get(ctx, &pb.GetRequest{Id: "DEMO2"}); c.Name != "" {
+			t.Errorf("Get of an expired class returned %v", c)
+		}
+		if cs, err := s.List(ctx, &pb.ListRequest{}); err != nil || !equalIds(ids(cs.Classes), []string{"DEMO1"}) {
+			t.Errorf("List = %v, %v; want DEMO1 only", cs, err)
+		}
+		if cs, err := s.List(ctx, &pb.ListRequest{PageSize: 10}); err != nil || !equalIds(ids(cs.Classes), []string{"DEMO1"}) {
+			t.Errorf("List of a page = %v, %v; want DEMO1 only", cs, err)
+		}
+		if cs, err := s.ListBySemester(ctx, &pb.ListBySemesterRequest{Semester: "2024-FALL"}); err != nil || !equalIds(ids(cs.Classes), []string{"DEMO1"}) {
+			t.Errorf("ListBySemester = %v, %v; want DEMO1 only", cs, err)
+		}
+		if cs, err := s.List(ctx, &pb.ListRequest{LabelSelector: "trial=yes"}); err != nil || !equalIds(ids(cs.Classes), []string{"DEMO1"}) {
+			t.Errorf("List by label = %v, %v; want DEMO1 only", cs, err)
+		}
+	})
+}
+
+func TestGetIfNoneMatch(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true, cache: newReadCache(10)}
+		ctx := context.Background()
+		created, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra", Semester: "2024-FALL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Etag == "" || c.Etag != created.Etag {
+			t.Fatalf("Get returned etag %q, Create %q", c.Etag, created.Etag)
+		}
+
+		// Twice, the second time from the cache.
+		for i := 0; i < 2; i++ {
+			got, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101", IfNoneMatch: c.Etag})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, &pb.Class{Id: "MATH101", Etag: c.Etag}) {
+				t.Errorf("Get of an unchanged class returned %v, want only its id and etag", got)
+			}
+		}
+		if got, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101", IfNoneMatch: "stale"}); err != nil || got.Name != "Algebra" {
+			t.Errorf("Get with another etag returned %v, %v, want the class", got, err)
+		}
+
+		updated, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I", Semester: "2024-FALL"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Etag == c.Etag {
+			t.Errorf("Update kept etag %q", c.Etag)
+		}
+		got, err := s.Get(ctx, &pb.GetRequest{Id: "MATH101", IfNoneMatch: c.Etag})
+		if err != nil || got.Name != "Algebra I" || got.Etag != updated.Etag {
+			t.Errorf("Get of a changed class returned %v, %v, want Algebra I with etag %q", got, err, updated.Etag)
+		}
+	})
+}
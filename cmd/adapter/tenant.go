@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"regexp"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	tenantMetadataKey = "x-tenant-id"
+	defaultTenant     = "default"
+	// Keys of tenants other than defaultTenant live under tenant/<tenant>/.
+	// The default tenant keeps the unprefixed keys written before tenants
+	// existed.
+	tenantKeyPrefix = "tenant/"
+)
+
+// A write transaction that conflicts with a concurrent one is tried up to
+// maxWriteAttempts times in all, waiting around minConflictBackoff before
+// the second attempt and twice as long before each one after.
+const (
+	maxWriteAttempts   = 5
+	minConflictBackoff = 5 * time.Millisecond
+)
+
+var writeConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "adapter_write_conflicts_total",
+	Help: "Write transactions that conflicted with a concurrent write, by result: retried, or aborted after the last attempt.",
+}, []string{"result"})
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// tenantFromContext returns the tenant named in the caller's metadata, or
+// defaultTenant when none is given.
+func tenantFromContext(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	vs := md.Get(tenantMetadataKey)
+	if len(vs) == 0 || vs[0] == "" {
+		return defaultTenant, nil
+	}
+	var v violations
+	if !tenantPattern.MatchString(vs[0]) {
+		v.add(tenantMetadataKey, "must match %s", tenantPattern)
+	}
+	return vs[0], v.err()
+}
+
+func tenantPrefix(tenant string) []byte {
+	if tenant == defaultTenant {
+		return nil
+	}
+	return []byte(tenantKeyPrefix + tenant + "/")
+}
+
+// tenantTxn scopes a Badger transaction to one tenant: keys passed to it, and
+// keys read back through its iterators, are relative to the tenant's prefix.
+// The underlying transaction is still reachable as Txn for global keys such
+// as the outbox and webhook queues.
+type tenantTxn struct {
+	Txn    kvTxn
+	tenant string
+	// ctx is the request the transaction serves. Long scans give up with
+	// its error once it ends.
+	ctx    context.Context
+	prefix []byte
+	// Classes written or deleted, for -check-invariants; see touch.
+	written map[string]bool
+	// Changes to log and relay as the transaction commits; see record.
+	changes []*pb.ClassEvent
+	// While nonzero, keys Set expire at this Unix time, so storeClass can
+	// give a class's index entries its expiry without every index knowing.
+	expiresAt uint64
+}
+
+func newTenantTxn(txn kvTxn, tenant string) *tenantTxn {
+	return &tenantTxn{Txn: txn, tenant: tenant, ctx: context.Background(), prefix: tenantPrefix(tenant)}
+}
+
+func (t *tenantTxn) key(k []byte) []byte {
+	if len(t.prefix) == 0 {
+		return k
+	}
+	return append(append(make([]byte, 0, len(t.prefix)+len(k)), t.prefix...), k...)
+}
+
+func (t *tenantTxn) Get(key []byte) (kvItem, error) {
+	return t.Txn.Get(t.key(key))
+}
+
+func (t *tenantTxn) Set(key, val []byte) error {
+	if t.expiresAt != 0 {
+		e := badger.NewEntry(t.key(key), val)
+		e.ExpiresAt = t.expiresAt
+		return t.Txn.SetEntry(e)
+	}
+	return t.Txn.Set(t.key(key), val)
+}
+
+func (t *tenantTxn) SetEntry(e *badger.Entry) error {
+	e.Key = t.key(e.Key)
+	return t.Txn.SetEntry(e)
+}
+
+func (t *tenantTxn) Delete(key []byte) error {
+	return t.Txn.Delete(t.key(key))
+}
+
+func (t *tenantTxn) NewIterator(opt badger.IteratorOptions) *tenantIterator {
+	opt.Prefix = t.key(opt.Prefix)
+	return &tenantIterator{kvIterator: t.Txn.NewIterator(opt), prefix: t.prefix}
+}
+
+// tenantIterator iterates over one tenant's keys. Use Key rather than
+// Item().Key() to get keys without the tenant prefix.
+type tenantIterator struct {
+	kvIterator
+	prefix []byte
+}
+
+func (it *tenantIterator) key(k []byte) []byte {
+	return append(append(make([]byte, 0, len(it.prefix)+len(k)), it.prefix...), k...)
+}
+
+func (it *tenantIterator) Seek(key []byte) {
+	it.kvIterator.Seek(it.key(key))
+}
+
+func (it *tenantIterator) ValidForPrefix(prefix []byte) bool {
+	return it.kvIterator.ValidForPrefix(it.key(prefix))
+}
+
+// Key returns the current key relative to the tenant prefix.
+func (it *tenantIterator) Key() []byte {
+	return it.Item().Key()[len(it.prefix):]
+}
+
+// view and update run fn in a transaction scoped to tenant, on behalf of
+// the request ctx. Neither starts once ctx has ended, and both fail with its
+// error if it ends while fn runs, since fn's scans may have stopped short.
+func (s *server) view(ctx context.Context, tenant string, fn func(txn *tenantTxn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.View(func(txn kvTxn) error {
+		t := newTenantTxn(txn, tenant)
+		t.ctx = ctx
+		if err := fn(t); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+}
+
+// update fails with FailedPrecondition while the tenant is being offboarded.
+// The changes fn records are logged and queued for the event relay in its
+// transaction. A transaction that conflicts with a concurrent write is run
+// again, with fn starting over, up to maxWriteAttempts times in all before
+// update returns badger.ErrConflict, which storageError makes Aborted.
+// With -check-invariants it panics rather than commit a class whose derived
+// data is inconsistent.
+func (s *server) update(ctx context.Context, tenant string, fn func(txn *tenantTxn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	release, err := s.offboarding.enter(tenant)
+	if err != nil {
+		return err
+	}
+	defer release()
+	backoff := minConflictBackoff
+	for attempt := 1; ; attempt++ {
+		err = s.tryUpdate(ctx, tenant, fn)
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+		if attempt == maxWriteAttempts {
+			writeConflicts.WithLabelValues("aborted").Inc()
+			return err
+		}
+		writeConflicts.WithLabelValues("retried").Inc()
+		// Jitter keeps the writes that conflicted from meeting again.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))):
+		}
+		backoff *= 2
+	}
+}
+
+// tryUpdate runs fn in one transaction for update.
+func (s *server) tryUpdate(ctx context.Context, tenant string, fn func(txn *tenantTxn) error) error {
+	unlock := func() {}
+	err := s.db.Update(func(txn kvTxn) error {
+		t := newTenantTxn(txn, tenant)
+		t.ctx = ctx
+		if err := fn(t); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.checkInvariants {
+			assertInvariants(t)
+		}
+		if len(t.changes) > 0 {
+			unlock = s.changelog.lock()
+		}
+		for _, e := range t.changes {
+			if err := s.changelog.add(t, e); err != nil {
+				return err
+			}
+			if err := s.outbox.add(txn, e); err != nil {
+				return err
+			}
+			if err := s.webhooks.add(txn, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	unlock()
+	if err == nil {
+		s.cache.invalidate(tenant)
+	}
+	return err
+}
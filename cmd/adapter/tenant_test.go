@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// conflictingDB fails its next conflicts write transactions with
+// badger.ErrConflict after running them, as Badger does when a concurrent
+// write commits first.
+type conflictingDB struct {
+	kvDB
+	conflicts int
+	attempts  int
+}
+
+func (db *conflictingDB) Update(fn func(txn kvTxn) error) error {
+	db.attempts++
+	if db.conflicts == 0 {
+		return db.kvDB.Update(fn)
+	}
+	db.conflicts--
+	return db.kvDB.Update(func(txn kvTxn) error {
+		if err := fn(txn); err != nil {
+			return err
+		}
+		return badger.ErrConflict
+	})
+}
+
+func TestUpdateRetriesConflicts(t *testing.T) {
+	db := &conflictingDB{kvDB: newTestDB(t, driverBadger, t.TempDir()), conflicts: 2}
+	s := &server{db: db, events: newEventBus()}
+	ctx := context.Background()
+	if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+		t.Fatal(err)
+	}
+	if db.attempts != 3 {
+		t.Errorf("Create took %d attempts, want 3", db.attempts)
+	}
+	if c, _ := s.Get(ctx, &pb.GetRequest{Id: "MATH101"}); c.Name != "Algebra" {
+		t.Errorf("class is %v after conflicts were retried", c)
+	}
+
+	db.conflicts, db.attempts = maxWriteAttempts, 0
+	_, err := s.Update(ctx, &pb.Class{Id: "MATH101", Name: "Algebra I"})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("Update conflicting on every attempt got %v, want Aborted", err)
+	}
+	var retry bool
+	for _, d := range status.Convert(err).Details() {
+		_, retry = d.(*errdetails.RetryInfo)
+	}
+	if !retry {
+		t.Errorf("Aborted error %v lacks RetryInfo", err)
+	}
+	if db.attempts != maxWriteAttempts {
+		t.Errorf("Update took %d attempts, want %d", db.attempts, maxWriteAttempts)
+	}
+	if c, _ := s.Get(ctx, &pb.GetRequest{Id: "MATH101"}); c.Name != "Algebra" {
+		t.Errorf("class is %v after an aborted update", c)
+	}
+}
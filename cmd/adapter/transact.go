@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Most operations a Transact call may apply; the whole call has to fit in
+// one Badger transaction.
+const maxTransactOps = 100
+
+func (v *violations) checkTransact(in *pb.TransactRequest) {
+	switch {
+	case len(in.Ops) == 0:
+		v.add("ops", "must not be empty")
+	case len(in.Ops) > maxTransactOps:
+		v.add("ops", "must have at most %d operations", maxTransactOps)
+	}
+	for i, op := range in.Ops {
+		switch op := op.Op.(type) {
+		case *pb.TransactOp_Create:
+			v.within(fmt.Sprintf("ops[%d].create", i), func(v *violations) {
+				v.checkClass(op.Create)
+			})
+		case *pb.TransactOp_Update:
+			v.within(fmt.Sprintf("ops[%d].update", i), func(v *violations) {
+				v.checkUpdate(op.Update)
+			})
+		case *pb.TransactOp_Delete:
+			v.within(fmt.Sprintf("ops[%d].delete", i), func(v *violations) {
+				v.checkId(op.Delete.Id)
+			})
+		default:
+			v.add(fmt.Sprintf("ops[%d]", i), "must set create, update or delete")
+		}
+	}
+}
+
+// transactOpError names the operation a status error came from, keeping
+// its details.
+func transactOpError(i int, err error) error {
+	if !isStatusError(err) {
+		return err
+	}
+	st := status.Convert(err)
+	var details []proto.Message
+	for _, d := range st.Details() {
+		if m, ok := d.(proto.Message); ok {
+			details = append(details, m)
+		}
+	}
+	return withDetails(status.Newf(st.Code(), "ops[%d]: %s", i, st.Message()), details...).Err()
+}
+
+// transactCreate stores c as Create would and returns the class it
+// replaced, if any.
+func transactCreate(txn *tenantTxn, c *pb.Class) (*pb.Class, error) {
+	token := c.LeaseToken
+	c.LeaseToken = ""
+	c.ValidateOnly = false
+	old, err := allowCorrupt(getClass(txn, c.Id))
+	if err != nil && err != badger.ErrKeyNotFound {
+		return nil, err
+	}
+	if old != nil {
+		if err := checkEditLease(txn, c.Id, token); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkReferences(txn, c); err != nil {
+		return nil, err
+	}
+	return old, putClass(txn, c)
+}
+
+// transactUpdate stores in as Update would and returns the stored class
+// and the one it replaced.
+func transactUpdate(txn *tenantTxn, in *pb.Class) (c, old *pb.Class, err error) {
+	paths := in.UpdateMask.GetPaths()
+	if err := checkEditLease(txn, in.Id, in.LeaseToken); err != nil {
+		return nil, nil, err
+	}
+	in.LeaseToken = ""
+	in.UpdateMask = nil
+	in.ValidateOnly = false
+	old, err = getClass(txn, in.Id)
+	if len(paths) == 0 {
+		old, err = allowCorrupt(old, err)
+	}
+	if err != nil && err != badger.ErrKeyNotFound {
+		return nil, nil, err
+	}
+	if len(paths) > 0 {
+		if old == nil {
+			return nil, nil, status.Errorf(codes.NotFound, "class %s not found", in.Id)
+		}
+		in = applyUpdateMask(proto.Clone(old).(*pb.Class), in, paths)
+	}
+	if err := checkReferences(txn, in); err != nil {
+		return nil, nil, err
+	}
+	return in, old, putClass(txn, in)
+}
+
+// transactDelete removes a class as Delete would and returns it, or nil if
+// there was none.
+func transactDelete(txn *tenantTxn, id, token string) (*pb.Class, error) {
+	old, err := allowCorrupt(getClass(txn, id))
+	if err != nil && err != badger.ErrKeyNotFound {
+		return nil, err
+	}
+	if err := checkEditLease(txn, id, token); err != nil {
+		return nil, err
+	}
+	return old, removeClass(txn, id)
+}
+
+func (s *server) Transact(ctx context.Context, in *pb.TransactRequest) (*pb.TransactResponse, error) {
+	logf(ctx, "Transact called with %d operations", len(in.Ops))
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out *pb.TransactResponse
+	var events []*pb.ClassEvent
+	err = s.update(ctx, tenant, func(txn *tenantTxn) error {
+		out, events = &pb.TransactResponse{}, nil
+		for i, op := range in.Ops {
+			var method string
+			var c, old *pb.Class
+			var t pb.ClassEvent_Type
+			var err error
+			switch op := op.Op.(type) {
+			case *pb.TransactOp_Create:
+				method, t = "Create", pb.ClassEvent_CREATED
+				c = proto.Clone(op.Create).(*pb.Class)
+				old, err = transactCreate(txn, c)
+			case *pb.TransactOp_Update:
+				method, t = "Update", pb.ClassEvent_UPDATED
+				c, old, err = transactUpdate(txn, proto.Clone(op.Update).(*pb.Class))
+			case *pb.TransactOp_Delete:
+				method, t = "Delete", pb.ClassEvent_DELETED
+				old, err = transactDelete(txn, op.Delete.Id, op.Delete.LeaseToken)
+			}
+			if err != nil {
+				return transactOpError(i, err)
+			}
+			switch {
+			case c != nil:
+				out.Results = append(out.Results, c)
+			case old != nil:
+				out.Results = append(out.Results, old)
+			default:
+				out.Results = append(out.Results, &pb.Class{Id: op.GetDelete().Id})
+			}
+			if in.ValidateOnly || (c == nil && old == nil) {
+				continue
+			}
+			var stored *pb.Class
+			if c != nil {
+				stored = proto.Clone(c).(*pb.Class)
+			}
+			if err := s.audit.record(ctx, txn, method, out.Results[i].Id, old, stored); err != nil {
+				return err
+			}
+			e := newClassEvent(t, tenant, proto.Clone(out.Results[i]).(*pb.Class))
+			txn.record(e)
+			events = append(events, e)
+		}
+		if in.ValidateOnly {
+			return errValidateOnly
+		}
+		return nil
+	})
+	if err == errValidateOnly {
+		return out, nil
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	for _, c := range out.Results {
+		s.forgetRead(tenant, c.Id)
+	}
+	for _, e := range events {
+		s.emit(e)
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestTransact(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, newDB func() kvDB) {
+		s := &server{db: newDB(), events: newEventBus(), checkInvariants: true}
+		ctx := context.Background()
+		putTestClasses(t, s.db,
+			&pb.Class{Id: "ART100", Name: "Drawing", Semester: "2024-FALL"},
+			&pb.Class{Id: "MATH101", Name: "Calculus", Semester: "2025-SPRING"},
+		)
+		semester := func(id string) string {
+			c, err := s.Get(ctx, &pb.GetRequest{Id: id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c.Semester
+		}
+		mask := &fieldmaskpb.FieldMask{Paths: []string{"semester"}}
+
+		// Swap the semesters of two classes.
+		resp, err := s.Transact(ctx, &pb.TransactRequest{Ops: []*pb.TransactOp{
+			{Op: &pb.TransactOp_Update{Update: &pb.Class{Id: "ART100", Semester: "2025-SPRING", UpdateMask: mask}}},
+			{Op: &pb.TransactOp_Update{Update: &pb.Class{Id: "MATH101", Semester: "2024-FALL", UpdateMask: mask}}},
+			{Op: &pb.TransactOp_Create{Create: &pb.Class{Id: "PHYS101", Name: "Mechanics", Semester: "2024-FALL", PrerequisiteIds: []string{"MATH101"}}}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Results) != 3 || resp.Results[0].Name != "Drawing" {
+			t.Errorf("Transact returned %v, want the three stored classes", resp.Results)
+		}
+		if a, m := semester("ART100"), semester("MATH101"); a != "2025-SPRING" || m != "2024-FALL" {
+			t.Errorf("after the swap ART100 is in %s and MATH101 in %s", a, m)
+		}
+
+		// A failing operation rolls back the ones before it.
+		_, err = s.Transact(ctx, &pb.TransactRequest{Ops: []*pb.TransactOp{
+			{Op: &pb.TransactOp_Delete{Delete: &pb.Class{Id: "ART100"}}},
+			{Op: &pb.TransactOp_Update{Update: &pb.Class{Id: "NOPE", Name: "x", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}}}},
+		}})
+		if status.Code(err) != codes.NotFound || status.Convert(err).Message() != "ops[1]: class NOPE not found" {
+			t.Errorf("Transact with a failing update returned %v, want NotFound for ops[1]", err)
+		}
+		if _, err := s.Get(ctx, &pb.GetRequest{Id: "ART100"}); err != nil {
+			t.Errorf("ART100 was deleted by a failed Transact: %v", err)
+		}
+
+		// validate_only stores nothing.
+		_, err = s.Transact(ctx, &pb.TransactRequest{ValidateOnly: true, Ops: []*pb.TransactOp{
+			{Op: &pb.TransactOp_Delete{Delete: &pb.Class{Id: "ART100"}}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get(ctx, &pb.GetRequest{Id: "ART100"}); err != nil {
+			t.Errorf("validate_only Transact deleted ART100: %v", err)
+		}
+
+		for _, in := range []*pb.TransactRequest{
+			{},
+			{Ops: []*pb.TransactOp{{}}},
+			{Ops: []*pb.TransactOp{{Op: &pb.TransactOp_Create{Create: &pb.Class{Id: "BAD", Semester: "someday"}}}}},
+		} {
+			if err := validateRequest("/class.Adapter/Transact", in); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Transact(%v) returned %v, want InvalidArgument", in, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Prefixes of the adapter.v2 resource names.
+const (
+	classResourcePrefix      = "classes/"
+	instructorResourcePrefix = "instructors/"
+)
+
+// v2ClassPaths maps the paths of an adapter.v2 update mask to those of a
+// class.Class one.
+var v2ClassPaths = map[string]string{
+	"display_name":            "name",
+	"semester":                "semester",
+	"instructor":              "instructor_id",
+	"instructor_display_name": "instructor_name",
+	"capacity":                "capacity",
+	"description":             "description",
+	"meetings":                "meetings",
+	"labels":                  "labels",
+	"prerequisites":           "prerequisite_ids",
+	"external_ids":            "external_ids",
+	"expire_time":             "expire_time",
+}
+
+// classesV2 serves the adapter.v2 Classes service by translating its calls
+// to the server's own, so both APIs share validation, storage, the audit
+// log and change events.
+type classesV2 struct {
+	adapterv2.UnimplementedClassesServer
+	s *server
+}
+
+// resourceId returns the Id at the end of name, a resource name starting
+// with prefix, reporting a malformed name as field.
+func (v *violations) resourceId(field, prefix, name string) string {
+	id := strings.TrimPrefix(name, prefix)
+	if id == name || id == "" {
+		v.add(field, "must be of the form %s{id}", prefix)
+		return ""
+	}
+	return id
+}
+
+func classToV2(c *pb.Class) *adapterv2.Class {
+	out := &adapterv2.Class{
+		Name:                  classResourcePrefix + c.Id,
+		DisplayName:           c.Name,
+		Semester:              c.Semester,
+		InstructorDisplayName: c.InstructorName,
+		Capacity:              c.Capacity,
+		Description:           c.Description,
+		Labels:                c.Labels,
+		ExternalIds:           c.ExternalIds,
+		CreateTime:            c.CreateTime,
+		UpdateTime:            c.UpdateTime,
+		ExpireTime:            c.ExpireTime,
+	}
+	if c.InstructorId != "" {
+		out.Instructor = instructorResourcePrefix + c.InstructorId
+	}
+	for _, m := range c.Meetings {
+		out.Meetings = append(out.Meetings, &adapterv2.Meeting{
+			Day:       adapterv2.Meeting_Day(m.Day),
+			StartTime: m.StartTime,
+			EndTime:   m.EndTime,
+			Location:  m.Location,
+		})
+	}
+	for _, id := range c.PrerequisiteIds {
+		out.Prerequisites = append(out.Prerequisites, classResourcePrefix+id)
+	}
+	return out
+}
+
+// classFromV2 converts c, reporting malformed resource names in v. The
+// class's Id is left for the caller to set.
+func classFromV2(v *violations, c *adapterv2.Class) *pb.Class {
+	out := &pb.Class{
+		Name:           c.DisplayName,
+		Semester:       c.Semester,
+		InstructorName: c.InstructorDisplayName,
+		Capacity:       c.Capacity,
+		Description:    c.Description,
+		Labels:         c.Labels,
+		ExternalIds:    c.ExternalIds,
+		ExpireTime:     c.ExpireTime,
+	}
+	if c.Instructor != "" {
+		out.InstructorId = v.resourceId("class.instructor", instructorResourcePrefix, c.Instructor)
+	}
+	for _, m := range c.Meetings {
+		out.Meetings = append(out.Meetings, &pb.Meeting{
+			Day:       pb.Meeting_Day(m.Day),
+			StartTime: m.StartTime,
+			EndTime:   m.EndTime,
+			Location:  m.Location,
+		})
+	}
+	for i, name := range c.Prerequisites {
+		field := fmt.Sprintf("class.prerequisites[%d]", i)
+		out.PrerequisiteIds = append(out.PrerequisiteIds, v.resourceId(field, classResourcePrefix, name))
+	}
+	return out
+}
+
+// createFromV2 returns the class a CreateClass request creates, reporting
+// what makes the request malformed in v.
+func createFromV2(v *violations, in *adapterv2.CreateClassRequest) *pb.Class {
+	if in.Class == nil {
+		v.add("class", "is required")
+		return nil
+	}
+	c := classFromV2(v, in.Class)
+	c.Id = in.ClassId
+	c.ValidateOnly = in.ValidateOnly
+	return c
+}
+
+// updateFromV2 returns the class.Class update an UpdateClass request makes,
+// reporting what makes the request malformed in v.
+func updateFromV2(v *violations, in *adapterv2.UpdateClassRequest) *pb.Class {
+	if in.Class == nil {
+		v.add("class", "is required")
+		return nil
+	}
+	id := v.resourceId("class.name", classResourcePrefix, in.Class.Name)
+	c := classFromV2(v, in.Class)
+	c.Id = id
+	c.UpdateMask = &fieldmaskpb.FieldMask{Paths: v2UpdatePaths(v, in.Class, in.UpdateMask)}
+	c.LeaseToken = in.LeaseToken
+	c.ValidateOnly = in.ValidateOnly
+	return c
+}
+
+// v2UpdatePaths returns the class.Class update mask paths of an adapter.v2
+// update: the mask's paths, every field for "*", or the fields set in c if
+// the mask is empty.
+func v2UpdatePaths(v *violations, c *adapterv2.Class, mask *fieldmaskpb.FieldMask) []string {
+	var paths []string
+	switch p := mask.GetPaths(); {
+	case len(p) == 1 && p[0] == "*":
+		for _, path := range v2ClassPaths {
+			paths = append(paths, path)
+		}
+	case len(p) > 0:
+		for _, path := range p {
+			v1, ok := v2ClassPaths[path]
+			if !ok {
+				v.add("update_mask", "unknown field %q", path)
+				continue
+			}
+			paths = append(paths, v1)
+		}
+	default:
+		c.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if v1, ok := v2ClassPaths[string(fd.Name())]; ok {
+				paths = append(paths, v1)
+			}
+			return true
+		})
+		if len(paths) == 0 {
+			v.add("update_mask", "names no fields, and class sets none to update")
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// v2OrderBy converts an adapter.v2 order_by to a class.ListRequest one.
+func v2OrderBy(orderBy string) (string, bool) {
+	parts := strings.Fields(orderBy)
+	if len(parts) == 0 {
+		return "", true
+	}
+	switch parts[0] {
+	case "id", "semester":
+	case "display_name":
+		parts[0] = "name"
+	default:
+		return "", false
+	}
+	return strings.Join(parts, " "), true
+}
+
+func (cs *classesV2) ListClasses(ctx context.Context, in *adapterv2.ListClassesRequest) (*adapterv2.ListClassesResponse, error) {
+	logf(ctx, "Classes.ListClasses called")
+	orderBy, _ := v2OrderBy(in.OrderBy)
+	classes, err := cs.s.List(ctx, &pb.ListRequest{
+		PageSize:      in.PageSize,
+		PageToken:     in.PageToken,
+		LabelSelector: in.LabelSelector,
+		OrderBy:       orderBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &adapterv2.ListClassesResponse{
+		Classes:       make([]*adapterv2.Class, 0, len(classes.Classes)),
+		NextPageToken: classes.NextPageToken,
+		TotalSize:     classes.TotalSize,
+	}
+	for _, c := range classes.Classes {
+		resp.Classes = append(resp.Classes, classToV2(c))
+	}
+	return resp, nil
+}
+
+func (cs *classesV2) GetClass(ctx context.Context, in *adapterv2.GetClassRequest) (*adapterv2.Class, error) {
+	logf(ctx, "Classes.GetClass called for %s", in.Name)
+	id := strings.TrimPrefix(in.Name, classResourcePrefix)
+	tenant, err := tenantFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var c *pb.Class
+	err = cs.s.view(ctx, tenant, func(txn *tenantTxn) error {
+		c, err = getClass(txn, id)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, status.Errorf(codes.NotFound, "class %s not found", id)
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return classToV2(c), nil
+}
+
+func (cs *classesV2) CreateClass(ctx context.Context, in *adapterv2.CreateClassRequest) (*adapterv2.Class, error) {
+	logf(ctx, "Classes.CreateClass called for Id %s", in.ClassId)
+	c, err := cs.s.create(ctx, createFromV2(&violations{}, in), false)
+	if err != nil {
+		return nil, err
+	}
+	return classToV2(c), nil
+}
+
+func (cs *classesV2) UpdateClass(ctx context.Context, in *adapterv2.UpdateClassRequest) (*adapterv2.Class, error) {
+	logf(ctx, "Classes.UpdateClass called for %s", in.Class.GetName())
+	c, err := cs.s.Update(ctx, updateFromV2(&violations{}, in))
+	if err != nil {
+		return nil, err
+	}
+	return classToV2(c), nil
+}
+
+func (cs *classesV2) DeleteClass(ctx context.Context, in *adapterv2.DeleteClassRequest) (*emptypb.Empty, error) {
+	logf(ctx, "Classes.DeleteClass called for %s", in.Name)
+	id := strings.TrimPrefix(in.Name, classResourcePrefix)
+	if _, err := cs.s.delete(ctx, &pb.Class{Id: id, LeaseToken: in.LeaseToken, ValidateOnly: in.ValidateOnly}, in.AllowMissing); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
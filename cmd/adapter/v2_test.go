@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	adapterv2 "github.com/virtual-class-tutor/class-adapter-file/proto/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestClassesV2(t *testing.T) {
+	s := &server{db: newTestDB(t, driverBadger, t.TempDir()), events: newEventBus()}
+	cs := &classesV2{s: s}
+	ctx := context.Background()
+
+	created, err := cs.CreateClass(ctx, &adapterv2.CreateClassRequest{
+		ClassId: "MATH101",
+		Class:   &adapterv2.Class{DisplayName: "Algebra", Semester: "2024-FALL", Capacity: 30},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "classes/MATH101" || created.CreateTime == nil {
+		t.Errorf("CreateClass returned %v", created)
+	}
+	if _, err := cs.CreateClass(ctx, &adapterv2.CreateClassRequest{ClassId: "MATH101", Class: &adapterv2.Class{DisplayName: "Again"}}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("creating MATH101 twice got %v, want AlreadyExists", err)
+	}
+	if err := validateRequest("/adapter.v2.Classes/CreateClass", &adapterv2.CreateClassRequest{
+		ClassId: "MATH201",
+		Class:   &adapterv2.Class{DisplayName: "Calculus", Prerequisites: []string{"MATH101"}},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("prerequisite without classes/ got %v, want InvalidArgument", err)
+	}
+	if _, err := cs.CreateClass(ctx, &adapterv2.CreateClassRequest{
+		ClassId: "MATH201",
+		Class:   &adapterv2.Class{DisplayName: "Calculus", Prerequisites: []string{"classes/MATH101"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the fields set change when there's no mask.
+	updated, err := cs.UpdateClass(ctx, &adapterv2.UpdateClassRequest{
+		Class: &adapterv2.Class{Name: "classes/MATH101", DisplayName: "Algebra I"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.DisplayName != "Algebra I" || updated.Capacity != 30 {
+		t.Errorf("UpdateClass returned %v, want the new display name and the old capacity", updated)
+	}
+	if err := validateRequest("/adapter.v2.Classes/UpdateClass", &adapterv2.UpdateClassRequest{
+		Class:      &adapterv2.Class{Name: "classes/MATH101"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("mask naming the resource name got %v, want InvalidArgument", err)
+	}
+	if _, err := cs.UpdateClass(ctx, &adapterv2.UpdateClassRequest{
+		Class: &adapterv2.Class{Name: "classes/CHEM101", DisplayName: "Chemistry"},
+	}); status.Code(err) != codes.NotFound {
+		t.Errorf("updating a missing class got %v, want NotFound", err)
+	}
+
+	// v1 sees v2's writes.
+	if c, _ := s.Get(ctx, &pb.GetRequest{Id: "MATH201"}); c.Name != "Calculus" || !equalIds(c.PrerequisiteIds, []string{"MATH101"}) {
+		t.Errorf("v1 Get returned %v", c)
+	}
+
+	list, err := cs.ListClasses(ctx, &adapterv2.ListClassesRequest{OrderBy: "display_name desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range list.Classes {
+		names = append(names, c.Name)
+	}
+	if !equalIds(names, []string{"classes/MATH201", "classes/MATH101"}) || list.TotalSize != 2 {
+		t.Errorf("ListClasses returned %v, total %d", names, list.TotalSize)
+	}
+	if err := validateRequest("/adapter.v2.Classes/ListClasses", &adapterv2.ListClassesRequest{OrderBy: "name"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("order_by name got %v, want InvalidArgument", err)
+	}
+
+	if _, err := cs.DeleteClass(ctx, &adapterv2.DeleteClassRequest{Name: "classes/MATH201"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.GetClass(ctx, &adapterv2.GetClassRequest{Name: "classes/MATH201"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetClass after DeleteClass got %v, want NotFound", err)
+	}
+	if _, err := cs.DeleteClass(ctx, &adapterv2.DeleteClassRequest{Name: "classes/MATH201"}); status.Code(err) != codes.NotFound {
+		t.Errorf("deleting a missing class got %v, want NotFound", err)
+	}
+	if _, err := cs.DeleteClass(ctx, &adapterv2.DeleteClassRequest{Name: "classes/MATH201", AllowMissing: true}); err != nil {
+		t.Errorf("deleting a missing class with allow_missing got %v", err)
+	}
+}
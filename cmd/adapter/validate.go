@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxIdLength          = 128
+	maxNameLength        = 256
+	maxSemesterLength    = 32
+	maxDescriptionLength = 4096
+)
+
+// Semesters are a four digit year followed by the term, e.g. 2024-FALL.
+var semesterPattern = regexp.MustCompile(`^[0-9]{4}-(SPRING|SUMMER|FALL|WINTER)$`)
+
+// violations collects field-level validation failures for a single request.
+type violations []*errdetails.BadRequest_FieldViolation
+
+func (v *violations) add(field, format string, a ...interface{}) {
+	*v = append(*v, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, a...),
+	})
+}
+
+// err returns an InvalidArgument status carrying the collected violations as
+// BadRequest details, or nil if there were none.
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(v))
+	for i, fv := range v {
+		msgs[i] = fv.Field + ": " + fv.Description
+	}
+	st := status.New(codes.InvalidArgument, "invalid request: "+strings.Join(msgs, "; "))
+	return withDetails(st, &errdetails.BadRequest{FieldViolations: v}).Err()
+}
+
+// within adds the violations check finds under prefix, so nested messages
+// report fields such as "sections[0].id".
+func (v *violations) within(prefix string, check func(v *violations)) {
+	var inner violations
+	check(&inner)
+	for _, fv := range inner {
+		fv.Field = prefix + "." + fv.Field
+		*v = append(*v, fv)
+	}
+}
+
+func (v *violations) checkId(id string) {
+	v.checkIdAs("id", id)
+}
+
+// checkIdAs applies the class Id rules to an Id held in another field.
+func (v *violations) checkIdAs(field, id string) {
+	switch {
+	case id == "":
+		v.add(field, "must not be empty")
+	case len(id) > maxIdLength:
+		v.add(field, "must be at most %d characters", maxIdLength)
+	}
+}
+
+func (v *violations) checkName(name string) {
+	if len(name) > maxNameLength {
+		v.add("name", "must be at most %d characters", maxNameLength)
+	}
+}
+
+func (v *violations) checkSemester(semester string) {
+	if len(semester) > maxSemesterLength {
+		v.add("semester", "must be at most %d characters", maxSemesterLength)
+	} else if semester != "" && !semesterPattern.MatchString(semester) {
+		v.add("semester", "must match %s, e.g. 2024-FALL", semesterPattern)
+	}
+}
+
+func (v *violations) checkInstructorId(id string) {
+	switch {
+	case len(id) > maxIdLength:
+		v.add("instructor_id", "must be at most %d characters", maxIdLength)
+	case strings.Contains(id, delim):
+		v.add("instructor_id", "must not contain %q", delim)
+	}
+}
+
+func (v *violations) checkInstructorName(name string) {
+	if len(name) > maxNameLength {
+		v.add("instructor_name", "must be at most %d characters", maxNameLength)
+	}
+}
+
+func (v *violations) checkCapacity(capacity int32) {
+	if capacity < 0 {
+		v.add("capacity", "must not be negative")
+	}
+}
+
+func (v *violations) checkDescription(desc string) {
+	if len(desc) > maxDescriptionLength {
+		v.add("description", "must be at most %d characters", maxDescriptionLength)
+	}
+}
+
+// checkExpireTime accepts no expire time, or one in the future: a class
+// written already expired would be gone before the call returned.
+func (v *violations) checkExpireTime(t *timestamppb.Timestamp) {
+	switch {
+	case t == nil:
+	case t.CheckValid() != nil:
+		v.add("expire_time", "must be a valid time")
+	case !t.AsTime().After(time.Now()):
+		v.add("expire_time", "must be in the future")
+	}
+}
+
+func validateId(id string) error {
+	var v violations
+	v.checkId(id)
+	return v.err()
+}
+
+func validateClass(c *pb.Class) error {
+	var v violations
+	v.checkClass(c)
+	return v.err()
+}
+
+func (v *violations) checkClass(c *pb.Class) {
+	v.checkId(c.Id)
+	v.checkName(c.Name)
+	v.checkSemester(c.Semester)
+	v.checkInstructorId(c.InstructorId)
+	v.checkInstructorName(c.InstructorName)
+	v.checkCapacity(c.Capacity)
+	v.checkDescription(c.Description)
+	v.checkMeetings(c.Meetings)
+	v.checkLabels(c.Labels)
+	v.checkPrerequisites(c.Id, c.PrerequisiteIds)
+	v.checkExternalIds(c.ExternalIds)
+	v.checkExpireTime(c.ExpireTime)
+}
+
+// validateUpdate validates c as an Update request, checking only the fields
+// named in its update mask when it has one.
+func validateUpdate(c *pb.Class) error {
+	var v violations
+	v.checkUpdate(c)
+	return v.err()
+}
+
+func (v *violations) checkUpdate(c *pb.Class) {
+	paths := c.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		v.checkClass(c)
+		return
+	}
+	v.checkId(c.Id)
+	for _, p := range paths {
+		switch p {
+		case "name":
+			v.checkName(c.Name)
+		case "semester":
+			v.checkSemester(c.Semester)
+		case "instructor_id":
+			v.checkInstructorId(c.InstructorId)
+		case "instructor_name":
+			v.checkInstructorName(c.InstructorName)
+		case "capacity":
+			v.checkCapacity(c.Capacity)
+		case "description":
+			v.checkDescription(c.Description)
+		case "meetings":
+			v.checkMeetings(c.Meetings)
+		case "labels":
+			v.checkLabels(c.Labels)
+		case "prerequisite_ids":
+			v.checkPrerequisites(c.Id, c.PrerequisiteIds)
+		case "external_ids":
+			v.checkExternalIds(c.ExternalIds)
+		case "expire_time":
+			v.checkExpireTime(c.ExpireTime)
+		default:
+			v.add("update_mask", "unknown field %q", p)
+		}
+	}
+}
+
+// checkRequiredSemester checks a semester that must be given.
+func (v *violations) checkRequiredSemester(semester string) {
+	if semester == "" {
+		v.add("semester", "must not be empty")
+	}
+	v.checkSemester(semester)
+}
+
+func (v *violations) checkListRequest(in *pb.ListRequest) {
+	if _, err := parseLabelSelector(in.LabelSelector); err != nil {
+		v.add("label_selector", "%s", err)
+	}
+	if _, ok := parseOrderBy(in.OrderBy); !ok {
+		v.add("order_by", "must be one of id, name or semester, optionally followed by asc or desc")
+	}
+	for i, st := range in.States {
+		v.checkState(fmt.Sprintf("states[%d]", i), st)
+	}
+}
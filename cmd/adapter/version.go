@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.gitCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	gitCommit = ""
+	buildDate = ""
+)
+
+// features lists the optional features GetServerInfo reports, sorted. Add
+// a name when a feature ships and never reuse one.
+var features = []string{
+	"api_descriptor",
+	"api_v2",
+	"archive",
+	"batch_delete",
+	"class_bundles",
+	"class_states",
+	"classroom_sync",
+	"clone",
+	"edit_leases",
+	"enrollments",
+	"etags",
+	"expire_time",
+	"external_ids",
+	"import_roster",
+	"instructors",
+	"key_value_store",
+	"list.label_selector",
+	"list.order_by",
+	"list.snapshots",
+	"list.states",
+	"prerequisites",
+	"replay_changes",
+	"saved_queries",
+	"semester_stats",
+	"transact",
+	"validate_only",
+	"watch",
+}
+
+func serverInfo() *pb.ServerInfo {
+	return &pb.ServerInfo{
+		Version:   version,
+		GitCommit: gitCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Features:  append([]string(nil), features...),
+	}
+}
+
+// versionString is what -version prints.
+func versionString() string {
+	s := "adapter " + version
+	if gitCommit != "" {
+		s += " (" + gitCommit + ")"
+	}
+	if buildDate != "" {
+		s += " built " + buildDate
+	}
+	return fmt.Sprintf("%s with %s", s, runtime.Version())
+}
+
+func (s *server) GetServerInfo(ctx context.Context, in *pb.Empty) (*pb.ServerInfo, error) {
+	logf(ctx, "GetServerInfo called")
+	return serverInfo(), nil
+}
+
+// commonFeatures returns the features in both a and b, which are sorted.
+func commonFeatures(a, b []string) []string {
+	var common []string
+	for _, f := range a {
+		if i := sort.SearchStrings(b, f); i < len(b) && b[i] == f {
+			common = append(common, f)
+		}
+	}
+	return common
+}
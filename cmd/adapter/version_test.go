@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func TestGetServerInfo(t *testing.T) {
+	s := &server{}
+	info, err := s.GetServerInfo(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != version || info.GoVersion == "" {
+		t.Errorf("GetServerInfo = %v, want version %s and a Go version", info, version)
+	}
+	if !sort.StringsAreSorted(info.Features) {
+		t.Errorf("features %v aren't sorted", info.Features)
+	}
+	for i := 1; i < len(info.Features); i++ {
+		if info.Features[i] == info.Features[i-1] {
+			t.Errorf("feature %s is listed twice", info.Features[i])
+		}
+	}
+}
+
+func TestCommonFeatures(t *testing.T) {
+	got := commonFeatures([]string{"a", "b", "d"}, []string{"b", "c", "d", "e"})
+	if !equalIds(got, []string{"b", "d"}) {
+		t.Errorf("commonFeatures = %v, want [b d]", got)
+	}
+	if got := commonFeatures([]string{"a"}, nil); len(got) != 0 {
+		t.Errorf("commonFeatures with an upstream without features = %v, want none", got)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// Events wait for each target under webhook/<target>/<sequence>.
+	webhookPrefix      = "webhook/"
+	webhookSequenceKey = "meta/webhook-seq"
+	webhookTimeout     = 10 * time.Second
+)
+
+// Headers of a webhook request. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" under the signing secret, prefixed with "sha256=".
+const (
+	webhookEventIdHeader   = "X-Class-Adapter-Event-Id"
+	webhookTimestampHeader = "X-Class-Adapter-Timestamp"
+	webhookSignatureHeader = "X-Class-Adapter-Signature"
+)
+
+var (
+	webhooksDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "adapter_webhooks_delivered_total",
+		Help: "Class change events delivered to webhook targets, by target URL.",
+	}, []string{"url"})
+	webhookFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "adapter_webhook_failures_total",
+		Help: "Failed attempts to deliver a class change event to a webhook target, by target URL.",
+	}, []string{"url"})
+	webhooksDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "adapter_webhooks_dead_lettered_total",
+		Help: "Class change events given up on and logged instead of delivered, by target URL.",
+	}, []string{"url"})
+)
+
+// webhookTarget is one URL events are POSTed to, with its own queue.
+type webhookTarget struct {
+	url string
+	// Names the target's queue: the start of the SHA-256 of its URL, so the
+	// queue survives restarts and reordering of -webhook-urls.
+	id   string
+	wake chan struct{}
+}
+
+func (t *webhookTarget) prefix() string {
+	return webhookPrefix + t.id + "/"
+}
+
+// webhooks queues every class event for each target in the transaction
+// making the change, like the outbox, and POSTs them to each target as
+// JSON in order. A target that fails holds up only its own queue. An event
+// is retried with backoff until it has failed maxAttempts times, or at once
+// if the target rejects it with a 4xx status other than 408 or 429, and is
+// then logged in full and dropped.
+type webhooks struct {
+	db          kvDB
+	seq         kvSequence
+	targets     []*webhookTarget
+	secret      []byte
+	client      *http.Client
+	maxAttempts int
+	now         func() time.Time
+}
+
+// newWebhooks opens the queues of urls and drops those of targets no longer
+// configured.
+func newWebhooks(db kvDB, urls []string, secret []byte, maxAttempts int) (*webhooks, error) {
+	seq, err := db.GetSequence([]byte(webhookSequenceKey), 100)
+	if err != nil {
+		return nil, err
+	}
+	w := &webhooks{
+		db:          db,
+		seq:         seq,
+		secret:      secret,
+		client:      &http.Client{Timeout: webhookTimeout},
+		maxAttempts: maxAttempts,
+		now:         time.Now,
+	}
+	configured := make(map[string]bool)
+	for _, u := range urls {
+		sum := sha256.Sum256([]byte(u))
+		t := &webhookTarget{url: u, id: hex.EncodeToString(sum[:8]), wake: make(chan struct{}, 1)}
+		w.targets = append(w.targets, t)
+		configured[t.id] = true
+	}
+	stale, err := w.staleQueues(configured)
+	if err != nil {
+		seq.Release()
+		return nil, err
+	}
+	for _, id := range stale {
+		log.Printf("Dropping the webhook queue %s of a target no longer in -webhook-urls", id)
+		if err := db.DropPrefix([]byte(webhookPrefix + id + "/")); err != nil {
+			seq.Release()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// staleQueues returns the ids of the queues holding events for targets not
+// in configured.
+func (w *webhooks) staleQueues(configured map[string]bool) ([]string, error) {
+	var stale []string
+	err := w.db.View(func(txn kvTxn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(webhookPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); {
+			id := string(it.Item().Key()[len(webhookPrefix):])
+			if i := strings.Index(id, "/"); i >= 0 {
+				id = id[:i]
+			}
+			if !configured[id] {
+				stale = append(stale, id)
+			}
+			// Skip the rest of the queue: "0" sorts right after "/".
+			it.Seek([]byte(webhookPrefix + id + "0"))
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// add queues e for every target once txn commits. A nil webhooks discards
+// events.
+func (w *webhooks) add(txn kvTxn, e *pb.ClassEvent) error {
+	if w == nil {
+		return nil
+	}
+	n, err := w.seq.Next()
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	for _, t := range w.targets {
+		if err := txn.Set([]byte(fmt.Sprintf("%s%020d", t.prefix(), n)), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify wakes every target's relay after a commit.
+func (w *webhooks) notify() {
+	if w == nil {
+		return
+	}
+	for _, t := range w.targets {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run relays every target's queue until ctx is cancelled.
+func (w *webhooks) run(ctx context.Context) {
+	done := make(chan struct{})
+	for _, t := range w.targets {
+		go func(t *webhookTarget) {
+			w.relay(ctx, t)
+			done <- struct{}{}
+		}(t)
+	}
+	for range w.targets {
+		<-done
+	}
+	w.seq.Release()
+}
+
+// relay delivers t's queue, backing off while its event at the head fails.
+func (w *webhooks) relay(ctx context.Context, t *webhookTarget) {
+	backoff := minPublishBackoff
+	attempts := 0
+	for {
+		delay := outboxPollPeriod
+		wake := t.wake
+		if err := w.drain(ctx, t, &attempts); err != nil && ctx.Err() == nil {
+			log.Printf("Error delivering a class event to webhook %s (attempt %d of %d), retrying in %s: %s", t.url, attempts, w.maxAttempts, backoff, err)
+			delay = backoff
+			if backoff *= 2; backoff > maxPublishBackoff {
+				backoff = maxPublishBackoff
+			}
+			wake = nil
+		} else {
+			backoff = minPublishBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(delay):
+		}
+	}
+}
+
+// drain delivers t's queued events oldest first, removing each once the
+// target accepts it or it is dead-lettered. attempts counts the failures
+// of the event at the head of the queue.
+func (w *webhooks) drain(ctx context.Context, t *webhookTarget, attempts *int) error {
+	for {
+		var entries []outboxEntry
+		err := w.db.View(func(txn kvTxn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = []byte(t.prefix())
+			it := txn.NewIterator(opts)
+			defer it.Close()
+			for it.Rewind(); it.Valid() && len(entries) < outboxBatch; it.Next() {
+				v, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, outboxEntry{key: it.Item().KeyCopy(nil), data: v})
+			}
+			return nil
+		})
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+
+		for _, e := range entries {
+			body, err := webhookPayload(e.data)
+			if err == nil {
+				err = w.deliver(ctx, t, string(e.key[len(webhookPrefix):]), body)
+			}
+			if err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				webhookFailures.WithLabelValues(t.url).Inc()
+				*attempts++
+				if _, permanent := err.(permanentWebhookError); !permanent && *attempts < w.maxAttempts {
+					return err
+				}
+				webhooksDeadLettered.WithLabelValues(t.url).Inc()
+				log.Printf("Dead letter: gave up delivering class event %s to webhook %s after %d attempts: %s; event: %s", e.key, t.url, *attempts, err, body)
+			} else {
+				webhooksDelivered.WithLabelValues(t.url).Inc()
+			}
+			*attempts = 0
+			if err := w.db.Update(func(txn kvTxn) error {
+				return txn.Delete(e.key)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// webhookPayload converts a queued event to the JSON sent to targets.
+func webhookPayload(data []byte) ([]byte, error) {
+	e := &pb.ClassEvent{}
+	if err := proto.Unmarshal(data, e); err != nil {
+		return nil, permanentWebhookError{err}
+	}
+	return protojson.Marshal(e)
+}
+
+// permanentWebhookError is a failure retrying won't fix.
+type permanentWebhookError struct{ error }
+
+// deliver POSTs one event, signed. id is stable across retries so targets
+// can drop duplicates.
+func (w *webhooks) deliver(ctx context.Context, t *webhookTarget, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return permanentWebhookError{err}
+	}
+	ts := strconv.FormatInt(w.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventIdHeader, id)
+	req.Header.Set(webhookTimestampHeader, ts)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(w.secret, ts, body))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	switch code := resp.StatusCode; {
+	case code/100 == 2:
+		return nil
+	case code/100 == 4 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests:
+		return permanentWebhookError{fmt.Errorf("target answered %s", resp.Status)}
+	default:
+		return fmt.Errorf("target answered %s", resp.Status)
+	}
+}
+
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
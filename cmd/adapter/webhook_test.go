@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// webhookRecorder answers every request with code and records the events
+// of those signed with secret.
+type webhookRecorder struct {
+	t      *testing.T
+	secret []byte
+	code   int
+
+	mu       sync.Mutex
+	requests int
+	events   []string
+}
+
+func (r *webhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	ts := req.Header.Get(webhookTimestampHeader)
+	if req.Header.Get(webhookSignatureHeader) != "sha256="+signWebhook(r.secret, ts, body) {
+		r.t.Errorf("request for event %s has a bad signature", req.Header.Get(webhookEventIdHeader))
+	}
+	e := &pb.ClassEvent{}
+	if err := protojson.Unmarshal(body, e); err != nil {
+		r.t.Errorf("payload %s isn't a ClassEvent: %s", body, err)
+	}
+	r.events = append(r.events, e.Type.String()+" "+e.Class.GetId())
+	w.WriteHeader(r.code)
+}
+
+func (r *webhookRecorder) counts() (int, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests, append([]string(nil), r.events...)
+}
+
+// queued counts the events waiting for any webhook target.
+func queued(t *testing.T, db kvDB) int {
+	t.Helper()
+	n := 0
+	err := db.View(func(txn kvTxn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(webhookPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWebhooks(t *testing.T) {
+	secret := []byte("s3cret")
+	ok := &webhookRecorder{t: t, secret: secret, code: http.StatusNoContent}
+	failing := &webhookRecorder{t: t, secret: secret, code: http.StatusServiceUnavailable}
+	rejecting := &webhookRecorder{t: t, secret: secret, code: http.StatusBadRequest}
+	var urls []string
+	for _, r := range []*webhookRecorder{ok, failing, rejecting} {
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+		urls = append(urls, ts.URL)
+	}
+
+	db := newTestDB(t, driverBadger, t.TempDir())
+	w, err := newWebhooks(db, urls, secret, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{db: db, events: newEventBus(), webhooks: w}
+	ctx := context.Background()
+	if _, err := s.Create(ctx, &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Delete(ctx, &pb.Class{Id: "MATH101"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := queued(t, db); n != 6 {
+		t.Errorf("%d events queued, want 2 for each of 3 targets", n)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go w.run(runCtx)
+	deadline := time.Now().Add(5 * time.Second)
+	for queued(t, db) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := queued(t, db); n > 0 {
+		t.Fatalf("%d events still queued", n)
+	}
+
+	want := []string{"CREATED MATH101", "DELETED MATH101"}
+	if _, events := ok.counts(); !equalIds(events, want) {
+		t.Errorf("target got %v, want %v", events, want)
+	}
+	// Each event failed twice and was dead-lettered.
+	if n, _ := failing.counts(); n != 4 {
+		t.Errorf("failing target got %d requests, want 4", n)
+	}
+	// A 400 isn't retried.
+	if n, _ := rejecting.counts(); n != 2 {
+		t.Errorf("rejecting target got %d requests, want 2", n)
+	}
+}
+
+func TestWebhooksDropRemovedTargets(t *testing.T) {
+	db := newTestDB(t, driverBadger, t.TempDir())
+	w, err := newWebhooks(db, []string{"http://old.example.com/hook", "http://kept.example.com/hook"}, []byte("s"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{db: db, events: newEventBus(), webhooks: w}
+	if _, err := s.Create(context.Background(), &pb.Class{Id: "MATH101", Name: "Algebra"}); err != nil {
+		t.Fatal(err)
+	}
+	w.seq.Release()
+	if n := queued(t, db); n != 2 {
+		t.Fatalf("%d events queued, want 2", n)
+	}
+
+	w, err = newWebhooks(db, []string{"http://kept.example.com/hook", "http://new.example.com/hook"}, []byte("s"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.seq.Release()
+	if n := queued(t, db); n != 1 {
+		t.Errorf("%d events queued after a target was removed, want the kept target's 1", n)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	xdscreds "google.golang.org/grpc/credentials/xds"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/xds"
+)
+
+// xdsBootstrapEnv names the xDS bootstrap file, which says how to reach
+// the control plane and where the mesh certificates are. gRPC reads it once
+// at startup.
+const xdsBootstrapEnv = "GRPC_XDS_BOOTSTRAP"
+
+// grpcServer is what serve needs of a gRPC server: a *grpc.Server, or an
+// *xds.GRPCServer under -xds.
+type grpcServer interface {
+	grpc.ServiceRegistrar
+	Serve(net.Listener) error
+	Stop()
+	GracefulStop()
+}
+
+// checkXDS reports why the adapter can't serve specs under -xds. The
+// control plane configures each listener by its TCP address and supplies
+// its certificates, so none may be a Unix domain socket or use -listen-tls,
+// and a server managed by it doesn't register reflection.
+func checkXDS(specs []listenSpec, reflection bool) error {
+	if os.Getenv(xdsBootstrapEnv) == "" {
+		return fmt.Errorf("-xds needs %s to name the xDS bootstrap file", xdsBootstrapEnv)
+	}
+	if _, err := os.Stat(os.Getenv(xdsBootstrapEnv)); err != nil {
+		return fmt.Errorf("-xds: %s: %w", xdsBootstrapEnv, err)
+	}
+	if reflection {
+		return fmt.Errorf("-reflection isn't supported with -xds; GetApiDescriptor serves the schema")
+	}
+	for _, l := range specs {
+		if _, ok := socketPath(l.addr); ok {
+			return fmt.Errorf("-xds serves TCP only, and %s is a Unix domain socket", l.addr)
+		}
+		if l.tls != nil {
+			return fmt.Errorf("-xds takes certificates from the control plane, so %s can't be in -listen-tls", l.addr)
+		}
+	}
+	return nil
+}
+
+// newXDSServer returns a gRPC server like newGRPCServer's that takes its
+// listener configuration and mTLS certificates from the xDS control plane,
+// serving plaintext until the control plane sends a security configuration.
+func newXDSServer(svc services, opts []grpc.ServerOption, unary []grpc.UnaryServerInterceptor, stream []grpc.StreamServerInterceptor) (*xds.GRPCServer, *health.Server, error) {
+	creds, err := xdscreds.NewServerCredentials(xdscreds.ServerOptions{FallbackCreds: insecure.NewCredentials()})
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(serverOptions(opts, unary, stream), grpc.Creds(creds))
+	s := xds.NewGRPCServer(opts...)
+	return s, registerServices(s, svc), nil
+}
+
+// dialCredentials returns the transport credentials for the adapter to
+// dial target with. An xds:/// target is resolved, balanced and secured by
+// the control plane, which also receives load reports for it; any other is
+// dialed in plaintext.
+func dialCredentials(target string) (grpc.DialOption, error) {
+	if !strings.HasPrefix(target, "xds:") {
+		return grpc.WithInsecure(), nil
+	}
+	creds, err := xdscreds.NewClientCredentials(xdscreds.ClientOptions{FallbackCreds: insecure.NewCredentials()})
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(creds), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckXDS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bootstrap := filepath.Join(dir, "bootstrap.json")
+	if err := ioutil.WriteFile(bootstrap, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile, _ := writeTestCert(t, dir)
+
+	old, set := os.LookupEnv(xdsBootstrapEnv)
+	defer func() {
+		if set {
+			os.Setenv(xdsBootstrapEnv, old)
+		} else {
+			os.Unsetenv(xdsBootstrapEnv)
+		}
+	}()
+
+	tcp, err := parseListeners(":50051,localhost:50052", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv(xdsBootstrapEnv)
+	if err := checkXDS(tcp, false); err == nil {
+		t.Error("checkXDS without a bootstrap file succeeded")
+	}
+	os.Setenv(xdsBootstrapEnv, filepath.Join(dir, "missing.json"))
+	if err := checkXDS(tcp, false); err == nil {
+		t.Error("checkXDS with a missing bootstrap file succeeded")
+	}
+
+	os.Setenv(xdsBootstrapEnv, bootstrap)
+	if err := checkXDS(tcp, false); err != nil {
+		t.Errorf("checkXDS of TCP listeners returned %v", err)
+	}
+	if err := checkXDS(tcp, true); err == nil {
+		t.Error("checkXDS with -reflection succeeded")
+	}
+	sock, err := parseListeners(":50051,unix:///run/adapter.sock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkXDS(sock, false); err == nil {
+		t.Error("checkXDS of a Unix domain socket succeeded")
+	}
+	withTLS, err := parseListeners(":50051", ":50051="+certFile+":"+keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkXDS(withTLS, false); err == nil {
+		t.Error("checkXDS of a -listen-tls address succeeded")
+	}
+}
@@ -3,10 +3,18 @@ module github.com/virtual-class-tutor/class-adapter-file
 go 1.15
 
 require (
-	github.com/dgraph-io/badger v1.6.2
+	github.com/dgraph-io/badger/v2 v2.2007.2
 	github.com/dgraph-io/ristretto v0.0.4-0.20210122082011-bb5d392ed82d // indirect
 	github.com/golang/protobuf v1.4.3
-	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c // indirect
+	github.com/kr/pretty v0.2.0 // indirect
+	github.com/nats-io/nats.go v1.11.0
+	github.com/prometheus/client_golang v1.9.0
+	github.com/prometheus/client_model v0.2.0
+	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
+	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c
+	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
 	google.golang.org/grpc v1.35.0
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.4.0
 )
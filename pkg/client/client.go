@@ -0,0 +1,446 @@
+// Package client connects to a class adapter and follows the policy the
+// adapter serves from GetClientPolicy: it retries failed calls as the policy
+// says, waiting at least as long as any RetryInfo the server sent, hedges
+// reads, caps page
+// sizes at the server's limit and logs each deprecated method the first
+// time it is called. The policy is fetched when the client
+// connects and again every refresh interval, so a fleet picks up changes
+// without being redeployed. Calls without a deadline get a default one.
+//
+//	c, err := client.Dial(ctx, "localhost:50051",
+//		client.WithDialOptions(grpc.WithInsecure()), client.WithToken(token))
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	class, err := c.GetClass(client.WithTenant(ctx, "district-7"), "MATH101-01")
+//	if client.IsNotFound(err) {
+//		...
+//	}
+//
+// The generated stubs stay available for everything the helpers don't
+// cover: Client embeds pb.AdapterClient, and Instructors and KeyValueStore
+// hold the other services' clients.
+package client
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Client is a connection to an adapter. It is safe for concurrent use.
+type Client struct {
+	pb.AdapterClient
+	Instructors   pb.InstructorsClient
+	KeyValueStore pb.KeyValueStoreClient
+
+	conn    *grpc.ClientConn
+	logf    func(format string, args ...interface{})
+	timeout time.Duration
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	policy *pb.ClientPolicy
+	warned map[string]bool
+}
+
+// An Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	dialOptions []grpc.DialOption
+	logf        func(format string, args ...interface{})
+	timeout     time.Duration
+}
+
+// DefaultTimeout is how long calls without a deadline may take, retries
+// included, unless WithDefaultTimeout says otherwise.
+const DefaultTimeout = 30 * time.Second
+
+// WithDialOptions adds options to the underlying grpc.Dial, such as
+// transport credentials. grpc.Dial requires credentials of some kind, so
+// pass at least grpc.WithInsecure() or grpc.WithTransportCredentials.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, opts...) }
+}
+
+// WithLogger sets where deprecation notices and failed policy refreshes are
+// logged, the standard logger by default.
+func WithLogger(logf func(format string, args ...interface{})) Option {
+	return func(o *options) { o.logf = logf }
+}
+
+// WithDefaultTimeout sets how long unary calls whose context has no deadline
+// may take, retries included. Zero leaves them without a deadline. Streams
+// such as Watch never get one.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithToken sends token as the bearer token of every call, for adapters
+// started with -auth-tokens-file.
+func WithToken(token string) Option {
+	return WithDialOptions(grpc.WithPerRPCCredentials(bearerToken(token)))
+}
+
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity allows tokens over plaintext connections, which
+// adapters on a private network accept.
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// DefaultPolicy is the policy a client follows until it has fetched the
+// server's, and on servers too old to serve one.
+func DefaultPolicy() *pb.ClientPolicy {
+	return &pb.ClientPolicy{
+		MaxBatchSize: 100,
+		RetryPolicy: &pb.RetryPolicy{
+			MaxAttempts:       3,
+			InitialBackoff:    durationpb.New(100 * time.Millisecond),
+			MaxBackoff:        durationpb.New(time.Second),
+			BackoffMultiplier: 2,
+			RetryableCodes:    []string{"UNAVAILABLE", "ABORTED"},
+		},
+		RefreshInterval: durationpb.New(5 * time.Minute),
+		HedgingPolicy: &pb.HedgingPolicy{
+			MaxAttempts:  3,
+			HedgingDelay: durationpb.New(200 * time.Millisecond),
+		},
+	}
+}
+
+// Dial connects to the adapter at target and fetches its policy, failing if
+// the policy can't be fetched.
+func Dial(ctx context.Context, target string, opts ...Option) (*Client, error) {
+	o := options{logf: log.Printf, timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c := &Client{
+		logf:    o.logf,
+		timeout: o.timeout,
+		done:    make(chan struct{}),
+		policy:  DefaultPolicy(),
+		warned:  make(map[string]bool),
+	}
+	dialOptions := append([]grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(c.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(c.streamInterceptor),
+	}, o.dialOptions...)
+	conn, err := grpc.DialContext(ctx, target, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.AdapterClient = pb.NewAdapterClient(conn)
+	c.Instructors = pb.NewInstructorsClient(conn)
+	c.KeyValueStore = pb.NewKeyValueStoreClient(conn)
+	if err := c.refresh(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.refreshLoop()
+	return c, nil
+}
+
+// Close stops refreshing the policy and closes the connection.
+func (c *Client) Close() error {
+	close(c.done)
+	return c.conn.Close()
+}
+
+// Policy returns the policy the client is following.
+func (c *Client) Policy() *pb.ClientPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return proto.Clone(c.policy).(*pb.ClientPolicy)
+}
+
+// refresh fetches the server's policy. Servers that predate GetClientPolicy
+// leave the client on the default policy.
+func (c *Client) refresh(ctx context.Context) error {
+	p, err := c.AdapterClient.GetClientPolicy(ctx, &pb.Empty{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if p.RetryPolicy == nil {
+		p.RetryPolicy = DefaultPolicy().RetryPolicy
+	}
+	if p.HedgingPolicy == nil {
+		p.HedgingPolicy = DefaultPolicy().HedgingPolicy
+	}
+	c.mu.Lock()
+	c.policy = p
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) refreshLoop() {
+	for {
+		interval := c.Policy().RefreshInterval.AsDuration()
+		if interval <= 0 {
+			interval = DefaultPolicy().RefreshInterval.AsDuration()
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(interval):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := c.refresh(ctx); err != nil {
+			c.logf("class adapter client: keeping the current policy, refresh failed: %v", err)
+		}
+		cancel()
+	}
+}
+
+// warnDeprecated logs the notice for method the first time it is called
+// while deprecated.
+func (c *Client) warnDeprecated(p *pb.ClientPolicy, method string) {
+	for _, d := range p.Deprecations {
+		if d.Method != method {
+			continue
+		}
+		c.mu.Lock()
+		warned := c.warned[method]
+		c.warned[method] = true
+		c.mu.Unlock()
+		if warned {
+			return
+		}
+		msg := method + " is deprecated"
+		if d.SunsetTime != nil {
+			msg += " and will be removed after " + d.SunsetTime.AsTime().Format("2006-01-02")
+		}
+		if d.Message != "" {
+			msg += ": " + d.Message
+		}
+		c.logf("class adapter client: %s", msg)
+		return
+	}
+}
+
+// capPageSize returns req with its page size lowered to max, copying it
+// rather than changing the caller's request.
+func capPageSize(req interface{}, max int32) interface{} {
+	if max <= 0 {
+		return req
+	}
+	switch r := req.(type) {
+	case *pb.ListRequest:
+		if r.PageSize > max {
+			r = proto.Clone(r).(*pb.ListRequest)
+			r.PageSize = max
+			return r
+		}
+	case *pb.ListBySemesterRequest:
+		if r.PageSize > max {
+			r = proto.Clone(r).(*pb.ListBySemesterRequest)
+			r.PageSize = max
+			return r
+		}
+	case *pb.ListArchivedRequest:
+		if r.PageSize > max {
+			r = proto.Clone(r).(*pb.ListArchivedRequest)
+			r.PageSize = max
+			return r
+		}
+	case *pb.ListEnrollmentsRequest:
+		if r.PageSize > max {
+			r = proto.Clone(r).(*pb.ListEnrollmentsRequest)
+			r.PageSize = max
+			return r
+		}
+	case *pb.ListInstructorsRequest:
+		if r.PageSize > max {
+			r = proto.Clone(r).(*pb.ListInstructorsRequest)
+			r.PageSize = max
+			return r
+		}
+	case *pb.ListKeysRequest:
+		if r.PageSize > max {
+			r = proto.Clone(r).(*pb.ListKeysRequest)
+			r.PageSize = max
+			return r
+		}
+	}
+	return req
+}
+
+func (c *Client) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c.mu.RLock()
+	p := c.policy
+	c.mu.RUnlock()
+	c.warnDeprecated(p, method)
+	req = capPageSize(req, p.MaxPageSize)
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	r := p.RetryPolicy
+	level := methodIdempotency(method)
+	if h := p.HedgingPolicy; h != nil && h.MaxAttempts > 1 && level == descriptorpb.MethodOptions_NO_SIDE_EFFECTS {
+		if m, ok := reply.(proto.Message); ok {
+			return hedge(ctx, h, r, method, req, m, cc, invoker, opts...)
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || attempt >= int(r.MaxAttempts) {
+			return err
+		}
+		// RetryInfo is the server saying the call may succeed later, even
+		// with a code the policy doesn't retry, such as ResourceExhausted,
+		// and that the call didn't take effect, as on a write conflict.
+		// Calls that could take effect twice are retried only then.
+		wait, ok := retryDelay(err)
+		if !ok && (level == descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN || !retryable(r, status.Code(err))) {
+			return err
+		}
+		if d := backoff(r, attempt); d > wait {
+			wait = d
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// hedge sends a call without side effects up to h.MaxAttempts times, each
+// h.HedgingDelay after the one before, and returns the first success. An
+// attempt that fails with a code r retries, or with RetryInfo, starts the
+// next one after its backoff instead; any other failure is returned at
+// once. Attempts still running are then cancelled.
+func hedge(ctx context.Context, h *pb.HedgingPolicy, r *pb.RetryPolicy, method string, req interface{}, reply proto.Message, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		reply proto.Message
+		err   error
+	}
+	results := make(chan result, h.MaxAttempts)
+	started, running := 0, 0
+	start := func() {
+		out := proto.Clone(reply)
+		out.Reset()
+		started++
+		running++
+		go func() {
+			err := invoker(ctx, method, req, out, cc, opts...)
+			results <- result{out, err}
+		}()
+	}
+	start()
+	delay := h.HedgingDelay.AsDuration()
+	next := time.NewTimer(delay)
+	defer next.Stop()
+	var err error
+	for running > 0 || started < int(h.MaxAttempts) {
+		// Only wait on ctx between attempts; running ones return its error.
+		done := ctx.Done()
+		if running > 0 {
+			done = nil
+		}
+		select {
+		case <-done:
+			return err
+		case <-next.C:
+			if started < int(h.MaxAttempts) {
+				start()
+				next.Reset(delay)
+			}
+		case res := <-results:
+			running--
+			if res.err == nil {
+				reply.Reset()
+				proto.Merge(reply, res.reply)
+				return nil
+			}
+			err = res.err
+			wait, ok := retryDelay(err)
+			if !ok && !retryable(r, status.Code(err)) {
+				return err
+			}
+			if started < int(h.MaxAttempts) {
+				if d := backoff(r, started); d > wait {
+					wait = d
+				}
+				if !next.Stop() {
+					select {
+					case <-next.C:
+					default:
+					}
+				}
+				next.Reset(wait)
+			}
+		}
+	}
+	return err
+}
+
+func (c *Client) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	c.mu.RLock()
+	p := c.policy
+	c.mu.RUnlock()
+	c.warnDeprecated(p, method)
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+func retryable(r *pb.RetryPolicy, code codes.Code) bool {
+	for _, name := range r.RetryableCodes {
+		var c codes.Code
+		if c.UnmarshalJSON([]byte(`"`+name+`"`)) == nil && c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay returns the delay of the RetryInfo err carries, if any.
+func retryDelay(err error) (time.Duration, bool) {
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			return ri.RetryDelay.AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// backoff returns how long to wait after the given failed attempt: a random
+// time up to the policy's backoff for it.
+func backoff(r *pb.RetryPolicy, attempt int) time.Duration {
+	d := float64(r.InitialBackoff.AsDuration()) * math.Pow(r.BackoffMultiplier, float64(attempt-1))
+	if max := float64(r.MaxBackoff.AsDuration()); d > max {
+		d = max
+	}
+	if d < 1 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
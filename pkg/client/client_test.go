@@ -0,0 +1,276 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// policyServer serves a policy the test can change, and fails List with
+// Unavailable failures times before succeeding.
+type policyServer struct {
+	pb.UnimplementedAdapterServer
+
+	mu        sync.Mutex
+	policy    *pb.ClientPolicy
+	failures  int
+	calls     int
+	pageSizes []int32
+}
+
+func (s *policyServer) GetClientPolicy(ctx context.Context, in *pb.Empty) (*pb.ClientPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy, nil
+}
+
+func (s *policyServer) List(ctx context.Context, in *pb.ListRequest) (*pb.Classes, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	s.pageSizes = append(s.pageSizes, in.PageSize)
+	if s.failures > 0 {
+		s.failures--
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return &pb.Classes{}, nil
+}
+
+func startServer(t *testing.T, adapter pb.AdapterServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterAdapterServer(s, adapter)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func testPolicy() *pb.ClientPolicy {
+	p := DefaultPolicy()
+	p.MaxPageSize = 10
+	p.RetryPolicy.InitialBackoff = durationpb.New(time.Millisecond)
+	p.RetryPolicy.MaxBackoff = durationpb.New(time.Millisecond)
+	p.Deprecations = []*pb.Deprecation{{Method: "/class.Adapter/List", Message: "use Query"}}
+	return p
+}
+
+type logRecorder struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *logRecorder) logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+func TestClientFollowsPolicy(t *testing.T) {
+	srv := &policyServer{policy: testPolicy(), failures: 2}
+	var logs logRecorder
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithLogger(logs.logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	req := &pb.ListRequest{PageSize: 50}
+	if _, err := c.List(context.Background(), req); err != nil {
+		t.Fatalf("List failed despite retries: %v", err)
+	}
+	if _, err := c.List(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if srv.calls != 4 {
+		t.Errorf("server saw %d calls, want 3 attempts and then 1", srv.calls)
+	}
+	for _, n := range srv.pageSizes {
+		if n != 10 {
+			t.Errorf("server got page size %d, want it capped at 10", n)
+		}
+	}
+	if req.PageSize != 50 {
+		t.Errorf("the caller's request was changed to page size %d", req.PageSize)
+	}
+	if len(logs.logs) != 1 || !strings.Contains(logs.logs[0], "use Query") {
+		t.Errorf("logged %q, want one deprecation notice", logs.logs)
+	}
+}
+
+func TestClientGivesUpAfterMaxAttempts(t *testing.T) {
+	srv := &policyServer{policy: testPolicy(), failures: 5}
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.List(context.Background(), &pb.ListRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("List returned %v, want Unavailable", err)
+	}
+	if srv.calls != 3 {
+		t.Errorf("server saw %d calls, want 3", srv.calls)
+	}
+}
+
+// throttledServer fails Exists with ResourceExhausted and RetryInfo once.
+type throttledServer struct {
+	policyServer
+	throttled bool
+}
+
+func (s *throttledServer) Exists(ctx context.Context, in *pb.GetRequest) (*pb.ExistsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if !s.throttled {
+		s.throttled = true
+		st, _ := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(50 * time.Millisecond)})
+		return nil, st.Err()
+	}
+	return &pb.ExistsResponse{Exists: true}, nil
+}
+
+func TestClientFollowsRetryInfo(t *testing.T) {
+	srv := &throttledServer{policyServer: policyServer{policy: testPolicy()}}
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	start := time.Now()
+	if ok, err := c.ClassExists(context.Background(), "c0"); err != nil || !ok {
+		t.Fatalf("ClassExists = %v, %v; want a retry past the ResourceExhausted", ok, err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("retried after %s, before the server's RetryInfo delay", waited)
+	}
+	if srv.calls != 2 {
+		t.Errorf("server saw %d calls, want 2", srv.calls)
+	}
+}
+
+func TestClientRefreshesPolicy(t *testing.T) {
+	p := testPolicy()
+	p.RefreshInterval = durationpb.New(10 * time.Millisecond)
+	srv := &policyServer{policy: p}
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	srv.mu.Lock()
+	p = testPolicy()
+	p.RefreshInterval = durationpb.New(10 * time.Millisecond)
+	p.MaxBatchSize = 7
+	srv.policy = p
+	srv.mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Policy().MaxBatchSize != 7 {
+		if time.Now().After(deadline) {
+			t.Fatal("the client never picked up the new policy")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClientDefaultsOnOldServers(t *testing.T) {
+	c, err := Dial(context.Background(), startServer(t, &pb.UnimplementedAdapterServer{}), WithDialOptions(grpc.WithInsecure()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.Policy().RetryPolicy.MaxAttempts; got != DefaultPolicy().RetryPolicy.MaxAttempts {
+		t.Errorf("MaxAttempts = %d, want the default", got)
+	}
+}
+
+// slowServer answers its first Get only once the call is cancelled, and
+// fails Enroll with err failures times.
+type slowServer struct {
+	policyServer
+	err error
+}
+
+func (s *slowServer) Get(ctx context.Context, in *pb.GetRequest) (*pb.Class, error) {
+	s.mu.Lock()
+	s.calls++
+	first := s.calls == 1
+	s.mu.Unlock()
+	if first {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &pb.Class{Id: in.Id, Name: "Algebra"}, nil
+}
+
+func (s *slowServer) Enroll(ctx context.Context, in *pb.EnrollmentRequest) (*pb.Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.failures > 0 {
+		s.failures--
+		return nil, s.err
+	}
+	return &pb.Enrollment{ClassId: in.ClassId}, nil
+}
+
+func TestClientHedgesReads(t *testing.T) {
+	p := testPolicy()
+	p.HedgingPolicy = &pb.HedgingPolicy{MaxAttempts: 2, HedgingDelay: durationpb.New(20 * time.Millisecond)}
+	srv := &slowServer{policyServer: policyServer{policy: p}}
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	class, err := c.Get(ctx, &pb.GetRequest{Id: "MATH101"})
+	if err != nil || class.Name != "Algebra" {
+		t.Fatalf("Get = %v, %v; want the hedged attempt's class", class, err)
+	}
+	if ctx.Err() != nil {
+		t.Error("Get waited for the stalled attempt")
+	}
+}
+
+func TestClientRetriesWritesOnlyWhenSafe(t *testing.T) {
+	srv := &slowServer{policyServer: policyServer{policy: testPolicy(), failures: 1}, err: status.Error(codes.Unavailable, "try again")}
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// Enroll isn't idempotent: the first attempt may have enrolled.
+	if _, err := c.Enroll(context.Background(), &pb.EnrollmentRequest{ClassId: "MATH101"}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Enroll returned %v, want Unavailable without a retry", err)
+	}
+
+	// A conflict comes with RetryInfo, and never commits.
+	st, _ := status.New(codes.Aborted, "conflict").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Millisecond)})
+	srv.mu.Lock()
+	srv.failures, srv.calls, srv.err = 1, 0, st.Err()
+	srv.mu.Unlock()
+	if _, err := c.Enroll(context.Background(), &pb.EnrollmentRequest{ClassId: "MATH101"}); err != nil {
+		t.Fatalf("Enroll failed despite the conflict's RetryInfo: %v", err)
+	}
+	if srv.calls != 2 {
+		t.Errorf("server saw %d calls, want 2", srv.calls)
+	}
+}
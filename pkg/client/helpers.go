@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// WithTenant returns a context whose calls act on tenant's data instead of
+// the default tenant's.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-tenant-id", tenant)
+}
+
+// WithRequestId returns a context whose calls carry id as their request
+// Id, so the adapter's log lines for them can be found by the caller's own
+// request Id. Without one the adapter makes one up.
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "x-request-id", id)
+}
+
+// RequestId returns the request Id the adapter attached to err, or "" if
+// err doesn't carry one.
+func RequestId(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.RequestInfo); ok {
+			return info.RequestId
+		}
+	}
+	return ""
+}
+
+// IsNotFound reports whether err is the adapter's NotFound status, such as
+// an Update with an update_mask returns for a class that doesn't exist.
+func IsNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
+
+// GetClass returns the class with the given Id. Like Get, it returns a
+// class holding only the Id when there is none; use ClassExists to tell.
+func (c *Client) GetClass(ctx context.Context, id string) (*pb.Class, error) {
+	return c.Get(ctx, &pb.GetRequest{Id: id})
+}
+
+// RefreshClass returns the current version of a class the caller holds a
+// copy of, and whether it changed. While the class keeps the copy's etag,
+// the adapter answers without the class's fields and RefreshClass returns
+// the copy itself, so polling an unchanged class stays cheap.
+func (c *Client) RefreshClass(ctx context.Context, cached *pb.Class) (*pb.Class, bool, error) {
+	class, err := c.Get(ctx, &pb.GetRequest{Id: cached.Id, IfNoneMatch: cached.Etag})
+	if err != nil {
+		return nil, false, err
+	}
+	if cached.Etag != "" && class.Etag == cached.Etag {
+		return cached, false, nil
+	}
+	return class, true, nil
+}
+
+// ClassExists reports whether a class with the given Id exists.
+func (c *Client) ClassExists(ctx context.Context, id string) (bool, error) {
+	r, err := c.Exists(ctx, &pb.GetRequest{Id: id})
+	if err != nil {
+		return false, err
+	}
+	return r.Exists, nil
+}
+
+// DeleteClass deletes the class with the given Id.
+func (c *Client) DeleteClass(ctx context.Context, id string) error {
+	_, err := c.Delete(ctx, &pb.Class{Id: id})
+	return err
+}
+
+// ListClasses returns every class req selects, reading page after page
+// until the last. req's page_size sets how many classes each call reads,
+// and page_token where the listing starts; req itself isn't changed.
+func (c *Client) ListClasses(ctx context.Context, req *pb.ListRequest) ([]*pb.Class, error) {
+	req = proto.Clone(req).(*pb.ListRequest)
+	var classes []*pb.Class
+	for {
+		page, err := c.List(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, page.Classes...)
+		if page.NextPageToken == "" {
+			return classes, nil
+		}
+		req.PageToken = page.NextPageToken
+	}
+}
+
+// ListClassesBySemester returns every class of semester, reading pages of
+// the server's maximum page size.
+func (c *Client) ListClassesBySemester(ctx context.Context, semester string) ([]*pb.Class, error) {
+	req := &pb.ListBySemesterRequest{Semester: semester, PageSize: c.Policy().MaxPageSize}
+	var classes []*pb.Class
+	for {
+		page, err := c.ListBySemester(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, page.Classes...)
+		if page.NextPageToken == "" {
+			return classes, nil
+		}
+		req.PageToken = page.NextPageToken
+	}
+}
+
+// GetInstructor returns the instructor with the given Id.
+func (c *Client) GetInstructor(ctx context.Context, id string) (*pb.Instructor, error) {
+	return c.Instructors.Get(ctx, &pb.InstructorRequest{Id: id})
+}
+
+// rosterChunkSize is how many bytes of a roster ImportRosterCSV sends per
+// message.
+const rosterChunkSize = 64 << 10
+
+// ImportRosterCSV streams the CSV roster r to ImportRoster, creating or
+// replacing its classes, or with dryRun only checking them. If reading r
+// fails, the call is cancelled and nothing is imported.
+func (c *Client) ImportRosterCSV(ctx context.Context, r io.Reader, dryRun bool) (*pb.ImportRosterResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.ImportRoster(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, rosterChunkSize)
+	first := true
+	for {
+		n, err := r.Read(buf)
+		if n > 0 || first {
+			// A failed Send means the server ended the call; CloseAndRecv
+			// returns why.
+			if stream.Send(&pb.RosterChunk{Data: buf[:n], DryRun: dryRun}) != nil {
+				break
+			}
+			first = false
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
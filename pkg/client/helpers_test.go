@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// classServer serves five classes, two to a page, and records the tenant,
+// token and deadline of the last call.
+type classServer struct {
+	pb.UnimplementedAdapterServer
+
+	tenant, token string
+	deadline      bool
+}
+
+func (s *classServer) record(ctx context.Context) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.tenant, s.token = "", ""
+	if v := md.Get("x-tenant-id"); len(v) > 0 {
+		s.tenant = v[0]
+	}
+	if v := md.Get("authorization"); len(v) > 0 {
+		s.token = v[0]
+	}
+	_, s.deadline = ctx.Deadline()
+}
+
+func (s *classServer) Get(ctx context.Context, in *pb.GetRequest) (*pb.Class, error) {
+	s.record(ctx)
+	if in.Id != "c0" {
+		return nil, status.Errorf(codes.NotFound, "class %s not found", in.Id)
+	}
+	if in.IfNoneMatch == "v1" {
+		return &pb.Class{Id: in.Id, Etag: "v1"}, nil
+	}
+	return &pb.Class{Id: in.Id, Name: "Algebra", Etag: "v1"}, nil
+}
+
+func (s *classServer) List(ctx context.Context, in *pb.ListRequest) (*pb.Classes, error) {
+	s.record(ctx)
+	start := 0
+	if in.PageToken != "" {
+		start, _ = strconv.Atoi(in.PageToken)
+	}
+	cs := &pb.Classes{}
+	for i := start; i < 5 && i < start+2; i++ {
+		cs.Classes = append(cs.Classes, &pb.Class{Id: "c" + strconv.Itoa(i)})
+	}
+	if start+2 < 5 {
+		cs.NextPageToken = strconv.Itoa(start + 2)
+	}
+	return cs, nil
+}
+
+func TestClientHelpers(t *testing.T) {
+	srv := &classServer{}
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithToken("secret"), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := WithTenant(context.Background(), "district-7")
+	if class, err := c.GetClass(ctx, "c0"); err != nil || class.Id != "c0" {
+		t.Fatalf("GetClass = %v, %v; want c0", class, err)
+	}
+	if srv.tenant != "district-7" || srv.token != "Bearer secret" || !srv.deadline {
+		t.Errorf("server saw tenant %q, token %q and deadline %v; want district-7, the token and a default deadline", srv.tenant, srv.token, srv.deadline)
+	}
+	if _, err := c.GetClass(ctx, "missing"); !IsNotFound(err) {
+		t.Errorf("GetClass of a missing class returned %v, want NotFound", err)
+	}
+
+	cached := &pb.Class{Id: "c0", Name: "Algebra", Etag: "v1"}
+	if class, changed, err := c.RefreshClass(ctx, cached); err != nil || changed || class != cached {
+		t.Errorf("RefreshClass of a current copy = %v, %v, %v; want the copy, unchanged", class, changed, err)
+	}
+	stale := &pb.Class{Id: "c0", Name: "Old", Etag: "v0"}
+	if class, changed, err := c.RefreshClass(ctx, stale); err != nil || !changed || class.Name != "Algebra" {
+		t.Errorf("RefreshClass of a stale copy = %v, %v, %v; want Algebra, changed", class, changed, err)
+	}
+
+	req := &pb.ListRequest{PageSize: 2}
+	classes, err := c.ListClasses(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(classes) != 5 || classes[4].Id != "c4" {
+		t.Errorf("ListClasses returned %v, want all 5 classes", classes)
+	}
+	if req.PageToken != "" {
+		t.Errorf("ListClasses changed the caller's request to page token %q", req.PageToken)
+	}
+}
+
+func TestClientWithoutDefaultTimeout(t *testing.T) {
+	srv := &classServer{}
+	c, err := Dial(context.Background(), startServer(t, srv), WithDialOptions(grpc.WithInsecure()), WithDefaultTimeout(0), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.GetClass(context.Background(), "c0"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.deadline {
+		t.Error("call got a deadline with the default timeout disabled")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := c.GetClass(ctx, "c0"); err != nil || !srv.deadline {
+		t.Errorf("call with a deadline of its own got none (%v)", err)
+	}
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Pool spreads calls over connections to several adapters serving the same
+// data, such as the replicas behind a proxy tier. Every connection is dialed
+// up front, so the first calls don't wait for one. It is safe for
+// concurrent use.
+type Pool struct {
+	clients []*Client
+	next    uint32
+}
+
+// DialPool dials every target, failing unless all of them connect.
+func DialPool(ctx context.Context, targets []string, opts ...Option) (*Pool, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("client: no adapters to dial")
+	}
+	p := &Pool{clients: make([]*Client, len(targets))}
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			p.clients[i], errs[i] = Dial(ctx, target, opts...)
+		}(i, target)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("client: dial %s: %w", targets[i], err)
+		}
+	}
+	return p, nil
+}
+
+// Client returns the next connection in turn, skipping those that are
+// failing while any other isn't.
+func (p *Pool) Client() *Client {
+	n := uint32(len(p.clients))
+	start := atomic.AddUint32(&p.next, 1)
+	for i := uint32(0); i < n; i++ {
+		c := p.clients[(start+i)%n]
+		switch c.conn.GetState() {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			continue
+		}
+		return c
+	}
+	return p.clients[start%n]
+}
+
+// Close closes every connection.
+func (p *Pool) Close() error {
+	var err error
+	for _, c := range p.clients {
+		if c == nil {
+			continue
+		}
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Import creates classes over every connection in the pool; see
+// Client.Import.
+func (p *Pool) Import(ctx context.Context, classes []*pb.Class, opts ImportOptions) (*ImportResult, error) {
+	return importClasses(ctx, p.Client, classes, opts)
+}
+
+// ImportOptions tune Import.
+type ImportOptions struct {
+	// Window is how many Creates are in flight at once, 16 if zero.
+	Window int
+	// Progress, if set, is called after every batch of the server's
+	// max_batch_size classes has completed, and once at the end. Calls
+	// don't overlap.
+	Progress func(Progress)
+}
+
+// Progress reports how far an Import has got.
+type Progress struct {
+	Total int
+	// Classes whose Create has completed, including the Failed ones.
+	Done   int
+	Failed int
+}
+
+// ImportResult lists the classes an Import couldn't create.
+type ImportResult struct {
+	Created int
+	Failed  []ImportError
+}
+
+type ImportError struct {
+	Id  string
+	Err error
+}
+
+// Import creates classes for the tenant in ctx, keeping a window of Creates
+// in flight instead of waiting for each before sending the next. A class
+// that fails, after the policy's retries, is recorded in the result and
+// the rest carry on. Import returns an error only if ctx ends first.
+func (c *Client) Import(ctx context.Context, classes []*pb.Class, opts ImportOptions) (*ImportResult, error) {
+	return importClasses(ctx, func() *Client { return c }, classes, opts)
+}
+
+func importClasses(ctx context.Context, pick func() *Client, classes []*pb.Class, opts ImportOptions) (*ImportResult, error) {
+	window := opts.Window
+	if window <= 0 {
+		window = 16
+	}
+	batch := int(pick().Policy().MaxBatchSize)
+	if batch <= 0 {
+		batch = int(DefaultPolicy().MaxBatchSize)
+	}
+
+	result := &ImportResult{}
+	var mu sync.Mutex
+	progress := Progress{Total: len(classes)}
+	report := func() {
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	sem := make(chan struct{}, window)
+	var wg sync.WaitGroup
+	for _, class := range classes {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(class *pb.Class) {
+			defer wg.Done()
+			_, err := pick().Create(ctx, class)
+			<-sem
+
+			mu.Lock()
+			defer mu.Unlock()
+			progress.Done++
+			if err != nil {
+				progress.Failed++
+				result.Failed = append(result.Failed, ImportError{Id: class.Id, Err: err})
+			} else {
+				result.Created++
+			}
+			if progress.Done%batch == 0 && progress.Done < progress.Total {
+				report()
+			}
+		}(class)
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	report()
+	return result, ctx.Err()
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// createServer counts Creates, rejecting Ids starting with "bad".
+type createServer struct {
+	pb.UnimplementedAdapterServer
+
+	mu      sync.Mutex
+	created int
+}
+
+func (s *createServer) GetClientPolicy(ctx context.Context, in *pb.Empty) (*pb.ClientPolicy, error) {
+	return DefaultPolicy(), nil
+}
+
+func (s *createServer) Create(ctx context.Context, in *pb.Class) (*pb.Class, error) {
+	if len(in.Id) >= 3 && in.Id[:3] == "bad" {
+		return nil, status.Error(codes.InvalidArgument, "bad class")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created++
+	return in, nil
+}
+
+func TestPoolImport(t *testing.T) {
+	servers := []*createServer{{}, {}}
+	var targets []string
+	for _, s := range servers {
+		targets = append(targets, startServer(t, s))
+	}
+	p, err := DialPool(context.Background(), targets, WithDialOptions(grpc.WithInsecure()), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var classes []*pb.Class
+	for i := 0; i < 250; i++ {
+		classes = append(classes, &pb.Class{Id: fmt.Sprintf("C%03d", i)})
+	}
+	classes = append(classes, &pb.Class{Id: "bad1"})
+	var reports []Progress
+	result, err := p.Import(context.Background(), classes, ImportOptions{
+		Window:   8,
+		Progress: func(pr Progress) { reports = append(reports, pr) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 250 || len(result.Failed) != 1 || result.Failed[0].Id != "bad1" {
+		t.Errorf("created %d, failed %v; want 250 created and bad1 failed", result.Created, result.Failed)
+	}
+	for _, s := range servers {
+		if s.created == 0 {
+			t.Error("a server in the pool got no Creates")
+		}
+	}
+	if len(reports) != 3 || reports[0].Done != 100 || reports[1].Done != 200 {
+		t.Errorf("progress reports %v, want after 100, 200 and at the end", reports)
+	}
+	if last := reports[len(reports)-1]; last.Done != 251 || last.Failed != 1 || last.Total != 251 {
+		t.Errorf("final progress %+v", last)
+	}
+}
+
+func TestImportStopsWhenCanceled(t *testing.T) {
+	c, err := Dial(context.Background(), startServer(t, &createServer{}), WithDialOptions(grpc.WithInsecure()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Import(ctx, []*pb.Class{{Id: "A"}}, ImportOptions{}); err != context.Canceled {
+		t.Errorf("Import returned %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ServiceConfig returns p as a gRPC service config in JSON, for the
+// unary methods of the services in files: the retry policy for methods
+// marked IDEMPOTENT and the hedging policy for methods marked
+// NO_SIDE_EFFECTS. Other methods, and streams, aren't retried, since
+// sending them twice could apply them twice.
+func ServiceConfig(p *pb.ClientPolicy, files ...protoreflect.FileDescriptor) (string, error) {
+	type name struct {
+		Service string `json:"service"`
+		Method  string `json:"method"`
+	}
+	type retryPolicy struct {
+		MaxAttempts          int32    `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type hedgingPolicy struct {
+		MaxAttempts         int32    `json:"maxAttempts"`
+		HedgingDelay        string   `json:"hedgingDelay"`
+		NonFatalStatusCodes []string `json:"nonFatalStatusCodes,omitempty"`
+	}
+	type methodConfig struct {
+		Name          []name         `json:"name"`
+		RetryPolicy   *retryPolicy   `json:"retryPolicy,omitempty"`
+		HedgingPolicy *hedgingPolicy `json:"hedgingPolicy,omitempty"`
+	}
+
+	var idempotent, noSideEffects []name
+	for _, f := range files {
+		services := f.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				m := methods.Get(j)
+				if m.IsStreamingClient() || m.IsStreamingServer() {
+					continue
+				}
+				n := name{Service: string(m.Parent().FullName()), Method: string(m.Name())}
+				switch idempotencyLevel(m) {
+				case descriptorpb.MethodOptions_IDEMPOTENT:
+					idempotent = append(idempotent, n)
+				case descriptorpb.MethodOptions_NO_SIDE_EFFECTS:
+					noSideEffects = append(noSideEffects, n)
+				}
+			}
+		}
+	}
+
+	var config struct {
+		MethodConfig []methodConfig `json:"methodConfig"`
+	}
+	r := p.RetryPolicy
+	if r != nil && r.MaxAttempts > 1 && len(r.RetryableCodes) > 0 {
+		rp := &retryPolicy{
+			MaxAttempts:          r.MaxAttempts,
+			InitialBackoff:       jsonDuration(r.InitialBackoff.AsDuration()),
+			MaxBackoff:           jsonDuration(r.MaxBackoff.AsDuration()),
+			BackoffMultiplier:    r.BackoffMultiplier,
+			RetryableStatusCodes: r.RetryableCodes,
+		}
+		if len(idempotent) > 0 {
+			config.MethodConfig = append(config.MethodConfig, methodConfig{Name: idempotent, RetryPolicy: rp})
+		}
+		// Without hedging, reads are retried like idempotent calls.
+		if h := p.HedgingPolicy; (h == nil || h.MaxAttempts <= 1) && len(noSideEffects) > 0 {
+			config.MethodConfig = append(config.MethodConfig, methodConfig{Name: noSideEffects, RetryPolicy: rp})
+		}
+	}
+	if h := p.HedgingPolicy; h != nil && h.MaxAttempts > 1 && len(noSideEffects) > 0 {
+		hp := &hedgingPolicy{
+			MaxAttempts:  h.MaxAttempts,
+			HedgingDelay: jsonDuration(h.HedgingDelay.AsDuration()),
+		}
+		if r != nil {
+			hp.NonFatalStatusCodes = r.RetryableCodes
+		}
+		config.MethodConfig = append(config.MethodConfig, methodConfig{Name: noSideEffects, HedgingPolicy: hp})
+	}
+	b, err := json.Marshal(config)
+	return string(b), err
+}
+
+// jsonDuration formats d as the JSON mapping of google.protobuf.Duration,
+// which service configs use.
+func jsonDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+func idempotencyLevel(m protoreflect.MethodDescriptor) descriptorpb.MethodOptions_IdempotencyLevel {
+	opts, ok := m.Options().(*descriptorpb.MethodOptions)
+	if !ok {
+		return descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+	}
+	return opts.GetIdempotencyLevel()
+}
+
+// methodIdempotency returns the idempotency level of a method given by its
+// full gRPC name, e.g. "/class.Adapter/List", or IDEMPOTENCY_UNKNOWN for a
+// method that isn't linked into the program.
+func methodIdempotency(method string) descriptorpb.MethodOptions_IdempotencyLevel {
+	name := strings.Replace(strings.TrimPrefix(method, "/"), "/", ".", 1)
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+	}
+	m, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+	}
+	return idempotencyLevel(m)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	pb "github.com/virtual-class-tutor/class-adapter-file/proto"
+)
+
+func TestServiceConfig(t *testing.T) {
+	config, err := ServiceConfig(DefaultPolicy(), pb.File_proto_class_proto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sc struct {
+		MethodConfig []struct {
+			Name []struct {
+				Service, Method string
+			}
+			RetryPolicy   *struct{ MaxAttempts int }
+			HedgingPolicy *struct{ MaxAttempts int }
+		}
+	}
+	if err := json.Unmarshal([]byte(config), &sc); err != nil {
+		t.Fatal(err)
+	}
+	policies := make(map[string]string)
+	for _, mc := range sc.MethodConfig {
+		for _, n := range mc.Name {
+			switch {
+			case mc.RetryPolicy != nil:
+				policies[n.Service+"/"+n.Method] = "retry"
+			case mc.HedgingPolicy != nil:
+				policies[n.Service+"/"+n.Method] = "hedging"
+			}
+		}
+	}
+	for method, want := range map[string]string{
+		"class.Adapter/Get":               "hedging",
+		"class.Adapter/Update":            "retry",
+		"class.KeyValueStore/Put":         "retry",
+		"class.Adapter/Enroll":            "",
+		"class.Adapter/Watch":             "",
+		"class.Adapter/CreateClassBundle": "",
+	} {
+		if got := policies[method]; got != want {
+			t.Errorf("%s has policy %q, want %q", method, got, want)
+		}
+	}
+
+	// Without hedging, reads are retried.
+	p := DefaultPolicy()
+	p.HedgingPolicy.MaxAttempts = 1
+	config, _ = ServiceConfig(p, pb.File_proto_class_proto)
+	sc.MethodConfig = nil
+	if err := json.Unmarshal([]byte(config), &sc); err != nil {
+		t.Fatal(err)
+	}
+	for _, mc := range sc.MethodConfig {
+		if mc.HedgingPolicy != nil {
+			t.Errorf("service config %s hedges with hedging disabled", config)
+		}
+	}
+}
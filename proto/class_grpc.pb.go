@@ -17,11 +17,133 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type AdapterClient interface {
+	// Lists every class in ascending Id order.
 	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*Classes, error)
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Class, error)
+	Exists(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*ExistsResponse, error)
+	// Returns the class with an Id in an external system. Fails with NotFound
+	// if no class has it.
+	GetByExternalId(ctx context.Context, in *GetByExternalIdRequest, opts ...grpc.CallOption) (*Class, error)
 	Create(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Class, error)
 	Update(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Class, error)
 	Delete(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Empty, error)
+	// Lists the classes of one semester in ascending Id order.
+	ListBySemester(ctx context.Context, in *ListBySemesterRequest, opts ...grpc.CallOption) (*Classes, error)
+	AcquireEditLease(ctx context.Context, in *AcquireEditLeaseRequest, opts ...grpc.CallOption) (*EditLease, error)
+	ReleaseEditLease(ctx context.Context, in *ReleaseEditLeaseRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Moves a class along its lifecycle: DRAFT to PUBLISHED, or PUBLISHED to
+	// CLOSED. Fails with FailedPrecondition for any other change, and
+	// returns the class unchanged if it is already in the requested state.
+	TransitionState(ctx context.Context, in *TransitionStateRequest, opts ...grpc.CallOption) (*Class, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Adapter_WatchClient, error)
+	SaveQuery(ctx context.Context, in *SavedQuery, opts ...grpc.CallOption) (*SavedQuery, error)
+	DeleteSavedQuery(ctx context.Context, in *SavedQueryRequest, opts ...grpc.CallOption) (*Empty, error)
+	ListSavedQueries(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SavedQueries, error)
+	RunSavedQuery(ctx context.Context, in *SavedQueryRequest, opts ...grpc.CallOption) (*Classes, error)
+	// Lists the saved queries of every tenant. Requires an admin token.
+	AdminListSavedQueries(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SavedQueries, error)
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	// Class counts safe to share outside the registrar: groups smaller than
+	// the server's minimum are suppressed.
+	GetAggregateStats(ctx context.Context, in *AggregateStatsRequest, opts ...grpc.CallOption) (*AggregateStats, error)
+	// Describes the Class fields and their validation rules, so generic
+	// clients can render forms without hardcoding the model.
+	DescribeSchema(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Schema, error)
+	// Returns the change history of a class, oldest first, including changes
+	// made before it was deleted. Requires an admin token.
+	GetAuditLog(ctx context.Context, in *AuditLogRequest, opts ...grpc.CallOption) (*AuditLog, error)
+	// Lists classes quarantined because they failed their checksum, with their
+	// fields as stored. Requires an admin token.
+	AdminListQuarantined(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Classes, error)
+	// Resolves a semester's dates, or the semester in session at a given time,
+	// in the institution's time zone.
+	GetSemester(ctx context.Context, in *GetSemesterRequest, opts ...grpc.CallOption) (*Semester, error)
+	// Returns how many classes and enrollments a semester has and when they
+	// last changed, from counters every write keeps up to date rather than a
+	// scan.
+	GetSemesterStats(ctx context.Context, in *GetSemesterStatsRequest, opts ...grpc.CallOption) (*SemesterStats, error)
+	// Exports a tenant's data to an encrypted archive on the server, verifies
+	// the archive, then deletes all of the tenant's data and records a
+	// certificate of completion. Requires an admin token granted the tenant.
+	AdminOffboardTenant(ctx context.Context, in *OffboardTenantRequest, opts ...grpc.CallOption) (*OffboardCertificate, error)
+	// Lists the certificates of the offboarded tenants the token was granted.
+	// Requires an admin token.
+	AdminListOffboardCertificates(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*OffboardCertificates, error)
+	// Returns the limits and retry policy clients should follow, and notices
+	// of deprecated methods. Clients fetch it when they connect and again
+	// every refresh_interval.
+	GetClientPolicy(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ClientPolicy, error)
+	// Creates a class with its sections, their rosters and their meeting
+	// schedules in one transaction, so either all of it is stored or none.
+	// Fails with AlreadyExists if the class exists.
+	CreateClassBundle(ctx context.Context, in *ClassBundle, opts ...grpc.CallOption) (*ClassBundle, error)
+	// Returns a class with its sections in ascending Id order.
+	GetClassBundle(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*ClassBundle, error)
+	// Compacts the database's tables into as few levels as possible, e.g. in
+	// a maintenance window. Requires an admin token.
+	AdminCompact(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*MaintenanceResult, error)
+	// Rewrites the value log files that are at least discard_ratio stale,
+	// reclaiming the space of deleted and overwritten values. Requires an
+	// admin token.
+	AdminRunGC(ctx context.Context, in *RunGCRequest, opts ...grpc.CallOption) (*MaintenanceResult, error)
+	// Reports the size of the database and when it was last maintained, for
+	// dashboards that can't scrape Prometheus.
+	Stats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatsResponse, error)
+	// Moves every class of a semester that has ended, with its sections, out
+	// of the live data into the semester's archive. List, Get and the other
+	// class RPCs no longer see archived classes.
+	ArchiveSemester(ctx context.Context, in *ArchiveSemesterRequest, opts ...grpc.CallOption) (*ArchiveSemesterResponse, error)
+	// Lists the archived classes of a semester in ascending Id order.
+	ListArchived(ctx context.Context, in *ListArchivedRequest, opts ...grpc.CallOption) (*Classes, error)
+	// Enrolls a student in a class. Fails with NotFound if the class doesn't
+	// exist, AlreadyExists if the student is enrolled, and
+	// FailedPrecondition if the class has a capacity and is full.
+	Enroll(ctx context.Context, in *EnrollmentRequest, opts ...grpc.CallOption) (*Enrollment, error)
+	// Removes a student from a class. Fails with NotFound if the student
+	// isn't enrolled.
+	Unenroll(ctx context.Context, in *EnrollmentRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Lists the students enrolled in a class in ascending student Id order.
+	ListEnrollments(ctx context.Context, in *ListEnrollmentsRequest, opts ...grpc.CallOption) (*Enrollments, error)
+	// Returns a class with its prerequisites, their prerequisites and so on.
+	GetPrerequisiteTree(ctx context.Context, in *PrerequisiteTreeRequest, opts ...grpc.CallOption) (*PrerequisiteTree, error)
+	// Deletes every class matching the filter, with its sections and
+	// enrollments, and returns how many were deleted. The classes are deleted
+	// in one transaction, so a call that fails deletes none, unless they are
+	// too many for one. Those are deleted in batches of 100 committed one at
+	// a time, and a call that fails may have deleted some: its error carries
+	// an ErrorInfo with reason BATCH_DELETE_INCOMPLETE whose deleted_count
+	// says how many.
+	// A matching class another session holds an edit lease on fails the call
+	// with FailedPrecondition.
+	BatchDelete(ctx context.Context, in *DeleteFilter, opts ...grpc.CallOption) (*BatchDeleteResponse, error)
+	// Copies a class but its external Ids to a new Id, and optionally a new
+	// semester, and returns the copy. Fails with NotFound if the source doesn't exist and
+	// AlreadyExists if a class has the new Id.
+	Clone(ctx context.Context, in *CloneRequest, opts ...grpc.CallOption) (*Class, error)
+	// Applies a list of creates, updates and deletes in one transaction:
+	// either every operation is stored or, when one fails, none is. Each
+	// operation sees the ones before it.
+	Transact(ctx context.Context, in *TransactRequest, opts ...grpc.CallOption) (*TransactResponse, error)
+	// Returns the server's version and the optional features it supports,
+	// so clients can check for a feature before relying on it.
+	GetServerInfo(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerInfo, error)
+	// Returns the compiled schema of this API, so client generators can fetch
+	// it whether or not the server has reflection enabled.
+	GetApiDescriptor(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ApiDescriptor, error)
+	// Streams the caller's tenant's changes after since_sequence from the
+	// changelog, oldest first, then ends, or with follow keeps streaming new
+	// changes as they commit. Fails with OutOfRange if changes after
+	// since_sequence were already trimmed from the changelog.
+	ReplayChanges(ctx context.Context, in *ReplayChangesRequest, opts ...grpc.CallOption) (Adapter_ReplayChangesClient, error)
+	// Creates or replaces the classes of a CSV roster, one row at a time, and
+	// reports how many rows created or replaced a class and why the others
+	// failed. A failed row doesn't stop the rows after it.
+	ImportRoster(ctx context.Context, opts ...grpc.CallOption) (Adapter_ImportRosterClient, error)
+	// Pulls the active courses of the adapter's Google Classroom account and
+	// creates or updates a class for each, reporting the courses it couldn't
+	// apply. Fails with FailedPrecondition if the adapter isn't configured to
+	// sync, and Aborted if a sync is already running. Requires an admin token.
+	AdminSyncClassroom(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ClassroomSyncResult, error)
 }
 
 type adapterClient struct {
@@ -50,6 +172,24 @@ func (c *adapterClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *adapterClient) Exists(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*ExistsResponse, error) {
+	out := new(ExistsResponse)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Exists", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetByExternalId(ctx context.Context, in *GetByExternalIdRequest, opts ...grpc.CallOption) (*Class, error) {
+	out := new(Class)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetByExternalId", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *adapterClient) Create(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Class, error) {
 	out := new(Class)
 	err := c.cc.Invoke(ctx, "/class.Adapter/Create", in, out, opts...)
@@ -59,181 +199,2196 @@ func (c *adapterClient) Create(ctx context.Context, in *Class, opts ...grpc.Call
 	return out, nil
 }
 
-func (c *adapterClient) Update(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Class, error) {
-	out := new(Class)
-	err := c.cc.Invoke(ctx, "/class.Adapter/Update", in, out, opts...)
+func (c *adapterClient) Update(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Class, error) {
+	out := new(Class)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Delete(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) ListBySemester(ctx context.Context, in *ListBySemesterRequest, opts ...grpc.CallOption) (*Classes, error) {
+	out := new(Classes)
+	err := c.cc.Invoke(ctx, "/class.Adapter/ListBySemester", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) AcquireEditLease(ctx context.Context, in *AcquireEditLeaseRequest, opts ...grpc.CallOption) (*EditLease, error) {
+	out := new(EditLease)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AcquireEditLease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) ReleaseEditLease(ctx context.Context, in *ReleaseEditLeaseRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/class.Adapter/ReleaseEditLease", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) TransitionState(ctx context.Context, in *TransitionStateRequest, opts ...grpc.CallOption) (*Class, error) {
+	out := new(Class)
+	err := c.cc.Invoke(ctx, "/class.Adapter/TransitionState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Adapter_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Adapter_serviceDesc.Streams[0], "/class.Adapter/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adapterWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Adapter_WatchClient interface {
+	Recv() (*ClassEvent, error)
+	grpc.ClientStream
+}
+
+type adapterWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *adapterWatchClient) Recv() (*ClassEvent, error) {
+	m := new(ClassEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adapterClient) SaveQuery(ctx context.Context, in *SavedQuery, opts ...grpc.CallOption) (*SavedQuery, error) {
+	out := new(SavedQuery)
+	err := c.cc.Invoke(ctx, "/class.Adapter/SaveQuery", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) DeleteSavedQuery(ctx context.Context, in *SavedQueryRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/class.Adapter/DeleteSavedQuery", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) ListSavedQueries(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SavedQueries, error) {
+	out := new(SavedQueries)
+	err := c.cc.Invoke(ctx, "/class.Adapter/ListSavedQueries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) RunSavedQuery(ctx context.Context, in *SavedQueryRequest, opts ...grpc.CallOption) (*Classes, error) {
+	out := new(Classes)
+	err := c.cc.Invoke(ctx, "/class.Adapter/RunSavedQuery", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) AdminListSavedQueries(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*SavedQueries, error) {
+	out := new(SavedQueries)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AdminListSavedQueries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Count", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetAggregateStats(ctx context.Context, in *AggregateStatsRequest, opts ...grpc.CallOption) (*AggregateStats, error) {
+	out := new(AggregateStats)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetAggregateStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) DescribeSchema(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Schema, error) {
+	out := new(Schema)
+	err := c.cc.Invoke(ctx, "/class.Adapter/DescribeSchema", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetAuditLog(ctx context.Context, in *AuditLogRequest, opts ...grpc.CallOption) (*AuditLog, error) {
+	out := new(AuditLog)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetAuditLog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) AdminListQuarantined(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Classes, error) {
+	out := new(Classes)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AdminListQuarantined", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetSemester(ctx context.Context, in *GetSemesterRequest, opts ...grpc.CallOption) (*Semester, error) {
+	out := new(Semester)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetSemester", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetSemesterStats(ctx context.Context, in *GetSemesterStatsRequest, opts ...grpc.CallOption) (*SemesterStats, error) {
+	out := new(SemesterStats)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetSemesterStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) AdminOffboardTenant(ctx context.Context, in *OffboardTenantRequest, opts ...grpc.CallOption) (*OffboardCertificate, error) {
+	out := new(OffboardCertificate)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AdminOffboardTenant", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) AdminListOffboardCertificates(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*OffboardCertificates, error) {
+	out := new(OffboardCertificates)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AdminListOffboardCertificates", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetClientPolicy(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ClientPolicy, error) {
+	out := new(ClientPolicy)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetClientPolicy", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) CreateClassBundle(ctx context.Context, in *ClassBundle, opts ...grpc.CallOption) (*ClassBundle, error) {
+	out := new(ClassBundle)
+	err := c.cc.Invoke(ctx, "/class.Adapter/CreateClassBundle", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetClassBundle(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*ClassBundle, error) {
+	out := new(ClassBundle)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetClassBundle", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) AdminCompact(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*MaintenanceResult, error) {
+	out := new(MaintenanceResult)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AdminCompact", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) AdminRunGC(ctx context.Context, in *RunGCRequest, opts ...grpc.CallOption) (*MaintenanceResult, error) {
+	out := new(MaintenanceResult)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AdminRunGC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Stats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Stats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) ArchiveSemester(ctx context.Context, in *ArchiveSemesterRequest, opts ...grpc.CallOption) (*ArchiveSemesterResponse, error) {
+	out := new(ArchiveSemesterResponse)
+	err := c.cc.Invoke(ctx, "/class.Adapter/ArchiveSemester", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) ListArchived(ctx context.Context, in *ListArchivedRequest, opts ...grpc.CallOption) (*Classes, error) {
+	out := new(Classes)
+	err := c.cc.Invoke(ctx, "/class.Adapter/ListArchived", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Enroll(ctx context.Context, in *EnrollmentRequest, opts ...grpc.CallOption) (*Enrollment, error) {
+	out := new(Enrollment)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Enroll", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Unenroll(ctx context.Context, in *EnrollmentRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Unenroll", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) ListEnrollments(ctx context.Context, in *ListEnrollmentsRequest, opts ...grpc.CallOption) (*Enrollments, error) {
+	out := new(Enrollments)
+	err := c.cc.Invoke(ctx, "/class.Adapter/ListEnrollments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetPrerequisiteTree(ctx context.Context, in *PrerequisiteTreeRequest, opts ...grpc.CallOption) (*PrerequisiteTree, error) {
+	out := new(PrerequisiteTree)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetPrerequisiteTree", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) BatchDelete(ctx context.Context, in *DeleteFilter, opts ...grpc.CallOption) (*BatchDeleteResponse, error) {
+	out := new(BatchDeleteResponse)
+	err := c.cc.Invoke(ctx, "/class.Adapter/BatchDelete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Clone(ctx context.Context, in *CloneRequest, opts ...grpc.CallOption) (*Class, error) {
+	out := new(Class)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Clone", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) Transact(ctx context.Context, in *TransactRequest, opts ...grpc.CallOption) (*TransactResponse, error) {
+	out := new(TransactResponse)
+	err := c.cc.Invoke(ctx, "/class.Adapter/Transact", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetServerInfo(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ServerInfo, error) {
+	out := new(ServerInfo)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetServerInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) GetApiDescriptor(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ApiDescriptor, error) {
+	out := new(ApiDescriptor)
+	err := c.cc.Invoke(ctx, "/class.Adapter/GetApiDescriptor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adapterClient) ReplayChanges(ctx context.Context, in *ReplayChangesRequest, opts ...grpc.CallOption) (Adapter_ReplayChangesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Adapter_serviceDesc.Streams[1], "/class.Adapter/ReplayChanges", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adapterReplayChangesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Adapter_ReplayChangesClient interface {
+	Recv() (*ClassEvent, error)
+	grpc.ClientStream
+}
+
+type adapterReplayChangesClient struct {
+	grpc.ClientStream
+}
+
+func (x *adapterReplayChangesClient) Recv() (*ClassEvent, error) {
+	m := new(ClassEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adapterClient) ImportRoster(ctx context.Context, opts ...grpc.CallOption) (Adapter_ImportRosterClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Adapter_serviceDesc.Streams[2], "/class.Adapter/ImportRoster", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adapterImportRosterClient{stream}
+	return x, nil
+}
+
+type Adapter_ImportRosterClient interface {
+	Send(*RosterChunk) error
+	CloseAndRecv() (*ImportRosterResponse, error)
+	grpc.ClientStream
+}
+
+type adapterImportRosterClient struct {
+	grpc.ClientStream
+}
+
+func (x *adapterImportRosterClient) Send(m *RosterChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *adapterImportRosterClient) CloseAndRecv() (*ImportRosterResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportRosterResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adapterClient) AdminSyncClassroom(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ClassroomSyncResult, error) {
+	out := new(ClassroomSyncResult)
+	err := c.cc.Invoke(ctx, "/class.Adapter/AdminSyncClassroom", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdapterServer is the server API for Adapter service.
+// All implementations must embed UnimplementedAdapterServer
+// for forward compatibility
+type AdapterServer interface {
+	// Lists every class in ascending Id order.
+	List(context.Context, *ListRequest) (*Classes, error)
+	Get(context.Context, *GetRequest) (*Class, error)
+	Exists(context.Context, *GetRequest) (*ExistsResponse, error)
+	// Returns the class with an Id in an external system. Fails with NotFound
+	// if no class has it.
+	GetByExternalId(context.Context, *GetByExternalIdRequest) (*Class, error)
+	Create(context.Context, *Class) (*Class, error)
+	Update(context.Context, *Class) (*Class, error)
+	Delete(context.Context, *Class) (*Empty, error)
+	// Lists the classes of one semester in ascending Id order.
+	ListBySemester(context.Context, *ListBySemesterRequest) (*Classes, error)
+	AcquireEditLease(context.Context, *AcquireEditLeaseRequest) (*EditLease, error)
+	ReleaseEditLease(context.Context, *ReleaseEditLeaseRequest) (*Empty, error)
+	// Moves a class along its lifecycle: DRAFT to PUBLISHED, or PUBLISHED to
+	// CLOSED. Fails with FailedPrecondition for any other change, and
+	// returns the class unchanged if it is already in the requested state.
+	TransitionState(context.Context, *TransitionStateRequest) (*Class, error)
+	Watch(*WatchRequest, Adapter_WatchServer) error
+	SaveQuery(context.Context, *SavedQuery) (*SavedQuery, error)
+	DeleteSavedQuery(context.Context, *SavedQueryRequest) (*Empty, error)
+	ListSavedQueries(context.Context, *Empty) (*SavedQueries, error)
+	RunSavedQuery(context.Context, *SavedQueryRequest) (*Classes, error)
+	// Lists the saved queries of every tenant. Requires an admin token.
+	AdminListSavedQueries(context.Context, *Empty) (*SavedQueries, error)
+	Count(context.Context, *CountRequest) (*CountResponse, error)
+	// Class counts safe to share outside the registrar: groups smaller than
+	// the server's minimum are suppressed.
+	GetAggregateStats(context.Context, *AggregateStatsRequest) (*AggregateStats, error)
+	// Describes the Class fields and their validation rules, so generic
+	// clients can render forms without hardcoding the model.
+	DescribeSchema(context.Context, *Empty) (*Schema, error)
+	// Returns the change history of a class, oldest first, including changes
+	// made before it was deleted. Requires an admin token.
+	GetAuditLog(context.Context, *AuditLogRequest) (*AuditLog, error)
+	// Lists classes quarantined because they failed their checksum, with their
+	// fields as stored. Requires an admin token.
+	AdminListQuarantined(context.Context, *Empty) (*Classes, error)
+	// Resolves a semester's dates, or the semester in session at a given time,
+	// in the institution's time zone.
+	GetSemester(context.Context, *GetSemesterRequest) (*Semester, error)
+	// Returns how many classes and enrollments a semester has and when they
+	// last changed, from counters every write keeps up to date rather than a
+	// scan.
+	GetSemesterStats(context.Context, *GetSemesterStatsRequest) (*SemesterStats, error)
+	// Exports a tenant's data to an encrypted archive on the server, verifies
+	// the archive, then deletes all of the tenant's data and records a
+	// certificate of completion. Requires an admin token granted the tenant.
+	AdminOffboardTenant(context.Context, *OffboardTenantRequest) (*OffboardCertificate, error)
+	// Lists the certificates of the offboarded tenants the token was granted.
+	// Requires an admin token.
+	AdminListOffboardCertificates(context.Context, *Empty) (*OffboardCertificates, error)
+	// Returns the limits and retry policy clients should follow, and notices
+	// of deprecated methods. Clients fetch it when they connect and again
+	// every refresh_interval.
+	GetClientPolicy(context.Context, *Empty) (*ClientPolicy, error)
+	// Creates a class with its sections, their rosters and their meeting
+	// schedules in one transaction, so either all of it is stored or none.
+	// Fails with AlreadyExists if the class exists.
+	CreateClassBundle(context.Context, *ClassBundle) (*ClassBundle, error)
+	// Returns a class with its sections in ascending Id order.
+	GetClassBundle(context.Context, *GetRequest) (*ClassBundle, error)
+	// Compacts the database's tables into as few levels as possible, e.g. in
+	// a maintenance window. Requires an admin token.
+	AdminCompact(context.Context, *Empty) (*MaintenanceResult, error)
+	// Rewrites the value log files that are at least discard_ratio stale,
+	// reclaiming the space of deleted and overwritten values. Requires an
+	// admin token.
+	AdminRunGC(context.Context, *RunGCRequest) (*MaintenanceResult, error)
+	// Reports the size of the database and when it was last maintained, for
+	// dashboards that can't scrape Prometheus.
+	Stats(context.Context, *Empty) (*StatsResponse, error)
+	// Moves every class of a semester that has ended, with its sections, out
+	// of the live data into the semester's archive. List, Get and the other
+	// class RPCs no longer see archived classes.
+	ArchiveSemester(context.Context, *ArchiveSemesterRequest) (*ArchiveSemesterResponse, error)
+	// Lists the archived classes of a semester in ascending Id order.
+	ListArchived(context.Context, *ListArchivedRequest) (*Classes, error)
+	// Enrolls a student in a class. Fails with NotFound if the class doesn't
+	// exist, AlreadyExists if the student is enrolled, and
+	// FailedPrecondition if the class has a capacity and is full.
+	Enroll(context.Context, *EnrollmentRequest) (*Enrollment, error)
+	// Removes a student from a class. Fails with NotFound if the student
+	// isn't enrolled.
+	Unenroll(context.Context, *EnrollmentRequest) (*Empty, error)
+	// Lists the students enrolled in a class in ascending student Id order.
+	ListEnrollments(context.Context, *ListEnrollmentsRequest) (*Enrollments, error)
+	// Returns a class with its prerequisites, their prerequisites and so on.
+	GetPrerequisiteTree(context.Context, *PrerequisiteTreeRequest) (*PrerequisiteTree, error)
+	// Deletes every class matching the filter, with its sections and
+	// enrollments, and returns how many were deleted. The classes are deleted
+	// in one transaction, so a call that fails deletes none, unless they are
+	// too many for one. Those are deleted in batches of 100 committed one at
+	// a time, and a call that fails may have deleted some: its error carries
+	// an ErrorInfo with reason BATCH_DELETE_INCOMPLETE whose deleted_count
+	// says how many.
+	// A matching class another session holds an edit lease on fails the call
+	// with FailedPrecondition.
+	BatchDelete(context.Context, *DeleteFilter) (*BatchDeleteResponse, error)
+	// Copies a class but its external Ids to a new Id, and optionally a new
+	// semester, and returns the copy. Fails with NotFound if the source doesn't exist and
+	// AlreadyExists if a class has the new Id.
+	Clone(context.Context, *CloneRequest) (*Class, error)
+	// Applies a list of creates, updates and deletes in one transaction:
+	// either every operation is stored or, when one fails, none is. Each
+	// operation sees the ones before it.
+	Transact(context.Context, *TransactRequest) (*TransactResponse, error)
+	// Returns the server's version and the optional features it supports,
+	// so clients can check for a feature before relying on it.
+	GetServerInfo(context.Context, *Empty) (*ServerInfo, error)
+	// Returns the compiled schema of this API, so client generators can fetch
+	// it whether or not the server has reflection enabled.
+	GetApiDescriptor(context.Context, *Empty) (*ApiDescriptor, error)
+	// Streams the caller's tenant's changes after since_sequence from the
+	// changelog, oldest first, then ends, or with follow keeps streaming new
+	// changes as they commit. Fails with OutOfRange if changes after
+	// since_sequence were already trimmed from the changelog.
+	ReplayChanges(*ReplayChangesRequest, Adapter_ReplayChangesServer) error
+	// Creates or replaces the classes of a CSV roster, one row at a time, and
+	// reports how many rows created or replaced a class and why the others
+	// failed. A failed row doesn't stop the rows after it.
+	ImportRoster(Adapter_ImportRosterServer) error
+	// Pulls the active courses of the adapter's Google Classroom account and
+	// creates or updates a class for each, reporting the courses it couldn't
+	// apply. Fails with FailedPrecondition if the adapter isn't configured to
+	// sync, and Aborted if a sync is already running. Requires an admin token.
+	AdminSyncClassroom(context.Context, *Empty) (*ClassroomSyncResult, error)
+	mustEmbedUnimplementedAdapterServer()
+}
+
+// UnimplementedAdapterServer must be embedded to have forward compatible implementations.
+type UnimplementedAdapterServer struct {
+}
+
+func (UnimplementedAdapterServer) List(context.Context, *ListRequest) (*Classes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedAdapterServer) Get(context.Context, *GetRequest) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedAdapterServer) Exists(context.Context, *GetRequest) (*ExistsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exists not implemented")
+}
+func (UnimplementedAdapterServer) GetByExternalId(context.Context, *GetByExternalIdRequest) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetByExternalId not implemented")
+}
+func (UnimplementedAdapterServer) Create(context.Context, *Class) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedAdapterServer) Update(context.Context, *Class) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedAdapterServer) Delete(context.Context, *Class) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedAdapterServer) ListBySemester(context.Context, *ListBySemesterRequest) (*Classes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBySemester not implemented")
+}
+func (UnimplementedAdapterServer) AcquireEditLease(context.Context, *AcquireEditLeaseRequest) (*EditLease, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AcquireEditLease not implemented")
+}
+func (UnimplementedAdapterServer) ReleaseEditLease(context.Context, *ReleaseEditLeaseRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseEditLease not implemented")
+}
+func (UnimplementedAdapterServer) TransitionState(context.Context, *TransitionStateRequest) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransitionState not implemented")
+}
+func (UnimplementedAdapterServer) Watch(*WatchRequest, Adapter_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedAdapterServer) SaveQuery(context.Context, *SavedQuery) (*SavedQuery, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaveQuery not implemented")
+}
+func (UnimplementedAdapterServer) DeleteSavedQuery(context.Context, *SavedQueryRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSavedQuery not implemented")
+}
+func (UnimplementedAdapterServer) ListSavedQueries(context.Context, *Empty) (*SavedQueries, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSavedQueries not implemented")
+}
+func (UnimplementedAdapterServer) RunSavedQuery(context.Context, *SavedQueryRequest) (*Classes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunSavedQuery not implemented")
+}
+func (UnimplementedAdapterServer) AdminListSavedQueries(context.Context, *Empty) (*SavedQueries, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminListSavedQueries not implemented")
+}
+func (UnimplementedAdapterServer) Count(context.Context, *CountRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedAdapterServer) GetAggregateStats(context.Context, *AggregateStatsRequest) (*AggregateStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAggregateStats not implemented")
+}
+func (UnimplementedAdapterServer) DescribeSchema(context.Context, *Empty) (*Schema, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeSchema not implemented")
+}
+func (UnimplementedAdapterServer) GetAuditLog(context.Context, *AuditLogRequest) (*AuditLog, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAuditLog not implemented")
+}
+func (UnimplementedAdapterServer) AdminListQuarantined(context.Context, *Empty) (*Classes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminListQuarantined not implemented")
+}
+func (UnimplementedAdapterServer) GetSemester(context.Context, *GetSemesterRequest) (*Semester, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSemester not implemented")
+}
+func (UnimplementedAdapterServer) GetSemesterStats(context.Context, *GetSemesterStatsRequest) (*SemesterStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSemesterStats not implemented")
+}
+func (UnimplementedAdapterServer) AdminOffboardTenant(context.Context, *OffboardTenantRequest) (*OffboardCertificate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminOffboardTenant not implemented")
+}
+func (UnimplementedAdapterServer) AdminListOffboardCertificates(context.Context, *Empty) (*OffboardCertificates, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminListOffboardCertificates not implemented")
+}
+func (UnimplementedAdapterServer) GetClientPolicy(context.Context, *Empty) (*ClientPolicy, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClientPolicy not implemented")
+}
+func (UnimplementedAdapterServer) CreateClassBundle(context.Context, *ClassBundle) (*ClassBundle, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateClassBundle not implemented")
+}
+func (UnimplementedAdapterServer) GetClassBundle(context.Context, *GetRequest) (*ClassBundle, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClassBundle not implemented")
+}
+func (UnimplementedAdapterServer) AdminCompact(context.Context, *Empty) (*MaintenanceResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminCompact not implemented")
+}
+func (UnimplementedAdapterServer) AdminRunGC(context.Context, *RunGCRequest) (*MaintenanceResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminRunGC not implemented")
+}
+func (UnimplementedAdapterServer) Stats(context.Context, *Empty) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedAdapterServer) ArchiveSemester(context.Context, *ArchiveSemesterRequest) (*ArchiveSemesterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ArchiveSemester not implemented")
+}
+func (UnimplementedAdapterServer) ListArchived(context.Context, *ListArchivedRequest) (*Classes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListArchived not implemented")
+}
+func (UnimplementedAdapterServer) Enroll(context.Context, *EnrollmentRequest) (*Enrollment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Enroll not implemented")
+}
+func (UnimplementedAdapterServer) Unenroll(context.Context, *EnrollmentRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unenroll not implemented")
+}
+func (UnimplementedAdapterServer) ListEnrollments(context.Context, *ListEnrollmentsRequest) (*Enrollments, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEnrollments not implemented")
+}
+func (UnimplementedAdapterServer) GetPrerequisiteTree(context.Context, *PrerequisiteTreeRequest) (*PrerequisiteTree, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPrerequisiteTree not implemented")
+}
+func (UnimplementedAdapterServer) BatchDelete(context.Context, *DeleteFilter) (*BatchDeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDelete not implemented")
+}
+func (UnimplementedAdapterServer) Clone(context.Context, *CloneRequest) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Clone not implemented")
+}
+func (UnimplementedAdapterServer) Transact(context.Context, *TransactRequest) (*TransactResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Transact not implemented")
+}
+func (UnimplementedAdapterServer) GetServerInfo(context.Context, *Empty) (*ServerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServerInfo not implemented")
+}
+func (UnimplementedAdapterServer) GetApiDescriptor(context.Context, *Empty) (*ApiDescriptor, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetApiDescriptor not implemented")
+}
+func (UnimplementedAdapterServer) ReplayChanges(*ReplayChangesRequest, Adapter_ReplayChangesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReplayChanges not implemented")
+}
+func (UnimplementedAdapterServer) ImportRoster(Adapter_ImportRosterServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportRoster not implemented")
+}
+func (UnimplementedAdapterServer) AdminSyncClassroom(context.Context, *Empty) (*ClassroomSyncResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AdminSyncClassroom not implemented")
+}
+func (UnimplementedAdapterServer) mustEmbedUnimplementedAdapterServer() {}
+
+// UnsafeAdapterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdapterServer will
+// result in compilation errors.
+type UnsafeAdapterServer interface {
+	mustEmbedUnimplementedAdapterServer()
+}
+
+func RegisterAdapterServer(s grpc.ServiceRegistrar, srv AdapterServer) {
+	s.RegisterService(&_Adapter_serviceDesc, srv)
+}
+
+func _Adapter_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Exists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Exists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Exists",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Exists(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetByExternalId_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetByExternalIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetByExternalId(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetByExternalId",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetByExternalId(ctx, req.(*GetByExternalIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Class)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Create",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Create(ctx, req.(*Class))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Class)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Update(ctx, req.(*Class))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Class)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Delete(ctx, req.(*Class))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_ListBySemester_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBySemesterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).ListBySemester(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/ListBySemester",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).ListBySemester(ctx, req.(*ListBySemesterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_AcquireEditLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AcquireEditLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AcquireEditLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AcquireEditLease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AcquireEditLease(ctx, req.(*AcquireEditLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_ReleaseEditLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseEditLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).ReleaseEditLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/ReleaseEditLease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).ReleaseEditLease(ctx, req.(*ReleaseEditLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_TransitionState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransitionStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).TransitionState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/TransitionState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).TransitionState(ctx, req.(*TransitionStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdapterServer).Watch(m, &adapterWatchServer{stream})
+}
+
+type Adapter_WatchServer interface {
+	Send(*ClassEvent) error
+	grpc.ServerStream
+}
+
+type adapterWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *adapterWatchServer) Send(m *ClassEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Adapter_SaveQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SavedQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).SaveQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/SaveQuery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).SaveQuery(ctx, req.(*SavedQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_DeleteSavedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SavedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).DeleteSavedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/DeleteSavedQuery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).DeleteSavedQuery(ctx, req.(*SavedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_ListSavedQueries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).ListSavedQueries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/ListSavedQueries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).ListSavedQueries(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_RunSavedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SavedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).RunSavedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/RunSavedQuery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).RunSavedQuery(ctx, req.(*SavedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_AdminListSavedQueries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AdminListSavedQueries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AdminListSavedQueries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AdminListSavedQueries(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Count",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Count(ctx, req.(*CountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetAggregateStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AggregateStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetAggregateStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetAggregateStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetAggregateStats(ctx, req.(*AggregateStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_DescribeSchema_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).DescribeSchema(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/DescribeSchema",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).DescribeSchema(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetAuditLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetAuditLog(ctx, req.(*AuditLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_AdminListQuarantined_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AdminListQuarantined(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AdminListQuarantined",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AdminListQuarantined(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetSemester_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSemesterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetSemester(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetSemester",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetSemester(ctx, req.(*GetSemesterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetSemesterStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSemesterStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetSemesterStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetSemesterStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetSemesterStats(ctx, req.(*GetSemesterStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_AdminOffboardTenant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OffboardTenantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AdminOffboardTenant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AdminOffboardTenant",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AdminOffboardTenant(ctx, req.(*OffboardTenantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_AdminListOffboardCertificates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AdminListOffboardCertificates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AdminListOffboardCertificates",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AdminListOffboardCertificates(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetClientPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetClientPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetClientPolicy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetClientPolicy(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_CreateClassBundle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClassBundle)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).CreateClassBundle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/CreateClassBundle",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).CreateClassBundle(ctx, req.(*ClassBundle))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetClassBundle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetClassBundle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetClassBundle",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetClassBundle(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_AdminCompact_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AdminCompact(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AdminCompact",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AdminCompact(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_AdminRunGC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunGCRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AdminRunGC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AdminRunGC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AdminRunGC(ctx, req.(*RunGCRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Stats(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_ArchiveSemester_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ArchiveSemesterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).ArchiveSemester(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/ArchiveSemester",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).ArchiveSemester(ctx, req.(*ArchiveSemesterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_ListArchived_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListArchivedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).ListArchived(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/ListArchived",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).ListArchived(ctx, req.(*ListArchivedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Enroll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnrollmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Enroll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Enroll",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Enroll(ctx, req.(*EnrollmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Unenroll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnrollmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Unenroll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Unenroll",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Unenroll(ctx, req.(*EnrollmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_ListEnrollments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEnrollmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).ListEnrollments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/ListEnrollments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).ListEnrollments(ctx, req.(*ListEnrollmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetPrerequisiteTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PrerequisiteTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetPrerequisiteTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetPrerequisiteTree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetPrerequisiteTree(ctx, req.(*PrerequisiteTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_BatchDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFilter)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).BatchDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/BatchDelete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).BatchDelete(ctx, req.(*DeleteFilter))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Clone_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloneRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Clone(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Clone",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Clone(ctx, req.(*CloneRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_Transact_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransactRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).Transact(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/Transact",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).Transact(ctx, req.(*TransactRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetServerInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetServerInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetServerInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetServerInfo(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_GetApiDescriptor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).GetApiDescriptor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/GetApiDescriptor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).GetApiDescriptor(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Adapter_ReplayChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReplayChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdapterServer).ReplayChanges(m, &adapterReplayChangesServer{stream})
+}
+
+type Adapter_ReplayChangesServer interface {
+	Send(*ClassEvent) error
+	grpc.ServerStream
+}
+
+type adapterReplayChangesServer struct {
+	grpc.ServerStream
+}
+
+func (x *adapterReplayChangesServer) Send(m *ClassEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Adapter_ImportRoster_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AdapterServer).ImportRoster(&adapterImportRosterServer{stream})
+}
+
+type Adapter_ImportRosterServer interface {
+	SendAndClose(*ImportRosterResponse) error
+	Recv() (*RosterChunk, error)
+	grpc.ServerStream
+}
+
+type adapterImportRosterServer struct {
+	grpc.ServerStream
+}
+
+func (x *adapterImportRosterServer) SendAndClose(m *ImportRosterResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *adapterImportRosterServer) Recv() (*RosterChunk, error) {
+	m := new(RosterChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Adapter_AdminSyncClassroom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdapterServer).AdminSyncClassroom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.Adapter/AdminSyncClassroom",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdapterServer).AdminSyncClassroom(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Adapter_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "class.Adapter",
+	HandlerType: (*AdapterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _Adapter_List_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Adapter_Get_Handler,
+		},
+		{
+			MethodName: "Exists",
+			Handler:    _Adapter_Exists_Handler,
+		},
+		{
+			MethodName: "GetByExternalId",
+			Handler:    _Adapter_GetByExternalId_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _Adapter_Create_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _Adapter_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Adapter_Delete_Handler,
+		},
+		{
+			MethodName: "ListBySemester",
+			Handler:    _Adapter_ListBySemester_Handler,
+		},
+		{
+			MethodName: "AcquireEditLease",
+			Handler:    _Adapter_AcquireEditLease_Handler,
+		},
+		{
+			MethodName: "ReleaseEditLease",
+			Handler:    _Adapter_ReleaseEditLease_Handler,
+		},
+		{
+			MethodName: "TransitionState",
+			Handler:    _Adapter_TransitionState_Handler,
+		},
+		{
+			MethodName: "SaveQuery",
+			Handler:    _Adapter_SaveQuery_Handler,
+		},
+		{
+			MethodName: "DeleteSavedQuery",
+			Handler:    _Adapter_DeleteSavedQuery_Handler,
+		},
+		{
+			MethodName: "ListSavedQueries",
+			Handler:    _Adapter_ListSavedQueries_Handler,
+		},
+		{
+			MethodName: "RunSavedQuery",
+			Handler:    _Adapter_RunSavedQuery_Handler,
+		},
+		{
+			MethodName: "AdminListSavedQueries",
+			Handler:    _Adapter_AdminListSavedQueries_Handler,
+		},
+		{
+			MethodName: "Count",
+			Handler:    _Adapter_Count_Handler,
+		},
+		{
+			MethodName: "GetAggregateStats",
+			Handler:    _Adapter_GetAggregateStats_Handler,
+		},
+		{
+			MethodName: "DescribeSchema",
+			Handler:    _Adapter_DescribeSchema_Handler,
+		},
+		{
+			MethodName: "GetAuditLog",
+			Handler:    _Adapter_GetAuditLog_Handler,
+		},
+		{
+			MethodName: "AdminListQuarantined",
+			Handler:    _Adapter_AdminListQuarantined_Handler,
+		},
+		{
+			MethodName: "GetSemester",
+			Handler:    _Adapter_GetSemester_Handler,
+		},
+		{
+			MethodName: "GetSemesterStats",
+			Handler:    _Adapter_GetSemesterStats_Handler,
+		},
+		{
+			MethodName: "AdminOffboardTenant",
+			Handler:    _Adapter_AdminOffboardTenant_Handler,
+		},
+		{
+			MethodName: "AdminListOffboardCertificates",
+			Handler:    _Adapter_AdminListOffboardCertificates_Handler,
+		},
+		{
+			MethodName: "GetClientPolicy",
+			Handler:    _Adapter_GetClientPolicy_Handler,
+		},
+		{
+			MethodName: "CreateClassBundle",
+			Handler:    _Adapter_CreateClassBundle_Handler,
+		},
+		{
+			MethodName: "GetClassBundle",
+			Handler:    _Adapter_GetClassBundle_Handler,
+		},
+		{
+			MethodName: "AdminCompact",
+			Handler:    _Adapter_AdminCompact_Handler,
+		},
+		{
+			MethodName: "AdminRunGC",
+			Handler:    _Adapter_AdminRunGC_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _Adapter_Stats_Handler,
+		},
+		{
+			MethodName: "ArchiveSemester",
+			Handler:    _Adapter_ArchiveSemester_Handler,
+		},
+		{
+			MethodName: "ListArchived",
+			Handler:    _Adapter_ListArchived_Handler,
+		},
+		{
+			MethodName: "Enroll",
+			Handler:    _Adapter_Enroll_Handler,
+		},
+		{
+			MethodName: "Unenroll",
+			Handler:    _Adapter_Unenroll_Handler,
+		},
+		{
+			MethodName: "ListEnrollments",
+			Handler:    _Adapter_ListEnrollments_Handler,
+		},
+		{
+			MethodName: "GetPrerequisiteTree",
+			Handler:    _Adapter_GetPrerequisiteTree_Handler,
+		},
+		{
+			MethodName: "BatchDelete",
+			Handler:    _Adapter_BatchDelete_Handler,
+		},
+		{
+			MethodName: "Clone",
+			Handler:    _Adapter_Clone_Handler,
+		},
+		{
+			MethodName: "Transact",
+			Handler:    _Adapter_Transact_Handler,
+		},
+		{
+			MethodName: "GetServerInfo",
+			Handler:    _Adapter_GetServerInfo_Handler,
+		},
+		{
+			MethodName: "GetApiDescriptor",
+			Handler:    _Adapter_GetApiDescriptor_Handler,
+		},
+		{
+			MethodName: "AdminSyncClassroom",
+			Handler:    _Adapter_AdminSyncClassroom_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Adapter_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReplayChanges",
+			Handler:       _Adapter_ReplayChanges_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportRoster",
+			Handler:       _Adapter_ImportRoster_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/class.proto",
+}
+
+// InstructorsClient is the client API for Instructors service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InstructorsClient interface {
+	// Fails with AlreadyExists if the Id is taken.
+	Create(ctx context.Context, in *Instructor, opts ...grpc.CallOption) (*Instructor, error)
+	Get(ctx context.Context, in *InstructorRequest, opts ...grpc.CallOption) (*Instructor, error)
+	// Replaces every field of an existing instructor.
+	Update(ctx context.Context, in *Instructor, opts ...grpc.CallOption) (*Instructor, error)
+	// Fails with FailedPrecondition while classes name the instructor.
+	Delete(ctx context.Context, in *InstructorRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Lists instructors in ascending Id order.
+	List(ctx context.Context, in *ListInstructorsRequest, opts ...grpc.CallOption) (*ListInstructorsResponse, error)
+}
+
+type instructorsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInstructorsClient(cc grpc.ClientConnInterface) InstructorsClient {
+	return &instructorsClient{cc}
+}
+
+func (c *instructorsClient) Create(ctx context.Context, in *Instructor, opts ...grpc.CallOption) (*Instructor, error) {
+	out := new(Instructor)
+	err := c.cc.Invoke(ctx, "/class.Instructors/Create", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instructorsClient) Get(ctx context.Context, in *InstructorRequest, opts ...grpc.CallOption) (*Instructor, error) {
+	out := new(Instructor)
+	err := c.cc.Invoke(ctx, "/class.Instructors/Get", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *adapterClient) Delete(ctx context.Context, in *Class, opts ...grpc.CallOption) (*Empty, error) {
+func (c *instructorsClient) Update(ctx context.Context, in *Instructor, opts ...grpc.CallOption) (*Instructor, error) {
+	out := new(Instructor)
+	err := c.cc.Invoke(ctx, "/class.Instructors/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *instructorsClient) Delete(ctx context.Context, in *InstructorRequest, opts ...grpc.CallOption) (*Empty, error) {
 	out := new(Empty)
-	err := c.cc.Invoke(ctx, "/class.Adapter/Delete", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/class.Instructors/Delete", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// AdapterServer is the server API for Adapter service.
-// All implementations must embed UnimplementedAdapterServer
+func (c *instructorsClient) List(ctx context.Context, in *ListInstructorsRequest, opts ...grpc.CallOption) (*ListInstructorsResponse, error) {
+	out := new(ListInstructorsResponse)
+	err := c.cc.Invoke(ctx, "/class.Instructors/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InstructorsServer is the server API for Instructors service.
+// All implementations must embed UnimplementedInstructorsServer
 // for forward compatibility
-type AdapterServer interface {
-	List(context.Context, *ListRequest) (*Classes, error)
-	Get(context.Context, *GetRequest) (*Class, error)
-	Create(context.Context, *Class) (*Class, error)
-	Update(context.Context, *Class) (*Class, error)
-	Delete(context.Context, *Class) (*Empty, error)
-	mustEmbedUnimplementedAdapterServer()
+type InstructorsServer interface {
+	// Fails with AlreadyExists if the Id is taken.
+	Create(context.Context, *Instructor) (*Instructor, error)
+	Get(context.Context, *InstructorRequest) (*Instructor, error)
+	// Replaces every field of an existing instructor.
+	Update(context.Context, *Instructor) (*Instructor, error)
+	// Fails with FailedPrecondition while classes name the instructor.
+	Delete(context.Context, *InstructorRequest) (*Empty, error)
+	// Lists instructors in ascending Id order.
+	List(context.Context, *ListInstructorsRequest) (*ListInstructorsResponse, error)
+	mustEmbedUnimplementedInstructorsServer()
 }
 
-// UnimplementedAdapterServer must be embedded to have forward compatible implementations.
-type UnimplementedAdapterServer struct {
+// UnimplementedInstructorsServer must be embedded to have forward compatible implementations.
+type UnimplementedInstructorsServer struct {
 }
 
-func (UnimplementedAdapterServer) List(context.Context, *ListRequest) (*Classes, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+func (UnimplementedInstructorsServer) Create(context.Context, *Instructor) (*Instructor, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
 }
-func (UnimplementedAdapterServer) Get(context.Context, *GetRequest) (*Class, error) {
+func (UnimplementedInstructorsServer) Get(context.Context, *InstructorRequest) (*Instructor, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
-func (UnimplementedAdapterServer) Create(context.Context, *Class) (*Class, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
-}
-func (UnimplementedAdapterServer) Update(context.Context, *Class) (*Class, error) {
+func (UnimplementedInstructorsServer) Update(context.Context, *Instructor) (*Instructor, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
 }
-func (UnimplementedAdapterServer) Delete(context.Context, *Class) (*Empty, error) {
+func (UnimplementedInstructorsServer) Delete(context.Context, *InstructorRequest) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
-func (UnimplementedAdapterServer) mustEmbedUnimplementedAdapterServer() {}
+func (UnimplementedInstructorsServer) List(context.Context, *ListInstructorsRequest) (*ListInstructorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedInstructorsServer) mustEmbedUnimplementedInstructorsServer() {}
 
-// UnsafeAdapterServer may be embedded to opt out of forward compatibility for this service.
-// Use of this interface is not recommended, as added methods to AdapterServer will
+// UnsafeInstructorsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InstructorsServer will
 // result in compilation errors.
-type UnsafeAdapterServer interface {
-	mustEmbedUnimplementedAdapterServer()
+type UnsafeInstructorsServer interface {
+	mustEmbedUnimplementedInstructorsServer()
 }
 
-func RegisterAdapterServer(s *grpc.Server, srv AdapterServer) {
-	s.RegisterService(&_Adapter_serviceDesc, srv)
+func RegisterInstructorsServer(s grpc.ServiceRegistrar, srv InstructorsServer) {
+	s.RegisterService(&_Instructors_serviceDesc, srv)
 }
 
-func _Adapter_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ListRequest)
+func _Instructors_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Instructor)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AdapterServer).List(ctx, in)
+		return srv.(InstructorsServer).Create(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/class.Adapter/List",
+		FullMethod: "/class.Instructors/Create",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AdapterServer).List(ctx, req.(*ListRequest))
+		return srv.(InstructorsServer).Create(ctx, req.(*Instructor))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Adapter_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetRequest)
+func _Instructors_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstructorRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AdapterServer).Get(ctx, in)
+		return srv.(InstructorsServer).Get(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/class.Adapter/Get",
+		FullMethod: "/class.Instructors/Get",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AdapterServer).Get(ctx, req.(*GetRequest))
+		return srv.(InstructorsServer).Get(ctx, req.(*InstructorRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Adapter_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Class)
+func _Instructors_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Instructor)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AdapterServer).Create(ctx, in)
+		return srv.(InstructorsServer).Update(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/class.Adapter/Create",
+		FullMethod: "/class.Instructors/Update",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AdapterServer).Create(ctx, req.(*Class))
+		return srv.(InstructorsServer).Update(ctx, req.(*Instructor))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Adapter_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Class)
+func _Instructors_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InstructorRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AdapterServer).Update(ctx, in)
+		return srv.(InstructorsServer).Delete(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/class.Adapter/Update",
+		FullMethod: "/class.Instructors/Delete",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AdapterServer).Update(ctx, req.(*Class))
+		return srv.(InstructorsServer).Delete(ctx, req.(*InstructorRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Adapter_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Class)
+func _Instructors_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListInstructorsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(AdapterServer).Delete(ctx, in)
+		return srv.(InstructorsServer).List(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/class.Adapter/Delete",
+		FullMethod: "/class.Instructors/List",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AdapterServer).Delete(ctx, req.(*Class))
+		return srv.(InstructorsServer).List(ctx, req.(*ListInstructorsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-var _Adapter_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "class.Adapter",
-	HandlerType: (*AdapterServer)(nil),
+var _Instructors_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "class.Instructors",
+	HandlerType: (*InstructorsServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "List",
-			Handler:    _Adapter_List_Handler,
+			MethodName: "Create",
+			Handler:    _Instructors_Create_Handler,
 		},
 		{
 			MethodName: "Get",
-			Handler:    _Adapter_Get_Handler,
+			Handler:    _Instructors_Get_Handler,
 		},
 		{
-			MethodName: "Create",
-			Handler:    _Adapter_Create_Handler,
+			MethodName: "Update",
+			Handler:    _Instructors_Update_Handler,
 		},
 		{
-			MethodName: "Update",
-			Handler:    _Adapter_Update_Handler,
+			MethodName: "Delete",
+			Handler:    _Instructors_Delete_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Instructors_List_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/class.proto",
+}
+
+// KeyValueStoreClient is the client API for KeyValueStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KeyValueStoreClient interface {
+	Put(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*KeyValue, error)
+	Get(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyValue, error)
+	Delete(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Lists a namespace's entries in ascending key order.
+	List(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*KeyValues, error)
+}
+
+type keyValueStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKeyValueStoreClient(cc grpc.ClientConnInterface) KeyValueStoreClient {
+	return &keyValueStoreClient{cc}
+}
+
+func (c *keyValueStoreClient) Put(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*KeyValue, error) {
+	out := new(KeyValue)
+	err := c.cc.Invoke(ctx, "/class.KeyValueStore/Put", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueStoreClient) Get(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyValue, error) {
+	out := new(KeyValue)
+	err := c.cc.Invoke(ctx, "/class.KeyValueStore/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueStoreClient) Delete(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/class.KeyValueStore/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyValueStoreClient) List(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*KeyValues, error) {
+	out := new(KeyValues)
+	err := c.cc.Invoke(ctx, "/class.KeyValueStore/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KeyValueStoreServer is the server API for KeyValueStore service.
+// All implementations must embed UnimplementedKeyValueStoreServer
+// for forward compatibility
+type KeyValueStoreServer interface {
+	Put(context.Context, *KeyValue) (*KeyValue, error)
+	Get(context.Context, *KeyRequest) (*KeyValue, error)
+	Delete(context.Context, *KeyRequest) (*Empty, error)
+	// Lists a namespace's entries in ascending key order.
+	List(context.Context, *ListKeysRequest) (*KeyValues, error)
+	mustEmbedUnimplementedKeyValueStoreServer()
+}
+
+// UnimplementedKeyValueStoreServer must be embedded to have forward compatible implementations.
+type UnimplementedKeyValueStoreServer struct {
+}
+
+func (UnimplementedKeyValueStoreServer) Put(context.Context, *KeyValue) (*KeyValue, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedKeyValueStoreServer) Get(context.Context, *KeyRequest) (*KeyValue, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedKeyValueStoreServer) Delete(context.Context, *KeyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKeyValueStoreServer) List(context.Context, *ListKeysRequest) (*KeyValues, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedKeyValueStoreServer) mustEmbedUnimplementedKeyValueStoreServer() {}
+
+// UnsafeKeyValueStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KeyValueStoreServer will
+// result in compilation errors.
+type UnsafeKeyValueStoreServer interface {
+	mustEmbedUnimplementedKeyValueStoreServer()
+}
+
+func RegisterKeyValueStoreServer(s grpc.ServiceRegistrar, srv KeyValueStoreServer) {
+	s.RegisterService(&_KeyValueStore_serviceDesc, srv)
+}
+
+func _KeyValueStore_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueStoreServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.KeyValueStore/Put",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueStoreServer).Put(ctx, req.(*KeyValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValueStore_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueStoreServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.KeyValueStore/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueStoreServer).Get(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValueStore_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueStoreServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.KeyValueStore/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueStoreServer).Delete(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyValueStore_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyValueStoreServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/class.KeyValueStore/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyValueStoreServer).List(ctx, req.(*ListKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _KeyValueStore_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "class.KeyValueStore",
+	HandlerType: (*KeyValueStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Put",
+			Handler:    _KeyValueStore_Put_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _KeyValueStore_Get_Handler,
 		},
 		{
 			MethodName: "Delete",
-			Handler:    _Adapter_Delete_Handler,
+			Handler:    _KeyValueStore_Delete_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _KeyValueStore_List_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
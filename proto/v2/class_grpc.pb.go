@@ -0,0 +1,258 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package adapterv2
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion7
+
+// ClassesClient is the client API for Classes service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ClassesClient interface {
+	// Lists the caller's classes in ascending Id order unless order_by says
+	// otherwise.
+	ListClasses(ctx context.Context, in *ListClassesRequest, opts ...grpc.CallOption) (*ListClassesResponse, error)
+	// Fails with NotFound if the class doesn't exist.
+	GetClass(ctx context.Context, in *GetClassRequest, opts ...grpc.CallOption) (*Class, error)
+	// Fails with AlreadyExists if a class with the Id exists.
+	CreateClass(ctx context.Context, in *CreateClassRequest, opts ...grpc.CallOption) (*Class, error)
+	// Fails with NotFound if the class doesn't exist.
+	UpdateClass(ctx context.Context, in *UpdateClassRequest, opts ...grpc.CallOption) (*Class, error)
+	// Fails with NotFound if the class doesn't exist, unless allow_missing
+	// is set, and with FailedPrecondition while another session holds an
+	// edit lease on it.
+	DeleteClass(ctx context.Context, in *DeleteClassRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type classesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClassesClient(cc grpc.ClientConnInterface) ClassesClient {
+	return &classesClient{cc}
+}
+
+func (c *classesClient) ListClasses(ctx context.Context, in *ListClassesRequest, opts ...grpc.CallOption) (*ListClassesResponse, error) {
+	out := new(ListClassesResponse)
+	err := c.cc.Invoke(ctx, "/adapter.v2.Classes/ListClasses", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *classesClient) GetClass(ctx context.Context, in *GetClassRequest, opts ...grpc.CallOption) (*Class, error) {
+	out := new(Class)
+	err := c.cc.Invoke(ctx, "/adapter.v2.Classes/GetClass", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *classesClient) CreateClass(ctx context.Context, in *CreateClassRequest, opts ...grpc.CallOption) (*Class, error) {
+	out := new(Class)
+	err := c.cc.Invoke(ctx, "/adapter.v2.Classes/CreateClass", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *classesClient) UpdateClass(ctx context.Context, in *UpdateClassRequest, opts ...grpc.CallOption) (*Class, error) {
+	out := new(Class)
+	err := c.cc.Invoke(ctx, "/adapter.v2.Classes/UpdateClass", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *classesClient) DeleteClass(ctx context.Context, in *DeleteClassRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/adapter.v2.Classes/DeleteClass", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClassesServer is the server API for Classes service.
+// All implementations must embed UnimplementedClassesServer
+// for forward compatibility
+type ClassesServer interface {
+	// Lists the caller's classes in ascending Id order unless order_by says
+	// otherwise.
+	ListClasses(context.Context, *ListClassesRequest) (*ListClassesResponse, error)
+	// Fails with NotFound if the class doesn't exist.
+	GetClass(context.Context, *GetClassRequest) (*Class, error)
+	// Fails with AlreadyExists if a class with the Id exists.
+	CreateClass(context.Context, *CreateClassRequest) (*Class, error)
+	// Fails with NotFound if the class doesn't exist.
+	UpdateClass(context.Context, *UpdateClassRequest) (*Class, error)
+	// Fails with NotFound if the class doesn't exist, unless allow_missing
+	// is set, and with FailedPrecondition while another session holds an
+	// edit lease on it.
+	DeleteClass(context.Context, *DeleteClassRequest) (*emptypb.Empty, error)
+	mustEmbedUnimplementedClassesServer()
+}
+
+// UnimplementedClassesServer must be embedded to have forward compatible implementations.
+type UnimplementedClassesServer struct {
+}
+
+func (UnimplementedClassesServer) ListClasses(context.Context, *ListClassesRequest) (*ListClassesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClasses not implemented")
+}
+func (UnimplementedClassesServer) GetClass(context.Context, *GetClassRequest) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClass not implemented")
+}
+func (UnimplementedClassesServer) CreateClass(context.Context, *CreateClassRequest) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateClass not implemented")
+}
+func (UnimplementedClassesServer) UpdateClass(context.Context, *UpdateClassRequest) (*Class, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateClass not implemented")
+}
+func (UnimplementedClassesServer) DeleteClass(context.Context, *DeleteClassRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteClass not implemented")
+}
+func (UnimplementedClassesServer) mustEmbedUnimplementedClassesServer() {}
+
+// UnsafeClassesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClassesServer will
+// result in compilation errors.
+type UnsafeClassesServer interface {
+	mustEmbedUnimplementedClassesServer()
+}
+
+func RegisterClassesServer(s grpc.ServiceRegistrar, srv ClassesServer) {
+	s.RegisterService(&_Classes_serviceDesc, srv)
+}
+
+func _Classes_ListClasses_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClassesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClassesServer).ListClasses(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/adapter.v2.Classes/ListClasses",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClassesServer).ListClasses(ctx, req.(*ListClassesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Classes_GetClass_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetClassRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClassesServer).GetClass(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/adapter.v2.Classes/GetClass",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClassesServer).GetClass(ctx, req.(*GetClassRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Classes_CreateClass_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateClassRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClassesServer).CreateClass(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/adapter.v2.Classes/CreateClass",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClassesServer).CreateClass(ctx, req.(*CreateClassRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Classes_UpdateClass_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateClassRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClassesServer).UpdateClass(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/adapter.v2.Classes/UpdateClass",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClassesServer).UpdateClass(ctx, req.(*UpdateClassRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Classes_DeleteClass_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteClassRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClassesServer).DeleteClass(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/adapter.v2.Classes/DeleteClass",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClassesServer).DeleteClass(ctx, req.(*DeleteClassRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Classes_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "adapter.v2.Classes",
+	HandlerType: (*ClassesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListClasses",
+			Handler:    _Classes_ListClasses_Handler,
+		},
+		{
+			MethodName: "GetClass",
+			Handler:    _Classes_GetClass_Handler,
+		},
+		{
+			MethodName: "CreateClass",
+			Handler:    _Classes_CreateClass_Handler,
+		},
+		{
+			MethodName: "UpdateClass",
+			Handler:    _Classes_UpdateClass_Handler,
+		},
+		{
+			MethodName: "DeleteClass",
+			Handler:    _Classes_DeleteClass_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/v2/class.proto",
+}